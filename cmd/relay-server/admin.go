@@ -1,14 +1,28 @@
 package main
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
-
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/adminpb"
+	"github.com/portal-project/portal-gateway/portal/capture"
+	"github.com/portal-project/portal-gateway/portal/circuitbreaker"
+	"github.com/portal-project/portal-gateway/portal/healthcheck"
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/metrics"
 	"github.com/portal-project/portal-gateway/portal/middleware"
 	"github.com/portal-project/portal-gateway/portal/quota"
 	"github.com/portal-project/portal-gateway/portal/webhook"
@@ -16,32 +30,175 @@ import (
 
 // AdminHandler handles administrative operations
 type AdminHandler struct {
-	aclConfig    *middleware.ACLConfig
-	quotaManager *quota.Manager
-	dlq          *webhook.DLQ
+	authConfig    *middleware.AuthConfig
+	aclConfig     *middleware.ACLConfig
+	quotaManager  *quota.Manager
+	dlq           *webhook.DLQ
+	captureConfig *capture.MiddlewareConfig
+	retryHandler  *webhook.RetryHandler // Shared by DLQ replays; has no DLQ so failed replays are not re-enqueued
+	healthChecker *healthcheck.Checker  // nil when no upstream health checks are configured
+	breakers      *circuitbreaker.Middleware
+	leaseTokens   *middleware.LeaseTokenSigner // nil when lease tokens are disabled
+
+	// Sources for /admin/overview; nil sources are left out of the snapshot
+	rateLimits   *middleware.RateLimitConfig
+	leaseTracker *metrics.MetricsMiddleware
+	quotaUsage   *quota.UsageReporter
+	tlsConfig    *tls.Config
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(aclConfig *middleware.ACLConfig, quotaManager *quota.Manager, dlq *webhook.DLQ) *AdminHandler {
+// DLQ replays are retried with retryConfig (nil = webhook.DefaultRetryConfig)
+func NewAdminHandler(authConfig *middleware.AuthConfig, aclConfig *middleware.ACLConfig, quotaManager *quota.Manager, dlq *webhook.DLQ, captureConfig *capture.MiddlewareConfig, retryConfig *webhook.RetryConfig) *AdminHandler {
+	if retryConfig == nil {
+		retryConfig = webhook.DefaultRetryConfig()
+	}
+
 	return &AdminHandler{
-		aclConfig:    aclConfig,
-		quotaManager: quotaManager,
-		dlq:          dlq,
+		authConfig:    authConfig,
+		aclConfig:     aclConfig,
+		quotaManager:  quotaManager,
+		dlq:           dlq,
+		captureConfig: captureConfig,
+		retryHandler:  webhook.NewRetryHandler(retryConfig),
 	}
 }
 
+// SetHealthChecker sets the upstream health checker reported by /admin/upstreams
+func (h *AdminHandler) SetHealthChecker(checker *healthcheck.Checker) {
+	h.healthChecker = checker
+}
+
+// SetCircuitBreaker sets the circuit breaker middleware managed by /admin/circuit-breakers
+func (h *AdminHandler) SetCircuitBreaker(breakers *circuitbreaker.Middleware) {
+	h.breakers = breakers
+}
+
+// SetRateLimitConfig sets the rate limiters reported by /admin/overview and managed by /admin/ratelimit
+func (h *AdminHandler) SetRateLimitConfig(config *middleware.RateLimitConfig) {
+	h.rateLimits = config
+}
+
+// SetLeaseTracker sets the metrics middleware whose active leases are reported by /admin/overview
+func (h *AdminHandler) SetLeaseTracker(tracker *metrics.MetricsMiddleware) {
+	h.leaseTracker = tracker
+}
+
+// SetQuotaUsageReporter sets the reporter whose usage summary is reported by /admin/overview
+func (h *AdminHandler) SetQuotaUsageReporter(reporter *quota.UsageReporter) {
+	h.quotaUsage = reporter
+}
+
+// SetLeaseTokenSigner sets the signer used by /admin/lease-tokens; without one, issuing tokens is disabled
+func (h *AdminHandler) SetLeaseTokenSigner(signer *middleware.LeaseTokenSigner) {
+	h.leaseTokens = signer
+}
+
+// SetTLSConfig sets the TLS configuration whose certificate expiry is reported by /admin/overview
+func (h *AdminHandler) SetTLSConfig(config *tls.Config) {
+	h.tlsConfig = config
+}
+
 // ACLRuleRequest represents a request to add/update an ACL rule
 type ACLRuleRequest struct {
-	LeaseID         string   `json:"lease_id"`
-	AllowedKeyIDs   []string `json:"allowed_key_ids"`
-	AllowedIPRanges []string `json:"allowed_ip_ranges,omitempty"` // CIDR notation
+	LeaseID          string   `json:"lease_id"`
+	AllowedKeyIDs    []string `json:"allowed_key_ids"`
+	AllowedKeyGroups []string `json:"allowed_key_groups,omitempty"`
+	AllowedIPRanges  []string `json:"allowed_ip_ranges,omitempty"` // CIDR notation
+
+	AllowedTimeWindows []TimeWindowJSON `json:"allowed_time_windows,omitempty"`
+	TimeZone           string           `json:"time_zone,omitempty"` // IANA name, default UTC
+
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"` // Values may use {lease_id} and {key_id}
+}
+
+// TimeWindowJSON represents a recurring access window in requests and responses
+type TimeWindowJSON struct {
+	Days  []string `json:"days,omitempty"` // e.g. ["mon", "tue"], empty = every day
+	Start string   `json:"start"`          // HH:MM
+	End   string   `json:"end"`            // HH:MM
 }
 
 // ACLRuleResponse represents an ACL rule in responses
 type ACLRuleResponse struct {
-	LeaseID         string   `json:"lease_id"`
-	AllowedKeyIDs   []string `json:"allowed_key_ids"`
-	AllowedIPRanges []string `json:"allowed_ip_ranges,omitempty"`
+	LeaseID          string   `json:"lease_id"`
+	AllowedKeyIDs    []string `json:"allowed_key_ids"`
+	AllowedKeyGroups []string `json:"allowed_key_groups,omitempty"`
+	AllowedIPRanges  []string `json:"allowed_ip_ranges,omitempty"`
+
+	AllowedTimeWindows []TimeWindowJSON `json:"allowed_time_windows,omitempty"`
+	TimeZone           string           `json:"time_zone,omitempty"`
+
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+}
+
+// ACLCheckRequest represents a request to simulate an access decision
+type ACLCheckRequest struct {
+	LeaseID string `json:"lease_id"`
+	KeyID   string `json:"key_id"`
+	IP      string `json:"ip,omitempty"`
+}
+
+// ACLCheckResponse represents a simulated access decision
+type ACLCheckResponse struct {
+	Decision    string           `json:"decision"`               // "allow" or "deny"
+	Reason      string           `json:"reason,omitempty"`       // Set when denied
+	DefaultRule bool             `json:"default_rule,omitempty"` // Set when the default rule, not the lease's rule, denied
+	MatchedRule *ACLRuleResponse `json:"matched_rule,omitempty"`
+}
+
+// KeyGroupRequest represents a request to create or replace a key group
+type KeyGroupRequest struct {
+	Name   string   `json:"name"`
+	KeyIDs []string `json:"key_ids"`
+}
+
+// KeyGroupResponse represents a key group in responses
+type KeyGroupResponse struct {
+	Name   string   `json:"name"`
+	KeyIDs []string `json:"key_ids"`
+}
+
+// LeaseAliasRequest represents a request to alias an old lease ID to a lease
+type LeaseAliasRequest struct {
+	Alias   string `json:"alias"`
+	LeaseID string `json:"lease_id"`
+}
+
+// LeaseAliasResponse represents a lease alias in responses
+type LeaseAliasResponse struct {
+	Alias            string `json:"alias"`
+	LeaseID          string `json:"lease_id"`
+	CanonicalLeaseID string `json:"canonical_lease_id"` // Where the alias resolves after following chained aliases
+}
+
+// LeaseDisableRequest is the optional body of POST /admin/lease/{leaseID}/disable
+type LeaseDisableRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// LeaseStateResponse represents a lease's administrative state in responses
+type LeaseStateResponse struct {
+	LeaseID   string `json:"lease_id"`
+	Enabled   bool   `json:"enabled"`
+	Reason    string `json:"reason,omitempty"`
+	UpdatedAt string `json:"updated_at,omitempty"` // RFC3339 format, unset for leases never disabled
+}
+
+// APIKeyEntry represents an API key in key exports and imports
+// Exports never carry the key value; imports must supply one for every entry
+type APIKeyEntry struct {
+	KeyID       string   `json:"key_id"`
+	Key         string   `json:"key,omitempty"`
+	KeySHA256   string   `json:"key_sha256,omitempty"` // Hex SHA-256 of the key value, only in exports with ?secrets=hash
+	Scopes      []string `json:"scopes"`
+	ExpiresAt   string   `json:"expires_at,omitempty"`   // RFC3339 format
+	GracePeriod string   `json:"grace_period,omitempty"` // e.g. "24h"
+}
+
+// APIKeySet represents the body of a key export or import
+type APIKeySet struct {
+	Keys []APIKeyEntry `json:"keys"`
 }
 
 // ErrorResponse represents an error response
@@ -96,13 +253,38 @@ func (h *AdminHandler) HandleAddACLRule(w http.ResponseWriter, r *http.Request)
 
 	// Create ACL rule
 	rule := &middleware.ACLRule{
-		LeaseID:         req.LeaseID,
-		AllowedKeyIDs:   req.AllowedKeyIDs,
-		AllowedIPRanges: ipNets,
+		LeaseID:          req.LeaseID,
+		AllowedKeyIDs:    req.AllowedKeyIDs,
+		AllowedKeyGroups: req.AllowedKeyGroups,
+		AllowedIPRanges:  ipNets,
+		ResponseHeaders:  req.ResponseHeaders,
+	}
+
+	// Parse time windows if provided
+	for _, window := range req.AllowedTimeWindows {
+		timeWindow, err := middleware.ParseTimeWindow(window.Days, window.Start, window.End)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "invalid_time_window", err.Error())
+			return
+		}
+		rule.AllowedTimeWindows = append(rule.AllowedTimeWindows, timeWindow)
+	}
+
+	if req.TimeZone != "" {
+		loc, err := time.LoadLocation(req.TimeZone)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "invalid_time_zone", err.Error())
+			return
+		}
+		rule.TimeZone = loc
 	}
 
 	// Add rule to configuration
 	if err := h.aclConfig.AddRule(rule); err != nil {
+		if errors.Is(err, middleware.ErrInvalidResponseHeader) {
+			h.sendError(w, http.StatusBadRequest, "invalid_response_header", err.Error())
+			return
+		}
 		h.sendError(w, http.StatusInternalServerError, "add_rule_failed", err.Error())
 		return
 	}
@@ -202,22 +384,101 @@ func (h *AdminHandler) HandleListACLRules(w http.ResponseWriter, r *http.Request
 		responses = append(responses, h.ruleToResponse(rule))
 	}
 
+	h.sendNegotiated(w, r, http.StatusOK, responses, ruleListToProto(responses))
+}
+
+// HandleCheckACL handles POST /admin/acl/check
+// The decision comes from the same check the ACL middleware runs, so it matches live traffic
+func (h *AdminHandler) HandleCheckACL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Parse request body
+	var req ACLCheckRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+
+	if req.LeaseID == "" || req.KeyID == "" {
+		h.sendError(w, http.StatusBadRequest, "validation_failed", "lease_id and key_id are required")
+		return
+	}
+
+	// An omitted IP fails any rule with an IP whitelist, as a request without a client IP would
+	var ip net.IP
+	if req.IP != "" {
+		ip = net.ParseIP(req.IP)
+		if ip == nil {
+			h.sendError(w, http.StatusBadRequest, "invalid_ip", fmt.Sprintf("Invalid IP address %q", req.IP))
+			return
+		}
+	}
+
+	rule, err := h.aclConfig.MatchAccess(req.LeaseID, req.KeyID, ip)
+
+	response := ACLCheckResponse{Decision: "allow"}
+	if err != nil {
+		response.Decision = "deny"
+		response.Reason = aclDenyReason(err)
+		response.DefaultRule = errors.Is(err, middleware.ErrDeniedByDefaultRule)
+	}
+	if rule != nil {
+		ruleResponse := h.ruleToResponse(rule)
+		response.MatchedRule = &ruleResponse
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(responses); err != nil {
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
 		return
 	}
 }
 
+// aclDenyReason maps an access check error to a reason code
+func aclDenyReason(err error) string {
+	switch {
+	case errors.Is(err, middleware.ErrLeaseNotFound):
+		return "lease_not_found"
+	case errors.Is(err, middleware.ErrAccessDenied):
+		return "key_not_allowed"
+	case errors.Is(err, middleware.ErrIPNotWhitelisted):
+		return "ip_not_whitelisted"
+	case errors.Is(err, middleware.ErrOutsideAllowedWindow):
+		return "outside_allowed_window"
+	case errors.Is(err, middleware.ErrInvalidLeaseID):
+		return "invalid_lease_id"
+	case errors.Is(err, middleware.ErrLeaseDisabled):
+		return "lease_disabled"
+	default:
+		return "access_denied"
+	}
+}
+
 // validateACLRuleRequest validates an ACL rule request
 func (h *AdminHandler) validateACLRuleRequest(req *ACLRuleRequest) error {
 	if req.LeaseID == "" {
 		return errors.New("lease_id is required")
 	}
 
-	if len(req.AllowedKeyIDs) == 0 {
-		return errors.New("at least one allowed_key_id is required")
+	if len(req.AllowedKeyIDs) == 0 && len(req.AllowedKeyGroups) == 0 {
+		return errors.New("at least one allowed_key_id or allowed_key_group is required")
+	}
+
+	for _, group := range req.AllowedKeyGroups {
+		if h.aclConfig.GetKeyGroup(group) == nil {
+			return fmt.Errorf("unknown key group %q", group)
+		}
 	}
 
 	return nil
@@ -226,8 +487,10 @@ func (h *AdminHandler) validateACLRuleRequest(req *ACLRuleRequest) error {
 // ruleToResponse converts an ACL rule to a response format
 func (h *AdminHandler) ruleToResponse(rule *middleware.ACLRule) ACLRuleResponse {
 	response := ACLRuleResponse{
-		LeaseID:       rule.LeaseID,
-		AllowedKeyIDs: rule.AllowedKeyIDs,
+		LeaseID:          rule.LeaseID,
+		AllowedKeyIDs:    rule.AllowedKeyIDs,
+		AllowedKeyGroups: rule.AllowedKeyGroups,
+		ResponseHeaders:  rule.ResponseHeaders,
 	}
 
 	// Convert IPNets to CIDR strings
@@ -239,57 +502,114 @@ func (h *AdminHandler) ruleToResponse(rule *middleware.ACLRule) ACLRuleResponse
 		response.AllowedIPRanges = cidrs
 	}
 
+	// Convert time windows to HH:MM form
+	for _, window := range rule.AllowedTimeWindows {
+		days, start, end := window.Format()
+		response.AllowedTimeWindows = append(response.AllowedTimeWindows, TimeWindowJSON{
+			Days:  days,
+			Start: start,
+			End:   end,
+		})
+	}
+
+	if rule.TimeZone != nil {
+		response.TimeZone = rule.TimeZone.String()
+	}
+
 	return response
 }
 
-// extractLeaseIDFromPath extracts the lease ID from a URL path
-func extractLeaseIDFromPath(urlPath, prefix string) string {
-	if !strings.HasPrefix(urlPath, prefix) {
-		return ""
+// ruleListToProto converts ACL rule responses to their protobuf form
+func ruleListToProto(responses []ACLRuleResponse) *adminpb.ACLRuleList {
+	list := &adminpb.ACLRuleList{Rules: make([]*adminpb.ACLRule, 0, len(responses))}
+	for _, response := range responses {
+		rule := &adminpb.ACLRule{
+			LeaseID:          response.LeaseID,
+			AllowedKeyIDs:    response.AllowedKeyIDs,
+			AllowedKeyGroups: response.AllowedKeyGroups,
+			AllowedIPRanges:  response.AllowedIPRanges,
+			TimeZone:         response.TimeZone,
+			ResponseHeaders:  response.ResponseHeaders,
+		}
+		for _, window := range response.AllowedTimeWindows {
+			rule.AllowedTimeWindows = append(rule.AllowedTimeWindows, &adminpb.TimeWindow{
+				Days:  window.Days,
+				Start: window.Start,
+				End:   window.End,
+			})
+		}
+		list.Rules = append(list.Rules, rule)
 	}
+	return list
+}
 
-	leaseID := strings.TrimPrefix(urlPath, prefix)
-	leaseID = strings.TrimSuffix(leaseID, "/")
+// HandleSetKeyGroup handles POST /admin/key-groups
+func (h *AdminHandler) HandleSetKeyGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
 
-	return leaseID
-}
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
 
-// sendError sends an error response
-func (h *AdminHandler) sendError(w http.ResponseWriter, statusCode int, errorCode, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	// Parse request body
+	var req KeyGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
 
-	response := ErrorResponse{
-		Error:   errorCode,
-		Message: message,
+	if req.Name == "" {
+		h.sendError(w, http.StatusBadRequest, "validation_failed", "name is required")
+		return
 	}
 
-	json.NewEncoder(w).Encode(response)
+	// Create or replace the group
+	if err := h.aclConfig.SetKeyGroup(req.Name, req.KeyIDs); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "set_key_group_failed", err.Error())
+		return
+	}
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Key group %s saved successfully", req.Name))
 }
 
-// sendSuccess sends a success response
-func (h *AdminHandler) sendSuccess(w http.ResponseWriter, statusCode int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+// HandleRemoveKeyGroup handles DELETE /admin/key-groups/{name}
+func (h *AdminHandler) HandleRemoveKeyGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE is allowed")
+		return
+	}
 
-	response := SuccessResponse{
-		Success: true,
-		Message: message,
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
 	}
 
-	json.NewEncoder(w).Encode(response)
-}
+	// Extract group name from URL
+	name := extractLeaseIDFromPath(r.URL.Path, "/admin/key-groups/")
+	if name == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key_group", "Key group name is required")
+		return
+	}
 
-// QuotaLimitRequest represents a request to set quota limits
-type QuotaLimitRequest struct {
-	KeyID                 string `json:"key_id"`
-	MonthlyRequestLimit   int64  `json:"monthly_request_limit"`
-	MonthlyBytesLimit     int64  `json:"monthly_bytes_limit"`
-	ConcurrentConnections int    `json:"concurrent_connections"`
+	// Remove group
+	if err := h.aclConfig.RemoveKeyGroup(name); err != nil {
+		h.sendError(w, http.StatusNotFound, "key_group_not_found", err.Error())
+		return
+	}
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Key group %s removed successfully", name))
 }
 
-// HandleGetQuotaStatus handles GET /admin/quota/{keyID}
-func (h *AdminHandler) HandleGetQuotaStatus(w http.ResponseWriter, r *http.Request) {
+// HandleGetKeyGroup handles GET /admin/key-groups/{name}
+func (h *AdminHandler) HandleGetKeyGroup(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
 		return
@@ -302,29 +622,32 @@ func (h *AdminHandler) HandleGetQuotaStatus(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// Extract key ID from URL
-	keyID := extractLeaseIDFromPath(r.URL.Path, "/admin/quota/")
-	if keyID == "" {
-		h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key ID is required")
+	// Extract group name from URL
+	name := extractLeaseIDFromPath(r.URL.Path, "/admin/key-groups/")
+	if name == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key_group", "Key group name is required")
 		return
 	}
 
-	// Get quota status
-	status, err := h.quotaManager.GetStatus(keyID)
-	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, "get_status_failed", err.Error())
+	// Get group
+	keyIDs := h.aclConfig.GetKeyGroup(name)
+	if keyIDs == nil {
+		h.sendError(w, http.StatusNotFound, "key_group_not_found", fmt.Sprintf("No key group named %s", name))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(status)
+	if err := json.NewEncoder(w).Encode(KeyGroupResponse{Name: name, KeyIDs: keyIDs}); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
+		return
+	}
 }
 
-// HandleSetQuotaLimit handles POST /admin/quota/{keyID}
-func (h *AdminHandler) HandleSetQuotaLimit(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+// HandleListKeyGroups handles GET /admin/key-groups
+func (h *AdminHandler) HandleListKeyGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
 		return
 	}
 
@@ -335,40 +658,60 @@ func (h *AdminHandler) HandleSetQuotaLimit(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Parse request body
-	var req QuotaLimitRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+	groups := h.aclConfig.ListKeyGroups()
+
+	// Convert to response format
+	responses := make([]KeyGroupResponse, 0, len(groups))
+	for name, keyIDs := range groups {
+		responses = append(responses, KeyGroupResponse{Name: name, KeyIDs: keyIDs})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
 		return
 	}
+}
 
-	// Validate key ID
-	if req.KeyID == "" {
-		h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key ID is required")
+// HandleSetLeaseAlias handles POST /admin/lease-aliases
+func (h *AdminHandler) HandleSetLeaseAlias(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
 		return
 	}
 
-	// Create quota limit
-	limit := &quota.QuotaLimit{
-		KeyID:                 req.KeyID,
-		MonthlyRequestLimit:   req.MonthlyRequestLimit,
-		MonthlyBytesLimit:     req.MonthlyBytesLimit,
-		ConcurrentConnections: req.ConcurrentConnections,
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
 	}
 
-	// Set limit
-	if err := h.quotaManager.SetLimit(limit); err != nil {
-		h.sendError(w, http.StatusBadRequest, "set_limit_failed", err.Error())
+	// Parse request body
+	var req LeaseAliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
 		return
 	}
 
-	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Quota limit for key %s updated successfully", req.KeyID))
+	// Create or replace the alias
+	if err := h.aclConfig.SetLeaseAlias(req.Alias, req.LeaseID); err != nil {
+		if errors.Is(err, middleware.ErrLeaseAliasCycle) {
+			h.sendError(w, http.StatusBadRequest, "lease_alias_cycle", err.Error())
+			return
+		}
+		h.sendError(w, http.StatusBadRequest, "invalid_lease_alias", err.Error())
+		return
+	}
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Lease %s now resolves to %s", req.Alias, h.aclConfig.ResolveLeaseID(req.Alias)))
 }
 
-// HandleResetQuota handles POST /admin/quota/{keyID}/reset
-func (h *AdminHandler) HandleResetQuota(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+// HandleRemoveLeaseAlias handles DELETE /admin/lease-aliases/{alias}
+func (h *AdminHandler) HandleRemoveLeaseAlias(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE is allowed")
 		return
 	}
 
@@ -379,33 +722,24 @@ func (h *AdminHandler) HandleResetQuota(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Extract key ID from URL (remove "/reset" suffix)
-	path := strings.TrimSuffix(r.URL.Path, "/reset")
-	keyID := extractLeaseIDFromPath(path, "/admin/quota/")
-	if keyID == "" {
-		h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key ID is required")
+	// Extract alias from URL
+	alias := extractLeaseIDFromPath(r.URL.Path, "/admin/lease-aliases/")
+	if alias == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_lease_alias", "Alias is required")
 		return
 	}
 
-	// Reset quota
-	if err := h.quotaManager.ResetQuota(keyID); err != nil {
-		h.sendError(w, http.StatusInternalServerError, "reset_failed", err.Error())
+	// Remove alias
+	if err := h.aclConfig.RemoveLeaseAlias(alias); err != nil {
+		h.sendError(w, http.StatusNotFound, "lease_alias_not_found", err.Error())
 		return
 	}
 
-	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Quota for key %s reset successfully", keyID))
-}
-
-// DLQListResponse represents a list of DLQ entries
-type DLQListResponse struct {
-	Entries []*webhook.DLQEntry `json:"entries"`
-	Total   int                 `json:"total"`
-	Limit   int                 `json:"limit"`
-	Offset  int                 `json:"offset"`
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Lease alias %s removed successfully", alias))
 }
 
-// HandleListDLQ handles GET /admin/dlq
-func (h *AdminHandler) HandleListDLQ(w http.ResponseWriter, r *http.Request) {
+// HandleListLeaseAliases handles GET /admin/lease-aliases
+func (h *AdminHandler) HandleListLeaseAliases(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
 		return
@@ -418,52 +752,1191 @@ func (h *AdminHandler) HandleListDLQ(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Parse query parameters
-	limit := 100
-	offset := 0
+	aliases := h.aclConfig.ListLeaseAliases()
 
-	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
+	// Convert to response format, ordered by alias
+	responses := make([]LeaseAliasResponse, 0, len(aliases))
+	for alias, leaseID := range aliases {
+		responses = append(responses, LeaseAliasResponse{
+			Alias:            alias,
+			LeaseID:          leaseID,
+			CanonicalLeaseID: h.aclConfig.ResolveLeaseID(alias),
+		})
+	}
+	sort.Slice(responses, func(i, j int) bool { return responses[i].Alias < responses[j].Alias })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
+		return
+	}
+}
+
+// HandleSetLeaseEnabled handles POST /admin/lease/{leaseID}/disable and /enable
+// Disabling cuts off every request to the lease at the ACL layer; its rule and upstream are untouched
+func (h *AdminHandler) HandleSetLeaseEnabled(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	path, enabled := strings.CutSuffix(r.URL.Path, "/enable")
+	if !enabled {
+		path = strings.TrimSuffix(r.URL.Path, "/disable")
+	}
+	leaseID := extractLeaseIDFromPath(path, "/admin/lease/")
+	if leaseID == "" || strings.Contains(leaseID, "/") {
+		h.sendError(w, http.StatusBadRequest, "invalid_lease_id", "Lease ID is required")
+		return
+	}
+
+	// The reason is optional, so an empty body still disables the lease at once
+	var req LeaseDisableRequest
+	if !enabled {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+			return
+		}
+	}
+
+	state, err := h.aclConfig.SetLeaseEnabled(leaseID, enabled, req.Reason)
+	if err != nil {
+		if errors.Is(err, middleware.ErrInvalidLeaseID) {
+			h.sendError(w, http.StatusBadRequest, "invalid_lease_id", err.Error())
+			return
+		}
+		h.sendError(w, http.StatusInternalServerError, "lease_state_failed", fmt.Sprintf("Lease state not changed: %v", err))
+		return
+	}
+
+	if enabled {
+		logging.InfoContext(r.Context(), "Lease enabled", "lease_id", leaseID, "admin_key_id", apiKeyInfo.KeyID)
+	} else {
+		logging.WarnContext(r.Context(), "Lease disabled", "lease_id", leaseID, "admin_key_id", apiKeyInfo.KeyID, "reason", req.Reason)
+	}
+
+	h.sendLeaseState(w, state)
+}
+
+// HandleGetLeaseState handles GET /admin/lease/{leaseID}
+func (h *AdminHandler) HandleGetLeaseState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	leaseID := extractLeaseIDFromPath(r.URL.Path, "/admin/lease/")
+	if leaseID == "" || strings.Contains(leaseID, "/") {
+		h.sendError(w, http.StatusBadRequest, "invalid_lease_id", "Lease ID is required")
+		return
+	}
+
+	h.sendLeaseState(w, h.aclConfig.GetLeaseState(leaseID))
+}
+
+// HandleListDisabledLeases handles GET /admin/lease
+func (h *AdminHandler) HandleListDisabledLeases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Convert to response format, ordered by lease ID
+	states := h.aclConfig.ListDisabledLeases()
+	responses := make([]LeaseStateResponse, 0, len(states))
+	for _, state := range states {
+		responses = append(responses, leaseStateToResponse(state))
+	}
+	sort.Slice(responses, func(i, j int) bool { return responses[i].LeaseID < responses[j].LeaseID })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(responses); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
+		return
+	}
+}
+
+// sendLeaseState writes a lease state response
+func (h *AdminHandler) sendLeaseState(w http.ResponseWriter, state *middleware.LeaseState) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(leaseStateToResponse(state)); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
+		return
+	}
+}
+
+// leaseStateToResponse converts a lease state to its response format
+func leaseStateToResponse(state *middleware.LeaseState) LeaseStateResponse {
+	response := LeaseStateResponse{
+		LeaseID: state.LeaseID,
+		Enabled: state.Enabled,
+		Reason:  state.Reason,
+	}
+	if !state.UpdatedAt.IsZero() {
+		response.UpdatedAt = state.UpdatedAt.Format(time.RFC3339)
+	}
+	return response
+}
+
+// HandleExportKeys handles GET /admin/keys/export
+// Key values are redacted, or replaced by their SHA-256 with ?secrets=hash; the result can be
+// posted to /admin/keys/import once a key value is filled in for every entry
+func (h *AdminHandler) HandleExportKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	var hashSecrets bool
+	switch secrets := r.URL.Query().Get("secrets"); secrets {
+	case "", "redact":
+	case "hash":
+		hashSecrets = true
+	default:
+		h.sendError(w, http.StatusBadRequest, "invalid_secrets_mode", fmt.Sprintf("Unknown secrets mode %q, expected redact or hash", secrets))
+		return
+	}
+
+	keys := h.authConfig.ListAPIKeys()
+	export := APIKeySet{Keys: make([]APIKeyEntry, 0, len(keys))}
+	for _, key := range keys {
+		entry := APIKeyEntry{
+			KeyID:  key.KeyID,
+			Scopes: key.Scopes,
+		}
+		if hashSecrets {
+			digest := sha256.Sum256([]byte(key.Key))
+			entry.KeySHA256 = hex.EncodeToString(digest[:])
+		}
+		if key.ExpiresAt != nil {
+			entry.ExpiresAt = key.ExpiresAt.Format(time.RFC3339)
+		}
+		if key.GracePeriod != nil {
+			entry.GracePeriod = key.GracePeriod.String()
+		}
+		export.Keys = append(export.Keys, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(export); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
+		return
+	}
+}
+
+// HandleImportKeys handles POST /admin/keys/import
+// Every entry is validated before any key is added, so a failed import changes nothing
+// Imported keys are held in memory like other admin changes and are not written to the key config
+func (h *AdminHandler) HandleImportKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Parse request body
+	var req APIKeySet
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+
+	if len(req.Keys) == 0 {
+		h.sendError(w, http.StatusBadRequest, "validation_failed", "keys must not be empty")
+		return
+	}
+
+	keys := make([]*middleware.APIKey, 0, len(req.Keys))
+	var errs []error
+	for i, entry := range req.Keys {
+		key, err := parseAPIKeyEntry(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("keys[%d]: %w", i, err))
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(errs) == 0 {
+		if err := h.authConfig.ImportAPIKeys(keys); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		message := strings.ReplaceAll(errors.Join(errs...).Error(), "\n", "; ")
+		h.sendError(w, http.StatusBadRequest, "validation_failed", message)
+		return
+	}
+
+	keyIDs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		keyIDs = append(keyIDs, key.KeyID)
+	}
+	logging.InfoContext(r.Context(), "API keys imported",
+		"event", "api_keys_imported",
+		"imported_by", apiKeyInfo.KeyID,
+		"count", len(keys),
+		"key_ids", keyIDs,
+	)
+
+	h.sendSuccess(w, http.StatusCreated, fmt.Sprintf("Imported %d API keys", len(keys)))
+}
+
+// parseAPIKeyEntry converts an imported key entry to an API key
+func parseAPIKeyEntry(entry APIKeyEntry) (*middleware.APIKey, error) {
+	if entry.Key == "" {
+		return nil, fmt.Errorf("key is required for %q; exports do not include key values", entry.KeyID)
+	}
+
+	key := &middleware.APIKey{
+		Key:    entry.Key,
+		KeyID:  entry.KeyID,
+		Scopes: entry.Scopes,
+	}
+
+	if entry.ExpiresAt != "" {
+		expiresAt, err := time.Parse(time.RFC3339, entry.ExpiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_at (expected RFC3339): %w", err)
+		}
+		key.ExpiresAt = &expiresAt
+	}
+
+	if entry.GracePeriod != "" {
+		gracePeriod, err := time.ParseDuration(entry.GracePeriod)
+		if err != nil || gracePeriod < 0 {
+			return nil, fmt.Errorf("invalid grace_period %q", entry.GracePeriod)
+		}
+		key.GracePeriod = &gracePeriod
+	}
+
+	return key, nil
+}
+
+// Lease token lifetimes
+const (
+	defaultLeaseTokenTTL = time.Hour
+	maxLeaseTokenTTL     = 24 * time.Hour
+)
+
+// LeaseTokenRequest represents a request to issue a temporary lease token
+type LeaseTokenRequest struct {
+	LeaseID  string   `json:"lease_id"`
+	KeyID    string   `json:"key_id"`              // API key the token acts for
+	TTL      string   `json:"ttl,omitempty"`       // Go duration, default 1h, at most 24h
+	Scopes   []string `json:"scopes,omitempty"`    // Default: the key's scopes, minus admin
+	ClientIP string   `json:"client_ip,omitempty"` // Only accept the token from this IP
+}
+
+// LeaseTokenResponse represents an issued lease token
+type LeaseTokenResponse struct {
+	Token     string   `json:"token"`
+	TokenID   string   `json:"token_id"`
+	LeaseID   string   `json:"lease_id"`
+	KeyID     string   `json:"key_id"`
+	Scopes    []string `json:"scopes"`
+	ClientIP  string   `json:"client_ip,omitempty"`
+	ExpiresAt string   `json:"expires_at"`
+}
+
+// HandleIssueLeaseToken handles POST /admin/lease-tokens
+// The token is only returned once; the gateway keeps no record of it
+func (h *AdminHandler) HandleIssueLeaseToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	if h.leaseTokens == nil {
+		h.sendError(w, http.StatusNotImplemented, "lease_tokens_disabled", "Lease tokens are not enabled (see -lease-token-secret-file)")
+		return
+	}
+
+	var req LeaseTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+
+	if req.LeaseID == "" || req.KeyID == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "lease_id and key_id are required")
+		return
+	}
+
+	key := h.authConfig.GetAPIKey(req.KeyID)
+	if key == nil {
+		h.sendError(w, http.StatusNotFound, "key_not_found", fmt.Sprintf("API key %s not found", req.KeyID))
+		return
+	}
+
+	ttl := defaultLeaseTokenTTL
+	if req.TTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(req.TTL)
+		if err != nil || ttl <= 0 || ttl > maxLeaseTokenTTL {
+			h.sendError(w, http.StatusBadRequest, "invalid_ttl", fmt.Sprintf("ttl must be a duration up to %s", maxLeaseTokenTTL))
+			return
+		}
+	}
+
+	// Tokens never carry admin access, and only narrow the key's other scopes
+	scopes := req.Scopes
+	if scopes == nil {
+		for _, scope := range key.Scopes {
+			if scope != "admin" {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	for _, scope := range scopes {
+		if scope == "admin" || !slices.Contains(key.Scopes, scope) {
+			h.sendError(w, http.StatusBadRequest, "invalid_scope", fmt.Sprintf("Scope %q cannot be granted by key %s", scope, req.KeyID))
+			return
+		}
+	}
+
+	// The key must be allowed on the lease, or the token would be refused on every use
+	// IP ranges and time windows are left to the request the token is used on
+	leaseID := h.aclConfig.ResolveLeaseID(req.LeaseID)
+	if _, err := h.aclConfig.MatchAccess(leaseID, req.KeyID, nil); errors.Is(err, middleware.ErrLeaseNotFound) || errors.Is(err, middleware.ErrAccessDenied) {
+		h.sendError(w, http.StatusBadRequest, "access_denied", fmt.Sprintf("Key %s cannot access lease %s: %s", req.KeyID, leaseID, aclDenyReason(err)))
+		return
+	}
+
+	now := time.Now()
+	token := &middleware.LeaseToken{
+		LeaseID:   leaseID,
+		KeyID:     req.KeyID,
+		Scopes:    scopes,
+		ClientIP:  req.ClientIP,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(ttl),
+	}
+	value, err := h.leaseTokens.Sign(token)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	logging.InfoContext(r.Context(), "Lease token issued",
+		"event", "lease_token_issued",
+		"token_id", token.ID,
+		"lease_id", leaseID,
+		"key_id", req.KeyID,
+		"client_ip", req.ClientIP,
+		"expires_at", token.ExpiresAt,
+		"issued_by", apiKeyInfo.KeyID,
+	)
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(LeaseTokenResponse{
+		Token:     value,
+		TokenID:   token.ID,
+		LeaseID:   leaseID,
+		KeyID:     req.KeyID,
+		Scopes:    scopes,
+		ClientIP:  req.ClientIP,
+		ExpiresAt: token.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// extractLeaseIDFromPath extracts the lease ID from a URL path
+func extractLeaseIDFromPath(urlPath, prefix string) string {
+	if !strings.HasPrefix(urlPath, prefix) {
+		return ""
+	}
+
+	leaseID := strings.TrimPrefix(urlPath, prefix)
+	leaseID = strings.TrimSuffix(leaseID, "/")
+
+	return leaseID
+}
+
+// sendError sends an error response
+func (h *AdminHandler) sendError(w http.ResponseWriter, statusCode int, errorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	response := ErrorResponse{
+		Error:   errorCode,
+		Message: message,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendNegotiated sends body as JSON, or message as protobuf if the client's Accept header prefers it
+func (h *AdminHandler) sendNegotiated(w http.ResponseWriter, r *http.Request, statusCode int, body any, message adminpb.Message) {
+	w.Header().Add("Vary", "Accept")
+
+	if adminpb.Negotiate(strings.Join(r.Header.Values("Accept"), ",")) == adminpb.ContentTypeProtobuf {
+		w.Header().Set("Content-Type", adminpb.ContentType(message))
+		w.WriteHeader(statusCode)
+		w.Write(message.Marshal())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+// sendSuccess sends a success response
+func (h *AdminHandler) sendSuccess(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	response := SuccessResponse{
+		Success: true,
+		Message: message,
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// QuotaLimitRequest represents a request to set quota limits
+type QuotaLimitRequest struct {
+	KeyID                 string `json:"key_id"`
+	MonthlyRequestLimit   int64  `json:"monthly_request_limit"`
+	MonthlyBytesLimit     int64  `json:"monthly_bytes_limit"`
+	ConcurrentConnections int    `json:"concurrent_connections"`
+	Period                string `json:"period,omitempty"`
+	RolloverPercent       int    `json:"rollover_percent,omitempty"`
+}
+
+// ActiveConnection is a key's active connection count and its limit
+type ActiveConnection struct {
+	KeyID string `json:"key_id"`
+	Count int    `json:"count"`
+	Limit int    `json:"limit"` // 0 = unlimited
+}
+
+// ActiveConnectionsResponse represents the response for listing active connections
+type ActiveConnectionsResponse struct {
+	Connections []ActiveConnection `json:"connections"`
+	Total       int                `json:"total"` // Sum of all active connections
+}
+
+// HandleListActiveConnections handles GET /admin/connections
+// Keys are sorted by connection count, highest first
+func (h *AdminHandler) HandleListActiveConnections(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	response := ActiveConnectionsResponse{Connections: []ActiveConnection{}}
+	for keyID, count := range h.quotaManager.ListActiveConnections() {
+		response.Connections = append(response.Connections, ActiveConnection{
+			KeyID: keyID,
+			Count: count,
+			Limit: h.quotaManager.GetLimit(keyID).ConcurrentConnections,
+		})
+		response.Total += count
+	}
+
+	sort.Slice(response.Connections, func(i, j int) bool {
+		a, b := response.Connections[i], response.Connections[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.KeyID < b.KeyID
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetQuotaStatus handles GET /admin/quota/{keyID}
+func (h *AdminHandler) HandleGetQuotaStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Extract key ID from URL
+	keyID := extractLeaseIDFromPath(r.URL.Path, "/admin/quota/")
+	if keyID == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key ID is required")
+		return
+	}
+
+	// Get quota status
+	status, err := h.quotaManager.GetStatus(keyID)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "get_status_failed", err.Error())
+		return
+	}
+
+	h.sendNegotiated(w, r, http.StatusOK, status, adminpb.NewQuotaStatus(status))
+}
+
+// HandleSetQuotaLimit handles POST /admin/quota/{keyID}
+func (h *AdminHandler) HandleSetQuotaLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Parse request body
+	var req QuotaLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+
+	// Validate key ID
+	if req.KeyID == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key ID is required")
+		return
+	}
+
+	// Create quota limit
+	limit := &quota.QuotaLimit{
+		KeyID:                 req.KeyID,
+		MonthlyRequestLimit:   req.MonthlyRequestLimit,
+		MonthlyBytesLimit:     req.MonthlyBytesLimit,
+		ConcurrentConnections: req.ConcurrentConnections,
+		Period:                req.Period,
+		RolloverPercent:       req.RolloverPercent,
+	}
+
+	// Set limit
+	if err := h.quotaManager.SetLimit(limit); err != nil {
+		h.sendError(w, http.StatusBadRequest, "set_limit_failed", err.Error())
+		return
+	}
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Quota limit for key %s updated successfully", req.KeyID))
+}
+
+// maxBulkQuotaKeys bounds the keys one bulk quota request may update
+const maxBulkQuotaKeys = 10000
+
+// BulkQuotaLimitRequest represents a request to set the same quota limit for many keys
+// Keys are listed in key_ids or selected by key_prefix among the configured API keys
+type BulkQuotaLimitRequest struct {
+	KeyIDs    []string          `json:"key_ids,omitempty"`
+	KeyPrefix string            `json:"key_prefix,omitempty"`
+	Limit     QuotaLimitRequest `json:"limit"` // key_id is ignored
+}
+
+// BulkQuotaLimitResult is the outcome of a bulk quota update for one key
+type BulkQuotaLimitResult struct {
+	KeyID  string `json:"key_id"`
+	Result string `json:"result"` // "created", "updated" or "unchanged"
+}
+
+// BulkQuotaLimitResponse represents the response for a bulk quota update
+type BulkQuotaLimitResponse struct {
+	Results []BulkQuotaLimitResult `json:"results"`
+	Total   int                    `json:"total"`
+}
+
+// HandleBulkSetQuotaLimit handles POST /admin/quota/bulk
+// The limit is validated once and applied to every key under one lock, so no request sees
+// some keys on the new limit and others on the old one
+func (h *AdminHandler) HandleBulkSetQuotaLimit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	var req BulkQuotaLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+
+	if (len(req.KeyIDs) > 0) == (req.KeyPrefix != "") {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Exactly one of key_ids or key_prefix is required")
+		return
+	}
+
+	keyIDs := req.KeyIDs
+	if req.KeyPrefix != "" {
+		for _, key := range h.authConfig.ListAPIKeys() {
+			if strings.HasPrefix(key.KeyID, req.KeyPrefix) {
+				keyIDs = append(keyIDs, key.KeyID)
+			}
+		}
+		if len(keyIDs) == 0 {
+			h.sendError(w, http.StatusNotFound, "no_matching_keys", fmt.Sprintf("No API keys start with %q", req.KeyPrefix))
+			return
+		}
+	}
+
+	if len(keyIDs) > maxBulkQuotaKeys {
+		h.sendError(w, http.StatusBadRequest, "too_many_keys", fmt.Sprintf("At most %d keys can be updated at once", maxBulkQuotaKeys))
+		return
+	}
+
+	seen := make(map[string]bool, len(keyIDs))
+	limits := make([]*quota.QuotaLimit, 0, len(keyIDs))
+	for _, keyID := range keyIDs {
+		if keyID == "" {
+			h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key IDs cannot be empty")
+			return
+		}
+		if seen[keyID] {
+			continue
+		}
+		seen[keyID] = true
+
+		limits = append(limits, &quota.QuotaLimit{
+			KeyID:                 keyID,
+			MonthlyRequestLimit:   req.Limit.MonthlyRequestLimit,
+			MonthlyBytesLimit:     req.Limit.MonthlyBytesLimit,
+			ConcurrentConnections: req.Limit.ConcurrentConnections,
+			Period:                req.Limit.Period,
+			RolloverPercent:       req.Limit.RolloverPercent,
+		})
+	}
+
+	previous, err := h.quotaManager.SetLimits(limits)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "set_limit_failed", err.Error())
+		return
+	}
+
+	response := BulkQuotaLimitResponse{
+		Results: make([]BulkQuotaLimitResult, len(limits)),
+		Total:   len(limits),
+	}
+	for i, limit := range limits {
+		result := "updated"
+		switch {
+		case previous[i] == nil:
+			result = "created"
+		case *previous[i] == *limit:
+			result = "unchanged"
+		}
+		response.Results[i] = BulkQuotaLimitResult{KeyID: limit.KeyID, Result: result}
+	}
+
+	logging.InfoContext(r.Context(), "Quota limits updated in bulk",
+		"event", "quota_bulk_update",
+		"keys", len(limits),
+		"key_prefix", req.KeyPrefix,
+		"monthly_request_limit", req.Limit.MonthlyRequestLimit,
+		"monthly_bytes_limit", req.Limit.MonthlyBytesLimit,
+		"updated_by", apiKeyInfo.KeyID,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleChangePlan handles POST /admin/quota/{keyID}/plan
+// Replaces the key's limits without resetting usage and returns the recomputed status
+func (h *AdminHandler) HandleChangePlan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Extract key ID from URL (remove "/plan" suffix)
+	path := strings.TrimSuffix(r.URL.Path, "/plan")
+	keyID := extractLeaseIDFromPath(path, "/admin/quota/")
+	if keyID == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key ID is required")
+		return
+	}
+
+	// Parse request body
+	var req QuotaLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+
+	limit := &quota.QuotaLimit{
+		KeyID:                 req.KeyID,
+		MonthlyRequestLimit:   req.MonthlyRequestLimit,
+		MonthlyBytesLimit:     req.MonthlyBytesLimit,
+		ConcurrentConnections: req.ConcurrentConnections,
+		Period:                req.Period,
+		RolloverPercent:       req.RolloverPercent,
+	}
+
+	// Change limit and recompute status atomically
+	status, err := h.quotaManager.ChangePlan(keyID, limit)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "change_plan_failed", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
+		return
+	}
+}
+
+// HandleResetQuota handles POST /admin/quota/{keyID}/reset
+func (h *AdminHandler) HandleResetQuota(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Extract key ID from URL (remove "/reset" suffix)
+	path := strings.TrimSuffix(r.URL.Path, "/reset")
+	keyID := extractLeaseIDFromPath(path, "/admin/quota/")
+	if keyID == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key_id", "Key ID is required")
+		return
+	}
+
+	// Reset quota
+	if err := h.quotaManager.ResetQuota(keyID); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "reset_failed", err.Error())
+		return
+	}
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Quota for key %s reset successfully", keyID))
+}
+
+// DLQListResponse represents a list of DLQ entries
+type DLQListResponse struct {
+	Entries []*webhook.DLQEntry `json:"entries"`
+	Total   int                 `json:"total"`
+	Limit   int                 `json:"limit"`
+	Offset  int                 `json:"offset"`
+}
+
+// HandleListDLQ handles GET /admin/dlq (optionally filtered by ?lease_id= and ?key_id=)
+func (h *AdminHandler) HandleListDLQ(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Parse query parameters
+	limit := 100
+	offset := 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 {
 			limit = l
 		}
 	}
 
-	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
-		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
-			offset = o
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	// Optional tenant filters
+	filter := webhook.DLQFilter{
+		LeaseID: r.URL.Query().Get("lease_id"),
+		KeyID:   r.URL.Query().Get("key_id"),
+	}
+
+	// Get DLQ entries
+	entries, err := h.dlq.ListFiltered(filter, limit, offset)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "list_failed", err.Error())
+		return
+	}
+
+	// Get total count of matching entries
+	total, err := h.dlq.CountFiltered(filter)
+	if err != nil {
+		h.sendError(w, http.StatusInternalServerError, "count_failed", err.Error())
+		return
+	}
+
+	response := DLQListResponse{
+		Entries: entries,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	}
+
+	h.sendNegotiated(w, r, http.StatusOK, response, &adminpb.DLQList{
+		Entries: entries,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+	})
+}
+
+// HandleRetryDLQ handles POST /admin/dlq/{id}/retry
+func (h *AdminHandler) HandleRetryDLQ(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Extract ID from URL (remove "/retry" suffix)
+	path := strings.TrimSuffix(r.URL.Path, "/retry")
+	idStr := extractLeaseIDFromPath(path, "/admin/dlq/")
+	if idStr == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID is required")
+		return
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID must be a number")
+		return
+	}
+
+	// Replay the entry; each call counts against the configured replay cap
+	err = h.dlq.Replay(r.Context(), id, h.retryHandler)
+	switch {
+	case err == nil:
+	case errors.Is(err, webhook.ErrEntryNotFound):
+		h.sendError(w, http.StatusNotFound, "entry_not_found", err.Error())
+		return
+	case errors.Is(err, webhook.ErrMaxReplaysExceeded):
+		h.sendError(w, http.StatusConflict, "max_replays_exceeded", err.Error())
+		return
+	case errors.Is(err, webhook.ErrPermanentlyFailed):
+		h.sendError(w, http.StatusConflict, "permanently_failed", err.Error())
+		return
+	case errors.Is(err, webhook.ErrReplayFailed):
+		h.sendError(w, http.StatusBadGateway, "retry_failed", err.Error())
+		return
+	default:
+		h.sendError(w, http.StatusInternalServerError, "retry_failed", err.Error())
+		return
+	}
+
+	// Replay succeeded, delete from DLQ
+	if err := h.dlq.Delete(id); err != nil {
+		// Log error but don't fail the request
+		logging.WarnContext(r.Context(), "Failed to delete DLQ entry after successful retry",
+			"dlq_id", id,
+			"error", err,
+		)
+	}
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("DLQ entry %d retried successfully", id))
+}
+
+// HandleDeleteDLQ handles DELETE /admin/dlq/{id}
+func (h *AdminHandler) HandleDeleteDLQ(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Extract ID from URL
+	idStr := extractLeaseIDFromPath(r.URL.Path, "/admin/dlq/")
+	if idStr == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID is required")
+		return
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID must be a number")
+		return
+	}
+
+	// Delete entry
+	if err := h.dlq.Delete(id); err != nil {
+		h.sendError(w, http.StatusNotFound, "entry_not_found", err.Error())
+		return
+	}
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("DLQ entry %d deleted successfully", id))
+}
+
+// HandleGetDLQ handles GET /admin/dlq/{id}
+func (h *AdminHandler) HandleGetDLQ(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	// Extract ID from URL
+	idStr := extractLeaseIDFromPath(r.URL.Path, "/admin/dlq/")
+	if idStr == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID is required")
+		return
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID must be a number")
+		return
+	}
+
+	// Get entry
+	entry, err := h.dlq.Get(id)
+	if err != nil {
+		h.sendError(w, http.StatusNotFound, "entry_not_found", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// CaptureRequest represents a request to start payload capture for a lease
+type CaptureRequest struct {
+	SampleRate   float64 `json:"sample_rate,omitempty"`    // Fraction of requests captured, default 0.1
+	Duration     string  `json:"duration,omitempty"`       // e.g. "15m", capped by -capture-max-duration
+	MaxBodyBytes int     `json:"max_body_bytes,omitempty"` // Body bytes kept per request and response
+}
+
+// CaptureSessionResponse represents an active payload capture session
+type CaptureSessionResponse struct {
+	LeaseID      string    `json:"lease_id"`
+	SampleRate   float64   `json:"sample_rate"`
+	MaxBodyBytes int       `json:"max_body_bytes"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Captured     int64     `json:"captured"`
+}
+
+// sessionToResponse converts a capture session to a response format
+func sessionToResponse(session *capture.Session) CaptureSessionResponse {
+	return CaptureSessionResponse{
+		LeaseID:      session.LeaseID,
+		SampleRate:   session.SampleRate,
+		MaxBodyBytes: session.MaxBodyBytes,
+		ExpiresAt:    session.ExpiresAt,
+		Captured:     session.Captured,
+	}
+}
+
+// HandleListCaptures handles GET /admin/capture
+func (h *AdminHandler) HandleListCaptures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	sessions := h.captureConfig.ListSessions()
+	responses := make([]CaptureSessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, sessionToResponse(session))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses)
+}
+
+// HandleStartCapture handles POST /admin/capture/{leaseID}
+// Sampled payloads are written to the log until the session expires or is stopped
+func (h *AdminHandler) HandleStartCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	leaseID := extractLeaseIDFromPath(r.URL.Path, "/admin/capture/")
+	if leaseID == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_lease_id", "Lease ID is required")
+		return
+	}
+
+	// An empty body starts a session with the defaults
+	var req CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON body")
+		return
+	}
+
+	var duration time.Duration
+	if req.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(req.Duration)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, "invalid_duration", err.Error())
+			return
 		}
 	}
 
-	// Get DLQ entries
-	entries, err := h.dlq.List(limit, offset)
+	session, err := h.captureConfig.Start(leaseID, req.SampleRate, duration, req.MaxBodyBytes)
 	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, "list_failed", err.Error())
+		h.sendError(w, http.StatusBadRequest, "invalid_capture", err.Error())
 		return
 	}
 
-	// Get total count
-	total, err := h.dlq.Count()
-	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, "count_failed", err.Error())
+	logging.InfoContext(r.Context(), "Payload capture started",
+		"event", "payload_capture_started",
+		"lease_id", leaseID,
+		"started_by", apiKeyInfo.KeyID,
+		"sample_rate", session.SampleRate,
+		"expires_at", session.ExpiresAt,
+	)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sessionToResponse(session))
+}
+
+// HandleGetCapture handles GET /admin/capture/{leaseID}
+func (h *AdminHandler) HandleGetCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
 		return
 	}
 
-	response := DLQListResponse{
-		Entries: entries,
-		Total:   total,
-		Limit:   limit,
-		Offset:  offset,
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	leaseID := extractLeaseIDFromPath(r.URL.Path, "/admin/capture/")
+	session := h.captureConfig.GetSession(leaseID)
+	if session == nil {
+		h.sendError(w, http.StatusNotFound, "capture_not_found", fmt.Sprintf("No active capture for lease %s", leaseID))
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(sessionToResponse(session))
 }
 
-// HandleRetryDLQ handles POST /admin/dlq/{id}/retry
-func (h *AdminHandler) HandleRetryDLQ(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
+// HandleStopCapture handles DELETE /admin/capture/{leaseID}
+func (h *AdminHandler) HandleStopCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE is allowed")
 		return
 	}
 
@@ -474,68 +1947,182 @@ func (h *AdminHandler) HandleRetryDLQ(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract ID from URL (remove "/retry" suffix)
-	path := strings.TrimSuffix(r.URL.Path, "/retry")
-	idStr := extractLeaseIDFromPath(path, "/admin/dlq/")
-	if idStr == "" {
-		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID is required")
+	leaseID := extractLeaseIDFromPath(r.URL.Path, "/admin/capture/")
+	if err := h.captureConfig.Stop(leaseID); err != nil {
+		h.sendError(w, http.StatusNotFound, "capture_not_found", err.Error())
 		return
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID must be a number")
+	logging.InfoContext(r.Context(), "Payload capture stopped",
+		"event", "payload_capture_stopped",
+		"lease_id", leaseID,
+		"stopped_by", apiKeyInfo.KeyID,
+	)
+
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Payload capture for lease %s stopped", leaseID))
+}
+
+// HandleListUpstreamHealth handles GET /admin/upstreams
+func (h *AdminHandler) HandleListUpstreamHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
 		return
 	}
 
-	// Get entry from DLQ
-	entry, err := h.dlq.Get(id)
-	if err != nil {
-		h.sendError(w, http.StatusNotFound, "entry_not_found", err.Error())
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
 		return
 	}
 
-	// Create retry handler
-	retryHandler := webhook.NewRetryHandler(nil)
+	statuses := []*healthcheck.Status{}
+	if h.healthChecker != nil {
+		statuses = h.healthChecker.Statuses()
+	}
 
-	// Reconstruct request
-	req, err := http.NewRequest(entry.Method, entry.URL, strings.NewReader(string(entry.Body)))
-	if err != nil {
-		h.sendError(w, http.StatusInternalServerError, "request_failed", err.Error())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// HandleGetUpstreamHealth handles GET /admin/upstreams/{leaseID}
+func (h *AdminHandler) HandleGetUpstreamHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
 		return
 	}
 
-	// Set headers
-	for key, values := range entry.Headers {
-		for _, value := range values {
-			req.Header.Add(key, value)
-		}
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
 	}
 
-	// Retry the request
-	resp, err := retryHandler.Do(req)
+	leaseID := extractLeaseIDFromPath(r.URL.Path, "/admin/upstreams/")
+	if h.healthChecker == nil {
+		h.sendError(w, http.StatusNotFound, "health_check_not_found", fmt.Sprintf("No health check for lease %s", leaseID))
+		return
+	}
+
+	status, err := h.healthChecker.Status(leaseID)
 	if err != nil {
-		h.sendError(w, http.StatusBadGateway, "retry_failed", err.Error())
+		h.sendError(w, http.StatusNotFound, "health_check_not_found", fmt.Sprintf("No health check for lease %s", leaseID))
 		return
 	}
-	defer resp.Body.Close()
 
-	// If retry successful, delete from DLQ
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		if err := h.dlq.Delete(id); err != nil {
-			// Log error but don't fail the request
-			fmt.Printf("Failed to delete DLQ entry after successful retry: %v\n", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+// ForceClosedRequest represents a request to override whether a lease bypasses its circuit breaker
+type ForceClosedRequest struct {
+	ForceClosed *bool `json:"force_closed"`
+}
+
+// CircuitBreakerResponse represents a lease's circuit breaker in responses
+type CircuitBreakerResponse struct {
+	LeaseID     string `json:"lease_id"`
+	Endpoint    string `json:"endpoint,omitempty"` // Set for per-endpoint breakers
+	State       string `json:"state,omitempty"`    // Empty until the lease's breaker has seen a request
+	ForceClosed bool   `json:"force_closed"`
+	Overridden  bool   `json:"overridden"` // Set when force_closed comes from the admin API rather than configuration
+}
+
+// HandleListCircuitBreakers handles GET /admin/circuit-breakers
+func (h *AdminHandler) HandleListCircuitBreakers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	breakers := h.breakers.ListBreakers()
+	overrides := h.breakers.ForceClosedOverrides()
+
+	// Breakers are keyed by lease, or by lease and endpoint; overrides are always by lease
+	keys := make([]string, 0, len(breakers)+len(overrides))
+	for key := range breakers {
+		keys = append(keys, key)
+	}
+	for leaseID := range overrides {
+		if _, exists := breakers[leaseID]; !exists {
+			keys = append(keys, leaseID)
+		}
+	}
+	sort.Strings(keys)
+
+	responses := make([]CircuitBreakerResponse, 0, len(keys))
+	for _, key := range keys {
+		leaseID, endpoint := circuitbreaker.SplitBreakerKey(key)
+		_, overridden := overrides[leaseID]
+		response := CircuitBreakerResponse{
+			LeaseID:     leaseID,
+			Endpoint:    endpoint,
+			ForceClosed: h.breakers.IsForceClosed(leaseID),
+			Overridden:  overridden,
+		}
+		if breaker, exists := breakers[key]; exists {
+			response.State = breaker.State().String()
 		}
+		responses = append(responses, response)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(responses)
+}
+
+// HandleSetForceClosed handles PUT /admin/circuit-breakers/{leaseID}/force-closed
+func (h *AdminHandler) HandleSetForceClosed(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only PUT is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	leaseID := extractLeaseIDFromPath(strings.TrimSuffix(r.URL.Path, "/force-closed"), "/admin/circuit-breakers/")
+	if leaseID == "" || strings.Contains(leaseID, "/") {
+		h.sendError(w, http.StatusBadRequest, "invalid_lease_id", "Lease ID is required")
+		return
+	}
 
-		h.sendSuccess(w, http.StatusOK, fmt.Sprintf("DLQ entry %d retried successfully", id))
+	var req ForceClosedRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "Invalid JSON request body")
+		return
+	}
+	if req.ForceClosed == nil {
+		h.sendError(w, http.StatusBadRequest, "invalid_request", "force_closed is required")
 		return
 	}
 
-	h.sendError(w, http.StatusBadGateway, "retry_failed", fmt.Sprintf("Retry failed with status %d", resp.StatusCode))
+	h.breakers.SetForceClosed(leaseID, *req.ForceClosed)
+
+	if *req.ForceClosed {
+		h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Circuit breaker bypassed for lease %s", leaseID))
+		return
+	}
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Circuit breaker enforced for lease %s", leaseID))
 }
 
-// HandleDeleteDLQ handles DELETE /admin/dlq/{id}
-func (h *AdminHandler) HandleDeleteDLQ(w http.ResponseWriter, r *http.Request) {
+// HandleClearForceClosed handles DELETE /admin/circuit-breakers/{leaseID}/force-closed
+// The lease goes back to the -circuit-breaker-force-closed configuration
+func (h *AdminHandler) HandleClearForceClosed(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only DELETE is allowed")
 		return
@@ -548,32 +2135,55 @@ func (h *AdminHandler) HandleDeleteDLQ(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract ID from URL
-	idStr := extractLeaseIDFromPath(r.URL.Path, "/admin/dlq/")
-	if idStr == "" {
-		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID is required")
+	leaseID := extractLeaseIDFromPath(strings.TrimSuffix(r.URL.Path, "/force-closed"), "/admin/circuit-breakers/")
+	if leaseID == "" || strings.Contains(leaseID, "/") {
+		h.sendError(w, http.StatusBadRequest, "invalid_lease_id", "Lease ID is required")
 		return
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID must be a number")
+	h.breakers.ClearForceClosed(leaseID)
+	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("Circuit breaker override removed for lease %s", leaseID))
+}
+
+// LimiterStateResponse represents a rate limiter's bucket in responses
+type LimiterStateResponse struct {
+	Key      string  `json:"key"`
+	Rate     float64 `json:"rate"`
+	Burst    int     `json:"burst"`
+	Tokens   float64 `json:"tokens"`
+	ResetAt  string  `json:"reset_at"` // RFC3339 format; when the next token is available
+	LastUsed string  `json:"last_used"`
+}
+
+// HandleGetLimiterState handles GET /admin/ratelimit/{key}
+// The key is the limiter key, e.g. key:<key ID>, ip:<client IP> or lease:<lease ID>:key:<key ID>
+func (h *AdminHandler) HandleGetLimiterState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
 		return
 	}
 
-	// Delete entry
-	if err := h.dlq.Delete(id); err != nil {
-		h.sendError(w, http.StatusNotFound, "entry_not_found", err.Error())
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
 		return
 	}
 
-	h.sendSuccess(w, http.StatusOK, fmt.Sprintf("DLQ entry %d deleted successfully", id))
+	key := extractLeaseIDFromPath(r.URL.Path, "/admin/ratelimit/")
+	if key == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key", "Limiter key is required")
+		return
+	}
+
+	h.sendLimiterState(w, key)
 }
 
-// HandleGetDLQ handles GET /admin/dlq/{id}
-func (h *AdminHandler) HandleGetDLQ(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+// HandleResetLimiter handles POST /admin/ratelimit/{key}/reset
+// The bucket is refilled, so a client throttled by a since-fixed limit is let through at once
+func (h *AdminHandler) HandleResetLimiter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only POST is allowed")
 		return
 	}
 
@@ -584,27 +2194,208 @@ func (h *AdminHandler) HandleGetDLQ(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract ID from URL
-	idStr := extractLeaseIDFromPath(r.URL.Path, "/admin/dlq/")
-	if idStr == "" {
-		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID is required")
+	key := extractLeaseIDFromPath(strings.TrimSuffix(r.URL.Path, "/reset"), "/admin/ratelimit/")
+	if key == "" {
+		h.sendError(w, http.StatusBadRequest, "invalid_key", "Limiter key is required")
 		return
 	}
 
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		h.sendError(w, http.StatusBadRequest, "invalid_id", "Entry ID must be a number")
+	if h.rateLimits == nil || !h.rateLimits.ResetLimiter(key) {
+		h.sendError(w, http.StatusNotFound, "limiter_not_found", fmt.Sprintf("No rate limiter for %s; it has not been used recently", key))
 		return
 	}
 
-	// Get entry
-	entry, err := h.dlq.Get(id)
-	if err != nil {
-		h.sendError(w, http.StatusNotFound, "entry_not_found", err.Error())
+	logging.InfoContext(r.Context(), "Rate limiter reset", "limiter_key", key, "admin_key_id", apiKeyInfo.KeyID)
+	h.sendLimiterState(w, key)
+}
+
+// sendLimiterState writes the state of the limiter for a key, or a 404 if there is none
+func (h *AdminHandler) sendLimiterState(w http.ResponseWriter, key string) {
+	var state *middleware.LimiterState
+	exists := false
+	if h.rateLimits != nil {
+		state, exists = h.rateLimits.GetLimiterState(key)
+	}
+	if !exists {
+		h.sendError(w, http.StatusNotFound, "limiter_not_found", fmt.Sprintf("No rate limiter for %s; it has not been used recently", key))
 		return
 	}
 
+	response := LimiterStateResponse{
+		Key:      state.Key,
+		Rate:     state.Rate,
+		Burst:    state.Burst,
+		Tokens:   state.Tokens,
+		ResetAt:  state.ResetAt.Format(time.RFC3339),
+		LastUsed: state.LastUsed.Format(time.RFC3339),
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(entry)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		h.sendError(w, http.StatusInternalServerError, "encoding_failed", "Failed to encode response")
+		return
+	}
+}
+
+// OverviewResponse is a snapshot of the gateway's state for status dashboards
+// Sections that are not configured are omitted; sections that failed to load are listed in Errors
+type OverviewResponse struct {
+	GeneratedAt     time.Time                `json:"generated_at"`
+	ACLRules        int                      `json:"acl_rules"`
+	APIKeys         int                      `json:"api_keys"`
+	ActiveLeases    *int                     `json:"active_leases,omitempty"`
+	CircuitBreakers *OverviewCircuitBreakers `json:"circuit_breakers,omitempty"`
+	DLQ             *OverviewDLQ             `json:"dlq,omitempty"`
+	RateLimiters    *OverviewRateLimiters    `json:"rate_limiters,omitempty"`
+	Quota           *OverviewQuota           `json:"quota,omitempty"`
+	TLS             *OverviewTLS             `json:"tls,omitempty"`
+	Errors          map[string]string        `json:"errors,omitempty"`
+}
+
+// OverviewCircuitBreakers counts circuit breakers by state
+type OverviewCircuitBreakers struct {
+	Total       int      `json:"total"`
+	Open        int      `json:"open"`
+	HalfOpen    int      `json:"half_open"`
+	OpenLeases  []string `json:"open_leases"` // Breaker keys: lease IDs, or lease/endpoint with per-endpoint breakers
+	ForceClosed int      `json:"force_closed_overrides"`
+}
+
+// OverviewDLQ summarizes the dead letter queue
+type OverviewDLQ struct {
+	Entries          int     `json:"entries"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"` // 0 when empty
+}
+
+// OverviewRateLimiters reports the rate limiter cache
+type OverviewRateLimiters struct {
+	ActiveLimiters int `json:"active_limiters"`
+	TrackedKeys    int `json:"tracked_keys"`
+}
+
+// OverviewQuota reports the quota usage summary from the last usage scan
+type OverviewQuota struct {
+	NearLimitKeys int       `json:"near_limit_keys"`
+	ExceededKeys  int       `json:"exceeded_keys"`
+	ScannedAt     time.Time `json:"scanned_at"`
+}
+
+// OverviewTLS reports the served certificate
+type OverviewTLS struct {
+	CertNotAfter     time.Time `json:"cert_not_after"`
+	ExpiresInSeconds float64   `json:"expires_in_seconds"` // Negative once expired
+}
+
+// HandleOverview handles GET /admin/overview
+// Every section comes from state the gateway already keeps, so the call is cheap to poll
+func (h *AdminHandler) HandleOverview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendError(w, http.StatusMethodNotAllowed, "method_not_allowed", "Only GET is allowed")
+		return
+	}
+
+	// Check if requester has admin scope
+	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+	if apiKeyInfo == nil || !apiKeyInfo.HasScope("admin") {
+		h.sendError(w, http.StatusForbidden, "insufficient_permissions", "Admin scope required")
+		return
+	}
+
+	now := time.Now()
+	response := OverviewResponse{
+		GeneratedAt: now,
+		ACLRules:    len(h.aclConfig.ListRules()),
+		APIKeys:     len(h.authConfig.ListAPIKeys()),
+	}
+	addError := func(section string, err error) {
+		if response.Errors == nil {
+			response.Errors = make(map[string]string)
+		}
+		response.Errors[section] = err.Error()
+	}
+
+	if h.leaseTracker != nil {
+		activeLeases := h.leaseTracker.ActiveLeases()
+		response.ActiveLeases = &activeLeases
+	}
+
+	if h.breakers != nil {
+		breakers := &OverviewCircuitBreakers{
+			OpenLeases:  []string{},
+			ForceClosed: len(h.breakers.ForceClosedOverrides()),
+		}
+		for key, breaker := range h.breakers.ListBreakers() {
+			breakers.Total++
+			switch breaker.State() {
+			case circuitbreaker.StateOpen:
+				breakers.Open++
+				breakers.OpenLeases = append(breakers.OpenLeases, key)
+			case circuitbreaker.StateHalfOpen:
+				breakers.HalfOpen++
+			}
+		}
+		sort.Strings(breakers.OpenLeases)
+		response.CircuitBreakers = breakers
+	}
+
+	if h.dlq != nil {
+		if count, err := h.dlq.Count(); err != nil {
+			addError("dlq", err)
+		} else if oldest, err := h.dlq.OldestCreatedAt(); err != nil {
+			addError("dlq", err)
+		} else {
+			response.DLQ = &OverviewDLQ{Entries: count}
+			if !oldest.IsZero() {
+				response.DLQ.OldestAgeSeconds = max(now.Sub(oldest).Seconds(), 0)
+			}
+		}
+	}
+
+	if h.rateLimits != nil {
+		activeLimiters, trackedKeys := h.rateLimits.GetStats()
+		response.RateLimiters = &OverviewRateLimiters{ActiveLimiters: activeLimiters, TrackedKeys: trackedKeys}
+	}
+
+	if h.quotaUsage != nil {
+		// Reuses the periodic scan behind the quota gauges rather than scanning all usage here
+		if summary, scannedAt := h.quotaUsage.Summary(); summary != nil {
+			response.Quota = &OverviewQuota{
+				NearLimitKeys: summary.NearLimit,
+				ExceededKeys:  summary.Exceeded,
+				ScannedAt:     scannedAt,
+			}
+		}
+	}
+
+	if h.tlsConfig != nil && len(h.tlsConfig.Certificates) > 0 {
+		if notAfter, err := certificateNotAfter(h.tlsConfig.Certificates[0]); err != nil {
+			addError("tls", err)
+		} else {
+			response.TLS = &OverviewTLS{
+				CertNotAfter:     notAfter,
+				ExpiresInSeconds: notAfter.Sub(now).Seconds(),
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// certificateNotAfter returns when a certificate expires
+func certificateNotAfter(cert tls.Certificate) (time.Time, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf.NotAfter, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return time.Time{}, errors.New("certificate is empty")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return leaf.NotAfter, nil
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// adminUIAssets holds the static admin console
+//
+//go:embed adminui
+var adminUIAssets embed.FS
+
+// newAdminUIHandler serves the admin console under /admin/ui/
+// It is mounted behind auth and the admin scope; the console also sends the key with
+// every call to the admin JSON endpoints
+func newAdminUIHandler() http.Handler {
+	assets, err := fs.Sub(adminUIAssets, "adminui")
+	if err != nil {
+		panic(err) // The directory is embedded at build time
+	}
+
+	fileServer := http.StripPrefix("/admin/ui/", http.FileServer(http.FS(assets)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// The console must not be framed or load anything from elsewhere
+		w.Header().Set("Content-Security-Policy", "default-src 'self'; frame-ancestors 'none'")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Cache-Control", "no-cache")
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,333 @@
+// Portal Gateway admin console
+// A thin client over the /admin JSON API. The API key is kept in sessionStorage only,
+// and every value from the server is rendered as text, never as HTML.
+"use strict";
+
+const KEY_STORAGE = "portal-admin-key";
+const DLQ_PAGE_SIZE = 50;
+
+const state = {
+  key: sessionStorage.getItem(KEY_STORAGE) || "",
+  dlqOffset: 0,
+  dlqTotal: 0,
+  dlqFilter: {},
+};
+
+const $ = (id) => document.getElementById(id);
+
+function setStatus(message, isError) {
+  const status = $("status");
+  status.textContent = message || "";
+  status.className = isError ? "error" : "";
+}
+
+// api calls an admin endpoint and returns the decoded JSON body
+async function api(method, path, body) {
+  if (!state.key) {
+    throw new Error("Enter an admin API key first");
+  }
+
+  const options = { method, headers: { Authorization: "Bearer " + state.key } };
+  if (body !== undefined) {
+    options.headers["Content-Type"] = "application/json";
+    options.body = JSON.stringify(body);
+  }
+
+  const resp = await fetch(path, options);
+  const text = await resp.text();
+  let data = null;
+  try {
+    data = text ? JSON.parse(text) : null;
+  } catch (e) {
+    data = null;
+  }
+
+  if (!resp.ok) {
+    const message = data && data.message ? data.message : text.trim() || resp.statusText;
+    if (resp.status === 401 || resp.status === 403) {
+      throw new Error("Not authorized: " + message);
+    }
+    throw new Error(message);
+  }
+  return data;
+}
+
+// run executes an action and reports its error, if any, in the status line
+async function run(action) {
+  try {
+    await action();
+  } catch (err) {
+    setStatus(err.message, true);
+  }
+}
+
+function cell(row, value, className) {
+  const td = document.createElement("td");
+  td.textContent = value === undefined || value === null ? "" : String(value);
+  if (className) {
+    td.className = className;
+  }
+  row.appendChild(td);
+  return td;
+}
+
+function button(label, onClick) {
+  const b = document.createElement("button");
+  b.type = "button";
+  b.textContent = label;
+  b.addEventListener("click", () => run(onClick));
+  return b;
+}
+
+function splitList(value) {
+  return value.split(",").map((s) => s.trim()).filter((s) => s !== "");
+}
+
+function formatTime(value) {
+  if (!value || value.startsWith("0001-")) {
+    return "";
+  }
+  return new Date(value).toLocaleString();
+}
+
+// Session
+
+function showSession() {
+  const connected = state.key !== "";
+  $("login").hidden = connected;
+  $("session").hidden = !connected;
+  $("session-label").textContent = connected ? "Connected" : "";
+}
+
+$("login").addEventListener("submit", (event) => {
+  event.preventDefault();
+  state.key = $("api-key").value.trim();
+  $("api-key").value = "";
+  run(async () => {
+    // Listing ACL rules needs the admin scope, so it doubles as a check of the key
+    try {
+      await loadACL();
+    } catch (err) {
+      state.key = "";
+      throw err;
+    }
+    sessionStorage.setItem(KEY_STORAGE, state.key);
+    showSession();
+  });
+});
+
+$("logout").addEventListener("click", () => {
+  sessionStorage.removeItem(KEY_STORAGE);
+  state.key = "";
+  $("acl-rows").replaceChildren();
+  $("quota-rows").replaceChildren();
+  $("dlq-rows").replaceChildren();
+  $("dlq-detail").hidden = true;
+  $("quota-table").hidden = true;
+  showSession();
+  setStatus("Disconnected");
+});
+
+// Tabs
+
+document.querySelectorAll("nav button").forEach((tab) => {
+  tab.addEventListener("click", () => {
+    document.querySelectorAll("nav button").forEach((t) => t.classList.toggle("active", t === tab));
+    document.querySelectorAll("main section").forEach((section) => {
+      section.hidden = section.id !== "tab-" + tab.dataset.tab;
+    });
+    setStatus("");
+    if (state.key && tab.dataset.tab === "acl") {
+      run(loadACL);
+    }
+    if (state.key && tab.dataset.tab === "dlq") {
+      run(loadDLQ);
+    }
+  });
+});
+
+// ACL rules
+
+function formatWindows(rule) {
+  const windows = (rule.allowed_time_windows || []).map((w) => {
+    const days = w.days && w.days.length ? w.days.join(",") + " " : "";
+    return days + w.start + "-" + w.end;
+  });
+  if (windows.length && rule.time_zone) {
+    windows.push("(" + rule.time_zone + ")");
+  }
+  return windows.join(" ");
+}
+
+async function loadACL() {
+  const rules = await api("GET", "/admin/acl");
+  rules.sort((a, b) => a.lease_id.localeCompare(b.lease_id));
+
+  const rows = rules.map((rule) => {
+    const row = document.createElement("tr");
+    cell(row, rule.lease_id);
+    cell(row, (rule.allowed_key_ids || []).join(", "), "wrap");
+    cell(row, (rule.allowed_key_groups || []).join(", "), "wrap");
+    cell(row, (rule.allowed_ip_ranges || []).join(", "), "wrap");
+    cell(row, formatWindows(rule));
+    cell(row, "").appendChild(button("Remove", async () => {
+      if (!confirm("Remove the ACL rule for " + rule.lease_id + "?")) {
+        return;
+      }
+      const result = await api("DELETE", "/admin/acl/" + encodeURIComponent(rule.lease_id));
+      setStatus(result.message);
+      await loadACL();
+    }));
+    return row;
+  });
+
+  $("acl-rows").replaceChildren(...rows);
+  setStatus(rules.length + " ACL rule(s)");
+}
+
+$("acl-refresh").addEventListener("click", () => run(loadACL));
+
+$("acl-form").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const form = event.target;
+  run(async () => {
+    const result = await api("POST", "/admin/acl", {
+      lease_id: form.lease_id.value.trim(),
+      allowed_key_ids: splitList(form.allowed_key_ids.value),
+      allowed_key_groups: splitList(form.allowed_key_groups.value),
+      allowed_ip_ranges: splitList(form.allowed_ip_ranges.value),
+    });
+    form.reset();
+    await loadACL();
+    setStatus(result.message);
+  });
+});
+
+// Quota
+
+const QUOTA_FIELDS = [
+  ["Period", (s) => s.period],
+  ["Period start", (s) => formatTime(s.period_start)],
+  ["Period end", (s) => formatTime(s.period_end)],
+  ["Requests", (s) => s.request_count + " / " + s.request_limit],
+  ["Requests remaining", (s) => s.request_remaining],
+  ["Rollover requests", (s) => s.rollover_requests],
+  ["Bytes", (s) => s.bytes_transferred + " / " + s.bytes_limit],
+  ["Bytes remaining", (s) => s.bytes_remaining],
+  ["Connections", (s) => s.active_connections + " / " + s.concurrent_conn_limit],
+  ["Exceeded", (s) => (s.quota_exceeded ? "yes (" + s.quota_exceeded_reason + ")" : "no")],
+];
+
+$("quota-form").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const keyID = event.target.key_id.value.trim();
+  run(async () => {
+    const status = await api("GET", "/admin/quota/" + encodeURIComponent(keyID));
+    const rows = QUOTA_FIELDS.map(([label, value]) => {
+      const row = document.createElement("tr");
+      const th = document.createElement("th");
+      th.textContent = label;
+      row.appendChild(th);
+      cell(row, value(status));
+      return row;
+    });
+    $("quota-rows").replaceChildren(...rows);
+    $("quota-table").hidden = false;
+    setStatus("Quota for " + status.key_id);
+  });
+});
+
+// Dead letter queue
+
+function decodeBody(body) {
+  if (!body) {
+    return "";
+  }
+  try {
+    return atob(body);
+  } catch (e) {
+    return body;
+  }
+}
+
+async function showDLQEntry(id) {
+  const entry = await api("GET", "/admin/dlq/" + id);
+  entry.body = decodeBody(entry.body);
+  const detail = $("dlq-detail");
+  detail.textContent = JSON.stringify(entry, null, 2);
+  detail.hidden = false;
+}
+
+async function loadDLQ() {
+  const params = new URLSearchParams({ limit: DLQ_PAGE_SIZE, offset: state.dlqOffset });
+  for (const [name, value] of Object.entries(state.dlqFilter)) {
+    if (value) {
+      params.set(name, value);
+    }
+  }
+
+  const page = await api("GET", "/admin/dlq?" + params.toString());
+  state.dlqTotal = page.total;
+
+  const rows = (page.entries || []).map((entry) => {
+    const row = document.createElement("tr");
+    cell(row, entry.id);
+    cell(row, formatTime(entry.created_at));
+    cell(row, entry.method + " " + entry.url, "wrap");
+    cell(row, entry.status_code || "");
+    cell(row, entry.retries);
+    cell(row, entry.permanently_failed ? entry.replays + " (failed)" : entry.replays);
+    cell(row, entry.last_error, "wrap");
+
+    const actions = cell(row, "");
+    actions.appendChild(button("View", () => showDLQEntry(entry.id)));
+    if (!entry.permanently_failed) {
+      actions.appendChild(button("Retry", async () => {
+        const result = await api("POST", "/admin/dlq/" + entry.id + "/retry");
+        await loadDLQ();
+        setStatus(result.message);
+      }));
+    }
+    actions.appendChild(button("Delete", async () => {
+      if (!confirm("Delete DLQ entry " + entry.id + "?")) {
+        return;
+      }
+      const result = await api("DELETE", "/admin/dlq/" + entry.id);
+      await loadDLQ();
+      setStatus(result.message);
+    }));
+    return row;
+  });
+
+  $("dlq-rows").replaceChildren(...rows);
+  const first = page.total === 0 ? 0 : state.dlqOffset + 1;
+  const last = Math.min(state.dlqOffset + DLQ_PAGE_SIZE, page.total);
+  $("dlq-page").textContent = first + "-" + last + " of " + page.total;
+  $("dlq-prev").disabled = state.dlqOffset === 0;
+  $("dlq-next").disabled = last >= page.total;
+  setStatus("");
+}
+
+$("dlq-form").addEventListener("submit", (event) => {
+  event.preventDefault();
+  const form = event.target;
+  state.dlqFilter = { lease_id: form.lease_id.value.trim(), key_id: form.key_id.value.trim() };
+  state.dlqOffset = 0;
+  $("dlq-detail").hidden = true;
+  run(loadDLQ);
+});
+
+$("dlq-prev").addEventListener("click", () => {
+  state.dlqOffset = Math.max(0, state.dlqOffset - DLQ_PAGE_SIZE);
+  run(loadDLQ);
+});
+
+$("dlq-next").addEventListener("click", () => {
+  state.dlqOffset += DLQ_PAGE_SIZE;
+  run(loadDLQ);
+});
+
+showSession();
+if (state.key) {
+  run(loadACL);
+}
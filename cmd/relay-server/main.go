@@ -3,29 +3,53 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 
+	"github.com/portal-project/portal-gateway/portal/bandwidth"
+	"github.com/portal-project/portal-gateway/portal/capture"
 	"github.com/portal-project/portal-gateway/portal/circuitbreaker"
+	"github.com/portal-project/portal-gateway/portal/coalesce"
 	"github.com/portal-project/portal-gateway/portal/config"
+	"github.com/portal-project/portal-gateway/portal/contentroute"
+	"github.com/portal-project/portal-gateway/portal/forward"
+	"github.com/portal-project/portal-gateway/portal/headers"
+	"github.com/portal-project/portal-gateway/portal/healthcheck"
+	"github.com/portal-project/portal-gateway/portal/idempotency"
 	"github.com/portal-project/portal-gateway/portal/logging"
 	"github.com/portal-project/portal-gateway/portal/metrics"
 	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/portal-project/portal-gateway/portal/mirror"
+	"github.com/portal-project/portal-gateway/portal/plugin"
+	"github.com/portal-project/portal-gateway/portal/problem"
 	"github.com/portal-project/portal-gateway/portal/quota"
+	"github.com/portal-project/portal-gateway/portal/recovery"
+	"github.com/portal-project/portal-gateway/portal/rewrite"
+	"github.com/portal-project/portal-gateway/portal/saturation"
+	"github.com/portal-project/portal-gateway/portal/service"
 	"github.com/portal-project/portal-gateway/portal/shutdown"
+	"github.com/portal-project/portal-gateway/portal/startup"
+	"github.com/portal-project/portal-gateway/portal/statusmap"
 	"github.com/portal-project/portal-gateway/portal/streaming"
 	"github.com/portal-project/portal-gateway/portal/timeout"
+	"github.com/portal-project/portal-gateway/portal/upstream"
 	"github.com/portal-project/portal-gateway/portal/webhook"
 )
 
@@ -43,6 +67,71 @@ type Server struct {
 	aclConfig       *middleware.ACLConfig
 	tlsEnabled      bool
 	shutdownManager *shutdown.Manager
+	adminHandler    *AdminHandler
+	startupGate     *startup.Gate
+	activeLayers    []string // Middleware layers in request order, for the startup summary
+}
+
+// ListenerTimeouts holds connection timeouts for a listener
+// Streaming requests clear their own deadlines, so WriteTimeout only bounds regular responses
+type ListenerTimeouts struct {
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+}
+
+// HTTP2Settings holds HTTP/2 tuning shared by both listeners
+type HTTP2Settings struct {
+	MaxConcurrentStreams uint32 // Streams a client may have open at once on one connection
+	MaxReadFrameSize     uint32 // Largest frame the server accepts, between 16 KiB and 16 MiB - 1
+	H2C                  bool   // Also serve HTTP/2 without TLS (h2c) on the HTTP listener
+}
+
+// newServer returns the HTTP/2 server for one listener; each gets its own, since
+// http2.ConfigureServer fills the idle timeout in from the listener it is applied to
+func (h HTTP2Settings) newServer() *http2.Server {
+	return &http2.Server{
+		MaxConcurrentStreams: h.MaxConcurrentStreams,
+		MaxReadFrameSize:     h.MaxReadFrameSize,
+	}
+}
+
+// MiddlewareLayers selects which optional layers wrap /peer requests
+// Auth and ACL always run on /peer: the ACL sets the lease ID every later layer depends on
+type MiddlewareLayers struct {
+	Timeout        bool
+	CircuitBreaker bool
+	Quota          bool
+	RateLimit      bool // Also covers the base rate limit on /admin and /auth/validate
+	Streaming      bool
+}
+
+// Metrics endpoint authentication modes
+const (
+	MetricsAuthNone   = "none"
+	MetricsAuthAPIKey = "api-key"
+	MetricsAuthBasic  = "basic"
+)
+
+// MetricsAuth holds authentication settings for the /metrics endpoint
+type MetricsAuth struct {
+	Mode              string // MetricsAuthNone, MetricsAuthAPIKey (requires the "metrics" scope) or MetricsAuthBasic
+	BasicAuthUsername string
+	BasicAuthPassword string
+}
+
+// withDefaults returns t with zero values taken from fallback
+func (t ListenerTimeouts) withDefaults(fallback ListenerTimeouts) ListenerTimeouts {
+	if t.ReadTimeout == 0 {
+		t.ReadTimeout = fallback.ReadTimeout
+	}
+	if t.WriteTimeout == 0 {
+		t.WriteTimeout = fallback.WriteTimeout
+	}
+	if t.IdleTimeout == 0 {
+		t.IdleTimeout = fallback.IdleTimeout
+	}
+	return t
 }
 
 func main() {
@@ -66,104 +155,902 @@ func main() {
 		}
 	}
 
+	// Credentials are always redacted; the variables add names to the defaults
+	redactHeaders := append(slices.Clone(logging.DefaultRedactHeaders), splitList(os.Getenv("LOG_REDACT_HEADERS"))...)
+	redactQueryParams := append(slices.Clone(logging.DefaultRedactQueryParams), splitList(os.Getenv("LOG_REDACT_QUERY_PARAMS"))...)
+
 	logger := logging.NewLogger(&logging.Config{
-		Level:  logLevel,
-		Format: logFormat,
-		Output: os.Stdout,
+		Level:    logLevel,
+		Format:   logFormat,
+		Output:   os.Stdout,
+		Redactor: logging.NewRedactor(redactHeaders, redactQueryParams),
+
+		RequestHeaders: splitList(os.Getenv("LOG_REQUEST_HEADERS")),
 	})
 	logging.SetDefault(logger)
 
+	// Route anything still written through the stdlib log package (e.g. from dependencies) into the same pipeline
+	slog.SetDefault(logger.Logger)
+
 	// Parse command line flags
 	port := flag.String("port", defaultPort, "Server HTTP port")
 	httpsPort := flag.String("https-port", defaultHTTPSPort, "Server HTTPS port")
 	configPath := flag.String("config", defaultConfigPath, "Path to auth configuration file")
+	authDirPath := flag.String("auth-dir", "", "Directory with one API key per file, named by key ID (optional, replaces -config)")
+	authDirInterval := flag.Duration("auth-dir-interval", 30*time.Second, "How often -auth-dir is checked for added, removed or rotated key files")
 	tlsConfigPath := flag.String("tls-config", "", "Path to TLS configuration file (optional)")
 	leaseRateLimitConfigPath := flag.String("lease-rate-limit-config", "", "Path to lease rate limit configuration file (optional)")
 	quotaConfigPath := flag.String("quota-config", "", "Path to quota configuration file (optional)")
+	aclConfigPath := flag.String("acl-config", "", "Path to ACL rules and key groups configuration file (optional)")
+	aclLogAllowedRules := flag.Bool("acl-log-allowed-rules", false, "Log which ACL rule allowed each request at debug level, e.g. to check a wildcard rule matches as intended")
+	leaseStateDBPath := flag.String("lease-state-db", "lease_state.db", "Path to the database keeping leases disabled through /admin/lease/{id}/disable across restarts (empty = in memory only)")
+	aclDefaultAllow := flag.Bool("acl-default-allow", false, "Allow any authenticated key to reach leases without an ACL rule (for trusted internal deployments only)")
+	mirrorConfigPath := flag.String("mirror-config", "", "Path to request mirroring configuration file (optional)")
+	bandwidthConfigPath := flag.String("bandwidth-config", "", "Path to per-lease bandwidth limit (bytes/sec) configuration file (optional; leases without a limit are unthrottled)")
+	statusMapConfigPath := flag.String("status-map-config", "", "Path to per-lease upstream status code remapping configuration file (optional)")
+	pluginConfigPath := flag.String("plugin-config", "", "Path to configuration placing registered plugin middlewares in the /peer chain (optional)")
+	contentRouteConfigPath := flag.String("content-route-config", "", "Path to per-lease upstream selection by request Content-Type configuration file (optional; unmatched requests use the lease's default upstream)")
+	rewriteConfigPath := flag.String("rewrite-config", "", "Path to per-lease request/response header rewrite configuration file (optional)")
+	forwardConfigPath := flag.String("forward-config", "", "Path to per-lease request header forwarding allow/deny configuration file (optional; hop-by-hop and credential headers are always removed)")
+	serviceConfigPath := flag.String("service-config", "", "Path to lease-to-service classification configuration file (optional)")
+	upstreamMaxIdleConns := flag.Int("upstream-max-idle-conns", upstream.DefaultTransportConfig().MaxIdleConns, "Idle upstream connections kept across all upstreams (0 = unlimited)")
+	upstreamMaxIdleConnsPerHost := flag.Int("upstream-max-idle-conns-per-host", upstream.DefaultTransportConfig().MaxIdleConnsPerHost, "Idle connections kept per upstream for reuse")
+	upstreamMaxConnsPerHost := flag.Int("upstream-max-conns-per-host", 0, "Connections per upstream, active or idle; further requests wait for one (0 = unlimited)")
+	upstreamIdleConnTimeout := flag.Duration("upstream-idle-conn-timeout", upstream.DefaultTransportConfig().IdleConnTimeout, "How long an unused upstream connection is kept open")
+	upstreamDialTimeout := flag.Duration("upstream-dial-timeout", upstream.DefaultTransportConfig().DialTimeout, "Bound on opening a connection to an upstream")
+	healthCheckConfigPath := flag.String("health-check-config", "", "Path to per-lease active upstream health check configuration file (optional)")
+	captureMaxDuration := flag.Duration("capture-max-duration", time.Hour, "Max duration of an admin-started payload capture session")
+	securityHeaders := flag.Bool("security-headers", false, "Inject default security headers into every response")
+	securityHeadersConfigPath := flag.String("security-headers-config", "", "Path to response headers configuration file (optional, implies -security-headers)")
+	maxConcurrent := flag.Int("max-concurrent", 0, "Max in-flight requests across the whole process (0 = unlimited)")
+	maxQueue := flag.Int("max-queue", 0, "Max requests waiting for a process-wide slot (0 = reject immediately)")
+	queueTimeout := flag.Duration("queue-timeout", time.Second, "Max time a request waits for a process-wide slot")
+	maxHeaderBytes := flag.Int("max-header-bytes", 32<<10, "Max total size of request headers; larger requests get a 431 (0 = net/http default)")
+	maxHeaderCount := flag.Int("max-header-count", 100, "Max number of request header lines; more get a 431 (0 = unlimited)")
+	leaseMaxConcurrent := flag.Int("lease-max-concurrent", 100, "Max in-flight requests per lease")
+	leaseMaxQueue := flag.Int("lease-max-queue", 0, "Max requests waiting for a free slot per lease (0 = reject immediately)")
+	fairQueueSlots := flag.Int("fair-queue-slots", 0, "Concurrent backend slots shared fairly across leases (0 = disabled)")
+	fairQueueTimeout := flag.Duration("fair-queue-timeout", 30*time.Second, "Max time a request waits for a shared backend slot")
+	idempotencyDBPath := flag.String("idempotency-db", "", "Path to idempotency key database (optional, enables Idempotency-Key deduplication)")
+	replayWindow := flag.Duration("replay-window", 0, "Require X-Nonce and X-Timestamp on peer requests, rejecting reused nonces and timestamps further off than this (0 = disabled)")
+	idempotencyTTL := flag.Duration("idempotency-ttl", 24*time.Hour, "How long responses are replayed for a repeated Idempotency-Key")
+	readTimeout := flag.Duration("read-timeout", 15*time.Second, "HTTP listener read timeout")
+	writeTimeout := flag.Duration("write-timeout", 15*time.Second, "HTTP listener write timeout (streaming responses are exempt)")
+	idleTimeout := flag.Duration("idle-timeout", 60*time.Second, "HTTP listener keep-alive idle timeout")
+	httpsReadTimeout := flag.Duration("https-read-timeout", 0, "HTTPS listener read timeout (0 = same as -read-timeout)")
+	httpsWriteTimeout := flag.Duration("https-write-timeout", 0, "HTTPS listener write timeout (0 = same as -write-timeout)")
+	httpsIdleTimeout := flag.Duration("https-idle-timeout", 0, "HTTPS listener keep-alive idle timeout (0 = same as -idle-timeout)")
+	http2MaxConcurrentStreams := flag.Uint("http2-max-concurrent-streams", 250, "Max HTTP/2 streams a client may have open at once on one connection")
+	http2MaxReadFrameSize := flag.Uint("http2-max-read-frame-size", 1<<20, "Largest HTTP/2 frame the server accepts, in bytes (16384 to 16777215)")
+	h2cEnabled := flag.Bool("h2c", false, "Also serve HTTP/2 without TLS (h2c) on the HTTP listener, for internal service-to-service traffic")
+	dlqMaxReplays := flag.Int("dlq-max-replays", 10, "Max times a DLQ entry can be replayed via the admin API (0 = unlimited)")
+	dlqMarkFailed := flag.Bool("dlq-mark-permanently-failed", true, "Flag DLQ entries as permanently failed once their last allowed replay fails")
+	retryTimeoutBudgetSource := flag.String("webhook-retry-timeout-budget-source", string(webhook.TimeoutBudgetFromContext), "Deadline shared by all attempts of a webhook delivery: context (the request's own deadline) or explicit (-webhook-retry-timeout-budget)")
+	retryTimeoutBudget := flag.Duration("webhook-retry-timeout-budget", 0, "Total time for all attempts of a webhook delivery with -webhook-retry-timeout-budget-source=explicit")
+	dlqReplayInterval := flag.Duration("dlq-replay-interval", 0, "Automatically replay DLQ entries this often (0 = disabled, replay via the admin API only)")
+	dlqReplayConcurrency := flag.Int("dlq-replay-concurrency", 4, "Max automatic DLQ replays in flight at once")
+	dlqReplayHostRate := flag.Float64("dlq-replay-host-rate", 5, "Max automatic DLQ replays per second to a single host (0 = unlimited)")
+	dlqReplayFailureThreshold := flag.Int("dlq-replay-failure-threshold", 5, "Consecutive failed automatic replays to a host before replays to it are paused")
+	dlqReplayPause := flag.Duration("dlq-replay-pause", 30*time.Second, "How long automatic replays to a failing host are first paused; doubles on each further pause, up to 10m")
+	enableTimeout := flag.Bool("enable-timeout", true, "Apply per-request timeouts to /peer requests")
+	timeoutHardStop := flag.Bool("timeout-hard-stop", false, "End timed out /peer responses immediately and discard later handler writes, tracking handlers that keep running")
+	enableCircuitBreaker := flag.Bool("enable-circuit-breaker", true, "Apply the circuit breaker to /peer requests")
+	staleCacheTTL := flag.Duration("stale-cache-ttl", 0, "Serve cached GET responses up to this old while a lease's circuit is open (0 = disabled)")
+	staleCacheLeases := flag.String("stale-cache-leases", "", "Comma-separated lease IDs whose GET responses are cached for -stale-cache-ttl, wildcards allowed (empty = all leases)")
+	coalesceWindow := flag.Duration("coalesce-window", 0, "Let identical concurrent GET/HEAD requests share one upstream call started up to this long ago (0 = disabled)")
+	coalesceLeases := flag.String("coalesce-leases", "", "Comma-separated lease IDs whose requests are coalesced within -coalesce-window, wildcards allowed (empty = all leases)")
+	circuitBreakerGranularity := flag.String("circuit-breaker-granularity", circuitbreaker.GranularityLease, "Scope of circuit breakers: lease (one per lease) or endpoint (one per lease and upstream endpoint)")
+	circuitBreakerIdleTTL := flag.Duration("circuit-breaker-idle-ttl", 0, "Remove closed circuit breakers unused for this long, e.g. 1h with -circuit-breaker-granularity=endpoint (0 = never)")
+	circuitBreakerStreamFailures := flag.Bool("circuit-breaker-stream-failures", false, "Count upstream failures reported after a response has started, e.g. a stream dropped mid-way, toward tripping circuit breakers")
+	circuitBreakerPrewarm := flag.String("circuit-breaker-prewarm", "", "Comma-separated lease IDs whose circuit breakers are created at startup instead of on their first request")
+	circuitBreakerPrewarmACL := flag.Bool("circuit-breaker-prewarm-acl", false, "Also create circuit breakers at startup for every lease with an exact (non-wildcard) ACL rule")
+	circuitBreakerForceClosed := flag.String("circuit-breaker-force-closed", "", "Comma-separated lease IDs that bypass the circuit breaker, wildcards allowed (toggle at runtime via /admin/circuit-breakers)")
+	enableQuota := flag.Bool("enable-quota", true, "Enforce quotas on /peer requests")
+	quotaNearLimitPercent := flag.Float64("quota-near-limit-percent", 90, "Usage percentage of a quota at which a key counts toward portal_quota_near_limit_keys")
+	saturationWindow := flag.Duration("saturation-window", 0, "Window over which portal_saturation reports the share of requests rejected by limiting layers (0 = disabled)")
+	quotaMetricsInterval := flag.Duration("quota-metrics-interval", 30*time.Second, "How often quota usage is scanned for the near-limit and exceeded key gauges")
+	rateLimitWarmUp := flag.Duration("rate-limit-warmup", 0, "How long a new key's or IP's rate limiter takes to ramp up to its full burst (0 = no ramp)")
+	rateLimitWarmUpFraction := flag.Float64("rate-limit-warmup-fraction", 0, "Share of the burst a new rate limiter starts with during -rate-limit-warmup, 0-1")
+	rateLimitKeyIPMode := flag.String("rate-limit-key-ip-mode", middleware.KeyIPModeKeyOnly, "Rate limits for requests with an API key: key (per key only) or both (per key and per client IP, the most restrictive wins)")
+	rateLimitKeyIPRate := flag.Float64("rate-limit-key-ip-rps", 0, "Per-IP requests per second for requests with an API key with -rate-limit-key-ip-mode=both (0 = the keyless per-IP limit)")
+	rateLimitKeyIPBurst := flag.Int("rate-limit-key-ip-burst", 0, "Per-IP burst for requests with an API key with -rate-limit-key-ip-mode=both (0 = the keyless per-IP burst)")
+	limitBypassKeys := flag.String("limit-bypass-keys", "", "Comma-separated API key IDs exempt from quota and rate limits, e.g. internal monitoring (every use is logged)")
+	limitBypassScope := flag.String("limit-bypass-scope", middleware.ScopeUnlimited, "Scope that exempts a key from quota and rate limits (empty = only -limit-bypass-keys)")
+	clientIPHeaders := flag.String("client-ip-headers", strings.Join(middleware.DefaultClientIPHeaders, ","), "Comma-separated headers checked in order for the client IP, e.g. CF-Connecting-IP,True-Client-IP,X-Forwarded-For")
+	trustedProxies := flag.String("trusted-proxies", "", "Comma-separated proxy IPs or CIDRs whose client IP headers are honored (empty = honor headers from any peer)")
+	leaseTokenSecretFile := flag.String("lease-token-secret-file", "", "File holding the HMAC secret (at least 32 bytes) for temporary lease tokens issued by /admin/lease-tokens (empty = disabled)")
+	startupWarmUp := flag.Duration("startup-warmup", 0, "How long after startup /readyz reports not ready, so load balancers do not send traffic to a cold process (0 = ready at once)")
+	storageOpenAttempts := flag.Int("storage-open-attempts", startup.DefaultRetry().Attempts, "Attempts to open each SQLite database at startup before exiting, for data volumes mounted after the process starts (1 = fail fast)")
+	storageOpenBackoff := flag.Duration("storage-open-backoff", startup.DefaultRetry().InitialBackoff, "Wait after the first failed SQLite open at startup, doubled after each later failure")
+	storageOpenMaxBackoff := flag.Duration("storage-open-max-backoff", startup.DefaultRetry().MaxBackoff, "Longest wait between SQLite open attempts at startup")
+	startupSelfTest := flag.Bool("startup-self-test", false, "Keep /readyz not ready until quota storage, the DLQ and the loaded API keys pass a self-test")
+	enableRateLimit := flag.Bool("enable-rate-limit", true, "Apply rate limits to /peer, /admin and /auth/validate requests")
+	enableStreaming := flag.Bool("enable-streaming", true, "Apply SSE/streaming support to /peer requests")
+	maxStreams := flag.Int("max-streams", 0, "Max streaming connections open at once across all leases; further streams get 503 (0 = unlimited)")
+	maxStreamsPerLease := flag.Int("max-streams-per-lease", 0, "Max streaming connections open at once per lease; further streams get 503 (0 = unlimited)")
+	metricsAuthMode := flag.String("metrics-auth", MetricsAuthNone, "Authentication for /metrics: none, api-key (requires the metrics scope) or basic")
+	leasePathList := flag.String("lease-paths", middleware.DefaultLeasePathTemplate, "Comma-separated routes carrying a lease ID, e.g. /peer/{lease_id},/v2/relay/{lease_id}")
+	metricsBasicAuthUser := flag.String("metrics-basic-auth-user", "", "Username for -metrics-auth=basic (password is read from METRICS_BASIC_AUTH_PASSWORD)")
+	statsdAddr := flag.String("statsd-addr", "", "StatsD/DogStatsD agent (host:port) to also send request metrics to (optional)")
+	statsdPrefix := flag.String("statsd-prefix", "", "Prefix for metric names sent to StatsD, e.g. gateway.")
+	errorFormat := flag.String("error-format", string(problem.FormatJSON), "Format of gateway error responses: json ({\"error\",\"message\"}) or problem+json (RFC 7807)")
+	errorTypeBase := flag.String("error-type-base", problem.DefaultTypeBase, "Prefix of problem type URIs with -error-format=problem+json; the error code is appended")
 	flag.Parse()
 
+	if err := problem.Configure(&problem.Config{Format: problem.Format(*errorFormat), TypeBase: *errorTypeBase}); err != nil {
+		fatal("Invalid -error-format", "error", err)
+	}
+
+	// Databases may live on a volume that is mounted shortly after the process starts
+	if *storageOpenAttempts < 1 || *storageOpenBackoff <= 0 || *storageOpenMaxBackoff < 0 {
+		fatal("Invalid storage open retry", "attempts", *storageOpenAttempts, "backoff", *storageOpenBackoff, "max_backoff", *storageOpenMaxBackoff)
+	}
+	storageRetry := startup.Retry{
+		Attempts:       *storageOpenAttempts,
+		InitialBackoff: *storageOpenBackoff,
+		MaxBackoff:     *storageOpenMaxBackoff,
+	}
+
 	// Load authentication configuration
-	logging.Info("Loading authentication configuration", "path", *configPath)
-	authConfig, err := config.LoadFromFile(*configPath)
-	if err != nil {
-		logging.Error("Failed to load auth configuration", "error", err)
-		os.Exit(1)
+	var authConfig *middleware.AuthConfig
+	var err error
+	if *authDirPath != "" {
+		logging.Debug("Loading API keys from secrets directory", "path", *authDirPath)
+		authDirLoader := config.NewAuthDirLoader(*authDirPath)
+		if err := authDirLoader.Load(); err != nil {
+			fatal("Failed to load API keys from secrets directory", "path", *authDirPath, "error", err)
+		}
+		authDirLoader.StartWatching(*authDirInterval)
+		defer authDirLoader.Stop()
+		authConfig = authDirLoader.GetAuthConfig()
+	} else {
+		logging.Debug("Loading authentication configuration", "path", *configPath)
+		authConfig, err = config.LoadFromFile(*configPath)
+		if err != nil {
+			fatal("Failed to load auth configuration", "path", *configPath, "error", err)
+		}
 	}
-	logging.Info("Authentication configuration loaded successfully")
 
 	// Load TLS configuration if provided
 	var tlsConfig *tls.Config
 	var tlsEnabled bool
+	tlsSummary := slog.Group("tls", slog.Bool("enabled", false))
 	if *tlsConfigPath != "" {
-		log.Printf("Loading TLS configuration from: %s", *tlsConfigPath)
+		logging.Debug("Loading TLS configuration", "path", *tlsConfigPath)
 		portalTLSConfig, err := config.LoadTLSConfig(*tlsConfigPath)
 		if err != nil {
-			log.Fatalf("Failed to load TLS configuration: %v", err)
+			fatal("Failed to load TLS configuration", "path", *tlsConfigPath, "error", err)
 		}
 		tlsConfig = portalTLSConfig.GetTLSConfig()
 		tlsEnabled = true
-		log.Println("TLS configuration loaded successfully")
+		tlsSummary = slog.Group("tls", slog.Bool("enabled", true))
 
-		// Display certificate info
+		// Certificate details for the startup summary
 		if certInfo, err := portalTLSConfig.GetCertificateInfo(); err == nil {
-			log.Printf("Certificate Info:")
-			log.Printf("  Subject: %s", certInfo.Subject)
-			log.Printf("  Issuer: %s", certInfo.Issuer)
-			log.Printf("  Valid: %s - %s", certInfo.NotBefore.Format("2006-01-02"), certInfo.NotAfter.Format("2006-01-02"))
-			log.Printf("  Expires in: %v", certInfo.ExpiresIn())
+			tlsSummary = slog.Group("tls",
+				slog.Bool("enabled", true),
+				slog.String("cert_subject", certInfo.Subject),
+				slog.String("cert_issuer", certInfo.Issuer),
+				slog.Time("cert_not_before", certInfo.NotBefore),
+				slog.Time("cert_not_after", certInfo.NotAfter),
+			)
 		}
 	}
 
 	// Load lease rate limit configuration if provided
 	var leaseRateLimitConfig *middleware.LeaseRateLimitConfig
 	if *leaseRateLimitConfigPath != "" {
-		log.Printf("Loading lease rate limit configuration from: %s", *leaseRateLimitConfigPath)
+		logging.Debug("Loading lease rate limit configuration", "path", *leaseRateLimitConfigPath)
 		leaseRateLimitConfig, err = config.LoadLeaseRateLimitConfig(*leaseRateLimitConfigPath)
 		if err != nil {
-			log.Fatalf("Failed to load lease rate limit configuration: %v", err)
+			fatal("Failed to load lease rate limit configuration", "path", *leaseRateLimitConfigPath, "error", err)
 		}
-		log.Printf("Lease rate limit configuration loaded successfully (%d rules)", len(leaseRateLimitConfig.ListRules()))
 	} else {
-		log.Println("No lease rate limit configuration provided, using defaults")
+		// No lease rate limit configuration provided, using defaults
 		leaseRateLimitConfig = middleware.NewLeaseRateLimitConfig(50, 100)
 	}
 
+	// Load ACL configuration if provided
+	var aclConfig *middleware.ACLConfig
+	if *aclConfigPath != "" {
+		logging.Debug("Loading ACL configuration", "path", *aclConfigPath)
+		aclConfig, err = config.LoadACLConfig(*aclConfigPath)
+		if err != nil {
+			fatal("Failed to load ACL configuration", "path", *aclConfigPath, "error", err)
+		}
+	} else {
+		// No ACL configuration provided, rules must be added via the admin API
+		aclConfig = middleware.NewACLConfig()
+	}
+	if *aclDefaultAllow {
+		aclConfig.DefaultAllow = true
+	}
+	if *aclLogAllowedRules {
+		aclConfig.LogAllowedRules = true
+	}
+	if aclConfig.DefaultAllow {
+		logging.Warn("ACL default-allow is enabled; leases without a rule are open to every authenticated key")
+	}
+
+	// Restore leases disabled before a restart so a kill switch stays on
+	if *leaseStateDBPath != "" {
+		var leaseStateStore *middleware.SQLiteLeaseStateStore
+		err := storageRetry.Do("lease state store", func() (err error) {
+			leaseStateStore, err = middleware.NewSQLiteLeaseStateStore(*leaseStateDBPath)
+			return err
+		})
+		if err != nil {
+			fatal("Failed to create lease state store", "path", *leaseStateDBPath, "error", err)
+		}
+		defer leaseStateStore.Close()
+
+		aclConfig.LeaseStateStore = leaseStateStore
+		if err := aclConfig.LoadLeaseStates(); err != nil {
+			fatal("Failed to load lease states", "path", *leaseStateDBPath, "error", err)
+		}
+	}
+
+	// Lease routes get the peer middleware chain; keep them clear of the admin API
+	leasePaths, err := middleware.ParseLeasePathPatterns(*leasePathList)
+	if err != nil {
+		fatal("Invalid -lease-paths", "error", err)
+	}
+	for _, pattern := range leasePaths {
+		if strings.HasPrefix(pattern.RoutePrefix(), "/admin/") || strings.HasPrefix(pattern.RoutePrefix(), "/auth/") {
+			fatal("Invalid -lease-paths", "pattern", pattern.String(), "error", "overlaps a reserved route")
+		}
+	}
+	aclConfig.LeasePaths = leasePaths
+
 	// Load quota configuration if provided
 	var quotaManager *quota.Manager
 	if *quotaConfigPath != "" {
-		log.Printf("Loading quota configuration from: %s", *quotaConfigPath)
-		quotaManager, err = config.LoadQuotaConfig(*quotaConfigPath)
+		logging.Debug("Loading quota configuration", "path", *quotaConfigPath)
+		quotaManager, err = config.LoadQuotaConfigWithRetry(*quotaConfigPath, storageRetry)
 		if err != nil {
-			log.Fatalf("Failed to load quota configuration: %v", err)
+			fatal("Failed to load quota configuration", "path", *quotaConfigPath, "error", err)
 		}
-		log.Printf("Quota configuration loaded successfully (%d limits)", len(quotaManager.ListLimits()))
 		defer quotaManager.Close()
 	} else {
-		log.Println("No quota configuration provided, using default in-memory storage")
-		// Create default quota manager with SQLite storage
-		storage, err := quota.NewSQLiteStorage("quota.db")
+		// No quota configuration provided, create default quota manager with SQLite storage
+		var storage *quota.SQLiteStorage
+		err := storageRetry.Do("quota storage", func() (err error) {
+			storage, err = quota.NewSQLiteStorage("quota.db")
+			return err
+		})
 		if err != nil {
-			log.Fatalf("Failed to create quota storage: %v", err)
+			fatal("Failed to create quota storage", "error", err)
 		}
 		quotaManager = quota.NewManager(storage, 1000000, 107374182400, 100)
 		defer quotaManager.Close()
 	}
 
+	// Periodically count keys near or over their quota, only while quotas are enforced
+	if *quotaNearLimitPercent <= 0 || *quotaNearLimitPercent > 100 {
+		fatal("Invalid quota near-limit percentage", "quota_near_limit_percent", *quotaNearLimitPercent)
+	}
+	if *quotaMetricsInterval <= 0 {
+		fatal("Invalid quota metrics interval", "quota_metrics_interval", *quotaMetricsInterval)
+	}
+	var usageReporter *quota.UsageReporter
+	if *enableQuota {
+		usageReporterConfig := quota.DefaultUsageReporterConfig()
+		usageReporterConfig.NearLimitPercent = *quotaNearLimitPercent
+		usageReporterConfig.RefreshInterval = *quotaMetricsInterval
+		usageReporter = quota.NewUsageReporter(quotaManager, usageReporterConfig)
+		defer usageReporter.Stop()
+	}
+
+	// Load response headers configuration if enabled
+	var headersConfig *headers.MiddlewareConfig
+	if *securityHeadersConfigPath != "" {
+		logging.Debug("Loading response headers configuration", "path", *securityHeadersConfigPath)
+		headersConfig, err = config.LoadHeadersConfig(*securityHeadersConfigPath)
+		if err != nil {
+			fatal("Failed to load response headers configuration", "path", *securityHeadersConfigPath, "error", err)
+		}
+	} else if *securityHeaders {
+		headersConfig = headers.DefaultMiddlewareConfig()
+	}
+
+	// Load request mirroring configuration if provided
+	var mirrorConfig *mirror.MiddlewareConfig
+	if *mirrorConfigPath != "" {
+		logging.Debug("Loading request mirroring configuration", "path", *mirrorConfigPath)
+		mirrorConfig, err = config.LoadMirrorConfig(*mirrorConfigPath)
+		if err != nil {
+			fatal("Failed to load request mirroring configuration", "path", *mirrorConfigPath, "error", err)
+		}
+	}
+
+	// Load status code remapping configuration if provided
+	var statusMapConfig *statusmap.MiddlewareConfig
+	if *statusMapConfigPath != "" {
+		logging.Debug("Loading status map configuration", "path", *statusMapConfigPath)
+		statusMapConfig, err = config.LoadStatusMapConfig(*statusMapConfigPath)
+		if err != nil {
+			fatal("Failed to load status map configuration", "path", *statusMapConfigPath, "error", err)
+		}
+	}
+
+	// Load content type routing configuration if provided
+	var contentRouteConfig *contentroute.MiddlewareConfig
+	if *contentRouteConfigPath != "" {
+		logging.Debug("Loading content route configuration", "path", *contentRouteConfigPath)
+		contentRouteConfig, err = config.LoadContentRouteConfig(*contentRouteConfigPath)
+		if err != nil {
+			fatal("Failed to load content route configuration", "path", *contentRouteConfigPath, "error", err)
+		}
+	}
+
+	// Load bandwidth limits if provided
+	var bandwidthConfig *bandwidth.MiddlewareConfig
+	if *bandwidthConfigPath != "" {
+		logging.Debug("Loading bandwidth configuration", "path", *bandwidthConfigPath)
+		bandwidthConfig, err = config.LoadBandwidthConfig(*bandwidthConfigPath)
+		if err != nil {
+			fatal("Failed to load bandwidth configuration", "path", *bandwidthConfigPath, "error", err)
+		}
+	}
+
+	// Load lease-to-service classification if provided
+	var serviceConfig *service.Config
+	if *serviceConfigPath != "" {
+		logging.Debug("Loading service configuration", "path", *serviceConfigPath)
+		serviceConfig, err = config.LoadServiceConfig(*serviceConfigPath)
+		if err != nil {
+			fatal("Failed to load service configuration", "path", *serviceConfigPath, "error", err)
+		}
+	}
+
+	// Load upstream health check configuration if provided
+	var healthCheckConfig *healthcheck.Config
+	if *healthCheckConfigPath != "" {
+		logging.Debug("Loading health check configuration", "path", *healthCheckConfigPath)
+		healthCheckConfig, err = config.LoadHealthCheckConfig(*healthCheckConfigPath)
+		if err != nil {
+			fatal("Failed to load health check configuration", "path", *healthCheckConfigPath, "error", err)
+		}
+	}
+
+	// Shared connection pool for requests the gateway sends upstream
+	if *upstreamMaxIdleConns < 0 || *upstreamMaxIdleConnsPerHost < 0 || *upstreamMaxConnsPerHost < 0 {
+		fatal("Upstream connection limits cannot be negative")
+	}
+	upstreamTransport := upstream.NewTransport(&upstream.TransportConfig{
+		MaxIdleConns:        *upstreamMaxIdleConns,
+		MaxIdleConnsPerHost: *upstreamMaxIdleConnsPerHost,
+		MaxConnsPerHost:     *upstreamMaxConnsPerHost,
+		IdleConnTimeout:     *upstreamIdleConnTimeout,
+		DialTimeout:         *upstreamDialTimeout,
+	})
+	if mirrorConfig != nil {
+		mirrorConfig.Transport = upstreamTransport
+	}
+	if healthCheckConfig != nil {
+		healthCheckConfig.Transport = upstreamTransport
+	}
+
+	// Load request/response rewrite configuration if provided
+	var rewriteConfig *rewrite.MiddlewareConfig
+	if *rewriteConfigPath != "" {
+		logging.Debug("Loading rewrite configuration", "path", *rewriteConfigPath)
+		rewriteConfig, err = config.LoadRewriteConfig(*rewriteConfigPath)
+		if err != nil {
+			fatal("Failed to load rewrite configuration", "path", *rewriteConfigPath, "error", err)
+		}
+	}
+
+	// Load request header forwarding configuration; without one, only the defaults apply
+	forwardConfig := forward.DefaultMiddlewareConfig()
+	if *forwardConfigPath != "" {
+		logging.Debug("Loading forward configuration", "path", *forwardConfigPath)
+		forwardConfig, err = config.LoadForwardConfig(*forwardConfigPath)
+		if err != nil {
+			fatal("Failed to load forward configuration", "path", *forwardConfigPath, "error", err)
+		}
+	}
+
+	// Build plugin middlewares if configured; plugins register themselves when their package is imported
+	var plugins *plugin.Chain
+	if *pluginConfigPath != "" {
+		logging.Debug("Loading plugin configuration", "path", *pluginConfigPath, "registered", plugin.Names())
+		placements, err := config.LoadPluginConfig(*pluginConfigPath)
+		if err != nil {
+			fatal("Failed to load plugin configuration", "path", *pluginConfigPath, "error", err)
+		}
+		plugins, err = plugin.NewChain(placements)
+		if err != nil {
+			fatal("Failed to create plugin middlewares", "path", *pluginConfigPath, "error", err)
+		}
+	}
+
+	// Create payload capture configuration; sessions are started through /admin/capture
+	if *captureMaxDuration <= 0 {
+		fatal("Invalid capture max duration", "capture_max_duration", *captureMaxDuration)
+	}
+	streamingConfig := streaming.DefaultMiddlewareConfig()
+	streamingConfig.MaxStreams = *maxStreams
+	streamingConfig.MaxStreamsPerLease = *maxStreamsPerLease
+
+	captureConfig := capture.DefaultMiddlewareConfig()
+	captureConfig.MaxDuration = *captureMaxDuration
+	captureConfig.DefaultDuration = min(captureConfig.DefaultDuration, *captureMaxDuration)
+
+	// Create saturation configuration if enabled
+	var saturationConfig *saturation.Config
+	if *saturationWindow < 0 {
+		fatal("Invalid saturation window", "saturation_window", *saturationWindow)
+	}
+	if *saturationWindow > 0 {
+		saturationConfig = saturation.DefaultConfig()
+		saturationConfig.Window = *saturationWindow
+		saturationConfig.Resolution = min(saturationConfig.Resolution, *saturationWindow)
+	}
+
+	// Create stale response cache configuration if enabled
+	var staleCacheConfig *circuitbreaker.StaleCacheConfig
+	if *staleCacheTTL < 0 {
+		fatal("Invalid stale cache TTL", "stale_cache_ttl", *staleCacheTTL)
+	}
+	if *staleCacheTTL > 0 {
+		staleCacheConfig = circuitbreaker.DefaultStaleCacheConfig()
+		staleCacheConfig.TTL = *staleCacheTTL
+		for _, leaseID := range strings.Split(*staleCacheLeases, ",") {
+			if leaseID = strings.TrimSpace(leaseID); leaseID != "" {
+				staleCacheConfig.Leases = append(staleCacheConfig.Leases, leaseID)
+			}
+		}
+	}
+
+	// Create request coalescing configuration if enabled
+	var coalesceConfig *coalesce.MiddlewareConfig
+	if *coalesceWindow < 0 {
+		fatal("Invalid coalesce window", "coalesce_window", *coalesceWindow)
+	}
+	if *coalesceWindow > 0 {
+		coalesceConfig = coalesce.DefaultMiddlewareConfig()
+		coalesceConfig.Window = *coalesceWindow
+		for _, leaseID := range strings.Split(*coalesceLeases, ",") {
+			if leaseID = strings.TrimSpace(leaseID); leaseID != "" {
+				coalesceConfig.Leases = append(coalesceConfig.Leases, leaseID)
+			}
+		}
+	}
+
+	if *rateLimitKeyIPMode != middleware.KeyIPModeKeyOnly && *rateLimitKeyIPMode != middleware.KeyIPModeBoth {
+		fatal("Invalid -rate-limit-key-ip-mode", "rate_limit_key_ip_mode", *rateLimitKeyIPMode)
+	}
+
+	// Leases whose requests always reach the upstream, even while it is failing
+	var forceClosedLeases []string
+	for _, leaseID := range strings.Split(*circuitBreakerForceClosed, ",") {
+		if leaseID = strings.TrimSpace(leaseID); leaseID != "" {
+			forceClosedLeases = append(forceClosedLeases, leaseID)
+		}
+	}
+	// Leases whose breakers exist before their first request, so a cold start never waits on the breaker lock
+	prewarmLeases := splitList(*circuitBreakerPrewarm)
+	if *circuitBreakerPrewarmACL {
+		for _, rule := range aclConfig.ListRules() {
+			prewarmLeases = append(prewarmLeases, rule.LeaseID)
+		}
+	}
+	if *circuitBreakerGranularity != circuitbreaker.GranularityLease && *circuitBreakerGranularity != circuitbreaker.GranularityEndpoint {
+		fatal("Invalid -circuit-breaker-granularity", "circuit_breaker_granularity", *circuitBreakerGranularity)
+	}
+
+	// Keys exempt from quota and rate limits; still authenticated, and logged on every use
+	var limitBypassKeyIDs []string
+	for _, keyID := range strings.Split(*limitBypassKeys, ",") {
+		if keyID = strings.TrimSpace(keyID); keyID != "" {
+			limitBypassKeyIDs = append(limitBypassKeyIDs, keyID)
+		}
+	}
+	limitBypass := middleware.NewLimitBypass(limitBypassKeyIDs, *limitBypassScope)
+	if len(limitBypassKeyIDs) > 0 || *limitBypassScope != "" {
+		logging.Info("API keys exempt from quota and rate limits", "key_ids", limitBypassKeyIDs, "scope", *limitBypassScope)
+	}
+
+	// Client IP resolution for IP whitelists and keyless rate limiting
+	clientIPResolver, err := middleware.NewClientIPResolver(strings.Split(*clientIPHeaders, ","), strings.Split(*trustedProxies, ","))
+	if err != nil {
+		fatal("Invalid -trusted-proxies", "error", err)
+	}
+
+	// Temporary lease tokens, signed with a secret shared by every gateway instance
+	var leaseTokenSigner *middleware.LeaseTokenSigner
+	if *leaseTokenSecretFile != "" {
+		secret, err := os.ReadFile(*leaseTokenSecretFile)
+		if err != nil {
+			fatal("Failed to read lease token secret", "error", err)
+		}
+		leaseTokenSigner, err = middleware.NewLeaseTokenSigner([]byte(strings.TrimSpace(string(secret))))
+		if err != nil {
+			fatal("Invalid lease token secret", "error", err)
+		}
+		logging.Info("Lease tokens enabled")
+	}
+
+	// Post-startup readiness delay and self-tests; the server adds its own once it has built them
+	startupGate := startup.NewGate(&startup.Config{WarmUp: *startupWarmUp})
+	if *startupSelfTest {
+		startupGate.AddSelfTest("quota_storage", func(ctx context.Context) error {
+			_, err := quotaManager.GetStatus("startup-self-test")
+			return err
+		})
+		startupGate.AddSelfTest("config", func(ctx context.Context) error {
+			if len(authConfig.ListAPIKeys()) == 0 {
+				return errors.New("no API keys loaded")
+			}
+			return nil
+		})
+	}
+
+	// Create per-lease concurrency limit configuration
+	concurrencyLimitConfig := middleware.NewConcurrencyLimitConfig(*leaseMaxConcurrent)
+	concurrencyLimitConfig.MaxQueue = *leaseMaxQueue
+
+	// Create global concurrency limit configuration if enabled
+	var globalConcurrencyConfig *middleware.GlobalConcurrencyConfig
+	if *maxConcurrent > 0 {
+		globalConcurrencyConfig = middleware.NewGlobalConcurrencyConfig(*maxConcurrent)
+		globalConcurrencyConfig.MaxQueue = *maxQueue
+		globalConcurrencyConfig.QueueTimeout = *queueTimeout
+		// Health checks and scrapes must keep answering while the process sheds load
+		globalConcurrencyConfig.ExemptPaths = []string{"/health", "/readyz", "/metrics"}
+	}
+
+	// Create request header limit configuration if enabled
+	var headerLimitConfig *middleware.HeaderLimitConfig
+	if *maxHeaderBytes < 0 || *maxHeaderCount < 0 {
+		fatal("Invalid header limits", "max_header_bytes", *maxHeaderBytes, "max_header_count", *maxHeaderCount)
+	}
+	if *maxHeaderBytes > 0 || *maxHeaderCount > 0 {
+		headerLimitConfig = middleware.NewHeaderLimitConfig(*maxHeaderBytes, *maxHeaderCount)
+	}
+
+	// Create fair queue configuration if enabled
+	var fairQueueConfig *middleware.FairQueueConfig
+	if *fairQueueSlots > 0 {
+		fairQueueConfig = middleware.NewFairQueueConfig(*fairQueueSlots)
+		fairQueueConfig.QueueTimeout = *fairQueueTimeout
+	}
+
+	// Create replay protection configuration if enabled
+	var nonceConfig *middleware.NonceConfig
+	if *replayWindow > 0 {
+		nonceConfig = middleware.NewNonceConfig(*replayWindow)
+	}
+
+	// Create idempotency configuration if enabled
+	var idempotencyConfig *idempotency.MiddlewareConfig
+	if *idempotencyDBPath != "" {
+		logging.Debug("Loading idempotency key store", "path", *idempotencyDBPath)
+		var idempotencyStore *idempotency.SQLiteStore
+		err := storageRetry.Do("idempotency store", func() (err error) {
+			idempotencyStore, err = idempotency.NewSQLiteStore(*idempotencyDBPath)
+			return err
+		})
+		if err != nil {
+			fatal("Failed to create idempotency store", "path", *idempotencyDBPath, "error", err)
+		}
+		defer idempotencyStore.Close()
+
+		idempotencyConfig = idempotency.DefaultMiddlewareConfig(idempotencyStore)
+		idempotencyConfig.TTL = *idempotencyTTL
+	}
+
+	// Listener timeouts; HTTPS inherits any value not overridden
+	httpTimeouts := ListenerTimeouts{
+		ReadTimeout:  *readTimeout,
+		WriteTimeout: *writeTimeout,
+		IdleTimeout:  *idleTimeout,
+	}
+	httpsTimeouts := ListenerTimeouts{
+		ReadTimeout:  *httpsReadTimeout,
+		WriteTimeout: *httpsWriteTimeout,
+		IdleTimeout:  *httpsIdleTimeout,
+	}.withDefaults(httpTimeouts)
+
+	// HTTP/2 tuning; out-of-range values would otherwise be replaced by defaults without a word
+	if *http2MaxConcurrentStreams == 0 || *http2MaxConcurrentStreams > math.MaxUint32 {
+		fatal("Invalid -http2-max-concurrent-streams", "value", *http2MaxConcurrentStreams)
+	}
+	if *http2MaxReadFrameSize < 16384 || *http2MaxReadFrameSize > 16777215 {
+		fatal("Invalid -http2-max-read-frame-size (expected 16384 to 16777215)", "value", *http2MaxReadFrameSize)
+	}
+	http2Settings := HTTP2Settings{
+		MaxConcurrentStreams: uint32(*http2MaxConcurrentStreams),
+		MaxReadFrameSize:     uint32(*http2MaxReadFrameSize),
+		H2C:                  *h2cEnabled,
+	}
+
+	// DLQ replay policy
+	dlqConfig := webhook.DefaultDLQConfig()
+	dlqConfig.MaxReplays = *dlqMaxReplays
+	dlqConfig.MarkPermanentlyFailed = *dlqMarkFailed
+
+	// Webhook retries, used for DLQ replays
+	retryConfig := webhook.DefaultRetryConfig()
+	retryConfig.TimeoutBudgetSource, err = webhook.ParseTimeoutBudgetSource(*retryTimeoutBudgetSource)
+	if err != nil {
+		fatal("Invalid -webhook-retry-timeout-budget-source", "error", err)
+	}
+	if retryConfig.TimeoutBudgetSource == webhook.TimeoutBudgetExplicit && *retryTimeoutBudget <= 0 {
+		fatal("-webhook-retry-timeout-budget-source=explicit requires a positive -webhook-retry-timeout-budget")
+	}
+	retryConfig.TimeoutBudget = *retryTimeoutBudget
+
+	// Automatic DLQ replay, if enabled
+	var replayerConfig *webhook.ReplayerConfig
+	if *dlqReplayInterval > 0 {
+		replayerConfig = webhook.DefaultReplayerConfig()
+		replayerConfig.Interval = *dlqReplayInterval
+		replayerConfig.Concurrency = *dlqReplayConcurrency
+		replayerConfig.HostRate = *dlqReplayHostRate
+		replayerConfig.FailureThreshold = *dlqReplayFailureThreshold
+		replayerConfig.PauseDuration = *dlqReplayPause
+	}
+
+	// Optional middleware layers (auth and ACL cannot be disabled for /peer)
+	layers := MiddlewareLayers{
+		Timeout:        *enableTimeout,
+		CircuitBreaker: *enableCircuitBreaker,
+		Quota:          *enableQuota,
+		RateLimit:      *enableRateLimit,
+		Streaming:      *enableStreaming,
+	}
+
+	// Metrics endpoint authentication
+	metricsAuth := MetricsAuth{
+		Mode:              *metricsAuthMode,
+		BasicAuthUsername: *metricsBasicAuthUser,
+		BasicAuthPassword: os.Getenv("METRICS_BASIC_AUTH_PASSWORD"),
+	}
+	switch metricsAuth.Mode {
+	case MetricsAuthNone, MetricsAuthAPIKey:
+	case MetricsAuthBasic:
+		if metricsAuth.BasicAuthUsername == "" || metricsAuth.BasicAuthPassword == "" {
+			fatal("-metrics-auth=basic requires -metrics-basic-auth-user and METRICS_BASIC_AUTH_PASSWORD")
+		}
+	default:
+		fatal("Invalid -metrics-auth value (expected none, api-key or basic)", "value", metricsAuth.Mode)
+	}
+
+	// Request metrics always go to Prometheus, and to StatsD as well if configured
+	var metricsRecorder metrics.Recorder = metrics.NewPrometheusRecorder(metrics.GetDefaultMetrics())
+	if *statsdAddr != "" {
+		statsdRecorder, err := metrics.NewStatsDRecorder(*statsdAddr, *statsdPrefix)
+		if err != nil {
+			fatal("Failed to create StatsD recorder", "statsd_addr", *statsdAddr, "error", err)
+		}
+		defer statsdRecorder.Close()
+		metricsRecorder = metrics.MultiRecorder{metricsRecorder, statsdRecorder}
+	}
+
 	// Create server
-	server := NewServer(*port, *httpsPort, authConfig, tlsConfig, tlsEnabled, leaseRateLimitConfig, quotaManager)
+	server := NewServer(&ServerConfig{
+		Port:                  *port,
+		HTTPSPort:             *httpsPort,
+		TLS:                   tlsConfig,
+		TLSEnabled:            tlsEnabled,
+		HTTPTimeouts:          httpTimeouts,
+		HTTPSTimeouts:         httpsTimeouts,
+		HTTP2:                 http2Settings,
+		Layers:                layers,
+		Plugins:               plugins,
+		Auth:                  authConfig,
+		ACL:                   aclConfig,
+		ClientIPResolver:      clientIPResolver,
+		LeaseTokenSigner:      leaseTokenSigner,
+		LimitBypass:           limitBypass,
+		LeaseRateLimits:       leaseRateLimitConfig,
+		RateLimitWarmUp:       middleware.WarmUp{InitialFraction: *rateLimitWarmUpFraction, Duration: *rateLimitWarmUp},
+		RateLimitKeyIP:        middleware.KeyIPLimit{Mode: *rateLimitKeyIPMode, RequestsPerSecond: *rateLimitKeyIPRate, BurstSize: *rateLimitKeyIPBurst},
+		ConcurrencyLimit:      concurrencyLimitConfig,
+		GlobalConcurrency:     globalConcurrencyConfig,
+		HeaderLimit:           headerLimitConfig,
+		FairQueue:             fairQueueConfig,
+		QuotaManager:          quotaManager,
+		Headers:               headersConfig,
+		Nonce:                 nonceConfig,
+		Idempotency:           idempotencyConfig,
+		DLQ:                   dlqConfig,
+		Retry:                 retryConfig,
+		Replayer:              replayerConfig,
+		Mirror:                mirrorConfig,
+		Capture:               captureConfig,
+		Streaming:             streamingConfig,
+		Bandwidth:             bandwidthConfig,
+		StatusMap:             statusMapConfig,
+		Rewrite:               rewriteConfig,
+		Coalesce:              coalesceConfig,
+		ContentRoute:          contentRouteConfig,
+		Forward:               forwardConfig,
+		StaleCache:            staleCacheConfig,
+		ForceClosedLeases:     forceClosedLeases,
+		BreakerGranularity:    *circuitBreakerGranularity,
+		BreakerIdleTTL:        *circuitBreakerIdleTTL,
+		BreakerStreamFailures: *circuitBreakerStreamFailures,
+		BreakerPrewarm:        prewarmLeases,
+		TimeoutHardStop:       *timeoutHardStop,
+		Service:               serviceConfig,
+		HealthCheck:           healthCheckConfig,
+		StartupGate:           startupGate,
+		Saturation:            saturationConfig,
+		StorageRetry:          storageRetry,
+		MetricsAuth:           metricsAuth,
+		MetricsRecorder:       metricsRecorder,
+	})
+
+	// The usage reporter is started before the server, so hand it over once both exist;
+	// without quotas it is nil and /admin/overview leaves out the quota summary
+	server.adminHandler.SetQuotaUsageReporter(usageReporter)
+
+	// One event summarizing everything loaded, so startup can be verified from logs alone
+	httpsAddr := ""
+	if server.httpsServer != nil {
+		httpsAddr = server.httpsServer.Addr
+	}
+	logging.Info("Relay server starting",
+		slog.String("event", "startup"),
+		slog.Int("api_keys", len(authConfig.APIKeys)),
+		slog.Int("acl_rules", len(aclConfig.ListRules())),
+		slog.Int("acl_key_groups", len(aclConfig.ListKeyGroups())),
+		slog.Int("lease_aliases", len(aclConfig.ListLeaseAliases())),
+		slog.Int("disabled_leases", len(aclConfig.ListDisabledLeases())),
+		slog.Int("lease_rate_limit_rules", len(leaseRateLimitConfig.ListRules())),
+		slog.Int("quota_limits", len(quotaManager.ListLimits())),
+		slog.Int("circuit_breakers", len(server.adminHandler.breakers.ListBreakers())),
+		tlsSummary,
+		slog.Group("http2",
+			slog.Bool("h2c", http2Settings.H2C),
+			slog.Uint64("max_concurrent_streams", uint64(http2Settings.MaxConcurrentStreams)),
+		),
+		slog.Any("middleware", server.activeLayers),
+		slog.Any("lease_paths", leasePathTemplates(leasePaths)),
+		slog.String("http_addr", server.httpServer.Addr),
+		slog.String("https_addr", httpsAddr),
+	)
 
 	// Start server
 	if err := server.Start(); err != nil {
-		log.Fatalf("Server failed: %v", err)
+		fatal("Server failed", "error", err)
+	}
+}
+
+// leasePathTemplates returns the lease path templates for logging
+func leasePathTemplates(patterns []middleware.LeasePathPattern) []string {
+	templates := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		templates[i] = pattern.String()
+	}
+	return templates
+}
+
+// leaseRoutePrefixes returns the distinct mux routes for the lease paths, defaulting to /peer/
+func leaseRoutePrefixes(patterns []middleware.LeasePathPattern) []string {
+	if len(patterns) == 0 {
+		patterns = middleware.DefaultLeasePathPatterns()
+	}
+
+	seen := make(map[string]bool)
+	var routes []string
+	for _, pattern := range patterns {
+		route := pattern.RoutePrefix()
+		if !seen[route] {
+			seen[route] = true
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// splitList splits a comma-separated list, dropping blank entries
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
+}
+
+// fatal logs an error and exits; like log.Fatal, deferred calls do not run
+func fatal(msg string, args ...any) {
+	logging.Error(msg, args...)
+	os.Exit(1)
+}
+
+// ServerConfig holds everything NewServer wires together
+// Optional layers are disabled by leaving their config nil
+type ServerConfig struct {
+	// Listeners
+	Port          string
+	HTTPSPort     string
+	TLS           *tls.Config
+	TLSEnabled    bool
+	HTTPTimeouts  ListenerTimeouts
+	HTTPSTimeouts ListenerTimeouts
+	HTTP2         HTTP2Settings
+
+	// Layers selects the optional /peer layers; Plugins are placed around them
+	Layers  MiddlewareLayers
+	Plugins *plugin.Chain
+
+	// Authentication and access control
+	Auth             *middleware.AuthConfig
+	ACL              *middleware.ACLConfig
+	ClientIPResolver *middleware.ClientIPResolver
+	LeaseTokenSigner *middleware.LeaseTokenSigner // nil disables lease tokens
+
+	// Limits
+	LimitBypass       *middleware.LimitBypass
+	LeaseRateLimits   *middleware.LeaseRateLimitConfig
+	RateLimitWarmUp   middleware.WarmUp
+	RateLimitKeyIP    middleware.KeyIPLimit
+	ConcurrencyLimit  *middleware.ConcurrencyLimitConfig
+	GlobalConcurrency *middleware.GlobalConcurrencyConfig
+	HeaderLimit       *middleware.HeaderLimitConfig
+	FairQueue         *middleware.FairQueueConfig
+	QuotaManager      *quota.Manager
+
+	// Request and response handling
+	Headers      *headers.MiddlewareConfig
+	Nonce        *middleware.NonceConfig
+	Idempotency  *idempotency.MiddlewareConfig
+	Mirror       *mirror.MiddlewareConfig
+	Capture      *capture.MiddlewareConfig
+	Streaming    *streaming.MiddlewareConfig
+	Bandwidth    *bandwidth.MiddlewareConfig
+	StatusMap    *statusmap.MiddlewareConfig
+	Rewrite      *rewrite.MiddlewareConfig
+	Coalesce     *coalesce.MiddlewareConfig
+	ContentRoute *contentroute.MiddlewareConfig
+	Forward      *forward.MiddlewareConfig
+
+	// Webhook delivery
+	DLQ      *webhook.DLQConfig
+	Retry    *webhook.RetryConfig // Retry policy for DLQ replays
+	Replayer *webhook.ReplayerConfig
+
+	// Circuit breaker and timeout
+	StaleCache            *circuitbreaker.StaleCacheConfig
+	ForceClosedLeases     []string
+	BreakerGranularity    string
+	BreakerIdleTTL        time.Duration
+	BreakerStreamFailures bool
+	BreakerPrewarm        []string // Leases whose breakers are created at startup
+	TimeoutHardStop       bool
+
+	// Upstreams and startup
+	Service      *service.Config
+	HealthCheck  *healthcheck.Config
+	StartupGate  *startup.Gate
+	Saturation   *saturation.Config
+	StorageRetry startup.Retry
+
+	// Metrics
+	MetricsAuth     MetricsAuth
+	MetricsRecorder metrics.Recorder
 }
 
 // NewServer creates a new relay server instance
-func NewServer(port, httpsPort string, authConfig *middleware.AuthConfig, tlsConfig *tls.Config, tlsEnabled bool, leaseRateLimitConfig *middleware.LeaseRateLimitConfig, quotaManager *quota.Manager) *Server {
+func NewServer(cfg *ServerConfig) *Server {
+	plugins := cfg.Plugins // Wrapped around every /peer layer below
+
 	mux := http.NewServeMux()
 
-	// Create ACL configuration
-	aclConfig := middleware.NewACLConfig()
+	// Create saturation tracker if enabled; the /peer limiting layers and the global
+	// concurrency limit report the requests they turn away to it
+	var saturationTracker *saturation.Tracker
+	var rejections middleware.RejectionRecorder // Stays nil without a tracker
+	if cfg.Saturation != nil {
+		saturationTracker = saturation.NewTracker(cfg.Saturation)
+		rejections = saturationTracker
+	}
 
 	// Create base rate limit configuration (for admin and auth endpoints)
 	// 100 req/s global, 50 req/s per API key, 10 req/s per IP
@@ -172,60 +1059,194 @@ func NewServer(port, httpsPort string, authConfig *middleware.AuthConfig, tlsCon
 	baseRateLimitConfig.PerKeyBurstSize = 100
 	baseRateLimitConfig.PerIPRequestsPerSecond = 10
 	baseRateLimitConfig.PerIPBurstSize = 20
+	baseRateLimitConfig.WarmUp = cfg.RateLimitWarmUp
+	baseRateLimitConfig.KeyIP = cfg.RateLimitKeyIP
+	baseRateLimitConfig.LimitBypass = cfg.LimitBypass
+	baseRateLimitConfig.ClientIPResolver = cfg.ClientIPResolver
 
 	// Create middlewares
-	authMiddleware := middleware.NewAuthMiddleware(authConfig)
-	aclMiddleware := middleware.NewACLMiddleware(aclConfig)
+	cfg.Auth.LeaseTokenSigner = cfg.LeaseTokenSigner
+	cfg.Auth.ClientIPResolver = cfg.ClientIPResolver
+	authMiddleware := middleware.NewAuthMiddleware(cfg.Auth)
+	authMiddleware.SetMetrics(middleware.NewAuthMetrics())
+	cfg.ACL.ClientIPResolver = cfg.ClientIPResolver
+	aclMiddleware := middleware.NewACLMiddleware(cfg.ACL)
 	baseRateLimitMiddleware := middleware.NewRateLimitMiddleware(baseRateLimitConfig)
+	baseRateLimit := baseRateLimitMiddleware.Middleware
+	if !cfg.Layers.RateLimit {
+		baseRateLimit = func(next http.Handler) http.Handler { return next }
+	}
 
 	// Create lease-specific rate limit middleware (for peer endpoints)
-	leaseRateLimitMiddleware := middleware.NewLeaseRateLimitMiddleware(leaseRateLimitConfig, baseRateLimitConfig)
+	cfg.LeaseRateLimits.Rejections = rejections
+	leaseRateLimitMiddleware := middleware.NewLeaseRateLimitMiddleware(cfg.LeaseRateLimits, baseRateLimitConfig)
 
-	// Create quota middleware
-	quotaMiddleware := quota.NewQuotaMiddleware(quotaManager)
+	// Create per-lease concurrency limit middleware (for peer endpoints)
+	cfg.ConcurrencyLimit.Rejections = rejections
+	concurrencyLimitMiddleware := middleware.NewConcurrencyLimitMiddleware(cfg.ConcurrencyLimit)
 
 	// Create metrics middleware
-	metricsMiddleware := metrics.NewMetricsMiddleware(metrics.GetDefaultMetrics())
+	metricsConfig := &metrics.MiddlewareConfig{
+		Recorder:   cfg.MetricsRecorder,
+		LeasePaths: cfg.ACL.LeasePaths,
+	}
+	if cfg.Service != nil {
+		metricsConfig.Classifier = cfg.Service.Classifier
+	}
+	metricsMiddleware := metrics.NewMetricsMiddlewareWithConfig(metricsConfig)
+
+	// Create quota middleware
+	quotaMiddleware := quota.NewQuotaMiddlewareWithConfig(&quota.MiddlewareConfig{
+		Manager:          cfg.QuotaManager,
+		ExceededRecorder: metricsMiddleware,
+		Rejections:       rejections,
+		Bypass:           cfg.LimitBypass,
+	})
 
 	// Create logging middleware
 	loggingMiddleware := logging.NewLoggingMiddleware(logging.Default())
 
+	// Create panic recovery middleware
+	recoveryMiddleware := recovery.NewMiddleware(recovery.DefaultMiddlewareConfig())
+
+	// Create upstream health checker if configured
+	var healthChecker *healthcheck.Checker
+	if cfg.HealthCheck != nil {
+		healthChecker = healthcheck.NewChecker(cfg.HealthCheck)
+	}
+
 	// Create circuit breaker middleware
-	// 3 max requests in half-open, 30s timeout, 5 consecutive failures to trip
+	// 3 max requests in half-open, counts cleared every 60s while closed, 30s timeout, 5 consecutive failures to trip
 	circuitBreakerConfig := &circuitbreaker.MiddlewareConfig{
-		MaxRequests:      3,
-		Timeout:          30 * time.Second,
-		FailureThreshold: 5,
+		MaxRequests:       3,
+		Interval:          60 * time.Second,
+		Timeout:           30 * time.Second,
+		FailureThreshold:  5,
+		ForceClosedLeases: cfg.ForceClosedLeases,
+		Granularity:       cfg.BreakerGranularity,
+		LeasePaths:        cfg.ACL.LeasePaths,
+		IdleTTL:           cfg.BreakerIdleTTL,
+		Rejections:        rejections,
+
+		DetectStreamFailures: cfg.BreakerStreamFailures,
+	}
+	if cfg.StaleCache != nil {
+		circuitBreakerConfig.StaleCache = circuitbreaker.NewStaleCache(cfg.StaleCache)
+	}
+	if cfg.Service != nil {
+		circuitBreakerConfig.Classifier = cfg.Service.Classifier
+		circuitBreakerConfig.ServiceFailureThresholds = cfg.Service.FailureThresholds
+	}
+	if healthChecker != nil {
+		// Leases with a health check recover through it instead of real trial requests
+		circuitBreakerConfig.HealthProbe = healthChecker.Probe
+		circuitBreakerConfig.HealthProbeLeases = healthChecker.Probes
 	}
 	circuitBreakerMiddleware := circuitbreaker.NewMiddleware(circuitBreakerConfig)
+	circuitBreakerMiddleware.PrewarmBreakers(cfg.BreakerPrewarm)
 
 	// Create timeout middleware
 	// Default 30s, MCP 10s, n8n 60s, OpenAI 30s
 	timeoutConfig := timeout.DefaultMiddlewareConfig()
+	timeoutConfig.HardStop = cfg.TimeoutHardStop
+	if cfg.Service != nil {
+		timeoutConfig.Classifier = cfg.Service.Classifier
+		for serviceType, serviceTimeout := range cfg.Service.Timeouts {
+			timeoutConfig.ServiceTimeouts[serviceType] = serviceTimeout
+		}
+	}
 	timeoutMiddleware := timeout.NewMiddleware(timeoutConfig)
 
 	// Create streaming middleware
 	// Enable SSE and streaming support
-	streamingConfig := streaming.DefaultMiddlewareConfig()
+	streamingConfig := cfg.Streaming
+	if streamingConfig == nil {
+		streamingConfig = streaming.DefaultMiddlewareConfig()
+	}
 	streamingMiddleware := streaming.NewMiddleware(streamingConfig)
 
 	// Create shutdown manager
 	shutdownManager := shutdown.NewManager(nil)
+	shutdownManager.RegisterCleanup(func() error {
+		circuitBreakerMiddleware.Stop()
+		return nil
+	})
+
+	if healthChecker != nil {
+		healthChecker.Start()
+		shutdownManager.RegisterCleanup(func() error {
+			healthChecker.Stop()
+			return nil
+		})
+	}
+
+	if saturationTracker != nil {
+		shutdownManager.RegisterCleanup(func() error {
+			saturationTracker.Stop()
+			return nil
+		})
+	}
 
 	// Create DLQ
-	dlq, err := webhook.NewDLQ("dlq.db")
+	var dlq *webhook.DLQ
+	err := cfg.StorageRetry.Do("DLQ", func() (err error) {
+		dlq, err = webhook.NewDLQWithConfig("dlq.db", cfg.DLQ)
+		return err
+	})
 	if err != nil {
-		log.Fatalf("Failed to create DLQ: %v", err)
+		fatal("Failed to create DLQ", "error", err)
+	}
+	if cfg.StartupGate.HasSelfTests() {
+		cfg.StartupGate.AddSelfTest("dlq", func(ctx context.Context) error {
+			_, err := dlq.Count()
+			return err
+		})
 	}
-	defer dlq.Close()
+	shutdownManager.RegisterCleanup(func() error {
+		cfg.StartupGate.Stop()
+		return nil
+	})
 
 	// Create admin handler
-	adminHandler := NewAdminHandler(aclConfig, quotaManager, dlq)
+	adminHandler := NewAdminHandler(cfg.Auth, cfg.ACL, cfg.QuotaManager, dlq, cfg.Capture, cfg.Retry)
+	adminHandler.SetHealthChecker(healthChecker)
+	adminHandler.SetCircuitBreaker(circuitBreakerMiddleware)
+	adminHandler.SetRateLimitConfig(baseRateLimitConfig)
+	adminHandler.SetLeaseTracker(metricsMiddleware)
+	adminHandler.SetLeaseTokenSigner(cfg.LeaseTokenSigner)
+	if cfg.TLSEnabled {
+		adminHandler.SetTLSConfig(cfg.TLS)
+	}
+
+	// Start automatic DLQ replay if enabled; it shares the admin API's replay handler
+	var replayer *webhook.Replayer
+	if cfg.Replayer != nil {
+		replayer = webhook.NewReplayer(dlq, adminHandler.retryHandler, cfg.Replayer)
+		replayer.Start()
+	}
+
+	// The DLQ stays open for the admin API and the replayer until shutdown
+	shutdownManager.RegisterCleanup(func() error {
+		if replayer != nil {
+			replayer.Stop()
+		}
+		return dlq.Close()
+	})
 
 	// Public endpoints (no authentication required)
 	mux.HandleFunc("/health", makeHealthHandler(shutdownManager))
+	mux.HandleFunc("/readyz", makeReadyHandler(shutdownManager, healthChecker, cfg.StartupGate))
 	mux.HandleFunc("/", handleRoot)
-	mux.Handle("/metrics", promhttp.Handler()) // Prometheus metrics endpoint
+
+	// Prometheus metrics endpoint (public unless -metrics-auth is set, since labels carry key and lease IDs)
+	var metricsEndpoint http.Handler = promhttp.Handler()
+	switch cfg.MetricsAuth.Mode {
+	case MetricsAuthAPIKey:
+		metricsEndpoint = authMiddleware.Middleware(middleware.NewScopeMiddleware("metrics").Middleware(metricsEndpoint))
+	case MetricsAuthBasic:
+		metricsEndpoint = middleware.NewBasicAuthMiddleware(cfg.MetricsAuth.BasicAuthUsername, cfg.MetricsAuth.BasicAuthPassword, "metrics").Middleware(metricsEndpoint)
+	}
+	mux.Handle("/metrics", metricsEndpoint)
 
 	// Admin endpoints (authentication + admin scope required)
 	adminMux := http.NewServeMux()
@@ -239,7 +1260,9 @@ func NewServer(port, httpsPort string, authConfig *middleware.AuthConfig, tlsCon
 		}
 	})
 	adminMux.HandleFunc("/admin/acl/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
+		if r.Method == http.MethodPost && r.URL.Path == "/admin/acl/check" {
+			adminHandler.HandleCheckACL(w, r)
+		} else if r.Method == http.MethodGet {
 			adminHandler.HandleGetACLRule(w, r)
 		} else if r.Method == http.MethodDelete {
 			adminHandler.HandleRemoveACLRule(w, r)
@@ -247,9 +1270,51 @@ func NewServer(port, httpsPort string, authConfig *middleware.AuthConfig, tlsCon
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	adminMux.HandleFunc("/admin/key-groups", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			adminHandler.HandleListKeyGroups(w, r)
+		} else if r.Method == http.MethodPost {
+			adminHandler.HandleSetKeyGroup(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	adminMux.HandleFunc("/admin/key-groups/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			adminHandler.HandleGetKeyGroup(w, r)
+		} else if r.Method == http.MethodDelete {
+			adminHandler.HandleRemoveKeyGroup(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	adminMux.HandleFunc("/admin/lease-aliases", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			adminHandler.HandleListLeaseAliases(w, r)
+		} else if r.Method == http.MethodPost {
+			adminHandler.HandleSetLeaseAlias(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	adminMux.HandleFunc("/admin/lease-aliases/", adminHandler.HandleRemoveLeaseAlias)
+	adminMux.HandleFunc("/admin/lease", adminHandler.HandleListDisabledLeases)
+	adminMux.HandleFunc("/admin/lease/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/disable") || strings.HasSuffix(r.URL.Path, "/enable") {
+			adminHandler.HandleSetLeaseEnabled(w, r)
+		} else {
+			adminHandler.HandleGetLeaseState(w, r)
+		}
+	})
+	adminMux.HandleFunc("/admin/keys/export", adminHandler.HandleExportKeys)
+	adminMux.HandleFunc("/admin/keys/import", adminHandler.HandleImportKeys)
+	adminMux.HandleFunc("/admin/lease-tokens", adminHandler.HandleIssueLeaseToken)
+	adminMux.HandleFunc("/admin/quota/bulk", adminHandler.HandleBulkSetQuotaLimit)
 	adminMux.HandleFunc("/admin/quota/", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.URL.Path, "/reset") && r.Method == http.MethodPost {
 			adminHandler.HandleResetQuota(w, r)
+		} else if strings.HasSuffix(r.URL.Path, "/plan") && r.Method == http.MethodPost {
+			adminHandler.HandleChangePlan(w, r)
 		} else if r.Method == http.MethodGet {
 			adminHandler.HandleGetQuotaStatus(w, r)
 		} else if r.Method == http.MethodPost {
@@ -258,6 +1323,41 @@ func NewServer(port, httpsPort string, authConfig *middleware.AuthConfig, tlsCon
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	adminMux.HandleFunc("/admin/connections", adminHandler.HandleListActiveConnections)
+	adminMux.HandleFunc("/admin/overview", adminHandler.HandleOverview)
+	adminMux.HandleFunc("/admin/capture", adminHandler.HandleListCaptures)
+	adminMux.HandleFunc("/admin/capture/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			adminHandler.HandleStartCapture(w, r)
+		} else if r.Method == http.MethodGet {
+			adminHandler.HandleGetCapture(w, r)
+		} else if r.Method == http.MethodDelete {
+			adminHandler.HandleStopCapture(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	adminMux.HandleFunc("/admin/circuit-breakers", adminHandler.HandleListCircuitBreakers)
+	adminMux.HandleFunc("/admin/circuit-breakers/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/force-closed") {
+			http.NotFound(w, r)
+		} else if r.Method == http.MethodPut {
+			adminHandler.HandleSetForceClosed(w, r)
+		} else if r.Method == http.MethodDelete {
+			adminHandler.HandleClearForceClosed(w, r)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	adminMux.HandleFunc("/admin/ratelimit/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/reset") {
+			adminHandler.HandleResetLimiter(w, r)
+		} else {
+			adminHandler.HandleGetLimiterState(w, r)
+		}
+	})
+	adminMux.HandleFunc("/admin/upstreams", adminHandler.HandleListUpstreamHealth)
+	adminMux.HandleFunc("/admin/upstreams/", adminHandler.HandleGetUpstreamHealth)
 	adminMux.HandleFunc("/admin/dlq", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			adminHandler.HandleListDLQ(w, r)
@@ -278,45 +1378,210 @@ func NewServer(port, httpsPort string, authConfig *middleware.AuthConfig, tlsCon
 	})
 
 	// Apply auth and base rate limit middleware to admin routes
-	mux.Handle("/admin/", authMiddleware.Middleware(baseRateLimitMiddleware.Middleware(adminMux)))
+	mux.Handle("/admin/", authMiddleware.Middleware(baseRateLimit(adminMux)))
+
+	// Admin console, with the admin scope required like the rest of /admin
+	adminUI := http.NewServeMux()
+	adminUI.Handle("/admin/ui/", newAdminUIHandler())
+	adminUI.Handle("/admin/ui", http.RedirectHandler("/admin/ui/", http.StatusMovedPermanently))
+	adminUIHandler := authMiddleware.Middleware(middleware.NewScopeMiddleware("admin").Middleware(baseRateLimit(adminUI)))
+	mux.Handle("/admin/ui/", adminUIHandler)
+	mux.Handle("/admin/ui", adminUIHandler)
 
-	// Protected endpoints (authentication + ACL + timeout + circuit breaker + quota + lease-specific rate limiting + streaming required)
+	// Protected endpoints (authentication + ACL + timeout + circuit breaker + quota + lease-specific rate limiting + concurrency limiting + streaming required)
+	// Every configured lease path shares one chain, so lease-scoped state is the same whichever route a lease is reached through
+	leaseRoutes := leaseRoutePrefixes(cfg.ACL.LeasePaths)
 	peerMux := http.NewServeMux()
-	peerMux.HandleFunc("/peer/", handlePeerRequest)
+	for _, route := range leaseRoutes {
+		peerMux.HandleFunc(route, handlePeerRequest)
+	}
 
-	// Apply auth, ACL, timeout, circuit breaker, quota, lease-specific rate limit, and streaming middleware to peer routes
-	// Order: auth -> ACL (sets lease ID) -> timeout -> circuit breaker -> quota -> lease rate limit -> streaming -> handler
-	mux.Handle("/peer/", authMiddleware.Middleware(aclMiddleware.Middleware(timeoutMiddleware.Middleware(circuitBreakerMiddleware.Middleware(quotaMiddleware.Middleware(leaseRateLimitMiddleware.Middleware(streamingMiddleware.Middleware(peerMux))))))))
+	// Apply auth, ACL, timeout, circuit breaker, quota, lease-specific rate limit, concurrency limit, and streaming middleware to peer routes
+	// Order: auth -> ACL (sets lease ID) -> replay protection (optional) -> idempotency (optional) -> timeout -> circuit breaker -> quota -> lease rate limit -> concurrency limit -> fair queue (optional) -> streaming -> bandwidth (optional) -> status map (optional) -> payload capture -> mirror (optional) -> rewrite (optional) -> coalescing (optional) -> content type routing (optional) -> header forwarding -> handler
+	// Layers are wrapped innermost first; disabled layers are skipped without changing the order of the rest
+	// No layer reads the request body before payload capture, so with "Expect: 100-continue" a rejected
+	// upload is answered with its error status and the client never sends the body
+	// Plugin middlewares from -plugin-config are wrapped on either side of the layer they are placed next to, disabled or not
+	var peerHandler http.Handler = plugins.Before("handler", peerMux)
+	peerHandler = plugins.After("forward_headers", peerHandler)
+	// Innermost and always on, so headers set by rewrite rules are filtered too, while coalescing
+	// still keys on the client's credentials
+	peerHandler = forward.NewMiddleware(cfg.Forward).Middleware(peerHandler)
+	peerHandler = plugins.After("content_route", plugins.Before("forward_headers", peerHandler))
+	if cfg.ContentRoute != nil {
+		// Inside rewrite, so routes match the Content-Type as sent upstream
+		peerHandler = contentroute.NewMiddleware(cfg.ContentRoute).Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("coalesce", plugins.Before("content_route", peerHandler))
+	if cfg.Coalesce != nil {
+		// Inside rewrite, so requests are matched as sent upstream and every client's copy is rewritten on its own
+		peerHandler = coalesce.NewMiddleware(cfg.Coalesce).Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("rewrite", plugins.Before("coalesce", peerHandler))
+	if cfg.Rewrite != nil {
+		// Innermost, so hooks see the request as sent upstream and the response as it came back
+		peerHandler = rewrite.NewMiddleware(cfg.Rewrite).Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("mirror", plugins.Before("rewrite", peerHandler))
+	if cfg.Mirror != nil {
+		// Innermost, so only requests the handler actually served are copied to the mirror
+		mirrorMiddleware := mirror.NewMiddleware(cfg.Mirror)
+		shutdownManager.RegisterCleanup(func() error {
+			mirrorMiddleware.Stop()
+			return nil
+		})
+		peerHandler = mirrorMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("payload_capture", plugins.Before("mirror", peerHandler))
+	// Idle until a capture session is started through /admin/capture
+	peerHandler = capture.NewMiddleware(cfg.Capture).Middleware(peerHandler)
+	peerHandler = plugins.After("status_map", plugins.Before("payload_capture", peerHandler))
+	if cfg.StatusMap != nil {
+		// Inside the circuit breaker, so it classifies the remapped code the client receives;
+		// capture and mirror keep seeing the upstream's own code
+		peerHandler = statusmap.NewMiddleware(cfg.StatusMap).Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("bandwidth", plugins.Before("status_map", peerHandler))
+	if cfg.Bandwidth != nil {
+		// Paces the body as the client receives it, after status remapping and capture have seen it
+		peerHandler = bandwidth.NewMiddleware(cfg.Bandwidth).Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("streaming", plugins.Before("bandwidth", peerHandler))
+	if cfg.Layers.Streaming {
+		peerHandler = streamingMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("fair_queue", plugins.Before("streaming", peerHandler))
+	if cfg.FairQueue != nil {
+		// Shared slots are taken after per-lease limits, so a lease over its own cap never holds a place in the queue
+		cfg.FairQueue.Rejections = rejections
+		fairQueueMiddleware := middleware.NewFairQueueMiddleware(cfg.FairQueue)
+		shutdownManager.RegisterCleanup(func() error {
+			fairQueueMiddleware.Stop()
+			return nil
+		})
+		peerHandler = fairQueueMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("concurrency_limit", plugins.Before("fair_queue", peerHandler))
+	peerHandler = concurrencyLimitMiddleware.Middleware(peerHandler)
+	peerHandler = plugins.After("rate_limit", plugins.Before("concurrency_limit", peerHandler))
+	if cfg.Layers.RateLimit {
+		peerHandler = leaseRateLimitMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("quota", plugins.Before("rate_limit", peerHandler))
+	if cfg.Layers.Quota {
+		peerHandler = quotaMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("circuit_breaker", plugins.Before("quota", peerHandler))
+	if cfg.Layers.CircuitBreaker {
+		peerHandler = circuitBreakerMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("timeout", plugins.Before("circuit_breaker", peerHandler))
+	if cfg.Layers.Timeout {
+		peerHandler = timeoutMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("idempotency", plugins.Before("timeout", peerHandler))
+	if cfg.Idempotency != nil {
+		// Replays are served before timeout, circuit breaker, quota and rate limits are applied
+		idempotencyMiddleware := idempotency.NewMiddleware(cfg.Idempotency)
+		shutdownManager.RegisterCleanup(func() error {
+			idempotencyMiddleware.Stop()
+			return nil
+		})
+		peerHandler = idempotencyMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("replay_protection", plugins.Before("idempotency", peerHandler))
+	if cfg.Nonce != nil {
+		// A replayed request is rejected before it can be answered from the idempotency store
+		nonceMiddleware := middleware.NewNonceMiddleware(cfg.Nonce)
+		shutdownManager.RegisterCleanup(func() error {
+			nonceMiddleware.Stop()
+			return nil
+		})
+		peerHandler = nonceMiddleware.Middleware(peerHandler)
+	}
+	peerHandler = plugins.After("acl", plugins.Before("replay_protection", peerHandler))
+	peerHandler = aclMiddleware.Middleware(peerHandler)
+	peerHandler = plugins.After("auth", plugins.Before("acl", peerHandler))
+	peerHandler = plugins.Before("auth", authMiddleware.Middleware(peerHandler))
+	for _, route := range leaseRoutes {
+		mux.Handle(route, peerHandler)
+	}
 
 	// Auth validation endpoint (authentication + base rate limiting only, no ACL)
 	authValidateMux := http.NewServeMux()
 	authValidateMux.HandleFunc("/auth/validate", handleAuthValidate)
-	mux.Handle("/auth/validate", authMiddleware.Middleware(baseRateLimitMiddleware.Middleware(authValidateMux)))
+	mux.Handle("/auth/validate", authMiddleware.Middleware(baseRateLimit(authValidateMux)))
 
 	// Wrap all routes with middleware layers
-	// Order: logging -> metrics -> routes
-	metricsHandler := metricsMiddleware.Middleware(mux)
+	// Order: logging -> metrics -> header limit (optional) -> saturation (optional) -> global concurrency limit (optional) -> security headers (optional) -> recovery -> routes
+	// Recovery sits outside every route chain, so a panic still counts as a circuit breaker
+	// failure and the 500 it writes is logged, measured and gets the security headers
+	var routesHandler http.Handler = recoveryMiddleware.Middleware(mux)
+	if cfg.Headers != nil {
+		// Injected just before the response header is written, so handler-set values win unless forced
+		routesHandler = headers.NewMiddleware(cfg.Headers).Middleware(routesHandler)
+	}
+	if cfg.GlobalConcurrency != nil {
+		// Sheds load before any route work, while shed requests are still logged and measured
+		cfg.GlobalConcurrency.Rejections = rejections
+		globalConcurrencyMiddleware := middleware.NewGlobalConcurrencyMiddleware(cfg.GlobalConcurrency)
+		routesHandler = globalConcurrencyMiddleware.Middleware(routesHandler)
+	}
+	if saturationTracker != nil {
+		// Counts every request outside the layers that report rejections, so each rejection has its request
+		routesHandler = saturationTracker.Middleware(routesHandler)
+	}
+	if cfg.HeaderLimit != nil {
+		// Cheapest check first, so abusive requests never take a concurrency slot
+		routesHandler = middleware.NewHeaderLimitMiddleware(cfg.HeaderLimit).Middleware(routesHandler)
+	}
+	metricsHandler := metricsMiddleware.Middleware(routesHandler)
 	loggingHandler := loggingMiddleware.Middleware(metricsHandler)
 
+	// Bound what the parser reads as well; net/http answers 431 itself well before its 1 MB default
+	var maxHeaderBytes int
+	if cfg.HeaderLimit != nil {
+		maxHeaderBytes = cfg.HeaderLimit.MaxHeaderBytes
+	}
+
 	// Create HTTP server
 	httpServer := &http.Server{
-		Addr:         ":" + port,
-		Handler:      loggingHandler,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:           ":" + cfg.Port,
+		Handler:        loggingHandler,
+		ReadTimeout:    cfg.HTTPTimeouts.ReadTimeout,
+		WriteTimeout:   cfg.HTTPTimeouts.WriteTimeout,
+		IdleTimeout:    cfg.HTTPTimeouts.IdleTimeout,
+		MaxHeaderBytes: maxHeaderBytes,
+		ErrorLog:       slog.NewLogLogger(logging.Default().Handler(), slog.LevelWarn),
 	}
 
 	// Create HTTPS server if TLS is enabled
 	var httpsServer *http.Server
-	if tlsEnabled && tlsConfig != nil {
+	if cfg.TLSEnabled && cfg.TLS != nil {
 		httpsServer = &http.Server{
-			Addr:         ":" + httpsPort,
-			Handler:      loggingHandler,
-			TLSConfig:    tlsConfig,
-			ReadTimeout:  15 * time.Second,
-			WriteTimeout: 15 * time.Second,
-			IdleTimeout:  60 * time.Second,
+			Addr:           ":" + cfg.HTTPSPort,
+			Handler:        loggingHandler,
+			TLSConfig:      cfg.TLS,
+			ReadTimeout:    cfg.HTTPSTimeouts.ReadTimeout,
+			WriteTimeout:   cfg.HTTPSTimeouts.WriteTimeout,
+			IdleTimeout:    cfg.HTTPSTimeouts.IdleTimeout,
+			MaxHeaderBytes: maxHeaderBytes,
+			ErrorLog:       slog.NewLogLogger(logging.Default().Handler(), slog.LevelWarn),
+		}
+	}
+
+	// HTTP/2 is configured explicitly rather than left to net/http, so its limits can be tuned.
+	// Configuring the HTTP server too lets graceful shutdown send h2c connections a GOAWAY
+	if cfg.HTTP2.H2C {
+		h2cServer := cfg.HTTP2.newServer()
+		if err := http2.ConfigureServer(httpServer, h2cServer); err != nil {
+			fatal("Failed to configure h2c", "error", err)
+		}
+		httpServer.Handler = h2c.NewHandler(loggingHandler, h2cServer)
+	}
+	if httpsServer != nil {
+		if err := http2.ConfigureServer(httpsServer, cfg.HTTP2.newServer()); err != nil {
+			fatal("Failed to configure HTTP/2", "error", err)
 		}
 	}
 
@@ -328,17 +1593,89 @@ func NewServer(port, httpsPort string, authConfig *middleware.AuthConfig, tlsCon
 
 	// Register cleanup functions
 	shutdownManager.RegisterCleanup(func() error {
-		quotaManager.Close()
+		cfg.QuotaManager.Close()
+		return nil
+	})
+	shutdownManager.RegisterCleanup(func() error {
+		concurrencyLimitMiddleware.Stop()
 		return nil
 	})
 
+	// Active layers in request order: global chain, then the /peer chain
+	activeLayers := []string{"logging", "metrics"}
+	if cfg.HeaderLimit != nil {
+		activeLayers = append(activeLayers, "header_limit")
+	}
+	if cfg.Saturation != nil {
+		activeLayers = append(activeLayers, "saturation")
+	}
+	if cfg.GlobalConcurrency != nil {
+		activeLayers = append(activeLayers, "global_concurrency_limit")
+	}
+	if cfg.Headers != nil {
+		activeLayers = append(activeLayers, "security_headers")
+	}
+	activeLayers = append(activeLayers, "recovery", "auth", "acl")
+	if cfg.Nonce != nil {
+		activeLayers = append(activeLayers, "replay_protection")
+	}
+	if cfg.Idempotency != nil {
+		activeLayers = append(activeLayers, "idempotency")
+	}
+	if cfg.Layers.Timeout {
+		activeLayers = append(activeLayers, "timeout")
+	}
+	if cfg.Layers.CircuitBreaker {
+		activeLayers = append(activeLayers, "circuit_breaker")
+	}
+	if cfg.Layers.Quota {
+		activeLayers = append(activeLayers, "quota")
+	}
+	if cfg.Layers.RateLimit {
+		activeLayers = append(activeLayers, "rate_limit")
+	}
+	activeLayers = append(activeLayers, "concurrency_limit")
+	if cfg.FairQueue != nil {
+		activeLayers = append(activeLayers, "fair_queue")
+	}
+	if cfg.Layers.Streaming {
+		activeLayers = append(activeLayers, "streaming")
+	}
+	if cfg.Bandwidth != nil {
+		activeLayers = append(activeLayers, "bandwidth")
+	}
+	if cfg.StatusMap != nil {
+		activeLayers = append(activeLayers, "status_map")
+	}
+	activeLayers = append(activeLayers, "payload_capture")
+	if cfg.Mirror != nil {
+		activeLayers = append(activeLayers, "mirror")
+	}
+	if cfg.Rewrite != nil {
+		activeLayers = append(activeLayers, "rewrite")
+	}
+	if cfg.Coalesce != nil {
+		activeLayers = append(activeLayers, "coalesce")
+	}
+	if cfg.ContentRoute != nil {
+		activeLayers = append(activeLayers, "content_route")
+	}
+	activeLayers = append(activeLayers, "forward_headers")
+	if plugins != nil {
+		peerStart := slices.Index(activeLayers, "auth")
+		activeLayers = append(activeLayers[:peerStart:peerStart], plugins.Describe(activeLayers[peerStart:])...)
+	}
+
 	return &Server{
 		httpServer:      httpServer,
 		httpsServer:     httpsServer,
-		authConfig:      authConfig,
-		aclConfig:       aclConfig,
-		tlsEnabled:      tlsEnabled,
+		authConfig:      cfg.Auth,
+		aclConfig:       cfg.ACL,
+		tlsEnabled:      cfg.TLSEnabled,
 		shutdownManager: shutdownManager,
+		adminHandler:    adminHandler,
+		startupGate:     cfg.StartupGate,
+		activeLayers:    activeLayers,
 	}
 }
 
@@ -348,10 +1685,12 @@ func (s *Server) Start() error {
 	shutdown := make(chan error, 1)
 	go s.handleShutdown(shutdown)
 
+	// The warm-up period starts now that the listeners are about to open
+	s.startupGate.Start()
+
 	// Start HTTPS server if TLS is enabled
 	if s.tlsEnabled && s.httpsServer != nil {
 		go func() {
-			log.Printf("Starting HTTPS server on %s", s.httpsServer.Addr)
 			if err := s.httpsServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				shutdown <- fmt.Errorf("HTTPS server error: %w", err)
 			}
@@ -359,7 +1698,6 @@ func (s *Server) Start() error {
 	}
 
 	// Start HTTP server
-	log.Printf("Starting HTTP server on %s", s.httpServer.Addr)
 	go func() {
 		if err := s.httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			shutdown <- fmt.Errorf("HTTP server error: %w", err)
@@ -376,20 +1714,20 @@ func (s *Server) handleShutdown(shutdown chan<- error) {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	sig := <-sigChan
-	log.Printf("Received signal: %v, initiating graceful shutdown...", sig)
+	logging.Info("Received signal, initiating graceful shutdown", "signal", sig.String())
 
 	// Create shutdown context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
 	// Use shutdown manager for graceful shutdown
-	log.Println("Shutting down servers...")
+	logging.Info("Shutting down servers")
 	if err := s.shutdownManager.Shutdown(ctx); err != nil {
 		shutdown <- fmt.Errorf("shutdown error: %w", err)
 		return
 	}
 
-	log.Println("Server shutdown completed successfully")
+	logging.Info("Server shutdown completed successfully")
 	shutdown <- nil
 }
 
@@ -410,6 +1748,53 @@ func makeHealthHandler(sm *shutdown.Manager) http.HandlerFunc {
 	}
 }
 
+// makeReadyHandler creates the readiness handler
+// Without health checks the gateway is ready from the end of its startup warm-up until
+// shutdown; with them, every upstream whose check gates readiness must also be healthy
+func makeReadyHandler(sm *shutdown.Manager, checker *healthcheck.Checker, gate *startup.Gate) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		// Return 503 if shutting down
+		if sm.IsShuttingDown() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, `{"status":"shutting_down","timestamp":"%s"}`, time.Now().Format(time.RFC3339))
+			return
+		}
+
+		// Return 503 during the startup warm-up or until the self-tests pass
+		if status := gate.Status(); !status.Ready {
+			response := map[string]any{
+				"status":           "warming_up",
+				"ready_in_seconds": status.WarmUpRemaining.Seconds(),
+				"timestamp":        time.Now().Format(time.RFC3339),
+			}
+			if len(status.FailedSelfTests) > 0 {
+				response["failed_self_tests"] = status.FailedSelfTests
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+
+		// Return 503 while a gating upstream is not healthy
+		if checker != nil {
+			if notReady := checker.NotReady(); len(notReady) > 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				json.NewEncoder(w).Encode(map[string]any{
+					"status":              "not_ready",
+					"unhealthy_upstreams": notReady,
+					"timestamp":           time.Now().Format(time.RFC3339),
+				})
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintf(w, `{"status":"ready","timestamp":"%s"}`, time.Now().Format(time.RFC3339))
+	}
+}
+
 // handleRoot handles root path requests
 func handleRoot(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
@@ -422,36 +1807,62 @@ func handleRoot(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, `{"service":"portal-gateway","version":"0.1.0","status":"running"}`)
 }
 
+// peerMethods are the methods accepted on peer routes, as advertised in the Allow header
+var peerMethods = strings.Join([]string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+}, ", ")
+
 // handlePeerRequest handles peer relay requests (requires authentication + ACL)
 func handlePeerRequest(w http.ResponseWriter, r *http.Request) {
 	// Get API key info from context
 	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
 	if apiKeyInfo == nil {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "missing_api_key", "API key is required")
 		return
 	}
 
 	// Get lease ID from context (set by ACL middleware)
 	leaseID := middleware.GetLeaseID(r.Context())
 	if leaseID == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, `{"error":"invalid_lease_id","message":"Lease ID is required"}`)
+		problem.Write(w, r, http.StatusBadRequest, "invalid_lease_id", "Lease ID is required")
 		return
 	}
 
 	// Check if API key has required scope
 	if !apiKeyInfo.HasScope("write") && !apiKeyInfo.HasScope("admin") {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusForbidden)
-		fmt.Fprintf(w, `{"error":"insufficient_permissions","message":"This endpoint requires 'write' or 'admin' scope"}`)
+		problem.Write(w, r, http.StatusForbidden, "insufficient_permissions", "This endpoint requires 'write' or 'admin' scope")
 		return
 	}
 
-	// TODO: Implement actual peer relay logic
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	case http.MethodOptions:
+		// Answered by the gateway until the relay can forward it to the backend
+		w.Header().Set("Allow", peerMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", peerMethods)
+		problem.Write(w, r, http.StatusMethodNotAllowed, "method_not_allowed", fmt.Sprintf("Method %s is not supported on peer routes", r.Method))
+		return
+	}
+
+	// TODO: Implement actual peer relay logic; HEAD must be forwarded without a body
+	body := fmt.Sprintf(`{"message":"Peer relay endpoint (implementation pending)","authenticated_as":"%s","lease_id":"%s"}`, apiKeyInfo.KeyID, leaseID)
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{"message":"Peer relay endpoint (implementation pending)","authenticated_as":"%s","lease_id":"%s"}`, apiKeyInfo.KeyID, leaseID)
+
+	// HEAD gets the same headers as GET, without the body
+	if r.Method != http.MethodHead {
+		io.WriteString(w, body)
+	}
 }
 
 // handleAuthValidate handles API key validation requests (requires authentication)
@@ -459,7 +1870,7 @@ func handleAuthValidate(w http.ResponseWriter, r *http.Request) {
 	// Get API key info from context
 	apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
 	if apiKeyInfo == nil {
-		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, "missing_api_key", "API key is required")
 		return
 	}
 
@@ -0,0 +1,266 @@
+// Package adminpb encodes admin API responses as protobuf messages defined in admin.proto
+package adminpb
+
+import (
+	"sort"
+	"time"
+
+	"github.com/munnerz/goautoneg"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/portal-project/portal-gateway/portal/quota"
+	"github.com/portal-project/portal-gateway/portal/webhook"
+)
+
+// Media types the admin read endpoints can answer with
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// Message is a response that can be encoded in protobuf wire format
+type Message interface {
+	// Marshal returns the message in protobuf wire format
+	Marshal() []byte
+	// ProtoName returns the fully qualified message name from admin.proto
+	ProtoName() string
+}
+
+// Negotiate picks the response media type for an Accept header
+// JSON is returned unless the client prefers protobuf, so clients that send no Accept header
+// or "*/*" keep getting JSON
+func Negotiate(accept string) string {
+	if goautoneg.Negotiate(accept, []string{ContentTypeJSON, ContentTypeProtobuf}) == ContentTypeProtobuf {
+		return ContentTypeProtobuf
+	}
+	return ContentTypeJSON
+}
+
+// ContentType returns the Content-Type for a protobuf-encoded message, naming its schema
+func ContentType(m Message) string {
+	return ContentTypeProtobuf + "; proto=" + m.ProtoName()
+}
+
+// TimeWindow is a recurring access window
+type TimeWindow struct {
+	Days  []string
+	Start string
+	End   string
+}
+
+func (m *TimeWindow) appendTo(b []byte) []byte {
+	b = appendStrings(b, 1, m.Days)
+	b = appendString(b, 2, m.Start)
+	b = appendString(b, 3, m.End)
+	return b
+}
+
+// ACLRule is an ACL rule as returned by GET /admin/acl
+type ACLRule struct {
+	LeaseID            string
+	AllowedKeyIDs      []string
+	AllowedKeyGroups   []string
+	AllowedIPRanges    []string
+	AllowedTimeWindows []*TimeWindow
+	TimeZone           string
+	ResponseHeaders    map[string]string
+}
+
+func (m *ACLRule) appendTo(b []byte) []byte {
+	b = appendString(b, 1, m.LeaseID)
+	b = appendStrings(b, 2, m.AllowedKeyIDs)
+	b = appendStrings(b, 3, m.AllowedKeyGroups)
+	b = appendStrings(b, 4, m.AllowedIPRanges)
+	for _, window := range m.AllowedTimeWindows {
+		b = appendMessage(b, 5, window.appendTo(nil))
+	}
+	b = appendString(b, 6, m.TimeZone)
+	b = appendStringMap(b, 7, m.ResponseHeaders)
+	return b
+}
+
+// ACLRuleList is the response of GET /admin/acl
+type ACLRuleList struct {
+	Rules []*ACLRule
+}
+
+// Marshal returns the message in protobuf wire format
+func (m *ACLRuleList) Marshal() []byte {
+	var b []byte
+	for _, rule := range m.Rules {
+		b = appendMessage(b, 1, rule.appendTo(nil))
+	}
+	return b
+}
+
+// ProtoName returns the fully qualified message name
+func (m *ACLRuleList) ProtoName() string { return "portal.admin.v1.ACLRuleList" }
+
+// QuotaStatus is the response of GET /admin/quota/{key_id}
+type QuotaStatus struct {
+	*quota.QuotaStatus
+}
+
+// NewQuotaStatus wraps a quota status for protobuf encoding
+func NewQuotaStatus(status *quota.QuotaStatus) *QuotaStatus {
+	return &QuotaStatus{QuotaStatus: status}
+}
+
+// Marshal returns the message in protobuf wire format
+func (m *QuotaStatus) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, m.KeyID)
+	b = appendInt64(b, 2, m.RequestCount)
+	b = appendInt64(b, 3, m.RequestLimit)
+	b = appendInt64(b, 4, m.RequestRemaining)
+	b = appendInt64(b, 5, m.RolloverRequests)
+	b = appendInt64(b, 6, m.BytesTransferred)
+	b = appendInt64(b, 7, m.BytesLimit)
+	b = appendInt64(b, 8, m.BytesRemaining)
+	b = appendInt64(b, 9, int64(m.ActiveConnections))
+	b = appendInt64(b, 10, int64(m.ConcurrentConnLimit))
+	b = appendString(b, 11, m.Period)
+	b = appendTimestamp(b, 12, m.PeriodStart)
+	b = appendTimestamp(b, 13, m.PeriodEnd)
+	b = appendBool(b, 14, m.QuotaExceeded)
+	b = appendString(b, 15, m.QuotaExceededReason)
+	return b
+}
+
+// ProtoName returns the fully qualified message name
+func (m *QuotaStatus) ProtoName() string { return "portal.admin.v1.QuotaStatus" }
+
+// DLQList is the response of GET /admin/dlq
+type DLQList struct {
+	Entries []*webhook.DLQEntry
+	Total   int
+	Limit   int
+	Offset  int
+}
+
+// Marshal returns the message in protobuf wire format
+func (m *DLQList) Marshal() []byte {
+	var b []byte
+	for _, entry := range m.Entries {
+		b = appendMessage(b, 1, appendDLQEntry(nil, entry))
+	}
+	b = appendInt64(b, 2, int64(m.Total))
+	b = appendInt64(b, 3, int64(m.Limit))
+	b = appendInt64(b, 4, int64(m.Offset))
+	return b
+}
+
+// ProtoName returns the fully qualified message name
+func (m *DLQList) ProtoName() string { return "portal.admin.v1.DLQList" }
+
+// appendDLQEntry encodes a DLQ entry as portal.admin.v1.DLQEntry
+func appendDLQEntry(b []byte, entry *webhook.DLQEntry) []byte {
+	b = appendInt64(b, 1, entry.ID)
+	b = appendString(b, 2, entry.Method)
+	b = appendString(b, 3, entry.URL)
+
+	// Header names are sorted so the encoding is deterministic
+	names := make([]string, 0, len(entry.Headers))
+	for name := range entry.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var header []byte
+		header = appendString(header, 1, name)
+		header = appendStrings(header, 2, entry.Headers[name])
+		b = appendMessage(b, 4, header)
+	}
+
+	b = appendBytes(b, 5, entry.Body)
+	b = appendInt64(b, 6, int64(entry.StatusCode))
+	b = appendInt64(b, 7, int64(entry.Retries))
+	b = appendString(b, 8, entry.LastError)
+	b = appendTimestamp(b, 9, entry.CreatedAt)
+	b = appendTimestamp(b, 10, entry.LastAttempt)
+	b = appendString(b, 11, entry.LeaseID)
+	b = appendString(b, 12, entry.KeyID)
+	b = appendInt64(b, 13, int64(entry.Replays))
+	b = appendBool(b, 14, entry.PermanentlyFailed)
+	return b
+}
+
+// Scalar fields holding their zero value are omitted, as proto3 requires
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendStrings(b []byte, num protowire.Number, values []string) []byte {
+	// Repeated elements are kept even when empty, so positions are preserved
+	for _, s := range values {
+		b = protowire.AppendTag(b, num, protowire.BytesType)
+		b = protowire.AppendString(b, s)
+	}
+	return b
+}
+
+func appendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, protowire.EncodeBool(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// appendStringMap encodes a map<string, string> as sorted key/value entries
+func appendStringMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		// Map entries always carry both fields
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, key)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, m[key])
+		b = appendMessage(b, num, entry)
+	}
+	return b
+}
+
+// appendTimestamp encodes t as a google.protobuf.Timestamp, omitting the zero time
+func appendTimestamp(b []byte, num protowire.Number, t time.Time) []byte {
+	if t.IsZero() {
+		return b
+	}
+
+	var ts []byte
+	ts = appendInt64(ts, 1, t.Unix())
+	ts = appendInt64(ts, 2, int64(t.Nanosecond()))
+	return appendMessage(b, num, ts)
+}
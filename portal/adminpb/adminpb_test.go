@@ -0,0 +1,209 @@
+package adminpb
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/portal-project/portal-gateway/portal/quota"
+	"github.com/portal-project/portal-gateway/portal/webhook"
+)
+
+// decodeFields splits an encoded message into the raw values of each field number
+// Varints are returned as their encoded bytes, so use protowire.ConsumeVarint on them
+func decodeFields(t *testing.T, b []byte) map[protowire.Number][][]byte {
+	t.Helper()
+
+	fields := make(map[protowire.Number][][]byte)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("Invalid tag: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+
+		var value []byte
+		switch typ {
+		case protowire.VarintType:
+			_, m := protowire.ConsumeVarint(b)
+			if m < 0 {
+				t.Fatalf("Invalid varint: %v", protowire.ParseError(m))
+			}
+			value, n = b[:m], m
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(b)
+			if n < 0 {
+				t.Fatalf("Invalid bytes: %v", protowire.ParseError(n))
+			}
+		default:
+			t.Fatalf("Unexpected wire type %v for field %d", typ, num)
+		}
+
+		fields[num] = append(fields[num], value)
+		b = b[n:]
+	}
+	return fields
+}
+
+func varint(t *testing.T, b []byte) uint64 {
+	t.Helper()
+
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		t.Fatalf("Invalid varint: %v", protowire.ParseError(n))
+	}
+	return v
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{"application/json", ContentTypeJSON},
+		{"text/html", ContentTypeJSON},
+		{"application/x-protobuf", ContentTypeProtobuf},
+		{"application/json;q=0.5, application/x-protobuf", ContentTypeProtobuf},
+		{"application/x-protobuf;q=0.5, application/json", ContentTypeJSON},
+	}
+
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept); got != tt.expected {
+			t.Errorf("Negotiate(%q) = %s, expected %s", tt.accept, got, tt.expected)
+		}
+	}
+}
+
+func TestQuotaStatusMarshal(t *testing.T) {
+	periodStart := time.Date(2025, 3, 1, 0, 0, 0, 500, time.UTC)
+	status := NewQuotaStatus(&quota.QuotaStatus{
+		KeyID:         "key-1",
+		RequestCount:  42,
+		RequestLimit:  1000,
+		Period:        "monthly",
+		PeriodStart:   periodStart,
+		QuotaExceeded: true,
+	})
+
+	if ContentType(status) != "application/x-protobuf; proto=portal.admin.v1.QuotaStatus" {
+		t.Errorf("Unexpected content type %s", ContentType(status))
+	}
+
+	fields := decodeFields(t, status.Marshal())
+
+	if got := string(fields[1][0]); got != "key-1" {
+		t.Errorf("Expected key_id key-1, got %s", got)
+	}
+	if got := varint(t, fields[2][0]); got != 42 {
+		t.Errorf("Expected request_count 42, got %d", got)
+	}
+	if got := varint(t, fields[14][0]); got != 1 {
+		t.Errorf("Expected quota_exceeded, got %d", got)
+	}
+
+	// Zero values are omitted
+	if _, ok := fields[6]; ok {
+		t.Error("Expected bytes_transferred to be omitted")
+	}
+	if _, ok := fields[13]; ok {
+		t.Error("Expected unset period_end to be omitted")
+	}
+
+	// Timestamps decode as the well-known type
+	ts := &timestamppb.Timestamp{}
+	if err := proto.Unmarshal(fields[12][0], ts); err != nil {
+		t.Fatalf("Failed to decode period_start: %v", err)
+	}
+	if !ts.AsTime().Equal(periodStart) {
+		t.Errorf("Expected period_start %v, got %v", periodStart, ts.AsTime())
+	}
+}
+
+func TestDLQListMarshal(t *testing.T) {
+	list := &DLQList{
+		Entries: []*webhook.DLQEntry{
+			{
+				ID:         7,
+				Method:     http.MethodPost,
+				URL:        "https://hooks.example.com/a",
+				Headers:    http.Header{"X-B": {"2"}, "X-A": {"1", "one"}},
+				Body:       []byte(`{"event":"x"}`),
+				StatusCode: 503,
+				LeaseID:    "lease-1",
+			},
+			{ID: 8},
+		},
+		Total: 2,
+		Limit: 100,
+	}
+
+	fields := decodeFields(t, list.Marshal())
+
+	if len(fields[1]) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(fields[1]))
+	}
+	if got := varint(t, fields[2][0]); got != 2 {
+		t.Errorf("Expected total 2, got %d", got)
+	}
+	if _, ok := fields[4]; ok {
+		t.Error("Expected zero offset to be omitted")
+	}
+
+	entry := decodeFields(t, fields[1][0])
+	if got := varint(t, entry[1][0]); got != 7 {
+		t.Errorf("Expected id 7, got %d", got)
+	}
+	if got := string(entry[5][0]); got != `{"event":"x"}` {
+		t.Errorf("Expected raw body, got %s", got)
+	}
+	if got := string(entry[11][0]); got != "lease-1" {
+		t.Errorf("Expected lease_id lease-1, got %s", got)
+	}
+
+	// Headers are sorted by name and keep every value
+	if len(entry[4]) != 2 {
+		t.Fatalf("Expected 2 headers, got %d", len(entry[4]))
+	}
+	header := decodeFields(t, entry[4][0])
+	if string(header[1][0]) != "X-A" || len(header[2]) != 2 || string(header[2][1]) != "one" {
+		t.Errorf("Expected X-A with both values first, got %q", header)
+	}
+}
+
+func TestACLRuleListMarshal(t *testing.T) {
+	list := &ACLRuleList{
+		Rules: []*ACLRule{{
+			LeaseID:            "lease-1",
+			AllowedKeyIDs:      []string{"key1", "key2"},
+			AllowedTimeWindows: []*TimeWindow{{Days: []string{"mon"}, Start: "09:00", End: "17:00"}},
+			ResponseHeaders:    map[string]string{"X-Z": "z", "X-Lease": "{lease_id}"},
+		}},
+	}
+
+	fields := decodeFields(t, list.Marshal())
+	rule := decodeFields(t, fields[1][0])
+
+	if len(rule[2]) != 2 || string(rule[2][1]) != "key2" {
+		t.Errorf("Expected both key IDs in order, got %q", rule[2])
+	}
+
+	window := decodeFields(t, rule[5][0])
+	if string(window[2][0]) != "09:00" || string(window[3][0]) != "17:00" {
+		t.Errorf("Unexpected time window %q", window)
+	}
+
+	// Map entries are sorted by key
+	if len(rule[7]) != 2 {
+		t.Fatalf("Expected 2 response headers, got %d", len(rule[7]))
+	}
+	entry := decodeFields(t, rule[7][0])
+	if string(entry[1][0]) != "X-Lease" || string(entry[2][0]) != "{lease_id}" {
+		t.Errorf("Expected X-Lease entry first, got %q", entry)
+	}
+}
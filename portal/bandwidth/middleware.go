@@ -0,0 +1,368 @@
+// Package bandwidth caps how fast a lease's responses are sent and its request bodies are read,
+// so tenants on throughput-limited plans cannot saturate shared egress
+// It limits instantaneous throughput; quota.Manager caps the bytes transferred per period
+package bandwidth
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// Directions a limit applies to, used as metric labels
+const (
+	DirectionResponse = "response"
+	DirectionRequest  = "request"
+)
+
+// maxChunk is the most bytes sent or read at once, so a large write is spread out evenly
+// instead of being held back and then sent in one burst
+const maxChunk = 32 << 10 // 32 KB
+
+// Metrics holds bandwidth throttling metrics
+type Metrics struct {
+	ThrottledSecondsTotal *prometheus.CounterVec
+	BytesTotal            *prometheus.CounterVec
+}
+
+// NewMetrics creates new bandwidth throttling metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new bandwidth throttling metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		ThrottledSecondsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_bandwidth_throttled_seconds_total",
+				Help: "Total time transfers of bandwidth-limited leases were held back to stay under their limit",
+			},
+			[]string{"lease_id", "direction"},
+		),
+		BytesTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_bandwidth_limited_bytes_total",
+				Help: "Total bytes transferred by bandwidth-limited leases",
+			},
+			[]string{"lease_id", "direction"},
+		),
+	}
+}
+
+// Limit caps a lease's transfer speed
+type Limit struct {
+	LeaseID string // Lease ID (supports wildcards like "free-*")
+
+	// ResponseBytesPerSecond caps response bodies sent to clients (0 = unlimited)
+	ResponseBytesPerSecond int64
+
+	// RequestBytesPerSecond caps request bodies read from clients (0 = unlimited)
+	RequestBytesPerSecond int64
+
+	// BurstBytes may be transferred at full speed before throttling starts
+	// (0 = one second at the limit)
+	BurstBytes int64
+}
+
+// Common errors
+var (
+	ErrInvalidLimit  = errors.New("invalid bandwidth limit")
+	ErrLimitNotFound = errors.New("bandwidth limit not found")
+)
+
+// MiddlewareConfig holds bandwidth throttling configuration
+type MiddlewareConfig struct {
+	// Limits maps lease IDs to their bandwidth limit
+	Limits middleware.LeaseRules[*Limit]
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+
+	// Clock paces transfers (nil = clock.Real); tests set a clock.Fake
+	Clock clock.Clock
+}
+
+// DefaultMiddlewareConfig returns default bandwidth configuration with no limits
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{}
+}
+
+// AddLimit validates a bandwidth limit and sets it for its lease
+func (c *MiddlewareConfig) AddLimit(limit *Limit) error {
+	if limit == nil {
+		return errors.New("bandwidth limit cannot be nil")
+	}
+
+	if limit.LeaseID == "" {
+		return errors.New("lease ID cannot be empty")
+	}
+
+	if limit.ResponseBytesPerSecond < 0 || limit.RequestBytesPerSecond < 0 || limit.BurstBytes < 0 {
+		return fmt.Errorf("%w: rates and burst cannot be negative", ErrInvalidLimit)
+	}
+
+	if limit.ResponseBytesPerSecond == 0 && limit.RequestBytesPerSecond == 0 {
+		return fmt.Errorf("%w: set response_bytes_per_second, request_bytes_per_second or both", ErrInvalidLimit)
+	}
+
+	c.Limits.Set(limit.LeaseID, limit)
+	return nil
+}
+
+// RemoveLimit removes the bandwidth limit for a lease
+func (c *MiddlewareConfig) RemoveLimit(leaseID string) error {
+	if !c.Limits.Delete(leaseID) {
+		return fmt.Errorf("%w: %s", ErrLimitNotFound, leaseID)
+	}
+	return nil
+}
+
+// GetLimit returns the bandwidth limit for a lease, or nil if it is unlimited
+func (c *MiddlewareConfig) GetLimit(leaseID string) *Limit {
+	limit, _ := c.Limits.Match(leaseID)
+	return limit
+}
+
+// bucket is a token bucket over bytes shared by all of a lease's transfers in one direction
+// Tokens may go negative: a transfer takes what it needs and waits out the debt, so
+// concurrent transfers are served in the order they asked
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate, burst int64, now time.Time) *bucket {
+	return &bucket{
+		rate:   float64(rate),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// reserve takes n bytes from the bucket and returns how long to wait before transferring them
+func (b *bucket) reserve(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+		b.last = now
+	}
+
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// Middleware throttles the transfers of bandwidth-limited leases
+type Middleware struct {
+	config *MiddlewareConfig
+
+	mu      sync.Mutex
+	buckets map[string]*bucket // lease ID + direction -> bucket
+}
+
+// NewMiddleware creates a new bandwidth throttling middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	return &Middleware{
+		config:  config,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// getBucket returns the bucket for a lease and direction, creating it at rate on first use
+// A lease matched by a wildcard gets buckets of its own, not shared with the pattern's other leases
+func (m *Middleware) getBucket(leaseID, direction string, rate, burst int64) *bucket {
+	key := leaseID + "\x00" + direction
+	if burst <= 0 {
+		burst = rate
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, exists := m.buckets[key]
+	if !exists || b.rate != float64(rate) || b.burst != float64(burst) {
+		// A changed limit takes effect with a fresh bucket
+		b = newBucket(rate, burst, clock.Or(m.config.Clock).Now())
+		m.buckets[key] = b
+	}
+	return b
+}
+
+// Middleware returns an http.Handler that paces the response and request body of leases with
+// a bandwidth limit; other leases pass through untouched
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := middleware.GetLeaseID(r.Context())
+		if leaseID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit := m.config.GetLimit(leaseID)
+		if limit == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if limit.RequestBytesPerSecond > 0 && r.Body != nil && r.Body != http.NoBody {
+			r.Body = &throttledBody{
+				ReadCloser: r.Body,
+				pacer:      m.newPacer(r.Context(), leaseID, DirectionRequest, limit.RequestBytesPerSecond, limit.BurstBytes),
+			}
+		}
+
+		if limit.ResponseBytesPerSecond > 0 {
+			w = &throttledWriter{
+				ResponseWriter: w,
+				pacer:          m.newPacer(r.Context(), leaseID, DirectionResponse, limit.ResponseBytesPerSecond, limit.BurstBytes),
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// newPacer returns a pacer for one transfer of a lease
+func (m *Middleware) newPacer(ctx context.Context, leaseID, direction string, rate, burst int64) *pacer {
+	return &pacer{
+		ctx:       ctx,
+		bucket:    m.getBucket(leaseID, direction, rate, burst),
+		clock:     clock.Or(m.config.Clock),
+		throttled: m.config.Metrics.ThrottledSecondsTotal.WithLabelValues(leaseID, direction),
+		bytes:     m.config.Metrics.BytesTotal.WithLabelValues(leaseID, direction),
+	}
+}
+
+// pacer holds back one transfer to its lease's rate
+type pacer struct {
+	ctx       context.Context
+	bucket    *bucket
+	clock     clock.Clock
+	throttled prometheus.Counter
+	bytes     prometheus.Counter
+}
+
+// wait blocks until n bytes may be transferred, or returns the context's error if the client
+// goes away first
+func (p *pacer) wait(n int) error {
+	p.bytes.Add(float64(n))
+
+	delay := p.bucket.reserve(n, p.clock.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	p.throttled.Add(delay.Seconds())
+	select {
+	case <-p.clock.After(delay):
+		return nil
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// chunkSize returns how many bytes to transfer at once: at most maxChunk, and never more than
+// the burst so a chunk never waits for more than the bucket can hold
+func (p *pacer) chunkSize(n int) int {
+	return min(n, maxChunk, max(int(p.bucket.burst), 1))
+}
+
+// throttledWriter paces a response body
+type throttledWriter struct {
+	http.ResponseWriter
+	pacer *pacer
+}
+
+func (w *throttledWriter) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		chunk := b[written : written+w.pacer.chunkSize(len(b)-written)]
+		if err := w.pacer.wait(len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := w.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Flush implements http.Flusher so streaming responses still flush
+func (w *throttledWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it
+// A hijacked connection is no longer throttled
+func (w *throttledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// throttledBody paces a request body as the handler reads it
+type throttledBody struct {
+	io.ReadCloser
+	pacer *pacer
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return b.ReadCloser.Read(p)
+	}
+
+	n, err := b.ReadCloser.Read(p[:b.pacer.chunkSize(len(p))])
+	if n > 0 {
+		if waitErr := b.pacer.wait(n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,168 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+
+	var metric dto.Metric
+	if err := counter.Write(&metric); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+// newTestMiddleware creates a middleware with one limit on a fake clock
+func newTestMiddleware(t *testing.T, limit *Limit) (*Middleware, *clock.Fake) {
+	t.Helper()
+
+	config := DefaultMiddlewareConfig()
+	config.Metrics = NewMetricsWithRegistry(prometheus.NewRegistry())
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	config.Clock = fake
+	if err := config.AddLimit(limit); err != nil {
+		t.Fatalf("Failed to add limit: %v", err)
+	}
+	return NewMiddleware(config), fake
+}
+
+func TestMiddlewareThrottlesResponse(t *testing.T) {
+	m, fake := newTestMiddleware(t, &Limit{LeaseID: "lease-*", ResponseBytesPerSecond: 1000})
+
+	body := bytes.Repeat([]byte("a"), 3000)
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+
+	rr := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1/file", nil))
+		close(done)
+	}()
+
+	// The first second's worth is the burst; each further 1000 bytes waits a second
+	for i := 0; i < 2; i++ {
+		fake.BlockUntil(1)
+		fake.Advance(time.Second)
+	}
+	<-done
+
+	if !bytes.Equal(rr.Body.Bytes(), body) {
+		t.Errorf("Expected the whole body, got %d bytes", rr.Body.Len())
+	}
+	if got := counterValue(t, m.config.Metrics.ThrottledSecondsTotal.WithLabelValues("lease-1", DirectionResponse)); got != 2 {
+		t.Errorf("Expected 2 throttled seconds, got %v", got)
+	}
+	if got := counterValue(t, m.config.Metrics.BytesTotal.WithLabelValues("lease-1", DirectionResponse)); got != 3000 {
+		t.Errorf("Expected 3000 limited bytes, got %v", got)
+	}
+}
+
+func TestMiddlewareThrottlesRequestBody(t *testing.T) {
+	m, fake := newTestMiddleware(t, &Limit{LeaseID: "lease-1", RequestBytesPerSecond: 1000})
+
+	var received []byte
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "POST", "/peer/lease-1/upload", bytes.NewReader(make([]byte, 2000))))
+		close(done)
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+	<-done
+
+	if len(received) != 2000 {
+		t.Errorf("Expected the whole body to be read, got %d bytes", len(received))
+	}
+}
+
+func TestMiddlewareClientGoesAway(t *testing.T) {
+	m, fake := newTestMiddleware(t, &Limit{LeaseID: "lease-1", ResponseBytesPerSecond: 100, BurstBytes: 100})
+
+	var writeErr error
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, writeErr = w.Write(make([]byte, 1000))
+	}))
+
+	ctx, cancel := context.WithCancel(middleware.WithLeaseID(context.Background(), "lease-1"))
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(ctx, "GET", "/peer/lease-1/file", nil))
+		close(done)
+	}()
+
+	fake.BlockUntil(1)
+	cancel()
+	<-done
+
+	if !errors.Is(writeErr, context.Canceled) {
+		t.Errorf("Expected the write to stop when the client went away, got %v", writeErr)
+	}
+}
+
+func TestMiddlewareUnlimitedLease(t *testing.T) {
+	m, fake := newTestMiddleware(t, &Limit{LeaseID: "lease-slow", ResponseBytesPerSecond: 1})
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1<<20))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-fast"), "GET", "/peer/lease-fast/file", nil))
+
+	if rr.Body.Len() != 1<<20 || fake.Waiters() != 0 {
+		t.Errorf("Expected a lease without a limit to pass through, got %d bytes", rr.Body.Len())
+	}
+}
+
+func TestAddLimitValidation(t *testing.T) {
+	config := DefaultMiddlewareConfig()
+
+	invalid := []*Limit{
+		{LeaseID: "lease-1"},
+		{LeaseID: "lease-1", ResponseBytesPerSecond: -1},
+		{LeaseID: "lease-1", ResponseBytesPerSecond: 1000, BurstBytes: -1},
+	}
+	for _, limit := range invalid {
+		if err := config.AddLimit(limit); !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("Expected ErrInvalidLimit for %+v, got %v", limit, err)
+		}
+	}
+
+	if config.AddLimit(&Limit{ResponseBytesPerSecond: 1000}) == nil {
+		t.Error("Expected an empty lease ID to be rejected")
+	}
+
+	if err := config.AddLimit(&Limit{LeaseID: "free-*", ResponseBytesPerSecond: 1000}); err != nil {
+		t.Fatalf("Failed to add limit: %v", err)
+	}
+	if err := config.AddLimit(&Limit{LeaseID: "free-video-*", ResponseBytesPerSecond: 5000}); err != nil {
+		t.Fatalf("Failed to add limit: %v", err)
+	}
+	if limit := config.GetLimit("free-video-1"); limit == nil || limit.ResponseBytesPerSecond != 5000 {
+		t.Errorf("Expected the longest wildcard to win, got %+v", limit)
+	}
+	if !errors.Is(config.RemoveLimit("other"), ErrLimitNotFound) {
+		t.Error("Expected removing a missing limit to fail")
+	}
+}
@@ -0,0 +1,361 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// Session is an active payload capture for one lease
+type Session struct {
+	LeaseID      string    // Exact lease ID (wildcards are not allowed, captures stay targeted)
+	SampleRate   float64   // Fraction of requests captured, in (0, 1]
+	MaxBodyBytes int       // Body bytes kept per request and response; the rest is truncated
+	ExpiresAt    time.Time // Capture stops on its own after this time
+	Captured     int64     // Requests captured so far
+}
+
+// MiddlewareConfig holds payload capture configuration and the active sessions
+type MiddlewareConfig struct {
+	// DefaultSampleRate is used when a session does not set one
+	DefaultSampleRate float64
+
+	// DefaultDuration is used when a session does not set one
+	DefaultDuration time.Duration
+
+	// MaxDuration caps how long a session may run, so capture cannot be left on
+	MaxDuration time.Duration
+
+	// DefaultMaxBodyBytes is used when a session does not set one
+	DefaultMaxBodyBytes int
+
+	// MaxBodyBytesLimit caps the body bytes a session may keep
+	MaxBodyBytesLimit int
+
+	sessions map[string]*Session
+	mu       sync.Mutex
+	now      func() time.Time
+	sample   func() float64
+}
+
+// Common errors
+var (
+	ErrInvalidSession  = errors.New("invalid capture session")
+	ErrSessionNotFound = errors.New("capture session not found")
+)
+
+// DefaultMiddlewareConfig returns default capture configuration with no active sessions
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{
+		DefaultSampleRate:   0.1,
+		DefaultDuration:     15 * time.Minute,
+		MaxDuration:         time.Hour,
+		DefaultMaxBodyBytes: 4 << 10,  // 4 KB
+		MaxBodyBytesLimit:   64 << 10, // 64 KB
+		sessions:            make(map[string]*Session),
+		now:                 time.Now,
+		sample:              rand.Float64,
+	}
+}
+
+// Start starts or replaces the capture session for a lease
+// Zero values take the configured defaults; a duration above MaxDuration is an error
+func (c *MiddlewareConfig) Start(leaseID string, sampleRate float64, duration time.Duration, maxBodyBytes int) (*Session, error) {
+	if leaseID == "" || strings.Contains(leaseID, "*") {
+		return nil, fmt.Errorf("%w: an exact lease ID is required", ErrInvalidSession)
+	}
+
+	if sampleRate == 0 {
+		sampleRate = c.DefaultSampleRate
+	}
+	if sampleRate <= 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("%w: sample rate must be in (0, 1]", ErrInvalidSession)
+	}
+
+	if duration == 0 {
+		duration = c.DefaultDuration
+	}
+	if duration <= 0 || duration > c.MaxDuration {
+		return nil, fmt.Errorf("%w: duration must be positive and at most %v", ErrInvalidSession, c.MaxDuration)
+	}
+
+	if maxBodyBytes == 0 {
+		maxBodyBytes = c.DefaultMaxBodyBytes
+	}
+	if maxBodyBytes < 0 || maxBodyBytes > c.MaxBodyBytesLimit {
+		return nil, fmt.Errorf("%w: max body bytes must be between 0 and %d", ErrInvalidSession, c.MaxBodyBytesLimit)
+	}
+
+	session := &Session{
+		LeaseID:      leaseID,
+		SampleRate:   sampleRate,
+		MaxBodyBytes: maxBodyBytes,
+		ExpiresAt:    c.clock().Add(duration),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.sessions == nil {
+		c.sessions = make(map[string]*Session)
+	}
+	c.sessions[leaseID] = session
+
+	copied := *session
+	return &copied, nil
+}
+
+// Stop ends the capture session for a lease
+func (c *MiddlewareConfig) Stop(leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.sessions[leaseID]; !exists {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, leaseID)
+	}
+
+	delete(c.sessions, leaseID)
+	return nil
+}
+
+// GetSession returns a copy of the active session for a lease, or nil if there is none
+func (c *MiddlewareConfig) GetSession(leaseID string) *Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	session := c.activeSession(leaseID)
+	if session == nil {
+		return nil
+	}
+
+	copied := *session
+	return &copied
+}
+
+// ListSessions returns copies of all active sessions, ordered by lease ID
+func (c *MiddlewareConfig) ListSessions() []*Session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sessions := make([]*Session, 0, len(c.sessions))
+	for leaseID := range c.sessions {
+		if session := c.activeSession(leaseID); session != nil {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LeaseID < sessions[j].LeaseID })
+	return sessions
+}
+
+// activeSession returns the session for a lease, dropping it if it has expired; callers hold c.mu
+func (c *MiddlewareConfig) activeSession(leaseID string) *Session {
+	session, exists := c.sessions[leaseID]
+	if !exists {
+		return nil
+	}
+
+	if !c.clock().Before(session.ExpiresAt) {
+		delete(c.sessions, leaseID)
+		logging.Info("Payload capture expired",
+			"event", "payload_capture_expired",
+			"lease_id", leaseID,
+			"captured", session.Captured,
+		)
+		return nil
+	}
+
+	return session
+}
+
+// sampled reports whether this request for the lease should be captured, and with what body cap
+func (c *MiddlewareConfig) sampled(leaseID string) (maxBodyBytes int, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.sessions) == 0 {
+		return 0, false
+	}
+
+	session := c.activeSession(leaseID)
+	if session == nil || c.random() >= session.SampleRate {
+		return 0, false
+	}
+
+	session.Captured++
+	return session.MaxBodyBytes, true
+}
+
+// clock returns the current time
+func (c *MiddlewareConfig) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// random returns a sample in [0, 1)
+func (c *MiddlewareConfig) random() float64 {
+	if c.sample == nil {
+		return rand.Float64()
+	}
+	return c.sample()
+}
+
+// Middleware logs sampled request and response payloads for leases with a capture session
+type Middleware struct {
+	config *MiddlewareConfig
+}
+
+// NewMiddleware creates a new payload capture middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	return &Middleware{config: config}
+}
+
+// Middleware returns an http.Handler that captures sampled payloads for leases being debugged
+// Requests for other leases pass straight through
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := middleware.GetLeaseID(r.Context())
+		maxBodyBytes, ok := m.config.sampled(leaseID)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Headers are masked by the same redactor as request logs, so LOG_REDACT_HEADERS applies here too
+		redactor := logging.Default().Redactor()
+		requestHeader := redactor.Header(r.Header)
+		requestBody := bodyBuffer{limit: maxBodyBytes}
+		if r.Body != nil && r.Body != http.NoBody {
+			// Read the capped prefix up front so it is captured even if the handler never reads the body,
+			// then hand the handler the prefix followed by the rest of the stream
+			prefix, err := io.ReadAll(io.LimitReader(r.Body, int64(maxBodyBytes)+1))
+			requestBody.write(prefix)
+			r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(prefix), &errReader{err: err}, r.Body), Closer: r.Body}
+		}
+
+		recorder := &captureWriter{ResponseWriter: w, statusCode: http.StatusOK, body: bodyBuffer{limit: maxBodyBytes}}
+		start := time.Now()
+		next.ServeHTTP(recorder, r)
+
+		var keyID string
+		if apiKeyInfo := middleware.GetAPIKeyInfo(r.Context()); apiKeyInfo != nil {
+			keyID = apiKeyInfo.KeyID
+		}
+
+		logging.Default().WithContext(r.Context()).Info("Captured request payload",
+			"event", "payload_capture",
+			"lease_id", leaseID,
+			"key_id", keyID,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", recorder.statusCode,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"request_headers", requestHeader,
+			"request_body", requestBody.String(),
+			"request_body_truncated", requestBody.truncated,
+			"response_headers", redactor.Header(recorder.Header()),
+			"response_body", recorder.body.String(),
+			"response_body_truncated", recorder.body.truncated,
+		)
+	})
+}
+
+// bodyBuffer keeps the first limit bytes written to it
+type bodyBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *bodyBuffer) write(p []byte) {
+	if room := b.limit - b.buf.Len(); len(p) > room {
+		p = p[:max(room, 0)]
+		b.truncated = true
+	}
+	b.buf.Write(p)
+}
+
+func (b *bodyBuffer) String() string {
+	return b.buf.String()
+}
+
+// replayBody serves the already-read prefix of a request body followed by the rest of it
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// errReader returns err once the prefix is consumed, so a failed read still reaches the handler
+type errReader struct {
+	err error
+}
+
+func (e *errReader) Read(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	return 0, io.EOF
+}
+
+// captureWriter records the response status and the start of the response body
+type captureWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bodyBuffer
+}
+
+func (rw *captureWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *captureWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	n, err := rw.ResponseWriter.Write(b)
+	rw.body.write(b[:n])
+	return n, err
+}
+
+// Flush implements http.Flusher so streaming responses still flush
+func (rw *captureWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it
+func (rw *captureWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (rw *captureWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
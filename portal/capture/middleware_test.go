@@ -0,0 +1,241 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := logging.Default()
+	logging.SetDefault(logging.NewLogger(&logging.Config{
+		Level:  logging.Default().GetLevel(),
+		Format: logging.FormatJSON,
+		Output: &buf,
+		// As if set with LOG_REDACT_HEADERS
+		Redactor: logging.NewRedactor(append(logging.DefaultRedactHeaders, "X-Webhook-Secret"), logging.DefaultRedactQueryParams),
+	}))
+	t.Cleanup(func() { logging.SetDefault(previous) })
+	return &buf
+}
+
+// capturedEntries returns the payload capture log entries
+func capturedEntries(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var entries []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		if entry["event"] == "payload_capture" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// TestCaptureLogsRedactedPayload tests that a sampled request is logged with redacted headers and capped bodies
+func TestCaptureLogsRedactedPayload(t *testing.T) {
+	logs := captureLogs(t)
+
+	config := DefaultMiddlewareConfig()
+	if _, err := config.Start("lease-1", 1, time.Minute, 8); err != nil {
+		t.Fatalf("Failed to start capture: %v", err)
+	}
+
+	handler := NewMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("response-body"))
+	}))
+
+	ctx := context.WithValue(middleware.WithLeaseID(context.Background(), "lease-1"), middleware.ContextKeyAPIKey, &middleware.APIKeyInfo{KeyID: "key1"})
+	req := httptest.NewRequestWithContext(ctx, "POST", "/peer/lease-1/items", strings.NewReader("short"))
+	req.Header.Set("Authorization", "Bearer sk_live_secret")
+	req.Header.Set("X-Webhook-Secret", "hunter2")
+	req.Header.Set("Content-Type", "text/plain")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated || rr.Body.String() != "response-body" {
+		t.Errorf("Expected response to be untouched, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	// Another lease is never captured
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-2"), "GET", "/peer/lease-2", nil))
+
+	entries := capturedEntries(t, logs)
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 captured request, got %d", len(entries))
+	}
+	entry := entries[0]
+
+	if entry["lease_id"] != "lease-1" || entry["key_id"] != "key1" || entry["status"] != float64(http.StatusCreated) {
+		t.Errorf("Unexpected capture metadata %v", entry)
+	}
+	if entry["request_body"] != "short" || entry["request_body_truncated"] != false {
+		t.Errorf("Expected full request body, got %v (truncated %v)", entry["request_body"], entry["request_body_truncated"])
+	}
+	if entry["response_body"] != "response" || entry["response_body_truncated"] != true {
+		t.Errorf("Expected truncated response body, got %v (truncated %v)", entry["response_body"], entry["response_body_truncated"])
+	}
+
+	if strings.Contains(logs.String(), "sk_live_secret") || strings.Contains(logs.String(), "hunter2") || strings.Contains(logs.String(), "session=abc") {
+		t.Errorf("Expected credentials to be redacted, got %s", logs.String())
+	}
+	requestHeaders := entry["request_headers"].(map[string]any)
+	if got := requestHeaders["Authorization"].([]any)[0]; got != logging.RedactedValue {
+		t.Errorf("Expected Authorization to be masked with %q, got %v", logging.RedactedValue, got)
+	}
+	if got := requestHeaders["Content-Type"].([]any)[0]; got != "text/plain" {
+		t.Errorf("Expected Content-Type to be kept, got %v", got)
+	}
+
+	if session := config.GetSession("lease-1"); session == nil || session.Captured != 1 {
+		t.Errorf("Expected 1 capture counted on the session, got %+v", session)
+	}
+}
+
+// TestCaptureSampling tests that only the sampled fraction of requests is captured
+func TestCaptureSampling(t *testing.T) {
+	logs := captureLogs(t)
+
+	config := DefaultMiddlewareConfig()
+	samples := []float64{0.05, 0.5, 0.24, 0.9}
+	config.sample = func() float64 {
+		s := samples[0]
+		samples = samples[1:]
+		return s
+	}
+	if _, err := config.Start("lease-1", 0.25, time.Minute, 0); err != nil {
+		t.Fatalf("Failed to start capture: %v", err)
+	}
+
+	handler := NewMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 4; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1", nil))
+	}
+
+	if got := len(capturedEntries(t, logs)); got != 2 {
+		t.Errorf("Expected 2 of 4 requests captured, got %d", got)
+	}
+}
+
+// TestCaptureExpires tests that a session stops capturing on its own once it expires
+func TestCaptureExpires(t *testing.T) {
+	logs := captureLogs(t)
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	config := DefaultMiddlewareConfig()
+	config.now = func() time.Time { return now }
+	if _, err := config.Start("lease-1", 1, 10*time.Minute, 0); err != nil {
+		t.Fatalf("Failed to start capture: %v", err)
+	}
+
+	now = now.Add(10 * time.Minute)
+
+	handler := NewMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1", nil))
+
+	if got := len(capturedEntries(t, logs)); got != 0 {
+		t.Errorf("Expected no capture after expiry, got %d", got)
+	}
+	if sessions := config.ListSessions(); len(sessions) != 0 {
+		t.Errorf("Expected expired session to be dropped, got %v", sessions)
+	}
+	if err := config.Stop("lease-1"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+}
+
+// TestStartValidation tests that sessions must be targeted and bounded
+func TestStartValidation(t *testing.T) {
+	config := DefaultMiddlewareConfig()
+
+	tests := []struct {
+		name         string
+		leaseID      string
+		sampleRate   float64
+		duration     time.Duration
+		maxBodyBytes int
+	}{
+		{"empty lease", "", 0, 0, 0},
+		{"wildcard lease", "lease-*", 0, 0, 0},
+		{"sample rate above 1", "lease-1", 1.5, 0, 0},
+		{"negative sample rate", "lease-1", -0.1, 0, 0},
+		{"duration above max", "lease-1", 0, 2 * time.Hour, 0},
+		{"negative duration", "lease-1", 0, -time.Minute, 0},
+		{"body cap above limit", "lease-1", 0, 0, 1 << 20},
+	}
+	for _, tt := range tests {
+		if _, err := config.Start(tt.leaseID, tt.sampleRate, tt.duration, tt.maxBodyBytes); !errors.Is(err, ErrInvalidSession) {
+			t.Errorf("%s: expected ErrInvalidSession, got %v", tt.name, err)
+		}
+	}
+
+	session, err := config.Start("lease-1", 0, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to start capture with defaults: %v", err)
+	}
+	if session.SampleRate != config.DefaultSampleRate || session.MaxBodyBytes != config.DefaultMaxBodyBytes {
+		t.Errorf("Expected defaults, got %+v", session)
+	}
+	if remaining := time.Until(session.ExpiresAt); remaining <= 0 || remaining > config.DefaultDuration {
+		t.Errorf("Expected session to expire within the default duration, got %v", remaining)
+	}
+}
+
+// TestCaptureRequestBody tests that the request body is captured even if unread, and reaches the handler intact
+func TestCaptureRequestBody(t *testing.T) {
+	logs := captureLogs(t)
+
+	config := DefaultMiddlewareConfig()
+	if _, err := config.Start("lease-1", 1, time.Minute, 4); err != nil {
+		t.Fatalf("Failed to start capture: %v", err)
+	}
+
+	var received string
+	handler := NewMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/peer/lease-1/read" {
+			body, _ := io.ReadAll(r.Body)
+			received = string(body)
+		}
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "POST", "/peer/lease-1/read", strings.NewReader("full-body")))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "POST", "/peer/lease-1/ignore", strings.NewReader("unread")))
+
+	if received != "full-body" {
+		t.Errorf("Expected handler to receive the full body, got %q", received)
+	}
+
+	entries := capturedEntries(t, logs)
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 captured requests, got %d", len(entries))
+	}
+	for i, want := range []string{"full", "unre"} {
+		if entries[i]["request_body"] != want || entries[i]["request_body_truncated"] != true {
+			t.Errorf("Expected request body %q truncated, got %v (truncated %v)", want, entries[i]["request_body"], entries[i]["request_body_truncated"])
+		}
+	}
+}
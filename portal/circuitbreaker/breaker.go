@@ -2,8 +2,11 @@ package circuitbreaker
 
 import (
 	"errors"
+	"fmt"
 	"sync"
 	"time"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
 )
 
 var (
@@ -43,7 +46,8 @@ func (s State) String() string {
 type Config struct {
 	// MaxRequests is the maximum number of requests allowed in half-open state
 	MaxRequests uint32
-	// Interval is the cyclic period to clear internal counts (0 means disabled)
+	// Interval is the cyclic period to clear internal counts while closed (0 means disabled)
+	// Without it, failures spread over a long period accumulate towards a trip
 	Interval time.Duration
 	// Timeout is the period after which the breaker moves from open to half-open
 	Timeout time.Duration
@@ -52,6 +56,13 @@ type Config struct {
 	ReadyToTrip func(counts Counts) bool
 	// OnStateChange is called when the state changes
 	OnStateChange func(name string, from State, to State)
+	// HealthProbe, if set, is run once on entering half-open state instead of letting real
+	// requests through as probes; success closes the breaker and failure reopens it
+	// Requests are rejected with ErrCircuitOpen until it returns, and a probe still running
+	// after Timeout counts as failed
+	HealthProbe func() error
+	// Clock tells the breaker the time (nil = clock.Real); tests set a clock.Fake
+	Clock clock.Clock
 }
 
 // Counts holds the statistics for circuit breaker
@@ -63,6 +74,29 @@ type Counts struct {
 	ConsecutiveFailures  uint32
 }
 
+// Trip reasons
+const (
+	TripFailureThreshold  = "failure_threshold"   // Failures while closed met ReadyToTrip
+	TripHalfOpenFailure   = "half_open_failure"   // A trial request failed while half-open
+	TripHealthProbeFailed = "health_probe_failed" // The half-open health probe failed
+)
+
+// Trip describes why a breaker opened
+type Trip struct {
+	Reason   string
+	OpenedAt time.Time // When the breaker left the closed state
+	Counts   Counts    // Counts when it opened
+}
+
+// FailureRatio returns the share of requests that failed when the breaker opened
+func (t Trip) FailureRatio() float64 {
+	total := t.Counts.TotalSuccesses + t.Counts.TotalFailures
+	if total == 0 {
+		return 0
+	}
+	return float64(t.Counts.TotalFailures) / float64(total)
+}
+
 // CircuitBreaker is a state machine to prevent sending requests that are likely to fail
 type CircuitBreaker struct {
 	name          string
@@ -71,12 +105,17 @@ type CircuitBreaker struct {
 	timeout       time.Duration
 	readyToTrip   func(counts Counts) bool
 	onStateChange func(name string, from State, to State)
+	healthProbe   func() error
+	clock         clock.Clock
 
 	mutex      sync.Mutex
 	state      State
 	generation uint64
 	counts     Counts
 	expiry     time.Time
+	trip       Trip // Why the breaker last opened; zero while closed
+
+	lastRequest time.Time // When a request last reached the breaker
 }
 
 // NewCircuitBreaker creates a new circuit breaker
@@ -86,6 +125,7 @@ func NewCircuitBreaker(name string, config Config) *CircuitBreaker {
 		maxRequests: config.MaxRequests,
 		interval:    config.Interval,
 		timeout:     config.Timeout,
+		clock:       clock.Or(config.Clock),
 	}
 
 	if config.ReadyToTrip == nil {
@@ -98,7 +138,10 @@ func NewCircuitBreaker(name string, config Config) *CircuitBreaker {
 		cb.onStateChange = config.OnStateChange
 	}
 
-	cb.toNewGeneration(time.Now())
+	cb.healthProbe = config.HealthProbe
+
+	cb.lastRequest = cb.clock.Now()
+	cb.toNewGeneration(cb.lastRequest)
 
 	return cb
 }
@@ -114,7 +157,7 @@ func (cb *CircuitBreaker) State() State {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	now := time.Now()
+	now := cb.clock.Now()
 	state, _ := cb.currentState(now)
 	return state
 }
@@ -124,9 +167,41 @@ func (cb *CircuitBreaker) Counts() Counts {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	// Apply any pending interval reset before reporting
+	cb.currentState(cb.clock.Now())
 	return cb.counts
 }
 
+// Trip returns why the breaker last opened, or the zero Trip while it is closed
+func (cb *CircuitBreaker) Trip() Trip {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.currentState(cb.clock.Now())
+	return cb.trip
+}
+
+// OpenRemaining returns how long the breaker stays open before moving to half-open
+// It is 0 unless the breaker is open
+func (cb *CircuitBreaker) OpenRemaining() time.Duration {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := cb.clock.Now()
+	if state, _ := cb.currentState(now); state != StateOpen {
+		return 0
+	}
+	return cb.expiry.Sub(now)
+}
+
+// LastRequest returns when a request last reached the breaker, or when it was created
+func (cb *CircuitBreaker) LastRequest() time.Time {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.lastRequest
+}
+
 // Execute runs the given function if the circuit breaker allows it
 func (cb *CircuitBreaker) Execute(fn func() error) error {
 	generation, err := cb.beforeRequest()
@@ -152,11 +227,15 @@ func (cb *CircuitBreaker) beforeRequest() (uint64, error) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	now := time.Now()
+	now := cb.clock.Now()
 	state, generation := cb.currentState(now)
+	cb.lastRequest = now
 
 	if state == StateOpen {
 		return generation, ErrCircuitOpen
+	} else if state == StateHalfOpen && cb.healthProbe != nil {
+		// Real traffic waits for the health probe
+		return generation, ErrCircuitOpen
 	} else if state == StateHalfOpen && cb.counts.Requests >= cb.maxRequests {
 		return generation, ErrTooManyRequests
 	}
@@ -170,7 +249,7 @@ func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	now := time.Now()
+	now := cb.clock.Now()
 	state, generation := cb.currentState(now)
 	if generation != before {
 		return
@@ -208,11 +287,24 @@ func (cb *CircuitBreaker) onFailure(state State, now time.Time) {
 		cb.counts.ConsecutiveFailures++
 		cb.counts.ConsecutiveSuccesses = 0
 		if cb.readyToTrip(cb.counts) {
+			cb.trip = Trip{Reason: TripFailureThreshold, OpenedAt: now, Counts: cb.counts}
 			cb.setState(StateOpen, now)
 		}
 	case StateHalfOpen:
-		cb.setState(StateOpen, now)
+		cb.counts.TotalFailures++
+		cb.counts.ConsecutiveFailures++
+		cb.reopen(TripHalfOpenFailure, now)
+	}
+}
+
+// reopen moves a half-open breaker back to open, keeping when it first opened
+func (cb *CircuitBreaker) reopen(reason string, now time.Time) {
+	cb.trip.Reason = reason
+	cb.trip.Counts = cb.counts
+	if cb.trip.OpenedAt.IsZero() {
+		cb.trip.OpenedAt = now
 	}
+	cb.setState(StateOpen, now)
 }
 
 // currentState returns the current state and generation
@@ -238,12 +330,58 @@ func (cb *CircuitBreaker) setState(state State, now time.Time) {
 
 	prev := cb.state
 	cb.state = state
+	if state == StateClosed {
+		cb.trip = Trip{}
+	}
 
 	cb.toNewGeneration(now)
 
 	if cb.onStateChange != nil {
 		cb.onStateChange(cb.name, prev, state)
 	}
+
+	if state == StateHalfOpen && cb.healthProbe != nil {
+		go cb.runHealthProbe(cb.generation)
+	}
+}
+
+// runHealthProbe probes the upstream for a half-open generation and closes or reopens the breaker
+func (cb *CircuitBreaker) runHealthProbe(generation uint64) {
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if e := recover(); e != nil {
+				result <- fmt.Errorf("health probe panicked: %v", e)
+			}
+		}()
+		result <- cb.healthProbe()
+	}()
+
+	var err error
+	if cb.timeout > 0 {
+		select {
+		case err = <-result:
+		case <-cb.clock.After(cb.timeout):
+			err = errors.New("health probe timed out")
+		}
+	} else {
+		err = <-result
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	// A reset or another transition since the probe started makes its result stale
+	now := cb.clock.Now()
+	if state, current := cb.currentState(now); state != StateHalfOpen || current != generation {
+		return
+	}
+
+	if err == nil {
+		cb.setState(StateClosed, now)
+	} else {
+		cb.reopen(TripHealthProbeFailed, now)
+	}
 }
 
 // toNewGeneration resets the counts and sets the expiry time
@@ -271,5 +409,5 @@ func (cb *CircuitBreaker) Reset() {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	cb.setState(StateClosed, time.Now())
+	cb.setState(StateClosed, cb.clock.Now())
 }
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
 )
 
 func TestNewCircuitBreaker(t *testing.T) {
@@ -96,9 +98,11 @@ func TestCircuitBreakerTrips(t *testing.T) {
 
 func TestCircuitBreakerHalfOpen(t *testing.T) {
 	timeout := 50 * time.Millisecond
+	fake := clock.NewFake(time.Now())
 	cb := NewCircuitBreaker("test", Config{
 		MaxRequests: 2,
 		Timeout:     timeout,
+		Clock:       fake,
 		ReadyToTrip: func(counts Counts) bool {
 			return counts.ConsecutiveFailures >= 3
 		},
@@ -117,8 +121,7 @@ func TestCircuitBreakerHalfOpen(t *testing.T) {
 		t.Errorf("Expected state to be Open, got %v", cb.State())
 	}
 
-	// Wait for timeout
-	time.Sleep(timeout + 10*time.Millisecond)
+	fake.Advance(timeout + time.Millisecond)
 
 	// Should be in half-open state now
 	err := cb.Execute(func() error {
@@ -135,9 +138,11 @@ func TestCircuitBreakerHalfOpen(t *testing.T) {
 
 func TestCircuitBreakerRecovery(t *testing.T) {
 	timeout := 50 * time.Millisecond
+	fake := clock.NewFake(time.Now())
 	cb := NewCircuitBreaker("test", Config{
 		MaxRequests: 2,
 		Timeout:     timeout,
+		Clock:       fake,
 		ReadyToTrip: func(counts Counts) bool {
 			return counts.ConsecutiveFailures >= 3
 		},
@@ -152,8 +157,7 @@ func TestCircuitBreakerRecovery(t *testing.T) {
 		})
 	}
 
-	// Wait for timeout
-	time.Sleep(timeout + 10*time.Millisecond)
+	fake.Advance(timeout + time.Millisecond)
 
 	// Successful requests in half-open should close the breaker
 	for i := 0; i < 2; i++ {
@@ -172,9 +176,11 @@ func TestCircuitBreakerRecovery(t *testing.T) {
 
 func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
 	timeout := 50 * time.Millisecond
+	fake := clock.NewFake(time.Now())
 	cb := NewCircuitBreaker("test", Config{
 		MaxRequests: 2,
 		Timeout:     timeout,
+		Clock:       fake,
 		ReadyToTrip: func(counts Counts) bool {
 			return counts.ConsecutiveFailures >= 3
 		},
@@ -189,8 +195,7 @@ func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
 		})
 	}
 
-	// Wait for timeout
-	time.Sleep(timeout + 10*time.Millisecond)
+	fake.Advance(timeout + time.Millisecond)
 
 	// Failure in half-open should reopen the breaker
 	err := cb.Execute(func() error {
@@ -205,11 +210,61 @@ func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
 	}
 }
 
+func TestCircuitBreakerTrip(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	fake := clock.NewFake(time.Now())
+	cb := NewCircuitBreaker("test", Config{
+		MaxRequests: 2,
+		Timeout:     timeout,
+		Clock:       fake,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+	})
+
+	if trip := cb.Trip(); trip.Reason != "" || cb.OpenRemaining() != 0 {
+		t.Errorf("Expected no trip while closed, got %+v", trip)
+	}
+
+	testErr := errors.New("test error")
+	cb.Execute(func() error { return nil })
+	for i := 0; i < 3; i++ {
+		cb.Execute(func() error { return testErr })
+	}
+
+	trip := cb.Trip()
+	if trip.Reason != TripFailureThreshold || trip.Counts.ConsecutiveFailures != 3 {
+		t.Errorf("Expected a failure threshold trip after 3 failures, got %+v", trip)
+	}
+	if ratio := trip.FailureRatio(); ratio != 0.75 {
+		t.Errorf("Expected failure ratio 0.75, got %v", ratio)
+	}
+	if remaining := cb.OpenRemaining(); remaining <= 0 || remaining > timeout {
+		t.Errorf("Expected open time remaining within the timeout, got %v", remaining)
+	}
+
+	// A failed trial request reopens the breaker but keeps when it first opened
+	fake.Advance(timeout + time.Millisecond)
+	cb.Execute(func() error { return testErr })
+
+	reopened := cb.Trip()
+	if reopened.Reason != TripHalfOpenFailure || !reopened.OpenedAt.Equal(trip.OpenedAt) {
+		t.Errorf("Expected a half-open failure keeping the original open time, got %+v", reopened)
+	}
+
+	cb.Reset()
+	if trip := cb.Trip(); trip.Reason != "" {
+		t.Errorf("Expected the trip to be cleared on close, got %+v", trip)
+	}
+}
+
 func TestCircuitBreakerTooManyRequests(t *testing.T) {
 	timeout := 50 * time.Millisecond
+	fake := clock.NewFake(time.Now())
 	cb := NewCircuitBreaker("test", Config{
 		MaxRequests: 2,
 		Timeout:     timeout,
+		Clock:       fake,
 		ReadyToTrip: func(counts Counts) bool {
 			return counts.ConsecutiveFailures >= 3
 		},
@@ -224,8 +279,7 @@ func TestCircuitBreakerTooManyRequests(t *testing.T) {
 		})
 	}
 
-	// Wait for timeout
-	time.Sleep(timeout + 10*time.Millisecond)
+	fake.Advance(timeout + time.Millisecond)
 
 	// First two requests should succeed (max requests = 2)
 	for i := 0; i < 2; i++ {
@@ -405,3 +459,227 @@ func TestCircuitBreakerOnStateChange(t *testing.T) {
 		t.Errorf("Expected to state to be Open, got %v", toState)
 	}
 }
+
+func TestCircuitBreakerIntervalResetsCounts(t *testing.T) {
+	interval := 50 * time.Millisecond
+	fake := clock.NewFake(time.Now())
+	cb := NewCircuitBreaker("test", Config{
+		MaxRequests: 1,
+		Interval:    interval,
+		Clock:       fake,
+		Timeout:     30 * time.Second,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+	})
+
+	testErr := errors.New("test error")
+
+	// Two failures long ago
+	for i := 0; i < 2; i++ {
+		cb.Execute(func() error {
+			return testErr
+		})
+	}
+
+	if counts := cb.Counts(); counts.ConsecutiveFailures != 2 {
+		t.Fatalf("Expected 2 consecutive failures, got %d", counts.ConsecutiveFailures)
+	}
+
+	fake.Advance(interval + time.Millisecond)
+
+	if counts := cb.Counts(); counts.ConsecutiveFailures != 0 || counts.TotalFailures != 0 {
+		t.Errorf("Expected counts to be cleared after interval, got %+v", counts)
+	}
+
+	// A new failure must not combine with the old ones to trip the breaker
+	cb.Execute(func() error {
+		return testErr
+	})
+
+	if cb.State() != StateClosed {
+		t.Errorf("Expected state to remain Closed, got %v", cb.State())
+	}
+
+	if counts := cb.Counts(); counts.ConsecutiveFailures != 1 {
+		t.Errorf("Expected 1 consecutive failure in new interval, got %d", counts.ConsecutiveFailures)
+	}
+}
+
+func TestCircuitBreakerNoIntervalKeepsCounts(t *testing.T) {
+	cb := NewCircuitBreaker("test", Config{
+		MaxRequests: 1,
+		Timeout:     30 * time.Second,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+	})
+
+	testErr := errors.New("test error")
+
+	for i := 0; i < 2; i++ {
+		cb.Execute(func() error {
+			return testErr
+		})
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	cb.Execute(func() error {
+		return testErr
+	})
+
+	if cb.State() != StateOpen {
+		t.Errorf("Expected state to be Open without interval reset, got %v", cb.State())
+	}
+}
+
+// waitForState polls the breaker until it reaches the expected state
+func waitForState(t *testing.T, cb *CircuitBreaker, expected State) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for cb.State() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected state %v, got %v", expected, cb.State())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// failRequests executes failing requests until the breaker opens
+func failRequests(cb *CircuitBreaker, failures int) {
+	testErr := errors.New("test error")
+	for i := 0; i < failures; i++ {
+		cb.Execute(func() error {
+			return testErr
+		})
+	}
+}
+
+func TestCircuitBreakerHealthProbeSuccess(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	release := make(chan error)
+	cb := NewCircuitBreaker("test", Config{
+		MaxRequests: 2,
+		Timeout:     timeout,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+		HealthProbe: func() error {
+			return <-release
+		},
+	})
+
+	failRequests(cb, 3)
+	time.Sleep(timeout + 10*time.Millisecond)
+
+	// While the probe runs, real requests are rejected rather than used as probes
+	served := false
+	err := cb.Execute(func() error {
+		served = true
+		return nil
+	})
+	if err != ErrCircuitOpen {
+		t.Errorf("Expected ErrCircuitOpen during the health probe, got %v", err)
+	}
+	if served {
+		t.Error("Expected no real request to be served during the health probe")
+	}
+	if cb.State() != StateHalfOpen {
+		t.Errorf("Expected state to be HalfOpen during the health probe, got %v", cb.State())
+	}
+
+	release <- nil
+	waitForState(t, cb, StateClosed)
+
+	if err := cb.Execute(func() error { return nil }); err != nil {
+		t.Errorf("Expected no error after a successful probe, got %v", err)
+	}
+}
+
+func TestCircuitBreakerHealthProbeFailure(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	probes := make(chan struct{}, 1)
+	cb := NewCircuitBreaker("test", Config{
+		MaxRequests: 2,
+		Timeout:     timeout,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+		HealthProbe: func() error {
+			probes <- struct{}{}
+			return errors.New("upstream unavailable")
+		},
+	})
+
+	failRequests(cb, 3)
+	time.Sleep(timeout + 10*time.Millisecond)
+
+	// Checking the state starts the half-open transition and with it the probe
+	cb.State()
+	<-probes
+	waitForState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerHealthProbeTimeout(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	fake := clock.NewFake(time.Now())
+	release := make(chan struct{})
+	defer close(release)
+
+	cb := NewCircuitBreaker("test", Config{
+		MaxRequests: 2,
+		Timeout:     timeout,
+		Clock:       fake,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+		HealthProbe: func() error {
+			<-release
+			return nil
+		},
+	})
+
+	failRequests(cb, 3)
+	fake.Advance(timeout + time.Millisecond)
+
+	// A probe that hangs past the timeout reopens the breaker
+	if cb.State() != StateHalfOpen {
+		t.Fatalf("Expected state to be HalfOpen, got %v", cb.State())
+	}
+	fake.BlockUntil(1)
+	fake.Advance(timeout)
+	waitForState(t, cb, StateOpen)
+}
+
+func TestCircuitBreakerHealthProbeStaleAfterReset(t *testing.T) {
+	timeout := 50 * time.Millisecond
+	release := make(chan error)
+	done := make(chan struct{})
+	cb := NewCircuitBreaker("test", Config{
+		MaxRequests: 2,
+		Timeout:     timeout,
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 3
+		},
+		HealthProbe: func() error {
+			defer close(done)
+			return <-release
+		},
+	})
+
+	failRequests(cb, 3)
+	time.Sleep(timeout + 10*time.Millisecond)
+	cb.State()
+
+	// A reset while the probe runs makes its failure irrelevant
+	cb.Reset()
+	release <- errors.New("upstream unavailable")
+	<-done
+	time.Sleep(10 * time.Millisecond)
+
+	if cb.State() != StateClosed {
+		t.Errorf("Expected state to stay Closed after reset, got %v", cb.State())
+	}
+}
@@ -0,0 +1,150 @@
+package circuitbreaker
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// Breaker granularities
+const (
+	GranularityLease    = "lease"    // One breaker per lease
+	GranularityEndpoint = "endpoint" // One breaker per endpoint of a lease
+)
+
+// maxEndpointSegments is how many path segments after the lease ID tell endpoints apart
+// Deeper segments are usually resource IDs or sub-resources of the same endpoint
+const maxEndpointSegments = 2
+
+// BreakerKey returns the key of the breaker for an endpoint of a lease, e.g. "billing/search"
+// An empty endpoint is the lease's own breaker, keyed by the lease ID
+func BreakerKey(leaseID, endpoint string) string {
+	return leaseID + endpoint
+}
+
+// SplitBreakerKey returns the lease ID and endpoint of a breaker key
+// Lease IDs are single path segments, so the endpoint starts at the first slash
+func SplitBreakerKey(key string) (leaseID, endpoint string) {
+	if i := strings.IndexByte(key, '/'); i >= 0 {
+		return key[:i], key[i:]
+	}
+	return key, ""
+}
+
+// breakerKey returns the key of the breaker guarding a request
+func (m *Middleware) breakerKey(leaseID string, r *http.Request) string {
+	if m.config.Granularity != GranularityEndpoint {
+		return leaseID
+	}
+
+	leasePaths := m.config.LeasePaths
+	if leasePaths == nil {
+		leasePaths = middleware.DefaultLeasePathPatterns()
+	}
+
+	// Lease routes are found the same way the metrics endpoint label finds them; what
+	// follows the lease ID is the upstream endpoint
+	pattern, ok := middleware.MatchLeasePath(r.URL.Path, leasePaths)
+	if !ok {
+		return leaseID
+	}
+	return BreakerKey(leaseID, sanitizeEndpoint(pattern.Subpath(r.URL.Path)))
+}
+
+// sanitizeEndpoint reduces an upstream path to a bounded endpoint name
+// ID-like segments become {id} and only the first maxEndpointSegments segments are kept,
+// so "/users/42/orders" and "/users/7" share the "/users/{id}" breaker
+func sanitizeEndpoint(subpath string) string {
+	var segments []string
+	for _, segment := range strings.Split(subpath, "/") {
+		if segment == "" {
+			continue
+		}
+		if len(segments) == maxEndpointSegments {
+			break
+		}
+		if looksLikeID(segment) {
+			segment = "{id}"
+		}
+		segments = append(segments, segment)
+	}
+
+	if len(segments) == 0 {
+		return ""
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// looksLikeID reports whether a path segment is an identifier rather than a route name:
+// a number, a UUID, or a long token containing digits
+func looksLikeID(segment string) bool {
+	digits := 0
+	for _, r := range segment {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+
+	switch {
+	case digits == len(segment):
+		return true
+	case len(segment) == 36 && strings.Count(segment, "-") == 4:
+		return true
+	default:
+		return len(segment) >= 16 && digits > 0
+	}
+}
+
+// reapLoop removes idle breakers until Stop is called
+func (m *Middleware) reapLoop() {
+	clk := clock.Or(m.config.Clock)
+	ticker := clk.NewTicker(min(m.config.IdleTTL, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			m.reapIdle(clk.Now())
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// reapIdle removes closed breakers that have seen no request for IdleTTL
+// Open and half-open breakers are kept, since removing them would close the circuit
+func (m *Middleware) reapIdle(now time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for key, breaker := range m.breakers {
+		if breaker.State() != StateClosed || now.Sub(breaker.LastRequest()) < m.config.IdleTTL {
+			continue
+		}
+
+		delete(m.breakers, key)
+		leaseID, endpoint := SplitBreakerKey(key)
+		if endpoint != "" {
+			m.endpoints[leaseID]--
+			if m.endpoints[leaseID] <= 0 {
+				delete(m.endpoints, leaseID)
+			}
+		}
+		m.config.Metrics.StateGauge.DeleteLabelValues(leaseID, endpoint)
+	}
+}
+
+// Stop stops removing idle breakers
+func (m *Middleware) Stop() {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+
+	if !m.stopped {
+		close(m.stopCh)
+		m.stopped = true
+	}
+}
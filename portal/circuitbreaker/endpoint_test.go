@@ -0,0 +1,134 @@
+package circuitbreaker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareEndpointGranularity(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 2,
+		Metrics:          newTestMetrics(),
+		Granularity:      GranularityEndpoint,
+	})
+
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/peer/billing/search" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	ctx := context.WithValue(context.Background(), "lease_id", "billing")
+	serve := func(path string) int {
+		req := httptest.NewRequest("GET", path, nil).WithContext(ctx)
+		rr := httptest.NewRecorder()
+		wrapped.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	serve("/peer/billing/search")
+	serve("/peer/billing/search")
+
+	if code := serve("/peer/billing/search"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the failing endpoint's circuit to be open, got %d", code)
+	}
+	if code := serve("/peer/billing/status"); code != http.StatusOK {
+		t.Errorf("Expected another endpoint of the lease to be unaffected, got %d", code)
+	}
+
+	breakers := m.ListBreakers()
+	if breakers["billing/search"] == nil || breakers["billing/status"] == nil || len(breakers) != 2 {
+		t.Errorf("Expected one breaker per endpoint, got %v", breakers)
+	}
+}
+
+func TestMiddlewareMaxEndpointsPerLease(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:          1,
+		Timeout:              time.Minute,
+		FailureThreshold:     5,
+		Metrics:              newTestMetrics(),
+		Granularity:          GranularityEndpoint,
+		MaxEndpointsPerLease: 2,
+	})
+
+	first := m.GetBreaker("billing/a")
+	m.GetBreaker("billing/b")
+
+	if m.GetBreaker("billing/a") != first {
+		t.Error("Expected an existing endpoint to keep its breaker")
+	}
+	if m.GetBreaker("billing/c") != m.GetBreaker("billing") {
+		t.Error("Expected endpoints past the limit to share the lease-wide breaker")
+	}
+	if len(m.ListBreakers()) != 3 {
+		t.Errorf("Expected 3 breakers, got %v", m.ListBreakers())
+	}
+}
+
+func TestMiddlewareReapIdle(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 1,
+		Metrics:          newTestMetrics(),
+		Granularity:      GranularityEndpoint,
+		IdleTTL:          time.Hour,
+	})
+	defer m.Stop()
+
+	m.GetBreaker("billing/idle")
+	open := m.GetBreaker("billing/open")
+	open.Execute(func() error { return http.ErrHandlerTimeout })
+
+	m.reapIdle(time.Now().Add(2 * time.Hour))
+
+	breakers := m.ListBreakers()
+	if _, exists := breakers["billing/idle"]; exists {
+		t.Error("Expected the idle closed breaker to be removed")
+	}
+	if _, exists := breakers["billing/open"]; !exists {
+		t.Error("Expected the open breaker to be kept")
+	}
+	if m.endpoints["billing"] != 1 {
+		t.Errorf("Expected the lease's endpoint count to drop to 1, got %d", m.endpoints["billing"])
+	}
+}
+
+func TestSanitizeEndpoint(t *testing.T) {
+	tests := []struct {
+		subpath  string
+		expected string
+	}{
+		{"", ""},
+		{"/", ""},
+		{"/search", "/search"},
+		{"/users/42", "/users/{id}"},
+		{"/users/42/orders/7", "/users/{id}"},
+		{"/v1/chat/completions", "/v1/chat"},
+		{"/items/3f2504e0-4f89-11d3-9a0c-0305e82c3301", "/items/{id}"},
+		{"/sessions/a1b2c3d4e5f6a7b8c9", "/sessions/{id}"},
+	}
+
+	for _, tt := range tests {
+		if got := sanitizeEndpoint(tt.subpath); got != tt.expected {
+			t.Errorf("sanitizeEndpoint(%q) = %q, expected %q", tt.subpath, got, tt.expected)
+		}
+	}
+}
+
+func TestSplitBreakerKey(t *testing.T) {
+	leaseID, endpoint := SplitBreakerKey(BreakerKey("billing", "/users/{id}"))
+	if leaseID != "billing" || endpoint != "/users/{id}" {
+		t.Errorf("Expected billing and /users/{id}, got %q and %q", leaseID, endpoint)
+	}
+
+	if leaseID, endpoint := SplitBreakerKey("billing"); leaseID != "billing" || endpoint != "" {
+		t.Errorf("Expected a lease-wide key, got %q and %q", leaseID, endpoint)
+	}
+}
@@ -1,22 +1,36 @@
 package circuitbreaker
 
 import (
+	"bytes"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/portal-project/portal-gateway/portal/problem"
+	"github.com/portal-project/portal-gateway/portal/service"
 )
 
 // Metrics holds circuit breaker metrics
 type Metrics struct {
-	StateGauge         *prometheus.GaugeVec
-	RequestsTotal      *prometheus.CounterVec
-	FailuresTotal      *prometheus.CounterVec
-	StateChangesTotal  *prometheus.CounterVec
-	RejectedTotal      *prometheus.CounterVec
+	StateGauge            *prometheus.GaugeVec
+	RequestsTotal         *prometheus.CounterVec
+	FailuresTotal         *prometheus.CounterVec
+	StateChangesTotal     *prometheus.CounterVec
+	RejectedTotal         *prometheus.CounterVec
+	FallbackTotal         *prometheus.CounterVec
+	FallbackFailuresTotal *prometheus.CounterVec
+	HealthProbesTotal     *prometheus.CounterVec
+	StaleServedTotal      *prometheus.CounterVec
+	StreamFailuresTotal   *prometheus.CounterVec
 }
 
 // NewMetrics creates new circuit breaker metrics using the default registry
@@ -38,7 +52,7 @@ func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
 				Name: "portal_circuit_breaker_state",
 				Help: "Current state of circuit breakers (0=closed, 1=open, 2=half-open)",
 			},
-			[]string{"lease_id"},
+			[]string{"lease_id", "endpoint"}, // endpoint is empty for lease-wide breakers
 		),
 		RequestsTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
@@ -64,10 +78,45 @@ func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
 		RejectedTotal: factory.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "portal_circuit_breaker_rejected_total",
-				Help: "Total number of requests rejected by circuit breaker",
+				Help: "Total number of requests rejected by circuit breaker, by how long the breaker had been open",
+			},
+			[]string{"lease_id", "reason", "open_for"}, // open_for: see openDurationBucket
+		),
+		FallbackTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_circuit_breaker_fallback_total",
+				Help: "Total number of fallback handler invocations",
+			},
+			[]string{"lease_id"},
+		),
+		FallbackFailuresTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_circuit_breaker_fallback_failures_total",
+				Help: "Total number of fallback handler failures",
 			},
 			[]string{"lease_id", "reason"},
 		),
+		HealthProbesTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_circuit_breaker_health_probes_total",
+				Help: "Total number of half-open health probes",
+			},
+			[]string{"lease_id", "result"},
+		),
+		StaleServedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_circuit_breaker_stale_served_total",
+				Help: "Total number of requests answered from the stale cache while the circuit was open",
+			},
+			[]string{"lease_id"},
+		),
+		StreamFailuresTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_circuit_breaker_stream_failures_total",
+				Help: "Total number of failures reported after the response had started, counted as breaker failures",
+			},
+			[]string{"lease_id"},
+		),
 	}
 }
 
@@ -75,34 +124,88 @@ func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
 type MiddlewareConfig struct {
 	// MaxRequests is the maximum number of requests allowed in half-open state
 	MaxRequests uint32
-	// Interval is the cyclic period to clear internal counts
+	// Interval is the cyclic period to clear internal counts while closed (0 means never)
 	Interval time.Duration
 	// Timeout is the period after which the breaker moves from open to half-open
 	Timeout time.Duration
 	// FailureThreshold is the number of consecutive failures before tripping
 	FailureThreshold uint32
+	// ServiceFailureThresholds override FailureThreshold for leases of a service
+	ServiceFailureThresholds map[string]uint32
+	// Classifier assigns leases to services; without it ServiceFailureThresholds is not used
+	Classifier *service.Classifier
 	// Metrics is the metrics collector
 	Metrics *Metrics
 	// FallbackHandler is called when circuit is open (optional)
 	FallbackHandler http.Handler
+	// Notifier is notified asynchronously of state changes (defaults to NoopNotifier)
+	Notifier StateChangeNotifier
+	// NotifyDebounce collapses state changes within this window into one notification (0 disables)
+	NotifyDebounce time.Duration
+	// HealthProbe checks a lease's upstream on entering half-open state, so recovery is
+	// validated without real traffic (optional; without it real requests act as probes)
+	HealthProbe func(leaseID string) error
+	// HealthProbeLeases limits HealthProbe to the leases it returns true for (nil = all leases)
+	HealthProbeLeases func(leaseID string) bool
+	// StaleCache keeps successful GET responses to serve while the circuit is open (optional)
+	// It is consulted before the fallback handler
+	StaleCache *StaleCache
+	// ForceClosedLeases bypass the breaker: their requests always reach the upstream and are
+	// still counted, but never trip it (supports wildcards like "control-*")
+	ForceClosedLeases []string
+	// Granularity scopes breakers to a lease (GranularityLease, the default) or to each
+	// endpoint of a lease (GranularityEndpoint), so one failing route does not open the others
+	Granularity string
+	// LeasePaths locate the endpoint after the lease ID (nil = middleware.DefaultLeasePathPatterns)
+	LeasePaths []middleware.LeasePathPattern
+	// MaxEndpointsPerLease bounds the endpoint breakers of one lease; requests to further
+	// endpoints share the lease-wide breaker (default 100)
+	MaxEndpointsPerLease int
+	// IdleTTL removes closed breakers that have seen no request for this long (0 = never)
+	IdleTTL time.Duration
+	// DetectStreamFailures counts failures handlers report with ReportFailure after the
+	// response has started, such as an upstream dropping mid-stream, toward tripping the
+	// breaker; the client still gets the status that was already sent
+	DetectStreamFailures bool
+	// Clock tells breakers and the idle reaper the time (nil = clock.Real); tests set a clock.Fake
+	Clock clock.Clock
+	// Rejections is told about requests rejected by an open circuit, e.g. saturation.Tracker (nil = none)
+	Rejections RejectionRecorder
 }
 
 // DefaultMiddlewareConfig returns default configuration
 func DefaultMiddlewareConfig() *MiddlewareConfig {
 	return &MiddlewareConfig{
 		MaxRequests:      3,
-		Interval:         0,
+		Interval:         60 * time.Second,
 		Timeout:          30 * time.Second,
 		FailureThreshold: 5,
 		Metrics:          NewMetrics(),
+		Notifier:         NoopNotifier{},
+		NotifyDebounce:   30 * time.Second,
 	}
 }
 
+// RejectionRecorder is told about requests a limiting layer turns away, e.g. saturation.Tracker
+type RejectionRecorder interface {
+	RecordRejection(reason string)
+}
+
 // Middleware provides circuit breaker middleware with per-lease breakers
 type Middleware struct {
-	config   *MiddlewareConfig
-	breakers map[string]*CircuitBreaker
-	mutex    sync.RWMutex
+	config    *MiddlewareConfig
+	notify    *notifyDispatcher
+	breakers  map[string]*CircuitBreaker // breaker key -> breaker, see BreakerKey
+	endpoints map[string]int             // lease ID -> number of endpoint breakers
+	mutex     sync.RWMutex
+
+	stopCh  chan struct{}
+	stopMu  sync.Mutex
+	stopped bool
+
+	// forceClosed holds runtime overrides of ForceClosedLeases by exact lease ID
+	forceClosed   map[string]bool
+	forceClosedMu sync.RWMutex
 }
 
 // NewMiddleware creates a new circuit breaker middleware
@@ -115,16 +218,76 @@ func NewMiddleware(config *MiddlewareConfig) *Middleware {
 		config.Metrics = NewMetrics()
 	}
 
-	return &Middleware{
-		config:   config,
-		breakers: make(map[string]*CircuitBreaker),
+	if config.Notifier == nil {
+		config.Notifier = NoopNotifier{}
+	}
+
+	if config.MaxEndpointsPerLease <= 0 {
+		config.MaxEndpointsPerLease = 100
 	}
+
+	m := &Middleware{
+		config:      config,
+		notify:      newNotifyDispatcher(config.Notifier, config.NotifyDebounce),
+		breakers:    make(map[string]*CircuitBreaker),
+		endpoints:   make(map[string]int),
+		forceClosed: make(map[string]bool),
+		stopCh:      make(chan struct{}),
+	}
+
+	if config.IdleTTL > 0 {
+		go m.reapLoop()
+	}
+
+	return m
+}
+
+// SetForceClosed overrides whether a lease bypasses its breaker, taking precedence over ForceClosedLeases
+func (m *Middleware) SetForceClosed(leaseID string, forceClosed bool) {
+	m.forceClosedMu.Lock()
+	defer m.forceClosedMu.Unlock()
+
+	m.forceClosed[leaseID] = forceClosed
 }
 
-// GetBreaker returns the circuit breaker for a given lease ID
-func (m *Middleware) GetBreaker(leaseID string) *CircuitBreaker {
+// ClearForceClosed removes a lease's runtime override, returning it to ForceClosedLeases
+func (m *Middleware) ClearForceClosed(leaseID string) {
+	m.forceClosedMu.Lock()
+	defer m.forceClosedMu.Unlock()
+
+	delete(m.forceClosed, leaseID)
+}
+
+// IsForceClosed reports whether a lease bypasses its breaker
+func (m *Middleware) IsForceClosed(leaseID string) bool {
+	m.forceClosedMu.RLock()
+	forceClosed, overridden := m.forceClosed[leaseID]
+	m.forceClosedMu.RUnlock()
+
+	if overridden {
+		return forceClosed
+	}
+	return middleware.MatchAnyLease(m.config.ForceClosedLeases, leaseID)
+}
+
+// ForceClosedOverrides returns the runtime force-closed overrides by lease ID
+func (m *Middleware) ForceClosedOverrides() map[string]bool {
+	m.forceClosedMu.RLock()
+	defer m.forceClosedMu.RUnlock()
+
+	result := make(map[string]bool, len(m.forceClosed))
+	for k, v := range m.forceClosed {
+		result[k] = v
+	}
+	return result
+}
+
+// GetBreaker returns the circuit breaker for a breaker key: a lease ID, or a lease ID and
+// endpoint with GranularityEndpoint (see BreakerKey)
+// A lease already at MaxEndpointsPerLease gets its lease-wide breaker for new endpoints
+func (m *Middleware) GetBreaker(key string) *CircuitBreaker {
 	m.mutex.RLock()
-	breaker, ok := m.breakers[leaseID]
+	breaker, ok := m.breakers[key]
 	m.mutex.RUnlock()
 
 	if ok {
@@ -135,13 +298,36 @@ func (m *Middleware) GetBreaker(leaseID string) *CircuitBreaker {
 	defer m.mutex.Unlock()
 
 	// Double-check after acquiring write lock
-	if breaker, ok := m.breakers[leaseID]; ok {
+	if breaker, ok := m.breakers[key]; ok {
 		return breaker
 	}
 
+	leaseID, endpoint := SplitBreakerKey(key)
+	if endpoint != "" && m.endpoints[leaseID] >= m.config.MaxEndpointsPerLease {
+		key, endpoint = leaseID, ""
+		if breaker, ok := m.breakers[key]; ok {
+			return breaker
+		}
+	}
+
 	// Create new circuit breaker for this lease
 	threshold := m.config.FailureThreshold
-	breaker = NewCircuitBreaker(leaseID, Config{
+	if serviceThreshold, ok := m.config.ServiceFailureThresholds[m.config.Classifier.Classify(leaseID)]; ok {
+		threshold = serviceThreshold
+	}
+	var healthProbe func() error
+	if m.config.HealthProbe != nil && (m.config.HealthProbeLeases == nil || m.config.HealthProbeLeases(leaseID)) {
+		healthProbe = func() error {
+			err := m.config.HealthProbe(leaseID)
+			result := "success"
+			if err != nil {
+				result = "failure"
+			}
+			m.config.Metrics.HealthProbesTotal.WithLabelValues(leaseID, result).Inc()
+			return err
+		}
+	}
+	breaker = NewCircuitBreaker(key, Config{
 		MaxRequests: m.config.MaxRequests,
 		Interval:    m.config.Interval,
 		Timeout:     m.config.Timeout,
@@ -151,21 +337,53 @@ func (m *Middleware) GetBreaker(leaseID string) *CircuitBreaker {
 		OnStateChange: func(name string, from State, to State) {
 			m.onStateChange(name, from, to)
 		},
+		HealthProbe: healthProbe,
+		Clock:       m.config.Clock,
 	})
 
-	m.breakers[leaseID] = breaker
+	m.breakers[key] = breaker
+	if endpoint != "" {
+		m.endpoints[leaseID]++
+	}
 
 	// Initialize state metric
-	m.config.Metrics.StateGauge.WithLabelValues(leaseID).Set(float64(StateClosed))
+	m.config.Metrics.StateGauge.WithLabelValues(leaseID, endpoint).Set(float64(StateClosed))
 
 	return breaker
 }
 
+// PrewarmBreakers creates the lease-wide breakers of known leases ahead of their first request,
+// so requests to them only ever take the read lock; it returns how many were created
+// Wildcard patterns and IDs that already have a breaker are skipped
+func (m *Middleware) PrewarmBreakers(leaseIDs []string) int {
+	created := 0
+	for _, leaseID := range leaseIDs {
+		if leaseID == "" || strings.ContainsAny(leaseID, "*/") {
+			continue
+		}
+
+		m.mutex.RLock()
+		_, exists := m.breakers[leaseID]
+		m.mutex.RUnlock()
+		if exists {
+			continue
+		}
+
+		m.GetBreaker(BreakerKey(leaseID, ""))
+		created++
+	}
+	return created
+}
+
 // onStateChange is called when a circuit breaker changes state
 func (m *Middleware) onStateChange(name string, from State, to State) {
 	// Update metrics
-	m.config.Metrics.StateGauge.WithLabelValues(name).Set(float64(to))
-	m.config.Metrics.StateChangesTotal.WithLabelValues(name, from.String(), to.String()).Inc()
+	leaseID, endpoint := SplitBreakerKey(name)
+	m.config.Metrics.StateGauge.WithLabelValues(leaseID, endpoint).Set(float64(to))
+	m.config.Metrics.StateChangesTotal.WithLabelValues(leaseID, from.String(), to.String()).Inc()
+
+	// Called with the breaker locked, so the notifier must not run inline
+	m.notify.stateChanged(name, from, to)
 }
 
 // Middleware returns an http.Handler that wraps the next handler with circuit breaker
@@ -179,14 +397,36 @@ func (m *Middleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Get or create circuit breaker for this lease
-		breaker := m.GetBreaker(leaseID)
+		var failure *streamFailure
+		if m.config.DetectStreamFailures {
+			r, failure = withStreamFailure(r)
+		}
+
+		if m.IsForceClosed(leaseID) {
+			m.servePassthrough(w, r, next, leaseID, failure)
+			return
+		}
+
+		// Get or create circuit breaker for this lease, or this endpoint of it
+		breaker := m.GetBreaker(m.breakerKey(leaseID, r))
+
+		var cacheKey string
+		if m.config.StaleCache != nil {
+			cacheKey = m.config.StaleCache.cacheKey(leaseID, r)
+		}
 
 		// Execute request through circuit breaker
 		err := breaker.Execute(func() error {
+			var target http.ResponseWriter = w
+			var recorder *cacheRecorder
+			if cacheKey != "" {
+				recorder = newCacheRecorder(w, m.config.StaleCache.config.MaxBodySize)
+				target = recorder
+			}
+
 			// Create response writer wrapper to capture status code
 			wrapped := &responseWriter{
-				ResponseWriter: w,
+				ResponseWriter: target,
 				statusCode:     http.StatusOK,
 			}
 
@@ -199,32 +439,49 @@ func (m *Middleware) Middleware(next http.Handler) http.Handler {
 				return fmt.Errorf("server error: %d", wrapped.statusCode)
 			}
 
+			// The response started fine but the upstream failed while it was being written
+			if err := failure.get(r); err != nil {
+				m.recordStreamFailure(leaseID)
+				return fmt.Errorf("stream failed: %w", err)
+			}
+
 			m.config.Metrics.RequestsTotal.WithLabelValues(leaseID, "success").Inc()
+			if recorder != nil {
+				m.config.StaleCache.store(cacheKey, recorder)
+			}
 			return nil
 		})
 
 		if err != nil {
 			// Circuit breaker rejected the request
 			if err == ErrCircuitOpen {
-				m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "open").Inc()
+				m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "open", openDurationBucket(breaker.Trip(), clock.Or(m.config.Clock).Now())).Inc()
+				if m.config.Rejections != nil {
+					m.config.Rejections.RecordRejection("circuit_open")
+				}
+
+				// A recent successful response beats a fallback or a 503
+				if cacheKey != "" {
+					if entry, ok := m.config.StaleCache.get(cacheKey); ok {
+						m.config.Metrics.StaleServedTotal.WithLabelValues(leaseID).Inc()
+						entry.serve(w)
+						return
+					}
+				}
 
 				// Use fallback handler if configured
 				if m.config.FallbackHandler != nil {
-					m.config.FallbackHandler.ServeHTTP(w, r)
+					m.serveFallback(w, r, leaseID, breaker)
 					return
 				}
 
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusServiceUnavailable)
-				fmt.Fprintf(w, `{"error":"service_unavailable","message":"Circuit breaker is open for lease %s"}`, leaseID)
+				writeCircuitOpen(w, r, leaseID, breaker)
 				return
 			}
 
 			if err == ErrTooManyRequests {
-				m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "too_many_requests").Inc()
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				fmt.Fprintf(w, `{"error":"too_many_requests","message":"Circuit breaker is testing recovery for lease %s"}`, leaseID)
+				m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "too_many_requests", openDurationBucket(breaker.Trip(), clock.Or(m.config.Clock).Now())).Inc()
+				problem.Write(w, r, http.StatusTooManyRequests, "too_many_requests", fmt.Sprintf("Circuit breaker is testing recovery for lease %s", leaseID))
 				return
 			}
 
@@ -233,6 +490,158 @@ func (m *Middleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// servePassthrough serves a force-closed lease without its breaker, recording the outcome
+// in the same metrics as breaker-guarded requests
+func (m *Middleware) servePassthrough(w http.ResponseWriter, r *http.Request, next http.Handler, leaseID string, failure *streamFailure) {
+	wrapped := &responseWriter{
+		ResponseWriter: w,
+		statusCode:     http.StatusOK,
+	}
+
+	next.ServeHTTP(wrapped, r)
+
+	if wrapped.statusCode >= 500 {
+		m.config.Metrics.FailuresTotal.WithLabelValues(leaseID).Inc()
+		m.config.Metrics.RequestsTotal.WithLabelValues(leaseID, "failure").Inc()
+		return
+	}
+	if failure.get(r) != nil {
+		m.recordStreamFailure(leaseID)
+		return
+	}
+	m.config.Metrics.RequestsTotal.WithLabelValues(leaseID, "success").Inc()
+}
+
+// recordStreamFailure records a failure reported after the response had started
+func (m *Middleware) recordStreamFailure(leaseID string) {
+	m.config.Metrics.FailuresTotal.WithLabelValues(leaseID).Inc()
+	m.config.Metrics.StreamFailuresTotal.WithLabelValues(leaseID).Inc()
+	m.config.Metrics.RequestsTotal.WithLabelValues(leaseID, "failure").Inc()
+}
+
+// serveFallback invokes the fallback handler for an open circuit
+// The fallback response is buffered so that a panicking or malformed fallback
+// can be replaced by the default 503 response instead of a broken one
+func (m *Middleware) serveFallback(w http.ResponseWriter, r *http.Request, leaseID string, breaker *CircuitBreaker) {
+	m.config.Metrics.FallbackTotal.WithLabelValues(leaseID).Inc()
+
+	rec := newFallbackRecorder()
+	if reason := m.runFallback(rec, r); reason != "" {
+		m.config.Metrics.FallbackFailuresTotal.WithLabelValues(leaseID, reason).Inc()
+		writeCircuitOpen(w, r, leaseID, breaker)
+		return
+	}
+
+	rec.copyTo(w)
+}
+
+// runFallback runs the fallback handler and returns a failure reason, or "" on success
+func (m *Middleware) runFallback(rec *fallbackRecorder, r *http.Request) (reason string) {
+	defer func() {
+		if e := recover(); e != nil {
+			reason = "panic"
+		}
+	}()
+
+	m.config.FallbackHandler.ServeHTTP(rec, r)
+
+	// A fallback that writes nothing would otherwise pass through as an empty 200
+	if !rec.wroteHeader {
+		return "empty_response"
+	}
+
+	if rec.statusCode < 100 || rec.statusCode > 599 {
+		return "invalid_status"
+	}
+
+	return ""
+}
+
+// circuitOpenTrip tells the client why the circuit opened
+type circuitOpenTrip struct {
+	Reason              string    `json:"reason"`
+	ConsecutiveFailures uint32    `json:"consecutive_failures"`
+	FailureRatio        float64   `json:"failure_ratio"`
+	OpenedAt            time.Time `json:"opened_at"`
+}
+
+// writeCircuitOpen writes the default response for an open circuit
+// Retry-After is when the breaker next lets a request through, at least one second
+func writeCircuitOpen(w http.ResponseWriter, r *http.Request, leaseID string, breaker *CircuitBreaker) {
+	retryAfter := max(int(math.Ceil(breaker.OpenRemaining().Seconds())), 1)
+
+	fields := map[string]any{"retry_after_seconds": retryAfter}
+	if trip := breaker.Trip(); trip.Reason != "" {
+		fields["trip"] = &circuitOpenTrip{
+			Reason:              trip.Reason,
+			ConsecutiveFailures: trip.Counts.ConsecutiveFailures,
+			FailureRatio:        trip.FailureRatio(),
+			OpenedAt:            trip.OpenedAt.UTC(),
+		}
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	problem.WriteWithFields(w, r, http.StatusServiceUnavailable, "service_unavailable", fmt.Sprintf("Circuit breaker is open for lease %s", leaseID), fields)
+}
+
+// openDurationBucket labels how long a breaker has been open, keeping metric cardinality bounded
+func openDurationBucket(trip Trip, now time.Time) string {
+	if trip.OpenedAt.IsZero() {
+		return "unknown"
+	}
+
+	switch openFor := now.Sub(trip.OpenedAt); {
+	case openFor < 30*time.Second:
+		return "under_30s"
+	case openFor < 5*time.Minute:
+		return "under_5m"
+	case openFor < 30*time.Minute:
+		return "under_30m"
+	default:
+		return "over_30m"
+	}
+}
+
+// fallbackRecorder buffers a fallback handler response
+type fallbackRecorder struct {
+	header      http.Header
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func newFallbackRecorder() *fallbackRecorder {
+	return &fallbackRecorder{
+		header:     make(http.Header),
+		statusCode: http.StatusOK,
+	}
+}
+
+func (rec *fallbackRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *fallbackRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.statusCode = code
+	}
+}
+
+func (rec *fallbackRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
+
+// copyTo writes the buffered response to w
+func (rec *fallbackRecorder) copyTo(w http.ResponseWriter) {
+	for key, values := range rec.header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(rec.statusCode)
+	w.Write(rec.body.Bytes())
+}
+
 // responseWriter wraps http.ResponseWriter to capture status code
 type responseWriter struct {
 	http.ResponseWriter
@@ -244,6 +653,11 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // getLeaseID retrieves lease ID from context
 func getLeaseID(ctx interface{}) string {
 	if ctx == nil {
@@ -280,7 +694,7 @@ func getLeaseID(ctx interface{}) string {
 	return ""
 }
 
-// ListBreakers returns all active circuit breakers
+// ListBreakers returns all active circuit breakers by breaker key
 func (m *Middleware) ListBreakers() map[string]*CircuitBreaker {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
@@ -292,10 +706,10 @@ func (m *Middleware) ListBreakers() map[string]*CircuitBreaker {
 	return result
 }
 
-// ResetBreaker resets a specific circuit breaker
-func (m *Middleware) ResetBreaker(leaseID string) bool {
+// ResetBreaker resets the circuit breaker with a breaker key
+func (m *Middleware) ResetBreaker(key string) bool {
 	m.mutex.RLock()
-	breaker, ok := m.breakers[leaseID]
+	breaker, ok := m.breakers[key]
 	m.mutex.RUnlock()
 
 	if !ok {
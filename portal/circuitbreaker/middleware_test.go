@@ -2,13 +2,19 @@ package circuitbreaker
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/service"
 )
 
 // newTestMetrics creates new metrics for testing with a fresh registry
@@ -99,11 +105,13 @@ func TestMiddlewareWithLeaseID(t *testing.T) {
 }
 
 func TestMiddlewareCircuitTrips(t *testing.T) {
+	rejections := &rejectionRecorder{}
 	config := &MiddlewareConfig{
 		MaxRequests:      2,
 		Timeout:          100 * time.Millisecond,
 		FailureThreshold: 3,
 		Metrics:          newTestMetrics(),
+		Rejections:       rejections,
 	}
 
 	m := NewMiddleware(config)
@@ -143,6 +151,94 @@ func TestMiddlewareCircuitTrips(t *testing.T) {
 	if rr.Code != http.StatusServiceUnavailable {
 		t.Errorf("Expected status 503, got %d", rr.Code)
 	}
+
+	// Failures that trip the breaker are not rejections, only the request turned away is
+	if len(rejections.reasons) != 1 || rejections.reasons[0] != "circuit_open" {
+		t.Errorf("Expected one circuit_open rejection reported, got %v", rejections.reasons)
+	}
+}
+
+func TestMiddlewareCircuitOpenResponse(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          90 * time.Second,
+		FailureThreshold: 2,
+		Metrics:          NewMetricsWithRegistry(reg),
+	})
+
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+	tripBreaker(t, m, ctx, 2)
+
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected handler not to be called while circuit is open")
+	}))
+
+	req := httptest.NewRequest("GET", "/test", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "90" {
+		t.Errorf("Expected Retry-After 90, got %q", got)
+	}
+
+	var body struct {
+		Error             string `json:"error"`
+		RetryAfterSeconds int    `json:"retry_after_seconds"`
+		Trip              struct {
+			Reason              string  `json:"reason"`
+			ConsecutiveFailures uint32  `json:"consecutive_failures"`
+			FailureRatio        float64 `json:"failure_ratio"`
+		} `json:"trip"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if body.Error != "service_unavailable" || body.RetryAfterSeconds != 90 {
+		t.Errorf("Unexpected response %+v", body)
+	}
+	if body.Trip.Reason != TripFailureThreshold || body.Trip.ConsecutiveFailures != 2 || body.Trip.FailureRatio != 1 {
+		t.Errorf("Expected the trip reason in the response, got %+v", body.Trip)
+	}
+
+	if got := counterValue(t, reg, "portal_circuit_breaker_rejected_total", "reason", "open", "open_for", "under_30s"); got != 1 {
+		t.Errorf("Expected 1 rejection in the under_30s bucket, got %v", got)
+	}
+}
+
+func TestOpenDurationBucket(t *testing.T) {
+	tests := []struct {
+		openFor  time.Duration
+		expected string
+	}{
+		{time.Second, "under_30s"},
+		{time.Minute, "under_5m"},
+		{10 * time.Minute, "under_30m"},
+		{time.Hour, "over_30m"},
+	}
+
+	now := time.Now()
+	for _, tt := range tests {
+		if got := openDurationBucket(Trip{OpenedAt: now.Add(-tt.openFor)}, now); got != tt.expected {
+			t.Errorf("openDurationBucket(%v) = %q, expected %q", tt.openFor, got, tt.expected)
+		}
+	}
+
+	if got := openDurationBucket(Trip{}, now); got != "unknown" {
+		t.Errorf("Expected unknown without an open time, got %q", got)
+	}
+}
+
+// rejectionRecorder collects rejections reported by the middleware
+type rejectionRecorder struct {
+	reasons []string
+}
+
+func (r *rejectionRecorder) RecordRejection(reason string) {
+	r.reasons = append(r.reasons, reason)
 }
 
 func TestMiddlewareCircuitRecovery(t *testing.T) {
@@ -540,3 +636,400 @@ func BenchmarkMiddleware(b *testing.B) {
 		wrapped.ServeHTTP(rr, req)
 	}
 }
+
+// counterValue sums the series of a counter family in a registry
+// Optional label name/value pairs restrict the sum to matching series
+func counterValue(t *testing.T, reg *prometheus.Registry, name string, labels ...string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	total := 0.0
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if matchesLabels(metric.GetLabel(), labels) {
+				total += metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return total
+}
+
+// matchesLabels reports whether a series carries all given label name/value pairs
+func matchesLabels(pairs []*dto.LabelPair, labels []string) bool {
+	for i := 0; i+1 < len(labels); i += 2 {
+		found := false
+		for _, pair := range pairs {
+			if pair.GetName() == labels[i] && pair.GetValue() == labels[i+1] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// tripBreaker sends failing requests until the breaker for the context lease opens
+func tripBreaker(t *testing.T, m *Middleware, ctx context.Context, failures int) {
+	t.Helper()
+
+	failing := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+
+	for i := 0; i < failures; i++ {
+		req := httptest.NewRequest("GET", "/test", nil).WithContext(ctx)
+		failing.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
+func TestMiddlewareFallbackFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback http.HandlerFunc
+		reason   string
+	}{
+		{
+			name: "fallback panics",
+			fallback: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("partial"))
+				panic("fallback exploded")
+			},
+			reason: "panic",
+		},
+		{
+			name: "fallback writes invalid status",
+			fallback: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(42)
+			},
+			reason: "invalid_status",
+		},
+		{
+			name:     "fallback writes nothing",
+			fallback: func(w http.ResponseWriter, r *http.Request) {},
+			reason:   "empty_response",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			m := NewMiddleware(&MiddlewareConfig{
+				MaxRequests:      1,
+				Timeout:          time.Minute,
+				FailureThreshold: 2,
+				Metrics:          NewMetricsWithRegistry(reg),
+				FallbackHandler:  tt.fallback,
+			})
+
+			ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+			tripBreaker(t, m, ctx, 2)
+
+			wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Error("Expected handler not to be called while circuit is open")
+			}))
+
+			req := httptest.NewRequest("GET", "/test", nil).WithContext(ctx)
+			rr := httptest.NewRecorder()
+			wrapped.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected status 503, got %d", rr.Code)
+			}
+
+			if !strings.Contains(rr.Body.String(), `"error":"service_unavailable"`) {
+				t.Errorf("Expected default 503 JSON body, got %q", rr.Body.String())
+			}
+
+			if got := counterValue(t, reg, "portal_circuit_breaker_fallback_total"); got != 1 {
+				t.Errorf("Expected 1 fallback invocation, got %v", got)
+			}
+
+			if got := counterValue(t, reg, "portal_circuit_breaker_fallback_failures_total", "reason", tt.reason); got != 1 {
+				t.Errorf("Expected 1 fallback failure with reason %s, got %v", tt.reason, got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareFallbackResponsePassthrough(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 2,
+		Metrics:          NewMetricsWithRegistry(reg),
+		FallbackHandler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Fallback", "true")
+			w.WriteHeader(http.StatusAccepted)
+			w.Write([]byte("cached"))
+		}),
+	})
+
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+	tripBreaker(t, m, ctx, 2)
+
+	req := httptest.NewRequest("GET", "/test", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	m.Middleware(http.NotFoundHandler()).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected fallback status 202, got %d", rr.Code)
+	}
+
+	if rr.Header().Get("X-Fallback") != "true" {
+		t.Error("Expected fallback headers to be copied")
+	}
+
+	if rr.Body.String() != "cached" {
+		t.Errorf("Expected fallback body 'cached', got %q", rr.Body.String())
+	}
+
+	if got := counterValue(t, reg, "portal_circuit_breaker_fallback_failures_total"); got != 0 {
+		t.Errorf("Expected no fallback failures, got %v", got)
+	}
+}
+
+func TestMiddlewareBreakerInterval(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	config := &MiddlewareConfig{
+		MaxRequests:      1,
+		Interval:         50 * time.Millisecond,
+		Timeout:          time.Minute,
+		FailureThreshold: 3,
+		Metrics:          newTestMetrics(),
+		Clock:            fake,
+	}
+	m := NewMiddleware(config)
+
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+
+	// Two failures, then let the interval elapse before a third
+	tripBreaker(t, m, ctx, 2)
+	fake.Advance(70 * time.Millisecond)
+	tripBreaker(t, m, ctx, 1)
+
+	if state := m.GetBreaker("test-lease").State(); state != StateClosed {
+		t.Errorf("Expected breaker to stay closed across intervals, got %v", state)
+	}
+}
+
+func TestMiddlewareHealthProbe(t *testing.T) {
+	metrics := newTestMetrics()
+	probed := make(chan string, 1)
+	config := &MiddlewareConfig{
+		MaxRequests:      2,
+		Timeout:          50 * time.Millisecond,
+		FailureThreshold: 3,
+		Metrics:          metrics,
+		HealthProbe: func(leaseID string) error {
+			probed <- leaseID
+			return nil
+		},
+	}
+
+	m := NewMiddleware(config)
+
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+	tripBreaker(t, m, ctx, 3)
+
+	served := 0
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The first request after the timeout starts the probe and is still rejected
+	req := httptest.NewRequest("GET", "/test", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 while probing, got %d", rr.Code)
+	}
+
+	if leaseID := <-probed; leaseID != "test-lease" {
+		t.Errorf("Expected probe for test-lease, got %s", leaseID)
+	}
+	waitForState(t, m.GetBreaker("test-lease"), StateClosed)
+
+	if served != 0 {
+		t.Errorf("Expected no real request to reach the handler while probing, got %d", served)
+	}
+
+	metric := &dto.Metric{}
+	if err := metrics.HealthProbesTotal.WithLabelValues("test-lease", "success").Write(metric); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	if got := metric.Counter.GetValue(); got != 1 {
+		t.Errorf("Expected 1 successful health probe, got %v", got)
+	}
+}
+
+// TestMiddlewareHealthProbeLeases tests that leases without a probe recover through real requests
+func TestMiddlewareHealthProbeLeases(t *testing.T) {
+	config := &MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          50 * time.Millisecond,
+		FailureThreshold: 3,
+		Metrics:          newTestMetrics(),
+		HealthProbe: func(leaseID string) error {
+			t.Errorf("Expected no probe for %s", leaseID)
+			return nil
+		},
+		HealthProbeLeases: func(leaseID string) bool { return leaseID == "probed-lease" },
+	}
+
+	m := NewMiddleware(config)
+
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+	tripBreaker(t, m, ctx, 3)
+
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	time.Sleep(60 * time.Millisecond)
+
+	// The trial request is served and closes the circuit
+	rr := httptest.NewRecorder()
+	wrapped.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the trial request to be served, got %d", rr.Code)
+	}
+	if state := m.GetBreaker("test-lease").State(); state != StateClosed {
+		t.Errorf("Expected closed circuit, got %v", state)
+	}
+}
+
+func TestMiddlewareForceClosed(t *testing.T) {
+	metrics := newTestMetrics()
+	config := &MiddlewareConfig{
+		MaxRequests:       1,
+		Timeout:           time.Minute,
+		FailureThreshold:  3,
+		Metrics:           metrics,
+		ForceClosedLeases: []string{"control-*"},
+	}
+
+	m := NewMiddleware(config)
+
+	// Failures on a force-closed lease pass through and never open its circuit
+	ctx := context.WithValue(context.Background(), "lease_id", "control-plane")
+	tripBreaker(t, m, ctx, 5)
+
+	rr := httptest.NewRecorder()
+	failing := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	failing.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected the upstream error to pass through, got %d", rr.Code)
+	}
+	if _, exists := m.ListBreakers()["control-plane"]; exists {
+		t.Error("Expected no breaker for a force-closed lease")
+	}
+
+	metric := &dto.Metric{}
+	metrics.RequestsTotal.WithLabelValues("control-plane", "failure").Write(metric)
+	if metric.Counter.GetValue() != 6 {
+		t.Errorf("Expected 6 failed requests to be recorded, got %v", metric.Counter.GetValue())
+	}
+
+	// A runtime override takes precedence over the configured patterns
+	m.SetForceClosed("control-plane", false)
+	tripBreaker(t, m, ctx, 3)
+	if state := m.GetBreaker("control-plane").State(); state != StateOpen {
+		t.Errorf("Expected open circuit once the override is lifted, got %v", state)
+	}
+
+	// Forcing an open circuit closed lets requests through again
+	m.SetForceClosed("control-plane", true)
+	rr = httptest.NewRecorder()
+	failing.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("Expected the request to bypass the open circuit, got %d", rr.Code)
+	}
+
+	m.ClearForceClosed("control-plane")
+	if !m.IsForceClosed("control-plane") {
+		t.Error("Expected the configured pattern to apply once the override is cleared")
+	}
+	if m.IsForceClosed("other-lease") {
+		t.Error("Expected other leases to use their breaker")
+	}
+}
+
+func TestMiddlewareServiceFailureThresholds(t *testing.T) {
+	classifier, err := service.NewClassifier([]*service.Rule{{Service: "mcp", Prefix: "mcp-"}}, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	config := &MiddlewareConfig{
+		MaxRequests:              1,
+		Timeout:                  time.Minute,
+		FailureThreshold:         5,
+		ServiceFailureThresholds: map[string]uint32{"mcp": 2},
+		Classifier:               classifier,
+		Metrics:                  newTestMetrics(),
+	}
+
+	m := NewMiddleware(config)
+
+	tripBreaker(t, m, context.WithValue(context.Background(), "lease_id", "mcp-tools"), 2)
+	if state := m.GetBreaker("mcp-tools").State(); state != StateOpen {
+		t.Errorf("Expected the mcp threshold to open the circuit, got %v", state)
+	}
+
+	tripBreaker(t, m, context.WithValue(context.Background(), "lease_id", "billing"), 2)
+	if state := m.GetBreaker("billing").State(); state != StateClosed {
+		t.Errorf("Expected other leases to keep the default threshold, got %v", state)
+	}
+}
+
+func TestMiddlewarePrewarmBreakers(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 1,
+		Metrics:          newTestMetrics(),
+	})
+
+	existing := m.GetBreaker("billing")
+
+	created := m.PrewarmBreakers([]string{"billing", "lease-1", "lease-*", "", "lease-2/search", "lease-2"})
+	if created != 2 {
+		t.Errorf("Expected 2 breakers to be created, got %d", created)
+	}
+
+	breakers := m.ListBreakers()
+	if len(breakers) != 3 {
+		t.Errorf("Expected 3 breakers, got %v", breakers)
+	}
+	if breakers["billing"] != existing {
+		t.Error("Expected an existing breaker to be kept")
+	}
+
+	// A request to a prewarmed lease uses the breaker created ahead of it
+	prewarmed := breakers["lease-1"]
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ctx := context.WithValue(context.Background(), "lease_id", "lease-1")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil).WithContext(ctx))
+
+	if m.GetBreaker("lease-1") != prewarmed || prewarmed.Counts().Requests != 1 {
+		t.Error("Expected the request to use the prewarmed breaker")
+	}
+}
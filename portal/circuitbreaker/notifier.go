@@ -0,0 +1,160 @@
+package circuitbreaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/webhook"
+)
+
+// StateChangeNotifier is notified when a lease's circuit breaker changes state
+// Notify is called asynchronously and may block without delaying requests
+type StateChangeNotifier interface {
+	Notify(leaseID string, from, to State)
+}
+
+// NoopNotifier discards state change notifications
+type NoopNotifier struct{}
+
+// Notify implements StateChangeNotifier
+func (NoopNotifier) Notify(leaseID string, from, to State) {}
+
+// StateChangeEvent is the payload sent by WebhookNotifier
+type StateChangeEvent struct {
+	LeaseID   string    `json:"lease_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookNotifier posts state changes as JSON to a webhook URL
+type WebhookNotifier struct {
+	url     string
+	handler *webhook.RetryHandler
+}
+
+// NewWebhookNotifier creates a notifier that delivers through a retry handler
+// Deliveries that fail after all retries land in the handler's DLQ if configured
+func NewWebhookNotifier(url string, handler *webhook.RetryHandler) *WebhookNotifier {
+	if handler == nil {
+		handler = webhook.NewRetryHandler(nil)
+	}
+
+	return &WebhookNotifier{
+		url:     url,
+		handler: handler,
+	}
+}
+
+// Notify implements StateChangeNotifier
+func (n *WebhookNotifier) Notify(leaseID string, from, to State) {
+	payload, err := json.Marshal(StateChangeEvent{
+		LeaseID:   leaseID,
+		From:      from.String(),
+		To:        to.String(),
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.handler.Do(req)
+	if err != nil {
+		return
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// notifyDispatcher debounces state changes per lease and notifies asynchronously
+// The first change after a quiet period is sent immediately; further changes within
+// the debounce window are collapsed into one trailing notification of the net change
+type notifyDispatcher struct {
+	notifier StateChangeNotifier
+	window   time.Duration
+
+	mu     sync.Mutex
+	leases map[string]*leaseNotifyState
+}
+
+// leaseNotifyState tracks notifications for a single lease
+type leaseNotifyState struct {
+	notified State       // Last state sent to the notifier
+	current  State       // Latest state of the breaker
+	lastSent time.Time   // When the last notification was sent
+	timer    *time.Timer // Pending trailing notification, if any
+}
+
+// newNotifyDispatcher creates a new dispatcher
+func newNotifyDispatcher(notifier StateChangeNotifier, window time.Duration) *notifyDispatcher {
+	return &notifyDispatcher{
+		notifier: notifier,
+		window:   window,
+		leases:   make(map[string]*leaseNotifyState),
+	}
+}
+
+// stateChanged records a state change; it never blocks on the notifier
+func (d *notifyDispatcher) stateChanged(leaseID string, from, to State) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.leases[leaseID]
+	if !ok {
+		s = &leaseNotifyState{notified: from}
+		d.leases[leaseID] = s
+	}
+	s.current = to
+
+	if s.timer != nil {
+		// A trailing notification is already scheduled
+		return
+	}
+
+	sinceLast := time.Since(s.lastSent)
+	if d.window <= 0 || sinceLast >= d.window {
+		d.sendLocked(leaseID, s)
+		return
+	}
+
+	s.timer = time.AfterFunc(d.window-sinceLast, func() {
+		d.flush(leaseID)
+	})
+}
+
+// flush sends the trailing notification for a lease if its state changed on net
+func (d *notifyDispatcher) flush(leaseID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s, ok := d.leases[leaseID]
+	if !ok {
+		return
+	}
+	s.timer = nil
+
+	// A flap that ended where it started is not worth an alert
+	if s.current != s.notified {
+		d.sendLocked(leaseID, s)
+	}
+}
+
+// sendLocked notifies the net change since the last notification; d.mu must be held
+func (d *notifyDispatcher) sendLocked(leaseID string, s *leaseNotifyState) {
+	from, to := s.notified, s.current
+	s.notified = to
+	s.lastSent = time.Now()
+
+	go d.notifier.Notify(leaseID, from, to)
+}
@@ -0,0 +1,159 @@
+package circuitbreaker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/webhook"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// notification is a state change received by recordingNotifier
+type notification struct {
+	leaseID  string
+	from, to State
+}
+
+// recordingNotifier sends every notification to a channel
+type recordingNotifier struct {
+	ch chan notification
+}
+
+func newRecordingNotifier() *recordingNotifier {
+	return &recordingNotifier{ch: make(chan notification, 16)}
+}
+
+func (n *recordingNotifier) Notify(leaseID string, from, to State) {
+	n.ch <- notification{leaseID: leaseID, from: from, to: to}
+}
+
+// expect waits for the next notification and checks it
+func (n *recordingNotifier) expect(t *testing.T, leaseID string, from, to State) {
+	t.Helper()
+
+	select {
+	case got := <-n.ch:
+		want := notification{leaseID: leaseID, from: from, to: to}
+		if got != want {
+			t.Errorf("Expected notification %v, got %v", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Timed out waiting for %s -> %s notification", from, to)
+	}
+}
+
+// expectNone checks that no notification arrives within d
+func (n *recordingNotifier) expectNone(t *testing.T, d time.Duration) {
+	t.Helper()
+
+	select {
+	case got := <-n.ch:
+		t.Errorf("Expected no notification, got %v", got)
+	case <-time.After(d):
+	}
+}
+
+func TestMiddlewareNotifiesStateChange(t *testing.T) {
+	notifier := newRecordingNotifier()
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 2,
+		Metrics:          newTestMetrics(),
+		Notifier:         notifier,
+	})
+
+	ctx := context.WithValue(context.Background(), "lease_id", "notify-lease")
+	tripBreaker(t, m, ctx, 2)
+
+	notifier.expect(t, "notify-lease", StateClosed, StateOpen)
+}
+
+func TestNewMiddlewareDefaultNotifier(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{Metrics: newTestMetrics()})
+
+	if _, ok := m.config.Notifier.(NoopNotifier); !ok {
+		t.Errorf("Expected NoopNotifier by default, got %T", m.config.Notifier)
+	}
+}
+
+func TestNotifyDispatcherDebounce(t *testing.T) {
+	notifier := newRecordingNotifier()
+	window := 100 * time.Millisecond
+	d := newNotifyDispatcher(notifier, window)
+
+	// The first change is sent immediately
+	d.stateChanged("lease", StateClosed, StateOpen)
+	notifier.expect(t, "lease", StateClosed, StateOpen)
+
+	// A flap that ends back in the notified state is suppressed
+	d.stateChanged("lease", StateOpen, StateHalfOpen)
+	d.stateChanged("lease", StateHalfOpen, StateOpen)
+	notifier.expectNone(t, 2*window)
+
+	// After a quiet period the next change is sent immediately and
+	// rapid follow-ups collapse into one trailing notification
+	d.stateChanged("lease", StateOpen, StateHalfOpen)
+	notifier.expect(t, "lease", StateOpen, StateHalfOpen)
+
+	d.stateChanged("lease", StateHalfOpen, StateOpen)
+	d.stateChanged("lease", StateOpen, StateHalfOpen)
+	d.stateChanged("lease", StateHalfOpen, StateClosed)
+	notifier.expect(t, "lease", StateHalfOpen, StateClosed)
+	notifier.expectNone(t, 2*window)
+}
+
+func TestNotifyDispatcherPerLease(t *testing.T) {
+	notifier := newRecordingNotifier()
+	d := newNotifyDispatcher(notifier, time.Minute)
+
+	// Debouncing one lease does not delay another
+	d.stateChanged("lease-a", StateClosed, StateOpen)
+	notifier.expect(t, "lease-a", StateClosed, StateOpen)
+
+	d.stateChanged("lease-b", StateClosed, StateOpen)
+	notifier.expect(t, "lease-b", StateClosed, StateOpen)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	events := make(chan StateChangeEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Expected JSON content type, got %q", r.Header.Get("Content-Type"))
+		}
+
+		var event StateChangeEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Failed to decode event: %v", err)
+		}
+		events <- event
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	handler := webhook.NewRetryHandler(&webhook.RetryConfig{
+		MaxRetries: 1,
+		Metrics:    webhook.NewRetryMetricsWithRegistry(prometheus.NewRegistry()),
+	})
+
+	notifier := NewWebhookNotifier(server.URL, handler)
+	notifier.Notify("webhook-lease", StateClosed, StateOpen)
+
+	select {
+	case event := <-events:
+		if event.LeaseID != "webhook-lease" || event.From != "closed" || event.To != "open" {
+			t.Errorf("Unexpected event: %+v", event)
+		}
+
+		if event.Timestamp.IsZero() {
+			t.Error("Expected event timestamp to be set")
+		}
+	default:
+		t.Fatal("Expected webhook to be called")
+	}
+}
@@ -0,0 +1,254 @@
+package circuitbreaker
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// StaleCacheHeader marks responses served from the stale cache while a circuit is open
+const StaleCacheHeader = "X-From-Cache"
+
+// StaleCacheConfig holds degraded-mode response cache configuration
+type StaleCacheConfig struct {
+	// TTL is how long a stored response may be served while its lease's circuit is open
+	TTL time.Duration
+
+	// MaxEntries bounds the number of cached responses; the least recently used is evicted
+	MaxEntries int
+
+	// MaxBodySize is the largest response body that is cached
+	MaxBodySize int64
+
+	// VaryHeaders are request headers that are part of the cache key
+	// Credentials are included by default so one caller never gets another's response
+	VaryHeaders []string
+
+	// Leases limits caching to these lease IDs (supports wildcards like "docs-*"; empty = all leases)
+	Leases []string
+}
+
+// DefaultStaleCacheConfig returns default stale cache configuration
+func DefaultStaleCacheConfig() *StaleCacheConfig {
+	return &StaleCacheConfig{
+		TTL:         10 * time.Minute,
+		MaxEntries:  1000,
+		MaxBodySize: 1 << 20, // 1 MB
+		VaryHeaders: []string{"Accept", "Accept-Encoding", "Authorization", "X-API-Key"},
+	}
+}
+
+// StaleCache keeps the last successful GET response per lease, path and varying headers,
+// so an open circuit can answer with slightly stale data instead of a 503
+type StaleCache struct {
+	config  *StaleCacheConfig
+	entries map[string]*list.Element
+	order   *list.List // front = most recently used
+	now     func() time.Time
+
+	mu sync.Mutex
+}
+
+type staleCacheEntry struct {
+	key        string
+	statusCode int
+	header     http.Header
+	body       []byte
+	storedAt   time.Time
+}
+
+// NewStaleCache creates a degraded-mode response cache
+func NewStaleCache(config *StaleCacheConfig) *StaleCache {
+	if config == nil {
+		config = DefaultStaleCacheConfig()
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = 10 * time.Minute
+	}
+
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+
+	return &StaleCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// cacheKey returns the cache key for a request, or "" if its response is not cached
+// Only GET requests are cached, since only they can be answered without reaching the upstream
+func (c *StaleCache) cacheKey(leaseID string, r *http.Request) string {
+	if r.Method != http.MethodGet || !c.cachesLease(leaseID) {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(leaseID))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RequestURI()))
+	for _, name := range c.config.VaryHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(r.Header.Values(name), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachesLease reports whether responses for a lease are cached
+func (c *StaleCache) cachesLease(leaseID string) bool {
+	return len(c.config.Leases) == 0 || middleware.MatchAnyLease(c.config.Leases, leaseID)
+}
+
+// get returns the cached response for a key if it has not expired
+func (c *StaleCache) get(key string) (*staleCacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*staleCacheEntry)
+	if c.now().Sub(entry.storedAt) > c.config.TTL {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return entry, true
+}
+
+// store caches a recorded response if it is a complete, successful and storable one
+func (c *StaleCache) store(key string, rec *cacheRecorder) {
+	// A handler that never wrote still sent its header map with an implicit 200
+	if !rec.wroteHeader {
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+
+	if rec.overflow || !cacheableResponse(rec.statusCode, rec.header) {
+		return
+	}
+
+	entry := &staleCacheEntry{
+		key:        key,
+		statusCode: rec.statusCode,
+		header:     rec.header,
+		body:       rec.body.Bytes(),
+		storedAt:   c.now(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+
+	if c.order.Len() > c.config.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*staleCacheEntry).key)
+	}
+}
+
+// cacheableResponse reports whether a response may be replayed to later requests
+// Partial content, per-client cookies and responses marked no-store are never cached
+func cacheableResponse(statusCode int, header http.Header) bool {
+	if statusCode < 200 || statusCode > 299 || statusCode == http.StatusPartialContent {
+		return false
+	}
+
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return false
+		}
+	}
+	return true
+}
+
+// serve writes a cached response marked as stale
+// Headers already set by outer layers for this request, such as its request ID, are kept
+func (e *staleCacheEntry) serve(w http.ResponseWriter) {
+	for key, values := range e.header {
+		if _, exists := w.Header()[key]; !exists {
+			w.Header()[key] = values
+		}
+	}
+	w.Header().Set(StaleCacheHeader, "stale")
+	w.WriteHeader(e.statusCode)
+	w.Write(e.body)
+}
+
+// cacheRecorder copies a response as it is written so it can be cached afterwards
+type cacheRecorder struct {
+	http.ResponseWriter
+	limit       int64
+	statusCode  int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+	overflow    bool
+}
+
+func newCacheRecorder(w http.ResponseWriter, limit int64) *cacheRecorder {
+	return &cacheRecorder{
+		ResponseWriter: w,
+		limit:          limit,
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (rec *cacheRecorder) WriteHeader(code int) {
+	if !rec.wroteHeader && code >= 200 {
+		rec.wroteHeader = true
+		rec.statusCode = code
+		rec.header = rec.ResponseWriter.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	if !rec.overflow {
+		if int64(rec.body.Len()+len(b)) > rec.limit {
+			rec.overflow = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(b)
+		}
+	}
+
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,174 @@
+package circuitbreaker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newStaleCacheMiddleware creates a middleware with a stale cache on a fake clock
+func newStaleCacheMiddleware(config *StaleCacheConfig) (*Middleware, *time.Time) {
+	now := time.Unix(1_700_000_000, 0)
+	cache := NewStaleCache(config)
+	cache.now = func() time.Time { return now }
+
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 3,
+		Metrics:          newTestMetrics(),
+		StaleCache:       cache,
+	})
+	return m, &now
+}
+
+// serveUpstream sends one request through the middleware to a handler answering with the given status
+func serveUpstream(m *Middleware, ctx context.Context, method, path, apiKey string, status int, header http.Header) *httptest.ResponseRecorder {
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, values := range header {
+			w.Header()[key] = values
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"items":[1,2,3]}`))
+	}))
+
+	req := httptest.NewRequest(method, path, nil).WithContext(ctx)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestStaleCacheServedWhenOpen(t *testing.T) {
+	m, _ := newStaleCacheMiddleware(nil)
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+
+	serveUpstream(m, ctx, "GET", "/peer/test-lease/items", "sk_live_a", http.StatusOK, nil)
+	tripBreaker(t, m, ctx, 3)
+
+	rr := serveUpstream(m, ctx, "GET", "/peer/test-lease/items", "sk_live_a", http.StatusOK, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected cached status 200, got %d", rr.Code)
+	}
+	if rr.Header().Get(StaleCacheHeader) != "stale" {
+		t.Errorf("Expected %s: stale, got %q", StaleCacheHeader, rr.Header().Get(StaleCacheHeader))
+	}
+	if rr.Header().Get("Content-Type") != "application/json" || rr.Body.String() != `{"items":[1,2,3]}` {
+		t.Errorf("Expected the cached response, got %q %q", rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+
+	metric := &dto.Metric{}
+	if err := m.config.Metrics.StaleServedTotal.WithLabelValues("test-lease").Write(metric); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	if got := metric.Counter.GetValue(); got != 1 {
+		t.Errorf("Expected 1 stale response served, got %v", got)
+	}
+
+	// Another caller, path or query has no cached response of its own
+	for _, tt := range []struct{ path, apiKey string }{
+		{"/peer/test-lease/items", "sk_live_b"},
+		{"/peer/test-lease/other", "sk_live_a"},
+		{"/peer/test-lease/items?page=2", "sk_live_a"},
+	} {
+		rr := serveUpstream(m, ctx, "GET", tt.path, tt.apiKey, http.StatusOK, nil)
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected 503 for %s with %s, got %d", tt.path, tt.apiKey, rr.Code)
+		}
+	}
+}
+
+func TestStaleCacheOnlyStoresSuccessfulGets(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		status int
+		header http.Header
+	}{
+		{"post", "POST", http.StatusOK, nil},
+		{"client error", "GET", http.StatusNotFound, nil},
+		{"partial content", "GET", http.StatusPartialContent, nil},
+		{"no-store", "GET", http.StatusOK, http.Header{"Cache-Control": {"private, no-store"}}},
+		{"set-cookie", "GET", http.StatusOK, http.Header{"Set-Cookie": {"session=abc"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _ := newStaleCacheMiddleware(nil)
+			ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+
+			serveUpstream(m, ctx, tt.method, "/peer/test-lease/items", "", tt.status, tt.header)
+			tripBreaker(t, m, ctx, 3)
+
+			rr := serveUpstream(m, ctx, tt.method, "/peer/test-lease/items", "", http.StatusOK, nil)
+			if rr.Code != http.StatusServiceUnavailable {
+				t.Errorf("Expected 503 without a cached response, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestStaleCacheExpires(t *testing.T) {
+	m, now := newStaleCacheMiddleware(&StaleCacheConfig{TTL: time.Minute})
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+
+	serveUpstream(m, ctx, "GET", "/peer/test-lease/items", "", http.StatusOK, nil)
+	tripBreaker(t, m, ctx, 3)
+
+	*now = now.Add(2 * time.Minute)
+
+	rr := serveUpstream(m, ctx, "GET", "/peer/test-lease/items", "", http.StatusOK, nil)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the cached response expired, got %d", rr.Code)
+	}
+}
+
+func TestStaleCacheLeases(t *testing.T) {
+	cache := NewStaleCache(&StaleCacheConfig{Leases: []string{"docs-*", "catalog"}})
+
+	tests := []struct {
+		leaseID  string
+		expected bool
+	}{
+		{"docs-api", true},
+		{"catalog", true},
+		{"catalog-v2", false},
+		{"billing", false},
+	}
+
+	for _, tt := range tests {
+		if got := cache.cachesLease(tt.leaseID); got != tt.expected {
+			t.Errorf("cachesLease(%s) = %v, expected %v", tt.leaseID, got, tt.expected)
+		}
+	}
+}
+
+func TestStaleCacheEviction(t *testing.T) {
+	cache := NewStaleCache(&StaleCacheConfig{MaxEntries: 2})
+
+	for _, key := range []string{"a", "b"} {
+		cache.store(key, newCacheRecorder(httptest.NewRecorder(), 1024))
+	}
+
+	// Reading a refreshes it, so adding c evicts b
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	cache.store("c", newCacheRecorder(httptest.NewRecorder(), 1024))
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := cache.get(key); !ok {
+			t.Errorf("Expected %s to be cached", key)
+		}
+	}
+}
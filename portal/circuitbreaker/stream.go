@@ -0,0 +1,55 @@
+package circuitbreaker
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// streamFailureKey is the context key of a request's streamFailure
+type streamFailureKey struct{}
+
+// streamFailure holds the first failure reported for a request after its response started
+type streamFailure struct {
+	mu  sync.Mutex
+	err error
+}
+
+// ReportFailure records that the upstream failed while its response was being written,
+// e.g. the upstream connection dropped mid-stream after a 200 was flushed
+// The status the client saw cannot change, but with DetectStreamFailures the failure counts
+// toward tripping the breaker. It returns false when no breaker is listening for failures
+// of this request. Safe to call from any goroutine; only the first failure is kept
+func ReportFailure(ctx context.Context, err error) bool {
+	failure, ok := ctx.Value(streamFailureKey{}).(*streamFailure)
+	if !ok || err == nil {
+		return false
+	}
+
+	failure.mu.Lock()
+	defer failure.mu.Unlock()
+
+	if failure.err == nil {
+		failure.err = err
+	}
+	return true
+}
+
+// withStreamFailure returns r with a streamFailure handlers can report to
+func withStreamFailure(r *http.Request) (*http.Request, *streamFailure) {
+	failure := &streamFailure{}
+	return r.WithContext(context.WithValue(r.Context(), streamFailureKey{}, failure)), failure
+}
+
+// get returns the reported failure, or nil
+// A failure reported after the client went away is ignored: the upstream request was most
+// likely cancelled along with it, which says nothing about the upstream's health
+func (f *streamFailure) get(r *http.Request) error {
+	if f == nil || r.Context().Err() != nil {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.err
+}
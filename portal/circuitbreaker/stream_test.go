@@ -0,0 +1,98 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// streamingHandler flushes a 200 and then reports an upstream failure
+var streamingHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("data: partial\n\n"))
+	http.NewResponseController(w).Flush()
+	ReportFailure(r.Context(), errors.New("upstream connection reset"))
+})
+
+func TestMiddlewareDetectStreamFailures(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:          1,
+		Timeout:              time.Minute,
+		FailureThreshold:     2,
+		Metrics:              NewMetricsWithRegistry(reg),
+		DetectStreamFailures: true,
+	})
+	wrapped := m.Middleware(streamingHandler)
+
+	ctx := context.WithValue(context.Background(), "lease_id", "stream-lease")
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		wrapped.ServeHTTP(rr, httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected the status already sent to be kept, got %d", rr.Code)
+		}
+	}
+
+	if state := m.GetBreaker("stream-lease").State(); state != StateOpen {
+		t.Errorf("Expected mid-stream failures to trip the breaker, got %s", state)
+	}
+	if got := counterValue(t, reg, "portal_circuit_breaker_stream_failures_total", "lease_id", "stream-lease"); got != 2 {
+		t.Errorf("Expected 2 stream failures, got %v", got)
+	}
+	if got := counterValue(t, reg, "portal_circuit_breaker_requests_total", "result", "failure"); got != 2 {
+		t.Errorf("Expected 2 failed requests, got %v", got)
+	}
+}
+
+func TestMiddlewareStreamFailuresDisabled(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 1,
+		Metrics:          newTestMetrics(),
+	})
+
+	reported := true
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reported = ReportFailure(r.Context(), errors.New("upstream connection reset"))
+	}))
+
+	ctx := context.WithValue(context.Background(), "lease_id", "stream-lease")
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+
+	if reported {
+		t.Error("Expected ReportFailure to report that no breaker is listening")
+	}
+	if state := m.GetBreaker("stream-lease").State(); state != StateClosed {
+		t.Errorf("Expected the breaker to stay closed, got %s", state)
+	}
+}
+
+func TestMiddlewareStreamFailureAfterClientGone(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxRequests:          1,
+		Timeout:              time.Minute,
+		FailureThreshold:     1,
+		Metrics:              newTestMetrics(),
+		DetectStreamFailures: true,
+	})
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "lease_id", "stream-lease"))
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		cancel()
+		ReportFailure(r.Context(), r.Context().Err())
+	}))
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+
+	if state := m.GetBreaker("stream-lease").State(); state != StateClosed {
+		t.Errorf("Expected a client disconnect not to count as an upstream failure, got %s", state)
+	}
+}
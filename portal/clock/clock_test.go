@@ -0,0 +1,89 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeAfter(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	f := NewFake(start)
+
+	ch := f.After(10 * time.Second)
+	f.Advance(9 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("Expected the timer not to fire before it is due")
+	default:
+	}
+
+	f.Advance(time.Second)
+	select {
+	case fired := <-ch:
+		if !fired.Equal(start.Add(10 * time.Second)) {
+			t.Errorf("Expected the timer to fire at its due time, got %v", fired)
+		}
+	default:
+		t.Fatal("Expected the timer to fire once due")
+	}
+
+	if f.Waiters() != 0 {
+		t.Errorf("Expected no pending waiters, got %d", f.Waiters())
+	}
+
+	select {
+	case <-f.After(0):
+	default:
+		t.Error("Expected a zero duration to fire at once")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(time.Unix(1700000000, 0))
+	ticker := f.NewTicker(time.Minute)
+
+	f.Advance(time.Minute)
+	<-ticker.C()
+
+	// Ticks are dropped while one is waiting to be received, like time.Ticker
+	f.Advance(3 * time.Minute)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Error("Expected missed ticks to be dropped")
+	default:
+	}
+
+	ticker.Stop()
+	f.Advance(time.Hour)
+	select {
+	case <-ticker.C():
+		t.Error("Expected a stopped ticker not to tick")
+	default:
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(time.Unix(1700000000, 0))
+
+	done := make(chan struct{})
+	go func() {
+		<-f.After(time.Second)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	<-done
+}
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Real {
+		t.Error("Expected nil to fall back to the real clock")
+	}
+
+	f := NewFake(time.Time{})
+	if Or(f) != f {
+		t.Error("Expected a set clock to be kept")
+	}
+}
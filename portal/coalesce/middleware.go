@@ -0,0 +1,322 @@
+// Package coalesce shares one upstream call between identical concurrent requests, so a
+// stampede on a hot resource reaches the upstream once instead of once per client
+package coalesce
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+)
+
+// CoalescedHeader marks responses copied from another client's upstream call
+const CoalescedHeader = "X-Coalesced"
+
+// Metrics holds request coalescing metrics
+type Metrics struct {
+	RequestsTotal *prometheus.CounterVec
+}
+
+// NewMetrics creates new request coalescing metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new request coalescing metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		RequestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_coalesced_requests_total",
+				Help: "Total number of coalescable requests, by whether they made the upstream call or waited for another's",
+			},
+			[]string{"lease_id", "result"}, // result: "leader", "shared", "unshared"
+		),
+	}
+}
+
+// MiddlewareConfig holds request coalescing configuration
+type MiddlewareConfig struct {
+	// Window is how long after an upstream call starts identical requests may still join it
+	// Later requests make a call of their own, so a slow call never serves stale data for long
+	Window time.Duration
+
+	// MaxBodySize is the largest response body that is shared
+	MaxBodySize int64
+
+	// VaryHeaders are request headers that are part of the coalescing key
+	// Credentials are included by default so one caller never gets another's response
+	VaryHeaders []string
+
+	// Leases limits coalescing to these lease IDs (supports wildcards like "docs-*"; empty = all leases)
+	Leases []string
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+}
+
+// DefaultMiddlewareConfig returns default request coalescing configuration
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{
+		Window:      time.Second,
+		MaxBodySize: 1 << 20, // 1 MB
+		VaryHeaders: []string{"Accept", "Accept-Encoding", "Range", "Authorization", "X-API-Key"},
+	}
+}
+
+// Middleware coalesces identical concurrent GET and HEAD requests per lease
+type Middleware struct {
+	config *MiddlewareConfig
+	group  singleflight.Group
+}
+
+// sharedResponse is a successful upstream response handed to every request that joined its call
+type sharedResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+// NewMiddleware creates a new request coalescing middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	if config.Window <= 0 {
+		config.Window = time.Second
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+
+	// Leaving the headers unset must not let one caller's response reach another
+	if config.VaryHeaders == nil {
+		config.VaryHeaders = DefaultMiddlewareConfig().VaryHeaders
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	return &Middleware{
+		config: config,
+	}
+}
+
+// Middleware returns an http.Handler that lets the first of several identical requests call
+// the upstream while the others wait and receive a copy of its response
+// Only 2xx responses are shared; when the call fails, every waiting request makes its own
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := middleware.GetLeaseID(r.Context())
+		key := m.coalesceKey(leaseID, r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		led := false
+		v, _, _ := m.group.Do(key, func() (interface{}, error) {
+			led = true
+
+			// Stop new requests from joining once the window has passed; a request that
+			// arrives later gets a response from a call that started after it did
+			timer := time.AfterFunc(m.config.Window, func() { m.group.Forget(key) })
+			defer timer.Stop()
+
+			// The first request answers its own client as the response arrives and keeps a copy for the rest
+			tw := &teeWriter{ResponseWriter: w, limit: m.config.MaxBodySize}
+			next.ServeHTTP(tw, r)
+			return m.share(tw, r), nil
+		})
+
+		if led {
+			m.config.Metrics.RequestsTotal.WithLabelValues(leaseID, "leader").Inc()
+			return
+		}
+
+		shared, _ := v.(*sharedResponse)
+		if shared == nil {
+			m.config.Metrics.RequestsTotal.WithLabelValues(leaseID, "unshared").Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.config.Metrics.RequestsTotal.WithLabelValues(leaseID, "shared").Inc()
+		for name, values := range shared.header {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		w.Header().Set(CoalescedHeader, "true")
+		w.WriteHeader(shared.statusCode)
+		if r.Method != http.MethodHead {
+			w.Write(shared.body)
+		}
+	})
+}
+
+// coalesceKey returns the coalescing key for a request, or "" if it is served on its own
+// Only GET and HEAD without a body are coalesced, and never streams, whose clients expect
+// data as it is produced rather than all at once
+func (m *Middleware) coalesceKey(leaseID string, r *http.Request) string {
+	if leaseID == "" || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return ""
+	}
+
+	if r.ContentLength != 0 || len(r.TransferEncoding) > 0 {
+		return ""
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") || r.Header.Get("X-Stream") == "true" {
+		return ""
+	}
+
+	if len(m.config.Leases) > 0 && !middleware.MatchAnyLease(m.config.Leases, leaseID) {
+		return ""
+	}
+
+	h := sha256.New()
+	h.Write([]byte(leaseID))
+	h.Write([]byte{0})
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.RequestURI()))
+	for _, name := range m.config.VaryHeaders {
+		h.Write([]byte{0})
+		h.Write([]byte(strings.Join(r.Header.Values(name), ",")))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// share returns the first request's response for the others to copy, or nil if they must
+// each make their own call
+func (m *Middleware) share(tw *teeWriter, r *http.Request) *sharedResponse {
+	// A client that went away may have cut the upstream call short
+	if tw.overflow || tw.hijacked || r.Context().Err() != nil {
+		return nil
+	}
+
+	if tw.statusCode == 0 {
+		tw.statusCode = http.StatusOK
+		tw.header = tw.Header().Clone()
+	}
+
+	if tw.statusCode < 200 || tw.statusCode > 299 {
+		return nil
+	}
+
+	// Cookies belong to one client, and a response varying on a header outside the key
+	// may differ between the requests that joined
+	if len(tw.header.Values("Set-Cookie")) > 0 || !m.coversVary(tw.header) {
+		return nil
+	}
+
+	return &sharedResponse{
+		statusCode: tw.statusCode,
+		header:     tw.header,
+		body:       tw.body,
+	}
+}
+
+// coversVary reports whether every header a response varies on is part of the key
+func (m *Middleware) coversVary(header http.Header) bool {
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name == "*" || !containsFold(m.config.VaryHeaders, name) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// containsFold reports whether names contains name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// teeWriter passes a response through to the client while keeping a copy of it
+type teeWriter struct {
+	http.ResponseWriter
+	statusCode int
+	header     http.Header
+	body       []byte
+	limit      int64
+	overflow   bool
+	hijacked   bool
+}
+
+func (w *teeWriter) WriteHeader(code int) {
+	if w.statusCode == 0 && code >= 200 {
+		w.statusCode = code
+		w.header = w.Header().Clone()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *teeWriter) Write(b []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.overflow {
+		if int64(len(w.body)+len(b)) > w.limit {
+			w.overflow = true
+			w.body = nil
+		} else {
+			w.body = append(w.body, b...)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so streaming responses still flush
+func (w *teeWriter) Flush() {
+	if w.statusCode == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it
+// A hijacked connection has no response to share
+func (w *teeWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	w.hijacked = true
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *teeWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
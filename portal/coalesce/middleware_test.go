@@ -0,0 +1,270 @@
+package coalesce
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterValue returns the value of a counter series, or 0 if it does not exist
+func counterValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if matchesLabels(metric.GetLabel(), labels) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func matchesLabels(pairs []*dto.LabelPair, labels map[string]string) bool {
+	for _, pair := range pairs {
+		if value, ok := labels[pair.GetName()]; ok && value != pair.GetValue() {
+			return false
+		}
+	}
+	return true
+}
+
+// blockingUpstream answers with a fixed status once released, counting the calls it receives
+type blockingUpstream struct {
+	status  int
+	header  http.Header
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingUpstream(status int) *blockingUpstream {
+	return &blockingUpstream{
+		status:  status,
+		header:  http.Header{},
+		started: make(chan struct{}, 16),
+		release: make(chan struct{}),
+	}
+}
+
+func (u *blockingUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.calls.Add(1)
+	u.started <- struct{}{}
+	<-u.release
+
+	for name, values := range u.header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(u.status)
+	w.Write([]byte("upstream body"))
+}
+
+// serveConcurrently sends n copies of a request once the first has reached the upstream
+func serveConcurrently(handler http.Handler, upstream *blockingUpstream, n int, newRequest func() *http.Request) []*httptest.ResponseRecorder {
+	recorders := make([]*httptest.ResponseRecorder, n)
+	var wg sync.WaitGroup
+	serve := func(i int) {
+		defer wg.Done()
+		recorders[i] = httptest.NewRecorder()
+		handler.ServeHTTP(recorders[i], newRequest())
+	}
+
+	wg.Add(n)
+	go serve(0)
+	<-upstream.started
+	for i := 1; i < n; i++ {
+		go serve(i)
+	}
+
+	// Give the rest time to join the first request's call
+	time.Sleep(50 * time.Millisecond)
+	close(upstream.release)
+	wg.Wait()
+	return recorders
+}
+
+func TestMiddlewareSharesSuccessfulResponse(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMiddleware(&MiddlewareConfig{Window: time.Minute, Metrics: NewMetricsWithRegistry(reg)})
+
+	upstream := newBlockingUpstream(http.StatusOK)
+	upstream.header.Set("Content-Type", "application/json")
+	upstream.header.Set("Vary", "Accept-Encoding")
+	handler := m.Middleware(upstream)
+
+	recorders := serveConcurrently(handler, upstream, 5, func() *http.Request {
+		return httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1/items?page=2", nil)
+	})
+
+	if calls := upstream.calls.Load(); calls != 1 {
+		t.Errorf("Expected identical requests to share 1 upstream call, got %d", calls)
+	}
+
+	coalesced := 0
+	for _, rr := range recorders {
+		if rr.Code != http.StatusOK || rr.Body.String() != "upstream body" {
+			t.Errorf("Expected every request to get the upstream response, got %d %q", rr.Code, rr.Body.String())
+		}
+		if rr.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("Expected upstream headers to be copied, got %q", rr.Header().Get("Content-Type"))
+		}
+		if rr.Header().Get(CoalescedHeader) == "true" {
+			coalesced++
+		}
+	}
+	if coalesced != 4 {
+		t.Errorf("Expected 4 responses marked as coalesced, got %d", coalesced)
+	}
+
+	if got := counterValue(t, reg, "portal_coalesced_requests_total", map[string]string{"lease_id": "lease-1", "result": "shared"}); got != 4 {
+		t.Errorf("Expected 4 shared requests, got %v", got)
+	}
+	if got := counterValue(t, reg, "portal_coalesced_requests_total", map[string]string{"lease_id": "lease-1", "result": "leader"}); got != 1 {
+		t.Errorf("Expected 1 leader request, got %v", got)
+	}
+}
+
+func TestMiddlewareDoesNotShareUnsuccessfulResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+	}{
+		{"server error", http.StatusBadGateway, nil},
+		{"not found", http.StatusNotFound, nil},
+		{"cookie", http.StatusOK, http.Header{"Set-Cookie": {"session=abc"}}},
+		{"vary outside key", http.StatusOK, http.Header{"Vary": {"Accept-Language"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			m := NewMiddleware(&MiddlewareConfig{Window: time.Minute, Metrics: NewMetricsWithRegistry(reg)})
+
+			upstream := newBlockingUpstream(tt.status)
+			for name, values := range tt.header {
+				upstream.header[name] = values
+			}
+			handler := m.Middleware(upstream)
+
+			recorders := serveConcurrently(handler, upstream, 3, func() *http.Request {
+				return httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1/items", nil)
+			})
+
+			// Requests that joined the call make their own once it could not be shared
+			if calls := upstream.calls.Load(); calls != 3 {
+				t.Errorf("Expected every request to call the upstream, got %d calls", calls)
+			}
+			for _, rr := range recorders {
+				if rr.Code != tt.status {
+					t.Errorf("Expected status %d, got %d", tt.status, rr.Code)
+				}
+				if rr.Header().Get(CoalescedHeader) != "" {
+					t.Error("Expected no response to be marked as coalesced")
+				}
+			}
+			if got := counterValue(t, reg, "portal_coalesced_requests_total", map[string]string{"result": "unshared"}); got != 2 {
+				t.Errorf("Expected 2 unshared requests, got %v", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareWindow(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{Window: 5 * time.Millisecond, Metrics: NewMetricsWithRegistry(prometheus.NewRegistry())})
+
+	upstream := newBlockingUpstream(http.StatusOK)
+	handler := m.Middleware(upstream)
+
+	var wg sync.WaitGroup
+	serve := func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1/items", nil))
+	}
+
+	wg.Add(2)
+	go serve()
+	<-upstream.started
+
+	// Once the window has passed, an identical request starts a call of its own
+	time.Sleep(20 * time.Millisecond)
+	go serve()
+	<-upstream.started
+
+	close(upstream.release)
+	wg.Wait()
+
+	if calls := upstream.calls.Load(); calls != 2 {
+		t.Errorf("Expected a request after the window to make its own call, got %d calls", calls)
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		Leases:  []string{"lease-*"},
+		Metrics: NewMetricsWithRegistry(prometheus.NewRegistry()),
+	})
+
+	newRequest := func(method, target string, header map[string]string) *http.Request {
+		r := httptest.NewRequest(method, target, nil)
+		for name, value := range header {
+			r.Header.Set(name, value)
+		}
+		return r
+	}
+
+	base := m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/items", nil))
+	if base == "" {
+		t.Fatal("Expected a GET request to be coalesced")
+	}
+
+	if m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/items", nil)) != base {
+		t.Error("Expected identical requests to share a key")
+	}
+
+	different := map[string]string{
+		"HEAD":          m.coalesceKey("lease-1", newRequest("HEAD", "/peer/lease-1/items", nil)),
+		"query":         m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/items?page=2", nil)),
+		"other lease":   m.coalesceKey("lease-2", newRequest("GET", "/peer/lease-1/items", nil)),
+		"vary header":   m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/items", map[string]string{"Accept": "text/html"})),
+		"other API key": m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/items", map[string]string{"X-API-Key": "other"})),
+	}
+	for name, key := range different {
+		if key == "" || key == base {
+			t.Errorf("Expected %s to get a key of its own", name)
+		}
+	}
+
+	if m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/items", map[string]string{"User-Agent": "curl"})) != base {
+		t.Error("Expected headers outside the key to be ignored")
+	}
+
+	uncoalesced := map[string]string{
+		"POST":           m.coalesceKey("lease-1", newRequest("POST", "/peer/lease-1/items", nil)),
+		"SSE":            m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/events", map[string]string{"Accept": "text/event-stream"})),
+		"stream":         m.coalesceKey("lease-1", newRequest("GET", "/peer/lease-1/events", map[string]string{"X-Stream": "true"})),
+		"unlisted lease": m.coalesceKey("docs", newRequest("GET", "/peer/docs/items", nil)),
+		"no lease":       m.coalesceKey("", newRequest("GET", "/peer/lease-1/items", nil)),
+	}
+	for name, key := range uncoalesced {
+		if key != "" {
+			t.Errorf("Expected %s not to be coalesced", name)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// ACLConfigFile represents the structure of the ACL config file
+type ACLConfigFile struct {
+	AllowLeaseIDHeader bool                  `yaml:"allow_lease_id_header"` // Accept X-Lease-ID when the path has none
+	DefaultAllow       bool                  `yaml:"default_allow"`         // Allow leases without a rule (default false = fail-closed)
+	LogAllowedRules    bool                  `yaml:"log_allowed_rules"`     // Log the rule allowing each request at debug level
+	KeyGroups          map[string][]string   `yaml:"key_groups"`
+	LeaseAliases       map[string]string     `yaml:"lease_aliases"` // old lease ID -> lease ID it was renamed to
+	DefaultRule        *ACLDefaultRuleConfig `yaml:"default_rule"`  // Checked for every lease in addition to its rule
+	Rules              []ACLRuleConfig       `yaml:"rules"`
+}
+
+// ACLDefaultRuleConfig represents the rule applied to every lease in config
+type ACLDefaultRuleConfig struct {
+	DeniedKeyIDs    []string `yaml:"denied_key_ids"`
+	DeniedKeyGroups []string `yaml:"denied_key_groups"`
+	AllowedIPRanges []string `yaml:"allowed_ip_ranges"` // CIDR notation
+}
+
+// ACLRuleConfig represents a single ACL rule in config
+type ACLRuleConfig struct {
+	LeaseID          string   `yaml:"lease_id"`
+	AllowedKeyIDs    []string `yaml:"allowed_key_ids"`
+	AllowedKeyGroups []string `yaml:"allowed_key_groups"`
+	AllowedIPRanges  []string `yaml:"allowed_ip_ranges"` // CIDR notation
+
+	AllowedTimeWindows []TimeWindowConfig `yaml:"allowed_time_windows"`
+	TimeZone           string             `yaml:"time_zone"` // IANA name, default UTC
+
+	ResponseHeaders map[string]string `yaml:"response_headers"` // Values may use {lease_id} and {key_id}
+}
+
+// TimeWindowConfig represents a recurring access window in config
+type TimeWindowConfig struct {
+	Days  []string `yaml:"days"`  // e.g. ["mon", "tue"], empty = every day
+	Start string   `yaml:"start"` // HH:MM
+	End   string   `yaml:"end"`   // HH:MM, before start wraps past midnight
+}
+
+// LoadACLConfig loads ACL rules and key groups from a file
+func LoadACLConfig(filePath string) (*middleware.ACLConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("ACL config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("ACL config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read ACL config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile ACLConfigFile
+	if err := yaml.Unmarshal(data, &configFile); err != nil {
+		return nil, fmt.Errorf("invalid ACL config format: %w", err)
+	}
+
+	config := middleware.NewACLConfig()
+	config.AllowLeaseIDHeader = configFile.AllowLeaseIDHeader
+	config.DefaultAllow = configFile.DefaultAllow
+	config.LogAllowedRules = configFile.LogAllowedRules
+
+	// Add key groups first so rules can be validated against them
+	for name, keyIDs := range configFile.KeyGroups {
+		if err := config.SetKeyGroup(name, keyIDs); err != nil {
+			return nil, fmt.Errorf("failed to add key group %q: %w", name, err)
+		}
+	}
+
+	if defaultRule := configFile.DefaultRule; defaultRule != nil {
+		for _, group := range defaultRule.DeniedKeyGroups {
+			if _, exists := configFile.KeyGroups[group]; !exists {
+				return nil, fmt.Errorf("default rule references unknown key group %q", group)
+			}
+		}
+
+		ipNets, err := middleware.ParseCIDRList(defaultRule.AllowedIPRanges)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range in default rule: %w", err)
+		}
+
+		config.SetDefaultRule(&middleware.ACLDefaultRule{
+			DeniedKeyIDs:    defaultRule.DeniedKeyIDs,
+			DeniedKeyGroups: defaultRule.DeniedKeyGroups,
+			AllowedIPRanges: ipNets,
+		})
+	}
+
+	// Add rules
+	for _, rule := range configFile.Rules {
+		for _, group := range rule.AllowedKeyGroups {
+			if _, exists := configFile.KeyGroups[group]; !exists {
+				return nil, fmt.Errorf("rule for lease %s references unknown key group %q", rule.LeaseID, group)
+			}
+		}
+
+		ipNets, err := middleware.ParseCIDRList(rule.AllowedIPRanges)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP range for lease %s: %w", rule.LeaseID, err)
+		}
+
+		middlewareRule := &middleware.ACLRule{
+			LeaseID:          rule.LeaseID,
+			AllowedKeyIDs:    rule.AllowedKeyIDs,
+			AllowedKeyGroups: rule.AllowedKeyGroups,
+			AllowedIPRanges:  ipNets,
+			ResponseHeaders:  rule.ResponseHeaders,
+		}
+
+		for _, window := range rule.AllowedTimeWindows {
+			timeWindow, err := middleware.ParseTimeWindow(window.Days, window.Start, window.End)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time window for lease %s: %w", rule.LeaseID, err)
+			}
+			middlewareRule.AllowedTimeWindows = append(middlewareRule.AllowedTimeWindows, timeWindow)
+		}
+
+		if rule.TimeZone != "" {
+			loc, err := time.LoadLocation(rule.TimeZone)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time zone for lease %s: %w", rule.LeaseID, err)
+			}
+			middlewareRule.TimeZone = loc
+		}
+
+		if err := config.AddRule(middlewareRule); err != nil {
+			return nil, fmt.Errorf("failed to add rule for lease %s: %w", rule.LeaseID, err)
+		}
+	}
+
+	// Add lease aliases
+	for alias, leaseID := range configFile.LeaseAliases {
+		if err := config.SetLeaseAlias(alias, leaseID); err != nil {
+			return nil, fmt.Errorf("failed to add lease alias %s: %w", alias, err)
+		}
+	}
+
+	return config, nil
+}
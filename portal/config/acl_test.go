@@ -0,0 +1,205 @@
+package config
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadACLConfig tests loading ACL rules and key groups from file
+func TestLoadACLConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "acl.yaml")
+
+	configContent := `allow_lease_id_header: true
+default_allow: true
+log_allowed_rules: true
+key_groups:
+  team-alpha:
+    - "key1"
+    - "key2"
+lease_aliases:
+  old-lease: "lease-001"
+default_rule:
+  denied_key_ids: ["key4"]
+  allowed_ip_ranges: ["10.0.0.0/8", "192.168.0.0/16"]
+rules:
+  - lease_id: "mcp-*"
+    allowed_key_groups:
+      - "team-alpha"
+  - lease_id: "lease-001"
+    allowed_key_ids:
+      - "key3"
+    allowed_ip_ranges:
+      - "10.0.0.0/8"
+    response_headers:
+      X-Tenant-Region: "eu-west-1"
+  - lease_id: "batch-*"
+    allowed_key_ids:
+      - "key1"
+    time_zone: "UTC"
+    allowed_time_windows:
+      - days: ["mon", "tue"]
+        start: "02:00"
+        end: "04:00"
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	config, err := LoadACLConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if !config.AllowLeaseIDHeader {
+		t.Error("Expected AllowLeaseIDHeader to be enabled")
+	}
+
+	if !config.DefaultAllow {
+		t.Error("Expected DefaultAllow to be enabled")
+	}
+
+	if !config.LogAllowedRules {
+		t.Error("Expected LogAllowedRules to be enabled")
+	}
+
+	if got := config.GetKeyGroup("team-alpha"); len(got) != 2 {
+		t.Errorf("Expected 2 members in team-alpha, got %v", got)
+	}
+
+	if len(config.ListRules()) != 3 {
+		t.Errorf("Expected 3 rules, got %d", len(config.ListRules()))
+	}
+
+	batch := config.GetRule("batch-nightly")
+	if batch == nil || len(batch.AllowedTimeWindows) != 1 {
+		t.Fatal("Expected batch rule with one time window")
+	}
+
+	if days, start, end := batch.AllowedTimeWindows[0].Format(); len(days) != 2 || start != "02:00" || end != "04:00" {
+		t.Errorf("Expected [mon tue] 02:00-04:00, got %v %s-%s", days, start, end)
+	}
+
+	if err := config.CheckAccess("mcp-server", "key2", net.ParseIP("192.168.1.1")); err != nil {
+		t.Errorf("Expected group member to have access, got %v", err)
+	}
+
+	if err := config.CheckAccess("lease-001", "key3", net.ParseIP("10.1.2.3")); err != nil {
+		t.Errorf("Expected direct key to have access, got %v", err)
+	}
+
+	if got := config.GetRule("lease-001").ResponseHeaders["X-Tenant-Region"]; got != "eu-west-1" {
+		t.Errorf("Expected X-Tenant-Region response header, got %q", got)
+	}
+
+	if got := config.ResolveLeaseID("old-lease"); got != "lease-001" {
+		t.Errorf("Expected old-lease to resolve to lease-001, got %q", got)
+	}
+
+	if defaultRule := config.GetDefaultRule(); defaultRule == nil || len(defaultRule.AllowedIPRanges) != 2 {
+		t.Fatalf("Expected a default rule with 2 IP ranges, got %+v", defaultRule)
+	}
+
+	if err := config.CheckAccess("unconfigured", "key4", net.ParseIP("10.1.2.3")); err == nil {
+		t.Error("Expected the default rule to deny key4")
+	}
+}
+
+// TestLoadACLConfigErrors tests error handling for invalid ACL configs
+func TestLoadACLConfigErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "unknown key group",
+			content: `rules:
+  - lease_id: "lease-001"
+    allowed_key_groups: ["team-missing"]
+`,
+		},
+		{
+			name: "invalid IP range",
+			content: `rules:
+  - lease_id: "lease-001"
+    allowed_key_ids: ["key1"]
+    allowed_ip_ranges: ["not-a-cidr"]
+`,
+		},
+		{
+			name: "invalid time window",
+			content: `rules:
+  - lease_id: "lease-001"
+    allowed_key_ids: ["key1"]
+    allowed_time_windows:
+      - start: "02:00"
+        end: "26:00"
+`,
+		},
+		{
+			name: "invalid time zone",
+			content: `rules:
+  - lease_id: "lease-001"
+    allowed_key_ids: ["key1"]
+    time_zone: "Mars/Olympus_Mons"
+`,
+		},
+		{
+			name: "default rule unknown key group",
+			content: `default_rule:
+  denied_key_groups: ["team-missing"]
+`,
+		},
+		{
+			name: "default rule invalid IP range",
+			content: `default_rule:
+  allowed_ip_ranges: ["not-a-cidr"]
+`,
+		},
+		{
+			name: "lease alias cycle",
+			content: `lease_aliases:
+  lease-a: "lease-b"
+  lease-b: "lease-a"
+`,
+		},
+		{
+			name: "invalid response header",
+			content: `rules:
+  - lease_id: "lease-001"
+    allowed_key_ids: ["key1"]
+    response_headers:
+      "X Tenant": "eu-west-1"
+`,
+		},
+		{
+			name: "invalid wildcard",
+			content: `rules:
+  - lease_id: "*-lease"
+    allowed_key_ids: ["key1"]
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tmpDir, "acl.yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create config file: %v", err)
+			}
+
+			if _, err := LoadACLConfig(configPath); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+
+	if _, err := LoadACLConfig(filepath.Join(tmpDir, "missing.yaml")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
@@ -7,28 +7,31 @@ import (
 	"sync"
 	"time"
 
-	"gopkg.in/yaml.v3"
-
 	"github.com/portal-project/portal-gateway/portal/middleware"
 )
 
 // AuthConfigFile represents the structure of the auth configuration file
 type AuthConfigFile struct {
-	APIKeys []APIKeyConfig `yaml:"api_keys"`
+	APIKeys       []APIKeyConfig      `yaml:"api_keys"`
+	DefaultScopes []string            `yaml:"default_scopes,omitempty"` // Scopes for keys that list none
+	ScopeInherits map[string][]string `yaml:"scope_inherits,omitempty"` // scope -> scopes it implies
+	GracePeriod   string              `yaml:"grace_period,omitempty"`   // Validity after expires_at, e.g. "24h"
 }
 
 // APIKeyConfig represents a single API key configuration
 type APIKeyConfig struct {
-	KeyID     string   `yaml:"key_id"`
-	Key       string   `yaml:"key"`
-	Scopes    []string `yaml:"scopes"`
-	ExpiresAt string   `yaml:"expires_at,omitempty"` // RFC3339 format
+	KeyID       string   `yaml:"key_id"`
+	Key         string   `yaml:"key"`
+	Scopes      []string `yaml:"scopes"`
+	ExpiresAt   string   `yaml:"expires_at,omitempty"`   // RFC3339 format
+	GracePeriod string   `yaml:"grace_period,omitempty"` // Overrides the global grace period, "0s" disables it
 }
 
 // AuthConfigLoader handles loading and reloading of authentication configuration
 type AuthConfigLoader struct {
 	filePath   string
 	authConfig *middleware.AuthConfig
+	metrics    *ReloadMetrics
 	mu         sync.RWMutex
 }
 
@@ -41,9 +44,19 @@ var (
 
 // NewAuthConfigLoader creates a new configuration loader
 func NewAuthConfigLoader(filePath string) *AuthConfigLoader {
+	return NewAuthConfigLoaderWithMetrics(filePath, nil)
+}
+
+// NewAuthConfigLoaderWithMetrics creates a new configuration loader with custom reload metrics
+func NewAuthConfigLoaderWithMetrics(filePath string, metrics *ReloadMetrics) *AuthConfigLoader {
+	if metrics == nil {
+		metrics = DefaultReloadMetrics
+	}
+
 	return &AuthConfigLoader{
 		filePath:   filePath,
 		authConfig: middleware.NewAuthConfig(),
+		metrics:    metrics,
 	}
 }
 
@@ -65,36 +78,57 @@ func (l *AuthConfigLoader) Load() error {
 
 	// Parse YAML
 	var configFile AuthConfigFile
-	if err := yaml.Unmarshal(data, &configFile); err != nil {
-		return fmt.Errorf("%w: %s", ErrInvalidConfig, err.Error())
+	doc, err := parseYAML(l.filePath, data, &configFile)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	newConfig, err := l.buildAuthConfig(&configFile)
+	if err != nil {
+		return fmt.Errorf("configuration validation failed: %w", locateError(l.filePath, doc, err))
 	}
 
+	// Replace old configuration with new one
+	l.mu.Lock()
+	l.authConfig = newConfig
+	l.mu.Unlock()
+
+	return nil
+}
+
+// buildAuthConfig validates a parsed configuration file and converts it to an auth configuration
+// Errors are returned unwrapped so the caller can locate them before adding context
+func (l *AuthConfigLoader) buildAuthConfig(configFile *AuthConfigFile) (*middleware.AuthConfig, error) {
 	// Validate configuration
-	if err := l.validateConfig(&configFile); err != nil {
-		return fmt.Errorf("configuration validation failed: %w", err)
+	if err := l.validateConfig(configFile); err != nil {
+		return nil, err
 	}
 
 	// Create new auth config
 	newConfig := middleware.NewAuthConfig()
 
+	if configFile.GracePeriod != "" {
+		gracePeriod, err := parseGracePeriod(configFile.GracePeriod)
+		if err != nil {
+			return nil, fieldError("grace_period", "", fmt.Errorf("%w: %v", ErrInvalidConfig, err))
+		}
+		newConfig.GracePeriod = gracePeriod
+	}
+
 	// Parse and add API keys
-	for _, keyConfig := range configFile.APIKeys {
+	for i, keyConfig := range configFile.APIKeys {
 		apiKey, err := l.parseAPIKey(&keyConfig)
 		if err != nil {
-			return fmt.Errorf("failed to parse API key %s: %w", keyConfig.KeyID, err)
+			return nil, fieldError(fmt.Sprintf("api_keys[%d]", i), keyConfig.KeyID, fmt.Errorf("failed to parse API key: %w", err))
 		}
+		apiKey.Scopes = resolveScopes(apiKey.Scopes, configFile.DefaultScopes, configFile.ScopeInherits)
 
 		if err := newConfig.AddAPIKey(apiKey); err != nil {
-			return fmt.Errorf("failed to add API key %s: %w", keyConfig.KeyID, err)
+			return nil, fieldError(fmt.Sprintf("api_keys[%d]", i), keyConfig.KeyID, fmt.Errorf("failed to add API key: %w", err))
 		}
 	}
 
-	// Replace old configuration with new one
-	l.mu.Lock()
-	l.authConfig = newConfig
-	l.mu.Unlock()
-
-	return nil
+	return newConfig, nil
 }
 
 // validateConfig performs validation on the configuration file
@@ -108,25 +142,68 @@ func (l *AuthConfigLoader) validateConfig(config *AuthConfigFile) error {
 	}
 
 	// Check for duplicate key IDs
-	keyIDs := make(map[string]bool)
-	for _, keyConfig := range config.APIKeys {
+	keyIDs := make(map[string]int)
+	for i, keyConfig := range config.APIKeys {
+		path := fmt.Sprintf("api_keys[%d]", i)
 		if keyConfig.KeyID == "" {
-			return errors.New("API key ID cannot be empty")
+			return fieldError(path, "", errors.New("API key ID cannot be empty"))
 		}
 
-		if keyIDs[keyConfig.KeyID] {
-			return fmt.Errorf("duplicate API key ID: %s", keyConfig.KeyID)
+		if first, exists := keyIDs[keyConfig.KeyID]; exists {
+			return fieldError(path, keyConfig.KeyID, fmt.Errorf("duplicate API key ID %s, first used by api_keys[%d]", keyConfig.KeyID, first))
 		}
-		keyIDs[keyConfig.KeyID] = true
+		keyIDs[keyConfig.KeyID] = i
 
 		if keyConfig.Key == "" {
-			return fmt.Errorf("API key value cannot be empty for key ID: %s", keyConfig.KeyID)
+			return fieldError(path, keyConfig.KeyID, fmt.Errorf("API key value cannot be empty for key ID: %s", keyConfig.KeyID))
+		}
+	}
+
+	for scope, implied := range config.ScopeInherits {
+		if scope == "" {
+			return fieldError("scope_inherits", "", errors.New("scope_inherits scope name cannot be empty"))
+		}
+		for _, s := range implied {
+			if s == "" {
+				return fieldError("scope_inherits."+scope, "", fmt.Errorf("scope_inherits entry for %s contains an empty scope", scope))
+			}
 		}
 	}
 
 	return nil
 }
 
+// resolveScopes applies default scopes to keys without explicit ones and expands
+// inherited scopes transitively, so HasScope needs no knowledge of inheritance
+// Cycles are harmless: each scope is only expanded once
+func resolveScopes(scopes, defaults []string, inherits map[string][]string) []string {
+	if len(scopes) == 0 {
+		scopes = defaults
+	}
+
+	resolved := make([]string, 0, len(scopes))
+	seen := make(map[string]bool)
+
+	var add func(scope string)
+	add = func(scope string) {
+		if seen[scope] {
+			return
+		}
+		seen[scope] = true
+		resolved = append(resolved, scope)
+
+		for _, implied := range inherits[scope] {
+			add(implied)
+		}
+	}
+
+	for _, scope := range scopes {
+		add(scope)
+	}
+
+	return resolved
+}
+
 // parseAPIKey converts a configuration API key to a middleware API key
 func (l *AuthConfigLoader) parseAPIKey(config *APIKeyConfig) (*middleware.APIKey, error) {
 	if config == nil {
@@ -148,13 +225,35 @@ func (l *AuthConfigLoader) parseAPIKey(config *APIKeyConfig) (*middleware.APIKey
 		apiKey.ExpiresAt = &expiresAt
 	}
 
+	if config.GracePeriod != "" {
+		gracePeriod, err := parseGracePeriod(config.GracePeriod)
+		if err != nil {
+			return nil, err
+		}
+		apiKey.GracePeriod = &gracePeriod
+	}
+
 	return apiKey, nil
 }
 
+// parseGracePeriod parses a non-negative expiry grace period such as "24h"
+func parseGracePeriod(value string) (time.Duration, error) {
+	gracePeriod, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid grace period %q: %w", value, err)
+	}
+	if gracePeriod < 0 {
+		return 0, fmt.Errorf("invalid grace period %q: must not be negative", value)
+	}
+	return gracePeriod, nil
+}
+
 // Reload reloads the configuration from the file
 // This can be called in response to a SIGHUP signal for zero-downtime config updates
 func (l *AuthConfigLoader) Reload() error {
-	return l.Load()
+	err := l.Load()
+	l.metrics.RecordReload(ConfigTypeAuth, err)
+	return err
 }
 
 // GetAuthConfig returns the current authentication configuration
@@ -0,0 +1,258 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// AuthDirLoader loads API keys from a secrets directory with one file per key
+// The file name is the key ID; the contents are either the key followed by its
+// scopes, one or more per line, or a small YAML document with key, scopes,
+// expires_at and grace_period
+type AuthDirLoader struct {
+	dirPath    string
+	authConfig *middleware.AuthConfig
+	metrics    *ReloadMetrics
+	lastDigest [sha256.Size]byte // Directory contents at the last load attempt
+	stopCh     chan struct{}
+	stopOnce   sync.Once
+	mu         sync.Mutex
+}
+
+// NewAuthDirLoader creates a new secrets directory loader
+func NewAuthDirLoader(dirPath string) *AuthDirLoader {
+	return NewAuthDirLoaderWithMetrics(dirPath, nil)
+}
+
+// NewAuthDirLoaderWithMetrics creates a new secrets directory loader with custom reload metrics
+func NewAuthDirLoaderWithMetrics(dirPath string, metrics *ReloadMetrics) *AuthDirLoader {
+	if metrics == nil {
+		metrics = DefaultReloadMetrics
+	}
+
+	return &AuthDirLoader{
+		dirPath:    dirPath,
+		authConfig: middleware.NewAuthConfig(),
+		metrics:    metrics,
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// Load reads every key file in the directory and replaces the served keys
+// The auth configuration is updated in place, so middleware holding it sees rotated keys
+// On error the previous keys stay active
+func (l *AuthDirLoader) Load() error {
+	if l.dirPath == "" {
+		return errors.New("secrets directory path cannot be empty")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keys, digest, err := readKeyDirectory(l.dirPath)
+	l.lastDigest = digest
+	if err != nil {
+		return err
+	}
+
+	newConfig, err := (&AuthConfigLoader{}).buildAuthConfig(&AuthConfigFile{APIKeys: keys})
+	if err != nil {
+		// Point at the key file rather than the assembled key list
+		var verr *ValidationError
+		if errors.As(err, &verr) && verr.Entry != "" {
+			verr.File = filepath.Join(l.dirPath, verr.Entry)
+			verr.Path, verr.Entry = "", ""
+		}
+		return fmt.Errorf("configuration validation failed: %w", err)
+	}
+
+	l.authConfig.ReplaceAPIKeys(newConfig)
+	return nil
+}
+
+// Reload reloads the keys from the directory and records the outcome
+func (l *AuthDirLoader) Reload() error {
+	err := l.Load()
+	l.metrics.RecordReload(ConfigTypeAuth, err)
+	return err
+}
+
+// GetAuthConfig returns the authentication configuration kept up to date by this loader
+func (l *AuthDirLoader) GetAuthConfig() *middleware.AuthConfig {
+	return l.authConfig
+}
+
+// StartWatching polls the directory and reloads when a key file is added, removed or changed
+func (l *AuthDirLoader) StartWatching(interval time.Duration) {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	go l.watchLoop(interval)
+}
+
+// watchLoop reloads the keys whenever the directory contents change
+func (l *AuthDirLoader) watchLoop(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !l.changed() {
+				continue
+			}
+			if err := l.Reload(); err != nil {
+				logging.Warn("Failed to reload API keys from secrets directory", "path", l.dirPath, "error", err)
+				continue
+			}
+			logging.Info("Reloaded API keys from secrets directory", "path", l.dirPath)
+		case <-l.stopCh:
+			return
+		}
+	}
+}
+
+// changed reports whether the directory differs from the last load attempt
+// A broken directory is therefore retried only once it changes again
+func (l *AuthDirLoader) changed() bool {
+	_, digest, _ := readKeyDirectory(l.dirPath)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return digest != l.lastDigest
+}
+
+// Stop stops watching the directory
+func (l *AuthDirLoader) Stop() {
+	l.stopOnce.Do(func() {
+		close(l.stopCh)
+	})
+}
+
+// LoadFromDirectory is a convenience function that loads API keys from a secrets directory
+func LoadFromDirectory(dirPath string) (*middleware.AuthConfig, error) {
+	loader := NewAuthDirLoader(dirPath)
+	if err := loader.Load(); err != nil {
+		return nil, err
+	}
+	return loader.GetAuthConfig(), nil
+}
+
+// readKeyDirectory parses every key file in a directory, ordered by key ID
+// It also returns a digest of the file names and contents for change detection
+// Hidden entries are skipped, which covers the ..data links Kubernetes adds to secret volumes
+func readKeyDirectory(dirPath string) ([]APIKeyConfig, [sha256.Size]byte, error) {
+	hash := sha256.New()
+	digest := func() (d [sha256.Size]byte) {
+		copy(d[:], hash.Sum(nil))
+		return d
+	}
+
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, digest(), fmt.Errorf("%w: %s", ErrConfigFileNotFound, dirPath)
+		}
+		return nil, digest(), fmt.Errorf("failed to read secrets directory: %w", err)
+	}
+
+	// ReadDir sorts by name, so the digest is stable
+	var keys []APIKeyConfig
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		// Stat follows symlinks, as secret volumes link each key into the current data directory
+		path := filepath.Join(dirPath, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, digest(), fmt.Errorf("failed to stat key file %s: %w", name, err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, digest(), fmt.Errorf("failed to read key file %s: %w", name, err)
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00", name, len(data))
+		hash.Write(data)
+
+		keyConfig, err := parseKeyFile(name, data)
+		if err != nil {
+			return nil, digest(), err
+		}
+		keys = append(keys, keyConfig)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return keys, digest(), nil
+}
+
+// keyFile is the per-file YAML form of a key; the key ID comes from the file name
+type keyFile struct {
+	Key         string   `yaml:"key"`
+	Scopes      []string `yaml:"scopes"`
+	ExpiresAt   string   `yaml:"expires_at,omitempty"`
+	GracePeriod string   `yaml:"grace_period,omitempty"`
+}
+
+// parseKeyFile parses the contents of one key file
+func parseKeyFile(keyID string, data []byte) (APIKeyConfig, error) {
+	// A plain key and scope list is a YAML scalar, so only a mapping with a key selects the YAML form
+	var file keyFile
+	if err := yaml.Unmarshal(data, &file); err == nil && file.Key != "" {
+		return APIKeyConfig{
+			KeyID:       keyID,
+			Key:         file.Key,
+			Scopes:      file.Scopes,
+			ExpiresAt:   file.ExpiresAt,
+			GracePeriod: file.GracePeriod,
+		}, nil
+	}
+
+	keyConfig := APIKeyConfig{KeyID: keyID}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if keyConfig.Key == "" {
+			keyConfig.Key = line
+			continue
+		}
+
+		keyConfig.Scopes = append(keyConfig.Scopes, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		})...)
+	}
+	if err := scanner.Err(); err != nil {
+		return APIKeyConfig{}, fmt.Errorf("failed to parse key file %s: %w", keyID, err)
+	}
+
+	if keyConfig.Key == "" {
+		return APIKeyConfig{}, fmt.Errorf("%w: key file %s is empty", ErrInvalidConfig, keyID)
+	}
+
+	return keyConfig, nil
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writeKeyFile writes one key file into a secrets directory
+func writeKeyFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write key file %s: %v", name, err)
+	}
+}
+
+// TestLoadFromDirectory tests loading plain and YAML key files
+func TestLoadFromDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile(t, dir, "plain", "sk_live_plain1234567890\nread write\nadmin\n")
+	writeKeyFile(t, dir, "commas", "sk_live_commas1234567890\nread, write\n")
+	writeKeyFile(t, dir, "bare", "sk_live_bare1234567890\n")
+	writeKeyFile(t, dir, "structured", `
+key: sk_live_structured1234567890
+scopes: [read]
+expires_at: "2030-01-01T00:00:00Z"
+grace_period: 1h
+`)
+
+	// Hidden entries and directories are not keys
+	writeKeyFile(t, dir, ".hidden", "sk_live_hidden1234567890\n")
+	if err := os.Mkdir(filepath.Join(dir, "..data"), 0700); err != nil {
+		t.Fatalf("Failed to create data directory: %v", err)
+	}
+
+	authConfig, err := LoadFromDirectory(dir)
+	if err != nil {
+		t.Fatalf("LoadFromDirectory failed: %v", err)
+	}
+
+	if len(authConfig.APIKeys) != 4 {
+		t.Fatalf("Expected 4 API keys, got %d", len(authConfig.APIKeys))
+	}
+
+	tests := []struct {
+		keyID  string
+		key    string
+		scopes []string
+	}{
+		{"plain", "sk_live_plain1234567890", []string{"read", "write", "admin"}},
+		{"commas", "sk_live_commas1234567890", []string{"read", "write"}},
+		{"bare", "sk_live_bare1234567890", nil},
+		{"structured", "sk_live_structured1234567890", []string{"read"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keyID, func(t *testing.T) {
+			apiKey, exists := authConfig.APIKeys[tt.keyID]
+			if !exists {
+				t.Fatalf("Expected key %s to be loaded", tt.keyID)
+			}
+			if apiKey.Key != tt.key {
+				t.Errorf("Expected key %q, got %q", tt.key, apiKey.Key)
+			}
+			if strings.Join(apiKey.Scopes, ",") != strings.Join(tt.scopes, ",") {
+				t.Errorf("Expected scopes %v, got %v", tt.scopes, apiKey.Scopes)
+			}
+		})
+	}
+
+	structured := authConfig.APIKeys["structured"]
+	if structured.ExpiresAt == nil || structured.GracePeriod == nil {
+		t.Error("Expected expires_at and grace_period from the YAML key file")
+	}
+}
+
+// TestLoadFromDirectoryErrors tests directories that cannot be loaded
+func TestLoadFromDirectoryErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		files       map[string]string
+		errContains string
+	}{
+		{
+			name:        "empty directory",
+			files:       map[string]string{},
+			errContains: "no API keys configured",
+		},
+		{
+			name:        "empty key file",
+			files:       map[string]string{"key1": "\n# no key yet\n"},
+			errContains: "key file key1 is empty",
+		},
+		{
+			name:        "invalid key format",
+			files:       map[string]string{"key1": "not-a-key\nread\n"},
+			errContains: "invalid API key format",
+		},
+		{
+			name: "duplicate key value",
+			files: map[string]string{
+				"key1": "sk_live_same1234567890\n",
+				"key2": "sk_live_same1234567890\n",
+			},
+			errContains: "already in use",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeKeyFile(t, dir, name, content)
+			}
+
+			_, err := LoadFromDirectory(dir)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.errContains) {
+				t.Errorf("Expected error containing %q, got %v", tt.errContains, err)
+			}
+		})
+	}
+
+	if _, err := LoadFromDirectory(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Expected error for a missing directory")
+	}
+}
+
+// TestAuthDirLoaderRotation tests that reloads update the served configuration in place
+func TestAuthDirLoaderRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile(t, dir, "key1", "sk_live_first1234567890\nread\n")
+	writeKeyFile(t, dir, "key2", "sk_live_second1234567890\nread\n")
+
+	metrics := NewReloadMetricsWithRegistry(prometheus.NewRegistry())
+	loader := NewAuthDirLoaderWithMetrics(dir, metrics)
+	if err := loader.Load(); err != nil {
+		t.Fatalf("Failed to load directory: %v", err)
+	}
+
+	// The middleware keeps this pointer, so it must see every later change
+	authConfig := loader.GetAuthConfig()
+
+	if loader.changed() {
+		t.Error("Expected no change right after loading")
+	}
+
+	// Rotate key1, remove key2 and add key3
+	writeKeyFile(t, dir, "key1", "sk_live_rotated1234567890\nread\n")
+	if err := os.Remove(filepath.Join(dir, "key2")); err != nil {
+		t.Fatalf("Failed to remove key file: %v", err)
+	}
+	writeKeyFile(t, dir, "key3", "sk_live_third1234567890\nwrite\n")
+
+	if !loader.changed() {
+		t.Fatal("Expected the directory change to be detected")
+	}
+	if err := loader.Reload(); err != nil {
+		t.Fatalf("Failed to reload directory: %v", err)
+	}
+
+	if got := authConfig.APIKeys["key1"]; got == nil || got.Key != "sk_live_rotated1234567890" {
+		t.Errorf("Expected key1 to be rotated, got %+v", got)
+	}
+	if _, exists := authConfig.APIKeys["key2"]; exists {
+		t.Error("Expected key2 to be removed")
+	}
+	if _, exists := authConfig.APIKeys["key3"]; !exists {
+		t.Error("Expected key3 to be added")
+	}
+
+	// A broken key file keeps the previous keys and is not retried until it changes
+	writeKeyFile(t, dir, "key4", "not-a-key\n")
+	if err := loader.Reload(); err == nil {
+		t.Fatal("Expected reload of an invalid key file to fail")
+	}
+	if len(authConfig.APIKeys) != 2 {
+		t.Errorf("Expected the previous 2 keys to remain, got %d", len(authConfig.APIKeys))
+	}
+	if loader.changed() {
+		t.Error("Expected an unchanged broken directory not to be reloaded again")
+	}
+
+	if got := metricValue(t, metrics.ReloadsTotal.WithLabelValues(ConfigTypeAuth, "success")); got != 1 {
+		t.Errorf("Expected 1 successful reload, got %v", got)
+	}
+	if got := metricValue(t, metrics.ReloadsTotal.WithLabelValues(ConfigTypeAuth, "failure")); got != 1 {
+		t.Errorf("Expected 1 failed reload, got %v", got)
+	}
+}
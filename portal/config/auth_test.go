@@ -6,6 +6,10 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // TestNewAuthConfigLoader tests creating a new configuration loader
@@ -225,6 +229,136 @@ api_keys:
 	}
 }
 
+// TestLoadDefaultScopesAndInheritance tests default scopes and scope inheritance
+func TestLoadDefaultScopesAndInheritance(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configData := `
+default_scopes:
+  - "read"
+scope_inherits:
+  admin: ["write", "metrics"]
+  write: ["read"]
+api_keys:
+  - key_id: "default_key"
+    key: "sk_live_default0000000000"
+  - key_id: "writer_key"
+    key: "sk_live_writer00000000000"
+    scopes:
+      - "write"
+  - key_id: "admin_key"
+    key: "sk_live_admin000000000000"
+    scopes:
+      - "admin"
+`
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	tests := []struct {
+		keyID  string
+		scopes []string
+	}{
+		{"default_key", []string{"read"}},
+		{"writer_key", []string{"write", "read"}},
+		{"admin_key", []string{"admin", "write", "read", "metrics"}},
+	}
+
+	for _, tt := range tests {
+		key := config.APIKeys[tt.keyID]
+		if key == nil {
+			t.Fatalf("Key %s not loaded", tt.keyID)
+		}
+
+		if strings.Join(key.Scopes, ",") != strings.Join(tt.scopes, ",") {
+			t.Errorf("Key %s: expected scopes %v, got %v", tt.keyID, tt.scopes, key.Scopes)
+		}
+	}
+
+	info := &middleware.APIKeyInfo{Scopes: config.APIKeys["admin_key"].Scopes}
+	if !info.HasScope("read") {
+		t.Error("Expected admin key to have inherited read scope")
+	}
+}
+
+// TestLoadGracePeriod tests global and per-key expiry grace periods
+func TestLoadGracePeriod(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	configData := `
+grace_period: "24h"
+api_keys:
+  - key_id: "default_grace"
+    key: "sk_live_defaultgrace00000"
+  - key_id: "short_grace"
+    key: "sk_live_shortgrace0000000"
+    grace_period: "1h"
+  - key_id: "no_grace"
+    key: "sk_live_nograce000000000"
+    grace_period: "0s"
+`
+
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	if err := os.WriteFile(configPath, []byte(configData), 0600); err != nil {
+		t.Fatalf("Failed to create test config file: %v", err)
+	}
+
+	config, err := LoadFromFile(configPath)
+	if err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+
+	if config.GracePeriod != 24*time.Hour {
+		t.Errorf("Expected global grace period 24h, got %v", config.GracePeriod)
+	}
+
+	if key := config.APIKeys["default_grace"]; key.GracePeriod != nil {
+		t.Errorf("Expected default_grace to use the global grace period, got %v", *key.GracePeriod)
+	}
+
+	tests := []struct {
+		keyID       string
+		gracePeriod time.Duration
+	}{
+		{"short_grace", time.Hour},
+		{"no_grace", 0},
+	}
+
+	for _, tt := range tests {
+		key := config.APIKeys[tt.keyID]
+		if key.GracePeriod == nil || *key.GracePeriod != tt.gracePeriod {
+			t.Errorf("Key %s: expected grace period %v, got %v", tt.keyID, tt.gracePeriod, key.GracePeriod)
+		}
+	}
+
+	// Negative and malformed durations are rejected
+	for _, value := range []string{"-1h", "soon"} {
+		if _, err := parseGracePeriod(value); err == nil {
+			t.Errorf("Expected error for grace period %q", value)
+		}
+	}
+}
+
+// TestResolveScopesCycle tests that inheritance cycles terminate
+func TestResolveScopesCycle(t *testing.T) {
+	inherits := map[string][]string{
+		"a": {"b"},
+		"b": {"a", "c"},
+	}
+
+	got := resolveScopes([]string{"a"}, nil, inherits)
+	if strings.Join(got, ",") != "a,b,c" {
+		t.Errorf("Expected scopes [a b c], got %v", got)
+	}
+}
+
 // TestLoadFromEnv tests loading configuration from environment variable
 func TestLoadFromEnv(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -532,3 +666,71 @@ func TestGetAuthConfig(t *testing.T) {
 		t.Error("Expected same config instance")
 	}
 }
+
+// TestReloadMetrics tests that reload attempts and successes are recorded
+func TestReloadMetrics(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "reload-metrics.yaml")
+
+	validConfig := `
+api_keys:
+  - key_id: "key_1"
+    key: "sk_live_metrics1234567890"
+    scopes:
+      - "read"
+`
+
+	if err := os.WriteFile(configPath, []byte(validConfig), 0600); err != nil {
+		t.Fatalf("Failed to create config: %v", err)
+	}
+
+	metrics := NewReloadMetricsWithRegistry(prometheus.NewRegistry())
+	loader := NewAuthConfigLoaderWithMetrics(configPath, metrics)
+
+	before := time.Now().Unix()
+	if err := loader.Reload(); err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte("invalid: [yaml"), 0600); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+
+	if err := loader.Reload(); err == nil {
+		t.Fatal("Expected reload of invalid config to fail")
+	}
+
+	if got := metricValue(t, metrics.ReloadsTotal.WithLabelValues(ConfigTypeAuth, "success")); got != 1 {
+		t.Errorf("Expected 1 successful reload, got %v", got)
+	}
+
+	if got := metricValue(t, metrics.ReloadsTotal.WithLabelValues(ConfigTypeAuth, "failure")); got != 1 {
+		t.Errorf("Expected 1 failed reload, got %v", got)
+	}
+
+	// The failed reload must not move the last success timestamp
+	if got := metricValue(t, metrics.LastSuccessTimestamp.WithLabelValues(ConfigTypeAuth)); got < float64(before) {
+		t.Errorf("Expected last success timestamp >= %d, got %v", before, got)
+	}
+
+	// The previous configuration stays active after a failed reload
+	if _, exists := loader.GetAuthConfig().APIKeys["key_1"]; !exists {
+		t.Error("Expected previous configuration to remain after failed reload")
+	}
+}
+
+// metricValue returns the value of a counter or gauge
+func metricValue(t *testing.T, c prometheus.Metric) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+
+	if m.Counter != nil {
+		return m.Counter.GetValue()
+	}
+
+	return m.Gauge.GetValue()
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/portal-project/portal-gateway/portal/bandwidth"
+)
+
+// BandwidthConfigFile represents the structure of the bandwidth limit config file
+type BandwidthConfigFile struct {
+	Leases []BandwidthRule `yaml:"leases"`
+}
+
+// BandwidthRule represents a single lease's bandwidth limits in config
+type BandwidthRule struct {
+	LeaseID                string `yaml:"lease_id"`
+	ResponseBytesPerSecond int64  `yaml:"response_bytes_per_second"`
+	RequestBytesPerSecond  int64  `yaml:"request_bytes_per_second"`
+	BurstBytes             int64  `yaml:"burst_bytes"`
+}
+
+// LoadBandwidthConfig loads per-lease bandwidth limits from a file
+func LoadBandwidthConfig(filePath string) (*bandwidth.MiddlewareConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("bandwidth config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("bandwidth config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read bandwidth config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile BandwidthConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bandwidth config format: %w", err)
+	}
+
+	config := bandwidth.DefaultMiddlewareConfig()
+
+	leaseIDs := make(map[string]int)
+	for i, rule := range configFile.Leases {
+		path := fmt.Sprintf("leases[%d]", i)
+		if first, exists := leaseIDs[rule.LeaseID]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("duplicate lease ID, first defined by leases[%d]", first)))
+		}
+		leaseIDs[rule.LeaseID] = i
+
+		err := config.AddLimit(&bandwidth.Limit{
+			LeaseID:                rule.LeaseID,
+			ResponseBytesPerSecond: rule.ResponseBytesPerSecond,
+			RequestBytesPerSecond:  rule.RequestBytesPerSecond,
+			BurstBytes:             rule.BurstBytes,
+		})
+		if err != nil {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, err))
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/bandwidth"
+)
+
+// TestLoadBandwidthConfig tests loading per-lease bandwidth limits from file
+func TestLoadBandwidthConfig(t *testing.T) {
+	path := writeConfigFile(t, "bandwidth.yaml", `leases:
+  - lease_id: "free-*"
+    response_bytes_per_second: 1048576
+  - lease_id: "uploads"
+    request_bytes_per_second: 262144
+    burst_bytes: 1048576
+`)
+
+	config, err := LoadBandwidthConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	limit := config.GetLimit("free-tier")
+	if limit == nil || limit.ResponseBytesPerSecond != 1048576 || limit.RequestBytesPerSecond != 0 {
+		t.Errorf("Expected a response limit for free-tier, got %+v", limit)
+	}
+	if limit := config.GetLimit("uploads"); limit == nil || limit.RequestBytesPerSecond != 262144 || limit.BurstBytes != 1048576 {
+		t.Errorf("Expected a request limit for uploads, got %+v", limit)
+	}
+	if config.GetLimit("other") != nil {
+		t.Error("Expected no limit for other")
+	}
+}
+
+// TestLoadBandwidthConfigInvalidLimit tests that a lease entry without a rate is reported with its location
+func TestLoadBandwidthConfigInvalidLimit(t *testing.T) {
+	path := writeConfigFile(t, "bandwidth.yaml", `leases:
+  - lease_id: "free-*"
+    response_bytes_per_second: 1048576
+  - lease_id: "uploads"
+    burst_bytes: 1048576
+`)
+
+	_, err := LoadBandwidthConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, bandwidth.ErrInvalidLimit) {
+		t.Errorf("Expected ErrInvalidLimit, got %v", err)
+	}
+	if verr.Path != "leases[1]" || verr.Line != 4 {
+		t.Errorf("Expected leases[1] at line 4, got %s at line %d", verr.Path, verr.Line)
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/portal-project/portal-gateway/portal/contentroute"
+)
+
+// ContentRouteConfigFile represents the structure of the content type routing config file
+type ContentRouteConfigFile struct {
+	Leases []ContentRouteRule `yaml:"leases"`
+}
+
+// ContentRouteRule represents a single lease's ordered content type routes in config
+type ContentRouteRule struct {
+	LeaseID string              `yaml:"lease_id"`
+	Routes  []ContentRouteEntry `yaml:"routes"`
+}
+
+// ContentRouteEntry represents a single content type route in config
+type ContentRouteEntry struct {
+	ContentType string `yaml:"content_type"`
+	Upstream    string `yaml:"upstream"`
+}
+
+// LoadContentRouteConfig loads per-lease content type routes from a file
+func LoadContentRouteConfig(filePath string) (*contentroute.MiddlewareConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("content route config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("content route config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read content route config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile ContentRouteConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid content route config format: %w", err)
+	}
+
+	config := contentroute.DefaultMiddlewareConfig()
+
+	leaseIDs := make(map[string]int)
+	for i, rule := range configFile.Leases {
+		path := fmt.Sprintf("leases[%d]", i)
+		if first, exists := leaseIDs[rule.LeaseID]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("duplicate lease ID, first defined by leases[%d]", first)))
+		}
+		leaseIDs[rule.LeaseID] = i
+
+		routes := make([]contentroute.Route, len(rule.Routes))
+		for j, route := range rule.Routes {
+			routes[j] = contentroute.Route{ContentType: route.ContentType, Upstream: route.Upstream}
+		}
+
+		if err := config.AddRule(&contentroute.Rule{LeaseID: rule.LeaseID, Routes: routes}); err != nil {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, err))
+		}
+	}
+
+	return config, nil
+}
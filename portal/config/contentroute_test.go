@@ -0,0 +1,80 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/contentroute"
+)
+
+// TestLoadContentRouteConfig tests loading per-lease content type routes from file
+func TestLoadContentRouteConfig(t *testing.T) {
+	path := writeConfigFile(t, "content-route.yaml", `leases:
+  - lease_id: "api-*"
+    routes:
+      - content_type: "application/grpc-web*"
+        upstream: "grpc"
+      - content_type: "application/json"
+        upstream: "json"
+`)
+
+	config, err := LoadContentRouteConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rule := config.GetRule("api-1")
+	if rule == nil || len(rule.Routes) != 2 {
+		t.Fatalf("Expected two routes for api-1, got %+v", rule)
+	}
+	if upstream, ok := rule.Match("application/grpc-web+proto"); !ok || upstream != "grpc" {
+		t.Errorf("Expected the first route to match, got %q", upstream)
+	}
+	if config.GetRule("other") != nil {
+		t.Error("Expected no routes for other")
+	}
+}
+
+// TestLoadContentRouteConfigInvalidRoute tests that a route without an upstream is reported with its location
+func TestLoadContentRouteConfigInvalidRoute(t *testing.T) {
+	path := writeConfigFile(t, "content-route.yaml", `leases:
+  - lease_id: "api-*"
+    routes:
+      - content_type: "application/json"
+        upstream: "json"
+  - lease_id: "uploads"
+    routes:
+      - content_type: "multipart/form-data"
+`)
+
+	_, err := LoadContentRouteConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, contentroute.ErrInvalidRoute) {
+		t.Errorf("Expected ErrInvalidRoute, got %v", err)
+	}
+	if verr.Path != "leases[1]" || verr.Line != 6 {
+		t.Errorf("Expected leases[1] at line 6, got %s at line %d", verr.Path, verr.Line)
+	}
+}
+
+// TestLoadContentRouteConfigDuplicateLeaseID tests error handling for duplicate lease IDs
+func TestLoadContentRouteConfigDuplicateLeaseID(t *testing.T) {
+	path := writeConfigFile(t, "content-route.yaml", `leases:
+  - lease_id: "api-*"
+    routes:
+      - content_type: "application/json"
+        upstream: "json"
+  - lease_id: "api-*"
+    routes:
+      - content_type: "application/xml"
+        upstream: "xml"
+`)
+
+	_, err := LoadContentRouteConfig(path)
+	verr := requireValidationError(t, err)
+
+	if verr.Path != "leases[1]" {
+		t.Errorf("Expected leases[1], got %s", verr.Path)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/portal-project/portal-gateway/portal/forward"
+)
+
+// ForwardConfigFile represents the structure of the request header forwarding config file
+type ForwardConfigFile struct {
+	Leases []ForwardRule `yaml:"leases"`
+}
+
+// ForwardRule represents a single lease's header forwarding rules in config
+type ForwardRule struct {
+	LeaseID string   `yaml:"lease_id"`
+	Allow   []string `yaml:"allow"`
+	Deny    []string `yaml:"deny"`
+}
+
+// LoadForwardConfig loads request header forwarding configuration from a file
+func LoadForwardConfig(filePath string) (*forward.MiddlewareConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("forward config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("forward config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read forward config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile ForwardConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid forward config format: %w", err)
+	}
+
+	config := forward.DefaultMiddlewareConfig()
+
+	leaseIDs := make(map[string]int)
+	for i, rule := range configFile.Leases {
+		path := fmt.Sprintf("leases[%d]", i)
+		if first, exists := leaseIDs[rule.LeaseID]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("duplicate lease ID, first defined by leases[%d]", first)))
+		}
+		leaseIDs[rule.LeaseID] = i
+
+		err := config.AddPolicy(&forward.Policy{
+			LeaseID: rule.LeaseID,
+			Allow:   rule.Allow,
+			Deny:    rule.Deny,
+		})
+		if err != nil {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, err))
+		}
+	}
+
+	return config, nil
+}
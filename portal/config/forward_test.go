@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/forward"
+)
+
+// TestLoadForwardConfig tests loading request header forwarding configuration from file
+func TestLoadForwardConfig(t *testing.T) {
+	path := writeConfigFile(t, "forward.yaml", `leases:
+  - lease_id: "legacy-*"
+    allow: [accept, content-type]
+  - lease_id: "billing"
+    deny: [X-Debug]
+`)
+
+	config, err := LoadForwardConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	policy := config.GetPolicy("legacy-crm")
+	if policy == nil || len(policy.Allow) != 2 || policy.Allow[1] != "Content-Type" {
+		t.Errorf("Expected a canonicalized allow list for legacy-crm, got %+v", policy)
+	}
+	if policy := config.GetPolicy("billing"); policy == nil || len(policy.Deny) != 1 {
+		t.Errorf("Expected a deny list for billing, got %+v", policy)
+	}
+	if config.GetPolicy("other") != nil {
+		t.Error("Expected no policy for other")
+	}
+}
+
+// TestLoadForwardConfigHopHeader tests that allowing a hop-by-hop header names its lease entry
+func TestLoadForwardConfigHopHeader(t *testing.T) {
+	path := writeConfigFile(t, "forward.yaml", `leases:
+  - lease_id: "billing"
+    deny: [X-Debug]
+  - lease_id: "legacy-*"
+    allow: [Accept, Transfer-Encoding]
+`)
+
+	_, err := LoadForwardConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, forward.ErrHopHeader) {
+		t.Errorf("Expected ErrHopHeader, got %v", err)
+	}
+	if verr.Path != "leases[1]" || verr.Line != 4 {
+		t.Errorf("Expected leases[1] at line 4, got %s at line %d", verr.Path, verr.Line)
+	}
+}
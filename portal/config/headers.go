@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/portal-project/portal-gateway/portal/headers"
+)
+
+// HeadersConfigFile represents the structure of the response headers config file
+type HeadersConfigFile struct {
+	Headers map[string]string `yaml:"headers"`
+	Force   bool              `yaml:"force"`
+}
+
+// LoadHeadersConfig loads response header injection configuration from a file
+func LoadHeadersConfig(filePath string) (*headers.MiddlewareConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("headers config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("headers config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read headers config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile HeadersConfigFile
+	if err := yaml.Unmarshal(data, &configFile); err != nil {
+		return nil, fmt.Errorf("invalid headers config format: %w", err)
+	}
+
+	for name := range configFile.Headers {
+		if name == "" {
+			return nil, errors.New("header name cannot be empty")
+		}
+	}
+
+	// No headers listed means the default security headers
+	return &headers.MiddlewareConfig{
+		Headers: configFile.Headers,
+		Force:   configFile.Force,
+	}, nil
+}
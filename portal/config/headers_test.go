@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestLoadHeadersConfig tests loading response header configuration from file
+func TestLoadHeadersConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "headers.yaml")
+
+	configContent := `force: true
+headers:
+  X-Frame-Options: "SAMEORIGIN"
+  Server: "edge"
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	config, err := LoadHeadersConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if !config.Force {
+		t.Error("Expected Force to be true")
+	}
+
+	if len(config.Headers) != 2 {
+		t.Errorf("Expected 2 headers, got %d", len(config.Headers))
+	}
+
+	if config.Headers["X-Frame-Options"] != "SAMEORIGIN" {
+		t.Errorf("Expected X-Frame-Options SAMEORIGIN, got %q", config.Headers["X-Frame-Options"])
+	}
+}
+
+// TestLoadHeadersConfigErrors tests error handling for invalid header configs
+func TestLoadHeadersConfigErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	if _, err := LoadHeadersConfig(""); err == nil {
+		t.Error("Expected error for empty path")
+	}
+
+	if _, err := LoadHeadersConfig(filepath.Join(tmpDir, "missing.yaml")); err == nil {
+		t.Error("Expected error for missing file")
+	}
+
+	invalidPath := filepath.Join(tmpDir, "invalid.yaml")
+	if err := os.WriteFile(invalidPath, []byte("headers: [not, a, map]"), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	if _, err := LoadHeadersConfig(invalidPath); err == nil {
+		t.Error("Expected error for invalid format")
+	}
+}
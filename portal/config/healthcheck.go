@@ -0,0 +1,77 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/healthcheck"
+)
+
+// HealthCheckConfigFile represents the structure of the upstream health check config file
+type HealthCheckConfigFile struct {
+	Leases []HealthCheckRule `yaml:"leases"`
+}
+
+// HealthCheckRule represents a single lease upstream health check in config
+type HealthCheckRule struct {
+	LeaseID          string        `yaml:"lease_id"`
+	URL              string        `yaml:"url"`
+	Path             string        `yaml:"path"`
+	Interval         time.Duration `yaml:"interval"`
+	Timeout          time.Duration `yaml:"timeout"`
+	ExpectedStatus   int           `yaml:"expected_status"`
+	FailureThreshold int           `yaml:"failure_threshold"`
+	GateReadiness    bool          `yaml:"gate_readiness"`
+}
+
+// LoadHealthCheckConfig loads upstream health check configuration from a file
+func LoadHealthCheckConfig(filePath string) (*healthcheck.Config, error) {
+	if filePath == "" {
+		return nil, errors.New("health check config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("health check config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read health check config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile HealthCheckConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid health check config format: %w", err)
+	}
+
+	config := healthcheck.DefaultConfig()
+
+	leaseIDs := make(map[string]int)
+	for i, rule := range configFile.Leases {
+		path := fmt.Sprintf("leases[%d]", i)
+		if first, exists := leaseIDs[rule.LeaseID]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("duplicate lease ID, first defined by leases[%d]", first)))
+		}
+		leaseIDs[rule.LeaseID] = i
+
+		check := &healthcheck.Check{
+			LeaseID:          rule.LeaseID,
+			URL:              rule.URL,
+			Path:             rule.Path,
+			Interval:         rule.Interval,
+			Timeout:          rule.Timeout,
+			ExpectedStatus:   rule.ExpectedStatus,
+			FailureThreshold: rule.FailureThreshold,
+			GateReadiness:    rule.GateReadiness,
+		}
+		if err := config.AddCheck(check); err != nil {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, err))
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/healthcheck"
+)
+
+// TestLoadHealthCheckConfig tests loading upstream health check configuration from file
+func TestLoadHealthCheckConfig(t *testing.T) {
+	path := writeConfigFile(t, "health-checks.yaml", `leases:
+  - lease_id: "billing"
+    url: "http://billing.internal:8080"
+    path: "/healthz"
+    interval: 5s
+    timeout: 1s
+    expected_status: 204
+    failure_threshold: 3
+    gate_readiness: true
+  - lease_id: "search"
+    url: "https://search.internal"
+`)
+
+	config, err := LoadHealthCheckConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	check := config.GetCheck("billing")
+	if check == nil {
+		t.Fatal("Expected a billing check")
+	}
+	if check.Path != "/healthz" || check.Interval != 5*time.Second || check.Timeout != time.Second ||
+		check.ExpectedStatus != 204 || check.FailureThreshold != 3 || !check.GateReadiness {
+		t.Errorf("Unexpected billing check: %+v", check)
+	}
+
+	// Unset fields keep their defaults
+	check = config.GetCheck("search")
+	if check == nil || check.Path != "/health" || check.Interval != 10*time.Second || check.GateReadiness {
+		t.Errorf("Expected search check with defaults, got %+v", check)
+	}
+}
+
+// TestLoadHealthCheckConfigInvalidURL tests that a relative URL names its lease entry
+func TestLoadHealthCheckConfigInvalidURL(t *testing.T) {
+	path := writeConfigFile(t, "health-checks.yaml", `leases:
+  - lease_id: "billing"
+    url: "http://billing.internal:8080"
+  - lease_id: "search"
+    url: "search.internal"
+`)
+
+	_, err := LoadHealthCheckConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, healthcheck.ErrInvalidCheckURL) {
+		t.Errorf("Expected ErrInvalidCheckURL, got %v", err)
+	}
+	if verr.Path != "leases[1]" || verr.Entry != "search" || verr.Line != 4 {
+		t.Errorf("Expected leases[1] (search) at line 4, got %s (%s) at line %d", verr.Path, verr.Entry, verr.Line)
+	}
+}
+
+// TestLoadHealthCheckConfigDuplicateLease tests that a lease can only be checked once
+func TestLoadHealthCheckConfigDuplicateLease(t *testing.T) {
+	path := writeConfigFile(t, "health-checks.yaml", `leases:
+  - lease_id: "billing"
+    url: "http://billing-a.internal"
+  - lease_id: "billing"
+    url: "http://billing-b.internal"
+`)
+
+	_, err := LoadHealthCheckConfig(path)
+	verr := requireValidationError(t, err)
+
+	if verr.Path != "leases[1]" {
+		t.Errorf("Expected leases[1], got %s", verr.Path)
+	}
+}
@@ -4,24 +4,25 @@ import (
 	"errors"
 	"fmt"
 	"os"
-
-	"gopkg.in/yaml.v3"
+	"time"
 
 	"github.com/portal-project/portal-gateway/portal/middleware"
 )
 
 // LeaseRateLimitConfigFile represents the structure of the lease rate limit config file
 type LeaseRateLimitConfigFile struct {
-	DefaultRate  float64                 `yaml:"default_rate"`
-	DefaultBurst int                     `yaml:"default_burst"`
-	Leases       []LeaseRateLimitRule    `yaml:"leases"`
+	DefaultRate  float64              `yaml:"default_rate"`
+	DefaultBurst int                  `yaml:"default_burst"`
+	MaxWait      time.Duration        `yaml:"max_wait"`
+	Leases       []LeaseRateLimitRule `yaml:"leases"`
 }
 
 // LeaseRateLimitRule represents a single lease rate limit rule in config
 type LeaseRateLimitRule struct {
-	LeaseID           string  `yaml:"lease_id"`
-	RequestsPerSecond float64 `yaml:"requests_per_second"`
-	BurstSize         int     `yaml:"burst_size"`
+	LeaseID           string        `yaml:"lease_id"`
+	RequestsPerSecond float64       `yaml:"requests_per_second"`
+	BurstSize         int           `yaml:"burst_size"`
+	MaxWait           time.Duration `yaml:"max_wait"`
 }
 
 // LoadLeaseRateLimitConfig loads lease rate limit configuration from a file
@@ -41,23 +42,37 @@ func LoadLeaseRateLimitConfig(filePath string) (*middleware.LeaseRateLimitConfig
 
 	// Parse YAML
 	var configFile LeaseRateLimitConfigFile
-	if err := yaml.Unmarshal(data, &configFile); err != nil {
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
 		return nil, fmt.Errorf("invalid lease rate limit config format: %w", err)
 	}
 
 	// Create configuration
 	config := middleware.NewLeaseRateLimitConfig(configFile.DefaultRate, configFile.DefaultBurst)
 
+	if configFile.MaxWait < 0 {
+		return nil, locateError(filePath, doc, fieldError("max_wait", "", errors.New("max_wait cannot be negative")))
+	}
+	config.MaxWait = configFile.MaxWait
+
 	// Add lease-specific rules
-	for _, rule := range configFile.Leases {
+	leaseIDs := make(map[string]int)
+	for i, rule := range configFile.Leases {
+		path := fmt.Sprintf("leases[%d]", i)
+		if first, exists := leaseIDs[rule.LeaseID]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("%w, first defined by leases[%d]", middleware.ErrLeaseRuleDuplicate, first)))
+		}
+		leaseIDs[rule.LeaseID] = i
+
 		middlewareRule := &middleware.LeaseRateLimitRule{
 			LeaseID:           rule.LeaseID,
 			RequestsPerSecond: rule.RequestsPerSecond,
 			BurstSize:         rule.BurstSize,
+			MaxWait:           rule.MaxWait,
 		}
 
 		if err := config.AddRule(middlewareRule); err != nil {
-			return nil, fmt.Errorf("failed to add rule for lease %s: %w", rule.LeaseID, err)
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("failed to add rule: %w", err)))
 		}
 	}
 
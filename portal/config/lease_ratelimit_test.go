@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/portal-project/portal-gateway/portal/middleware"
 )
@@ -16,10 +17,12 @@ func TestLoadLeaseRateLimitConfig(t *testing.T) {
 
 	configContent := `default_rate: 50.0
 default_burst: 100
+max_wait: 250ms
 leases:
   - lease_id: "mcp-*"
     requests_per_second: 50.0
     burst_size: 100
+    max_wait: 2s
   - lease_id: "n8n-*"
     requests_per_second: 200.0
     burst_size: 400
@@ -47,6 +50,14 @@ leases:
 		t.Errorf("Expected DefaultBurst 100, got %d", config.DefaultBurst)
 	}
 
+	if config.MaxWait != 250*time.Millisecond {
+		t.Errorf("Expected MaxWait 250ms, got %v", config.MaxWait)
+	}
+
+	if got := config.GetMaxWait("mcp-server-1"); got != 2*time.Second {
+		t.Errorf("Expected mcp-* MaxWait 2s, got %v", got)
+	}
+
 	// Verify rules are loaded
 	rules := config.ListRules()
 	if len(rules) != 3 {
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Config types used as the "config" metric label
+const (
+	ConfigTypeAuth = "auth"
+)
+
+// ReloadMetrics holds configuration reload metrics
+type ReloadMetrics struct {
+	ReloadsTotal         *prometheus.CounterVec
+	LastSuccessTimestamp *prometheus.GaugeVec
+}
+
+// NewReloadMetrics creates new reload metrics using the default registry
+func NewReloadMetrics() *ReloadMetrics {
+	return NewReloadMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewReloadMetricsWithRegistry creates new reload metrics with a custom registry
+func NewReloadMetricsWithRegistry(reg prometheus.Registerer) *ReloadMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &ReloadMetrics{
+		ReloadsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_config_reloads_total",
+				Help: "Total number of configuration reload attempts",
+			},
+			[]string{"config", "result"}, // result: "success", "failure"
+		),
+		LastSuccessTimestamp: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "portal_config_last_reload_success_timestamp_seconds",
+				Help: "Unix timestamp of the last successful configuration reload",
+			},
+			[]string{"config"},
+		),
+	}
+}
+
+// DefaultReloadMetrics is the default global reload metrics instance
+var DefaultReloadMetrics = NewReloadMetrics()
+
+// RecordReload records the outcome of a reload of the given config type
+func (m *ReloadMetrics) RecordReload(configType string, err error) {
+	if err != nil {
+		m.ReloadsTotal.WithLabelValues(configType, "failure").Inc()
+		return
+	}
+
+	m.ReloadsTotal.WithLabelValues(configType, "success").Inc()
+	m.LastSuccessTimestamp.WithLabelValues(configType).Set(float64(time.Now().Unix()))
+}
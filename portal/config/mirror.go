@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/portal-project/portal-gateway/portal/mirror"
+)
+
+// MirrorConfigFile represents the structure of the request mirroring config file
+type MirrorConfigFile struct {
+	Timeout     time.Duration `yaml:"timeout"`
+	MaxBodySize int64         `yaml:"max_body_size"`
+	MaxInFlight int           `yaml:"max_in_flight"`
+	Mirrors     []MirrorRule  `yaml:"mirrors"`
+}
+
+// MirrorRule represents a single mirror rule in config
+type MirrorRule struct {
+	LeaseID string `yaml:"lease_id"`
+	URL     string `yaml:"url"`
+}
+
+// LoadMirrorConfig loads request mirroring configuration from a file
+func LoadMirrorConfig(filePath string) (*mirror.MiddlewareConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("mirror config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("mirror config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read mirror config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile MirrorConfigFile
+	if err := yaml.Unmarshal(data, &configFile); err != nil {
+		return nil, fmt.Errorf("invalid mirror config format: %w", err)
+	}
+
+	if configFile.Timeout < 0 {
+		return nil, errors.New("timeout cannot be negative")
+	}
+	if configFile.MaxBodySize < 0 {
+		return nil, errors.New("max_body_size cannot be negative")
+	}
+	if configFile.MaxInFlight < 0 {
+		return nil, errors.New("max_in_flight cannot be negative")
+	}
+
+	// Unset values keep their defaults
+	config := mirror.DefaultMiddlewareConfig()
+	if configFile.Timeout > 0 {
+		config.Timeout = configFile.Timeout
+	}
+	if configFile.MaxBodySize > 0 {
+		config.MaxBodySize = configFile.MaxBodySize
+	}
+	if configFile.MaxInFlight > 0 {
+		config.MaxInFlight = configFile.MaxInFlight
+	}
+
+	for _, rule := range configFile.Mirrors {
+		if err := config.AddRule(&mirror.Rule{LeaseID: rule.LeaseID, URL: rule.URL}); err != nil {
+			return nil, fmt.Errorf("failed to add mirror for lease %s: %w", rule.LeaseID, err)
+		}
+	}
+
+	return config, nil
+}
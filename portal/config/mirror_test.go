@@ -0,0 +1,68 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestLoadMirrorConfig tests loading request mirroring configuration from file
+func TestLoadMirrorConfig(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "mirror.yaml")
+
+	configContent := `timeout: 2s
+max_in_flight: 10
+mirrors:
+  - lease_id: "mcp-*"
+    url: "http://shadow.internal:8080"
+  - lease_id: "n8n-prod"
+    url: "https://staging.example.com/n8n"
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	config, err := LoadMirrorConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.Timeout != 2*time.Second {
+		t.Errorf("Expected Timeout 2s, got %v", config.Timeout)
+	}
+	if config.MaxInFlight != 10 {
+		t.Errorf("Expected MaxInFlight 10, got %d", config.MaxInFlight)
+	}
+	if config.MaxBodySize != 1<<20 {
+		t.Errorf("Expected default MaxBodySize, got %d", config.MaxBodySize)
+	}
+
+	if rule := config.GetRule("mcp-server-1"); rule == nil || rule.URL != "http://shadow.internal:8080" {
+		t.Errorf("Expected mcp-* mirror, got %v", rule)
+	}
+	if rule := config.GetRule("n8n-dev"); rule != nil {
+		t.Errorf("Expected no mirror for n8n-dev, got %v", rule)
+	}
+}
+
+// TestLoadMirrorConfigInvalidURL tests that a relative mirror URL is rejected
+func TestLoadMirrorConfigInvalidURL(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "mirror.yaml")
+
+	configContent := `mirrors:
+  - lease_id: "mcp-*"
+    url: "shadow.internal:8080"
+`
+
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create config file: %v", err)
+	}
+
+	if _, err := LoadMirrorConfig(configPath); err == nil {
+		t.Error("Expected error for relative mirror URL")
+	}
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/portal-project/portal-gateway/portal/plugin"
+)
+
+// PluginConfigFile represents the structure of the plugin middleware config file
+type PluginConfigFile struct {
+	Middlewares []PluginPlacement `yaml:"middlewares"`
+}
+
+// PluginPlacement represents a single registered middleware placed in the /peer chain
+type PluginPlacement struct {
+	Name    string            `yaml:"name"`
+	Before  string            `yaml:"before"`
+	After   string            `yaml:"after"`
+	Options map[string]string `yaml:"options"`
+}
+
+// LoadPluginConfig loads the placements of registered plugin middlewares from a file
+// Middlewares must be registered before the file is loaded, so unknown names are reported
+func LoadPluginConfig(filePath string) ([]*plugin.Placement, error) {
+	if filePath == "" {
+		return nil, errors.New("plugin config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("plugin config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read plugin config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile PluginConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid plugin config format: %w", err)
+	}
+
+	placements := make([]*plugin.Placement, 0, len(configFile.Middlewares))
+	for i, entry := range configFile.Middlewares {
+		placement := &plugin.Placement{
+			Name:    entry.Name,
+			Before:  entry.Before,
+			After:   entry.After,
+			Options: entry.Options,
+		}
+		if err := placement.Validate(); err != nil {
+			return nil, locateError(filePath, doc, fieldError(fmt.Sprintf("middlewares[%d]", i), entry.Name, err))
+		}
+		placements = append(placements, placement)
+	}
+
+	return placements, nil
+}
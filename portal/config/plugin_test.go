@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/plugin"
+)
+
+func init() {
+	plugin.Register(plugin.Registration{
+		Name: "config-test-lease",
+		Factory: func(options map[string]string) (plugin.Middleware, error) {
+			return func(next http.Handler) http.Handler { return next }, nil
+		},
+		RequiresLease: true,
+	})
+}
+
+// TestLoadPluginConfig tests loading plugin placements from file
+func TestLoadPluginConfig(t *testing.T) {
+	path := writeConfigFile(t, "plugins.yaml", `middlewares:
+  - name: config-test-lease
+    after: acl
+    options:
+      header: X-Tenant
+  - name: config-test-lease
+    before: handler
+`)
+
+	placements, err := LoadPluginConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(placements) != 2 {
+		t.Fatalf("Expected 2 placements, got %d", len(placements))
+	}
+	if p := placements[0]; p.After != "acl" || p.Options["header"] != "X-Tenant" {
+		t.Errorf("Expected the first placement after acl with its options, got %+v", p)
+	}
+	if p := placements[1]; p.Before != "handler" {
+		t.Errorf("Expected the second placement before handler, got %+v", p)
+	}
+}
+
+// TestLoadPluginConfigInvalidPlacement tests that a placement breaking the built-in ordering names its entry
+func TestLoadPluginConfigInvalidPlacement(t *testing.T) {
+	path := writeConfigFile(t, "plugins.yaml", `middlewares:
+  - name: config-test-lease
+    after: acl
+  - name: config-test-lease
+    before: acl
+`)
+
+	_, err := LoadPluginConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, plugin.ErrInvalidPlacement) {
+		t.Errorf("Expected ErrInvalidPlacement, got %v", err)
+	}
+	if verr.Path != "middlewares[1]" || verr.Entry != "config-test-lease" || verr.Line != 4 {
+		t.Errorf("Expected middlewares[1] (config-test-lease) at line 4, got %s (%s) at line %d", verr.Path, verr.Entry, verr.Line)
+	}
+}
+
+// TestLoadPluginConfigUnknownPlugin tests that unregistered middleware names are rejected
+func TestLoadPluginConfigUnknownPlugin(t *testing.T) {
+	path := writeConfigFile(t, "plugins.yaml", `middlewares:
+  - name: header-normalize
+    before: auth
+`)
+
+	if _, err := LoadPluginConfig(path); !errors.Is(err, plugin.ErrUnknownPlugin) {
+		t.Errorf("Expected ErrUnknownPlugin, got %v", err)
+	}
+}
@@ -6,18 +6,20 @@ import (
 	"os"
 	"strings"
 
-	"gopkg.in/yaml.v3"
-
 	"github.com/portal-project/portal-gateway/portal/quota"
+	"github.com/portal-project/portal-gateway/portal/startup"
 )
 
 // QuotaConfigFile represents the structure of the quota config file
 type QuotaConfigFile struct {
-	DefaultMonthlyRequests        int64           `yaml:"default_monthly_requests"`
-	DefaultMonthlyBytes           int64           `yaml:"default_monthly_bytes"`
-	DefaultConcurrentConnections  int             `yaml:"default_concurrent_connections"`
-	Storage                       StorageConfig   `yaml:"storage"`
-	Quotas                        []QuotaRule     `yaml:"quotas"`
+	DefaultMonthlyRequests       int64         `yaml:"default_monthly_requests"`
+	DefaultMonthlyBytes          int64         `yaml:"default_monthly_bytes"`
+	DefaultConcurrentConnections int           `yaml:"default_concurrent_connections"`
+	DefaultPeriod                string        `yaml:"default_period"`
+	ByteAccounting               string        `yaml:"byte_accounting"`
+	StreamAccounting             string        `yaml:"stream_accounting"`
+	Storage                      StorageConfig `yaml:"storage"`
+	Quotas                       []QuotaRule   `yaml:"quotas"`
 }
 
 // StorageConfig represents storage configuration
@@ -32,10 +34,18 @@ type QuotaRule struct {
 	MonthlyRequests       int64  `yaml:"monthly_requests"`
 	MonthlyBytes          int64  `yaml:"monthly_bytes"`
 	ConcurrentConnections int    `yaml:"concurrent_connections"`
+	Period                string `yaml:"period"`
+	RolloverPercent       int    `yaml:"rollover_percent"`
 }
 
 // LoadQuotaConfig loads quota configuration from a file
 func LoadQuotaConfig(filePath string) (*quota.Manager, error) {
+	return LoadQuotaConfigWithRetry(filePath, startup.Retry{})
+}
+
+// LoadQuotaConfigWithRetry loads quota configuration from a file, retrying the storage open
+// so a database on a volume that is not mounted yet does not fail startup
+func LoadQuotaConfigWithRetry(filePath string, retry startup.Retry) (*quota.Manager, error) {
 	if filePath == "" {
 		return nil, errors.New("quota config file path cannot be empty")
 	}
@@ -51,7 +61,8 @@ func LoadQuotaConfig(filePath string) (*quota.Manager, error) {
 
 	// Parse YAML
 	var configFile QuotaConfigFile
-	if err := yaml.Unmarshal(data, &configFile); err != nil {
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
 		return nil, fmt.Errorf("invalid quota config format: %w", err)
 	}
 
@@ -60,14 +71,36 @@ func LoadQuotaConfig(filePath string) (*quota.Manager, error) {
 		configFile.Storage.Type = "sqlite"
 	}
 	if configFile.Storage.Type != "sqlite" {
-		return nil, fmt.Errorf("unsupported storage type: %s (only 'sqlite' is supported)", configFile.Storage.Type)
+		return nil, locateError(filePath, doc, fieldError("storage.type", "", fmt.Errorf("unsupported storage type: %s (only 'sqlite' is supported)", configFile.Storage.Type)))
 	}
 	if configFile.Storage.Path == "" {
-		return nil, errors.New("storage path cannot be empty")
+		return nil, locateError(filePath, doc, fieldError("storage", "", errors.New("storage path cannot be empty")))
+	}
+
+	// Validate default period
+	defaultPeriod, err := quota.ParsePeriod(configFile.DefaultPeriod)
+	if err != nil {
+		return nil, locateError(filePath, doc, fieldError("default_period", "", fmt.Errorf("invalid default_period: %w", err)))
+	}
+
+	// Validate byte accounting mode
+	byteAccounting, err := quota.ParseByteAccounting(configFile.ByteAccounting)
+	if err != nil {
+		return nil, locateError(filePath, doc, fieldError("byte_accounting", "", fmt.Errorf("invalid byte_accounting: %w", err)))
+	}
+
+	// Validate stream accounting mode
+	streamAccounting, err := quota.ParseStreamAccounting(configFile.StreamAccounting)
+	if err != nil {
+		return nil, locateError(filePath, doc, fieldError("stream_accounting", "", fmt.Errorf("invalid stream_accounting: %w", err)))
 	}
 
 	// Create storage
-	storage, err := quota.NewSQLiteStorage(configFile.Storage.Path)
+	var storage *quota.SQLiteStorage
+	err = retry.Do("quota storage", func() (err error) {
+		storage, err = quota.NewSQLiteStorage(configFile.Storage.Path)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage: %w", err)
 	}
@@ -79,20 +112,25 @@ func LoadQuotaConfig(filePath string) (*quota.Manager, error) {
 		configFile.DefaultMonthlyBytes,
 		configFile.DefaultConcurrentConnections,
 	)
+	manager.SetDefaultPeriod(defaultPeriod)
+	manager.SetByteAccounting(byteAccounting)
+	manager.SetStreamAccounting(streamAccounting)
 
 	// Add quota rules
-	for _, rule := range configFile.Quotas {
+	for i, rule := range configFile.Quotas {
 		limit := &quota.QuotaLimit{
 			KeyID:                 rule.KeyID,
 			MonthlyRequestLimit:   rule.MonthlyRequests,
 			MonthlyBytesLimit:     rule.MonthlyBytes,
 			ConcurrentConnections: rule.ConcurrentConnections,
+			Period:                rule.Period,
+			RolloverPercent:       rule.RolloverPercent,
 		}
 
 		if err := manager.SetLimit(limit); err != nil {
 			// Clean up on error
 			storage.Close()
-			return nil, fmt.Errorf("failed to set quota limit for key %s: %w", rule.KeyID, err)
+			return nil, locateError(filePath, doc, fieldError(fmt.Sprintf("quotas[%d]", i), rule.KeyID, fmt.Errorf("failed to set quota limit: %w", err)))
 		}
 	}
 
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/portal-project/portal-gateway/portal/rewrite"
+)
+
+// RewriteConfigFile represents the structure of the request/response rewrite config file
+type RewriteConfigFile struct {
+	Leases []RewriteRule `yaml:"leases"`
+}
+
+// RewriteRule represents a single lease's rewrite rules in config
+type RewriteRule struct {
+	LeaseID       string            `yaml:"lease_id"`
+	Request       HeaderRewrite     `yaml:"request"`
+	Response      HeaderRewrite     `yaml:"response"`
+	RedirectHosts map[string]string `yaml:"redirect_hosts"`
+}
+
+// HeaderRewrite represents header edits in config
+type HeaderRewrite struct {
+	Set    map[string]string `yaml:"set"`
+	Remove []string          `yaml:"remove"`
+	Rename map[string]string `yaml:"rename"`
+}
+
+// LoadRewriteConfig loads request/response rewrite configuration from a file
+func LoadRewriteConfig(filePath string) (*rewrite.MiddlewareConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("rewrite config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("rewrite config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read rewrite config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile RewriteConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rewrite config format: %w", err)
+	}
+
+	config := rewrite.DefaultMiddlewareConfig()
+
+	leaseIDs := make(map[string]int)
+	for i, rule := range configFile.Leases {
+		path := fmt.Sprintf("leases[%d]", i)
+		if first, exists := leaseIDs[rule.LeaseID]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("duplicate lease ID, first defined by leases[%d]", first)))
+		}
+		leaseIDs[rule.LeaseID] = i
+
+		err := config.AddRule(&rewrite.Rule{
+			LeaseID:       rule.LeaseID,
+			Request:       rewrite.HeaderRules(rule.Request),
+			Response:      rewrite.HeaderRules(rule.Response),
+			RedirectHosts: rule.RedirectHosts,
+		})
+		if err != nil {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, err))
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/rewrite"
+)
+
+// TestLoadRewriteConfig tests loading request/response rewrite configuration from file
+func TestLoadRewriteConfig(t *testing.T) {
+	path := writeConfigFile(t, "rewrite.yaml", `leases:
+  - lease_id: "legacy-*"
+    request:
+      remove: [X-Debug]
+    response:
+      remove: [X-Internal-Trace]
+      rename:
+        X-Backend-Version: X-Api-Version
+    redirect_hosts:
+      "backend.internal:8080": "api.example.com"
+`)
+
+	config, err := LoadRewriteConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	hook := config.GetHook("legacy-crm")
+	if hook == nil {
+		t.Fatal("Expected a hook for legacy-crm")
+	}
+	if config.GetHook("other") != nil {
+		t.Error("Expected no hook for other")
+	}
+
+	header := http.Header{}
+	header.Set("X-Internal-Trace", "node-7")
+	header.Set("X-Backend-Version", "42")
+	header.Set("Location", "http://backend.internal:8080/items")
+	hook.RewriteResponse(httptest.NewRequest("GET", "/peer/legacy-crm", nil), http.StatusFound, header)
+
+	if header.Get("X-Internal-Trace") != "" || header.Get("X-Api-Version") != "42" {
+		t.Errorf("Expected response header rules to apply, got %v", header)
+	}
+	if got := header.Get("Location"); got != "http://api.example.com/items" {
+		t.Errorf("Expected rewritten Location, got %q", got)
+	}
+}
+
+// TestLoadRewriteConfigInvalidHeader tests that an invalid header name names its lease entry
+func TestLoadRewriteConfigInvalidHeader(t *testing.T) {
+	path := writeConfigFile(t, "rewrite.yaml", `leases:
+  - lease_id: "legacy-*"
+    response:
+      remove: ["X-Debug:"]
+`)
+
+	_, err := LoadRewriteConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, rewrite.ErrInvalidHeaderName) {
+		t.Errorf("Expected ErrInvalidHeaderName, got %v", err)
+	}
+	if verr.Path != "leases[0]" || verr.Line != 2 {
+		t.Errorf("Expected leases[0] at line 2, got %s at line %d", verr.Path, verr.Line)
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/service"
+)
+
+// ServiceConfigFile represents the structure of the lease classification config file
+type ServiceConfigFile struct {
+	Default  string            `yaml:"default"`
+	Rules    []ServiceRule     `yaml:"rules"`
+	Services []ServiceSettings `yaml:"services"`
+}
+
+// ServiceRule represents a single lease-to-service rule in config
+type ServiceRule struct {
+	Service string `yaml:"service"`
+	Prefix  string `yaml:"prefix"`
+	Pattern string `yaml:"pattern"`
+}
+
+// ServiceSettings represents per-service settings in config
+type ServiceSettings struct {
+	Name             string        `yaml:"name"`
+	Timeout          time.Duration `yaml:"timeout"`
+	FailureThreshold uint32        `yaml:"failure_threshold"`
+}
+
+// LoadServiceConfig loads lease classification configuration from a file
+func LoadServiceConfig(filePath string) (*service.Config, error) {
+	if filePath == "" {
+		return nil, errors.New("service config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("service config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read service config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile ServiceConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service config format: %w", err)
+	}
+
+	rules := make([]*service.Rule, 0, len(configFile.Rules))
+	for i, rule := range configFile.Rules {
+		rule := &service.Rule{Service: rule.Service, Prefix: rule.Prefix, Pattern: rule.Pattern}
+
+		// Validate each rule on its own so errors point at the entry
+		if _, err := service.NewClassifier([]*service.Rule{rule}, configFile.Default); err != nil {
+			return nil, locateError(filePath, doc, fieldError(fmt.Sprintf("rules[%d]", i), rule.Service, err))
+		}
+		rules = append(rules, rule)
+	}
+
+	classifier, err := service.NewClassifier(rules, configFile.Default)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &service.Config{
+		Classifier:        classifier,
+		Timeouts:          make(map[string]time.Duration),
+		FailureThresholds: make(map[string]uint32),
+	}
+
+	known := classifier.Services()
+	names := make(map[string]int)
+	for i, settings := range configFile.Services {
+		path := fmt.Sprintf("services[%d]", i)
+		if first, exists := names[settings.Name]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, settings.Name, fmt.Errorf("duplicate service, first defined by services[%d]", first)))
+		}
+		names[settings.Name] = i
+
+		if !slices.Contains(known, settings.Name) {
+			return nil, locateError(filePath, doc, fieldError(path, settings.Name, errors.New("no rule classifies leases as this service")))
+		}
+
+		if settings.Timeout < 0 {
+			return nil, locateError(filePath, doc, fieldError(path, settings.Name, errors.New("timeout cannot be negative")))
+		}
+
+		if settings.Timeout > 0 {
+			config.Timeouts[settings.Name] = settings.Timeout
+		}
+		if settings.FailureThreshold > 0 {
+			config.FailureThresholds[settings.Name] = settings.FailureThreshold
+		}
+	}
+
+	return config, nil
+}
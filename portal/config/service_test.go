@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/service"
+)
+
+// TestLoadServiceConfig tests loading lease classification configuration from file
+func TestLoadServiceConfig(t *testing.T) {
+	path := writeConfigFile(t, "services.yaml", `default: other
+rules:
+  - service: mcp
+    prefix: "mcp-"
+  - service: openai
+    pattern: "^(openai|gpt)-"
+services:
+  - name: mcp
+    timeout: 10s
+    failure_threshold: 3
+  - name: other
+    timeout: 45s
+`)
+
+	config, err := LoadServiceConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if got := config.Classifier.Classify("gpt-relay"); got != "openai" {
+		t.Errorf("Expected gpt-relay to be openai, got %s", got)
+	}
+	if got := config.Classifier.Classify("billing"); got != "other" {
+		t.Errorf("Expected billing to be other, got %s", got)
+	}
+
+	if config.Timeouts["mcp"] != 10*time.Second || config.Timeouts["other"] != 45*time.Second {
+		t.Errorf("Unexpected timeouts %v", config.Timeouts)
+	}
+	if _, exists := config.Timeouts["openai"]; exists {
+		t.Error("Expected no timeout for a service without settings")
+	}
+	if config.FailureThresholds["mcp"] != 3 || len(config.FailureThresholds) != 1 {
+		t.Errorf("Unexpected failure thresholds %v", config.FailureThresholds)
+	}
+}
+
+// TestLoadServiceConfigInvalidRule tests that an invalid rule names its entry
+func TestLoadServiceConfigInvalidRule(t *testing.T) {
+	path := writeConfigFile(t, "services.yaml", `rules:
+  - service: mcp
+    prefix: "mcp-"
+  - service: openai
+    pattern: "(openai"
+`)
+
+	_, err := LoadServiceConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, service.ErrInvalidRule) {
+		t.Errorf("Expected ErrInvalidRule, got %v", err)
+	}
+	if verr.Path != "rules[1]" || verr.Entry != "openai" || verr.Line != 4 {
+		t.Errorf("Expected rules[1] (openai) at line 4, got %s (%s) at line %d", verr.Path, verr.Entry, verr.Line)
+	}
+}
+
+// TestLoadServiceConfigUnknownService tests that settings must belong to a classified service
+func TestLoadServiceConfigUnknownService(t *testing.T) {
+	path := writeConfigFile(t, "services.yaml", `rules:
+  - service: mcp
+    prefix: "mcp-"
+services:
+  - name: mpc
+    timeout: 10s
+`)
+
+	_, err := LoadServiceConfig(path)
+	verr := requireValidationError(t, err)
+
+	if verr.Path != "services[0]" || verr.Entry != "mpc" {
+		t.Errorf("Expected services[0] (mpc), got %s (%s)", verr.Path, verr.Entry)
+	}
+}
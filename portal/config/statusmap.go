@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/portal-project/portal-gateway/portal/statusmap"
+)
+
+// StatusMapConfigFile represents the structure of the status code remapping config file
+type StatusMapConfigFile struct {
+	Leases []StatusMapRule `yaml:"leases"`
+}
+
+// StatusMapRule represents a single lease remapping table in config
+type StatusMapRule struct {
+	LeaseID     string      `yaml:"lease_id"`
+	StatusCodes map[int]int `yaml:"status_codes"`
+}
+
+// LoadStatusMapConfig loads status code remapping configuration from a file
+func LoadStatusMapConfig(filePath string) (*statusmap.MiddlewareConfig, error) {
+	if filePath == "" {
+		return nil, errors.New("status map config file path cannot be empty")
+	}
+
+	// Read configuration file
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("status map config file not found: %s", filePath)
+		}
+		return nil, fmt.Errorf("failed to read status map config file: %w", err)
+	}
+
+	// Parse YAML
+	var configFile StatusMapConfigFile
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status map config format: %w", err)
+	}
+
+	config := statusmap.DefaultMiddlewareConfig()
+
+	leaseIDs := make(map[string]int)
+	for i, rule := range configFile.Leases {
+		path := fmt.Sprintf("leases[%d]", i)
+		if first, exists := leaseIDs[rule.LeaseID]; exists {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, fmt.Errorf("duplicate lease ID, first defined by leases[%d]", first)))
+		}
+		leaseIDs[rule.LeaseID] = i
+
+		if err := config.AddRule(&statusmap.Rule{LeaseID: rule.LeaseID, Codes: rule.StatusCodes}); err != nil {
+			return nil, locateError(filePath, doc, fieldError(path, rule.LeaseID, err))
+		}
+	}
+
+	return config, nil
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/statusmap"
+)
+
+// TestLoadStatusMapConfig tests loading status code remapping configuration from file
+func TestLoadStatusMapConfig(t *testing.T) {
+	path := writeConfigFile(t, "status-map.yaml", `leases:
+  - lease_id: "legacy-*"
+    status_codes:
+      418: 502
+      520: 502
+  - lease_id: "billing"
+    status_codes:
+      299: 200
+`)
+
+	config, err := LoadStatusMapConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	rule := config.GetRule("legacy-crm")
+	if rule == nil || rule.Codes[418] != 502 || rule.Codes[520] != 502 {
+		t.Errorf("Expected legacy-* remapping, got %v", rule)
+	}
+	if rule := config.GetRule("billing"); rule == nil || rule.Codes[299] != 200 {
+		t.Errorf("Expected billing remapping, got %v", rule)
+	}
+	if rule := config.GetRule("other"); rule != nil {
+		t.Errorf("Expected no remapping for other, got %v", rule)
+	}
+}
+
+// TestLoadStatusMapConfigInvalidCode tests that an out-of-range code names its lease entry
+func TestLoadStatusMapConfigInvalidCode(t *testing.T) {
+	path := writeConfigFile(t, "status-map.yaml", `leases:
+  - lease_id: "legacy-*"
+    status_codes:
+      418: 502
+  - lease_id: "billing"
+    status_codes:
+      500: 700
+`)
+
+	_, err := LoadStatusMapConfig(path)
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, statusmap.ErrInvalidStatusCode) {
+		t.Errorf("Expected ErrInvalidStatusCode, got %v", err)
+	}
+	if verr.Path != "leases[1]" || verr.Entry != "billing" || verr.Line != 5 {
+		t.Errorf("Expected leases[1] (billing) at line 5, got %s (%s) at line %d", verr.Path, verr.Entry, verr.Line)
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"fmt"
 	"os"
 
-	"gopkg.in/yaml.v3"
-
 	portalTLS "github.com/portal-project/portal-gateway/portal/tls"
 )
 
@@ -41,7 +39,8 @@ func LoadTLSConfig(filePath string) (*portalTLS.Config, error) {
 
 	// Parse YAML
 	var configFile TLSConfigFile
-	if err := yaml.Unmarshal(data, &configFile); err != nil {
+	doc, err := parseYAML(filePath, data, &configFile)
+	if err != nil {
 		return nil, fmt.Errorf("invalid TLS config format: %w", err)
 	}
 
@@ -68,7 +67,7 @@ func LoadTLSConfig(filePath string) (*portalTLS.Config, error) {
 
 	// Validate configuration
 	if err := validateTLSConfig(tlsConfig); err != nil {
-		return nil, fmt.Errorf("TLS config validation failed: %w", err)
+		return nil, fmt.Errorf("TLS config validation failed: %w", locateError(filePath, doc, err))
 	}
 
 	// Load certificates
@@ -100,7 +99,7 @@ func validateTLSConfig(config *portalTLS.Config) error {
 	// Validate ACME configuration
 	if config.EnableACME {
 		if len(config.ACMEDomains) == 0 {
-			return errors.New("ACME domains cannot be empty when ACME is enabled")
+			return fieldError("acme_domains", "", errors.New("ACME domains cannot be empty when ACME is enabled"))
 		}
 
 		// Validate email (optional but recommended)
@@ -110,18 +109,18 @@ func validateTLSConfig(config *portalTLS.Config) error {
 	} else {
 		// Manual certificate configuration
 		if config.CertFile == "" {
-			return errors.New("cert_file is required when ACME is not enabled")
+			return fieldError("cert_file", "", errors.New("required when ACME is not enabled"))
 		}
 
 		if config.KeyFile == "" {
-			return errors.New("key_file is required when ACME is not enabled")
+			return fieldError("key_file", "", errors.New("required when ACME is not enabled"))
 		}
 	}
 
 	// Validate mTLS configuration
 	if config.EnableMTLS {
 		if config.CAFile == "" {
-			return errors.New("ca_file is required when mTLS is enabled")
+			return fieldError("ca_file", "", errors.New("required when mTLS is enabled"))
 		}
 	}
 
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ValidationError is a configuration error located in its file
+// Syntax and type errors carry the line the YAML parser reported; semantic errors
+// name the offending field or list entry and, once located, its line and column
+type ValidationError struct {
+	File   string // Configuration file, empty if unknown
+	Line   int    // 1-based line, 0 if unknown
+	Column int    // 1-based column, 0 if unknown
+	Path   string // Offending field or entry, e.g. "api_keys[2]"
+	Entry  string // Identifier of the offending entry, e.g. its key ID
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+
+	if e.File != "" {
+		b.WriteString(e.File)
+	} else if e.Line > 0 {
+		b.WriteString("line")
+	}
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ":%d", e.Column)
+		}
+	}
+	if b.Len() > 0 {
+		b.WriteString(": ")
+	}
+
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		if e.Entry != "" {
+			fmt.Fprintf(&b, " (%s)", e.Entry)
+		}
+		b.WriteString(": ")
+	}
+
+	b.WriteString(e.Err.Error())
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// fieldError returns a validation error for a field or list entry, located later by locateError
+func fieldError(path, entry string, err error) *ValidationError {
+	return &ValidationError{Path: path, Entry: entry, Err: err}
+}
+
+// yamlLinePattern matches the line prefix of yaml.v3 syntax and type error messages
+var yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// parseYAML decodes a configuration file into out
+// The document node is returned so semantic errors can be located with locateError;
+// syntax and type errors come back as ValidationErrors carrying the parser's line numbers
+func parseYAML(file string, data []byte, out any) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, yamlError(file, err)
+	}
+
+	// An empty file decodes to nothing, as it does with yaml.Unmarshal
+	if doc.Kind == 0 {
+		return &doc, nil
+	}
+
+	if err := doc.Decode(out); err != nil {
+		return nil, yamlError(file, err)
+	}
+
+	return &doc, nil
+}
+
+// yamlError converts a yaml.v3 error into located validation errors, one per reported problem
+func yamlError(file string, err error) error {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	errs := make([]error, 0, len(messages))
+	for _, message := range messages {
+		verr := &ValidationError{File: file, Err: errors.New(strings.TrimPrefix(message, "yaml: "))}
+		if m := yamlLinePattern.FindStringSubmatch(message); m != nil {
+			verr.Line, _ = strconv.Atoi(m[1])
+			verr.Err = errors.New(m[2])
+		}
+		errs = append(errs, verr)
+	}
+
+	return errors.Join(errs...)
+}
+
+// locateError fills in the file, line and column of a ValidationError found in err
+// Errors without a ValidationError, or whose path is not in the document, are returned as they are
+func locateError(file string, doc *yaml.Node, err error) error {
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		return err
+	}
+
+	verr.File = file
+	if node := findNode(doc, verr.Path); node != nil {
+		verr.Line, verr.Column = node.Line, node.Column
+	}
+	return err
+}
+
+// findNode returns the node at a path such as "api_keys[2].key_id", or nil if there is none
+func findNode(doc *yaml.Node, path string) *yaml.Node {
+	if doc == nil || path == "" {
+		return nil
+	}
+
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	for _, part := range strings.Split(path, ".") {
+		name, index, hasIndex := strings.Cut(part, "[")
+
+		if name != "" {
+			node = mappingValue(node, name)
+			if node == nil {
+				return nil
+			}
+		}
+
+		if hasIndex {
+			i, err := strconv.Atoi(strings.TrimSuffix(index, "]"))
+			if err != nil || node.Kind != yaml.SequenceNode || i < 0 || i >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[i]
+		}
+	}
+
+	return node
+}
+
+// mappingValue returns the value for a key of a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
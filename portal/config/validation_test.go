@@ -0,0 +1,178 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigFile writes a configuration file into a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+// requireValidationError returns the ValidationError in err, failing the test if there is none
+func requireValidationError(t *testing.T, err error) *ValidationError {
+	t.Helper()
+
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+	return verr
+}
+
+func TestValidationErrorSyntaxLine(t *testing.T) {
+	path := writeConfigFile(t, "auth.yaml", `api_keys:
+  - key_id: "key_1"
+    key: "sk_live_1234567890abcdef"
+    scopes: read: write
+`)
+
+	err := NewAuthConfigLoader(path).Load()
+	verr := requireValidationError(t, err)
+
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("Expected ErrInvalidConfig, got %v", err)
+	}
+	if verr.Line != 4 {
+		t.Errorf("Expected line 4, got %d", verr.Line)
+	}
+	if !strings.Contains(err.Error(), path+":4: ") {
+		t.Errorf("Expected file and line in error, got %q", err.Error())
+	}
+}
+
+func TestValidationErrorTypeLines(t *testing.T) {
+	path := writeConfigFile(t, "rate-limits.yaml", `default_rate: 50.0
+default_burst: lots
+leases:
+  - lease_id: "test-*"
+    burst_size: many
+`)
+
+	_, err := LoadLeaseRateLimitConfig(path)
+	requireValidationError(t, err)
+
+	// Every type error is reported, each with its own line
+	for _, want := range []string{path + ":2: cannot unmarshal", path + ":5: cannot unmarshal"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error containing %q, got %q", want, err.Error())
+		}
+	}
+}
+
+func TestValidationErrorDuplicateKeyID(t *testing.T) {
+	path := writeConfigFile(t, "auth.yaml", `api_keys:
+  - key_id: "key_1"
+    key: "sk_live_1234567890abcdef"
+  - key_id: "key_2"
+    key: "sk_live_abcdef1234567890"
+  - key_id: "key_1"
+    key: "sk_live_0987654321fedcba"
+`)
+
+	err := NewAuthConfigLoader(path).Load()
+	verr := requireValidationError(t, err)
+
+	if verr.Path != "api_keys[2]" || verr.Entry != "key_1" {
+		t.Errorf("Expected api_keys[2] (key_1), got %s (%s)", verr.Path, verr.Entry)
+	}
+	if verr.Line != 6 || verr.Column != 5 {
+		t.Errorf("Expected line 6 column 5, got %d:%d", verr.Line, verr.Column)
+	}
+	if !strings.Contains(err.Error(), path+":6:5: api_keys[2] (key_1): duplicate API key ID key_1, first used by api_keys[0]") {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+}
+
+func TestValidationErrorInvalidKey(t *testing.T) {
+	path := writeConfigFile(t, "auth.yaml", `api_keys:
+  - key_id: "key_1"
+    key: "sk_live_1234567890abcdef"
+  - key_id: "key_2"
+    key: "not-a-key"
+`)
+
+	verr := requireValidationError(t, NewAuthConfigLoader(path).Load())
+	if verr.Path != "api_keys[1]" || verr.Entry != "key_2" || verr.Line != 4 {
+		t.Errorf("Expected api_keys[1] (key_2) at line 4, got %s (%s) at line %d", verr.Path, verr.Entry, verr.Line)
+	}
+}
+
+func TestValidationErrorQuotaStorage(t *testing.T) {
+	path := writeConfigFile(t, "quota.yaml", `default_monthly_requests: 1000
+storage:
+  type: postgres
+  path: quota.db
+`)
+
+	_, err := LoadQuotaConfig(path)
+	verr := requireValidationError(t, err)
+
+	if verr.Path != "storage.type" || verr.Line != 3 || verr.Column != 9 {
+		t.Errorf("Expected storage.type at 3:9, got %s at %d:%d", verr.Path, verr.Line, verr.Column)
+	}
+}
+
+func TestValidationErrorDuplicateLease(t *testing.T) {
+	path := writeConfigFile(t, "rate-limits.yaml", `default_rate: 50.0
+leases:
+  - lease_id: "test-lease"
+    requests_per_second: 100.0
+  - lease_id: "test-lease"
+    requests_per_second: 200.0
+`)
+
+	_, err := LoadLeaseRateLimitConfig(path)
+	verr := requireValidationError(t, err)
+
+	if verr.Path != "leases[1]" || verr.Entry != "test-lease" || verr.Line != 5 {
+		t.Errorf("Expected leases[1] (test-lease) at line 5, got %s (%s) at line %d", verr.Path, verr.Entry, verr.Line)
+	}
+	if !strings.Contains(err.Error(), "first defined by leases[0]") {
+		t.Errorf("Expected the first definition to be named, got %q", err.Error())
+	}
+}
+
+func TestValidationErrorMissingTLSField(t *testing.T) {
+	path := writeConfigFile(t, "tls.yaml", `cert_file: server.crt
+`)
+
+	_, err := LoadTLSConfig(path)
+	verr := requireValidationError(t, err)
+
+	// A missing field has no position, but the field is still named
+	if verr.Path != "key_file" || verr.Line != 0 {
+		t.Errorf("Expected key_file without a line, got %s at line %d", verr.Path, verr.Line)
+	}
+	if !strings.Contains(err.Error(), path+": key_file: required when ACME is not enabled") {
+		t.Errorf("Unexpected error message: %q", err.Error())
+	}
+}
+
+func TestValidationErrorAuthDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeKeyFile(t, dir, "key1", "sk_live_first1234567890\n")
+	writeKeyFile(t, dir, "key2", "not-a-key\n")
+
+	_, err := LoadFromDirectory(dir)
+	verr := requireValidationError(t, err)
+
+	// Key files are named directly instead of by their place in the assembled list
+	if verr.File != filepath.Join(dir, "key2") || verr.Path != "" {
+		t.Errorf("Expected the key2 file to be named, got %q", err.Error())
+	}
+}
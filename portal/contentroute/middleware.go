@@ -0,0 +1,224 @@
+package contentroute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics holds content type routing metrics
+type Metrics struct {
+	RoutedTotal *prometheus.CounterVec
+}
+
+// NewMetrics creates new content type routing metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new content type routing metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		RoutedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_content_routed_total",
+				Help: "Total number of requests sent to an upstream chosen by their Content-Type",
+			},
+			[]string{"lease_id", "upstream"}, // upstream: "default" when no route matched
+		),
+	}
+}
+
+// Route sends requests with a matching Content-Type to an upstream
+type Route struct {
+	// ContentType is a media type such as "application/json", matched without parameters and
+	// case-insensitively; a trailing "*" matches by prefix, e.g. "application/grpc-web*"
+	ContentType string
+
+	// Upstream names the backend the request goes to
+	Upstream string
+}
+
+// Rule is a lease's ordered content type routes
+type Rule struct {
+	LeaseID string  // Lease ID (supports wildcards like "api-*")
+	Routes  []Route // Checked in order; the first match wins
+}
+
+// Match returns the upstream of the first route matching a Content-Type header value
+// Requests without a Content-Type, or with one no route matches, go to the default upstream
+func (rule *Rule) Match(contentType string) (string, bool) {
+	if contentType == "" {
+		return "", false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+
+	for _, route := range rule.Routes {
+		if prefix, wildcard := strings.CutSuffix(route.ContentType, "*"); wildcard {
+			if strings.HasPrefix(mediaType, prefix) {
+				return route.Upstream, true
+			}
+		} else if mediaType == route.ContentType {
+			return route.Upstream, true
+		}
+	}
+	return "", false
+}
+
+// MiddlewareConfig holds content type routing configuration
+type MiddlewareConfig struct {
+	// Rules maps lease IDs to their routes
+	Rules middleware.LeaseRules[*Rule]
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+}
+
+// Common errors
+var (
+	ErrInvalidRoute = errors.New("invalid content type route")
+	ErrRuleNotFound = errors.New("content type routing rule not found")
+)
+
+// DefaultMiddlewareConfig returns default routing configuration with no rules
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{}
+}
+
+// AddRule adds or replaces the routes for a lease
+func (c *MiddlewareConfig) AddRule(rule *Rule) error {
+	if rule == nil {
+		return errors.New("content type routing rule cannot be nil")
+	}
+
+	if rule.LeaseID == "" {
+		return errors.New("lease ID cannot be empty")
+	}
+
+	if len(rule.Routes) == 0 {
+		return fmt.Errorf("%w: at least one route is required", ErrInvalidRoute)
+	}
+
+	routes := make([]Route, len(rule.Routes))
+	for i, route := range rule.Routes {
+		contentType := strings.ToLower(strings.TrimSpace(route.ContentType))
+		if err := validateContentType(contentType); err != nil {
+			return fmt.Errorf("%w: routes[%d]: %v", ErrInvalidRoute, i, err)
+		}
+		if route.Upstream == "" {
+			return fmt.Errorf("%w: routes[%d]: upstream cannot be empty", ErrInvalidRoute, i)
+		}
+		routes[i] = Route{ContentType: contentType, Upstream: route.Upstream}
+	}
+
+	c.Rules.Set(rule.LeaseID, &Rule{LeaseID: rule.LeaseID, Routes: routes})
+	return nil
+}
+
+// validateContentType checks a lowercased route content type
+func validateContentType(contentType string) error {
+	prefix, wildcard := strings.CutSuffix(contentType, "*")
+	if strings.Contains(prefix, "*") {
+		return fmt.Errorf("content type %q may only end in *", contentType)
+	}
+
+	// A wildcard may stop anywhere after the slash, e.g. "application/*"
+	mediaType, subtype, ok := strings.Cut(prefix, "/")
+	if !ok || mediaType == "" || subtype == "" && !wildcard {
+		return fmt.Errorf("content type %q must be a media type such as application/json", contentType)
+	}
+	return nil
+}
+
+// RemoveRule removes the routes for a lease
+func (c *MiddlewareConfig) RemoveRule(leaseID string) error {
+	if !c.Rules.Delete(leaseID) {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, leaseID)
+	}
+	return nil
+}
+
+// GetRule returns the routes for a lease, or nil if it always uses its default upstream
+func (c *MiddlewareConfig) GetRule(leaseID string) *Rule {
+	rule, _ := c.Rules.Match(leaseID)
+	return rule
+}
+
+// ListRules returns all routing rules
+func (c *MiddlewareConfig) ListRules() []*Rule {
+	return c.Rules.List()
+}
+
+// contextKey is a custom type for context keys to avoid collisions
+type contextKey struct{}
+
+// GetUpstream returns the upstream selected for a request, or "" for the lease's default upstream
+func GetUpstream(ctx context.Context) string {
+	upstream, _ := ctx.Value(contextKey{}).(string)
+	return upstream
+}
+
+// Middleware selects a lease's upstream by request Content-Type
+type Middleware struct {
+	config *MiddlewareConfig
+}
+
+// NewMiddleware creates a new content type routing middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	return &Middleware{
+		config: config,
+	}
+}
+
+// Middleware returns an http.Handler that records the selected upstream in the request context
+// for leases with a rule; GetUpstream reads it back
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := middleware.GetLeaseID(r.Context())
+		if leaseID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule := m.config.GetRule(leaseID)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		upstream, matched := rule.Match(r.Header.Get("Content-Type"))
+		if !matched {
+			m.config.Metrics.RoutedTotal.WithLabelValues(rule.LeaseID, "default").Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		m.config.Metrics.RoutedTotal.WithLabelValues(rule.LeaseID, upstream).Inc()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, upstream)))
+	})
+}
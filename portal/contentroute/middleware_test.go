@@ -0,0 +1,120 @@
+package contentroute
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func counterValue(t *testing.T, counter prometheus.Counter) float64 {
+	t.Helper()
+
+	var metric dto.Metric
+	if err := counter.Write(&metric); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+// newTestConfig creates a routing configuration with the given rules and its own metrics
+func newTestConfig(t *testing.T, rules ...*Rule) *MiddlewareConfig {
+	t.Helper()
+
+	config := DefaultMiddlewareConfig()
+	config.Metrics = NewMetricsWithRegistry(prometheus.NewRegistry())
+	for _, rule := range rules {
+		if err := config.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	return config
+}
+
+func TestMiddlewareSelectsUpstream(t *testing.T) {
+	config := newTestConfig(t, &Rule{LeaseID: "api-*", Routes: []Route{
+		{ContentType: "application/grpc-web*", Upstream: "grpc"},
+		{ContentType: "Application/JSON", Upstream: "json"},
+		{ContentType: "application/*", Upstream: "other-app"},
+	}})
+
+	var selected string
+	handler := NewMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		selected = GetUpstream(r.Context())
+	}))
+
+	tests := []struct {
+		name        string
+		leaseID     string
+		contentType string
+		expected    string
+	}{
+		{"grpc-web", "api-1", "application/grpc-web+proto", "grpc"},
+		{"json with parameters", "api-1", "application/json; charset=utf-8", "json"},
+		{"first match wins", "api-1", "application/grpc-web-text", "grpc"},
+		{"type wildcard", "api-1", "application/xml", "other-app"},
+		{"no match", "api-1", "text/plain", ""},
+		{"no content type", "api-1", "", ""},
+		{"malformed content type", "api-1", "application/", ""},
+		{"lease without rule", "billing", "application/json", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected = "unset"
+			req := httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), tt.leaseID), "POST", "/peer/"+tt.leaseID, nil)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if selected != tt.expected {
+				t.Errorf("Expected upstream %q, got %q", tt.expected, selected)
+			}
+		})
+	}
+
+	if got := counterValue(t, config.Metrics.RoutedTotal.WithLabelValues("api-*", "grpc")); got != 2 {
+		t.Errorf("Expected 2 requests routed to grpc, got %v", got)
+	}
+	if got := counterValue(t, config.Metrics.RoutedTotal.WithLabelValues("api-*", "default")); got != 3 {
+		t.Errorf("Expected 3 requests left on the default upstream, got %v", got)
+	}
+}
+
+func TestAddRuleValidation(t *testing.T) {
+	config := DefaultMiddlewareConfig()
+
+	invalid := []*Rule{
+		{LeaseID: "api-1"},
+		{LeaseID: "api-1", Routes: []Route{{ContentType: "application/json"}}},
+		{LeaseID: "api-1", Routes: []Route{{ContentType: "json", Upstream: "json"}}},
+		{LeaseID: "api-1", Routes: []Route{{ContentType: "application/", Upstream: "json"}}},
+		{LeaseID: "api-1", Routes: []Route{{ContentType: "*", Upstream: "any"}}},
+		{LeaseID: "api-1", Routes: []Route{{ContentType: "application/*+json", Upstream: "json"}}},
+	}
+	for _, rule := range invalid {
+		if err := config.AddRule(rule); !errors.Is(err, ErrInvalidRoute) {
+			t.Errorf("Expected ErrInvalidRoute for %+v, got %v", rule.Routes, err)
+		}
+	}
+
+	if config.AddRule(&Rule{Routes: []Route{{ContentType: "application/json", Upstream: "json"}}}) == nil {
+		t.Error("Expected an empty lease ID to be rejected")
+	}
+
+	if err := config.AddRule(&Rule{LeaseID: "api-1", Routes: []Route{{ContentType: "application/json", Upstream: "json"}}}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := config.RemoveRule("api-1"); err != nil {
+		t.Errorf("Failed to remove rule: %v", err)
+	}
+	if !errors.Is(config.RemoveRule("api-1"), ErrRuleNotFound) {
+		t.Error("Expected removing a missing rule to fail")
+	}
+}
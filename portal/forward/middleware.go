@@ -0,0 +1,237 @@
+// Package forward decides which request headers are forwarded upstream, so connection-specific
+// headers and the gateway's credentials never reach a tenant's upstream
+package forward
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// DefaultDenyHeaders are the gateway's credential headers, removed from every request whose
+// lease does not explicitly allow them
+var DefaultDenyHeaders = []string{"Authorization", "X-API-Key"}
+
+// HopHeaders are connection-specific headers (RFC 7230, section 6.1) that are never forwarded
+var HopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection", // Non-standard, but still sent by some clients
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Common errors
+var (
+	ErrInvalidHeaderName = errors.New("invalid header name")
+	ErrHopHeader         = errors.New("hop-by-hop header cannot be forwarded")
+	ErrPolicyNotFound    = errors.New("forwarding policy not found")
+)
+
+// Policy holds a lease's request header forwarding rules
+type Policy struct {
+	LeaseID string // Lease ID (supports wildcards like "legacy-*")
+
+	// Allow forwards only these headers when set; listing a credential header forwards it
+	Allow []string
+
+	// Deny removes these headers, in addition to the credential headers
+	Deny []string
+}
+
+// MiddlewareConfig holds request header forwarding configuration
+type MiddlewareConfig struct {
+	// Policies maps lease IDs to their forwarding policy
+	Policies middleware.LeaseRules[*Policy]
+
+	// DenyHeaders are removed from the requests of every lease whose allow list does not name them
+	DenyHeaders []string
+}
+
+// DefaultMiddlewareConfig returns default forwarding configuration: hop-by-hop and credential
+// headers are removed and everything else is forwarded
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{
+		DenyHeaders: slices.Clone(DefaultDenyHeaders),
+	}
+}
+
+// AddPolicy validates a forwarding policy and sets it for its lease
+// Header names are canonicalized, so no work is left for requests
+func (c *MiddlewareConfig) AddPolicy(policy *Policy) error {
+	if policy == nil {
+		return errors.New("forwarding policy cannot be nil")
+	}
+
+	if policy.LeaseID == "" {
+		return errors.New("lease ID cannot be empty")
+	}
+
+	allow, err := canonicalHeaderNames(policy.Allow)
+	if err != nil {
+		return err
+	}
+	for _, name := range allow {
+		if isHopHeader(name) {
+			return fmt.Errorf("%w: %q", ErrHopHeader, name)
+		}
+	}
+
+	deny, err := canonicalHeaderNames(policy.Deny)
+	if err != nil {
+		return err
+	}
+	for _, name := range deny {
+		if slices.Contains(allow, name) {
+			return fmt.Errorf("header %q is both allowed and denied", name)
+		}
+	}
+	policy.Allow, policy.Deny = allow, deny
+
+	c.Policies.Set(policy.LeaseID, policy)
+	return nil
+}
+
+// RemovePolicy removes the forwarding policy for a lease
+func (c *MiddlewareConfig) RemovePolicy(leaseID string) error {
+	if !c.Policies.Delete(leaseID) {
+		return fmt.Errorf("%w: %s", ErrPolicyNotFound, leaseID)
+	}
+	return nil
+}
+
+// GetPolicy returns the forwarding policy for a lease, or nil if it uses the defaults
+func (c *MiddlewareConfig) GetPolicy(leaseID string) *Policy {
+	policy, _ := c.Policies.Match(leaseID)
+	return policy
+}
+
+// FilterHeader removes the headers that must not be forwarded under a policy, which may be nil
+func (c *MiddlewareConfig) FilterHeader(header http.Header, policy *Policy) {
+	// A protocol upgrade only reaches the upstream if it is asked for again
+	upgrade := ""
+	if hasToken(header.Values("Connection"), "upgrade") {
+		upgrade = header.Get("Upgrade")
+	}
+	trailers := hasToken(header.Values("Te"), "trailers")
+
+	for _, value := range header.Values("Connection") {
+		for _, field := range strings.Split(value, ",") {
+			header.Del(strings.TrimSpace(field))
+		}
+	}
+	for _, name := range HopHeaders {
+		header.Del(name)
+	}
+
+	var allow []string
+	if policy != nil {
+		allow = policy.Allow
+		if len(allow) > 0 {
+			for name := range header {
+				if !slices.Contains(allow, http.CanonicalHeaderKey(name)) {
+					delete(header, name)
+				}
+			}
+		}
+		for _, name := range policy.Deny {
+			header.Del(name)
+		}
+	}
+
+	for _, name := range c.DenyHeaders {
+		if !slices.Contains(allow, http.CanonicalHeaderKey(name)) {
+			header.Del(name)
+		}
+	}
+
+	if upgrade != "" {
+		header.Set("Connection", "Upgrade")
+		header.Set("Upgrade", upgrade)
+	}
+	// Only the trailers value is end-to-end; it tells a gRPC upstream the client reads trailers
+	if trailers {
+		header.Set("Te", "trailers")
+	}
+}
+
+// canonicalHeaderNames validates header names and returns them in canonical form
+func canonicalHeaderNames(names []string) ([]string, error) {
+	canonical := make([]string, 0, len(names))
+	for _, name := range names {
+		if !validHeaderName(name) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidHeaderName, name)
+		}
+		canonical = append(canonical, http.CanonicalHeaderKey(name))
+	}
+	return canonical, nil
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isHopHeader reports whether a canonical header name is hop-by-hop
+func isHopHeader(name string) bool {
+	return slices.Contains(HopHeaders, name)
+}
+
+// hasToken reports whether any comma-separated value contains token, ignoring case
+func hasToken(values []string, token string) bool {
+	for _, value := range values {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Middleware removes request headers that must not be forwarded upstream
+type Middleware struct {
+	config *MiddlewareConfig
+}
+
+// NewMiddleware creates a new request header forwarding middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	return &Middleware{
+		config: config,
+	}
+}
+
+// Middleware returns an http.Handler that passes the handler a copy of the request holding only
+// the headers its lease forwards
+// The client's request is left as it is, so outer layers still see what the client sent
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := m.config.GetPolicy(middleware.GetLeaseID(r.Context()))
+
+		forwarded := r.WithContext(r.Context())
+		forwarded.Header = r.Header.Clone()
+		m.config.FilterHeader(forwarded.Header, policy)
+
+		next.ServeHTTP(w, forwarded)
+	})
+}
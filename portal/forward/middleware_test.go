@@ -0,0 +1,132 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// forwardedHeader serves a request and returns the header the upstream handler received
+func forwardedHeader(t *testing.T, config *MiddlewareConfig, leaseID string, header http.Header) http.Header {
+	t.Helper()
+
+	var got http.Header
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	})
+
+	r := httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), leaseID), "GET", "/peer/"+leaseID+"/items", nil)
+	for name, values := range header {
+		r.Header[name] = values
+	}
+	NewMiddleware(config).Middleware(upstream).ServeHTTP(httptest.NewRecorder(), r)
+
+	if r.Header.Get("Authorization") != header.Get("Authorization") {
+		t.Error("Expected the client's request to be left unchanged")
+	}
+	return got
+}
+
+func TestMiddlewareStripsHopAndCredentialHeaders(t *testing.T) {
+	got := forwardedHeader(t, DefaultMiddlewareConfig(), "lease-1", http.Header{
+		"Authorization":       {"Bearer gateway-key"},
+		"X-Api-Key":           {"gateway-key"},
+		"Connection":          {"keep-alive, X-Session-Hint"},
+		"X-Session-Hint":      {"abc"},
+		"Keep-Alive":          {"timeout=5"},
+		"Proxy-Authorization": {"Basic Zm9vOmJhcg=="},
+		"Te":                  {"trailers, deflate"},
+		"Accept":              {"application/json"},
+	})
+
+	for _, name := range []string{"Authorization", "X-Api-Key", "Connection", "X-Session-Hint", "Keep-Alive", "Proxy-Authorization"} {
+		if got.Get(name) != "" {
+			t.Errorf("Expected %s to be removed, got %q", name, got.Get(name))
+		}
+	}
+	if got.Get("Accept") != "application/json" {
+		t.Errorf("Expected end-to-end headers to be forwarded, got %v", got)
+	}
+	if got.Get("Te") != "trailers" {
+		t.Errorf("Expected Te to be reduced to trailers, got %q", got.Get("Te"))
+	}
+}
+
+func TestMiddlewareKeepsUpgrade(t *testing.T) {
+	got := forwardedHeader(t, DefaultMiddlewareConfig(), "lease-1", http.Header{
+		"Connection": {"keep-alive, Upgrade"},
+		"Upgrade":    {"websocket"},
+	})
+
+	if got.Get("Connection") != "Upgrade" || got.Get("Upgrade") != "websocket" {
+		t.Errorf("Expected the upgrade to be requested from the upstream, got %v", got)
+	}
+}
+
+func TestMiddlewarePolicies(t *testing.T) {
+	config := DefaultMiddlewareConfig()
+	if err := config.AddPolicy(&Policy{LeaseID: "lease-strict", Allow: []string{"accept", "authorization"}}); err != nil {
+		t.Fatalf("Failed to add policy: %v", err)
+	}
+	if err := config.AddPolicy(&Policy{LeaseID: "lease-*", Deny: []string{"x-debug"}}); err != nil {
+		t.Fatalf("Failed to add policy: %v", err)
+	}
+
+	header := http.Header{
+		"Authorization": {"Bearer upstream-token"},
+		"X-Api-Key":     {"gateway-key"},
+		"X-Debug":       {"1"},
+		"Accept":        {"text/plain"},
+		"User-Agent":    {"curl"},
+	}
+
+	// An allow list forwards only the headers it names, credentials included
+	strict := forwardedHeader(t, config, "lease-strict", header)
+	if len(strict) != 2 || strict.Get("Authorization") != "Bearer upstream-token" || strict.Get("Accept") != "text/plain" {
+		t.Errorf("Expected only the allowed headers, got %v", strict)
+	}
+
+	// A deny list removes its headers on top of the credentials
+	other := forwardedHeader(t, config, "lease-other", header)
+	if other.Get("X-Debug") != "" || other.Get("Authorization") != "" || other.Get("X-Api-Key") != "" {
+		t.Errorf("Expected denied and credential headers to be removed, got %v", other)
+	}
+	if other.Get("User-Agent") != "curl" {
+		t.Errorf("Expected other headers to be forwarded, got %v", other)
+	}
+}
+
+func TestAddPolicyValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  *Policy
+		wantErr error
+	}{
+		{"invalid name", &Policy{LeaseID: "lease-1", Deny: []string{"X-Debug:"}}, ErrInvalidHeaderName},
+		{"hop-by-hop allowed", &Policy{LeaseID: "lease-1", Allow: []string{"connection"}}, ErrHopHeader},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := DefaultMiddlewareConfig().AddPolicy(tt.policy)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	config := DefaultMiddlewareConfig()
+	if config.AddPolicy(&Policy{LeaseID: "lease-1", Allow: []string{"X-Debug"}, Deny: []string{"x-debug"}}) == nil {
+		t.Error("Expected a header both allowed and denied to be rejected")
+	}
+	if config.AddPolicy(&Policy{Deny: []string{"X-Debug"}}) == nil {
+		t.Error("Expected an empty lease ID to be rejected")
+	}
+	if !errors.Is(config.RemovePolicy("lease-1"), ErrPolicyNotFound) {
+		t.Error("Expected removing a missing policy to fail")
+	}
+}
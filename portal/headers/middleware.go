@@ -0,0 +1,153 @@
+package headers
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// hstsHeader is only meaningful over TLS; browsers ignore it on plain HTTP (RFC 6797)
+const hstsHeader = "Strict-Transport-Security"
+
+// DefaultSecurityHeaders returns the default set of security headers
+func DefaultSecurityHeaders() map[string]string {
+	return map[string]string{
+		"X-Frame-Options":        "DENY",
+		"X-Content-Type-Options": "nosniff",
+		hstsHeader:               "max-age=31536000; includeSubDomains",
+		"Referrer-Policy":        "no-referrer",
+		"Server":                 "portal-gateway",
+	}
+}
+
+// MiddlewareConfig holds response header injection configuration
+type MiddlewareConfig struct {
+	// Headers maps header names to the values injected into every response
+	// If nil, DefaultSecurityHeaders is used. Strict-Transport-Security is only
+	// sent on TLS responses
+	Headers map[string]string
+
+	// Force overwrites headers already set by downstream handlers
+	Force bool
+}
+
+// DefaultMiddlewareConfig returns default configuration
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{
+		Headers: DefaultSecurityHeaders(),
+		Force:   false,
+	}
+}
+
+// Middleware injects a fixed set of headers into every response
+type Middleware struct {
+	config *MiddlewareConfig
+}
+
+// NewMiddleware creates a new header injection middleware
+// The config is copied, so later changes by the caller have no effect
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	headers := config.Headers
+	if headers == nil {
+		headers = DefaultSecurityHeaders()
+	}
+
+	copied := &MiddlewareConfig{
+		Headers: make(map[string]string, len(headers)),
+		Force:   config.Force,
+	}
+	for name, value := range headers {
+		copied.Headers[name] = value
+	}
+
+	return &Middleware{
+		config: copied,
+	}
+}
+
+// Middleware returns an http.Handler that injects the configured headers
+// Headers are applied right before the response header is written, so values
+// set by downstream handlers are preserved unless Force is enabled
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapped := &headerResponseWriter{
+			ResponseWriter: w,
+			headers:        m.config.Headers,
+			force:          m.config.Force,
+			tls:            r.TLS != nil,
+		}
+
+		next.ServeHTTP(wrapped, r)
+
+		// Handlers that never write still produce a response
+		if !wrapped.wroteHeader {
+			wrapped.injectHeaders()
+		}
+	})
+}
+
+// headerResponseWriter wraps http.ResponseWriter to inject headers on first write
+type headerResponseWriter struct {
+	http.ResponseWriter
+	headers     map[string]string
+	force       bool
+	tls         bool
+	wroteHeader bool
+}
+
+// injectHeaders sets the configured headers on the underlying response
+func (w *headerResponseWriter) injectHeaders() {
+	h := w.ResponseWriter.Header()
+	for name, value := range w.headers {
+		if !w.tls && http.CanonicalHeaderKey(name) == hstsHeader {
+			continue
+		}
+		if !w.force && h.Get(name) != "" {
+			continue
+		}
+		h.Set(name, value)
+	}
+}
+
+func (w *headerResponseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.injectHeaders()
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *headerResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher for streaming responses
+func (w *headerResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker for WebSocket support
+func (w *headerResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hijacker.Hijack()
+	}
+	return nil, nil, fmt.Errorf("response writer does not support hijacking")
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *headerResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,219 @@
+package headers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewMiddlewareWithDefaults(t *testing.T) {
+	m := NewMiddleware(nil)
+
+	if m == nil {
+		t.Fatal("Expected middleware to be created with defaults")
+	}
+
+	if len(m.config.Headers) == 0 {
+		t.Error("Expected default security headers to be configured")
+	}
+
+	if m.config.Force {
+		t.Error("Expected force to be disabled by default")
+	}
+}
+
+func TestNewMiddlewareNilHeaders(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{})
+
+	if m.config.Headers["X-Content-Type-Options"] != "nosniff" {
+		t.Error("Expected nil headers to fall back to default security headers")
+	}
+}
+
+func TestMiddlewareInjectsHeaders(t *testing.T) {
+	m := NewMiddleware(nil)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+
+	wrapped := m.Middleware(handler)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.TLS = &tls.ConnectionState{}
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	for name, value := range DefaultSecurityHeaders() {
+		if got := rr.Header().Get(name); got != value {
+			t.Errorf("Expected %s %q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestNewMiddlewareCopiesConfig(t *testing.T) {
+	config := &MiddlewareConfig{}
+	m := NewMiddleware(config)
+
+	if config.Headers != nil {
+		t.Error("Expected caller config headers to stay nil")
+	}
+
+	config.Headers = map[string]string{"X-Frame-Options": "SAMEORIGIN"}
+	config.Force = true
+
+	if m.config.Headers["X-Frame-Options"] != "DENY" || m.config.Force {
+		t.Error("Expected middleware config to be unaffected by caller changes")
+	}
+}
+
+func TestMiddlewareHSTSOnlyOverTLS(t *testing.T) {
+	m := NewMiddleware(nil)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrapped := m.Middleware(handler)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Expected no HSTS header on plain HTTP, got %q", got)
+	}
+
+	if rr.Header().Get("X-Frame-Options") != "DENY" {
+		t.Error("Expected other headers to be injected on plain HTTP")
+	}
+
+	req.TLS = &tls.ConnectionState{}
+	rr = httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("Expected HSTS header on TLS response")
+	}
+}
+
+func TestMiddlewareInjectsHeadersOnImplicitWrite(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		Headers: map[string]string{"X-Frame-Options": "DENY"},
+	})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "write without header",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("OK"))
+			},
+		},
+		{
+			name:    "no write at all",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := m.Middleware(tt.handler)
+
+			req := httptest.NewRequest("GET", "/test", nil)
+			rr := httptest.NewRecorder()
+
+			wrapped.ServeHTTP(rr, req)
+
+			if got := rr.Header().Get("X-Frame-Options"); got != "DENY" {
+				t.Errorf("Expected X-Frame-Options DENY, got %q", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewarePreservesHandlerHeaders(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		Headers: map[string]string{
+			"X-Frame-Options": "DENY",
+			"Server":          "portal-gateway",
+		},
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "SAMEORIGIN")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrapped := m.Middleware(handler)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("Expected handler header SAMEORIGIN to be preserved, got %q", got)
+	}
+
+	if got := rr.Header().Get("Server"); got != "portal-gateway" {
+		t.Errorf("Expected Server portal-gateway, got %q", got)
+	}
+}
+
+func TestMiddlewareForceOverridesHandlerHeaders(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		Headers: map[string]string{"Server": "portal-gateway"},
+		Force:   true,
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream/1.0")
+		w.WriteHeader(http.StatusOK)
+	})
+
+	wrapped := m.Middleware(handler)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("Server"); got != "portal-gateway" {
+		t.Errorf("Expected forced Server portal-gateway, got %q", got)
+	}
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	m := NewMiddleware(nil)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("Expected response writer to implement http.Flusher")
+		}
+		flusher.Flush()
+	})
+
+	wrapped := m.Middleware(handler)
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	if !rr.Flushed {
+		t.Error("Expected response to be flushed")
+	}
+
+	if rr.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("Expected headers to be injected before flush")
+	}
+}
@@ -0,0 +1,444 @@
+package healthcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Upstream health states
+const (
+	StateUnknown   = "unknown" // Not checked yet
+	StateHealthy   = "healthy"
+	StateUnhealthy = "unhealthy"
+)
+
+// Metrics holds upstream health check metrics
+type Metrics struct {
+	ChecksTotal *prometheus.CounterVec
+	Healthy     *prometheus.GaugeVec
+}
+
+// NewMetrics creates new health check metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new health check metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		ChecksTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_upstream_health_checks_total",
+				Help: "Total number of active upstream health checks, by lease and result",
+			},
+			[]string{"lease_id", "result"}, // result: "success", "failure"
+		),
+		Healthy: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "portal_upstream_healthy",
+				Help: "Whether a lease's upstream passed its health check (1=healthy, 0=unhealthy or not checked yet)",
+			},
+			[]string{"lease_id"},
+		),
+	}
+}
+
+// Check is an active health check of one lease's upstream
+type Check struct {
+	LeaseID string // Exact lease ID; a check targets a single upstream, so wildcards are not allowed
+	URL     string // Upstream base URL; Path is appended
+	Path    string // Health endpoint path (default "/health")
+
+	Interval time.Duration // Time between checks (default 10s)
+	Timeout  time.Duration // Bound on each check (default 2s, at most Interval)
+
+	// ExpectedStatus is the status a healthy upstream answers with (0 = any 2xx)
+	ExpectedStatus int
+
+	// FailureThreshold is the number of consecutive failed checks before the upstream is unhealthy (default 1)
+	FailureThreshold int
+
+	// GateReadiness makes the gateway unready while this upstream is not healthy
+	GateReadiness bool
+
+	target *url.URL
+}
+
+// Status is the health of one lease's upstream
+type Status struct {
+	LeaseID             string    `json:"lease_id"`
+	URL                 string    `json:"url"`
+	State               string    `json:"state"`
+	GatesReadiness      bool      `json:"gates_readiness"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastCheck           time.Time `json:"last_check,omitzero"`
+	LastSuccess         time.Time `json:"last_success,omitzero"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+// Config holds upstream health check configuration
+type Config struct {
+	// Checks maps lease IDs to their upstream health check
+	Checks map[string]*Check
+
+	// Client sends health checks (nil = a client without redirects using Transport)
+	Client *http.Client
+
+	// Transport carries health checks when Client is nil (nil = http.DefaultTransport)
+	Transport http.RoundTripper
+
+	// Metrics is the metrics collector (nil = metrics on the default registry)
+	Metrics *Metrics
+
+	mu sync.RWMutex
+}
+
+// Common errors
+var (
+	ErrInvalidCheckURL = errors.New("invalid health check URL")
+	ErrCheckNotFound   = errors.New("health check not found")
+	ErrUnhealthy       = errors.New("upstream unhealthy")
+)
+
+// DefaultConfig returns default health check configuration with no checks
+func DefaultConfig() *Config {
+	return &Config{
+		Checks: make(map[string]*Check),
+	}
+}
+
+// AddCheck validates a health check, fills in its defaults, and adds or replaces it for its lease
+// Checks must be added before the Checker is created
+func (c *Config) AddCheck(check *Check) error {
+	if check == nil {
+		return errors.New("health check cannot be nil")
+	}
+
+	if check.LeaseID == "" {
+		return errors.New("lease ID cannot be empty")
+	}
+	if strings.Contains(check.LeaseID, "*") {
+		return fmt.Errorf("lease ID %q cannot be a wildcard; a health check targets a single upstream", check.LeaseID)
+	}
+
+	target, err := url.Parse(check.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCheckURL, err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: %q must be an absolute http or https URL", ErrInvalidCheckURL, check.URL)
+	}
+
+	if check.Path == "" {
+		check.Path = "/health"
+	}
+	if !strings.HasPrefix(check.Path, "/") {
+		return fmt.Errorf("%w: path %q must start with /", ErrInvalidCheckURL, check.Path)
+	}
+	check.target = target.JoinPath(check.Path)
+
+	if check.Interval < 0 || check.Timeout < 0 || check.FailureThreshold < 0 {
+		return errors.New("interval, timeout and failure threshold cannot be negative")
+	}
+	if check.ExpectedStatus != 0 && (check.ExpectedStatus < 100 || check.ExpectedStatus > 599) {
+		return fmt.Errorf("invalid expected status %d", check.ExpectedStatus)
+	}
+
+	if check.Interval == 0 {
+		check.Interval = 10 * time.Second
+	}
+	if check.Timeout == 0 {
+		check.Timeout = 2 * time.Second
+	}
+	check.Timeout = min(check.Timeout, check.Interval)
+	if check.FailureThreshold == 0 {
+		check.FailureThreshold = 1
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Checks == nil {
+		c.Checks = make(map[string]*Check)
+	}
+	c.Checks[check.LeaseID] = check
+	return nil
+}
+
+// RemoveCheck removes the health check for a lease
+func (c *Config) RemoveCheck(leaseID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.Checks[leaseID]; !exists {
+		return fmt.Errorf("%w: %s", ErrCheckNotFound, leaseID)
+	}
+
+	delete(c.Checks, leaseID)
+	return nil
+}
+
+// GetCheck returns the health check for a lease, or nil if its upstream is not checked
+func (c *Config) GetCheck(leaseID string) *Check {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.Checks[leaseID]
+}
+
+// ListChecks returns all health checks sorted by lease ID
+func (c *Config) ListChecks() []*Check {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	checks := make([]*Check, 0, len(c.Checks))
+	for _, check := range c.Checks {
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].LeaseID < checks[j].LeaseID })
+	return checks
+}
+
+// Checker actively checks lease upstreams and tracks their health
+type Checker struct {
+	config  *Config
+	client  *http.Client
+	metrics *Metrics
+
+	mu       sync.RWMutex
+	statuses map[string]*Status
+
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewChecker creates a health checker for the configured checks
+// Every upstream starts in StateUnknown until its first check completes
+func NewChecker(config *Config) *Checker {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	client := config.Client
+	if client == nil {
+		client = &http.Client{
+			Transport: config.Transport,
+			// A redirect is the upstream's answer; following it would check another service
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = NewMetrics()
+	}
+
+	statuses := make(map[string]*Status)
+	for _, check := range config.ListChecks() {
+		statuses[check.LeaseID] = &Status{
+			LeaseID:        check.LeaseID,
+			URL:            check.URL,
+			State:          StateUnknown,
+			GatesReadiness: check.GateReadiness,
+		}
+		metrics.Healthy.WithLabelValues(check.LeaseID).Set(0)
+	}
+
+	return &Checker{
+		config:   config,
+		client:   client,
+		metrics:  metrics,
+		statuses: statuses,
+	}
+}
+
+// Start checks every upstream right away and then on its interval until Stop is called
+func (c *Checker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	for _, check := range c.config.ListChecks() {
+		c.wg.Add(1)
+		go func(check *Check) {
+			defer c.wg.Done()
+
+			ticker := time.NewTicker(check.Interval)
+			defer ticker.Stop()
+
+			for {
+				c.runCheck(ctx, check)
+
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(check)
+	}
+}
+
+// Stop stops checking and waits for checks in progress to finish
+func (c *Checker) Stop() {
+	c.stopOnce.Do(func() {
+		if c.cancel != nil {
+			c.cancel()
+		}
+		c.wg.Wait()
+	})
+}
+
+// Probes reports whether a lease's upstream has a health check
+func (c *Checker) Probes(leaseID string) bool {
+	return c.config.GetCheck(leaseID) != nil
+}
+
+// Probe checks a lease's upstream now and records the result, e.g. as a circuit breaker's
+// half-open probe; it returns nil only if the upstream is healthy
+func (c *Checker) Probe(leaseID string) error {
+	check := c.config.GetCheck(leaseID)
+	if check == nil {
+		return fmt.Errorf("%w: %s", ErrCheckNotFound, leaseID)
+	}
+
+	return c.runCheck(context.Background(), check)
+}
+
+// Status returns the health of a lease's upstream
+func (c *Checker) Status(leaseID string) (*Status, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status, exists := c.statuses[leaseID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrCheckNotFound, leaseID)
+	}
+
+	snapshot := *status
+	return &snapshot, nil
+}
+
+// Statuses returns the health of every checked upstream sorted by lease ID
+func (c *Checker) Statuses() []*Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	statuses := make([]*Status, 0, len(c.statuses))
+	for _, status := range c.statuses {
+		snapshot := *status
+		statuses = append(statuses, &snapshot)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].LeaseID < statuses[j].LeaseID })
+	return statuses
+}
+
+// NotReady returns the lease IDs whose upstream gates readiness and is not healthy, sorted
+// The gateway is ready when it is empty
+func (c *Checker) NotReady() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var leaseIDs []string
+	for leaseID, status := range c.statuses {
+		if status.GatesReadiness && status.State != StateHealthy {
+			leaseIDs = append(leaseIDs, leaseID)
+		}
+	}
+	sort.Strings(leaseIDs)
+	return leaseIDs
+}
+
+// runCheck sends one health check and records its result
+func (c *Checker) runCheck(ctx context.Context, check *Check) error {
+	err := c.send(ctx, check)
+
+	// A check cut short by Stop says nothing about the upstream
+	if ctx.Err() != nil {
+		return err
+	}
+
+	c.record(check, err)
+	return err
+}
+
+// send requests the upstream's health endpoint and compares the status
+func (c *Checker) send(ctx context.Context, check *Check) error {
+	ctx, cancel := context.WithTimeout(ctx, check.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, check.target.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "portal-gateway-healthcheck")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnhealthy, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	healthy := resp.StatusCode >= 200 && resp.StatusCode <= 299
+	if check.ExpectedStatus != 0 {
+		healthy = resp.StatusCode == check.ExpectedStatus
+	}
+	if !healthy {
+		return fmt.Errorf("%w: status %d", ErrUnhealthy, resp.StatusCode)
+	}
+	return nil
+}
+
+// record updates a lease's status with a check result
+func (c *Checker) record(check *Check, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status, exists := c.statuses[check.LeaseID]
+	if !exists {
+		return
+	}
+
+	now := time.Now()
+	status.LastCheck = now
+
+	if err == nil {
+		status.State = StateHealthy
+		status.ConsecutiveFailures = 0
+		status.LastSuccess = now
+		status.LastError = ""
+		c.metrics.ChecksTotal.WithLabelValues(check.LeaseID, "success").Inc()
+		c.metrics.Healthy.WithLabelValues(check.LeaseID).Set(1)
+		return
+	}
+
+	status.ConsecutiveFailures++
+	status.LastError = err.Error()
+	if status.ConsecutiveFailures >= check.FailureThreshold {
+		status.State = StateUnhealthy
+	}
+	c.metrics.ChecksTotal.WithLabelValues(check.LeaseID, "failure").Inc()
+	if status.State != StateHealthy {
+		c.metrics.Healthy.WithLabelValues(check.LeaseID).Set(0)
+	}
+}
@@ -0,0 +1,185 @@
+package healthcheck
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestChecker creates a checker for the given checks with metrics on a private registry
+func newTestChecker(t *testing.T, checks ...*Check) *Checker {
+	t.Helper()
+
+	config := DefaultConfig()
+	config.Metrics = NewMetricsWithRegistry(prometheus.NewRegistry())
+	for _, check := range checks {
+		if err := config.AddCheck(check); err != nil {
+			t.Fatalf("Failed to add check: %v", err)
+		}
+	}
+	return NewChecker(config)
+}
+
+// waitForState waits until a lease's upstream reaches state
+func waitForState(t *testing.T, checker *Checker, leaseID, state string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		status, err := checker.Status(leaseID)
+		if err != nil {
+			t.Fatalf("Failed to get status: %v", err)
+		}
+		if status.State == state {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s to become %s, still %s", leaseID, state, status.State)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCheckerTracksHealth(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	var path atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path.Store(r.URL.Path)
+		if healthy.Load() {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	checker := newTestChecker(t, &Check{
+		LeaseID:          "lease-1",
+		URL:              server.URL + "/api",
+		Path:             "/healthz",
+		Interval:         10 * time.Millisecond,
+		FailureThreshold: 2,
+		GateReadiness:    true,
+	})
+
+	// Unchecked upstreams gate readiness
+	if notReady := checker.NotReady(); len(notReady) != 1 || notReady[0] != "lease-1" {
+		t.Errorf("Expected lease-1 to gate readiness before its first check, got %v", notReady)
+	}
+
+	checker.Start()
+	defer checker.Stop()
+
+	waitForState(t, checker, "lease-1", StateHealthy)
+	if got := path.Load(); got != "/api/healthz" {
+		t.Errorf("Expected check path /api/healthz, got %v", got)
+	}
+	if notReady := checker.NotReady(); len(notReady) != 0 {
+		t.Errorf("Expected ready, got %v", notReady)
+	}
+
+	healthy.Store(false)
+	waitForState(t, checker, "lease-1", StateUnhealthy)
+
+	status, _ := checker.Status("lease-1")
+	if status.ConsecutiveFailures < 2 || status.LastError == "" || status.LastSuccess.IsZero() {
+		t.Errorf("Expected failures, an error and a last success, got %+v", status)
+	}
+	if notReady := checker.NotReady(); len(notReady) != 1 {
+		t.Errorf("Expected lease-1 to gate readiness, got %v", notReady)
+	}
+
+	healthy.Store(true)
+	waitForState(t, checker, "lease-1", StateHealthy)
+}
+
+func TestCheckerExpectedStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	checker := newTestChecker(t,
+		&Check{LeaseID: "any-2xx", URL: server.URL},
+		&Check{LeaseID: "expects-204", URL: server.URL, ExpectedStatus: http.StatusNoContent},
+	)
+
+	if err := checker.Probe("any-2xx"); err != nil {
+		t.Errorf("Expected any 2xx to pass, got %v", err)
+	}
+	if err := checker.Probe("expects-204"); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("Expected ErrUnhealthy for an unexpected status, got %v", err)
+	}
+	if err := checker.Probe("missing"); !errors.Is(err, ErrCheckNotFound) {
+		t.Errorf("Expected ErrCheckNotFound, got %v", err)
+	}
+
+	// Upstreams that do not gate readiness never make the gateway unready
+	if notReady := checker.NotReady(); len(notReady) != 0 {
+		t.Errorf("Expected no readiness gates, got %v", notReady)
+	}
+
+	statuses := checker.Statuses()
+	if len(statuses) != 2 || statuses[0].State != StateHealthy || statuses[1].State != StateUnhealthy {
+		t.Errorf("Expected any-2xx healthy and expects-204 unhealthy, got %+v", statuses)
+	}
+
+	metric := &dto.Metric{}
+	checker.metrics.ChecksTotal.WithLabelValues("expects-204", "failure").Write(metric)
+	if metric.Counter.GetValue() != 1 {
+		t.Errorf("Expected 1 failed check, got %v", metric.Counter.GetValue())
+	}
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	checker := newTestChecker(t, &Check{LeaseID: "slow", URL: server.URL, Timeout: 20 * time.Millisecond})
+	if checker.config.GetCheck("slow").Interval != 10*time.Second {
+		t.Errorf("Expected default interval")
+	}
+
+	start := time.Now()
+	if err := checker.Probe("slow"); !errors.Is(err, ErrUnhealthy) {
+		t.Errorf("Expected ErrUnhealthy for a slow upstream, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the check to time out quickly, took %v", elapsed)
+	}
+}
+
+func TestConfigAddCheckValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		check *Check
+	}{
+		{"nil check", nil},
+		{"empty lease ID", &Check{URL: "http://backend"}},
+		{"wildcard lease ID", &Check{LeaseID: "lease-*", URL: "http://backend"}},
+		{"relative URL", &Check{LeaseID: "lease-1", URL: "backend:8080"}},
+		{"path without slash", &Check{LeaseID: "lease-1", URL: "http://backend", Path: "health"}},
+		{"negative interval", &Check{LeaseID: "lease-1", URL: "http://backend", Interval: -time.Second}},
+		{"invalid expected status", &Check{LeaseID: "lease-1", URL: "http://backend", ExpectedStatus: 42}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := DefaultConfig().AddCheck(tt.check); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package idempotency
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/portal-project/portal-gateway/portal/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// HeaderIdempotencyKey is the request header carrying the idempotency key
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+// HeaderIdempotentReplayed marks responses served from the idempotency store
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+// Metrics holds idempotency metrics
+type Metrics struct {
+	RequestsTotal *prometheus.CounterVec
+}
+
+// NewMetrics creates new idempotency metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new idempotency metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		RequestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_idempotency_requests_total",
+				Help: "Total number of requests carrying an idempotency key",
+			},
+			[]string{"result"}, // result: "stored", "not_stored", "replayed", "in_progress", "mismatch", "error"
+		),
+	}
+}
+
+// MiddlewareConfig holds idempotency middleware configuration
+type MiddlewareConfig struct {
+	// Store persists idempotency keys and responses
+	Store *SQLiteStore
+
+	// TTL is how long a stored response is replayed for
+	TTL time.Duration
+
+	// MaxBodySize is the largest response body that is stored; larger responses are not cached
+	MaxBodySize int
+
+	// CleanupInterval is how often expired keys are removed from the store
+	CleanupInterval time.Duration
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+}
+
+// DefaultMiddlewareConfig returns default middleware configuration
+func DefaultMiddlewareConfig(store *SQLiteStore) *MiddlewareConfig {
+	return &MiddlewareConfig{
+		Store:           store,
+		TTL:             24 * time.Hour,
+		MaxBodySize:     1 << 20, // 1 MB
+		CleanupInterval: 10 * time.Minute,
+	}
+}
+
+// Middleware replays stored responses for repeated idempotency keys
+type Middleware struct {
+	config *MiddlewareConfig
+
+	mu       sync.Mutex
+	inFlight map[string]struct{} // scoped keys currently being processed
+
+	stopCh  chan struct{}
+	stopMu  sync.Mutex
+	stopped bool
+}
+
+// NewMiddleware creates a new idempotency middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil || config.Store == nil {
+		panic("idempotency store cannot be nil")
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = 10 * time.Minute
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	m := &Middleware{
+		config:   config,
+		inFlight: make(map[string]struct{}),
+		stopCh:   make(chan struct{}),
+	}
+
+	// Start cleanup goroutine
+	go m.cleanupLoop()
+
+	return m
+}
+
+// cleanupLoop periodically removes expired keys
+func (m *Middleware) cleanupLoop() {
+	ticker := time.NewTicker(m.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.config.Store.DeleteExpired()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the cleanup goroutine
+func (m *Middleware) Stop() {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+
+	if !m.stopped {
+		close(m.stopCh)
+		m.stopped = true
+	}
+}
+
+// Middleware returns an http.Handler that deduplicates requests by idempotency key
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if key == "" || isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Keys are scoped per API key so tenants can never collide
+		apiKeyInfo := middleware.GetAPIKeyInfo(r.Context())
+		if apiKeyInfo == nil {
+			// No API key in context, skip deduplication
+			next.ServeHTTP(w, r)
+			return
+		}
+		keyID := apiKeyInfo.KeyID
+
+		if !m.begin(keyID, key) {
+			m.config.Metrics.RequestsTotal.WithLabelValues("in_progress").Inc()
+			problem.Write(w, r, http.StatusConflict, "idempotency_key_in_use", "A request with this idempotency key is already in progress")
+			return
+		}
+		defer m.end(keyID, key)
+
+		cached, err := m.config.Store.Get(keyID, key)
+		if err != nil {
+			// Fail open: a broken store must not block traffic
+			m.config.Metrics.RequestsTotal.WithLabelValues("error").Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if cached != nil {
+			if cached.Method != r.Method || cached.Path != r.URL.Path {
+				m.config.Metrics.RequestsTotal.WithLabelValues("mismatch").Inc()
+				problem.Write(w, r, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency key was already used for a different request")
+				return
+			}
+
+			m.config.Metrics.RequestsTotal.WithLabelValues("replayed").Inc()
+			replay(w, cached)
+			return
+		}
+
+		rec := &recordingResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+			maxBodySize:    m.config.MaxBodySize,
+		}
+
+		next.ServeHTTP(rec, r)
+
+		// Server errors and oversized bodies are not stored so the client can retry
+		if rec.statusCode >= 500 || rec.overflow {
+			m.config.Metrics.RequestsTotal.WithLabelValues("not_stored").Inc()
+			return
+		}
+
+		now := time.Now()
+		err = m.config.Store.Put(keyID, key, &CachedResponse{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			StatusCode: rec.statusCode,
+			Header:     w.Header().Clone(),
+			Body:       rec.body.Bytes(),
+			CreatedAt:  now,
+			ExpiresAt:  now.Add(m.config.TTL),
+		})
+		if err != nil {
+			m.config.Metrics.RequestsTotal.WithLabelValues("error").Inc()
+			return
+		}
+
+		m.config.Metrics.RequestsTotal.WithLabelValues("stored").Inc()
+	})
+}
+
+// begin marks a scoped key as in flight, returning false if it already is
+func (m *Middleware) begin(keyID, key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	scoped := keyID + ":" + key
+	if _, ok := m.inFlight[scoped]; ok {
+		return false
+	}
+
+	m.inFlight[scoped] = struct{}{}
+	return true
+}
+
+// end clears the in-flight mark for a scoped key
+func (m *Middleware) end(keyID, key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.inFlight, keyID+":"+key)
+}
+
+// replay writes a stored response
+func replay(w http.ResponseWriter, cached *CachedResponse) {
+	for name, values := range cached.Header {
+		w.Header()[name] = values
+	}
+
+	w.Header().Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(cached.StatusCode)
+	w.Write(cached.Body)
+}
+
+// isSafeMethod reports whether the method has no side effects to deduplicate
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// recordingResponseWriter passes the response through while recording it for storage
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+	body        bytes.Buffer
+	maxBodySize int
+	overflow    bool
+}
+
+func (rw *recordingResponseWriter) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+
+	n, err := rw.ResponseWriter.Write(b)
+
+	if !rw.overflow {
+		if rw.body.Len()+n > rw.maxBodySize {
+			rw.overflow = true
+			rw.body.Reset()
+		} else {
+			rw.body.Write(b[:n])
+		}
+	}
+
+	return n, err
+}
+
+// Flush implements http.Flusher for streaming responses
+func (rw *recordingResponseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
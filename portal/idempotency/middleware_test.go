@@ -0,0 +1,236 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestMiddleware creates a middleware with a temporary store and fresh metrics registry
+func newTestMiddleware(t *testing.T) *Middleware {
+	t.Helper()
+
+	config := DefaultMiddlewareConfig(newTestStore(t))
+	config.Metrics = NewMetricsWithRegistry(prometheus.NewRegistry())
+
+	m := NewMiddleware(config)
+	t.Cleanup(m.Stop)
+
+	return m
+}
+
+// newKeyedRequest creates a request authenticated as keyID carrying an idempotency key
+func newKeyedRequest(method, path, keyID, idempotencyKey string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader("payload"))
+	if idempotencyKey != "" {
+		req.Header.Set(HeaderIdempotencyKey, idempotencyKey)
+	}
+
+	ctx := context.WithValue(req.Context(), middleware.ContextKeyAPIKey, &middleware.APIKeyInfo{KeyID: keyID})
+	return req.WithContext(ctx)
+}
+
+// countingHandler counts calls and responds with 201 and the call number
+func countingHandler(calls *int32) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		w.Header().Set("X-Call", string(rune('0'+n)))
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	})
+}
+
+func TestMiddlewareReplaysRepeatedKey(t *testing.T) {
+	m := newTestMiddleware(t)
+
+	var calls int32
+	handler := m.Middleware(countingHandler(&calls))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+
+	if calls != 1 {
+		t.Fatalf("Expected handler to be called once, got %d", calls)
+	}
+
+	if second.Code != http.StatusCreated || second.Body.String() != "created" {
+		t.Errorf("Expected replayed 201 'created', got %d %q", second.Code, second.Body.String())
+	}
+
+	if second.Header().Get("X-Call") != "1" {
+		t.Errorf("Expected replayed headers from first call, got %q", second.Header().Get("X-Call"))
+	}
+
+	if second.Header().Get(HeaderIdempotentReplayed) != "true" {
+		t.Error("Expected replayed response to be marked")
+	}
+
+	if first.Header().Get(HeaderIdempotentReplayed) != "" {
+		t.Error("Expected original response not to be marked as replayed")
+	}
+}
+
+func TestMiddlewareScopesKeysPerAPIKey(t *testing.T) {
+	m := newTestMiddleware(t)
+
+	var calls int32
+	handler := m.Middleware(countingHandler(&calls))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest(http.MethodPost, "/peer/pay", "key-2", "abc"))
+
+	if calls != 2 {
+		t.Errorf("Expected handler to be called for each API key, got %d", calls)
+	}
+}
+
+func TestMiddlewarePassThrough(t *testing.T) {
+	m := newTestMiddleware(t)
+
+	var calls int32
+	handler := m.Middleware(countingHandler(&calls))
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+	}{
+		{
+			name: "no idempotency key",
+			req: func() *http.Request {
+				return newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "")
+			},
+		},
+		{
+			name: "safe method",
+			req: func() *http.Request {
+				return newKeyedRequest(http.MethodGet, "/peer/pay", "key-1", "get-key")
+			},
+		},
+		{
+			name: "no API key",
+			req: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, "/peer/pay", nil)
+				req.Header.Set(HeaderIdempotencyKey, "anon")
+				return req
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := atomic.LoadInt32(&calls)
+
+			handler.ServeHTTP(httptest.NewRecorder(), tt.req())
+			handler.ServeHTTP(httptest.NewRecorder(), tt.req())
+
+			if got := atomic.LoadInt32(&calls) - before; got != 2 {
+				t.Errorf("Expected both requests to reach the handler, got %d", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareDoesNotStoreServerErrors(t *testing.T) {
+	m := newTestMiddleware(t)
+
+	var calls int32
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+
+	if calls != 2 {
+		t.Errorf("Expected server errors to be retried, got %d calls", calls)
+	}
+}
+
+func TestMiddlewareRejectsReusedKey(t *testing.T) {
+	m := newTestMiddleware(t)
+
+	var calls int32
+	handler := m.Middleware(countingHandler(&calls))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newKeyedRequest(http.MethodPost, "/peer/refund", "key-1", "abc"))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", rec.Code)
+	}
+
+	if calls != 1 {
+		t.Errorf("Expected handler to be called once, got %d", calls)
+	}
+}
+
+func TestMiddlewareRejectsConcurrentKey(t *testing.T) {
+	m := newTestMiddleware(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("First request did not start")
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+
+	close(release)
+	<-done
+
+	if rec.Code != http.StatusConflict {
+		t.Errorf("Expected status 409, got %d", rec.Code)
+	}
+}
+
+func TestMiddlewareDoesNotStoreOversizedBody(t *testing.T) {
+	config := DefaultMiddlewareConfig(newTestStore(t))
+	config.Metrics = NewMetricsWithRegistry(prometheus.NewRegistry())
+	config.MaxBodySize = 4
+
+	m := NewMiddleware(config)
+	defer m.Stop()
+
+	var calls int32
+	handler := m.Middleware(countingHandler(&calls))
+
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+	handler.ServeHTTP(httptest.NewRecorder(), newKeyedRequest(http.MethodPost, "/peer/pay", "key-1", "abc"))
+
+	if first.Body.String() != "created" {
+		t.Errorf("Expected full body to be passed through, got %q", first.Body.String())
+	}
+
+	if calls != 2 {
+		t.Errorf("Expected oversized response not to be stored, got %d calls", calls)
+	}
+}
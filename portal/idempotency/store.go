@@ -0,0 +1,172 @@
+package idempotency
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Common errors
+var (
+	ErrStoreFailed     = errors.New("idempotency store operation failed")
+	ErrStoreInvalidKey = errors.New("invalid idempotency key")
+)
+
+// CachedResponse is a stored response for an idempotency key
+type CachedResponse struct {
+	Method     string      `json:"method"`
+	Path       string      `json:"path"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	CreatedAt  time.Time   `json:"created_at"`
+	ExpiresAt  time.Time   `json:"expires_at"`
+}
+
+// SQLiteStore persists idempotency keys and their responses in SQLite
+type SQLiteStore struct {
+	db *sql.DB
+	mu sync.RWMutex
+}
+
+// NewSQLiteStore creates a new SQLite-based idempotency store
+func NewSQLiteStore(dbPath string) (*SQLiteStore, error) {
+	if dbPath == "" {
+		return nil, errors.New("database path cannot be empty")
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	store := &SQLiteStore{
+		db: db,
+	}
+
+	if err := store.initSchema(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return store, nil
+}
+
+// initSchema creates the idempotency_keys table if it doesn't exist
+func (s *SQLiteStore) initSchema() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		key_id TEXT NOT NULL,
+		idempotency_key TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		status_code INTEGER NOT NULL,
+		headers TEXT NOT NULL,
+		body BLOB,
+		created_at DATETIME NOT NULL,
+		expires_at DATETIME NOT NULL,
+		PRIMARY KEY (key_id, idempotency_key)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_idempotency_expires_at ON idempotency_keys(expires_at);
+	`
+
+	_, err := s.db.Exec(query)
+	return err
+}
+
+// Get returns the unexpired response stored for a key, or nil if there is none
+func (s *SQLiteStore) Get(keyID, key string) (*CachedResponse, error) {
+	if key == "" {
+		return nil, ErrStoreInvalidKey
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `
+	SELECT method, path, status_code, headers, body, created_at, expires_at
+	FROM idempotency_keys
+	WHERE key_id = ? AND idempotency_key = ? AND expires_at > ?
+	`
+
+	resp := &CachedResponse{}
+	var headersJSON string
+
+	err := s.db.QueryRow(query, keyID, key, time.Now()).Scan(
+		&resp.Method,
+		&resp.Path,
+		&resp.StatusCode,
+		&headersJSON,
+		&resp.Body,
+		&resp.CreatedAt,
+		&resp.ExpiresAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+
+	if err := json.Unmarshal([]byte(headersJSON), &resp.Header); err != nil {
+		return nil, fmt.Errorf("%w: failed to unmarshal headers: %v", ErrStoreFailed, err)
+	}
+
+	return resp, nil
+}
+
+// Put stores the response for a key, replacing any expired entry
+func (s *SQLiteStore) Put(keyID, key string, resp *CachedResponse) error {
+	if key == "" {
+		return ErrStoreInvalidKey
+	}
+
+	headersJSON, err := json.Marshal(resp.Header)
+	if err != nil {
+		return fmt.Errorf("failed to marshal headers: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := `
+	INSERT OR REPLACE INTO idempotency_keys (key_id, idempotency_key, method, path, status_code, headers, body, created_at, expires_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err = s.db.Exec(query,
+		keyID, key, resp.Method, resp.Path, resp.StatusCode, string(headersJSON), resp.Body, resp.CreatedAt, resp.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+
+	return nil
+}
+
+// DeleteExpired removes all expired entries and returns the number removed
+func (s *SQLiteStore) DeleteExpired() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Close closes the database connection
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,110 @@
+package idempotency
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestStore creates a store in a temporary directory
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "idempotency.db"))
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// TestNewSQLiteStoreEmptyPath tests error handling for empty path
+func TestNewSQLiteStoreEmptyPath(t *testing.T) {
+	if _, err := NewSQLiteStore(""); err == nil {
+		t.Fatal("Expected error for empty path, got nil")
+	}
+}
+
+// TestStorePutGet tests storing and retrieving a response
+func TestStorePutGet(t *testing.T) {
+	store := newTestStore(t)
+
+	now := time.Now()
+	err := store.Put("key-1", "abc", &CachedResponse{
+		Method:     http.MethodPost,
+		Path:       "/peer/test",
+		StatusCode: http.StatusCreated,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       []byte(`{"id":1}`),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to put response: %v", err)
+	}
+
+	cached, err := store.Get("key-1", "abc")
+	if err != nil {
+		t.Fatalf("Failed to get response: %v", err)
+	}
+
+	if cached == nil {
+		t.Fatal("Expected cached response")
+	}
+
+	if cached.StatusCode != http.StatusCreated || string(cached.Body) != `{"id":1}` {
+		t.Errorf("Unexpected cached response: %+v", cached)
+	}
+
+	if cached.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected Content-Type header to be stored, got %v", cached.Header)
+	}
+
+	// Keys are scoped per API key
+	other, err := store.Get("key-2", "abc")
+	if err != nil {
+		t.Fatalf("Failed to get response: %v", err)
+	}
+
+	if other != nil {
+		t.Error("Expected no response for a different API key")
+	}
+}
+
+// TestStoreExpiry tests that expired entries are ignored and removed
+func TestStoreExpiry(t *testing.T) {
+	store := newTestStore(t)
+
+	now := time.Now()
+	err := store.Put("key-1", "expired", &CachedResponse{
+		Method:     http.MethodPost,
+		Path:       "/peer/test",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		CreatedAt:  now.Add(-2 * time.Hour),
+		ExpiresAt:  now.Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to put response: %v", err)
+	}
+
+	cached, err := store.Get("key-1", "expired")
+	if err != nil {
+		t.Fatalf("Failed to get response: %v", err)
+	}
+
+	if cached != nil {
+		t.Error("Expected expired response to be ignored")
+	}
+
+	removed, err := store.DeleteExpired()
+	if err != nil {
+		t.Fatalf("Failed to delete expired: %v", err)
+	}
+
+	if removed != 1 {
+		t.Errorf("Expected 1 expired entry removed, got %d", removed)
+	}
+}
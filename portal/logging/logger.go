@@ -21,6 +21,8 @@ const (
 type Logger struct {
 	*slog.Logger
 	levelVar *slog.LevelVar // For runtime level adjustment
+	redactor *Redactor
+	headers  []string // Request headers logged by LoggingMiddleware
 }
 
 // Config holds logger configuration
@@ -30,6 +32,10 @@ type Config struct {
 	Output io.Writer  // Output destination (default: os.Stdout)
 	// AddSource adds source file and line number to logs
 	AddSource bool
+	// Redactor hides credentials in logged request details (default: DefaultRedactor)
+	Redactor *Redactor
+	// RequestHeaders are logged with each request by LoggingMiddleware, redacted by Redactor
+	RequestHeaders []string
 }
 
 // DefaultConfig returns default logger configuration
@@ -52,14 +58,20 @@ func NewLogger(cfg *Config) *Logger {
 		cfg.Output = os.Stdout
 	}
 
+	redactor := cfg.Redactor
+	if redactor == nil {
+		redactor = DefaultRedactor()
+	}
+
 	// Create level var for runtime adjustment
 	levelVar := new(slog.LevelVar)
 	levelVar.Set(cfg.Level)
 
 	var handler slog.Handler
 	handlerOpts := &slog.HandlerOptions{
-		Level:     levelVar,
-		AddSource: cfg.AddSource,
+		Level:       levelVar,
+		AddSource:   cfg.AddSource,
+		ReplaceAttr: redactor.ReplaceAttr,
 	}
 
 	switch cfg.Format {
@@ -76,6 +88,8 @@ func NewLogger(cfg *Config) *Logger {
 	return &Logger{
 		Logger:   logger,
 		levelVar: levelVar,
+		redactor: redactor,
+		headers:  cfg.RequestHeaders,
 	}
 }
 
@@ -89,6 +103,11 @@ func (l *Logger) GetLevel() slog.Level {
 	return l.levelVar.Level()
 }
 
+// Redactor returns the redactor applied to logged request details
+func (l *Logger) Redactor() *Redactor {
+	return l.redactor
+}
+
 // WithRequestID adds request ID to the logger context
 func (l *Logger) WithRequestID(requestID string) *slog.Logger {
 	return l.With("request_id", requestID)
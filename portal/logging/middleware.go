@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -43,13 +44,20 @@ func (m *LoggingMiddleware) Middleware(next http.Handler) http.Handler {
 		// Start timing
 		start := time.Now()
 
-		// Log request start
-		m.logger.WithContext(ctx).Info("Request started",
+		// Log request start, with credentials redacted before any detail is written
+		attrs := []any{
 			slog.String("method", r.Method),
 			slog.String("path", r.URL.Path),
 			slog.String("remote_addr", r.RemoteAddr),
 			slog.String("user_agent", r.UserAgent()),
-		)
+		}
+		if r.URL.RawQuery != "" {
+			attrs = append(attrs, slog.String("query", m.logger.redactor.Query(r.URL.RawQuery)))
+		}
+		if headers := m.loggedHeaders(r.Header); len(headers) > 0 {
+			attrs = append(attrs, slog.Group("headers", headers...))
+		}
+		m.logger.WithContext(ctx).Info("Request started", attrs...)
 
 		// Process request
 		next.ServeHTTP(wrapped, r)
@@ -68,6 +76,22 @@ func (m *LoggingMiddleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// loggedHeaders returns the configured headers present on a request, redacted
+func (m *LoggingMiddleware) loggedHeaders(h http.Header) []any {
+	if len(m.logger.headers) == 0 {
+		return nil
+	}
+
+	redacted := m.logger.redactor.Header(h)
+	var attrs []any
+	for _, name := range m.logger.headers {
+		if values := redacted.Values(name); len(values) > 0 {
+			attrs = append(attrs, slog.String(http.CanonicalHeaderKey(name), strings.Join(values, ", ")))
+		}
+	}
+	return attrs
+}
+
 // loggingResponseWriter wraps http.ResponseWriter to capture status code
 type loggingResponseWriter struct {
 	http.ResponseWriter
@@ -86,6 +110,11 @@ func (rw *loggingResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // generateRequestID generates a unique request ID
 func generateRequestID() string {
 	b := make([]byte, 16)
@@ -174,6 +174,90 @@ func TestLoggingMiddlewareRequestDetails(t *testing.T) {
 	}
 }
 
+// TestLoggingMiddlewareRedaction tests that credentials never reach the log
+func TestLoggingMiddlewareRedaction(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewLogger(&Config{
+		Level:    slog.LevelInfo,
+		Format:   FormatJSON,
+		Output:   buf,
+		Redactor: NewRedactor(append(DefaultRedactHeaders, "X-Session"), append(DefaultRedactQueryParams, "token")),
+
+		RequestHeaders: []string{"Authorization", "x-api-key", "X-Session", "Accept", "X-Missing"},
+	})
+	middleware := NewLoggingMiddleware(logger)
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/peer/lease-1/items?page=2&api_key=secret-1&Token=secret-2", nil)
+	req.Header.Set("Authorization", "Bearer secret-3")
+	req.Header.Set("X-API-Key", "secret-4")
+	req.Header.Set("X-Session", "secret-5")
+	req.Header.Set("Accept", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	output := buf.String()
+	if strings.Contains(output, "secret") {
+		t.Fatalf("Expected credentials to be redacted, got %s", output)
+	}
+
+	var entry struct {
+		Query   string            `json:"query"`
+		Headers map[string]string `json:"headers"`
+	}
+	if err := json.Unmarshal([]byte(strings.SplitN(output, "\n", 2)[0]), &entry); err != nil {
+		t.Fatalf("Failed to parse log entry: %v", err)
+	}
+
+	if entry.Query != "page=2&api_key=***&Token=***" {
+		t.Errorf("Expected redacted query, got %q", entry.Query)
+	}
+
+	wantHeaders := map[string]string{
+		"Authorization": RedactedValue,
+		"X-Api-Key":     RedactedValue,
+		"X-Session":     RedactedValue,
+		"Accept":        "application/json",
+	}
+	if len(entry.Headers) != len(wantHeaders) {
+		t.Errorf("Expected headers %v, got %v", wantHeaders, entry.Headers)
+	}
+	for name, want := range wantHeaders {
+		if entry.Headers[name] != want {
+			t.Errorf("Expected header %s to be logged as %q, got %q", name, want, entry.Headers[name])
+		}
+	}
+
+	// The request itself is left untouched for the handlers behind the middleware
+	if req.Header.Get("X-API-Key") != "secret-4" {
+		t.Error("Expected the request headers not to be modified")
+	}
+}
+
+// TestLoggerRedactsFields tests that fields named like a credential are redacted wherever they are logged
+func TestLoggerRedactsFields(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewLogger(&Config{Level: slog.LevelInfo, Format: FormatJSON, Output: buf})
+
+	logger.Info("Calling upstream", "authorization", "Bearer secret", "x_api_key", "secret", "api_key", "secret", "key_id", "key1")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse log entry: %v", err)
+	}
+
+	for _, field := range []string{"authorization", "x_api_key", "api_key"} {
+		if entry[field] != RedactedValue {
+			t.Errorf("Expected field %s to be redacted, got %v", field, entry[field])
+		}
+	}
+	if entry["key_id"] != "key1" {
+		t.Errorf("Expected the key ID to be logged, got %v", entry["key_id"])
+	}
+}
+
 // TestLoggingResponseWriter tests the response writer wrapper
 func TestLoggingResponseWriter(t *testing.T) {
 	rr := httptest.NewRecorder()
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RedactedValue replaces the value of a redacted header, query parameter or log field
+const RedactedValue = "***"
+
+// Credentials redacted unless configured otherwise
+var (
+	DefaultRedactHeaders     = []string{"Authorization", "Proxy-Authorization", "X-API-Key", "Cookie", "Set-Cookie"}
+	DefaultRedactQueryParams = []string{"api_key"}
+)
+
+// Redactor hides credentials before request details are logged
+type Redactor struct {
+	headers     map[string]bool // Canonical header names
+	queryParams map[string]bool // Lowercased parameter names
+	fields      map[string]bool // Log field keys the names above may appear as
+}
+
+// NewRedactor creates a redactor for the given header and query parameter names
+// Header names are matched case-insensitively, query parameter names too, since
+// clients are not consistent about either
+func NewRedactor(headers, queryParams []string) *Redactor {
+	r := &Redactor{
+		headers:     make(map[string]bool),
+		queryParams: make(map[string]bool),
+		fields:      make(map[string]bool),
+	}
+
+	for _, name := range headers {
+		if name = strings.TrimSpace(name); name != "" {
+			r.headers[http.CanonicalHeaderKey(name)] = true
+			r.fields[fieldKey(name)] = true
+		}
+	}
+	for _, name := range queryParams {
+		if name = strings.TrimSpace(name); name != "" {
+			r.queryParams[strings.ToLower(name)] = true
+			r.fields[fieldKey(name)] = true
+		}
+	}
+
+	return r
+}
+
+// DefaultRedactor returns a redactor for the default headers and query parameters
+func DefaultRedactor() *Redactor {
+	return NewRedactor(DefaultRedactHeaders, DefaultRedactQueryParams)
+}
+
+// Header returns a copy of h with the values of redacted headers replaced
+func (r *Redactor) Header(h http.Header) http.Header {
+	redacted := h.Clone()
+	for name, values := range redacted {
+		if r.headers[http.CanonicalHeaderKey(name)] {
+			for i := range values {
+				values[i] = RedactedValue
+			}
+		}
+	}
+	return redacted
+}
+
+// Query returns a raw query string with the values of redacted parameters replaced
+// Everything else is kept as sent, so the logged query matches the request
+func (r *Redactor) Query(rawQuery string) string {
+	if rawQuery == "" || len(r.queryParams) == 0 {
+		return rawQuery
+	}
+
+	pairs := strings.Split(rawQuery, "&")
+	for i, pair := range pairs {
+		key, _, hasValue := strings.Cut(pair, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if hasValue && r.queryParams[strings.ToLower(name)] {
+			pairs[i] = key + "=" + RedactedValue
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// ReplaceAttr redacts log fields named like a redacted header or query parameter, for
+// use as slog.HandlerOptions.ReplaceAttr, so a credential logged as a field is hidden too
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if a.Value.Kind() != slog.KindGroup && r.fields[fieldKey(a.Key)] {
+		return slog.String(a.Key, RedactedValue)
+	}
+	return a
+}
+
+// fieldKey normalizes a header, parameter or field name so "X-API-Key" matches "x_api_key"
+func fieldKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "-", "_")
+}
@@ -6,13 +6,19 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/portal-project/portal-gateway/portal/service"
 )
 
 // MetricsMiddleware provides HTTP metrics collection
 type MetricsMiddleware struct {
-	metrics         *Metrics
+	metrics         *Metrics // nil when created with a custom recorder
+	recorder        Recorder
 	activeLeases    map[string]bool
 	activeLeasesMu  sync.RWMutex
+	leasePaths      []middleware.LeasePathPattern
+	classifier      *service.Classifier
 }
 
 // NewMetricsMiddleware creates a new metrics middleware
@@ -21,9 +27,51 @@ func NewMetricsMiddleware(metrics *Metrics) *MetricsMiddleware {
 		metrics = GetDefaultMetrics()
 	}
 
+	m := NewMetricsMiddlewareWithRecorder(NewPrometheusRecorder(metrics))
+	m.metrics = metrics
+	return m
+}
+
+// NewMetricsMiddlewareWithRecorder creates a new metrics middleware reporting to any backend
+func NewMetricsMiddlewareWithRecorder(recorder Recorder) *MetricsMiddleware {
+	return NewMetricsMiddlewareWithConfig(&MiddlewareConfig{Recorder: recorder})
+}
+
+// MiddlewareConfig holds metrics middleware configuration
+type MiddlewareConfig struct {
+	// Recorder receives the metrics (default: Prometheus with the default metrics)
+	Recorder Recorder
+
+	// LeasePaths are the lease routes whose paths are collapsed to their template in
+	// endpoint labels (default: middleware.DefaultLeasePathPatterns)
+	LeasePaths []middleware.LeasePathPattern
+
+	// Classifier assigns leases to services, whose name becomes the agent_type of AI agent
+	// metrics. Without one, AI agent metrics are only recorded through RecordAIAgentRequest
+	// and RecordAIAgentError
+	Classifier *service.Classifier
+}
+
+// NewMetricsMiddlewareWithConfig creates a new metrics middleware from a configuration
+func NewMetricsMiddlewareWithConfig(config *MiddlewareConfig) *MetricsMiddleware {
+	if config == nil {
+		config = &MiddlewareConfig{}
+	}
+
+	recorder := config.Recorder
+	if recorder == nil {
+		recorder = NewPrometheusRecorder(nil)
+	}
+	leasePaths := config.LeasePaths
+	if len(leasePaths) == 0 {
+		leasePaths = middleware.DefaultLeasePathPatterns()
+	}
+
 	return &MetricsMiddleware{
-		metrics:      metrics,
+		recorder:     recorder,
 		activeLeases: make(map[string]bool),
+		leasePaths:   leasePaths,
+		classifier:   config.Classifier,
 	}
 }
 
@@ -31,8 +79,8 @@ func NewMetricsMiddleware(metrics *Metrics) *MetricsMiddleware {
 func (m *MetricsMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Increment active connections
-		m.metrics.ActiveConnections.Inc()
-		defer m.metrics.ActiveConnections.Dec()
+		m.recorder.AddGauge(MetricActiveConnections, 1, nil)
+		defer m.recorder.AddGauge(MetricActiveConnections, -1, nil)
 
 		// Start timing
 		start := time.Now()
@@ -54,7 +102,7 @@ func (m *MetricsMiddleware) Middleware(next http.Handler) http.Handler {
 		// Record request bytes
 		requestBytes := r.ContentLength
 		if requestBytes > 0 && leaseID != "" {
-			m.metrics.BytesTransferredTotal.WithLabelValues("in", leaseID).Add(float64(requestBytes))
+			m.recorder.AddCounter(MetricBytesTransferredTotal, float64(requestBytes), Labels{"direction": "in", "lease_id": leaseID})
 		}
 
 		// Process request
@@ -64,20 +112,63 @@ func (m *MetricsMiddleware) Middleware(next http.Handler) http.Handler {
 		duration := time.Since(start).Seconds()
 
 		// Get endpoint path (sanitized to avoid cardinality explosion)
-		endpoint := sanitizeEndpoint(r.URL.Path)
+		endpoint := sanitizeEndpoint(r.URL.Path, m.leasePaths)
 
 		// Record metrics
 		statusStr := strconv.Itoa(wrapped.statusCode)
-		m.metrics.RequestsTotal.WithLabelValues(r.Method, endpoint, statusStr, leaseID).Inc()
-		m.metrics.RequestDuration.WithLabelValues(r.Method, endpoint, leaseID).Observe(duration)
+		m.recorder.AddCounter(MetricRequestsTotal, 1, Labels{"method": r.Method, "endpoint": endpoint, "status": statusStr, "lease_id": leaseID})
+		m.recorder.ObserveHistogram(MetricRequestDuration, duration, Labels{"method": r.Method, "endpoint": endpoint, "lease_id": leaseID})
 
 		// Record response bytes
 		if wrapped.bytesWritten > 0 && leaseID != "" {
-			m.metrics.BytesTransferredTotal.WithLabelValues("out", leaseID).Add(float64(wrapped.bytesWritten))
+			m.recorder.AddCounter(MetricBytesTransferredTotal, float64(wrapped.bytesWritten), Labels{"direction": "out", "lease_id": leaseID})
+		}
+
+		// Record per-service metrics for classified leases
+		if m.classifier != nil {
+			m.recordAgentRequest(r, leaseID, wrapped.statusCode, time.Since(start))
 		}
 	})
 }
 
+// recordAgentRequest records AI agent metrics for a request, with its lease's service as agent_type
+// This middleware runs before the ACL middleware stores the lease in the context, so the lease
+// is taken from the route; requests turned away by auth or ACL never reached an agent
+func (m *MetricsMiddleware) recordAgentRequest(r *http.Request, leaseID string, statusCode int, duration time.Duration) {
+	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
+		return
+	}
+
+	if leaseID == "" {
+		if pattern, ok := middleware.MatchLeasePath(r.URL.Path, m.leasePaths); ok {
+			leaseID, _ = pattern.Match(r.URL.Path)
+		}
+	}
+	if leaseID == "" {
+		return
+	}
+
+	agentType := m.classifier.Classify(leaseID)
+	m.RecordAIAgentRequest(agentType, leaseID, strconv.Itoa(statusCode), duration)
+	if errorType := agentErrorType(statusCode); errorType != "" {
+		m.RecordAIAgentError(agentType, leaseID, errorType)
+	}
+}
+
+// agentErrorType returns the error_type of a failed AI agent response, or "" if it did not fail
+func agentErrorType(statusCode int) string {
+	switch {
+	case statusCode == http.StatusGatewayTimeout:
+		return "timeout"
+	case statusCode == http.StatusServiceUnavailable:
+		return "unavailable"
+	case statusCode >= 500:
+		return "upstream_error"
+	default:
+		return ""
+	}
+}
+
 // trackActiveLease adds a lease to the active set
 func (m *MetricsMiddleware) trackActiveLease(leaseID string) {
 	m.activeLeasesMu.Lock()
@@ -87,7 +178,7 @@ func (m *MetricsMiddleware) trackActiveLease(leaseID string) {
 	m.activeLeases[leaseID] = true
 
 	if !wasActive {
-		m.metrics.ActiveLeases.Inc()
+		m.recorder.AddGauge(MetricActiveLeases, 1, nil)
 	}
 }
 
@@ -101,30 +192,37 @@ func (m *MetricsMiddleware) untrackActiveLease(leaseID string) {
 	// A more sophisticated implementation would use reference counting
 }
 
+// ActiveLeases returns how many leases are in the active set behind portal_active_leases
+func (m *MetricsMiddleware) ActiveLeases() int {
+	m.activeLeasesMu.RLock()
+	defer m.activeLeasesMu.RUnlock()
+	return len(m.activeLeases)
+}
+
 // RecordRateLimitExceeded records a rate limit exceeded event
 func (m *MetricsMiddleware) RecordRateLimitExceeded(leaseID, limitType string) {
-	m.metrics.RateLimitExceeded.WithLabelValues(leaseID, limitType).Inc()
+	m.recorder.AddCounter(MetricRateLimitExceeded, 1, Labels{"lease_id": leaseID, "limit_type": limitType})
 }
 
 // RecordQuotaExceeded records a quota exceeded event
 func (m *MetricsMiddleware) RecordQuotaExceeded(keyID, quotaType string) {
-	m.metrics.QuotaExceeded.WithLabelValues(keyID, quotaType).Inc()
+	m.recorder.AddCounter(MetricQuotaExceeded, 1, Labels{"key_id": keyID, "quota_type": quotaType})
 }
 
 // RecordACLDenied records an ACL denied event
 func (m *MetricsMiddleware) RecordACLDenied(leaseID, reason string) {
-	m.metrics.ACLDenied.WithLabelValues(leaseID, reason).Inc()
+	m.recorder.AddCounter(MetricACLDenied, 1, Labels{"lease_id": leaseID, "reason": reason})
 }
 
 // RecordAIAgentRequest records an AI agent request
 func (m *MetricsMiddleware) RecordAIAgentRequest(agentType, leaseID, status string, duration time.Duration) {
-	m.metrics.AIAgentRequestsTotal.WithLabelValues(agentType, leaseID, status).Inc()
-	m.metrics.AIAgentLatency.WithLabelValues(agentType, leaseID).Observe(duration.Seconds())
+	m.recorder.AddCounter(MetricAIAgentRequestsTotal, 1, Labels{"agent_type": agentType, "lease_id": leaseID, "status": status})
+	m.recorder.ObserveHistogram(MetricAIAgentLatency, duration.Seconds(), Labels{"agent_type": agentType, "lease_id": leaseID})
 }
 
 // RecordAIAgentError records an AI agent error
 func (m *MetricsMiddleware) RecordAIAgentError(agentType, leaseID, errorType string) {
-	m.metrics.AIAgentErrorsTotal.WithLabelValues(agentType, leaseID, errorType).Inc()
+	m.recorder.AddCounter(MetricAIAgentErrorsTotal, 1, Labels{"agent_type": agentType, "lease_id": leaseID, "error_type": errorType})
 }
 
 // metricsResponseWriter wraps http.ResponseWriter to capture status code and bytes
@@ -145,12 +243,17 @@ func (rw *metricsResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // sanitizeEndpoint sanitizes endpoint paths to prevent cardinality explosion
 // Converts paths like /peer/lease-123 to /peer/{lease_id}
-func sanitizeEndpoint(path string) string {
+func sanitizeEndpoint(path string, leasePaths []middleware.LeasePathPattern) string {
 	// Handle common patterns
-	if strings.HasPrefix(path, "/peer/") {
-		return "/peer/{lease_id}"
+	if pattern, ok := middleware.MatchLeasePath(path, leasePaths); ok {
+		return pattern.String()
 	}
 
 	if strings.HasPrefix(path, "/admin/acl/") {
@@ -168,6 +271,7 @@ func sanitizeEndpoint(path string) string {
 	knownPaths := []string{
 		"/",
 		"/health",
+		"/readyz",
 		"/metrics",
 		"/admin/acl",
 		"/auth/validate",
@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/portal-project/portal-gateway/portal/middleware"
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 )
@@ -170,7 +171,7 @@ func TestSanitizeEndpoint(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := sanitizeEndpoint(tt.path)
+			result := sanitizeEndpoint(tt.path, middleware.DefaultLeasePathPatterns())
 			if result != tt.expected {
 				t.Errorf("Expected %q, got %q", tt.expected, result)
 			}
@@ -178,6 +179,26 @@ func TestSanitizeEndpoint(t *testing.T) {
 	}
 }
 
+// TestSanitizeEndpointCustomLeasePaths tests endpoint labels for configured lease routes
+func TestSanitizeEndpointCustomLeasePaths(t *testing.T) {
+	leasePaths, err := middleware.ParseLeasePathPatterns("/peer/{lease_id},/v2/relay/{lease_id}")
+	if err != nil {
+		t.Fatalf("ParseLeasePathPatterns failed: %v", err)
+	}
+
+	tests := map[string]string{
+		"/peer/lease-123":          "/peer/{lease_id}",
+		"/v2/relay/lease-123/chat": "/v2/relay/{lease_id}",
+		"/v2/other/lease-123":      "/v2/other/lease-123",
+	}
+
+	for path, expected := range tests {
+		if result := sanitizeEndpoint(path, leasePaths); result != expected {
+			t.Errorf("sanitizeEndpoint(%q) = %q, want %q", path, result, expected)
+		}
+	}
+}
+
 // TestGetLeaseIDFromContext tests lease ID extraction from context
 func TestGetLeaseIDFromContext(t *testing.T) {
 	// Test with nil context
@@ -33,7 +33,7 @@ func NewMetrics() *Metrics {
 		// Core metrics
 		RequestsTotal: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "portal_requests_total",
+				Name: MetricRequestsTotal,
 				Help: "Total number of HTTP requests",
 			},
 			[]string{"method", "endpoint", "status", "lease_id"},
@@ -41,7 +41,7 @@ func NewMetrics() *Metrics {
 
 		RequestDuration: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
-				Name:    "portal_request_duration_seconds",
+				Name:    MetricRequestDuration,
 				Help:    "HTTP request duration in seconds",
 				Buckets: []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0},
 			},
@@ -50,21 +50,21 @@ func NewMetrics() *Metrics {
 
 		ActiveConnections: promauto.NewGauge(
 			prometheus.GaugeOpts{
-				Name: "portal_active_connections",
+				Name: MetricActiveConnections,
 				Help: "Number of active HTTP connections",
 			},
 		),
 
 		ActiveLeases: promauto.NewGauge(
 			prometheus.GaugeOpts{
-				Name: "portal_active_leases",
+				Name: MetricActiveLeases,
 				Help: "Number of active leases with connections",
 			},
 		),
 
 		BytesTransferredTotal: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "portal_bytes_transferred_total",
+				Name: MetricBytesTransferredTotal,
 				Help: "Total bytes transferred (request + response)",
 			},
 			[]string{"direction", "lease_id"}, // direction: "in" or "out"
@@ -73,7 +73,7 @@ func NewMetrics() *Metrics {
 		// AI Agent metrics
 		AIAgentRequestsTotal: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "portal_ai_agent_requests_total",
+				Name: MetricAIAgentRequestsTotal,
 				Help: "Total number of AI agent requests",
 			},
 			[]string{"agent_type", "lease_id", "status"},
@@ -81,7 +81,7 @@ func NewMetrics() *Metrics {
 
 		AIAgentLatency: promauto.NewHistogramVec(
 			prometheus.HistogramOpts{
-				Name:    "portal_ai_agent_latency_seconds",
+				Name:    MetricAIAgentLatency,
 				Help:    "AI agent request latency in seconds",
 				Buckets: []float64{0.1, 0.5, 1.0, 2.0, 5.0, 10.0, 30.0, 60.0},
 			},
@@ -90,7 +90,7 @@ func NewMetrics() *Metrics {
 
 		AIAgentErrorsTotal: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "portal_ai_agent_errors_total",
+				Name: MetricAIAgentErrorsTotal,
 				Help: "Total number of AI agent errors",
 			},
 			[]string{"agent_type", "lease_id", "error_type"},
@@ -99,7 +99,7 @@ func NewMetrics() *Metrics {
 		// Rate limiting metrics
 		RateLimitExceeded: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "portal_rate_limit_exceeded_total",
+				Name: MetricRateLimitExceeded,
 				Help: "Total number of rate limit exceeded errors",
 			},
 			[]string{"lease_id", "limit_type"}, // limit_type: "global", "lease", "ip"
@@ -107,7 +107,7 @@ func NewMetrics() *Metrics {
 
 		QuotaExceeded: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "portal_quota_exceeded_total",
+				Name: MetricQuotaExceeded,
 				Help: "Total number of quota exceeded errors",
 			},
 			[]string{"key_id", "quota_type"}, // quota_type: "requests", "bytes", "connections"
@@ -116,7 +116,7 @@ func NewMetrics() *Metrics {
 		// ACL metrics
 		ACLDenied: promauto.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "portal_acl_denied_total",
+				Name: MetricACLDenied,
 				Help: "Total number of ACL denied requests",
 			},
 			[]string{"lease_id", "reason"}, // reason: "lease_not_found", "key_not_allowed", "ip_not_allowed"
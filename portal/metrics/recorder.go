@@ -0,0 +1,155 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metric names reported through a Recorder
+// The Prometheus adapter exports them unchanged; other backends may add a prefix
+const (
+	MetricRequestsTotal         = "portal_requests_total"
+	MetricRequestDuration       = "portal_request_duration_seconds"
+	MetricActiveConnections     = "portal_active_connections"
+	MetricActiveLeases          = "portal_active_leases"
+	MetricBytesTransferredTotal = "portal_bytes_transferred_total"
+	MetricAIAgentRequestsTotal  = "portal_ai_agent_requests_total"
+	MetricAIAgentLatency        = "portal_ai_agent_latency_seconds"
+	MetricAIAgentErrorsTotal    = "portal_ai_agent_errors_total"
+	MetricRateLimitExceeded     = "portal_rate_limit_exceeded_total"
+	MetricQuotaExceeded         = "portal_quota_exceeded_total"
+	MetricACLDenied             = "portal_acl_denied_total"
+)
+
+// Labels are the label names and values of one observation
+type Labels map[string]string
+
+// Recorder is a metrics backend the gateway reports to
+// Implementations must be safe for concurrent use
+type Recorder interface {
+	// AddCounter adds a non-negative value to a counter
+	AddCounter(name string, value float64, labels Labels)
+
+	// AddGauge adds a delta, which may be negative, to a gauge
+	AddGauge(name string, delta float64, labels Labels)
+
+	// SetGauge sets a gauge to a value
+	SetGauge(name string, value float64, labels Labels)
+
+	// ObserveHistogram records one observation in a histogram
+	ObserveHistogram(name string, value float64, labels Labels)
+}
+
+// MultiRecorder reports every observation to each of its recorders
+type MultiRecorder []Recorder
+
+// AddCounter implements Recorder
+func (m MultiRecorder) AddCounter(name string, value float64, labels Labels) {
+	for _, r := range m {
+		r.AddCounter(name, value, labels)
+	}
+}
+
+// AddGauge implements Recorder
+func (m MultiRecorder) AddGauge(name string, delta float64, labels Labels) {
+	for _, r := range m {
+		r.AddGauge(name, delta, labels)
+	}
+}
+
+// SetGauge implements Recorder
+func (m MultiRecorder) SetGauge(name string, value float64, labels Labels) {
+	for _, r := range m {
+		r.SetGauge(name, value, labels)
+	}
+}
+
+// ObserveHistogram implements Recorder
+func (m MultiRecorder) ObserveHistogram(name string, value float64, labels Labels) {
+	for _, r := range m {
+		r.ObserveHistogram(name, value, labels)
+	}
+}
+
+// PrometheusRecorder reports to the collectors of a Metrics set
+// Names without a collector in the set are ignored
+type PrometheusRecorder struct {
+	counters   map[string]*prometheus.CounterVec
+	gauges     map[string]prometheus.Gauge
+	histograms map[string]*prometheus.HistogramVec
+}
+
+// NewPrometheusRecorder creates a recorder over the given metrics (nil = the default metrics)
+func NewPrometheusRecorder(metrics *Metrics) *PrometheusRecorder {
+	if metrics == nil {
+		metrics = GetDefaultMetrics()
+	}
+
+	r := &PrometheusRecorder{
+		counters:   make(map[string]*prometheus.CounterVec),
+		gauges:     make(map[string]prometheus.Gauge),
+		histograms: make(map[string]*prometheus.HistogramVec),
+	}
+
+	// Unset fields are skipped, so partial metric sets (as in tests) still work
+	for name, vec := range map[string]*prometheus.CounterVec{
+		MetricRequestsTotal:         metrics.RequestsTotal,
+		MetricBytesTransferredTotal: metrics.BytesTransferredTotal,
+		MetricAIAgentRequestsTotal:  metrics.AIAgentRequestsTotal,
+		MetricAIAgentErrorsTotal:    metrics.AIAgentErrorsTotal,
+		MetricRateLimitExceeded:     metrics.RateLimitExceeded,
+		MetricQuotaExceeded:         metrics.QuotaExceeded,
+		MetricACLDenied:             metrics.ACLDenied,
+	} {
+		if vec != nil {
+			r.counters[name] = vec
+		}
+	}
+
+	for name, gauge := range map[string]prometheus.Gauge{
+		MetricActiveConnections: metrics.ActiveConnections,
+		MetricActiveLeases:      metrics.ActiveLeases,
+	} {
+		if gauge != nil {
+			r.gauges[name] = gauge
+		}
+	}
+
+	for name, vec := range map[string]*prometheus.HistogramVec{
+		MetricRequestDuration: metrics.RequestDuration,
+		MetricAIAgentLatency:  metrics.AIAgentLatency,
+	} {
+		if vec != nil {
+			r.histograms[name] = vec
+		}
+	}
+
+	return r
+}
+
+// AddCounter implements Recorder
+func (r *PrometheusRecorder) AddCounter(name string, value float64, labels Labels) {
+	if vec, ok := r.counters[name]; ok {
+		vec.With(prometheus.Labels(labels)).Add(value)
+	}
+}
+
+// AddGauge implements Recorder
+func (r *PrometheusRecorder) AddGauge(name string, delta float64, labels Labels) {
+	if gauge, ok := r.gauges[name]; ok {
+		gauge.Add(delta)
+	}
+}
+
+// SetGauge implements Recorder
+func (r *PrometheusRecorder) SetGauge(name string, value float64, labels Labels) {
+	if gauge, ok := r.gauges[name]; ok {
+		gauge.Set(value)
+	}
+}
+
+// ObserveHistogram implements Recorder
+func (r *PrometheusRecorder) ObserveHistogram(name string, value float64, labels Labels) {
+	if vec, ok := r.histograms[name]; ok {
+		vec.With(prometheus.Labels(labels)).Observe(value)
+	}
+}
@@ -0,0 +1,214 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/portal-project/portal-gateway/portal/service"
+)
+
+// fakeRecorder records every observation as a line for assertions
+type fakeRecorder struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (f *fakeRecorder) record(kind, name string, value float64, labels Labels) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lines = append(f.lines, formatStatsDLine(name, formatStatsDValue(value), kind, labels))
+}
+
+func (f *fakeRecorder) AddCounter(name string, value float64, labels Labels) {
+	f.record("c", name, value, labels)
+}
+
+func (f *fakeRecorder) AddGauge(name string, delta float64, labels Labels) {
+	f.record("g+", name, delta, labels)
+}
+
+func (f *fakeRecorder) SetGauge(name string, value float64, labels Labels) {
+	f.record("g", name, value, labels)
+}
+
+func (f *fakeRecorder) ObserveHistogram(name string, value float64, labels Labels) {
+	f.record("h", name, value, labels)
+}
+
+// TestMetricsMiddlewareWithRecorder tests that the middleware reports through a custom recorder
+func TestMetricsMiddlewareWithRecorder(t *testing.T) {
+	recorder := &fakeRecorder{}
+	m := NewMetricsMiddlewareWithRecorder(recorder)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	m.RecordQuotaExceeded("key1", "requests")
+
+	want := []string{
+		"portal_active_connections:1|g+",
+		"portal_requests_total:1|c|#endpoint:/health,lease_id:,method:GET,status:418",
+		"portal_active_connections:-1|g+",
+		"portal_quota_exceeded_total:1|c|#key_id:key1,quota_type:requests",
+	}
+
+	var got []string
+	for _, line := range recorder.lines {
+		if !strings.HasPrefix(line, MetricRequestDuration) {
+			got = append(got, line)
+		}
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected observations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestPrometheusRecorder tests that observations reach the collectors of the metric set
+func TestPrometheusRecorder(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_requests"}, []string{"method", "endpoint", "status", "lease_id"})
+	active := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_active"})
+	reg.MustRegister(requests, active)
+
+	recorder := NewPrometheusRecorder(&Metrics{RequestsTotal: requests, ActiveConnections: active})
+
+	recorder.AddCounter(MetricRequestsTotal, 2, Labels{"method": "GET", "endpoint": "/", "status": "200", "lease_id": ""})
+	recorder.SetGauge(MetricActiveConnections, 5, nil)
+	recorder.AddGauge(MetricActiveConnections, -1, nil)
+
+	// Metrics missing from the set are ignored rather than panicking
+	recorder.AddCounter(MetricACLDenied, 1, Labels{"lease_id": "l", "reason": "r"})
+	recorder.ObserveHistogram(MetricRequestDuration, 0.1, nil)
+
+	m := &dto.Metric{}
+	requests.WithLabelValues("GET", "/", "200", "").Write(m)
+	if got := m.Counter.GetValue(); got != 2 {
+		t.Errorf("Expected counter 2, got %v", got)
+	}
+
+	m = &dto.Metric{}
+	active.Write(m)
+	if got := m.Gauge.GetValue(); got != 4 {
+		t.Errorf("Expected gauge 4, got %v", got)
+	}
+}
+
+// TestMultiRecorder tests that every recorder receives each observation
+func TestMultiRecorder(t *testing.T) {
+	a, b := &fakeRecorder{}, &fakeRecorder{}
+	MultiRecorder{a, b}.AddCounter("x", 1, nil)
+
+	if len(a.lines) != 1 || len(b.lines) != 1 {
+		t.Errorf("Expected one observation in each recorder, got %v and %v", a.lines, b.lines)
+	}
+}
+
+// TestFormatStatsDLine tests DogStatsD line formatting
+func TestFormatStatsDLine(t *testing.T) {
+	tests := []struct {
+		name, value, kind string
+		labels            Labels
+		want              string
+	}{
+		{"portal_requests_total", "1", "c", nil, "portal_requests_total:1|c"},
+		{"portal_active_connections", "+1", "g", nil, "portal_active_connections:+1|g"},
+		{"lat", "0.25", "h", Labels{"b": "2", "a": "x|y"}, "lat:0.25|h|#a:x_y,b:2"},
+	}
+
+	for _, tt := range tests {
+		if got := formatStatsDLine(tt.name, tt.value, tt.kind, tt.labels); got != tt.want {
+			t.Errorf("formatStatsDLine(%s) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestStatsDRecorder tests that observations are sent to the agent over UDP
+func TestStatsDRecorder(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	recorder, err := NewStatsDRecorder(conn.LocalAddr().String(), "gw.")
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	defer recorder.Close()
+
+	recorder.AddCounter(MetricQuotaExceeded, 1, Labels{"key_id": "k"})
+	recorder.AddGauge(MetricActiveConnections, -1, nil)
+	recorder.SetGauge(MetricActiveLeases, 3, nil)
+	recorder.ObserveHistogram(MetricRequestDuration, 0.5, nil)
+
+	var got []string
+	buf := make([]byte, 512)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for len(got) < 4 {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("Failed to read packet: %v", err)
+		}
+		got = append(got, string(buf[:n]))
+	}
+	sort.Strings(got)
+
+	want := []string{
+		"gw.portal_active_connections:-1|g",
+		"gw.portal_active_leases:3|g",
+		"gw.portal_quota_exceeded_total:1|c|#key_id:k",
+		"gw.portal_request_duration_seconds:0.5|h",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected packets:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+// TestMetricsMiddlewareClassifier tests that classified lease requests are recorded as AI agent metrics
+func TestMetricsMiddlewareClassifier(t *testing.T) {
+	classifier, err := service.NewClassifier([]*service.Rule{{Service: "mcp", Prefix: "mcp-"}}, "other")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	recorder := &fakeRecorder{}
+	m := NewMetricsMiddlewareWithConfig(&MiddlewareConfig{Recorder: recorder, Classifier: classifier})
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/peer/mcp-tools/call":
+			w.WriteHeader(http.StatusGatewayTimeout)
+		case "/peer/denied":
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	for _, path := range []string{"/peer/mcp-tools/call", "/peer/billing", "/peer/denied", "/health"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var got []string
+	for _, line := range recorder.lines {
+		if strings.HasPrefix(line, "portal_ai_agent_requests_total") || strings.HasPrefix(line, MetricAIAgentErrorsTotal) {
+			got = append(got, line)
+		}
+	}
+
+	want := []string{
+		"portal_ai_agent_requests_total:1|c|#agent_type:mcp,lease_id:mcp-tools,status:504",
+		"portal_ai_agent_errors_total:1|c|#agent_type:mcp,error_type:timeout,lease_id:mcp-tools",
+		"portal_ai_agent_requests_total:1|c|#agent_type:other,lease_id:billing,status:200",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected observations:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
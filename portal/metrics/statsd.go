@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StatsDRecorder reports metrics as DogStatsD lines over UDP
+// Labels become tags; sends are fire-and-forget so a missing agent never slows requests
+type StatsDRecorder struct {
+	conn   net.Conn
+	prefix string
+}
+
+// NewStatsDRecorder creates a recorder sending to a StatsD agent at addr (host:port)
+// prefix is prepended to every metric name, e.g. "gateway."
+func NewStatsDRecorder(addr, prefix string) (*StatsDRecorder, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD agent: %w", err)
+	}
+
+	return &StatsDRecorder{conn: conn, prefix: prefix}, nil
+}
+
+// AddCounter implements Recorder
+func (r *StatsDRecorder) AddCounter(name string, value float64, labels Labels) {
+	r.send(name, formatStatsDValue(value), "c", labels)
+}
+
+// AddGauge implements Recorder
+func (r *StatsDRecorder) AddGauge(name string, delta float64, labels Labels) {
+	// A leading sign makes the agent adjust the gauge instead of setting it
+	value := formatStatsDValue(delta)
+	if delta >= 0 {
+		value = "+" + value
+	}
+	r.send(name, value, "g", labels)
+}
+
+// SetGauge implements Recorder
+func (r *StatsDRecorder) SetGauge(name string, value float64, labels Labels) {
+	// A negative value would be read as a delta, so reset to 0 first
+	if value < 0 {
+		r.send(name, "0", "g", labels)
+	}
+	r.send(name, formatStatsDValue(value), "g", labels)
+}
+
+// ObserveHistogram implements Recorder
+func (r *StatsDRecorder) ObserveHistogram(name string, value float64, labels Labels) {
+	r.send(name, formatStatsDValue(value), "h", labels)
+}
+
+// Close closes the connection to the agent
+func (r *StatsDRecorder) Close() error {
+	return r.conn.Close()
+}
+
+// send writes one metric line, dropping it on error
+func (r *StatsDRecorder) send(name, value, kind string, labels Labels) {
+	r.conn.Write([]byte(formatStatsDLine(r.prefix+name, value, kind, labels)))
+}
+
+// formatStatsDLine formats a DogStatsD line: name:value|kind|#tag:value,...
+// Tags are sorted so identical observations produce identical lines
+func formatStatsDLine(name, value, kind string, labels Labels) string {
+	var b strings.Builder
+	b.WriteString(sanitizeStatsD(name))
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(kind)
+
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for key := range labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("|#")
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(sanitizeStatsD(key))
+			b.WriteByte(':')
+			b.WriteString(sanitizeStatsD(labels[key]))
+		}
+	}
+
+	return b.String()
+}
+
+// formatStatsDValue formats a value without exponent notation
+func formatStatsDValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// sanitizeStatsD replaces characters that delimit StatsD fields
+func sanitizeStatsD(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '|', ',', '#', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
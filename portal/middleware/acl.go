@@ -4,43 +4,162 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/headers"
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/problem"
 )
 
 // ACLRule represents an access control rule for a lease
 type ACLRule struct {
-	LeaseID        string   // Lease ID (supports wildcards like "mcp-*")
-	AllowedKeyIDs  []string // List of allowed API key IDs
-	AllowedIPRanges []*net.IPNet // CIDR ranges for IP whitelist
+	LeaseID          string       // Lease ID (supports wildcards like "mcp-*")
+	AllowedKeyIDs    []string     // List of allowed API key IDs
+	AllowedKeyGroups []string     // List of allowed key groups, expanded at check time
+	AllowedIPRanges  []*net.IPNet // CIDR ranges for IP whitelist
+
+	// AllowedTimeWindows restricts access to recurring time windows (empty = always)
+	AllowedTimeWindows []TimeWindow
+	// TimeZone is the location the time windows are evaluated in (nil = UTC)
+	TimeZone *time.Location
+
+	// ResponseHeaders are set on every response for the lease, replacing values from the backend
+	// Values may use the {lease_id} and {key_id} placeholders
+	ResponseHeaders map[string]string
+}
+
+// ACLDefaultRule is a baseline policy every lease is checked against in addition to its own rule
+// A request must pass both; the default rule can only deny, never grant access
+type ACLDefaultRule struct {
+	DeniedKeyIDs    []string     // Keys denied on every lease
+	DeniedKeyGroups []string     // Key groups denied on every lease, expanded at check time
+	AllowedIPRanges []*net.IPNet // If set, requests to any lease must come from one of these ranges
+}
+
+// TimeWindow is a recurring daily time range on selected days of the week
+// A window whose End is before its Start wraps past midnight into the next day
+type TimeWindow struct {
+	Days  []time.Weekday // Days the window opens on (empty = every day)
+	Start time.Duration  // Offset from midnight when the window opens
+	End   time.Duration  // Offset from midnight when the window closes (exclusive)
 }
 
 // ACLConfig holds the access control configuration
 type ACLConfig struct {
-	Rules map[string]*ACLRule // leaseID -> ACLRule
-	mu    sync.RWMutex
+	Rules     map[string]*ACLRule // leaseID -> ACLRule (modify through AddRule/RemoveRule so the lookup cache stays valid)
+	KeyGroups map[string][]string // group name -> member key IDs
+
+	// LeaseAliases map old lease IDs to the lease they were renamed to (modify through SetLeaseAlias/RemoveLeaseAlias)
+	// Requests for an alias are checked and handled as the canonical lease
+	LeaseAliases map[string]string
+
+	// AllowLeaseIDHeader falls back to the X-Lease-ID header when the path has no lease segment
+	AllowLeaseIDHeader bool
+
+	// DefaultAllow lets any authenticated key reach leases no rule covers (default false = fail-closed)
+	// Meant for trusted internal deployments; rules that do match are still enforced
+	DefaultAllow bool
+
+	// LogAllowedRules logs, at debug level, which rule allowed each request
+	// Useful to check a wildcard rule matches as intended; too verbose for normal production use
+	LogAllowedRules bool
+
+	// Logger receives the access decisions (nil = logging.Default())
+	Logger *logging.Logger
+
+	// LeasePaths are the routes carrying a lease ID segment (empty = DefaultLeasePathPatterns)
+	LeasePaths []LeasePathPattern
+
+	// ClientIPResolver determines the client IP checked against IP whitelists
+	// (nil = DefaultClientIPHeaders from any peer)
+	ClientIPResolver *ClientIPResolver
+
+	// LeaseStateStore persists lease states across restarts (nil = in memory only)
+	// LoadLeaseStates restores the stored states
+	LeaseStateStore LeaseStateStore
+
+	mu          sync.RWMutex
+	defaultRule *ACLDefaultRule  // Checked for every lease (nil = none)
+	now         func() time.Time // Clock used for time window checks
+	ruleCache   *aclRuleCache    // Resolved rules per concrete lease ID (nil = no caching)
+
+	disabledLeases map[string]*LeaseState // Leases cut off by an administrator (modify through SetLeaseEnabled)
 }
 
+// HeaderLeaseID is the request header carrying the lease ID when it is not in the path
+const HeaderLeaseID = "X-Lease-ID"
+
+// maxLeaseIDLength is the longest lease ID accepted from a request
+const maxLeaseIDLength = 256
+
 // ACLMiddleware provides lease-based access control
 type ACLMiddleware struct {
-	config *ACLConfig
+	config   *ACLConfig
+	clientIP *ClientIPResolver
+	logger   *logging.Logger
 }
 
 // Common errors
 var (
-	ErrLeaseNotFound       = errors.New("lease not found")
-	ErrAccessDenied        = errors.New("access denied to this lease")
-	ErrInvalidLeaseID      = errors.New("invalid lease ID")
-	ErrInvalidIPRange      = errors.New("invalid IP range")
-	ErrIPNotWhitelisted    = errors.New("IP address not whitelisted")
+	ErrLeaseNotFound    = errors.New("lease not found")
+	ErrAccessDenied     = errors.New("access denied to this lease")
+	ErrInvalidLeaseID   = errors.New("invalid lease ID")
+	ErrInvalidIPRange   = errors.New("invalid IP range")
+	ErrIPNotWhitelisted = errors.New("IP address not whitelisted")
+	ErrInvalidKeyGroup  = errors.New("invalid key group")
+	ErrKeyGroupNotFound = errors.New("key group not found")
+
+	ErrInvalidTimeWindow    = errors.New("invalid time window")
+	ErrOutsideAllowedWindow = errors.New("access outside allowed time window")
+
+	ErrInvalidResponseHeader = errors.New("invalid response header")
+
+	// ErrDeniedByDefaultRule is wrapped with ErrAccessDenied or ErrIPNotWhitelisted when the
+	// default rule, rather than the lease's rule, denied a request
+	ErrDeniedByDefaultRule = errors.New("denied by default ACL rule")
 )
 
 // NewACLConfig creates a new ACL configuration
 func NewACLConfig() *ACLConfig {
 	return &ACLConfig{
-		Rules: make(map[string]*ACLRule),
+		Rules:        make(map[string]*ACLRule),
+		KeyGroups:    make(map[string][]string),
+		LeaseAliases: make(map[string]string),
+		now:          time.Now,
+		ruleCache:    newACLRuleCache(DefaultACLRuleCacheSize),
+	}
+}
+
+// SetRuleCacheSize resizes the rule lookup cache, dropping its contents
+// A size of 0 or less disables caching
+func (c *ACLConfig) SetRuleCacheSize(size int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if size <= 0 {
+		c.ruleCache = nil
+		return
+	}
+	c.ruleCache = newACLRuleCache(size)
+}
+
+// leasePaths returns the configured lease paths or the /peer default
+func (c *ACLConfig) leasePaths() []LeasePathPattern {
+	if len(c.LeasePaths) == 0 {
+		return defaultLeasePaths
+	}
+	return c.LeasePaths
+}
+
+// invalidateRuleCache drops cached lookups after a rule change; callers hold c.mu
+func (c *ACLConfig) invalidateRuleCache() {
+	if c.ruleCache != nil {
+		c.ruleCache.purge()
 	}
 }
 
@@ -62,10 +181,23 @@ func (c *ACLConfig) AddRule(rule *ACLRule) error {
 		}
 	}
 
+	for _, window := range rule.AllowedTimeWindows {
+		if err := window.validate(); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range rule.ResponseHeaders {
+		if err := validateResponseHeader(name, value); err != nil {
+			return err
+		}
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.Rules[rule.LeaseID] = rule
+	c.invalidateRuleCache()
 	return nil
 }
 
@@ -83,6 +215,7 @@ func (c *ACLConfig) RemoveRule(leaseID string) error {
 	}
 
 	delete(c.Rules, leaseID)
+	c.invalidateRuleCache()
 	return nil
 }
 
@@ -92,6 +225,22 @@ func (c *ACLConfig) GetRule(leaseID string) *ACLRule {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
+	if c.ruleCache == nil {
+		return c.resolveRule(leaseID)
+	}
+
+	if rule, ok := c.ruleCache.get(leaseID); ok {
+		return rule
+	}
+
+	// Stored under the read lock so a concurrent AddRule/RemoveRule cannot be overtaken by a stale entry
+	rule := c.resolveRule(leaseID)
+	c.ruleCache.put(leaseID, rule)
+	return rule
+}
+
+// resolveRule finds the rule for a lease without consulting the cache; callers hold c.mu
+func (c *ACLConfig) resolveRule(leaseID string) *ACLRule {
 	// First, try exact match
 	if rule, exists := c.Rules[leaseID]; exists {
 		return rule
@@ -107,6 +256,22 @@ func (c *ACLConfig) GetRule(leaseID string) *ACLRule {
 	return nil
 }
 
+// SetDefaultRule sets the rule every lease is checked against (nil removes it)
+func (c *ACLConfig) SetDefaultRule(rule *ACLDefaultRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.defaultRule = rule
+}
+
+// GetDefaultRule returns the rule every lease is checked against, or nil if there is none
+func (c *ACLConfig) GetDefaultRule() *ACLDefaultRule {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.defaultRule
+}
+
 // ListRules returns all ACL rules
 func (c *ACLConfig) ListRules() []*ACLRule {
 	c.mu.RLock()
@@ -119,42 +284,316 @@ func (c *ACLConfig) ListRules() []*ACLRule {
 	return rules
 }
 
+// SetKeyGroup creates or replaces a named key group
+// Membership changes apply to every rule referencing the group
+func (c *ACLConfig) SetKeyGroup(name string, keyIDs []string) error {
+	if name == "" {
+		return ErrInvalidKeyGroup
+	}
+
+	members := make([]string, len(keyIDs))
+	copy(members, keyIDs)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.KeyGroups == nil {
+		c.KeyGroups = make(map[string][]string)
+	}
+
+	c.KeyGroups[name] = members
+	return nil
+}
+
+// RemoveKeyGroup removes a named key group
+// Rules still referencing the group no longer grant access through it
+func (c *ACLConfig) RemoveKeyGroup(name string) error {
+	if name == "" {
+		return ErrInvalidKeyGroup
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.KeyGroups[name]; !exists {
+		return fmt.Errorf("%w: %s", ErrKeyGroupNotFound, name)
+	}
+
+	delete(c.KeyGroups, name)
+	return nil
+}
+
+// GetKeyGroup returns the members of a key group
+// Returns nil if the group does not exist
+func (c *ACLConfig) GetKeyGroup(name string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	members, exists := c.KeyGroups[name]
+	if !exists {
+		return nil
+	}
+
+	result := make([]string, len(members))
+	copy(result, members)
+	return result
+}
+
+// ListKeyGroups returns a copy of all key groups
+func (c *ACLConfig) ListKeyGroups() map[string][]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	groups := make(map[string][]string, len(c.KeyGroups))
+	for name, members := range c.KeyGroups {
+		result := make([]string, len(members))
+		copy(result, members)
+		groups[name] = result
+	}
+	return groups
+}
+
+// inKeyGroups checks if a key is a member of any of the given groups
+func (c *ACLConfig) inKeyGroups(groups []string, keyID string) bool {
+	if len(groups) == 0 {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, group := range groups {
+		if contains(c.KeyGroups[group], keyID) {
+			return true
+		}
+	}
+	return false
+}
+
 // CheckAccess checks if an API key has access to a lease from a given IP
 func (c *ACLConfig) CheckAccess(leaseID, keyID string, ip net.IP) error {
+	_, err := c.MatchAccess(leaseID, keyID, ip)
+	return err
+}
+
+// MatchAccess checks access exactly like CheckAccess and also returns the rule
+// the lease matched, which is nil when no rule covers the lease
+func (c *ACLConfig) MatchAccess(leaseID, keyID string, ip net.IP) (*ACLRule, error) {
 	if leaseID == "" {
-		return ErrInvalidLeaseID
+		return nil, ErrInvalidLeaseID
+	}
+
+	// A disabled lease is cut off whatever its rule allows, and keeps its rule for when it is enabled again
+	if c.leaseDisabled(leaseID) {
+		return nil, ErrLeaseDisabled
 	}
 
 	rule := c.GetRule(leaseID)
 
-	// If no rule exists, deny access by default (fail-closed)
+	// If no rule exists, deny access unless default-allow is enabled (fail-closed)
+	if rule == nil && !c.DefaultAllow {
+		return nil, ErrLeaseNotFound
+	}
+
+	// The default rule comes first, so no lease rule can exempt a key or IP from it
+	if err := c.checkDefaultRule(keyID, ip); err != nil {
+		return rule, err
+	}
+
 	if rule == nil {
-		return ErrLeaseNotFound
+		return nil, nil
 	}
 
-	// Check API key whitelist
-	if !contains(rule.AllowedKeyIDs, keyID) {
-		return ErrAccessDenied
+	// Check API key whitelist, directly or through a key group
+	if !contains(rule.AllowedKeyIDs, keyID) && !c.inKeyGroups(rule.AllowedKeyGroups, keyID) {
+		return rule, ErrAccessDenied
 	}
 
 	// Check IP whitelist if configured
 	if len(rule.AllowedIPRanges) > 0 {
 		if !isIPAllowed(ip, rule.AllowedIPRanges) {
-			return ErrIPNotWhitelisted
+			return rule, ErrIPNotWhitelisted
 		}
 	}
 
+	// Check time windows if configured
+	if len(rule.AllowedTimeWindows) > 0 {
+		if !rule.inTimeWindow(c.clock()) {
+			return rule, ErrOutsideAllowedWindow
+		}
+	}
+
+	return rule, nil
+}
+
+// checkDefaultRule checks a request against the rule applied to every lease
+func (c *ACLConfig) checkDefaultRule(keyID string, ip net.IP) error {
+	defaultRule := c.GetDefaultRule()
+	if defaultRule == nil {
+		return nil
+	}
+
+	if contains(defaultRule.DeniedKeyIDs, keyID) || c.inKeyGroups(defaultRule.DeniedKeyGroups, keyID) {
+		return fmt.Errorf("%w: %w", ErrDeniedByDefaultRule, ErrAccessDenied)
+	}
+
+	if len(defaultRule.AllowedIPRanges) > 0 && !isIPAllowed(ip, defaultRule.AllowedIPRanges) {
+		return fmt.Errorf("%w: %w", ErrDeniedByDefaultRule, ErrIPNotWhitelisted)
+	}
+
 	return nil
 }
 
+// clock returns the current time
+func (c *ACLConfig) clock() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// inTimeWindow checks if t falls inside any of the rule's time windows
+func (r *ACLRule) inTimeWindow(t time.Time) bool {
+	loc := r.TimeZone
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+
+	for _, window := range r.AllowedTimeWindows {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains checks if t (already in the rule's time zone) falls inside the window
+func (w TimeWindow) contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	offset := t.Sub(midnight)
+
+	if w.Start < w.End {
+		return w.onDay(t.Weekday()) && offset >= w.Start && offset < w.End
+	}
+
+	// Window wraps past midnight: the tail belongs to the previous day's window
+	if offset >= w.Start && w.onDay(t.Weekday()) {
+		return true
+	}
+	previous := (t.Weekday() + 6) % 7
+	return offset < w.End && w.onDay(previous)
+}
+
+// onDay checks if the window opens on the given day
+func (w TimeWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the window bounds are within a day and not empty
+func (w TimeWindow) validate() error {
+	if w.Start < 0 || w.Start >= 24*time.Hour || w.End < 0 || w.End > 24*time.Hour {
+		return fmt.Errorf("%w: start and end must be within a day", ErrInvalidTimeWindow)
+	}
+	if w.Start == w.End {
+		return fmt.Errorf("%w: start and end must differ", ErrInvalidTimeWindow)
+	}
+	return nil
+}
+
+// weekdayNames maps day names and abbreviations to weekdays
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// ParseTimeWindow parses a time window from day names (e.g. "mon") and "HH:MM" start/end times
+func ParseTimeWindow(days []string, start, end string) (TimeWindow, error) {
+	var window TimeWindow
+
+	for _, name := range days {
+		day, ok := weekdayNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return TimeWindow{}, fmt.Errorf("%w: unknown day %q", ErrInvalidTimeWindow, name)
+		}
+		window.Days = append(window.Days, day)
+	}
+
+	var err error
+	if window.Start, err = parseClock(start); err != nil {
+		return TimeWindow{}, err
+	}
+	if window.End, err = parseClock(end); err != nil {
+		return TimeWindow{}, err
+	}
+
+	if err := window.validate(); err != nil {
+		return TimeWindow{}, err
+	}
+
+	return window, nil
+}
+
+// Format returns the window as day abbreviations and "HH:MM" start/end times
+func (w TimeWindow) Format() (days []string, start, end string) {
+	for _, day := range w.Days {
+		days = append(days, strings.ToLower(day.String()[:3]))
+	}
+	return days, formatClock(w.Start), formatClock(w.End)
+}
+
+// parseClock parses an "HH:MM" time of day into an offset from midnight
+// "24:00" is accepted as the end of the day
+func parseClock(value string) (time.Duration, error) {
+	var hours, minutes int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hours, &minutes); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("%w: time %q must be HH:MM", ErrInvalidTimeWindow, value)
+	}
+
+	if minutes < 0 || minutes > 59 || hours < 0 || hours > 24 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("%w: time %q out of range", ErrInvalidTimeWindow, value)
+	}
+
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// formatClock formats an offset from midnight as "HH:MM"
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
 // NewACLMiddleware creates a new ACL middleware
 func NewACLMiddleware(config *ACLConfig) *ACLMiddleware {
 	if config == nil {
 		config = NewACLConfig()
 	}
 	return &ACLMiddleware{
-		config: config,
+		config:   config,
+		clientIP: config.ClientIPResolver,
+		logger:   config.Logger,
+	}
+}
+
+// log returns the logger for a request
+func (m *ACLMiddleware) log(ctx context.Context) *slog.Logger {
+	logger := m.logger
+	if logger == nil {
+		logger = logging.Default()
 	}
+	return logger.WithContext(ctx)
 }
 
 // Middleware returns an http.Handler that performs ACL checks
@@ -163,112 +602,145 @@ func (m *ACLMiddleware) Middleware(next http.Handler) http.Handler {
 		// Get API key info from context (set by auth middleware)
 		apiKeyInfo := GetAPIKeyInfo(r.Context())
 		if apiKeyInfo == nil {
-			m.handleACLError(w, errors.New("authentication required"))
+			m.handleACLError(w, r, errors.New("authentication required"))
 			return
 		}
 
-		// Extract lease ID from URL path
-		// Expected format: /peer/{leaseID}/...
-		leaseID := extractLeaseID(r.URL.Path)
-		if leaseID == "" {
-			m.handleACLError(w, ErrInvalidLeaseID)
+		// Extract lease ID from URL path, or the header if enabled
+		// Expected format: a configured lease path, /peer/{leaseID}/... by default
+		leaseID := m.requestLeaseID(r)
+		if !isValidLeaseID(leaseID) {
+			m.handleACLError(w, r, ErrInvalidLeaseID)
+			return
+		}
+
+		// Resolve renamed leases so every downstream layer sees the canonical lease ID
+		if canonical := m.config.ResolveLeaseID(leaseID); canonical != leaseID {
+			m.log(r.Context()).Debug("Lease alias resolved",
+				"alias", leaseID,
+				"lease_id", canonical,
+				"key_id", apiKeyInfo.KeyID,
+			)
+			leaseID = canonical
+		}
+
+		// A lease token only opens the lease it was issued for
+		if apiKeyInfo.LeaseID != "" && m.config.ResolveLeaseID(apiKeyInfo.LeaseID) != leaseID {
+			m.handleACLError(w, r, ErrAccessDenied)
 			return
 		}
 
 		// Get client IP
-		clientIP := getClientIP(r)
+		clientIP := m.clientIP.ClientIP(r)
 
 		// Check access
-		if err := m.config.CheckAccess(leaseID, apiKeyInfo.KeyID, clientIP); err != nil {
-			m.handleACLError(w, err)
+		rule, err := m.config.MatchAccess(leaseID, apiKeyInfo.KeyID, clientIP)
+		if err != nil {
+			m.handleACLError(w, r, err)
 			return
 		}
 
+		// A nil rule means the lease is unconfigured and was let through by default-allow
+		if rule == nil {
+			m.log(r.Context()).Debug("Lease has no ACL rule, allowed by default",
+				"lease_id", leaseID,
+				"key_id", apiKeyInfo.KeyID,
+			)
+		} else if m.config.LogAllowedRules {
+			match := "exact"
+			if strings.Contains(rule.LeaseID, "*") {
+				match = "wildcard"
+			}
+			m.log(r.Context()).Debug("ACL rule allowed request",
+				"lease_id", leaseID,
+				"key_id", apiKeyInfo.KeyID,
+				"rule", rule.LeaseID,
+				"match", match,
+			)
+		}
+
 		// Add lease ID to context for downstream handlers
-		ctx := context.WithValue(r.Context(), contextKey("lease_id"), leaseID)
+		ctx := WithLeaseID(r.Context(), leaseID)
+
+		// Stamp the lease's response headers once the backend has responded
+		handler := next
+		if rule != nil && len(rule.ResponseHeaders) > 0 {
+			handler = headers.NewMiddleware(&headers.MiddlewareConfig{
+				Headers: rule.renderResponseHeaders(leaseID, apiKeyInfo.KeyID),
+				Force:   true,
+			}).Middleware(next)
+		}
 
 		// Call next handler
-		next.ServeHTTP(w, r.WithContext(ctx))
+		handler.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 // handleACLError writes an appropriate error response
-func (m *ACLMiddleware) handleACLError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
-
+func (m *ACLMiddleware) handleACLError(w http.ResponseWriter, r *http.Request, err error) {
 	switch {
 	case errors.Is(err, ErrLeaseNotFound):
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, `{"error":"lease_not_found","message":"Lease not found or no ACL rule configured"}`)
+		problem.Write(w, r, http.StatusNotFound, "lease_not_found", "Lease not found or no ACL rule configured")
 	case errors.Is(err, ErrAccessDenied):
-		w.WriteHeader(http.StatusForbidden)
-		fmt.Fprintf(w, `{"error":"access_denied","message":"Access denied to this lease"}`)
+		problem.Write(w, r, http.StatusForbidden, "access_denied", "Access denied to this lease")
 	case errors.Is(err, ErrInvalidLeaseID):
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, `{"error":"invalid_lease_id","message":"Invalid or missing lease ID"}`)
+		problem.Write(w, r, http.StatusBadRequest, "invalid_lease_id", "Invalid or missing lease ID")
 	case errors.Is(err, ErrIPNotWhitelisted):
-		w.WriteHeader(http.StatusForbidden)
-		fmt.Fprintf(w, `{"error":"ip_not_whitelisted","message":"Your IP address is not whitelisted for this lease"}`)
+		problem.Write(w, r, http.StatusForbidden, "ip_not_whitelisted", "Your IP address is not whitelisted for this lease")
+	case errors.Is(err, ErrOutsideAllowedWindow):
+		problem.Write(w, r, http.StatusForbidden, "outside_allowed_window", "This lease is not accessible at this time")
+	case errors.Is(err, ErrLeaseDisabled):
+		problem.Write(w, r, http.StatusForbidden, "lease_disabled", "This lease has been disabled by an administrator")
 	default:
-		w.WriteHeader(http.StatusForbidden)
-		fmt.Fprintf(w, `{"error":"access_denied","message":"Access denied"}`)
+		problem.Write(w, r, http.StatusForbidden, "access_denied", "Access denied")
 	}
 }
 
-// extractLeaseID extracts the lease ID from the URL path
-// Expected format: /peer/{leaseID}/... or /peer/{leaseID}
-func extractLeaseID(urlPath string) string {
-	// Remove leading slash
-	urlPath = strings.TrimPrefix(urlPath, "/")
-
-	// Split by slash
-	parts := strings.Split(urlPath, "/")
+// requestLeaseID returns the lease ID from the path, falling back to the header if enabled
+// The path always takes precedence so a header cannot redirect a path-addressed request
+func (m *ACLMiddleware) requestLeaseID(r *http.Request) string {
+	if leaseID := extractLeaseID(r.URL.Path, m.config.leasePaths()); leaseID != "" {
+		return leaseID
+	}
 
-	// Expected: ["peer", "{leaseID}", ...]
-	if len(parts) < 2 || parts[0] != "peer" {
-		return ""
+	if m.config.AllowLeaseIDHeader {
+		return r.Header.Get(HeaderLeaseID)
 	}
 
-	return parts[1]
+	return ""
 }
 
-// getClientIP extracts the client IP address from the request
-// Checks X-Forwarded-For and X-Real-IP headers first, then falls back to RemoteAddr
-func getClientIP(r *http.Request) net.IP {
-	// Check X-Forwarded-For header
-	xff := r.Header.Get("X-Forwarded-For")
-	if xff != "" {
-		// Take the first IP in the list
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			ip := net.ParseIP(strings.TrimSpace(ips[0]))
-			if ip != nil {
-				return ip
-			}
-		}
+// isValidLeaseID reports whether a requested lease ID is well formed
+// Wildcards are only meaningful in rules, never in requested lease IDs
+func isValidLeaseID(leaseID string) bool {
+	if leaseID == "" || len(leaseID) > maxLeaseIDLength {
+		return false
 	}
 
-	// Check X-Real-IP header
-	xri := r.Header.Get("X-Real-IP")
-	if xri != "" {
-		ip := net.ParseIP(xri)
-		if ip != nil {
-			return ip
+	for _, c := range leaseID {
+		if c == '/' || c == '*' || c <= ' ' || c == 0x7f {
+			return false
 		}
 	}
 
-	// Fall back to RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		// Try parsing as IP directly
-		ip := net.ParseIP(r.RemoteAddr)
-		if ip != nil {
-			return ip
+	return true
+}
+
+// extractLeaseID extracts the lease ID from the URL path
+// Expected format: a configured lease path such as /peer/{leaseID}/... or /peer/{leaseID}
+func extractLeaseID(urlPath string, patterns []LeasePathPattern) string {
+	for _, pattern := range patterns {
+		if leaseID, ok := pattern.Match(urlPath); ok {
+			return leaseID
 		}
-		return nil
 	}
 
-	return net.ParseIP(host)
+	return ""
+}
+
+// getClientIP extracts the client IP address from the request using DefaultClientIPHeaders
+func getClientIP(r *http.Request) net.IP {
+	return (*ClientIPResolver)(nil).ClientIP(r)
 }
 
 // isIPAllowed checks if an IP is in any of the allowed ranges
@@ -337,6 +809,36 @@ func matchWildcard(pattern, str string) bool {
 	return strings.HasPrefix(str, prefix)
 }
 
+// renderResponseHeaders returns the rule's response headers with placeholders filled in
+func (r *ACLRule) renderResponseHeaders(leaseID, keyID string) map[string]string {
+	replacer := strings.NewReplacer("{lease_id}", leaseID, "{key_id}", keyID)
+
+	rendered := make(map[string]string, len(r.ResponseHeaders))
+	for name, value := range r.ResponseHeaders {
+		rendered[name] = replacer.Replace(value)
+	}
+	return rendered
+}
+
+// validateResponseHeader checks that a configured response header can be sent as-is
+func validateResponseHeader(name, value string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidResponseHeader)
+	}
+
+	for _, c := range name {
+		if c > 0x7e || c <= ' ' || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return fmt.Errorf("%w: %q is not a valid header name", ErrInvalidResponseHeader, name)
+		}
+	}
+
+	if strings.ContainsAny(value, "\r\n\x00") {
+		return fmt.Errorf("%w: value for %s contains a control character", ErrInvalidResponseHeader, name)
+	}
+
+	return nil
+}
+
 // ParseCIDR parses a CIDR notation string into an IPNet
 func ParseCIDR(cidr string) (*net.IPNet, error) {
 	_, ipNet, err := net.ParseCIDR(cidr)
@@ -359,6 +861,12 @@ func ParseCIDRList(cidrs []string) ([]*net.IPNet, error) {
 	return ipNets, nil
 }
 
+// WithLeaseID returns a context carrying the lease ID, as the ACL middleware sets it
+// Tests of layers that run after the ACL use it to serve requests for a lease directly
+func WithLeaseID(ctx context.Context, leaseID string) context.Context {
+	return context.WithValue(ctx, contextKey("lease_id"), leaseID)
+}
+
 // GetLeaseID retrieves the lease ID from the request context
 func GetLeaseID(ctx context.Context) string {
 	leaseID, ok := ctx.Value(contextKey("lease_id")).(string)
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultACLRuleCacheSize is the number of lease IDs whose resolved rule is cached
+const DefaultACLRuleCacheSize = 10000
+
+// aclRuleCache is a bounded LRU mapping concrete lease IDs to their resolved rule
+// A nil rule is cached as well so repeated lookups of unknown leases skip the wildcard scan
+type aclRuleCache struct {
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // front = most recently used
+
+	mu sync.Mutex
+}
+
+type aclRuleCacheEntry struct {
+	leaseID string
+	rule    *ACLRule
+}
+
+// newACLRuleCache creates a cache holding at most capacity lease IDs
+func newACLRuleCache(capacity int) *aclRuleCache {
+	return &aclRuleCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// get returns the cached rule for a lease ID and whether it was present
+func (c *aclRuleCache) get(leaseID string) (*ACLRule, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[leaseID]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(elem)
+	return elem.Value.(*aclRuleCacheEntry).rule, true
+}
+
+// put stores the resolved rule for a lease ID, evicting the least recently used entry when full
+func (c *aclRuleCache) put(leaseID string, rule *ACLRule) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[leaseID]; ok {
+		elem.Value.(*aclRuleCacheEntry).rule = rule
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[leaseID] = c.order.PushFront(&aclRuleCacheEntry{leaseID: leaseID, rule: rule})
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*aclRuleCacheEntry).leaseID)
+	}
+}
+
+// purge drops every cached entry
+func (c *aclRuleCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// len returns the number of cached lease IDs
+func (c *aclRuleCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
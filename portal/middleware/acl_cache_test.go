@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestACLRuleCacheEviction tests that the least recently used lease is evicted first
+func TestACLRuleCacheEviction(t *testing.T) {
+	cache := newACLRuleCache(2)
+	ruleA := &ACLRule{LeaseID: "a"}
+	ruleB := &ACLRule{LeaseID: "b"}
+
+	cache.put("a", ruleA)
+	cache.put("b", ruleB)
+
+	// Touch "a" so "b" becomes the eviction candidate
+	if _, ok := cache.get("a"); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	cache.put("c", nil)
+
+	if _, ok := cache.get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if rule, ok := cache.get("a"); !ok || rule != ruleA {
+		t.Error("Expected a to remain cached")
+	}
+	if rule, ok := cache.get("c"); !ok || rule != nil {
+		t.Error("Expected negative entry for c")
+	}
+	if cache.len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.len())
+	}
+}
+
+// TestGetRuleCacheInvalidation tests that rule changes are visible through the cache
+func TestGetRuleCacheInvalidation(t *testing.T) {
+	config := NewACLConfig()
+
+	// Cache a miss first
+	if rule := config.GetRule("mcp-server-1"); rule != nil {
+		t.Fatalf("Expected no rule, got %v", rule)
+	}
+
+	wildcard := &ACLRule{LeaseID: "mcp-*", AllowedKeyIDs: []string{"key1"}}
+	if err := config.AddRule(wildcard); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if rule := config.GetRule("mcp-server-1"); rule != wildcard {
+		t.Fatalf("Expected wildcard rule after AddRule, got %v", rule)
+	}
+
+	exact := &ACLRule{LeaseID: "mcp-server-1", AllowedKeyIDs: []string{"key2"}}
+	if err := config.AddRule(exact); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if rule := config.GetRule("mcp-server-1"); rule != exact {
+		t.Fatalf("Expected exact rule to take precedence, got %v", rule)
+	}
+
+	// Replacing a rule is an update
+	updated := &ACLRule{LeaseID: "mcp-server-1", AllowedKeyIDs: []string{"key3"}}
+	if err := config.AddRule(updated); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if rule := config.GetRule("mcp-server-1"); rule != updated {
+		t.Fatalf("Expected updated rule, got %v", rule)
+	}
+
+	if err := config.RemoveRule("mcp-*"); err != nil {
+		t.Fatalf("RemoveRule failed: %v", err)
+	}
+	if rule := config.GetRule("mcp-server-2"); rule != nil {
+		t.Fatalf("Expected no rule after RemoveRule, got %v", rule)
+	}
+}
+
+// TestSetRuleCacheSizeDisable tests that lookups still resolve with caching disabled
+func TestSetRuleCacheSizeDisable(t *testing.T) {
+	config := NewACLConfig()
+	config.SetRuleCacheSize(0)
+
+	rule := &ACLRule{LeaseID: "mcp-*", AllowedKeyIDs: []string{"key1"}}
+	if err := config.AddRule(rule); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+	if got := config.GetRule("mcp-1"); got != rule {
+		t.Errorf("Expected wildcard rule, got %v", got)
+	}
+
+	// A config built without NewACLConfig has no cache
+	bare := &ACLConfig{Rules: map[string]*ACLRule{"mcp-*": rule}}
+	if got := bare.GetRule("mcp-1"); got != rule {
+		t.Errorf("Expected wildcard rule from bare config, got %v", got)
+	}
+}
+
+// TestGetRuleCacheConcurrent tests concurrent lookups racing with rule changes
+func TestGetRuleCacheConcurrent(t *testing.T) {
+	config := NewACLConfig()
+	config.SetRuleCacheSize(16)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				config.GetRule(fmt.Sprintf("lease-%d-%d", worker, j%32))
+			}
+		}(i)
+	}
+
+	for j := 0; j < 50; j++ {
+		pattern := fmt.Sprintf("lease-%d-*", j%8)
+		_ = config.AddRule(&ACLRule{LeaseID: pattern})
+		_ = config.RemoveRule(pattern)
+	}
+	wg.Wait()
+
+	// Every rule was removed, so nothing may be served from a stale entry
+	for i := 0; i < 8; i++ {
+		if rule := config.GetRule(fmt.Sprintf("lease-%d-0", i)); rule != nil {
+			t.Fatalf("Expected no rule for worker %d, got %v", i, rule)
+		}
+	}
+}
+
+// BenchmarkGetRuleWildcard compares uncached and cached lookups against many wildcard rules
+func BenchmarkGetRuleWildcard(b *testing.B) {
+	for _, numRules := range []int{10, 1000} {
+		for _, cacheSize := range []int{0, DefaultACLRuleCacheSize} {
+			config := NewACLConfig()
+			config.SetRuleCacheSize(cacheSize)
+			for i := 0; i < numRules; i++ {
+				if err := config.AddRule(&ACLRule{LeaseID: fmt.Sprintf("tenant-%d-*", i)}); err != nil {
+					b.Fatalf("Failed to add rule: %v", err)
+				}
+			}
+
+			name := "uncached"
+			if cacheSize > 0 {
+				name = "cached"
+			}
+
+			leaseIDs := []string{
+				fmt.Sprintf("tenant-%d-server", numRules-1),
+				"unknown-lease",
+			}
+
+			b.Run(fmt.Sprintf("%s/rules=%d", name, numRules), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					config.GetRule(leaseIDs[i%len(leaseIDs)])
+				}
+			})
+		}
+	}
+}
@@ -1,12 +1,18 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
 )
 
 // TestNewACLConfig tests creating a new ACL configuration
@@ -304,6 +310,349 @@ func TestCheckAccess(t *testing.T) {
 	}
 }
 
+// TestCheckAccessDefaultRule tests that the default rule applies to every lease on top of its rule
+func TestCheckAccessDefaultRule(t *testing.T) {
+	config := NewACLConfig()
+	if err := config.SetKeyGroup("banned", []string{"key3"}); err != nil {
+		t.Fatalf("Failed to add key group: %v", err)
+	}
+	if err := config.AddRule(&ACLRule{LeaseID: "lease-*", AllowedKeyIDs: []string{"key1", "key2", "key3"}}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := config.AddRule(&ACLRule{
+		LeaseID:         "lease-public",
+		AllowedKeyIDs:   []string{"key1"},
+		AllowedIPRanges: []*net.IPNet{mustParseCIDR("0.0.0.0/0")},
+	}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	config.SetDefaultRule(&ACLDefaultRule{
+		DeniedKeyIDs:    []string{"key2"},
+		DeniedKeyGroups: []string{"banned"},
+		AllowedIPRanges: []*net.IPNet{mustParseCIDR("10.0.0.0/8")},
+	})
+
+	internal := net.ParseIP("10.0.0.1")
+	external := net.ParseIP("203.0.113.1")
+
+	tests := []struct {
+		name      string
+		leaseID   string
+		keyID     string
+		ip        net.IP
+		wantErr   error
+		byDefault bool
+	}{
+		{"allowed by both rules", "lease-001", "key1", internal, nil, false},
+		{"denied key", "lease-001", "key2", internal, ErrAccessDenied, true},
+		{"denied key group", "lease-001", "key3", internal, ErrAccessDenied, true},
+		{"outside default IP ranges", "lease-001", "key1", external, ErrIPNotWhitelisted, true},
+		{"lease rule cannot widen the default IP ranges", "lease-public", "key1", external, ErrIPNotWhitelisted, true},
+		{"lease rule still applies", "lease-public", "key4", internal, ErrAccessDenied, false},
+		{"unknown lease", "other", "key1", internal, ErrLeaseNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := config.CheckAccess(tt.leaseID, tt.keyID, tt.ip)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if byDefault := errors.Is(err, ErrDeniedByDefaultRule); byDefault != tt.byDefault {
+				t.Errorf("Expected denied by default rule %v, got %v", tt.byDefault, byDefault)
+			}
+		})
+	}
+
+	// Leases let through by default-allow are still held to the default rule
+	config.DefaultAllow = true
+	if err := config.CheckAccess("other", "key1", internal); err != nil {
+		t.Errorf("Expected default-allow to admit the lease, got %v", err)
+	}
+	if err := config.CheckAccess("other", "key2", internal); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected the default rule to deny key2 on an unconfigured lease, got %v", err)
+	}
+
+	config.SetDefaultRule(nil)
+	if err := config.CheckAccess("lease-001", "key2", external); err != nil {
+		t.Errorf("Expected access once the default rule is removed, got %v", err)
+	}
+}
+
+// TestCheckAccessKeyGroups tests access granted through key groups
+func TestCheckAccessKeyGroups(t *testing.T) {
+	config := NewACLConfig()
+
+	if err := config.SetKeyGroup("team-alpha", []string{"key1", "key2"}); err != nil {
+		t.Fatalf("Failed to set key group: %v", err)
+	}
+
+	rule := &ACLRule{
+		LeaseID:          "lease-001",
+		AllowedKeyIDs:    []string{"key9"},
+		AllowedKeyGroups: []string{"team-alpha", "team-missing"},
+	}
+	if err := config.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	ip := net.ParseIP("10.0.0.1")
+
+	// Group members and direct keys are both allowed
+	for _, keyID := range []string{"key1", "key2", "key9"} {
+		if err := config.CheckAccess("lease-001", keyID, ip); err != nil {
+			t.Errorf("Expected %s to have access, got %v", keyID, err)
+		}
+	}
+
+	if err := config.CheckAccess("lease-001", "key3", ip); err != ErrAccessDenied {
+		t.Errorf("Expected ErrAccessDenied for non-member, got %v", err)
+	}
+
+	// Membership changes apply without touching the rule
+	if err := config.SetKeyGroup("team-alpha", []string{"key3"}); err != nil {
+		t.Fatalf("Failed to update key group: %v", err)
+	}
+
+	if err := config.CheckAccess("lease-001", "key3", ip); err != nil {
+		t.Errorf("Expected new member to have access, got %v", err)
+	}
+
+	if err := config.CheckAccess("lease-001", "key1", ip); err != ErrAccessDenied {
+		t.Errorf("Expected removed member to be denied, got %v", err)
+	}
+
+	// Removing the group revokes access granted through it
+	if err := config.RemoveKeyGroup("team-alpha"); err != nil {
+		t.Fatalf("Failed to remove key group: %v", err)
+	}
+
+	if err := config.CheckAccess("lease-001", "key3", ip); err != ErrAccessDenied {
+		t.Errorf("Expected ErrAccessDenied after group removal, got %v", err)
+	}
+}
+
+// TestCheckAccessTimeWindows tests time-windowed access
+func TestCheckAccessTimeWindows(t *testing.T) {
+	config := NewACLConfig()
+
+	batch, err := ParseTimeWindow(nil, "02:00", "04:00")
+	if err != nil {
+		t.Fatalf("Failed to parse time window: %v", err)
+	}
+
+	overnight, err := ParseTimeWindow([]string{"fri"}, "22:00", "02:00")
+	if err != nil {
+		t.Fatalf("Failed to parse time window: %v", err)
+	}
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data unavailable: %v", err)
+	}
+
+	rules := []*ACLRule{
+		{LeaseID: "batch", AllowedKeyIDs: []string{"key1"}, AllowedTimeWindows: []TimeWindow{batch}},
+		{LeaseID: "overnight", AllowedKeyIDs: []string{"key1"}, AllowedTimeWindows: []TimeWindow{overnight}},
+		{LeaseID: "berlin", AllowedKeyIDs: []string{"key1"}, AllowedTimeWindows: []TimeWindow{batch}, TimeZone: berlin},
+	}
+	for _, rule := range rules {
+		if err := config.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		leaseID string
+		now     time.Time
+		wantErr error
+	}{
+		{"inside daily window", "batch", time.Date(2025, 1, 6, 3, 0, 0, 0, time.UTC), nil},
+		{"window start is inclusive", "batch", time.Date(2025, 1, 6, 2, 0, 0, 0, time.UTC), nil},
+		{"window end is exclusive", "batch", time.Date(2025, 1, 6, 4, 0, 0, 0, time.UTC), ErrOutsideAllowedWindow},
+		{"outside daily window", "batch", time.Date(2025, 1, 6, 12, 0, 0, 0, time.UTC), ErrOutsideAllowedWindow},
+		{"overnight window on its day", "overnight", time.Date(2025, 1, 10, 23, 0, 0, 0, time.UTC), nil},
+		{"overnight window after midnight", "overnight", time.Date(2025, 1, 11, 1, 0, 0, 0, time.UTC), nil},
+		{"overnight window on other day", "overnight", time.Date(2025, 1, 9, 23, 0, 0, 0, time.UTC), ErrOutsideAllowedWindow},
+		{"overnight window tail on other day", "overnight", time.Date(2025, 1, 10, 1, 0, 0, 0, time.UTC), ErrOutsideAllowedWindow},
+		{"window in rule time zone", "berlin", time.Date(2025, 1, 6, 2, 0, 0, 0, time.UTC), nil},
+		{"UTC window not used for zoned rule", "berlin", time.Date(2025, 1, 6, 3, 30, 0, 0, time.UTC), ErrOutsideAllowedWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.now = func() time.Time { return tt.now }
+
+			if err := config.CheckAccess(tt.leaseID, "key1", nil); err != tt.wantErr {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// Key checks still come first
+	if err := config.CheckAccess("batch", "key2", nil); err != ErrAccessDenied {
+		t.Errorf("Expected ErrAccessDenied, got %v", err)
+	}
+}
+
+// TestMatchAccess tests that the matched rule is reported alongside the decision
+func TestMatchAccess(t *testing.T) {
+	config := NewACLConfig()
+
+	rule := &ACLRule{
+		LeaseID:         "mcp-*",
+		AllowedKeyIDs:   []string{"key1"},
+		AllowedIPRanges: []*net.IPNet{mustParseCIDR("10.0.0.0/8")},
+	}
+	if err := config.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		leaseID  string
+		keyID    string
+		ip       net.IP
+		wantRule *ACLRule
+		wantErr  error
+	}{
+		{"allowed", "mcp-001", "key1", net.ParseIP("10.1.2.3"), rule, nil},
+		{"key not allowed", "mcp-001", "key2", net.ParseIP("10.1.2.3"), rule, ErrAccessDenied},
+		{"ip not whitelisted", "mcp-001", "key1", net.ParseIP("192.168.1.1"), rule, ErrIPNotWhitelisted},
+		{"no ip", "mcp-001", "key1", nil, rule, ErrIPNotWhitelisted},
+		{"no rule", "other-001", "key1", net.ParseIP("10.1.2.3"), nil, ErrLeaseNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matched, err := config.MatchAccess(tt.leaseID, tt.keyID, tt.ip)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if matched != tt.wantRule {
+				t.Errorf("Expected matched rule %v, got %v", tt.wantRule, matched)
+			}
+
+			// CheckAccess must agree with MatchAccess
+			if checkErr := config.CheckAccess(tt.leaseID, tt.keyID, tt.ip); checkErr != err {
+				t.Errorf("CheckAccess returned %v, MatchAccess returned %v", checkErr, err)
+			}
+		})
+	}
+}
+
+// TestMatchAccessDefaultAllow tests that default-allow only opens leases no rule covers
+func TestMatchAccessDefaultAllow(t *testing.T) {
+	config := NewACLConfig()
+	if err := config.AddRule(&ACLRule{LeaseID: "locked-*", AllowedKeyIDs: []string{"key1"}}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	if err := config.CheckAccess("unconfigured", "key2", nil); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Expected ErrLeaseNotFound by default, got %v", err)
+	}
+
+	config.DefaultAllow = true
+
+	rule, err := config.MatchAccess("unconfigured", "key2", nil)
+	if err != nil || rule != nil {
+		t.Errorf("Expected unconfigured lease to be allowed without a rule, got %v, %v", rule, err)
+	}
+
+	if err := config.CheckAccess("locked-1", "key2", nil); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Expected matching rule to still deny, got %v", err)
+	}
+
+	// The middleware lets the request through with the lease ID set
+	var gotLeaseID string
+	handler := NewACLMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLeaseID = GetLeaseID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/peer/unconfigured", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "key2"}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || gotLeaseID != "unconfigured" {
+		t.Errorf("Expected 200 with lease ID set, got %d and %q", rr.Code, gotLeaseID)
+	}
+}
+
+// TestParseTimeWindow tests parsing and formatting time windows
+func TestParseTimeWindow(t *testing.T) {
+	window, err := ParseTimeWindow([]string{"Mon", "friday"}, "09:00", "17:30")
+	if err != nil {
+		t.Fatalf("Failed to parse time window: %v", err)
+	}
+
+	days, start, end := window.Format()
+	if len(days) != 2 || days[0] != "mon" || days[1] != "fri" {
+		t.Errorf("Expected days [mon fri], got %v", days)
+	}
+	if start != "09:00" || end != "17:30" {
+		t.Errorf("Expected 09:00-17:30, got %s-%s", start, end)
+	}
+
+	if _, err := ParseTimeWindow(nil, "22:00", "24:00"); err != nil {
+		t.Errorf("Expected 24:00 end to be valid, got %v", err)
+	}
+
+	invalid := []struct {
+		days       []string
+		start, end string
+	}{
+		{[]string{"someday"}, "09:00", "17:00"},
+		{nil, "9:00", "17:00"},
+		{nil, "09:60", "17:00"},
+		{nil, "25:00", "17:00"},
+		{nil, "09:00", "09:00"},
+		{nil, "24:00", "02:00"},
+	}
+
+	for _, tt := range invalid {
+		if _, err := ParseTimeWindow(tt.days, tt.start, tt.end); !errors.Is(err, ErrInvalidTimeWindow) {
+			t.Errorf("ParseTimeWindow(%v, %q, %q): expected ErrInvalidTimeWindow, got %v", tt.days, tt.start, tt.end, err)
+		}
+	}
+}
+
+// TestKeyGroups tests key group management
+func TestKeyGroups(t *testing.T) {
+	config := NewACLConfig()
+
+	if err := config.SetKeyGroup("", []string{"key1"}); err != ErrInvalidKeyGroup {
+		t.Errorf("Expected ErrInvalidKeyGroup, got %v", err)
+	}
+
+	members := []string{"key1", "key2"}
+	if err := config.SetKeyGroup("team-alpha", members); err != nil {
+		t.Fatalf("Failed to set key group: %v", err)
+	}
+
+	// Caller's slice is copied
+	members[0] = "changed"
+	if got := config.GetKeyGroup("team-alpha"); len(got) != 2 || got[0] != "key1" {
+		t.Errorf("Expected [key1 key2], got %v", got)
+	}
+
+	if got := config.GetKeyGroup("missing"); got != nil {
+		t.Errorf("Expected nil for missing group, got %v", got)
+	}
+
+	if groups := config.ListKeyGroups(); len(groups) != 1 {
+		t.Errorf("Expected 1 group, got %d", len(groups))
+	}
+
+	if err := config.RemoveKeyGroup("missing"); !errors.Is(err, ErrKeyGroupNotFound) {
+		t.Errorf("Expected ErrKeyGroupNotFound, got %v", err)
+	}
+}
+
 // TestExtractLeaseID tests lease ID extraction from URL paths
 func TestExtractLeaseID(t *testing.T) {
 	tests := []struct {
@@ -321,7 +670,7 @@ func TestExtractLeaseID(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.path, func(t *testing.T) {
-			leaseID := extractLeaseID(tt.path)
+			leaseID := extractLeaseID(tt.path, DefaultLeasePathPatterns())
 			if leaseID != tt.wantID {
 				t.Errorf("extractLeaseID(%q) = %q, want %q", tt.path, leaseID, tt.wantID)
 			}
@@ -591,6 +940,168 @@ func TestACLMiddleware(t *testing.T) {
 	}
 }
 
+// TestACLMiddlewareLeaseIDHeader tests the X-Lease-ID header fallback
+func TestACLMiddlewareLeaseIDHeader(t *testing.T) {
+	config := NewACLConfig()
+	for _, leaseID := range []string{"lease-001", "lease-002"} {
+		if err := config.AddRule(&ACLRule{LeaseID: leaseID, AllowedKeyIDs: []string{"test_key"}}); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	var gotLeaseID string
+	handler := NewACLMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLeaseID = GetLeaseID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		allowHeader    bool
+		path           string
+		header         string
+		wantStatusCode int
+		wantLeaseID    string
+	}{
+		{"header disabled", false, "/peer/", "lease-001", http.StatusBadRequest, ""},
+		{"header fallback", true, "/peer/", "lease-001", http.StatusOK, "lease-001"},
+		{"path takes precedence", true, "/peer/lease-002", "lease-001", http.StatusOK, "lease-002"},
+		{"missing header", true, "/peer/", "", http.StatusBadRequest, ""},
+		{"wildcard rejected", true, "/peer/", "lease-*", http.StatusBadRequest, ""},
+		{"slash rejected", true, "/peer/", "lease-001/x", http.StatusBadRequest, ""},
+		{"whitespace rejected", true, "/peer/", "lease 001", http.StatusBadRequest, ""},
+		{"too long rejected", true, "/peer/", strings.Repeat("a", maxLeaseIDLength+1), http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AllowLeaseIDHeader = tt.allowHeader
+			gotLeaseID = ""
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(HeaderLeaseID, tt.header)
+			}
+			req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "test_key"}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatusCode {
+				t.Errorf("Expected status code %d, got %d", tt.wantStatusCode, rr.Code)
+			}
+
+			if gotLeaseID != tt.wantLeaseID {
+				t.Errorf("Expected lease ID %q in context, got %q", tt.wantLeaseID, gotLeaseID)
+			}
+		})
+	}
+}
+
+// TestACLMiddlewareResponseHeaders tests that a lease's templated response headers replace backend values
+func TestACLMiddlewareResponseHeaders(t *testing.T) {
+	config := NewACLConfig()
+	rule := &ACLRule{
+		LeaseID:       "tenant-*",
+		AllowedKeyIDs: []string{"test_key"},
+		ResponseHeaders: map[string]string{
+			"X-Tenant-Region": "eu-west-1",
+			"X-Served-By":     "{lease_id}/{key_id}",
+		},
+	}
+	if err := config.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := config.AddRule(&ACLRule{LeaseID: "plain", AllowedKeyIDs: []string{"test_key"}}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	handler := NewACLMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Tenant-Region", "from-backend")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	req := httptest.NewRequest("GET", "/peer/tenant-a/items", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "test_key"}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected status code %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	if got := rr.Header().Get("X-Tenant-Region"); got != "eu-west-1" {
+		t.Errorf("Expected configured X-Tenant-Region to win, got %q", got)
+	}
+	if got := rr.Header().Get("X-Served-By"); got != "tenant-a/test_key" {
+		t.Errorf("Expected rendered X-Served-By, got %q", got)
+	}
+
+	// Leases without response headers are untouched
+	req = httptest.NewRequest("GET", "/peer/plain", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "test_key"}))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if got := rr.Header().Get("X-Tenant-Region"); got != "from-backend" {
+		t.Errorf("Expected backend X-Tenant-Region, got %q", got)
+	}
+	if got := rr.Header().Get("X-Served-By"); got != "" {
+		t.Errorf("Expected no X-Served-By, got %q", got)
+	}
+}
+
+// TestAddRuleInvalidResponseHeaders tests that unsendable response headers are rejected
+func TestAddRuleInvalidResponseHeaders(t *testing.T) {
+	config := NewACLConfig()
+
+	for name, headers := range map[string]map[string]string{
+		"empty name":       {"": "value"},
+		"space in name":    {"X Tenant": "value"},
+		"colon in name":    {"X-Tenant:": "value"},
+		"newline in value": {"X-Tenant": "a\r\nSet-Cookie: x=1"},
+	} {
+		err := config.AddRule(&ACLRule{LeaseID: "lease-001", AllowedKeyIDs: []string{"key"}, ResponseHeaders: headers})
+		if !errors.Is(err, ErrInvalidResponseHeader) {
+			t.Errorf("%s: expected ErrInvalidResponseHeader, got %v", name, err)
+		}
+	}
+}
+
+func TestACLMiddlewareLogAllowedRules(t *testing.T) {
+	config := NewACLConfig()
+	config.AddRule(&ACLRule{LeaseID: "mcp-*", AllowedKeyIDs: []string{"key1"}})
+	config.AddRule(&ACLRule{LeaseID: "lease-001", AllowedKeyIDs: []string{"key1"}})
+
+	buf := &bytes.Buffer{}
+	config.Logger = logging.NewLogger(&logging.Config{Level: slog.LevelDebug, Format: logging.FormatJSON, Output: buf})
+	middleware := NewACLMiddleware(config)
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(path string) {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "key1"}))
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	request("/peer/mcp-tools/call")
+	if buf.Len() != 0 {
+		t.Errorf("Expected no rule logging unless enabled, got %s", buf.String())
+	}
+
+	config.LogAllowedRules = true
+	request("/peer/mcp-tools/call")
+	request("/peer/lease-001/data")
+
+	for _, expected := range []string{
+		`"lease_id":"mcp-tools","key_id":"key1","rule":"mcp-*","match":"wildcard"`,
+		`"lease_id":"lease-001","key_id":"key1","rule":"lease-001","match":"exact"`,
+	} {
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("Expected log to contain %s, got %s", expected, buf.String())
+		}
+	}
+}
+
 // Helper function to parse CIDR (panics on error, for test data)
 func mustParseCIDR(cidr string) *net.IPNet {
 	_, ipNet, err := net.ParseCIDR(cidr)
@@ -2,13 +2,22 @@ package middleware
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/subtle"
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/problem"
 )
 
 // contextKey is a type for context keys to avoid collisions
@@ -25,6 +34,12 @@ type APIKeyInfo struct {
 	Scopes      []string
 	ExpiresAt   *time.Time
 	RateLimitID string
+
+	// LeaseID limits the credential to one lease; set for lease tokens
+	LeaseID string
+
+	// LeaseTokenID identifies the lease token the request was made with, if any
+	LeaseTokenID string
 }
 
 // APIKey represents a configured API key with its permissions
@@ -33,17 +48,73 @@ type APIKey struct {
 	KeyID     string
 	Scopes    []string
 	ExpiresAt *time.Time
+
+	// GracePeriod keeps the key valid for this long after ExpiresAt (nil = AuthConfig.GracePeriod)
+	GracePeriod *time.Duration
 }
 
 // AuthConfig holds the authentication configuration
 type AuthConfig struct {
-	APIKeys map[string]*APIKey // keyID -> APIKey
-	mu      sync.RWMutex
+	APIKeys  map[string]*APIKey            // keyID -> APIKey
+	keyIndex map[[sha256.Size]byte]*APIKey // SHA-256 of key value -> APIKey
+	mu       sync.RWMutex
+
+	// Realm is advertised in the WWW-Authenticate challenge on 401 responses (empty = DefaultAuthRealm)
+	Realm string
+
+	// GracePeriod keeps expired keys valid for this long so clients can rotate (0 = none)
+	// Requests in the grace period get an X-Key-Expired: true response header
+	GracePeriod time.Duration
+
+	// LeaseTokenSigner enables lease tokens verified by it (nil = lease tokens are rejected)
+	LeaseTokenSigner *LeaseTokenSigner
+
+	// ClientIPResolver determines the client IP of IP-bound lease tokens; without trusted
+	// proxies the connection's peer address is used, never a forwarding header
+	ClientIPResolver *ClientIPResolver
+}
+
+// DefaultAuthRealm is the realm used in Bearer challenges when none is configured
+const DefaultAuthRealm = "portal"
+
+// ExpiredKeyHeader is set on responses to requests made with a key in its grace period
+const ExpiredKeyHeader = "X-Key-Expired"
+
+// AuthMetrics holds authentication metrics
+type AuthMetrics struct {
+	ExpiredKeyGraceTotal *prometheus.CounterVec
+}
+
+// NewAuthMetrics creates new authentication metrics using the default registry
+func NewAuthMetrics() *AuthMetrics {
+	return NewAuthMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewAuthMetricsWithRegistry creates new authentication metrics with a custom registry
+func NewAuthMetricsWithRegistry(reg prometheus.Registerer) *AuthMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &AuthMetrics{
+		ExpiredKeyGraceTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_auth_expired_key_grace_total",
+				Help: "Total number of requests accepted with an expired API key during its grace period",
+			},
+			[]string{"key_id"},
+		),
+	}
 }
 
 // AuthMiddleware provides API key authentication
 type AuthMiddleware struct {
-	config *AuthConfig
+	config      *AuthConfig
+	metrics     *AuthMetrics
+	leaseTokens *LeaseTokenSigner
+	clientIP    *ClientIPResolver
 }
 
 // Common errors
@@ -57,13 +128,37 @@ var (
 // NewAuthConfig creates a new authentication configuration
 func NewAuthConfig() *AuthConfig {
 	return &AuthConfig{
-		APIKeys: make(map[string]*APIKey),
+		APIKeys:  make(map[string]*APIKey),
+		keyIndex: make(map[[sha256.Size]byte]*APIKey),
 	}
 }
 
 // AddAPIKey adds a new API key to the configuration
 // Returns an error if the key already exists or validation fails
 func (c *AuthConfig) AddAPIKey(key *APIKey) error {
+	if err := checkAPIKey(key); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.APIKeys[key.KeyID]; exists {
+		return fmt.Errorf("API key with ID %s already exists", key.KeyID)
+	}
+
+	digest := sha256.Sum256([]byte(key.Key))
+	if _, exists := c.keyIndex[digest]; exists {
+		return errors.New("API key value is already in use")
+	}
+
+	c.APIKeys[key.KeyID] = key
+	c.keyIndex[digest] = key
+	return nil
+}
+
+// checkAPIKey validates the fields of a key before it is added
+func checkAPIKey(key *APIKey) error {
 	if key == nil {
 		return errors.New("API key cannot be nil")
 	}
@@ -81,17 +176,76 @@ func (c *AuthConfig) AddAPIKey(key *APIKey) error {
 		return ErrInvalidKeyFormat
 	}
 
+	return nil
+}
+
+// ImportAPIKeys adds a batch of API keys, all or none
+// Every key is checked against the existing keys and the rest of the batch before any is
+// added; if one fails nothing changes, and the error names every rejected key by its index
+func (c *AuthConfig) ImportAPIKeys(keys []*APIKey) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if _, exists := c.APIKeys[key.KeyID]; exists {
-		return fmt.Errorf("API key with ID %s already exists", key.KeyID)
+	var errs []error
+	keyIDs := make(map[string]int, len(keys))
+	digests := make(map[[sha256.Size]byte]int, len(keys))
+	for i, key := range keys {
+		if err := checkAPIKey(key); err != nil {
+			errs = append(errs, fmt.Errorf("keys[%d]: %w", i, err))
+			continue
+		}
+
+		if _, exists := c.APIKeys[key.KeyID]; exists {
+			errs = append(errs, fmt.Errorf("keys[%d]: API key with ID %s already exists", i, key.KeyID))
+		} else if first, exists := keyIDs[key.KeyID]; exists {
+			errs = append(errs, fmt.Errorf("keys[%d]: duplicate API key ID %s, first used by keys[%d]", i, key.KeyID, first))
+		} else {
+			keyIDs[key.KeyID] = i
+		}
+
+		digest := sha256.Sum256([]byte(key.Key))
+		if _, exists := c.keyIndex[digest]; exists {
+			errs = append(errs, fmt.Errorf("keys[%d]: API key value is already in use", i))
+		} else if first, exists := digests[digest]; exists {
+			errs = append(errs, fmt.Errorf("keys[%d]: API key value is already used by keys[%d]", i, first))
+		} else {
+			digests[digest] = i
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
 	}
 
-	c.APIKeys[key.KeyID] = key
+	for _, key := range keys {
+		c.APIKeys[key.KeyID] = key
+		c.keyIndex[sha256.Sum256([]byte(key.Key))] = key
+	}
 	return nil
 }
 
+// GetAPIKey returns the API key with an ID, or nil
+func (c *AuthConfig) GetAPIKey(keyID string) *APIKey {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.APIKeys[keyID]
+}
+
+// ListAPIKeys returns the configured API keys sorted by key ID
+func (c *AuthConfig) ListAPIKeys() []*APIKey {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	keys := make([]*APIKey, 0, len(c.APIKeys))
+	for _, key := range c.APIKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].KeyID < keys[j].KeyID
+	})
+	return keys
+}
+
 // RemoveAPIKey removes an API key from the configuration
 func (c *AuthConfig) RemoveAPIKey(keyID string) error {
 	if keyID == "" {
@@ -101,58 +255,132 @@ func (c *AuthConfig) RemoveAPIKey(keyID string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if _, exists := c.APIKeys[keyID]; !exists {
+	key, exists := c.APIKeys[keyID]
+	if !exists {
 		return fmt.Errorf("API key with ID %s not found", keyID)
 	}
 
 	delete(c.APIKeys, keyID)
+	delete(c.keyIndex, sha256.Sum256([]byte(key.Key)))
 	return nil
 }
 
-// validateAPIKey performs constant-time comparison to prevent timing attacks
+// ReplaceAPIKeys replaces all API keys with those of another configuration
+// The swap happens under one lock, so requests see either the old keys or the new ones
+func (c *AuthConfig) ReplaceAPIKeys(other *AuthConfig) {
+	other.mu.RLock()
+	apiKeys := make(map[string]*APIKey, len(other.APIKeys))
+	keyIndex := make(map[[sha256.Size]byte]*APIKey, len(other.keyIndex))
+	for keyID, key := range other.APIKeys {
+		apiKeys[keyID] = key
+	}
+	for digest, key := range other.keyIndex {
+		keyIndex[digest] = key
+	}
+	other.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.APIKeys = apiKeys
+	c.keyIndex = keyIndex
+}
+
+// validateAPIKey looks up the key by its SHA-256 digest and confirms it with a
+// constant-time comparison, so validation cost does not grow with the key count
+// The lookup only depends on the digest, which reveals nothing about valid key bytes
 // Returns the APIKey if valid, or an error
 func (c *AuthConfig) validateAPIKey(providedKey string) (*APIKey, error) {
 	if providedKey == "" {
 		return nil, ErrMissingAPIKey
 	}
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	// Check all keys with constant-time comparison
-	// This prevents timing attacks that could leak information about valid keys
-	var foundKey *APIKey
-	var isValid bool
+	digest := sha256.Sum256([]byte(providedKey))
 
-	for _, key := range c.APIKeys {
-		// Use subtle.ConstantTimeCompare for timing attack prevention
-		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(providedKey)) == 1 {
-			foundKey = key
-			isValid = true
-			// Don't break - continue checking all keys to maintain constant time
-		}
-	}
+	c.mu.RLock()
+	foundKey, exists := c.keyIndex[digest]
+	c.mu.RUnlock()
 
-	if !isValid {
+	// Use subtle.ConstantTimeCompare for timing attack prevention
+	if !exists || subtle.ConstantTimeCompare([]byte(foundKey.Key), []byte(providedKey)) != 1 {
 		return nil, ErrInvalidAPIKey
 	}
 
-	// Check expiration
-	if foundKey.ExpiresAt != nil && time.Now().After(*foundKey.ExpiresAt) {
+	// Check expiration, allowing for the grace period
+	if foundKey.ExpiresAt != nil && time.Now().After(foundKey.ExpiresAt.Add(c.gracePeriodFor(foundKey))) {
 		return nil, ErrExpiredAPIKey
 	}
 
 	return foundKey, nil
 }
 
+// gracePeriodFor returns how long a key stays valid after it expires
+func (c *AuthConfig) gracePeriodFor(key *APIKey) time.Duration {
+	if key.GracePeriod != nil {
+		return *key.GracePeriod
+	}
+	return c.GracePeriod
+}
+
 // NewAuthMiddleware creates a new authentication middleware
 func NewAuthMiddleware(config *AuthConfig) *AuthMiddleware {
 	if config == nil {
 		config = NewAuthConfig()
 	}
 	return &AuthMiddleware{
-		config: config,
+		config:      config,
+		leaseTokens: config.LeaseTokenSigner,
+		clientIP:    config.ClientIPResolver,
+	}
+}
+
+// SetMetrics sets the metrics recorded by the middleware (nil = none)
+func (m *AuthMiddleware) SetMetrics(metrics *AuthMetrics) {
+	m.metrics = metrics
+}
+
+// authenticateLeaseToken verifies a lease token and returns the API key info it grants
+// The token acts for its API key, so the key must still be valid; scopes the key has lost
+// since the token was issued are dropped
+func (m *AuthMiddleware) authenticateLeaseToken(r *http.Request, value string) (*APIKeyInfo, error) {
+	now := time.Now()
+	token, err := m.leaseTokens.Verify(value, now)
+	if err != nil {
+		return nil, err
+	}
+
+	key := m.config.GetAPIKey(token.KeyID)
+	if key == nil {
+		return nil, ErrInvalidLeaseToken
 	}
+	if key.ExpiresAt != nil && now.After(key.ExpiresAt.Add(m.config.gracePeriodFor(key))) {
+		return nil, ErrExpiredAPIKey
+	}
+
+	if !token.allowsIP(m.clientIP.TrustedClientIP(r)) {
+		return nil, ErrLeaseTokenIPMismatch
+	}
+
+	scopes := make([]string, 0, len(token.Scopes))
+	for _, scope := range token.Scopes {
+		if contains(key.Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	expiresAt := token.ExpiresAt
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(expiresAt) {
+		expiresAt = *key.ExpiresAt
+	}
+
+	return &APIKeyInfo{
+		KeyID:        key.KeyID,
+		Scopes:       scopes,
+		ExpiresAt:    &expiresAt,
+		RateLimitID:  key.KeyID,
+		LeaseID:      token.LeaseID,
+		LeaseTokenID: token.ID,
+	}, nil
 }
 
 // extractAPIKey extracts the API key from the request
@@ -184,17 +412,33 @@ func (m *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 		// Extract API key from request
 		apiKey, err := extractAPIKey(r)
 		if err != nil {
-			m.handleAuthError(w, err)
+			m.handleAuthError(w, r, err)
+			return
+		}
+
+		// Lease tokens act for an API key, limited to a single lease
+		if m.leaseTokens != nil && strings.HasPrefix(apiKey, LeaseTokenPrefix) {
+			info, err := m.authenticateLeaseToken(r, apiKey)
+			if err != nil {
+				m.handleAuthError(w, r, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), ContextKeyAPIKey, info)))
 			return
 		}
 
 		// Validate API key
 		keyInfo, err := m.config.validateAPIKey(apiKey)
 		if err != nil {
-			m.handleAuthError(w, err)
+			m.handleAuthError(w, r, err)
 			return
 		}
 
+		if keyInfo.ExpiresAt != nil && time.Now().After(*keyInfo.ExpiresAt) {
+			m.handleGracePeriod(w, r, keyInfo)
+		}
+
 		// Create API key info for context
 		info := &APIKeyInfo{
 			KeyID:       keyInfo.KeyID,
@@ -211,29 +455,67 @@ func (m *AuthMiddleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
-// handleAuthError writes an appropriate error response
-func (m *AuthMiddleware) handleAuthError(w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
+// handleGracePeriod flags a request made with an expired key that is still in its grace period
+func (m *AuthMiddleware) handleGracePeriod(w http.ResponseWriter, r *http.Request, key *APIKey) {
+	w.Header().Set(ExpiredKeyHeader, "true")
+
+	if m.metrics != nil {
+		m.metrics.ExpiredKeyGraceTotal.WithLabelValues(key.KeyID).Inc()
+	}
 
+	logging.Default().WithContext(r.Context()).Warn("Expired API key accepted during grace period",
+		slog.String("key_id", key.KeyID),
+		slog.Time("expired_at", *key.ExpiresAt),
+		slog.Time("grace_ends_at", key.ExpiresAt.Add(m.config.gracePeriodFor(key))),
+	)
+}
+
+// handleAuthError writes an appropriate error response
+func (m *AuthMiddleware) handleAuthError(w http.ResponseWriter, r *http.Request, err error) {
 	switch {
 	case errors.Is(err, ErrMissingAPIKey):
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error":"missing_api_key","message":"API key is required"}`)
+		// RFC 6750 section 3.1: no error code when the request carried no credentials
+		m.setBearerChallenge(w, "", "")
+		problem.Write(w, r, http.StatusUnauthorized, "missing_api_key", "API key is required")
 	case errors.Is(err, ErrInvalidAPIKey):
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error":"invalid_api_key","message":"Invalid API key"}`)
+		m.setBearerChallenge(w, "invalid_token", "The API key is invalid")
+		problem.Write(w, r, http.StatusUnauthorized, "invalid_api_key", "Invalid API key")
 	case errors.Is(err, ErrExpiredAPIKey):
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error":"expired_api_key","message":"API key has expired"}`)
+		m.setBearerChallenge(w, "invalid_token", "The API key has expired")
+		problem.Write(w, r, http.StatusUnauthorized, "expired_api_key", "API key has expired")
+	case errors.Is(err, ErrInvalidLeaseToken):
+		m.setBearerChallenge(w, "invalid_token", "The lease token is invalid")
+		problem.Write(w, r, http.StatusUnauthorized, "invalid_lease_token", "Invalid lease token")
+	case errors.Is(err, ErrLeaseTokenIPMismatch):
+		m.setBearerChallenge(w, "invalid_token", "The lease token is not valid from this IP address")
+		problem.Write(w, r, http.StatusUnauthorized, "lease_token_ip_mismatch", "Lease token is not valid from this IP address")
 	case errors.Is(err, ErrInvalidKeyFormat):
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, `{"error":"invalid_key_format","message":"API key must start with sk_live_ or sk_test_"}`)
+		problem.Write(w, r, http.StatusBadRequest, "invalid_key_format", "API key must start with sk_live_ or sk_test_")
 	default:
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintf(w, `{"error":"authentication_failed","message":"Authentication failed"}`)
+		m.setBearerChallenge(w, "", "")
+		problem.Write(w, r, http.StatusUnauthorized, "authentication_failed", "Authentication failed")
 	}
 }
 
+// setBearerChallenge sets an RFC 6750 WWW-Authenticate header
+// errorCode and description are omitted when empty
+func (m *AuthMiddleware) setBearerChallenge(w http.ResponseWriter, errorCode, description string) {
+	realm := m.config.Realm
+	if realm == "" {
+		realm = DefaultAuthRealm
+	}
+
+	challenge := fmt.Sprintf(`Bearer realm=%q`, realm)
+	if errorCode != "" {
+		challenge += fmt.Sprintf(`, error=%q`, errorCode)
+	}
+	if description != "" {
+		challenge += fmt.Sprintf(`, error_description=%q`, description)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+}
+
 // GetAPIKeyInfo retrieves API key information from the request context
 // Returns nil if no API key info is present
 func GetAPIKeyInfo(ctx context.Context) *APIKeyInfo {
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// BasicAuthMiddleware provides HTTP basic authentication with a single credential pair
+// Used for endpoints scraped by tools that cannot send API keys
+type BasicAuthMiddleware struct {
+	usernameHash [sha256.Size]byte
+	passwordHash [sha256.Size]byte
+	realm        string
+}
+
+// NewBasicAuthMiddleware creates a new basic authentication middleware
+func NewBasicAuthMiddleware(username, password, realm string) *BasicAuthMiddleware {
+	if username == "" || password == "" {
+		panic("basic auth username and password cannot be empty")
+	}
+
+	if realm == "" {
+		realm = "portal"
+	}
+
+	return &BasicAuthMiddleware{
+		usernameHash: sha256.Sum256([]byte(username)),
+		passwordHash: sha256.Sum256([]byte(password)),
+		realm:        realm,
+	}
+}
+
+// Middleware returns an http.Handler that requires valid basic auth credentials
+func (m *BasicAuthMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if ok && m.validate(username, password) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q`, m.realm))
+		problem.Write(w, r, http.StatusUnauthorized, "invalid_credentials", "Valid basic auth credentials are required")
+	})
+}
+
+// validate compares credential digests in constant time, checking both fields
+// so the response time does not reveal which one was wrong
+func (m *BasicAuthMiddleware) validate(username, password string) bool {
+	usernameHash := sha256.Sum256([]byte(username))
+	passwordHash := sha256.Sum256([]byte(password))
+
+	usernameMatch := subtle.ConstantTimeCompare(usernameHash[:], m.usernameHash[:])
+	passwordMatch := subtle.ConstantTimeCompare(passwordHash[:], m.passwordHash[:])
+
+	return usernameMatch&passwordMatch == 1
+}
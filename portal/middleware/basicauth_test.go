@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestBasicAuthMiddleware tests basic auth credential checks
+func TestBasicAuthMiddleware(t *testing.T) {
+	m := NewBasicAuthMiddleware("prometheus", "s3cret", "metrics")
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		setAuth    bool
+		wantStatus int
+	}{
+		{"no credentials", "", "", false, http.StatusUnauthorized},
+		{"wrong password", "prometheus", "wrong", true, http.StatusUnauthorized},
+		{"wrong username", "grafana", "s3cret", true, http.StatusUnauthorized},
+		{"valid credentials", "prometheus", "s3cret", true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.setAuth {
+				req.SetBasicAuth(tt.username, tt.password)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+
+			if tt.wantStatus == http.StatusUnauthorized {
+				if got := rec.Header().Get("WWW-Authenticate"); got != `Basic realm="metrics"` {
+					t.Errorf("Unexpected WWW-Authenticate header: %q", got)
+				}
+			}
+		})
+	}
+}
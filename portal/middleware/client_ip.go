@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// DefaultClientIPHeaders are the headers checked for the client IP when none are configured
+var DefaultClientIPHeaders = []string{"X-Forwarded-For", "X-Real-IP"}
+
+// ClientIPResolver determines the client IP of a request from proxy headers
+// Headers are checked in order and the first one holding a valid IP wins; RemoteAddr is the fallback
+type ClientIPResolver struct {
+	headers        []string
+	trustedProxies []*net.IPNet
+}
+
+// NewClientIPResolver creates a resolver checking headers in order (empty = DefaultClientIPHeaders)
+// With trustedProxies (IPs or CIDRs) set, headers are only honored when the direct peer is a
+// trusted proxy, and list headers such as X-Forwarded-For resolve to the rightmost entry that
+// is not a trusted proxy. Without them, headers are honored from any peer and list headers
+// resolve to their first entry
+func NewClientIPResolver(headers []string, trustedProxies []string) (*ClientIPResolver, error) {
+	c := &ClientIPResolver{}
+	for _, header := range headers {
+		if header = strings.TrimSpace(header); header != "" {
+			c.headers = append(c.headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	if len(c.headers) == 0 {
+		c.headers = DefaultClientIPHeaders
+	}
+
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidIPRange, proxy)
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidIPRange, proxy)
+		}
+		c.trustedProxies = append(c.trustedProxies, ipNet)
+	}
+
+	return c, nil
+}
+
+// Headers returns the headers checked for the client IP, in order
+func (c *ClientIPResolver) Headers() []string {
+	if c == nil {
+		return DefaultClientIPHeaders
+	}
+	return c.headers
+}
+
+// ClientIP returns the client IP of a request, or nil if it cannot be determined
+// A nil resolver checks DefaultClientIPHeaders from any peer
+func (c *ClientIPResolver) ClientIP(r *http.Request) net.IP {
+	remoteIP := remoteAddrIP(r.RemoteAddr)
+	if c != nil && len(c.trustedProxies) > 0 && !c.isTrustedProxy(remoteIP) {
+		return remoteIP
+	}
+
+	for _, header := range c.Headers() {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+
+		entries := strings.Split(strings.Join(values, ","), ",")
+		if ip := c.pickEntry(entries); ip != nil {
+			return ip
+		}
+	}
+
+	return remoteIP
+}
+
+// TrustedClientIP returns the client IP of a request only as far as it can be trusted: headers
+// are used when set by a trusted proxy, and without trusted proxies it is the direct peer's address
+// Use it where the IP grants access, since any client can send proxy headers itself
+func (c *ClientIPResolver) TrustedClientIP(r *http.Request) net.IP {
+	if c == nil || len(c.trustedProxies) == 0 {
+		return remoteAddrIP(r.RemoteAddr)
+	}
+	return c.ClientIP(r)
+}
+
+// pickEntry selects the client IP from a header's comma-separated entries
+func (c *ClientIPResolver) pickEntry(entries []string) net.IP {
+	if c == nil || len(c.trustedProxies) == 0 {
+		return net.ParseIP(strings.TrimSpace(entries[0]))
+	}
+
+	// Walk back past the proxies we trust; the first other address is the client
+	for i := len(entries) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(entries[i]))
+		if ip == nil {
+			return nil
+		}
+		if !c.isTrustedProxy(ip) {
+			return ip
+		}
+	}
+	return nil
+}
+
+// isTrustedProxy reports whether an address belongs to a trusted proxy
+func (c *ClientIPResolver) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range c.trustedProxies {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteAddrIP parses the IP of a RemoteAddr with or without a port
+func remoteAddrIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return net.ParseIP(remoteAddr)
+	}
+	return net.ParseIP(host)
+}
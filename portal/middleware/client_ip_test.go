@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolverHeaders(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"cf-connecting-ip", "True-Client-IP", "X-Forwarded-For"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantIP  string
+	}{
+		{
+			name:    "first configured header wins",
+			headers: map[string]string{"CF-Connecting-IP": "203.0.113.1", "X-Forwarded-For": "203.0.113.2"},
+			wantIP:  "203.0.113.1",
+		},
+		{
+			name:    "invalid value falls through to the next header",
+			headers: map[string]string{"CF-Connecting-IP": "garbage", "True-Client-IP": "203.0.113.3"},
+			wantIP:  "203.0.113.3",
+		},
+		{
+			name:    "unlisted headers are ignored",
+			headers: map[string]string{"X-Real-IP": "203.0.113.4"},
+			wantIP:  "192.168.1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", nil)
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			req.RemoteAddr = "192.168.1.1:12345"
+
+			if ip := resolver.ClientIP(req); ip == nil || ip.String() != tt.wantIP {
+				t.Errorf("Expected IP %s, got %v", tt.wantIP, ip)
+			}
+		})
+	}
+}
+
+func TestClientIPResolverTrustedProxies(t *testing.T) {
+	resolver, err := NewClientIPResolver(nil, []string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		xff        string
+		remoteAddr string
+		wantIP     string
+	}{
+		{"untrusted peer headers ignored", "203.0.113.1", "198.51.100.7:443", "198.51.100.7"},
+		{"trusted peer headers honored", "203.0.113.1", "10.1.2.3:443", "203.0.113.1"},
+		{"spoofed leftmost entry skipped", "1.2.3.4, 203.0.113.1, 10.0.0.5", "192.168.1.1:443", "203.0.113.1"},
+		{"all entries trusted falls back to peer", "10.0.0.5", "10.1.2.3:443", "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			req.RemoteAddr = tt.remoteAddr
+
+			if ip := resolver.ClientIP(req); ip == nil || ip.String() != tt.wantIP {
+				t.Errorf("Expected IP %s, got %v", tt.wantIP, ip)
+			}
+		})
+	}
+}
+
+func TestNewClientIPResolverValidation(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{" ", ""}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	if len(resolver.Headers()) != len(DefaultClientIPHeaders) {
+		t.Errorf("Expected default headers, got %v", resolver.Headers())
+	}
+
+	if _, err := NewClientIPResolver(nil, []string{"not-an-ip"}); !errors.Is(err, ErrInvalidIPRange) {
+		t.Errorf("Expected ErrInvalidIPRange, got %v", err)
+	}
+}
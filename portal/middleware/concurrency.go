@@ -0,0 +1,423 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// ConcurrencyMetrics holds per-lease concurrency limiting metrics
+type ConcurrencyMetrics struct {
+	InFlight      *prometheus.GaugeVec
+	RejectedTotal *prometheus.CounterVec
+}
+
+// NewConcurrencyMetrics creates new concurrency metrics using the default registry
+func NewConcurrencyMetrics() *ConcurrencyMetrics {
+	return NewConcurrencyMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewConcurrencyMetricsWithRegistry creates new concurrency metrics with a custom registry
+func NewConcurrencyMetricsWithRegistry(reg prometheus.Registerer) *ConcurrencyMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &ConcurrencyMetrics{
+		InFlight: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "portal_lease_inflight_requests",
+				Help: "Current number of in-flight requests per lease",
+			},
+			[]string{"lease_id"},
+		),
+		RejectedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_lease_concurrency_rejected_total",
+				Help: "Total number of requests rejected by the per-lease concurrency limit",
+			},
+			[]string{"lease_id", "reason"}, // reason: "limit_exceeded", "queue_timeout", "cancelled"
+		),
+	}
+}
+
+// ConcurrencyLimitConfig holds per-lease concurrency (bulkhead) configuration
+type ConcurrencyLimitConfig struct {
+	MaxConcurrent int            // Default max in-flight requests per lease
+	LeaseLimits   map[string]int // leaseID (supports wildcards like "mcp-*") -> max in-flight
+	MaxQueue      int            // Max requests waiting for a slot per lease (0 = reject immediately)
+	QueueTimeout  time.Duration  // Max time a request waits in the queue
+	Metrics       *ConcurrencyMetrics
+
+	// Rejections is told about requests the limit turns away, e.g. saturation.Tracker (nil = none)
+	Rejections RejectionRecorder
+
+	// Bulkhead cache settings
+	BulkheadTTL     time.Duration // How long to keep idle bulkheads
+	CleanupInterval time.Duration // How often to clean up idle bulkheads
+
+	mu        sync.Mutex
+	bulkheads map[string]*bulkhead // leaseID -> bulkhead
+}
+
+// ConcurrencyLimitMiddleware caps the number of in-flight requests per lease
+type ConcurrencyLimitMiddleware struct {
+	config  *ConcurrencyLimitConfig
+	stopCh  chan struct{}
+	stopMu  sync.Mutex
+	stopped bool
+}
+
+// Common errors
+var (
+	ErrConcurrencyLimitExceeded = errors.New("concurrency limit exceeded")
+	ErrConcurrencyQueueTimeout  = errors.New("timed out waiting for a concurrency slot")
+)
+
+// bulkhead is a resizable semaphore with a bounded FIFO wait queue
+type bulkhead struct {
+	mu       sync.Mutex
+	limit    int
+	inFlight int
+	waiters  []chan struct{}
+	lastUsed time.Time
+
+	// observe is called under mu whenever in-flight or queued counts change (nil = not observed)
+	observe func(inFlight, queued int)
+}
+
+// NewConcurrencyLimitConfig creates a new concurrency limit configuration
+func NewConcurrencyLimitConfig(maxConcurrent int) *ConcurrencyLimitConfig {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 100 // Default: 100 in-flight requests per lease
+	}
+
+	return &ConcurrencyLimitConfig{
+		MaxConcurrent:   maxConcurrent,
+		LeaseLimits:     make(map[string]int),
+		MaxQueue:        0,
+		QueueTimeout:    time.Second,
+		BulkheadTTL:     10 * time.Minute,
+		CleanupInterval: 5 * time.Minute,
+		bulkheads:       make(map[string]*bulkhead),
+	}
+}
+
+// SetLeaseLimit sets the max in-flight requests for a lease
+// Existing bulkheads are resized in place, so in-flight requests keep counting
+// against the new limit
+func (c *ConcurrencyLimitConfig) SetLeaseLimit(leaseID string, maxConcurrent int) error {
+	if leaseID == "" {
+		return ErrInvalidLeaseID
+	}
+
+	if maxConcurrent <= 0 {
+		return errors.New("max concurrent requests must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.LeaseLimits[leaseID] = maxConcurrent
+
+	// Re-resolve every cached bulkhead, since a wildcard rule may now apply
+	for id, b := range c.bulkheads {
+		b.setLimit(c.leaseLimitLocked(id))
+	}
+
+	return nil
+}
+
+// GetLeaseLimit returns the max in-flight requests for a lease (considering defaults)
+func (c *ConcurrencyLimitConfig) GetLeaseLimit(leaseID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.leaseLimitLocked(leaseID)
+}
+
+// leaseLimitLocked resolves the limit for a lease; c.mu must be held
+func (c *ConcurrencyLimitConfig) leaseLimitLocked(leaseID string) int {
+	// Try exact match first
+	if limit, exists := c.LeaseLimits[leaseID]; exists {
+		return limit
+	}
+
+	// Try wildcard match
+	for pattern, limit := range c.LeaseLimits {
+		if matchWildcard(pattern, leaseID) {
+			return limit
+		}
+	}
+
+	return c.MaxConcurrent
+}
+
+// getBulkhead returns or creates the bulkhead for a lease
+func (c *ConcurrencyLimitConfig) getBulkhead(leaseID string) *bulkhead {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if b, exists := c.bulkheads[leaseID]; exists {
+		return b
+	}
+
+	b := &bulkhead{
+		limit:    c.leaseLimitLocked(leaseID),
+		lastUsed: time.Now(),
+	}
+	c.bulkheads[leaseID] = b
+
+	return b
+}
+
+// CleanupIdleBulkheads removes bulkheads with no in-flight or queued requests
+// that haven't been used recently
+func (c *ConcurrencyLimitConfig) CleanupIdleBulkheads() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for id, b := range c.bulkheads {
+		if b.idleSince(now) > c.BulkheadTTL {
+			delete(c.bulkheads, id)
+		}
+	}
+}
+
+// GetStats returns the number of cached bulkheads
+func (c *ConcurrencyLimitConfig) GetStats() (activeBulkheads int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.bulkheads)
+}
+
+// acquire takes a slot, waiting in the queue if one is configured
+func (b *bulkhead) acquire(ctx context.Context, maxQueue int, queueTimeout time.Duration) error {
+	b.mu.Lock()
+	b.lastUsed = time.Now()
+
+	// Fast path: free slot available and nobody queued ahead of us
+	if b.inFlight < b.limit && len(b.waiters) == 0 {
+		b.inFlight++
+		b.notifyLocked()
+		b.mu.Unlock()
+		return nil
+	}
+
+	if len(b.waiters) >= maxQueue {
+		b.mu.Unlock()
+		return ErrConcurrencyLimitExceeded
+	}
+
+	ready := make(chan struct{})
+	b.waiters = append(b.waiters, ready)
+	b.notifyLocked()
+	b.mu.Unlock()
+
+	timer := time.NewTimer(queueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = ErrConcurrencyQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// A slot may have been handed over while we were giving up
+	select {
+	case <-ready:
+		return nil
+	default:
+	}
+
+	for i, w := range b.waiters {
+		if w == ready {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			break
+		}
+	}
+	b.notifyLocked()
+
+	return err
+}
+
+// release frees a slot and hands it to the next queued request
+func (b *bulkhead) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.inFlight--
+	b.lastUsed = time.Now()
+	b.grantLocked()
+	b.notifyLocked()
+}
+
+// setLimit changes the bulkhead size without touching in-flight requests
+func (b *bulkhead) setLimit(limit int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.limit = limit
+	b.grantLocked()
+	b.notifyLocked()
+}
+
+// grantLocked hands free slots to queued requests in FIFO order; b.mu must be held
+func (b *bulkhead) grantLocked() {
+	for b.inFlight < b.limit && len(b.waiters) > 0 {
+		ready := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		b.inFlight++
+		close(ready)
+	}
+}
+
+// notifyLocked reports the current counts to the observer; b.mu must be held
+func (b *bulkhead) notifyLocked() {
+	if b.observe != nil {
+		b.observe(b.inFlight, len(b.waiters))
+	}
+}
+
+// idleSince returns how long the bulkhead has been unused, or 0 if it is busy
+func (b *bulkhead) idleSince(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.inFlight > 0 || len(b.waiters) > 0 {
+		return 0
+	}
+
+	return now.Sub(b.lastUsed)
+}
+
+// NewConcurrencyLimitMiddleware creates a new per-lease concurrency limit middleware
+func NewConcurrencyLimitMiddleware(config *ConcurrencyLimitConfig) *ConcurrencyLimitMiddleware {
+	if config == nil {
+		config = NewConcurrencyLimitConfig(100)
+	}
+
+	if config.LeaseLimits == nil {
+		config.LeaseLimits = make(map[string]int)
+	}
+
+	if config.bulkheads == nil {
+		config.bulkheads = make(map[string]*bulkhead)
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewConcurrencyMetrics()
+	}
+
+	if config.BulkheadTTL <= 0 {
+		config.BulkheadTTL = 10 * time.Minute
+	}
+
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = 5 * time.Minute
+	}
+
+	m := &ConcurrencyLimitMiddleware{
+		config: config,
+		stopCh: make(chan struct{}),
+	}
+
+	// Start cleanup goroutine
+	go m.cleanupLoop()
+
+	return m
+}
+
+// cleanupLoop periodically removes idle bulkheads
+func (m *ConcurrencyLimitMiddleware) cleanupLoop() {
+	ticker := time.NewTicker(m.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.config.CleanupIdleBulkheads()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the cleanup goroutine
+func (m *ConcurrencyLimitMiddleware) Stop() {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+
+	if !m.stopped {
+		close(m.stopCh)
+		m.stopped = true
+	}
+}
+
+// Middleware returns an http.Handler that limits in-flight requests per lease
+func (m *ConcurrencyLimitMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Get lease ID from context (set by ACL middleware)
+		leaseID := GetLeaseID(r.Context())
+		if leaseID == "" {
+			// No lease ID, skip concurrency limiting
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		b := m.config.getBulkhead(leaseID)
+		if err := b.acquire(r.Context(), m.config.MaxQueue, m.config.QueueTimeout); err != nil {
+			m.handleConcurrencyError(w, r, leaseID, err)
+			return
+		}
+		defer b.release()
+
+		inFlight := m.config.Metrics.InFlight.WithLabelValues(leaseID)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleConcurrencyError writes an appropriate error response
+func (m *ConcurrencyLimitMiddleware) handleConcurrencyError(w http.ResponseWriter, r *http.Request, leaseID string, err error) {
+	w.Header().Set("Retry-After", "1")
+
+	// Clients that gave up while queued are not a sign of saturation
+	if m.config.Rejections != nil && (errors.Is(err, ErrConcurrencyLimitExceeded) || errors.Is(err, ErrConcurrencyQueueTimeout)) {
+		m.config.Rejections.RecordRejection("concurrency")
+	}
+
+	switch {
+	case errors.Is(err, ErrConcurrencyLimitExceeded):
+		m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "limit_exceeded").Inc()
+		problem.Write(w, r, http.StatusTooManyRequests, "concurrency_limit_exceeded", fmt.Sprintf("Too many in-flight requests for lease %s", leaseID))
+	case errors.Is(err, ErrConcurrencyQueueTimeout):
+		m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "queue_timeout").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "concurrency_queue_timeout", fmt.Sprintf("Timed out waiting for a free slot for lease %s", leaseID))
+	default:
+		// Request context was cancelled while queued
+		m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "cancelled").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "request_cancelled", "Request cancelled while waiting for a free slot")
+	}
+}
@@ -0,0 +1,298 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestConcurrencyConfig creates a concurrency config with a fresh metrics registry
+func newTestConcurrencyConfig(maxConcurrent int) *ConcurrencyLimitConfig {
+	config := NewConcurrencyLimitConfig(maxConcurrent)
+	config.Metrics = NewConcurrencyMetricsWithRegistry(prometheus.NewRegistry())
+	return config
+}
+
+// leaseRequest creates a request carrying a lease ID in its context
+func leaseRequest(leaseID string) *http.Request {
+	req := httptest.NewRequest("GET", "/test", nil)
+	ctx := context.WithValue(req.Context(), contextKey("lease_id"), leaseID)
+	return req.WithContext(ctx)
+}
+
+// TestNewConcurrencyLimitConfig tests default values
+func TestNewConcurrencyLimitConfig(t *testing.T) {
+	config := NewConcurrencyLimitConfig(0)
+
+	if config.MaxConcurrent <= 0 {
+		t.Error("MaxConcurrent should have default value")
+	}
+
+	if config.LeaseLimits == nil {
+		t.Error("LeaseLimits map should be initialized")
+	}
+}
+
+// TestConcurrencyLeaseLimit tests per-lease limit resolution
+func TestConcurrencyLeaseLimit(t *testing.T) {
+	config := newTestConcurrencyConfig(10)
+
+	if err := config.SetLeaseLimit("mcp-*", 5); err != nil {
+		t.Fatalf("Failed to set wildcard limit: %v", err)
+	}
+	if err := config.SetLeaseLimit("mcp-special", 2); err != nil {
+		t.Fatalf("Failed to set exact limit: %v", err)
+	}
+
+	tests := []struct {
+		leaseID string
+		want    int
+	}{
+		{"mcp-special", 2},
+		{"mcp-other", 5},
+		{"n8n-1", 10},
+	}
+
+	for _, tt := range tests {
+		if got := config.GetLeaseLimit(tt.leaseID); got != tt.want {
+			t.Errorf("GetLeaseLimit(%q) = %d, want %d", tt.leaseID, got, tt.want)
+		}
+	}
+
+	if err := config.SetLeaseLimit("", 1); err == nil {
+		t.Error("Expected error for empty lease ID")
+	}
+
+	if err := config.SetLeaseLimit("lease", 0); err == nil {
+		t.Error("Expected error for non-positive limit")
+	}
+}
+
+// blockingHandler returns a handler that signals on started and blocks until its lease's release channel is closed
+func blockingHandler(started chan<- string, release map[string]chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := GetLeaseID(r.Context())
+		started <- leaseID
+		<-release[leaseID]
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// TestConcurrencyLimitMiddlewareRejects tests that requests beyond the limit get 429
+func TestConcurrencyLimitMiddlewareRejects(t *testing.T) {
+	config := newTestConcurrencyConfig(2)
+	rejections := &rejectionRecorder{}
+	config.Rejections = rejections
+	m := NewConcurrencyLimitMiddleware(config)
+	defer m.Stop()
+
+	release := map[string]chan struct{}{
+		"test-lease":  make(chan struct{}),
+		"other-lease": make(chan struct{}),
+	}
+	started := make(chan string, 3)
+	handler := m.Middleware(blockingHandler(started, release))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), leaseRequest("test-lease"))
+		}()
+	}
+	<-started
+	<-started
+
+	// Third concurrent request should be rejected
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, leaseRequest("test-lease"))
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rr.Code)
+	}
+
+	// Other leases are isolated
+	other := make(chan int, 1)
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, leaseRequest("other-lease"))
+		other <- rr.Code
+	}()
+	if leaseID := <-started; leaseID != "other-lease" {
+		t.Fatalf("Expected other-lease to start, got %q", leaseID)
+	}
+	close(release["other-lease"])
+	if code := <-other; code != http.StatusOK {
+		t.Errorf("Expected other lease to succeed, got %d", code)
+	}
+
+	close(release["test-lease"])
+	wg.Wait()
+
+	// Slots are released once requests finish
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, leaseRequest("test-lease"))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after release, got %d", rr.Code)
+	}
+
+	if got := rejections.list(); strings.Join(got, ",") != "concurrency" {
+		t.Errorf("Expected one concurrency rejection reported, got %v", got)
+	}
+}
+
+// TestConcurrencyLimitSetLeaseLimitInFlight tests that resizing keeps in-flight requests accounted
+func TestConcurrencyLimitSetLeaseLimitInFlight(t *testing.T) {
+	config := newTestConcurrencyConfig(2)
+	m := NewConcurrencyLimitMiddleware(config)
+	defer m.Stop()
+
+	release := map[string]chan struct{}{"test-lease": make(chan struct{})}
+	started := make(chan string, 3)
+	handler := m.Middleware(blockingHandler(started, release))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler.ServeHTTP(httptest.NewRecorder(), leaseRequest("test-lease"))
+		}()
+	}
+	<-started
+	<-started
+
+	// Raising the limit to 3 leaves room for exactly one more request
+	if err := config.SetLeaseLimit("test-*", 3); err != nil {
+		t.Fatalf("Failed to set lease limit: %v", err)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(httptest.NewRecorder(), leaseRequest("test-lease"))
+	}()
+	<-started
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, leaseRequest("test-lease"))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 once the resized bulkhead is full, got %d", rr.Code)
+	}
+
+	close(release["test-lease"])
+	wg.Wait()
+}
+
+// TestConcurrencyLimitCleanupIdleBulkheads tests that only idle bulkheads are evicted
+func TestConcurrencyLimitCleanupIdleBulkheads(t *testing.T) {
+	config := newTestConcurrencyConfig(1)
+	config.BulkheadTTL = 10 * time.Millisecond
+
+	idle := config.getBulkhead("idle-lease")
+	idle.lastUsed = time.Now().Add(-time.Second)
+
+	busy := config.getBulkhead("busy-lease")
+	if err := busy.acquire(context.Background(), 0, time.Second); err != nil {
+		t.Fatalf("Failed to acquire slot: %v", err)
+	}
+	busy.lastUsed = time.Now().Add(-time.Second)
+
+	config.CleanupIdleBulkheads()
+
+	if got := config.GetStats(); got != 1 {
+		t.Errorf("Expected 1 bulkhead after cleanup, got %d", got)
+	}
+
+	busy.release()
+	busy.lastUsed = time.Now().Add(-time.Second)
+	config.CleanupIdleBulkheads()
+
+	if got := config.GetStats(); got != 0 {
+		t.Errorf("Expected 0 bulkheads after release and cleanup, got %d", got)
+	}
+}
+
+// TestConcurrencyLimitMiddlewareQueue tests that queued requests get a slot when one frees up
+func TestConcurrencyLimitMiddlewareQueue(t *testing.T) {
+	config := newTestConcurrencyConfig(1)
+	config.MaxQueue = 1
+	config.QueueTimeout = time.Second
+	m := NewConcurrencyLimitMiddleware(config)
+	defer m.Stop()
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, leaseRequest("test-lease"))
+			codes[i] = rr.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("Request %d: expected queued request to succeed, got %d", i, code)
+		}
+	}
+}
+
+// TestConcurrencyLimitMiddlewareQueueTimeout tests that queued requests time out with 503
+func TestConcurrencyLimitMiddlewareQueueTimeout(t *testing.T) {
+	config := newTestConcurrencyConfig(1)
+	config.MaxQueue = 1
+	config.QueueTimeout = 20 * time.Millisecond
+	m := NewConcurrencyLimitMiddleware(config)
+	defer m.Stop()
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), leaseRequest("test-lease"))
+	<-started
+	defer close(release)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, leaseRequest("test-lease"))
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503 on queue timeout, got %d", rr.Code)
+	}
+}
+
+// TestConcurrencyLimitMiddlewareWithoutLeaseID tests passthrough without a lease
+func TestConcurrencyLimitMiddlewareWithoutLeaseID(t *testing.T) {
+	m := NewConcurrencyLimitMiddleware(newTestConcurrencyConfig(1))
+	defer m.Stop()
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,456 @@
+package middleware
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// FairQueueMetrics holds fair scheduling metrics
+type FairQueueMetrics struct {
+	WaitSeconds   *prometheus.HistogramVec
+	Queued        *prometheus.GaugeVec
+	RejectedTotal *prometheus.CounterVec
+}
+
+// NewFairQueueMetrics creates new fair queue metrics using the default registry
+func NewFairQueueMetrics() *FairQueueMetrics {
+	return NewFairQueueMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewFairQueueMetricsWithRegistry creates new fair queue metrics with a custom registry
+func NewFairQueueMetricsWithRegistry(reg prometheus.Registerer) *FairQueueMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &FairQueueMetrics{
+		WaitSeconds: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "portal_fair_queue_wait_seconds",
+				Help:    "Time requests waited for a shared backend slot per lease",
+				Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10},
+			},
+			[]string{"lease_id"},
+		),
+		Queued: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "portal_fair_queue_queued_requests",
+				Help: "Current number of requests waiting for a shared backend slot per lease",
+			},
+			[]string{"lease_id"},
+		),
+		RejectedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_fair_queue_rejected_total",
+				Help: "Total number of requests rejected by the fair queue",
+			},
+			[]string{"lease_id", "reason"}, // reason: "queue_full", "queue_timeout", "cancelled"
+		),
+	}
+}
+
+// FairQueueConfig holds fair scheduling configuration for leases sharing a backend
+// When all slots are busy, queued requests are served in order of per-lease virtual
+// finish time, so each lease gets a share of slots proportional to its weight no
+// matter how many requests it sends
+type FairQueueConfig struct {
+	Slots         int                // Concurrent requests shared by all leases
+	Weights       map[string]float64 // leaseID (supports wildcards like "mcp-*") -> weight
+	DefaultWeight float64            // Weight for leases without an entry
+	MaxQueue      int                // Max requests waiting across all leases (0 = unlimited)
+	QueueTimeout  time.Duration      // Max time a request waits for a slot
+	Metrics       *FairQueueMetrics
+
+	// Rejections is told about requests the limit turns away, e.g. saturation.Tracker (nil = none)
+	Rejections RejectionRecorder
+
+	// CleanupInterval is how often idle lease state is dropped
+	CleanupInterval time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	virtualTime float64                    // Start tag of the most recently dispatched request
+	leases      map[string]*fairLeaseState // leaseID -> scheduling state
+	waiters     fairWaiterHeap
+	seq         uint64 // Arrival counter, breaks ties in FIFO order
+}
+
+// fairLeaseState tracks scheduling state for one lease
+type fairLeaseState struct {
+	finish float64 // Finish tag of the lease's latest request
+	queued int     // Requests currently waiting
+}
+
+// fairWaiter is a request waiting for a slot
+type fairWaiter struct {
+	leaseID string
+	start   float64
+	finish  float64
+	seq     uint64
+	ready   chan struct{}
+	index   int
+}
+
+// FairQueueMiddleware schedules requests from contending leases fairly over shared slots
+type FairQueueMiddleware struct {
+	config  *FairQueueConfig
+	stopCh  chan struct{}
+	stopMu  sync.Mutex
+	stopped bool
+}
+
+// Common errors
+var (
+	ErrFairQueueFull    = errors.New("fair queue is full")
+	ErrFairQueueTimeout = errors.New("timed out waiting for a shared backend slot")
+)
+
+// NewFairQueueConfig creates a new fair queue configuration
+func NewFairQueueConfig(slots int) *FairQueueConfig {
+	if slots <= 0 {
+		slots = 100 // Default: 100 shared slots
+	}
+
+	return &FairQueueConfig{
+		Slots:           slots,
+		Weights:         make(map[string]float64),
+		DefaultWeight:   1,
+		MaxQueue:        0,
+		QueueTimeout:    30 * time.Second,
+		CleanupInterval: 5 * time.Minute,
+		leases:          make(map[string]*fairLeaseState),
+	}
+}
+
+// SetLeaseWeight sets the scheduling weight for a lease or wildcard pattern
+// A lease with weight 2 gets twice the slots of a lease with weight 1 under contention
+func (c *FairQueueConfig) SetLeaseWeight(leaseID string, weight float64) error {
+	if leaseID == "" {
+		return ErrInvalidLeaseID
+	}
+
+	if weight <= 0 {
+		return errors.New("weight must be positive")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Weights[leaseID] = weight
+	return nil
+}
+
+// GetLeaseWeight returns the scheduling weight for a lease (considering defaults)
+func (c *FairQueueConfig) GetLeaseWeight(leaseID string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.leaseWeightLocked(leaseID)
+}
+
+// leaseWeightLocked resolves the weight for a lease; c.mu must be held
+func (c *FairQueueConfig) leaseWeightLocked(leaseID string) float64 {
+	// Try exact match first
+	if weight, exists := c.Weights[leaseID]; exists {
+		return weight
+	}
+
+	// Try wildcard match
+	for pattern, weight := range c.Weights {
+		if matchWildcard(pattern, leaseID) {
+			return weight
+		}
+	}
+
+	return c.DefaultWeight
+}
+
+// acquire takes a shared slot for a lease, queueing behind other leases' earlier finish tags
+func (c *FairQueueConfig) acquire(ctx context.Context, leaseID string) error {
+	c.mu.Lock()
+
+	lease, exists := c.leases[leaseID]
+	if !exists {
+		lease = &fairLeaseState{}
+		c.leases[leaseID] = lease
+	}
+
+	// A lease that has been idle starts at the current virtual time, so it
+	// cannot bank credit while idle and then burst ahead of everyone else
+	start := lease.finish
+	if c.virtualTime > start {
+		start = c.virtualTime
+	}
+	finish := start + 1/c.leaseWeightLocked(leaseID)
+
+	// Fast path: free slot available and nobody queued ahead of us
+	if c.inFlight < c.Slots && c.waiters.Len() == 0 {
+		c.inFlight++
+		c.virtualTime = start
+		lease.finish = finish
+		c.mu.Unlock()
+		return nil
+	}
+
+	if c.MaxQueue > 0 && c.waiters.Len() >= c.MaxQueue {
+		c.mu.Unlock()
+		return ErrFairQueueFull
+	}
+
+	c.seq++
+	w := &fairWaiter{
+		leaseID: leaseID,
+		start:   start,
+		finish:  finish,
+		seq:     c.seq,
+		ready:   make(chan struct{}),
+	}
+	heap.Push(&c.waiters, w)
+	lease.finish = finish
+	lease.queued++
+	c.mu.Unlock()
+
+	timer := time.NewTimer(c.QueueTimeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timer.C:
+		err = ErrFairQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A slot may have been handed over while we were giving up
+	select {
+	case <-w.ready:
+		return nil
+	default:
+	}
+
+	heap.Remove(&c.waiters, w.index)
+	lease.queued--
+
+	// Give back the virtual time this request reserved if nothing was queued after it
+	if lease.finish == w.finish {
+		lease.finish = w.start
+	}
+
+	return err
+}
+
+// release frees a slot and hands it to the queued request with the earliest finish tag
+func (c *FairQueueConfig) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inFlight--
+
+	for c.inFlight < c.Slots && c.waiters.Len() > 0 {
+		w := heap.Pop(&c.waiters).(*fairWaiter)
+		if w.start > c.virtualTime {
+			c.virtualTime = w.start
+		}
+		if lease, exists := c.leases[w.leaseID]; exists {
+			lease.queued--
+		}
+		c.inFlight++
+		close(w.ready)
+	}
+}
+
+// CleanupIdleLeases drops state for leases with nothing queued whose
+// reservations the virtual clock has already passed, or all state once the
+// backend is idle
+func (c *FairQueueConfig) CleanupIdleLeases() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idle := c.inFlight == 0
+	for id, lease := range c.leases {
+		if lease.queued == 0 && (idle || lease.finish <= c.virtualTime) {
+			delete(c.leases, id)
+		}
+	}
+}
+
+// GetStats returns the number of in-flight and queued requests
+func (c *FairQueueConfig) GetStats() (inFlight, queued int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.inFlight, c.waiters.Len()
+}
+
+// fairWaiterHeap orders waiters by finish tag, then arrival
+type fairWaiterHeap []*fairWaiter
+
+func (h fairWaiterHeap) Len() int { return len(h) }
+
+func (h fairWaiterHeap) Less(i, j int) bool {
+	if h[i].finish != h[j].finish {
+		return h[i].finish < h[j].finish
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h fairWaiterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *fairWaiterHeap) Push(x any) {
+	w := x.(*fairWaiter)
+	w.index = len(*h)
+	*h = append(*h, w)
+}
+
+func (h *fairWaiterHeap) Pop() any {
+	old := *h
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return w
+}
+
+// NewFairQueueMiddleware creates a new fair queue middleware
+func NewFairQueueMiddleware(config *FairQueueConfig) *FairQueueMiddleware {
+	if config == nil {
+		config = NewFairQueueConfig(100)
+	}
+
+	if config.Slots <= 0 {
+		config.Slots = 100
+	}
+
+	if config.Weights == nil {
+		config.Weights = make(map[string]float64)
+	}
+
+	if config.DefaultWeight <= 0 {
+		config.DefaultWeight = 1
+	}
+
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = 30 * time.Second
+	}
+
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = 5 * time.Minute
+	}
+
+	if config.leases == nil {
+		config.leases = make(map[string]*fairLeaseState)
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewFairQueueMetrics()
+	}
+
+	m := &FairQueueMiddleware{
+		config: config,
+		stopCh: make(chan struct{}),
+	}
+
+	// Start cleanup goroutine
+	go m.cleanupLoop()
+
+	return m
+}
+
+// cleanupLoop periodically removes idle lease state
+func (m *FairQueueMiddleware) cleanupLoop() {
+	ticker := time.NewTicker(m.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.config.CleanupIdleLeases()
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the cleanup goroutine
+func (m *FairQueueMiddleware) Stop() {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+
+	if !m.stopped {
+		close(m.stopCh)
+		m.stopped = true
+	}
+}
+
+// Middleware returns an http.Handler that schedules requests fairly across leases
+func (m *FairQueueMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Get lease ID from context (set by ACL middleware)
+		leaseID := GetLeaseID(r.Context())
+		if leaseID == "" {
+			// No lease ID, skip fair scheduling
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		queued := m.config.Metrics.Queued.WithLabelValues(leaseID)
+		queued.Inc()
+		start := time.Now()
+		err := m.config.acquire(r.Context(), leaseID)
+		queued.Dec()
+
+		if err != nil {
+			m.handleFairQueueError(w, r, leaseID, err)
+			return
+		}
+		defer m.config.release()
+
+		m.config.Metrics.WaitSeconds.WithLabelValues(leaseID).Observe(time.Since(start).Seconds())
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleFairQueueError writes an appropriate error response
+func (m *FairQueueMiddleware) handleFairQueueError(w http.ResponseWriter, r *http.Request, leaseID string, err error) {
+	w.Header().Set("Retry-After", "1")
+
+	// Clients that gave up while queued are not a sign of saturation
+	if m.config.Rejections != nil && (errors.Is(err, ErrFairQueueFull) || errors.Is(err, ErrFairQueueTimeout)) {
+		m.config.Rejections.RecordRejection("concurrency")
+	}
+
+	switch {
+	case errors.Is(err, ErrFairQueueFull):
+		m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "queue_full").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "fair_queue_full", "Too many requests waiting for the shared backend")
+	case errors.Is(err, ErrFairQueueTimeout):
+		m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "queue_timeout").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "fair_queue_timeout", fmt.Sprintf("Timed out waiting for a shared backend slot for lease %s", leaseID))
+	default:
+		// Request context was cancelled while queued
+		m.config.Metrics.RejectedTotal.WithLabelValues(leaseID, "cancelled").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "request_cancelled", "Request cancelled while waiting for a shared backend slot")
+	}
+}
@@ -0,0 +1,310 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestFairQueueConfig creates a fair queue config with a fresh metrics registry
+func newTestFairQueueConfig(slots int) *FairQueueConfig {
+	config := NewFairQueueConfig(slots)
+	config.Metrics = NewFairQueueMetricsWithRegistry(prometheus.NewRegistry())
+	return config
+}
+
+// enqueue starts acquiring a slot in the background and waits until the request is queued
+func enqueue(t *testing.T, config *FairQueueConfig, leaseID string, granted chan<- string) {
+	t.Helper()
+
+	_, before := config.GetStats()
+	go func() {
+		if err := config.acquire(context.Background(), leaseID); err != nil {
+			t.Errorf("acquire(%s) failed: %v", leaseID, err)
+			return
+		}
+		granted <- leaseID
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, queued := config.GetStats(); queued > before {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("request for %s was never queued", leaseID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// drain releases slots one at a time and returns the order in which leases were granted
+func drain(t *testing.T, config *FairQueueConfig, granted <-chan string, n int) []string {
+	t.Helper()
+
+	order := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		config.release()
+		select {
+		case leaseID := <-granted:
+			order = append(order, leaseID)
+		case <-time.After(time.Second):
+			t.Fatalf("no request granted after release %d", i+1)
+		}
+	}
+	config.release()
+
+	return order
+}
+
+// TestFairQueueInterleavesLeases tests that a quiet lease is not stuck behind a noisy one
+func TestFairQueueInterleavesLeases(t *testing.T) {
+	config := newTestFairQueueConfig(1)
+	NewFairQueueMiddleware(config).Stop()
+
+	if err := config.acquire(context.Background(), "noisy"); err != nil {
+		t.Fatalf("Failed to acquire first slot: %v", err)
+	}
+
+	granted := make(chan string, 5)
+	for i := 0; i < 3; i++ {
+		enqueue(t, config, "noisy", granted)
+	}
+	enqueue(t, config, "quiet", granted)
+
+	order := drain(t, config, granted, 4)
+	want := []string{"quiet", "noisy", "noisy", "noisy"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Grant order = %v, want %v", order, want)
+		}
+	}
+}
+
+// TestFairQueueWeights tests that slots are shared in proportion to lease weights
+func TestFairQueueWeights(t *testing.T) {
+	config := newTestFairQueueConfig(1)
+	NewFairQueueMiddleware(config).Stop()
+
+	if err := config.SetLeaseWeight("heavy-*", 2); err != nil {
+		t.Fatalf("Failed to set weight: %v", err)
+	}
+	if err := config.SetLeaseWeight("light", 0); err == nil {
+		t.Error("Expected error for non-positive weight")
+	}
+	if got := config.GetLeaseWeight("heavy-1"); got != 2 {
+		t.Errorf("GetLeaseWeight(heavy-1) = %v, want 2", got)
+	}
+
+	if err := config.acquire(context.Background(), "blocker"); err != nil {
+		t.Fatalf("Failed to acquire first slot: %v", err)
+	}
+
+	granted := make(chan string, 6)
+	for i := 0; i < 2; i++ {
+		enqueue(t, config, "light", granted)
+	}
+	for i := 0; i < 4; i++ {
+		enqueue(t, config, "heavy-1", granted)
+	}
+
+	// Finish tags: heavy 0.5, 1, 1.5, 2; light 1, 2 (ties go to the earlier arrival)
+	order := drain(t, config, granted, 6)
+	want := []string{"heavy-1", "light", "heavy-1", "heavy-1", "light", "heavy-1"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Grant order = %v, want %v", order, want)
+		}
+	}
+}
+
+// TestFairQueueIdleLeaseNoCredit tests that an idle lease cannot bank virtual time
+func TestFairQueueIdleLeaseNoCredit(t *testing.T) {
+	config := newTestFairQueueConfig(1)
+	NewFairQueueMiddleware(config).Stop()
+
+	// Advance the virtual clock with another lease's traffic
+	for i := 0; i < 5; i++ {
+		if err := config.acquire(context.Background(), "busy"); err != nil {
+			t.Fatalf("acquire failed: %v", err)
+		}
+		config.release()
+	}
+
+	if err := config.acquire(context.Background(), "busy"); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	// The idle lease starts at the current virtual time rather than zero, so it
+	// alternates with the busy lease instead of taking every slot
+	granted := make(chan string, 4)
+	enqueue(t, config, "busy", granted)
+	for i := 0; i < 3; i++ {
+		enqueue(t, config, "idle", granted)
+	}
+
+	order := drain(t, config, granted, 4)
+	want := []string{"idle", "busy", "idle", "idle"}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Grant order = %v, want %v", order, want)
+		}
+	}
+}
+
+// TestFairQueueMiddlewareQueueFull tests rejection when the queue is full
+func TestFairQueueMiddlewareQueueFull(t *testing.T) {
+	config := newTestFairQueueConfig(1)
+	config.MaxQueue = 1
+	m := NewFairQueueMiddleware(config)
+	defer m.Stop()
+
+	if err := config.acquire(context.Background(), "lease-a"); err != nil {
+		t.Fatalf("Failed to acquire first slot: %v", err)
+	}
+	granted := make(chan string, 1)
+	enqueue(t, config, "lease-a", granted)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, leaseRequest("lease-b"))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+
+	drain(t, config, granted, 1)
+}
+
+// TestFairQueueMiddlewareQueueTimeout tests that a queued request gives up after the timeout
+func TestFairQueueMiddlewareQueueTimeout(t *testing.T) {
+	config := newTestFairQueueConfig(1)
+	config.QueueTimeout = 20 * time.Millisecond
+	m := NewFairQueueMiddleware(config)
+	defer m.Stop()
+
+	if err := config.acquire(context.Background(), "lease-a"); err != nil {
+		t.Fatalf("Failed to acquire first slot: %v", err)
+	}
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, leaseRequest("lease-b"))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status 503, got %d", rec.Code)
+	}
+
+	if _, queued := config.GetStats(); queued != 0 {
+		t.Errorf("Expected empty queue after timeout, got %d", queued)
+	}
+
+	// The abandoned request must not count against the lease
+	config.mu.Lock()
+	finish := config.leases["lease-b"].finish
+	config.mu.Unlock()
+	if finish != 0 {
+		t.Errorf("Expected lease-b finish tag to be rolled back, got %v", finish)
+	}
+}
+
+// TestFairQueueMiddlewareRecordsWait tests per-lease wait time metrics
+func TestFairQueueMiddlewareRecordsWait(t *testing.T) {
+	config := newTestFairQueueConfig(2)
+	m := NewFairQueueMiddleware(config)
+	defer m.Stop()
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, leaseRequest("lease-a"))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+	}
+
+	metric := &dto.Metric{}
+	observer, err := config.Metrics.WaitSeconds.GetMetricWithLabelValues("lease-a")
+	if err != nil {
+		t.Fatalf("Failed to get metric: %v", err)
+	}
+	if err := observer.(prometheus.Histogram).Write(metric); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	if got := metric.GetHistogram().GetSampleCount(); got != 3 {
+		t.Errorf("Expected 3 wait samples, got %d", got)
+	}
+
+	if inFlight, _ := config.GetStats(); inFlight != 0 {
+		t.Errorf("Expected no in-flight requests, got %d", inFlight)
+	}
+}
+
+// TestFairQueueCleanupIdleLeases tests that idle lease state is dropped
+func TestFairQueueCleanupIdleLeases(t *testing.T) {
+	config := newTestFairQueueConfig(1)
+	NewFairQueueMiddleware(config).Stop()
+
+	if err := config.acquire(context.Background(), "lease-a"); err != nil {
+		t.Fatalf("Failed to acquire first slot: %v", err)
+	}
+	granted := make(chan string, 1)
+	enqueue(t, config, "lease-b", granted)
+
+	// lease-a's reservation is still ahead of the virtual clock and lease-b is queued
+	config.CleanupIdleLeases()
+	config.mu.Lock()
+	count := len(config.leases)
+	config.mu.Unlock()
+	if count != 2 {
+		t.Errorf("Expected 2 leases while busy, got %d", count)
+	}
+
+	drain(t, config, granted, 1)
+
+	config.CleanupIdleLeases()
+	config.mu.Lock()
+	count = len(config.leases)
+	config.mu.Unlock()
+	if count != 0 {
+		t.Errorf("Expected lease state to be dropped once idle, got %d", count)
+	}
+}
+
+// TestFairQueueMiddlewareWithoutLeaseID tests that requests without a lease bypass the queue
+func TestFairQueueMiddlewareWithoutLeaseID(t *testing.T) {
+	config := newTestFairQueueConfig(1)
+	m := NewFairQueueMiddleware(config)
+	defer m.Stop()
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inFlight, _ := config.GetStats(); inFlight != 0 {
+			t.Errorf("Expected request to bypass the queue, got %d in flight", inFlight)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/test", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// GlobalConcurrencyMetrics holds process-wide concurrency limiting metrics
+type GlobalConcurrencyMetrics struct {
+	InFlight      prometheus.Gauge
+	Queued        prometheus.Gauge
+	RejectedTotal *prometheus.CounterVec
+}
+
+// NewGlobalConcurrencyMetrics creates new global concurrency metrics using the default registry
+func NewGlobalConcurrencyMetrics() *GlobalConcurrencyMetrics {
+	return NewGlobalConcurrencyMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewGlobalConcurrencyMetricsWithRegistry creates new global concurrency metrics with a custom registry
+func NewGlobalConcurrencyMetricsWithRegistry(reg prometheus.Registerer) *GlobalConcurrencyMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &GlobalConcurrencyMetrics{
+		InFlight: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_global_inflight_requests",
+				Help: "Current number of in-flight requests admitted by the global concurrency limit",
+			},
+		),
+		Queued: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_global_queued_requests",
+				Help: "Current number of requests waiting for a global concurrency slot",
+			},
+		),
+		RejectedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_global_concurrency_rejected_total",
+				Help: "Total number of requests shed by the global concurrency limit",
+			},
+			[]string{"reason"}, // reason: "limit_exceeded", "queue_timeout", "cancelled"
+		),
+	}
+}
+
+// GlobalConcurrencyConfig holds the process-wide concurrency limit configuration
+type GlobalConcurrencyConfig struct {
+	MaxConcurrent int           // Max in-flight requests across the whole process
+	MaxQueue      int           // Max requests waiting for a slot (0 = reject immediately)
+	QueueTimeout  time.Duration // Max time a request waits in the queue
+	RetryAfter    time.Duration // Retry-After advertised on 503 responses
+	ExemptPaths   []string      // Exact paths that bypass the limit, e.g. health checks
+	Metrics       *GlobalConcurrencyMetrics
+
+	// Rejections is told about requests the limit turns away, e.g. saturation.Tracker (nil = none)
+	Rejections RejectionRecorder
+}
+
+// GlobalConcurrencyMiddleware sheds load once the whole process is saturated
+type GlobalConcurrencyMiddleware struct {
+	config  *GlobalConcurrencyConfig
+	slots   *bulkhead
+	exempts map[string]bool
+}
+
+// NewGlobalConcurrencyConfig creates a new global concurrency limit configuration
+func NewGlobalConcurrencyConfig(maxConcurrent int) *GlobalConcurrencyConfig {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1000 // Default: 1000 in-flight requests
+	}
+
+	return &GlobalConcurrencyConfig{
+		MaxConcurrent: maxConcurrent,
+		MaxQueue:      0,
+		QueueTimeout:  time.Second,
+		RetryAfter:    time.Second,
+	}
+}
+
+// NewGlobalConcurrencyMiddleware creates a new global concurrency limit middleware
+func NewGlobalConcurrencyMiddleware(config *GlobalConcurrencyConfig) *GlobalConcurrencyMiddleware {
+	if config == nil {
+		config = NewGlobalConcurrencyConfig(0)
+	}
+
+	if config.MaxConcurrent <= 0 {
+		config.MaxConcurrent = 1000
+	}
+
+	if config.QueueTimeout <= 0 {
+		config.QueueTimeout = time.Second
+	}
+
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = time.Second
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewGlobalConcurrencyMetrics()
+	}
+
+	exempts := make(map[string]bool, len(config.ExemptPaths))
+	for _, path := range config.ExemptPaths {
+		exempts[path] = true
+	}
+
+	metrics := config.Metrics
+	return &GlobalConcurrencyMiddleware{
+		config: config,
+		slots: &bulkhead{
+			limit:    config.MaxConcurrent,
+			lastUsed: time.Now(),
+			observe: func(inFlight, queued int) {
+				metrics.InFlight.Set(float64(inFlight))
+				metrics.Queued.Set(float64(queued))
+			},
+		},
+		exempts: exempts,
+	}
+}
+
+// SetMaxConcurrent changes the limit without touching in-flight requests
+func (m *GlobalConcurrencyMiddleware) SetMaxConcurrent(maxConcurrent int) error {
+	if maxConcurrent <= 0 {
+		return errors.New("max concurrent requests must be positive")
+	}
+
+	m.slots.setLimit(maxConcurrent)
+	return nil
+}
+
+// GetStats returns the current number of in-flight and queued requests
+func (m *GlobalConcurrencyMiddleware) GetStats() (inFlight, queued int) {
+	m.slots.mu.Lock()
+	defer m.slots.mu.Unlock()
+
+	return m.slots.inFlight, len(m.slots.waiters)
+}
+
+// Middleware returns an http.Handler that limits in-flight requests across the process
+func (m *GlobalConcurrencyMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.exempts[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if err := m.slots.acquire(r.Context(), m.config.MaxQueue, m.config.QueueTimeout); err != nil {
+			m.handleConcurrencyError(w, r, err)
+			return
+		}
+		defer m.slots.release()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleConcurrencyError writes a 503 response for a shed request
+func (m *GlobalConcurrencyMiddleware) handleConcurrencyError(w http.ResponseWriter, r *http.Request, err error) {
+	// Clients that gave up while queued are not a sign of saturation
+	if m.config.Rejections != nil && (errors.Is(err, ErrConcurrencyLimitExceeded) || errors.Is(err, ErrConcurrencyQueueTimeout)) {
+		m.config.Rejections.RecordRejection("concurrency")
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(m.config.RetryAfter.Seconds()))))
+
+	switch {
+	case errors.Is(err, ErrConcurrencyLimitExceeded):
+		m.config.Metrics.RejectedTotal.WithLabelValues("limit_exceeded").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "server_overloaded", "Server is at capacity, retry later")
+	case errors.Is(err, ErrConcurrencyQueueTimeout):
+		m.config.Metrics.RejectedTotal.WithLabelValues("queue_timeout").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "server_overloaded", "Timed out waiting for server capacity")
+	default:
+		// Request context was cancelled while queued
+		m.config.Metrics.RejectedTotal.WithLabelValues("cancelled").Inc()
+		problem.Write(w, r, http.StatusServiceUnavailable, "request_cancelled", "Request cancelled while waiting for server capacity")
+	}
+}
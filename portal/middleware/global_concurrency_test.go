@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestGlobalConcurrencyConfig creates a global concurrency config with a fresh metrics registry
+func newTestGlobalConcurrencyConfig(maxConcurrent int) *GlobalConcurrencyConfig {
+	config := NewGlobalConcurrencyConfig(maxConcurrent)
+	config.Metrics = NewGlobalConcurrencyMetricsWithRegistry(prometheus.NewRegistry())
+	return config
+}
+
+// metricValue returns the value of a counter or gauge
+func metricValue(t *testing.T, c prometheus.Metric) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+
+	if m.Counter != nil {
+		return m.Counter.GetValue()
+	}
+
+	return m.Gauge.GetValue()
+}
+
+// holdingHandler signals on started and blocks until release is closed
+func holdingHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// TestGlobalConcurrencyRejects tests that requests beyond the limit are shed with 503
+func TestGlobalConcurrencyRejects(t *testing.T) {
+	config := newTestGlobalConcurrencyConfig(2)
+	config.RetryAfter = 1500 * time.Millisecond
+	m := NewGlobalConcurrencyMiddleware(config)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	handler := m.Middleware(holdingHandler(started, release))
+
+	done := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequest("GET", "/peer/a", nil))
+			done <- rr.Code
+		}()
+		<-started
+	}
+
+	if got := metricValue(t, config.Metrics.InFlight); got != 2 {
+		t.Errorf("Expected in-flight gauge 2, got %v", got)
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/peer/b", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+	if got := metricValue(t, config.Metrics.RejectedTotal.WithLabelValues("limit_exceeded")); got != 1 {
+		t.Errorf("Expected 1 limit_exceeded rejection, got %v", got)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("Expected admitted request to succeed, got %d", code)
+		}
+	}
+
+	if inFlight, queued := m.GetStats(); inFlight != 0 || queued != 0 {
+		t.Errorf("Expected no in-flight or queued requests, got %d/%d", inFlight, queued)
+	}
+	if got := metricValue(t, config.Metrics.InFlight); got != 0 {
+		t.Errorf("Expected in-flight gauge 0, got %v", got)
+	}
+}
+
+// TestGlobalConcurrencyQueue tests that queued requests are admitted when a slot frees up
+func TestGlobalConcurrencyQueue(t *testing.T) {
+	config := newTestGlobalConcurrencyConfig(1)
+	config.MaxQueue = 1
+	config.QueueTimeout = 5 * time.Second
+	m := NewGlobalConcurrencyMiddleware(config)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	handler := m.Middleware(holdingHandler(started, release))
+
+	done := make(chan int, 2)
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		done <- rr.Code
+	}()
+	<-started
+
+	go func() {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+		done <- rr.Code
+	}()
+
+	// Wait for the second request to join the queue
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, queued := m.GetStats(); queued == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Second request was never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := metricValue(t, config.Metrics.Queued); got != 1 {
+		t.Errorf("Expected queued gauge 1, got %v", got)
+	}
+
+	// The queue is full, so a third request is shed
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("Expected request to succeed, got %d", code)
+		}
+	}
+	if got := metricValue(t, config.Metrics.Queued); got != 0 {
+		t.Errorf("Expected queued gauge 0, got %v", got)
+	}
+}
+
+// TestGlobalConcurrencyQueueTimeout tests that a queued request gives up after the timeout
+func TestGlobalConcurrencyQueueTimeout(t *testing.T) {
+	config := newTestGlobalConcurrencyConfig(1)
+	config.MaxQueue = 1
+	config.QueueTimeout = 20 * time.Millisecond
+	m := NewGlobalConcurrencyMiddleware(config)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	handler := m.Middleware(holdingHandler(started, release))
+
+	go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	<-started
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+	if got := metricValue(t, config.Metrics.RejectedTotal.WithLabelValues("queue_timeout")); got != 1 {
+		t.Errorf("Expected 1 queue_timeout rejection, got %v", got)
+	}
+}
+
+// TestGlobalConcurrencyExemptPaths tests that exempt paths bypass a saturated limit
+func TestGlobalConcurrencyExemptPaths(t *testing.T) {
+	config := newTestGlobalConcurrencyConfig(1)
+	config.ExemptPaths = []string{"/health"}
+	m := NewGlobalConcurrencyMiddleware(config)
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+	blocking := m.Middleware(holdingHandler(started, release))
+
+	go blocking.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/peer/a", nil))
+	<-started
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected exempt path to succeed, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/peer/b", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rr.Code)
+	}
+}
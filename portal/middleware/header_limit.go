@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// HeaderLimitMetrics holds request header limit metrics
+type HeaderLimitMetrics struct {
+	RejectedTotal *prometheus.CounterVec
+}
+
+// NewHeaderLimitMetrics creates new header limit metrics using the default registry
+func NewHeaderLimitMetrics() *HeaderLimitMetrics {
+	return NewHeaderLimitMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewHeaderLimitMetricsWithRegistry creates new header limit metrics with a custom registry
+func NewHeaderLimitMetricsWithRegistry(reg prometheus.Registerer) *HeaderLimitMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &HeaderLimitMetrics{
+		RejectedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_header_limit_rejected_total",
+				Help: "Total number of requests rejected for oversized or too many headers",
+			},
+			[]string{"reason"}, // reason: "size", "count"
+		),
+	}
+}
+
+// HeaderLimitConfig holds the request header limit configuration
+type HeaderLimitConfig struct {
+	MaxHeaderBytes int // Max total size of header lines, counted as on the wire (0 = unlimited)
+	MaxHeaderCount int // Max number of header lines (0 = unlimited)
+	Metrics        *HeaderLimitMetrics
+}
+
+// HeaderLimitMiddleware rejects requests whose headers exceed the configured limits
+type HeaderLimitMiddleware struct {
+	config *HeaderLimitConfig
+}
+
+// NewHeaderLimitConfig creates a new request header limit configuration
+func NewHeaderLimitConfig(maxHeaderBytes, maxHeaderCount int) *HeaderLimitConfig {
+	return &HeaderLimitConfig{
+		MaxHeaderBytes: maxHeaderBytes,
+		MaxHeaderCount: maxHeaderCount,
+	}
+}
+
+// NewHeaderLimitMiddleware creates a new request header limit middleware
+func NewHeaderLimitMiddleware(config *HeaderLimitConfig) *HeaderLimitMiddleware {
+	if config == nil {
+		config = NewHeaderLimitConfig(0, 0)
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewHeaderLimitMetrics()
+	}
+
+	return &HeaderLimitMiddleware{config: config}
+}
+
+// Middleware returns an http.Handler that rejects oversized headers with 431
+func (m *HeaderLimitMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size, count := headerSize(r)
+
+		if m.config.MaxHeaderCount > 0 && count > m.config.MaxHeaderCount {
+			m.config.Metrics.RejectedTotal.WithLabelValues("count").Inc()
+			writeHeaderLimitError(w, r, fmt.Sprintf("Request has %d headers, the limit is %d", count, m.config.MaxHeaderCount))
+			return
+		}
+
+		if m.config.MaxHeaderBytes > 0 && size > m.config.MaxHeaderBytes {
+			m.config.Metrics.RejectedTotal.WithLabelValues("size").Inc()
+			writeHeaderLimitError(w, r, fmt.Sprintf("Request headers are %d bytes, the limit is %d", size, m.config.MaxHeaderBytes))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// headerSize returns the wire size and number of the request's header lines, including Host
+func headerSize(r *http.Request) (size, count int) {
+	if r.Host != "" {
+		size += len("Host: \r\n") + len(r.Host)
+		count++
+	}
+
+	for name, values := range r.Header {
+		for _, value := range values {
+			size += len(name) + len(": \r\n") + len(value)
+			count++
+		}
+	}
+
+	return size, count
+}
+
+// writeHeaderLimitError writes a 431 response; the connection is closed since the client misbehaved
+func writeHeaderLimitError(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("Connection", "close")
+	problem.Write(w, r, http.StatusRequestHeaderFieldsTooLarge, "request_header_fields_too_large", message)
+}
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestHeaderLimitConfig creates a header limit config with a fresh metrics registry
+func newTestHeaderLimitConfig(maxHeaderBytes, maxHeaderCount int) *HeaderLimitConfig {
+	config := NewHeaderLimitConfig(maxHeaderBytes, maxHeaderCount)
+	config.Metrics = NewHeaderLimitMetricsWithRegistry(prometheus.NewRegistry())
+	return config
+}
+
+// TestHeaderLimitSize tests that requests with oversized headers are rejected with 431
+func TestHeaderLimitSize(t *testing.T) {
+	config := newTestHeaderLimitConfig(256, 0)
+	handler := NewHeaderLimitMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest("GET", "/peer/a", nil)
+	req.Header.Set("X-Small", "ok")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected small headers to pass, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/peer/a", nil)
+	req.Header.Set("X-Large", strings.Repeat("a", 300))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestHeaderFieldsTooLarge, rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "request_header_fields_too_large") {
+		t.Errorf("Unexpected body %q", rr.Body.String())
+	}
+	if got := metricValue(t, config.Metrics.RejectedTotal.WithLabelValues("size")); got != 1 {
+		t.Errorf("Expected 1 size rejection, got %v", got)
+	}
+}
+
+// TestHeaderLimitCount tests that requests with too many header lines are rejected with 431
+func TestHeaderLimitCount(t *testing.T) {
+	config := newTestHeaderLimitConfig(0, 5)
+	handler := NewHeaderLimitMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Host plus four headers is exactly at the limit
+	req := httptest.NewRequest("GET", "/peer/a", nil)
+	for _, name := range []string{"A", "B", "C"} {
+		req.Header.Set("X-"+name, "1")
+	}
+	req.Header.Add("X-C", "2")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected headers at the limit to pass, got %d", rr.Code)
+	}
+
+	// Repeated values count as separate header lines
+	req.Header.Add("X-C", "3")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestHeaderFieldsTooLarge {
+		t.Errorf("Expected status %d, got %d", http.StatusRequestHeaderFieldsTooLarge, rr.Code)
+	}
+	if got := metricValue(t, config.Metrics.RejectedTotal.WithLabelValues("count")); got != 1 {
+		t.Errorf("Expected 1 count rejection, got %v", got)
+	}
+}
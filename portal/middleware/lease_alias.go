@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Lease alias errors
+var (
+	ErrInvalidLeaseAlias  = errors.New("invalid lease alias")
+	ErrLeaseAliasCycle    = errors.New("lease alias cycle")
+	ErrLeaseAliasNotFound = errors.New("lease alias not found")
+)
+
+// SetLeaseAlias maps an old lease ID to the lease it now resolves to
+// Aliases may chain (a -> b -> c) but never loop back on themselves
+func (c *ACLConfig) SetLeaseAlias(alias, leaseID string) error {
+	if !isValidLeaseID(alias) || !isValidLeaseID(leaseID) {
+		return fmt.Errorf("%w: alias and lease ID must be exact lease IDs", ErrInvalidLeaseAlias)
+	}
+	if alias == leaseID {
+		return fmt.Errorf("%w: %s cannot alias itself", ErrLeaseAliasCycle, alias)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Following the chain from the new target must not come back to the alias
+	seen := map[string]bool{alias: true}
+	for next, ok := leaseID, true; ok; next, ok = c.LeaseAliases[next] {
+		if seen[next] {
+			return fmt.Errorf("%w: %s -> %s would loop", ErrLeaseAliasCycle, alias, leaseID)
+		}
+		seen[next] = true
+	}
+
+	if c.LeaseAliases == nil {
+		c.LeaseAliases = make(map[string]string)
+	}
+
+	c.LeaseAliases[alias] = leaseID
+	return nil
+}
+
+// RemoveLeaseAlias removes a lease alias
+func (c *ACLConfig) RemoveLeaseAlias(alias string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.LeaseAliases[alias]; !exists {
+		return fmt.Errorf("%w: %s", ErrLeaseAliasNotFound, alias)
+	}
+
+	delete(c.LeaseAliases, alias)
+	return nil
+}
+
+// ListLeaseAliases returns a copy of all lease aliases
+func (c *ACLConfig) ListLeaseAliases() map[string]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	aliases := make(map[string]string, len(c.LeaseAliases))
+	for alias, leaseID := range c.LeaseAliases {
+		aliases[alias] = leaseID
+	}
+	return aliases
+}
+
+// ResolveLeaseID follows aliases to the canonical lease ID
+// A lease ID that is not an alias is returned unchanged
+func (c *ACLConfig) ResolveLeaseID(leaseID string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// SetLeaseAlias rejects cycles, so the length bound only guards direct map edits
+	for i := 0; i <= len(c.LeaseAliases); i++ {
+		next, ok := c.LeaseAliases[leaseID]
+		if !ok {
+			break
+		}
+		leaseID = next
+	}
+	return leaseID
+}
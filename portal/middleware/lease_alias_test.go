@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestSetLeaseAlias tests alias validation and transitive resolution
+func TestSetLeaseAlias(t *testing.T) {
+	config := NewACLConfig()
+
+	if err := config.SetLeaseAlias("old", "new"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	if err := config.SetLeaseAlias("older", "old"); err != nil {
+		t.Fatalf("Failed to set chained alias: %v", err)
+	}
+
+	if got := config.ResolveLeaseID("older"); got != "new" {
+		t.Errorf("Expected older to resolve to new, got %q", got)
+	}
+	if got := config.ResolveLeaseID("other"); got != "other" {
+		t.Errorf("Expected a non-alias to resolve to itself, got %q", got)
+	}
+
+	tests := []struct {
+		name    string
+		alias   string
+		leaseID string
+		wantErr error
+	}{
+		{"self alias", "a", "a", ErrLeaseAliasCycle},
+		{"direct cycle", "new", "old", ErrLeaseAliasCycle},
+		{"transitive cycle", "new", "older", ErrLeaseAliasCycle},
+		{"wildcard alias", "old-*", "new", ErrInvalidLeaseAlias},
+		{"empty target", "a", "", ErrInvalidLeaseAlias},
+	}
+	for _, tt := range tests {
+		if err := config.SetLeaseAlias(tt.alias, tt.leaseID); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+
+	if err := config.RemoveLeaseAlias("old"); err != nil {
+		t.Fatalf("Failed to remove alias: %v", err)
+	}
+	if got := config.ResolveLeaseID("older"); got != "old" {
+		t.Errorf("Expected older to stop at old once old -> new is removed, got %q", got)
+	}
+	if err := config.RemoveLeaseAlias("old"); !errors.Is(err, ErrLeaseAliasNotFound) {
+		t.Errorf("Expected ErrLeaseAliasNotFound, got %v", err)
+	}
+}
+
+// TestACLMiddlewareResolvesLeaseAlias tests that requests for an alias are checked and handled as the canonical lease
+func TestACLMiddlewareResolvesLeaseAlias(t *testing.T) {
+	config := NewACLConfig()
+	if err := config.AddRule(&ACLRule{LeaseID: "new-lease", AllowedKeyIDs: []string{"key1"}}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := config.SetLeaseAlias("old-lease", "new-lease"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+
+	var gotLeaseID string
+	handler := NewACLMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLeaseID = GetLeaseID(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/peer/old-lease/items", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "key1"}))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected alias to be allowed by the canonical lease's rule, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if gotLeaseID != "new-lease" {
+		t.Errorf("Expected canonical lease ID in context, got %q", gotLeaseID)
+	}
+}
@@ -5,13 +5,15 @@ import (
 	"fmt"
 	"net/http"
 	"sync"
+	"time"
 )
 
 // LeaseRateLimitRule defines rate limit for a specific lease
 type LeaseRateLimitRule struct {
-	LeaseID           string  // Lease ID (supports wildcards like "mcp-*")
-	RequestsPerSecond float64 // Rate limit for this lease
-	BurstSize         int     // Burst capacity
+	LeaseID           string        // Lease ID (supports wildcards like "mcp-*")
+	RequestsPerSecond float64       // Rate limit for this lease
+	BurstSize         int           // Burst capacity
+	MaxWait           time.Duration // Max time to wait for a token (0 = use config default)
 }
 
 // LeaseRateLimitConfig manages per-lease rate limiting
@@ -19,7 +21,13 @@ type LeaseRateLimitConfig struct {
 	Rules        map[string]*LeaseRateLimitRule // leaseID -> rule
 	DefaultRate  float64                        // Default rate for unconfigured leases
 	DefaultBurst int                            // Default burst for unconfigured leases
-	mu           sync.RWMutex
+	MaxWait      time.Duration                  // Default max time to wait for a token (0 = reject immediately)
+
+	// Rejections is told about requests the lease limits turn away, e.g. saturation.Tracker
+	// (nil = none); the base configuration's Rejections is not used, as it covers other routes
+	Rejections RejectionRecorder
+
+	mu sync.RWMutex
 }
 
 // LeaseRateLimitMiddleware provides lease-specific rate limiting
@@ -152,6 +160,15 @@ func (c *LeaseRateLimitConfig) GetRateLimit(leaseID string) (rate float64, burst
 	return c.DefaultRate, c.DefaultBurst
 }
 
+// GetMaxWait returns how long requests for a lease may wait for a token (considering defaults)
+func (c *LeaseRateLimitConfig) GetMaxWait(leaseID string) time.Duration {
+	rule := c.GetRule(leaseID)
+	if rule != nil && rule.MaxWait > 0 {
+		return rule.MaxWait
+	}
+	return c.MaxWait
+}
+
 // ListRules returns all configured rules
 func (c *LeaseRateLimitConfig) ListRules() []*LeaseRateLimitRule {
 	c.mu.RLock()
@@ -174,10 +191,13 @@ func NewLeaseRateLimitMiddleware(config *LeaseRateLimitConfig, baseRateLimitConf
 		baseRateLimitConfig = NewRateLimitConfig(100, 200)
 	}
 
+	rateLimitMiddleware := NewRateLimitMiddleware(baseRateLimitConfig)
+	rateLimitMiddleware.rejection = config.Rejections
+
 	return &LeaseRateLimitMiddleware{
 		config:              config,
 		rateLimitConfig:     baseRateLimitConfig,
-		rateLimitMiddleware: NewRateLimitMiddleware(baseRateLimitConfig),
+		rateLimitMiddleware: rateLimitMiddleware,
 	}
 }
 
@@ -191,6 +211,12 @@ func (m *LeaseRateLimitMiddleware) Stop() {
 // Middleware returns an http.Handler that performs lease-specific rate limiting
 func (m *LeaseRateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Exempt keys are neither limited nor counted
+		if m.rateLimitMiddleware.bypass.Bypasses(r, "lease_rate_limit") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Get lease ID from context (set by ACL middleware)
 		leaseID := GetLeaseID(r.Context())
 		if leaseID == "" {
@@ -208,7 +234,7 @@ func (m *LeaseRateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 		if apiKeyInfo != nil {
 			limiterKey = fmt.Sprintf("lease:%s:key:%s", leaseID, apiKeyInfo.KeyID)
 		} else {
-			clientIP := getClientIP(r)
+			clientIP := m.rateLimitMiddleware.clientIP.ClientIP(r)
 			if clientIP != nil {
 				limiterKey = fmt.Sprintf("lease:%s:ip:%s", leaseID, clientIP.String())
 			} else {
@@ -219,9 +245,9 @@ func (m *LeaseRateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 		// Get or create rate limiter for this lease
 		limiter := m.rateLimitConfig.GetLimiter(limiterKey, rate, burst)
 
-		// Check if request is allowed
-		if !limiter.Allow() {
-			m.rateLimitMiddleware.handleRateLimitExceeded(w, limiter, burst)
+		// Check if request is allowed, waiting for a token if the lease is in wait mode
+		if !allowOrWait(r, limiter, m.config.GetMaxWait(leaseID)) {
+			m.rateLimitMiddleware.handleRateLimitExceeded(w, r, limiter, burst)
 			return
 		}
 
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestNewLeaseRateLimitConfig tests creating a new lease rate limit configuration
@@ -406,3 +407,58 @@ func TestLeaseRateLimitWildcardPrecedence(t *testing.T) {
 		t.Errorf("Expected default rate 10, got %f", rate)
 	}
 }
+
+// TestLeaseRateLimitMaxWait tests per-lease wait mode
+func TestLeaseRateLimitMaxWait(t *testing.T) {
+	leaseConfig := NewLeaseRateLimitConfig(1, 1)
+	leaseConfig.MaxWait = 10 * time.Millisecond
+
+	if err := leaseConfig.AddRule(&LeaseRateLimitRule{
+		LeaseID:           "patient-*",
+		RequestsPerSecond: 20,
+		BurstSize:         1,
+		MaxWait:           time.Second,
+	}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	if got := leaseConfig.GetMaxWait("patient-lease"); got != time.Second {
+		t.Errorf("Expected rule MaxWait 1s, got %v", got)
+	}
+
+	if got := leaseConfig.GetMaxWait("other-lease"); got != 10*time.Millisecond {
+		t.Errorf("Expected default MaxWait 10ms, got %v", got)
+	}
+
+	middleware := NewLeaseRateLimitMiddleware(leaseConfig, NewRateLimitConfig(100, 200))
+	defer middleware.Stop()
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func(leaseID string) *http.Request {
+		req := httptest.NewRequest("GET", "/test", nil)
+		ctx := context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "test_key"})
+		ctx = context.WithValue(ctx, contextKey("lease_id"), leaseID)
+		return req.WithContext(ctx)
+	}
+
+	// The patient lease waits ~50ms for its next token instead of failing
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newRequest("patient-lease"))
+		if rr.Code != http.StatusOK {
+			t.Errorf("Patient request %d: expected status 200, got %d", i+1, rr.Code)
+		}
+	}
+
+	// The default lease would wait ~1s, which exceeds its 10ms cap
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest("other-lease"))
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest("other-lease"))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429 when wait exceeds cap, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LeaseRules maps lease IDs and wildcard patterns (e.g. "mcp-*") to per-lease settings
+// Match prefers an exact lease ID, then the longest wildcard prefix. The zero value is
+// empty and ready to use, and it is safe for concurrent use
+type LeaseRules[T any] struct {
+	mu    sync.RWMutex
+	rules map[string]T
+}
+
+// Set adds or replaces the value for a lease ID or pattern
+func (l *LeaseRules[T]) Set(pattern string, value T) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rules == nil {
+		l.rules = make(map[string]T)
+	}
+	l.rules[pattern] = value
+}
+
+// Delete removes the value for a lease ID or pattern, reporting whether it existed
+func (l *LeaseRules[T]) Delete(pattern string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, exists := l.rules[pattern]; !exists {
+		return false
+	}
+	delete(l.rules, pattern)
+	return true
+}
+
+// Get returns the value set for exactly this lease ID or pattern
+func (l *LeaseRules[T]) Get(pattern string) (T, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	value, exists := l.rules[pattern]
+	return value, exists
+}
+
+// Match returns the value that applies to a lease
+func (l *LeaseRules[T]) Match(leaseID string) (T, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if value, exists := l.rules[leaseID]; exists {
+		return value, true
+	}
+
+	var best T
+	bestLen := -1
+	for pattern, value := range l.rules {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(leaseID, prefix) && len(prefix) > bestLen {
+			best, bestLen = value, len(prefix)
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// List returns all values, ordered by lease ID or pattern
+func (l *LeaseRules[T]) List() []T {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	patterns := make([]string, 0, len(l.rules))
+	for pattern := range l.rules {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	values := make([]T, 0, len(patterns))
+	for _, pattern := range patterns {
+		values = append(values, l.rules[pattern])
+	}
+	return values
+}
+
+// Len returns the number of lease IDs and patterns with a value
+func (l *LeaseRules[T]) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.rules)
+}
+
+// MatchAnyLease reports whether a lease matches any of the lease IDs or wildcard patterns
+func MatchAnyLease(patterns []string, leaseID string) bool {
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, leaseID) {
+			return true
+		}
+	}
+	return false
+}
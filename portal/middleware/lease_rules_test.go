@@ -0,0 +1,55 @@
+package middleware
+
+import "testing"
+
+func TestLeaseRulesMatch(t *testing.T) {
+	var rules LeaseRules[string]
+	if _, ok := rules.Match("lease-1"); ok {
+		t.Error("Expected an empty table to match nothing")
+	}
+
+	rules.Set("*", "all")
+	rules.Set("mcp-*", "mcp")
+	rules.Set("mcp-video-*", "video")
+	rules.Set("mcp-video-1", "exact")
+
+	tests := map[string]string{
+		"mcp-video-1": "exact",
+		"mcp-video-2": "video",
+		"mcp-chat":    "mcp",
+		"other":       "all",
+	}
+	for leaseID, want := range tests {
+		if got, ok := rules.Match(leaseID); !ok || got != want {
+			t.Errorf("%s: expected %q, got %q", leaseID, want, got)
+		}
+	}
+
+	if got, ok := rules.Get("mcp-*"); !ok || got != "mcp" {
+		t.Errorf("Expected Get to return the pattern's own value, got %q", got)
+	}
+	if !rules.Delete("*") || rules.Delete("*") {
+		t.Error("Expected Delete to report whether the pattern existed")
+	}
+	if _, ok := rules.Match("other"); ok {
+		t.Error("Expected other to match nothing once * is removed")
+	}
+	if list := rules.List(); rules.Len() != 3 || len(list) != 3 || list[0] != "mcp" {
+		t.Errorf("Expected 3 values ordered by pattern, got %v", list)
+	}
+}
+
+func TestMatchAnyLease(t *testing.T) {
+	patterns := []string{"billing", "mcp-*"}
+
+	for leaseID, want := range map[string]bool{
+		"billing":   true,
+		"billing-2": false,
+		"mcp-chat":  true,
+		"other":     false,
+	} {
+		if got := MatchAnyLease(patterns, leaseID); got != want {
+			t.Errorf("%s: expected %v, got %v", leaseID, want, got)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Lease state errors
+var (
+	// ErrLeaseDisabled is returned for every request to a lease an administrator disabled
+	ErrLeaseDisabled = errors.New("lease disabled")
+
+	ErrLeaseStateStore = errors.New("lease state store operation failed")
+)
+
+// LeaseState is the administrative state of a lease, kept apart from its ACL rule so a
+// lease can be cut off and restored without touching its rule or upstream
+type LeaseState struct {
+	LeaseID   string
+	Enabled   bool   // Leases are enabled unless disabled through SetLeaseEnabled
+	Reason    string // Why the lease was disabled, for operators; never sent to clients
+	UpdatedAt time.Time
+}
+
+// LeaseStateStore persists lease states across restarts
+type LeaseStateStore interface {
+	// LoadLeaseStates returns every stored lease state
+	LoadLeaseStates() ([]*LeaseState, error)
+	// SaveLeaseState stores a lease state, replacing any earlier one for the lease
+	SaveLeaseState(state *LeaseState) error
+}
+
+// LoadLeaseStates replaces the lease states in memory with those stored in LeaseStateStore
+// Without a store there is nothing to load
+func (c *ACLConfig) LoadLeaseStates() error {
+	if c.LeaseStateStore == nil {
+		return nil
+	}
+
+	states, err := c.LeaseStateStore.LoadLeaseStates()
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.disabledLeases = make(map[string]*LeaseState)
+	for _, state := range states {
+		if !state.Enabled {
+			c.disabledLeases[state.LeaseID] = state
+		}
+	}
+	return nil
+}
+
+// SetLeaseEnabled enables or disables a lease, taking effect for the next request
+// The state is persisted first, so a lease is never left in a state a restart would undo
+func (c *ACLConfig) SetLeaseEnabled(leaseID string, enabled bool, reason string) (*LeaseState, error) {
+	if !isValidLeaseID(leaseID) {
+		return nil, fmt.Errorf("%w: lease state applies to exact lease IDs", ErrInvalidLeaseID)
+	}
+
+	state := &LeaseState{
+		LeaseID:   leaseID,
+		Enabled:   enabled,
+		UpdatedAt: c.clock(),
+	}
+	if !enabled {
+		state.Reason = reason
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.LeaseStateStore != nil {
+		if err := c.LeaseStateStore.SaveLeaseState(state); err != nil {
+			return nil, err
+		}
+	}
+
+	if enabled {
+		delete(c.disabledLeases, leaseID)
+		return state, nil
+	}
+
+	if c.disabledLeases == nil {
+		c.disabledLeases = make(map[string]*LeaseState)
+	}
+	c.disabledLeases[leaseID] = state
+	return state, nil
+}
+
+// GetLeaseState returns the state of a lease; leases never disabled are enabled
+func (c *ACLConfig) GetLeaseState(leaseID string) *LeaseState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if state, ok := c.disabledLeases[leaseID]; ok {
+		copied := *state
+		return &copied
+	}
+	return &LeaseState{LeaseID: leaseID, Enabled: true}
+}
+
+// ListDisabledLeases returns a copy of the state of every disabled lease
+func (c *ACLConfig) ListDisabledLeases() []*LeaseState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	states := make([]*LeaseState, 0, len(c.disabledLeases))
+	for _, state := range c.disabledLeases {
+		copied := *state
+		states = append(states, &copied)
+	}
+	return states
+}
+
+// leaseDisabled reports whether a lease has been disabled
+func (c *ACLConfig) leaseDisabled(leaseID string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, disabled := c.disabledLeases[leaseID]
+	return disabled
+}
+
+// SQLiteLeaseStateStore persists lease states in SQLite
+type SQLiteLeaseStateStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteLeaseStateStore creates a new SQLite-based lease state store
+func NewSQLiteLeaseStateStore(dbPath string) (*SQLiteLeaseStateStore, error) {
+	if dbPath == "" {
+		return nil, errors.New("database path cannot be empty")
+	}
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	query := `
+	CREATE TABLE IF NOT EXISTS lease_states (
+		lease_id TEXT PRIMARY KEY,
+		enabled INTEGER NOT NULL,
+		reason TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME NOT NULL
+	);
+	`
+	if _, err := db.Exec(query); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	}
+
+	return &SQLiteLeaseStateStore{db: db}, nil
+}
+
+// LoadLeaseStates returns every stored lease state
+func (s *SQLiteLeaseStateStore) LoadLeaseStates() ([]*LeaseState, error) {
+	rows, err := s.db.Query(`SELECT lease_id, enabled, reason, updated_at FROM lease_states`)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLeaseStateStore, err)
+	}
+	defer rows.Close()
+
+	var states []*LeaseState
+	for rows.Next() {
+		state := &LeaseState{}
+		if err := rows.Scan(&state.LeaseID, &state.Enabled, &state.Reason, &state.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrLeaseStateStore, err)
+		}
+		states = append(states, state)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrLeaseStateStore, err)
+	}
+	return states, nil
+}
+
+// SaveLeaseState stores a lease state, replacing any earlier one for the lease
+func (s *SQLiteLeaseStateStore) SaveLeaseState(state *LeaseState) error {
+	query := `
+	INSERT INTO lease_states (lease_id, enabled, reason, updated_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(lease_id) DO UPDATE SET
+		enabled = excluded.enabled,
+		reason = excluded.reason,
+		updated_at = excluded.updated_at
+	`
+	if _, err := s.db.Exec(query, state.LeaseID, state.Enabled, state.Reason, state.UpdatedAt); err != nil {
+		return fmt.Errorf("%w: %v", ErrLeaseStateStore, err)
+	}
+	return nil
+}
+
+// Close closes the database connection
+func (s *SQLiteLeaseStateStore) Close() error {
+	return s.db.Close()
+}
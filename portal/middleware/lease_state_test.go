@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestACLMiddlewareDisabledLease tests that a disabled lease is cut off and restored without touching its rule
+func TestACLMiddlewareDisabledLease(t *testing.T) {
+	config := NewACLConfig()
+	if err := config.AddRule(&ACLRule{LeaseID: "lease-*", AllowedKeyIDs: []string{"key1"}}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	if err := config.SetLeaseAlias("old-lease", "lease-1"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+
+	handler := NewACLMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "key1"}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if _, err := config.SetLeaseEnabled("lease-1", false, "abuse report"); err != nil {
+		t.Fatalf("Failed to disable lease: %v", err)
+	}
+
+	for _, path := range []string{"/peer/lease-1/data", "/peer/old-lease/data"} {
+		rr := serve(path)
+		if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"lease_disabled"`) {
+			t.Errorf("%s: expected 403 lease_disabled, got %d %s", path, rr.Code, rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), "abuse report") {
+			t.Errorf("%s: expected the reason not to reach the client", path)
+		}
+	}
+
+	// Other leases under the same rule are unaffected
+	if rr := serve("/peer/lease-2/data"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another lease to be allowed, got %d", rr.Code)
+	}
+
+	if _, err := config.SetLeaseEnabled("lease-1", true, ""); err != nil {
+		t.Fatalf("Failed to enable lease: %v", err)
+	}
+	if rr := serve("/peer/lease-1/data"); rr.Code != http.StatusOK {
+		t.Errorf("Expected an enabled lease to be allowed, got %d", rr.Code)
+	}
+	if config.GetRule("lease-1") == nil {
+		t.Error("Expected the lease's rule to be kept")
+	}
+}
+
+// TestSetLeaseEnabled tests lease state bookkeeping
+func TestSetLeaseEnabled(t *testing.T) {
+	config := NewACLConfig()
+
+	if state := config.GetLeaseState("lease-1"); !state.Enabled {
+		t.Error("Expected leases to be enabled by default")
+	}
+
+	if _, err := config.SetLeaseEnabled("lease-*", false, ""); !errors.Is(err, ErrInvalidLeaseID) {
+		t.Errorf("Expected ErrInvalidLeaseID for a wildcard, got %v", err)
+	}
+
+	if _, err := config.SetLeaseEnabled("lease-1", false, "incident 42"); err != nil {
+		t.Fatalf("Failed to disable lease: %v", err)
+	}
+	state := config.GetLeaseState("lease-1")
+	if state.Enabled || state.Reason != "incident 42" || state.UpdatedAt.IsZero() {
+		t.Errorf("Expected a disabled state with its reason, got %+v", state)
+	}
+	if disabled := config.ListDisabledLeases(); len(disabled) != 1 || disabled[0].LeaseID != "lease-1" {
+		t.Errorf("Expected lease-1 to be listed as disabled, got %v", disabled)
+	}
+
+	if err := config.CheckAccess("lease-1", "key1", nil); !errors.Is(err, ErrLeaseDisabled) {
+		t.Errorf("Expected ErrLeaseDisabled, got %v", err)
+	}
+}
+
+// failingLeaseStateStore fails every save
+type failingLeaseStateStore struct{}
+
+func (failingLeaseStateStore) LoadLeaseStates() ([]*LeaseState, error) { return nil, nil }
+
+func (failingLeaseStateStore) SaveLeaseState(*LeaseState) error { return ErrLeaseStateStore }
+
+// TestLeaseStatePersistence tests that lease states survive a restart
+func TestLeaseStatePersistence(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "leases.db")
+
+	store, err := NewSQLiteLeaseStateStore(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	config := NewACLConfig()
+	config.LeaseStateStore = store
+	if err := config.LoadLeaseStates(); err != nil {
+		t.Fatalf("Failed to load lease states: %v", err)
+	}
+	for _, leaseID := range []string{"lease-1", "lease-2"} {
+		if _, err := config.SetLeaseEnabled(leaseID, false, "incident"); err != nil {
+			t.Fatalf("Failed to disable %s: %v", leaseID, err)
+		}
+	}
+	if _, err := config.SetLeaseEnabled("lease-2", true, ""); err != nil {
+		t.Fatalf("Failed to enable lease-2: %v", err)
+	}
+	store.Close()
+
+	// A new gateway process loads the same states
+	store, err = NewSQLiteLeaseStateStore(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	restarted := NewACLConfig()
+	restarted.LeaseStateStore = store
+	if err := restarted.LoadLeaseStates(); err != nil {
+		t.Fatalf("Failed to load lease states: %v", err)
+	}
+	if state := restarted.GetLeaseState("lease-1"); state.Enabled || state.Reason != "incident" {
+		t.Errorf("Expected lease-1 to stay disabled, got %+v", state)
+	}
+	if state := restarted.GetLeaseState("lease-2"); !state.Enabled {
+		t.Error("Expected lease-2 to stay enabled")
+	}
+
+	// A change that cannot be persisted is not applied
+	failing := NewACLConfig()
+	failing.LeaseStateStore = failingLeaseStateStore{}
+	if err := failing.LoadLeaseStates(); err != nil {
+		t.Fatalf("Failed to set store: %v", err)
+	}
+	if _, err := failing.SetLeaseEnabled("lease-1", false, ""); !errors.Is(err, ErrLeaseStateStore) {
+		t.Errorf("Expected ErrLeaseStateStore, got %v", err)
+	}
+	if !failing.GetLeaseState("lease-1").Enabled {
+		t.Error("Expected a lease to stay enabled when its state could not be persisted")
+	}
+}
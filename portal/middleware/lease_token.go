@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LeaseTokenPrefix starts every lease token, telling it apart from an API key
+const LeaseTokenPrefix = "lt_"
+
+// MinLeaseTokenSecretSize is the shortest HMAC secret accepted for signing lease tokens
+const MinLeaseTokenSecretSize = 32
+
+// Lease token errors
+var (
+	ErrInvalidLeaseToken    = errors.New("invalid lease token")
+	ErrLeaseTokenIPMismatch = errors.New("lease token is not valid from this IP address")
+)
+
+// LeaseToken grants temporary access to a single lease on behalf of an API key, like a
+// pre-signed URL: whoever holds it can use the lease until it expires, without a key of
+// their own
+// The token acts as its API key, so that key must still exist and be allowed on the lease
+type LeaseToken struct {
+	ID        string    `json:"tid"`
+	LeaseID   string    `json:"lid"`
+	KeyID     string    `json:"kid"`          // API key the token acts for
+	Scopes    []string  `json:"scp"`          // A subset of the key's scopes
+	ClientIP  string    `json:"ip,omitempty"` // Only this client IP may use the token (empty = any)
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// LeaseTokenSigner signs and verifies lease tokens with an HMAC-SHA256 secret
+// Tokens are stateless: they cannot be revoked one by one, only by rotating the secret or
+// removing the API key they act for
+type LeaseTokenSigner struct {
+	secret []byte
+}
+
+// NewLeaseTokenSigner creates a signer from a secret of at least MinLeaseTokenSecretSize bytes
+func NewLeaseTokenSigner(secret []byte) (*LeaseTokenSigner, error) {
+	if len(secret) < MinLeaseTokenSecretSize {
+		return nil, fmt.Errorf("lease token secret must be at least %d bytes", MinLeaseTokenSecretSize)
+	}
+	return &LeaseTokenSigner{secret: slices.Clone(secret)}, nil
+}
+
+// Sign returns the token string for a lease token, assigning it an ID if it has none
+func (s *LeaseTokenSigner) Sign(token *LeaseToken) (string, error) {
+	if token.LeaseID == "" || token.KeyID == "" {
+		return "", errors.New("lease token needs a lease ID and key ID")
+	}
+	if token.ClientIP != "" && net.ParseIP(token.ClientIP) == nil {
+		return "", fmt.Errorf("invalid client IP %q", token.ClientIP)
+	}
+
+	if token.ID == "" {
+		id := make([]byte, 8)
+		if _, err := rand.Read(id); err != nil {
+			return "", fmt.Errorf("failed to generate token ID: %w", err)
+		}
+		token.ID = hex.EncodeToString(id)
+	}
+
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return LeaseTokenPrefix + encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Verify checks a token string's signature and expiry and returns the token
+// Expired tokens return ErrExpiredAPIKey, like expired keys
+func (s *LeaseTokenSigner) Verify(value string, now time.Time) (*LeaseToken, error) {
+	encoded, signature, ok := strings.Cut(strings.TrimPrefix(value, LeaseTokenPrefix), ".")
+	if !ok || !strings.HasPrefix(value, LeaseTokenPrefix) {
+		return nil, ErrInvalidLeaseToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return nil, ErrInvalidLeaseToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidLeaseToken
+	}
+
+	var token LeaseToken
+	if err := json.Unmarshal(payload, &token); err != nil || token.LeaseID == "" || token.KeyID == "" {
+		return nil, ErrInvalidLeaseToken
+	}
+
+	if !now.Before(token.ExpiresAt) {
+		return nil, ErrExpiredAPIKey
+	}
+
+	return &token, nil
+}
+
+// mac returns the HMAC-SHA256 of an encoded payload
+func (s *LeaseTokenSigner) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
+
+// allowsIP reports whether the token may be used from ip
+func (t *LeaseToken) allowsIP(ip net.IP) bool {
+	if t.ClientIP == "" {
+		return true
+	}
+	return ip != nil && ip.Equal(net.ParseIP(t.ClientIP))
+}
@@ -0,0 +1,188 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testLeaseTokenSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestLeaseTokenSignVerify(t *testing.T) {
+	signer, err := NewLeaseTokenSigner(testLeaseTokenSecret)
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	now := time.Now()
+	value, err := signer.Sign(&LeaseToken{
+		LeaseID:   "lease-001",
+		KeyID:     "partner",
+		Scopes:    []string{"read"},
+		IssuedAt:  now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	if !strings.HasPrefix(value, LeaseTokenPrefix) {
+		t.Errorf("Expected the token to start with %s, got %q", LeaseTokenPrefix, value)
+	}
+
+	token, err := signer.Verify(value, now)
+	if err != nil {
+		t.Fatalf("Failed to verify token: %v", err)
+	}
+	if token.LeaseID != "lease-001" || token.KeyID != "partner" || token.ID == "" {
+		t.Errorf("Unexpected token %+v", token)
+	}
+
+	if _, err := signer.Verify(value, now.Add(time.Hour)); !errors.Is(err, ErrExpiredAPIKey) {
+		t.Errorf("Expected ErrExpiredAPIKey after expiry, got %v", err)
+	}
+
+	// A token changed after signing, or signed with another secret, is rejected
+	other, _ := NewLeaseTokenSigner([]byte("fedcba9876543210fedcba9876543210"))
+	forged, _ := other.Sign(&LeaseToken{LeaseID: "lease-001", KeyID: "partner", ExpiresAt: now.Add(time.Hour)})
+	encoded, signature, _ := strings.Cut(value, ".")
+	for name, bad := range map[string]string{
+		"tampered payload": encoded + "x." + signature,
+		"wrong secret":     forged,
+		"no signature":     encoded,
+		"api key":          "sk_live_test1234567890",
+	} {
+		if _, err := signer.Verify(bad, now); !errors.Is(err, ErrInvalidLeaseToken) {
+			t.Errorf("%s: expected ErrInvalidLeaseToken, got %v", name, err)
+		}
+	}
+
+	if _, err := NewLeaseTokenSigner([]byte("short")); err == nil {
+		t.Error("Expected a short secret to be rejected")
+	}
+}
+
+func TestAuthMiddlewareLeaseToken(t *testing.T) {
+	config := NewAuthConfig()
+	config.AddAPIKey(&APIKey{KeyID: "partner", Key: "sk_live_partner1234567890", Scopes: []string{"read"}})
+
+	signer, _ := NewLeaseTokenSigner(testLeaseTokenSecret)
+	config.LeaseTokenSigner = signer
+
+	var info *APIKeyInfo
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info = GetAPIKeyInfo(r.Context())
+	})
+	handler := NewAuthMiddleware(config).Middleware(next)
+
+	sign := func(token *LeaseToken) string {
+		token.ExpiresAt = time.Now().Add(time.Hour)
+		value, err := signer.Sign(token)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return value
+	}
+
+	serve := func(token, remoteAddr string) *httptest.ResponseRecorder {
+		info = nil
+		req := httptest.NewRequest("GET", "/peer/lease-001", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Scopes the key does not hold are dropped
+	rr := serve(sign(&LeaseToken{LeaseID: "lease-001", KeyID: "partner", Scopes: []string{"read", "write"}}), "203.0.113.1:1234")
+	if rr.Code != http.StatusOK || info == nil {
+		t.Fatalf("Expected the token to authenticate, got %d %s", rr.Code, rr.Body.String())
+	}
+	if info.KeyID != "partner" || info.LeaseID != "lease-001" || info.LeaseTokenID == "" {
+		t.Errorf("Expected the token to act for its key on its lease, got %+v", info)
+	}
+	if len(info.Scopes) != 1 || info.Scopes[0] != "read" {
+		t.Errorf("Expected only the key's scopes, got %v", info.Scopes)
+	}
+
+	// An IP-bound token is only accepted from that IP
+	bound := sign(&LeaseToken{LeaseID: "lease-001", KeyID: "partner", ClientIP: "203.0.113.1"})
+	if rr := serve(bound, "203.0.113.1:1234"); rr.Code != http.StatusOK {
+		t.Errorf("Expected the bound IP to be accepted, got %d", rr.Code)
+	}
+	if rr := serve(bound, "198.51.100.9:1234"); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "lease_token_ip_mismatch") {
+		t.Errorf("Expected another IP to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Without trusted proxies, a forwarding header cannot stand in for the bound IP
+	req := httptest.NewRequest("GET", "/peer/lease-001", nil)
+	req.Header.Set("Authorization", "Bearer "+bound)
+	req.Header.Set("X-Forwarded-For", "203.0.113.1")
+	req.RemoteAddr = "198.51.100.9:1234"
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "lease_token_ip_mismatch") {
+		t.Errorf("Expected a spoofed X-Forwarded-For to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Behind a trusted proxy, its header carries the client IP
+	resolver, err := NewClientIPResolver(nil, []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatalf("Failed to create resolver: %v", err)
+	}
+	config.ClientIPResolver = resolver
+	req.RemoteAddr = "10.0.0.1:1234"
+	rr = httptest.NewRecorder()
+	NewAuthMiddleware(config).Middleware(next).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected the bound IP forwarded by a trusted proxy to be accepted, got %d %s", rr.Code, rr.Body.String())
+	}
+	config.ClientIPResolver = nil
+
+	// Removing the key revokes its tokens
+	token := sign(&LeaseToken{LeaseID: "lease-001", KeyID: "partner"})
+	config.RemoveAPIKey("partner")
+	if rr := serve(token, "203.0.113.1:1234"); rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), "invalid_lease_token") {
+		t.Errorf("Expected a token for a removed key to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Without a signer, tokens are just unknown keys
+	config.LeaseTokenSigner = nil
+	plain := NewAuthMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	req = httptest.NewRequest("GET", "/peer/lease-001", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	plain.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without lease tokens enabled, got %d", rr.Code)
+	}
+}
+
+func TestACLMiddlewareLeaseToken(t *testing.T) {
+	config := NewACLConfig()
+	for _, leaseID := range []string{"lease-001", "lease-002"} {
+		if err := config.AddRule(&ACLRule{LeaseID: leaseID, AllowedKeyIDs: []string{"partner"}}); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+
+	handler := NewACLMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	info := &APIKeyInfo{KeyID: "partner", LeaseID: "lease-001", LeaseTokenID: "abc"}
+
+	for path, expected := range map[string]int{
+		"/peer/lease-001/data": http.StatusOK,
+		"/peer/lease-002/data": http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, info))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LeaseIDPlaceholder marks the lease ID segment in a lease path template
+const LeaseIDPlaceholder = "{lease_id}"
+
+// DefaultLeasePathTemplate is the lease path used when none is configured
+const DefaultLeasePathTemplate = "/peer/" + LeaseIDPlaceholder
+
+// ErrInvalidLeasePath is returned for malformed lease path templates
+var ErrInvalidLeasePath = errors.New("invalid lease path pattern")
+
+// LeasePathPattern locates the lease ID in request paths under a route prefix
+// Built from a template such as "/v2/relay/{lease_id}" with ParseLeasePathPattern
+type LeasePathPattern struct {
+	template string
+	segments []string // Path segments of the template, without the leading slash
+	position int      // Index of the lease ID segment in segments
+}
+
+// ParseLeasePathPattern parses a template with exactly one {lease_id} segment
+// At least one literal segment must precede the lease ID so the pattern has a route prefix
+func ParseLeasePathPattern(template string) (LeasePathPattern, error) {
+	if !strings.HasPrefix(template, "/") {
+		return LeasePathPattern{}, fmt.Errorf("%w %q: must start with /", ErrInvalidLeasePath, template)
+	}
+
+	segments := strings.Split(strings.TrimPrefix(template, "/"), "/")
+	position := -1
+	for i, segment := range segments {
+		switch {
+		case segment == LeaseIDPlaceholder:
+			if position >= 0 {
+				return LeasePathPattern{}, fmt.Errorf("%w %q: more than one %s", ErrInvalidLeasePath, template, LeaseIDPlaceholder)
+			}
+			position = i
+		case segment == "":
+			return LeasePathPattern{}, fmt.Errorf("%w %q: empty path segment", ErrInvalidLeasePath, template)
+		case strings.ContainsAny(segment, "{}*"):
+			return LeasePathPattern{}, fmt.Errorf("%w %q: unsupported segment %q", ErrInvalidLeasePath, template, segment)
+		}
+	}
+
+	if position < 0 {
+		return LeasePathPattern{}, fmt.Errorf("%w %q: missing %s", ErrInvalidLeasePath, template, LeaseIDPlaceholder)
+	}
+	if position == 0 {
+		return LeasePathPattern{}, fmt.Errorf("%w %q: %s cannot be the first segment", ErrInvalidLeasePath, template, LeaseIDPlaceholder)
+	}
+
+	return LeasePathPattern{
+		template: template,
+		segments: segments,
+		position: position,
+	}, nil
+}
+
+// ParseLeasePathPatterns parses a comma-separated list of lease path templates
+func ParseLeasePathPatterns(list string) ([]LeasePathPattern, error) {
+	var patterns []LeasePathPattern
+	for _, template := range strings.Split(list, ",") {
+		template = strings.TrimSpace(template)
+		if template == "" {
+			continue
+		}
+
+		pattern, err := ParseLeasePathPattern(template)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("%w: no patterns given", ErrInvalidLeasePath)
+	}
+
+	return patterns, nil
+}
+
+// defaultLeasePaths is shared by configs that do not set their own lease paths
+var defaultLeasePaths = DefaultLeasePathPatterns()
+
+// DefaultLeasePathPatterns returns the built-in /peer/{lease_id} pattern
+func DefaultLeasePathPatterns() []LeasePathPattern {
+	pattern, _ := ParseLeasePathPattern(DefaultLeasePathTemplate)
+	return []LeasePathPattern{pattern}
+}
+
+// String returns the template, which is also used as the metrics endpoint label
+func (p LeasePathPattern) String() string {
+	return p.template
+}
+
+// RoutePrefix returns the subtree path covering every request the pattern can match
+// e.g. "/v2/relay/" for "/v2/relay/{lease_id}", suitable for http.ServeMux registration
+func (p LeasePathPattern) RoutePrefix() string {
+	return "/" + strings.Join(p.segments[:p.position], "/") + "/"
+}
+
+// Match reports whether urlPath falls under the pattern and returns its lease ID segment
+// The lease ID is empty when the path stops at the prefix
+func (p LeasePathPattern) Match(urlPath string) (string, bool) {
+	parts := strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+
+	for i := 0; i < p.position; i++ {
+		if i >= len(parts) || parts[i] != p.segments[i] {
+			return "", false
+		}
+	}
+
+	if len(parts) <= p.position {
+		return "", true
+	}
+
+	// Literal segments after the lease ID must match too
+	for i := p.position + 1; i < len(p.segments); i++ {
+		if i >= len(parts) || parts[i] != p.segments[i] {
+			return "", false
+		}
+	}
+
+	return parts[p.position], true
+}
+
+// Subpath returns the part of urlPath after the pattern, e.g. "/search" for
+// "/peer/billing/search" under "/peer/{lease_id}", or "" if nothing follows
+// urlPath must be matched by the pattern
+func (p LeasePathPattern) Subpath(urlPath string) string {
+	parts := strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+	if len(parts) <= len(p.segments) {
+		return ""
+	}
+	return "/" + strings.Join(parts[len(p.segments):], "/")
+}
+
+// MatchLeasePath returns the first pattern covering urlPath
+func MatchLeasePath(urlPath string, patterns []LeasePathPattern) (LeasePathPattern, bool) {
+	for _, pattern := range patterns {
+		if _, ok := pattern.Match(urlPath); ok {
+			return pattern, true
+		}
+	}
+	return LeasePathPattern{}, false
+}
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestParseLeasePathPattern tests template validation
+func TestParseLeasePathPattern(t *testing.T) {
+	tests := []struct {
+		template    string
+		wantErr     bool
+		routePrefix string
+	}{
+		{template: "/peer/{lease_id}", routePrefix: "/peer/"},
+		{template: "/v2/relay/{lease_id}", routePrefix: "/v2/relay/"},
+		{template: "/v2/{lease_id}/relay", routePrefix: "/v2/"},
+		{template: "peer/{lease_id}", wantErr: true},
+		{template: "/{lease_id}", wantErr: true},
+		{template: "/peer", wantErr: true},
+		{template: "/peer/{lease_id}/{lease_id}", wantErr: true},
+		{template: "/peer//{lease_id}", wantErr: true},
+		{template: "/peer/*/{lease_id}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			pattern, err := ParseLeasePathPattern(tt.template)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidLeasePath) {
+					t.Errorf("Expected ErrInvalidLeasePath, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := pattern.RoutePrefix(); got != tt.routePrefix {
+				t.Errorf("RoutePrefix() = %q, want %q", got, tt.routePrefix)
+			}
+			if got := pattern.String(); got != tt.template {
+				t.Errorf("String() = %q, want %q", got, tt.template)
+			}
+		})
+	}
+}
+
+// TestLeasePathSubpath tests the part of a path after its pattern
+func TestLeasePathSubpath(t *testing.T) {
+	patterns, err := ParseLeasePathPatterns("/peer/{lease_id}, /v3/{lease_id}/invoke")
+	if err != nil {
+		t.Fatalf("ParseLeasePathPatterns failed: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		subpath string
+	}{
+		{"/peer/billing", ""},
+		{"/peer/billing/search", "/search"},
+		{"/peer/billing/users/42/", "/users/42/"},
+		{"/v3/billing/invoke", ""},
+		{"/v3/billing/invoke/batch", "/batch"},
+	}
+
+	for _, tt := range tests {
+		pattern, ok := MatchLeasePath(tt.path, patterns)
+		if !ok {
+			t.Fatalf("Expected %q to match a pattern", tt.path)
+		}
+		if got := pattern.Subpath(tt.path); got != tt.subpath {
+			t.Errorf("Subpath(%q) = %q, want %q", tt.path, got, tt.subpath)
+		}
+	}
+}
+
+// TestExtractLeaseIDCustomPatterns tests extraction with several configured lease paths
+func TestExtractLeaseIDCustomPatterns(t *testing.T) {
+	patterns, err := ParseLeasePathPatterns("/peer/{lease_id}, /v2/relay/{lease_id}, /v3/{lease_id}/invoke")
+	if err != nil {
+		t.Fatalf("ParseLeasePathPatterns failed: %v", err)
+	}
+
+	tests := []struct {
+		path   string
+		wantID string
+	}{
+		{"/peer/lease-001/data", "lease-001"},
+		{"/v2/relay/lease-002", "lease-002"},
+		{"/v2/relay/lease-002/tools/call", "lease-002"},
+		{"/v2/relay/", ""},
+		{"/v2/other/lease-002", ""},
+		{"/v3/lease-003/invoke", "lease-003"},
+		{"/v3/lease-003/other", ""},
+		{"/relay/lease-004", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := extractLeaseID(tt.path, patterns); got != tt.wantID {
+				t.Errorf("extractLeaseID(%q) = %q, want %q", tt.path, got, tt.wantID)
+			}
+		})
+	}
+
+	if _, err := ParseLeasePathPatterns(" , "); !errors.Is(err, ErrInvalidLeasePath) {
+		t.Errorf("Expected ErrInvalidLeasePath for empty list, got %v", err)
+	}
+}
+
+// TestACLMiddlewareCustomLeasePaths tests that the ACL reads the lease ID from configured routes
+func TestACLMiddlewareCustomLeasePaths(t *testing.T) {
+	config := NewACLConfig()
+	patterns, err := ParseLeasePathPatterns("/v2/relay/{lease_id}")
+	if err != nil {
+		t.Fatalf("ParseLeasePathPatterns failed: %v", err)
+	}
+	config.LeasePaths = patterns
+
+	if err := config.AddRule(&ACLRule{LeaseID: "lease-001", AllowedKeyIDs: []string{"key1"}}); err != nil {
+		t.Fatalf("AddRule failed: %v", err)
+	}
+
+	var gotLeaseID string
+	handler := NewACLMiddleware(config).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLeaseID = GetLeaseID(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for path, wantStatus := range map[string]int{
+		"/v2/relay/lease-001/chat": http.StatusOK,
+		"/peer/lease-001":          http.StatusBadRequest,
+	} {
+		gotLeaseID = ""
+		req := httptest.NewRequest("GET", path, nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "key1"}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != wantStatus {
+			t.Errorf("%s: expected status %d, got %d", path, wantStatus, rr.Code)
+		}
+		if wantStatus == http.StatusOK && gotLeaseID != "lease-001" {
+			t.Errorf("%s: expected lease ID lease-001 in context, got %q", path, gotLeaseID)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+)
+
+// ScopeUnlimited is the default scope that exempts a key from quota and rate limits
+const ScopeUnlimited = "unlimited"
+
+// LimitBypass exempts listed API keys from quota and rate-limit enforcement
+// Exempt keys are still authenticated and access-checked; every bypass is logged so its use
+// can be audited
+type LimitBypass struct {
+	keyIDs map[string]bool
+	scope  string
+	logger *logging.Logger
+}
+
+// NewLimitBypass creates a bypass for the given key IDs and for keys holding scope
+// An empty scope exempts only the listed keys
+func NewLimitBypass(keyIDs []string, scope string) *LimitBypass {
+	b := &LimitBypass{
+		keyIDs: make(map[string]bool, len(keyIDs)),
+		scope:  scope,
+	}
+	for _, keyID := range keyIDs {
+		if keyID != "" {
+			b.keyIDs[keyID] = true
+		}
+	}
+	return b
+}
+
+// SetLogger sets where bypasses are logged (nil uses logging.Default())
+// Must be called before the bypass is used
+func (b *LimitBypass) SetLogger(logger *logging.Logger) {
+	b.logger = logger
+}
+
+// Exempt reports whether an authenticated key skips limit enforcement
+func (b *LimitBypass) Exempt(apiKeyInfo *APIKeyInfo) bool {
+	if b == nil || apiKeyInfo == nil {
+		return false
+	}
+	if b.keyIDs[apiKeyInfo.KeyID] {
+		return true
+	}
+	return b.scope != "" && apiKeyInfo.HasScope(b.scope)
+}
+
+// Bypasses reports whether a request skips the named limit, logging it if so
+func (b *LimitBypass) Bypasses(r *http.Request, limit string) bool {
+	apiKeyInfo := GetAPIKeyInfo(r.Context())
+	if !b.Exempt(apiKeyInfo) {
+		return false
+	}
+
+	logger := b.logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+	logger.WithContext(r.Context()).Info("Limit bypassed for exempt API key",
+		slog.String("key_id", apiKeyInfo.KeyID),
+		slog.String("limit", limit),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+	)
+	return true
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+)
+
+func TestLimitBypassExempt(t *testing.T) {
+	bypass := NewLimitBypass([]string{"monitoring", ""}, ScopeUnlimited)
+
+	tests := []struct {
+		name     string
+		info     *APIKeyInfo
+		expected bool
+	}{
+		{"listed key", &APIKeyInfo{KeyID: "monitoring"}, true},
+		{"unlimited scope", &APIKeyInfo{KeyID: "automation", Scopes: []string{"read", ScopeUnlimited}}, true},
+		{"regular key", &APIKeyInfo{KeyID: "tenant", Scopes: []string{"read"}}, false},
+		{"empty key ID", &APIKeyInfo{}, false},
+		{"unauthenticated", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bypass.Exempt(tt.info); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// Without a scope only listed keys are exempt
+	keysOnly := NewLimitBypass([]string{"monitoring"}, "")
+	if keysOnly.Exempt(&APIKeyInfo{KeyID: "automation", Scopes: []string{ScopeUnlimited}}) {
+		t.Error("Expected the scope to be ignored when none is configured")
+	}
+
+	var unconfigured *LimitBypass
+	if unconfigured.Exempt(&APIKeyInfo{KeyID: "monitoring"}) {
+		t.Error("Expected a nil bypass to exempt nothing")
+	}
+}
+
+func TestRateLimitMiddlewareBypass(t *testing.T) {
+	config := NewRateLimitConfig(10, 10)
+	config.PerKeyRequestsPerSecond = 1
+	config.PerKeyBurstSize = 1
+
+	buf := &bytes.Buffer{}
+	bypass := NewLimitBypass([]string{"monitoring"}, "")
+	bypass.SetLogger(logging.NewLogger(&logging.Config{Level: slog.LevelInfo, Format: logging.FormatJSON, Output: buf}))
+	config.LimitBypass = bypass
+
+	middleware := NewRateLimitMiddleware(config)
+	defer middleware.Stop()
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(keyID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: keyID}))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < 5; i++ {
+		if rr := request("monitoring"); rr.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected exempt key to pass, got %d", i+1, rr.Code)
+		}
+	}
+
+	// Exempt requests do not create or drain limiters
+	if active, _ := config.GetStats(); active != 0 {
+		t.Errorf("Expected no limiters for the exempt key, got %d", active)
+	}
+
+	request("tenant")
+	if rr := request("tenant"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected other keys to stay limited, got %d", rr.Code)
+	}
+
+	// Every bypass is logged
+	if count := strings.Count(buf.String(), `"key_id":"monitoring"`); count != 5 {
+		t.Errorf("Expected 5 bypass log entries, got %d: %s", count, buf.String())
+	}
+	if !strings.Contains(buf.String(), `"limit":"rate_limit"`) {
+		t.Errorf("Expected the bypassed limit to be logged, got %s", buf.String())
+	}
+}
@@ -0,0 +1,257 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// Replay protection headers
+const (
+	HeaderNonce     = "X-Nonce"
+	HeaderTimestamp = "X-Timestamp" // Unix seconds
+)
+
+// NonceMetrics holds replay protection metrics
+type NonceMetrics struct {
+	RejectedTotal *prometheus.CounterVec
+	CacheSize     prometheus.Gauge
+}
+
+// NewNonceMetrics creates new replay protection metrics using the default registry
+func NewNonceMetrics() *NonceMetrics {
+	return NewNonceMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewNonceMetricsWithRegistry creates new replay protection metrics with a custom registry
+func NewNonceMetricsWithRegistry(reg prometheus.Registerer) *NonceMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &NonceMetrics{
+		RejectedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_nonce_rejected_total",
+				Help: "Total number of requests rejected by replay protection",
+			},
+			[]string{"reason"}, // reason: "missing_nonce", "invalid_timestamp", "stale_timestamp", "replayed"
+		),
+		CacheSize: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_nonce_cache_size",
+				Help: "Current number of nonces remembered for replay protection",
+			},
+		),
+	}
+}
+
+// NonceConfig holds replay protection configuration
+// A request's timestamp must be within Window of the server clock, and its nonce
+// is remembered until the timestamp ages out of the window, after which a replay
+// fails the timestamp check instead
+type NonceConfig struct {
+	Window          time.Duration // Allowed clock skew in either direction
+	MaxNonceLength  int
+	CleanupInterval time.Duration
+	Metrics         *NonceMetrics
+
+	mu     sync.Mutex
+	nonces map[string]time.Time // scoped nonce -> time it can be forgotten
+}
+
+// Common errors
+var (
+	ErrMissingNonce     = errors.New("missing or invalid nonce")
+	ErrInvalidTimestamp = errors.New("missing or invalid timestamp")
+	ErrStaleTimestamp   = errors.New("timestamp outside allowed window")
+	ErrNonceReused      = errors.New("nonce already used")
+)
+
+// NewNonceConfig creates a new replay protection configuration
+func NewNonceConfig(window time.Duration) *NonceConfig {
+	if window <= 0 {
+		window = 5 * time.Minute // Default: 5 minutes of skew
+	}
+
+	return &NonceConfig{
+		Window:          window,
+		MaxNonceLength:  128,
+		CleanupInterval: time.Minute,
+		nonces:          make(map[string]time.Time),
+	}
+}
+
+// Check validates a request's timestamp and records its nonce within a scope
+// (normally the API key ID), returning an error if either fails
+func (c *NonceConfig) Check(scope, nonce, timestamp string, now time.Time) error {
+	if nonce == "" || len(nonce) > c.MaxNonceLength {
+		return ErrMissingNonce
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	ts := time.Unix(seconds, 0)
+	if ts.Before(now.Add(-c.Window)) || ts.After(now.Add(c.Window)) {
+		return ErrStaleTimestamp
+	}
+
+	key := scope + ":" + nonce
+	forgetAt := ts.Add(c.Window)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if expiresAt, exists := c.nonces[key]; exists && now.Before(expiresAt) {
+		return ErrNonceReused
+	}
+
+	c.nonces[key] = forgetAt
+	return nil
+}
+
+// CleanupExpired forgets nonces whose timestamps have aged out of the window
+func (c *NonceConfig) CleanupExpired(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key, expiresAt := range c.nonces {
+		if !now.Before(expiresAt) {
+			delete(c.nonces, key)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Len returns the number of remembered nonces
+func (c *NonceConfig) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.nonces)
+}
+
+// NonceMiddleware rejects requests that reuse a nonce or carry a stale timestamp
+type NonceMiddleware struct {
+	config  *NonceConfig
+	stopCh  chan struct{}
+	stopMu  sync.Mutex
+	stopped bool
+}
+
+// NewNonceMiddleware creates a new replay protection middleware
+func NewNonceMiddleware(config *NonceConfig) *NonceMiddleware {
+	if config == nil {
+		config = NewNonceConfig(0)
+	}
+
+	if config.Window <= 0 {
+		config.Window = 5 * time.Minute
+	}
+
+	if config.MaxNonceLength <= 0 {
+		config.MaxNonceLength = 128
+	}
+
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = time.Minute
+	}
+
+	if config.nonces == nil {
+		config.nonces = make(map[string]time.Time)
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewNonceMetrics()
+	}
+
+	m := &NonceMiddleware{
+		config: config,
+		stopCh: make(chan struct{}),
+	}
+
+	// Start cleanup goroutine
+	go m.cleanupLoop()
+
+	return m
+}
+
+// cleanupLoop periodically forgets aged-out nonces
+func (m *NonceMiddleware) cleanupLoop() {
+	ticker := time.NewTicker(m.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.config.CleanupExpired(time.Now())
+			m.config.Metrics.CacheSize.Set(float64(m.config.Len()))
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops the cleanup goroutine
+func (m *NonceMiddleware) Stop() {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+
+	if !m.stopped {
+		close(m.stopCh)
+		m.stopped = true
+	}
+}
+
+// Middleware returns an http.Handler that enforces nonce and timestamp checks
+// Nonces are scoped per API key, so it must run after AuthMiddleware
+func (m *NonceMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := ""
+		if apiKeyInfo := GetAPIKeyInfo(r.Context()); apiKeyInfo != nil {
+			scope = apiKeyInfo.KeyID
+		}
+
+		err := m.config.Check(scope, r.Header.Get(HeaderNonce), r.Header.Get(HeaderTimestamp), time.Now())
+		if err != nil {
+			m.handleNonceError(w, r, err)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleNonceError writes an appropriate error response
+func (m *NonceMiddleware) handleNonceError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrMissingNonce):
+		m.config.Metrics.RejectedTotal.WithLabelValues("missing_nonce").Inc()
+		problem.Write(w, r, http.StatusBadRequest, "missing_nonce", fmt.Sprintf("%s header is required (max %d characters)", HeaderNonce, m.config.MaxNonceLength))
+	case errors.Is(err, ErrInvalidTimestamp):
+		m.config.Metrics.RejectedTotal.WithLabelValues("invalid_timestamp").Inc()
+		problem.Write(w, r, http.StatusBadRequest, "invalid_timestamp", fmt.Sprintf("%s header must be Unix seconds", HeaderTimestamp))
+	case errors.Is(err, ErrStaleTimestamp):
+		m.config.Metrics.RejectedTotal.WithLabelValues("stale_timestamp").Inc()
+		problem.Write(w, r, http.StatusUnauthorized, "stale_timestamp", fmt.Sprintf("Request timestamp is outside the allowed window of %s", m.config.Window))
+	default:
+		m.config.Metrics.RejectedTotal.WithLabelValues("replayed").Inc()
+		problem.Write(w, r, http.StatusConflict, "nonce_reused", "Request nonce has already been used")
+	}
+}
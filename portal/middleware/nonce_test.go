@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestNonceConfig creates a replay protection config with a fresh metrics registry
+func newTestNonceConfig(window time.Duration) *NonceConfig {
+	config := NewNonceConfig(window)
+	config.Metrics = NewNonceMetricsWithRegistry(prometheus.NewRegistry())
+	return config
+}
+
+// TestNonceCheck tests timestamp and nonce validation
+func TestNonceCheck(t *testing.T) {
+	config := newTestNonceConfig(time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name      string
+		scope     string
+		nonce     string
+		timestamp string
+		wantErr   error
+	}{
+		{"first use", "key1", "abc", ts, nil},
+		{"replayed", "key1", "abc", ts, ErrNonceReused},
+		{"other scope", "key2", "abc", ts, nil},
+		{"missing nonce", "key1", "", ts, ErrMissingNonce},
+		{"missing timestamp", "key1", "def", "", ErrInvalidTimestamp},
+		{"too old", "key1", "def", strconv.FormatInt(now.Add(-2*time.Minute).Unix(), 10), ErrStaleTimestamp},
+		{"too far ahead", "key1", "def", strconv.FormatInt(now.Add(2*time.Minute).Unix(), 10), ErrStaleTimestamp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := config.Check(tt.scope, tt.nonce, tt.timestamp, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestNonceCleanupExpired tests that nonces are forgotten once their timestamp ages out
+func TestNonceCleanupExpired(t *testing.T) {
+	config := newTestNonceConfig(time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+
+	if err := config.Check("key1", "old", strconv.FormatInt(now.Add(-30*time.Second).Unix(), 10), now); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if err := config.Check("key1", "new", strconv.FormatInt(now.Unix(), 10), now); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	if removed := config.CleanupExpired(now.Add(45 * time.Second)); removed != 1 {
+		t.Errorf("Expected 1 nonce removed, got %d", removed)
+	}
+	if config.Len() != 1 {
+		t.Errorf("Expected 1 nonce remaining, got %d", config.Len())
+	}
+}
+
+// TestNonceMiddleware tests replay rejection through the middleware
+func TestNonceMiddleware(t *testing.T) {
+	config := newTestNonceConfig(time.Minute)
+	m := NewNonceMiddleware(config)
+	defer m.Stop()
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	newRequest := func(nonce string, ts time.Time) *http.Request {
+		req := httptest.NewRequest("POST", "/peer/test", nil)
+		req.Header.Set(HeaderNonce, nonce)
+		req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts.Unix(), 10))
+		info := &APIKeyInfo{KeyID: "key1"}
+		return req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, info))
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{"fresh request", newRequest("n1", time.Now()), http.StatusOK},
+		{"replayed request", newRequest("n1", time.Now()), http.StatusConflict},
+		{"stale request", newRequest("n2", time.Now().Add(-time.Hour)), http.StatusUnauthorized},
+		{"missing nonce", newRequest("", time.Now()), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, tt.req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.wantStatus, rec.Code)
+		}
+	}
+}
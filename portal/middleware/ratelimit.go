@@ -1,12 +1,16 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/problem"
 )
 
 // RateLimiter implements token bucket rate limiting
@@ -16,6 +20,39 @@ type RateLimiter struct {
 	tokens     float64       // Current token count
 	lastUpdate time.Time     // Last token refill time
 	mu         sync.Mutex
+
+	warmUp    WarmUp
+	createdAt time.Time
+	clock     clock.Clock
+}
+
+// WarmUp limits the bucket of a newly created limiter, so a new key cannot spend a full burst
+// right away. The zero value disables warm-up and new limiters start with a full bucket
+type WarmUp struct {
+	// InitialFraction is the share of the burst a new limiter starts with (0-1)
+	InitialFraction float64
+
+	// Duration is how long the bucket's capacity takes to ramp from InitialFraction to the
+	// full burst (0 = only the initial tokens are reduced)
+	Duration time.Duration
+}
+
+// Modes of KeyIPLimit
+const (
+	KeyIPModeKeyOnly = "key"  // Requests with an API key are limited per key only
+	KeyIPModeBoth    = "both" // Requests with an API key are limited per key and per IP; the most restrictive wins
+)
+
+// KeyIPLimit selects whether requests with an API key are also limited per client IP,
+// so a client cannot get around the IP limit by rotating keys
+type KeyIPLimit struct {
+	// Mode is KeyIPModeKeyOnly (the default) or KeyIPModeBoth
+	Mode string
+
+	// Per-IP limit for requests with an API key (0 = PerIPRequestsPerSecond and PerIPBurstSize)
+	// It is counted apart from keyless requests from the same IP
+	RequestsPerSecond float64
+	BurstSize         int
 }
 
 // RateLimitConfig holds rate limiting configuration
@@ -32,6 +69,29 @@ type RateLimitConfig struct {
 	PerIPRequestsPerSecond float64
 	PerIPBurstSize         int
 
+	// WarmUp applies to every limiter created after it is set
+	WarmUp WarmUp
+
+	// KeyIP selects whether requests with an API key are also limited per IP
+	KeyIP KeyIPLimit
+
+	// MaxWait is how long a request waits for a token before being rejected (0 = reject immediately)
+	MaxWait time.Duration
+
+	// Clock drives limiters created after it is set and the limiter cache (nil = clock.Real)
+	// Tests set a clock.Fake to refill buckets without sleeping
+	Clock clock.Clock
+
+	// Rejections is told about requests the limit turns away, e.g. saturation.Tracker (nil = none)
+	Rejections RejectionRecorder
+
+	// LimitBypass selects API keys that are not rate limited (nil = none)
+	LimitBypass *LimitBypass
+
+	// ClientIPResolver determines the client IP of keyless requests
+	// (nil = DefaultClientIPHeaders from any peer)
+	ClientIPResolver *ClientIPResolver
+
 	// Limiter cache settings
 	LimiterTTL      time.Duration // How long to keep inactive limiters
 	CleanupInterval time.Duration // How often to clean up expired limiters
@@ -41,12 +101,30 @@ type RateLimitConfig struct {
 	lastUsed map[string]time.Time    // key -> last use time
 }
 
+// LimiterState is a snapshot of one rate limiter's bucket
+type LimiterState struct {
+	Key      string
+	Rate     float64   // Tokens added per second
+	Burst    int       // Bucket size once any warm-up is over
+	Tokens   float64   // Tokens available now
+	ResetAt  time.Time // When the next token is available (now if one already is)
+	LastUsed time.Time
+}
+
 // RateLimitMiddleware provides rate limiting
 type RateLimitMiddleware struct {
-	config  *RateLimitConfig
-	stopCh  chan struct{}
-	stopMu  sync.Mutex
-	stopped bool
+	config    *RateLimitConfig
+	rejection RejectionRecorder
+	bypass    *LimitBypass
+	clientIP  *ClientIPResolver
+	stopCh    chan struct{}
+	stopMu    sync.Mutex
+	stopped   bool
+}
+
+// RejectionRecorder is told about requests a limiting layer turns away, e.g. saturation.Tracker
+type RejectionRecorder interface {
+	RecordRejection(reason string)
 }
 
 // Common errors
@@ -57,6 +135,16 @@ var (
 
 // NewRateLimiter creates a new token bucket rate limiter
 func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	return NewRateLimiterWithWarmUp(rate, burst, WarmUp{})
+}
+
+// NewRateLimiterWithWarmUp creates a token bucket rate limiter that ramps up to its burst
+func NewRateLimiterWithWarmUp(rate float64, burst int, warmUp WarmUp) *RateLimiter {
+	return newRateLimiter(rate, burst, warmUp, clock.Real)
+}
+
+// newRateLimiter creates a token bucket rate limiter running on clk
+func newRateLimiter(rate float64, burst int, warmUp WarmUp, clk clock.Clock) *RateLimiter {
 	if rate <= 0 {
 		rate = 10 // Default: 10 requests per second
 	}
@@ -64,27 +152,62 @@ func NewRateLimiter(rate float64, burst int) *RateLimiter {
 		burst = int(rate * 2) // Default: 2x the rate
 	}
 
+	// The zero value means no warm-up
+	if warmUp.InitialFraction <= 0 && warmUp.Duration <= 0 {
+		warmUp.InitialFraction = 1
+	}
+	if warmUp.InitialFraction < 0 {
+		warmUp.InitialFraction = 0
+	}
+	if warmUp.InitialFraction > 1 {
+		warmUp.InitialFraction = 1
+	}
+	if warmUp.Duration < 0 {
+		warmUp.Duration = 0
+	}
+
+	now := clk.Now()
 	return &RateLimiter{
 		rate:       rate,
 		burst:      burst,
-		tokens:     float64(burst), // Start with full bucket
-		lastUpdate: time.Now(),
+		tokens:     float64(burst) * warmUp.InitialFraction, // Full bucket unless warming up
+		lastUpdate: now,
+		warmUp:     warmUp,
+		createdAt:  now,
+		clock:      clk,
 	}
 }
 
+// capacity returns how many tokens the bucket can hold at now
+// It grows linearly from the warm-up's initial fraction to the full burst
+func (rl *RateLimiter) capacity(now time.Time) float64 {
+	burst := float64(rl.burst)
+	if rl.warmUp.Duration == 0 {
+		return burst
+	}
+
+	progress := float64(now.Sub(rl.createdAt)) / float64(rl.warmUp.Duration)
+	if progress >= 1 {
+		return burst
+	}
+
+	fraction := rl.warmUp.InitialFraction
+	return burst * (fraction + (1-fraction)*progress)
+}
+
 // Allow checks if a request is allowed under the rate limit
 // Returns true if allowed, false if rate limit exceeded
 func (rl *RateLimiter) Allow() bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	now := time.Now()
+	now := rl.clock.Now()
 	elapsed := now.Sub(rl.lastUpdate).Seconds()
 
 	// Refill tokens based on elapsed time
 	rl.tokens += elapsed * rl.rate
-	if rl.tokens > float64(rl.burst) {
-		rl.tokens = float64(rl.burst)
+	if capacity := rl.capacity(now); rl.tokens > capacity {
+		rl.tokens = capacity
 	}
 
 	rl.lastUpdate = now
@@ -103,13 +226,13 @@ func (rl *RateLimiter) Remaining() int {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
-	now := time.Now()
+	now := rl.clock.Now()
 	elapsed := now.Sub(rl.lastUpdate).Seconds()
 
 	// Calculate current tokens
 	tokens := rl.tokens + elapsed*rl.rate
-	if tokens > float64(rl.burst) {
-		tokens = float64(rl.burst)
+	if capacity := rl.capacity(now); tokens > capacity {
+		tokens = capacity
 	}
 
 	return int(tokens)
@@ -121,14 +244,81 @@ func (rl *RateLimiter) Reset() time.Time {
 	defer rl.mu.Unlock()
 
 	if rl.tokens >= 1.0 {
-		return time.Now()
+		return rl.clock.Now()
 	}
 
 	// Calculate when we'll have 1 token
 	tokensNeeded := 1.0 - rl.tokens
 	secondsNeeded := tokensNeeded / rl.rate
 
-	return time.Now().Add(time.Duration(secondsNeeded * float64(time.Second)))
+	return rl.clock.Now().Add(time.Duration(secondsNeeded * float64(time.Second)))
+}
+
+// snapshot returns the bucket's tokens and when the next one is available, refilled to now
+func (rl *RateLimiter) snapshot() (tokens float64, resetAt time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.clock.Now()
+	tokens = rl.tokens + now.Sub(rl.lastUpdate).Seconds()*rl.rate
+	if capacity := rl.capacity(now); tokens > capacity {
+		tokens = capacity
+	}
+
+	if tokens >= 1.0 {
+		return tokens, now
+	}
+	return tokens, now.Add(time.Duration((1.0 - tokens) / rl.rate * float64(time.Second)))
+}
+
+// fill refills the bucket to its full burst and ends any warm-up
+func (rl *RateLimiter) fill() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.warmUp = WarmUp{InitialFraction: 1}
+	rl.tokens = float64(rl.burst)
+	rl.lastUpdate = rl.clock.Now()
+}
+
+// refund returns a token taken by Allow or Wait, e.g. when another limiter rejected the request
+func (rl *RateLimiter) refund() {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.tokens++
+	if capacity := rl.capacity(rl.lastUpdate); rl.tokens > capacity {
+		rl.tokens = capacity
+	}
+}
+
+// Wait blocks until a token is available and takes it
+// Returns ErrRateLimitExceeded if no token will be available within maxWait or before
+// the context deadline, or the context error if the context is done while waiting
+func (rl *RateLimiter) Wait(ctx context.Context, maxWait time.Duration) error {
+	deadline := rl.clock.Now().Add(maxWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	for {
+		if rl.Allow() {
+			return nil
+		}
+
+		// Allow just refilled the bucket, so Reset is current
+		reset := rl.Reset()
+		if reset.After(deadline) {
+			return ErrRateLimitExceeded
+		}
+
+		// Another waiter may take the token first, so re-check after waking
+		select {
+		case <-rl.clock.After(reset.Sub(rl.clock.Now())):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
 // NewRateLimitConfig creates a new rate limit configuration
@@ -162,7 +352,7 @@ func (c *RateLimitConfig) GetLimiter(key string, rate float64, burst int) *RateL
 	defer c.mu.Unlock()
 
 	// Update last used time
-	c.lastUsed[key] = time.Now()
+	c.lastUsed[key] = clock.Or(c.Clock).Now()
 
 	// Return existing limiter if present
 	if limiter, exists := c.limiters[key]; exists {
@@ -170,7 +360,7 @@ func (c *RateLimitConfig) GetLimiter(key string, rate float64, burst int) *RateL
 	}
 
 	// Create new limiter
-	limiter := NewRateLimiter(rate, burst)
+	limiter := newRateLimiter(rate, burst, c.WarmUp, clock.Or(c.Clock))
 	c.limiters[key] = limiter
 
 	return limiter
@@ -181,7 +371,7 @@ func (c *RateLimitConfig) CleanupExpiredLimiters() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	now := time.Now()
+	now := clock.Or(c.Clock).Now()
 	for key, lastUsed := range c.lastUsed {
 		if now.Sub(lastUsed) > c.LimiterTTL {
 			delete(c.limiters, key)
@@ -190,6 +380,46 @@ func (c *RateLimitConfig) CleanupExpiredLimiters() {
 	}
 }
 
+// GetLimiterState returns the state of the limiter for a key, e.g. "key:<key ID>",
+// "ip:<client IP>" or "lease:<lease ID>:key:<key ID>"
+// Returns false if no limiter exists for the key, because it was never used or expired
+func (c *RateLimitConfig) GetLimiterState(key string) (*LimiterState, bool) {
+	c.mu.RLock()
+	limiter, exists := c.limiters[key]
+	lastUsed := c.lastUsed[key]
+	c.mu.RUnlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	tokens, resetAt := limiter.snapshot()
+	return &LimiterState{
+		Key:      key,
+		Rate:     limiter.rate,
+		Burst:    limiter.burst,
+		Tokens:   tokens,
+		ResetAt:  resetAt,
+		LastUsed: lastUsed,
+	}, true
+}
+
+// ResetLimiter refills the bucket of the limiter for a key, so a throttled client is let
+// through at once, e.g. after fixing a misconfigured limit
+// Returns false if no limiter exists for the key
+func (c *RateLimitConfig) ResetLimiter(key string) bool {
+	c.mu.RLock()
+	limiter, exists := c.limiters[key]
+	c.mu.RUnlock()
+
+	if !exists {
+		return false
+	}
+
+	limiter.fill()
+	return true
+}
+
 // GetStats returns statistics about rate limiters
 func (c *RateLimitConfig) GetStats() (activeLimiters, totalKeys int) {
 	c.mu.RLock()
@@ -205,8 +435,11 @@ func NewRateLimitMiddleware(config *RateLimitConfig) *RateLimitMiddleware {
 	}
 
 	m := &RateLimitMiddleware{
-		config: config,
-		stopCh: make(chan struct{}),
+		config:    config,
+		rejection: config.Rejections,
+		bypass:    config.LimitBypass,
+		clientIP:  config.ClientIPResolver,
+		stopCh:    make(chan struct{}),
 	}
 
 	// Start cleanup goroutine
@@ -217,12 +450,12 @@ func NewRateLimitMiddleware(config *RateLimitConfig) *RateLimitMiddleware {
 
 // cleanupLoop periodically cleans up expired rate limiters
 func (m *RateLimitMiddleware) cleanupLoop() {
-	ticker := time.NewTicker(m.config.CleanupInterval)
+	ticker := clock.Or(m.config.Clock).NewTicker(m.config.CleanupInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			m.config.CleanupExpiredLimiters()
 		case <-m.stopCh:
 			return
@@ -249,6 +482,12 @@ func (m *RateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 		var rate float64
 		var burst int
 
+		// Exempt keys are neither limited nor counted
+		if m.bypass.Bypasses(r, "rate_limit") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Try to get API key info from context
 		apiKeyInfo := GetAPIKeyInfo(r.Context())
 		if apiKeyInfo != nil {
@@ -257,12 +496,7 @@ func (m *RateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 			burst = m.config.PerKeyBurstSize
 		} else {
 			// Fallback to IP-based rate limiting
-			clientIP := getClientIP(r)
-			if clientIP != nil {
-				limiterKey = "ip:" + clientIP.String()
-			} else {
-				limiterKey = "ip:unknown"
-			}
+			limiterKey = "ip:" + m.clientIPKey(r)
 			rate = m.config.PerIPRequestsPerSecond
 			burst = m.config.PerIPBurstSize
 		}
@@ -271,11 +505,28 @@ func (m *RateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 		limiter := m.config.GetLimiter(limiterKey, rate, burst)
 
 		// Check if request is allowed
-		if !limiter.Allow() {
-			m.handleRateLimitExceeded(w, limiter, burst)
+		if !allowOrWait(r, limiter, m.config.MaxWait) {
+			m.handleRateLimitExceeded(w, r, limiter, burst)
 			return
 		}
 
+		// An authenticated request must also pass its IP's limiter
+		if apiKeyInfo != nil && m.config.KeyIP.Mode == KeyIPModeBoth {
+			ipRate, ipBurst := m.config.keyIPLimit()
+			ipLimiter := m.config.GetLimiter("keyip:"+m.clientIPKey(r), ipRate, ipBurst)
+			if !allowOrWait(r, ipLimiter, m.config.MaxWait) {
+				// The key is not charged for a request it did not get
+				limiter.refund()
+				m.handleRateLimitExceeded(w, r, ipLimiter, ipBurst)
+				return
+			}
+
+			// Report the limit closest to running out
+			if ipLimiter.Remaining() < limiter.Remaining() {
+				limiter, burst = ipLimiter, ipBurst
+			}
+		}
+
 		// Add rate limit headers
 		m.addRateLimitHeaders(w, limiter, burst)
 
@@ -284,6 +535,35 @@ func (m *RateLimitMiddleware) Middleware(next http.Handler) http.Handler {
 	})
 }
 
+// clientIPKey returns the client IP a request's IP limiter is keyed by
+func (m *RateLimitMiddleware) clientIPKey(r *http.Request) string {
+	if clientIP := m.clientIP.ClientIP(r); clientIP != nil {
+		return clientIP.String()
+	}
+	return "unknown"
+}
+
+// keyIPLimit returns the per-IP rate and burst for requests with an API key
+func (c *RateLimitConfig) keyIPLimit() (float64, int) {
+	rate, burst := c.KeyIP.RequestsPerSecond, c.KeyIP.BurstSize
+	if rate <= 0 {
+		rate = c.PerIPRequestsPerSecond
+	}
+	if burst <= 0 {
+		burst = c.PerIPBurstSize
+	}
+	return rate, burst
+}
+
+// allowOrWait checks the limiter, waiting up to maxWait for a token when wait mode is enabled
+func allowOrWait(r *http.Request, limiter *RateLimiter, maxWait time.Duration) bool {
+	if maxWait <= 0 {
+		return limiter.Allow()
+	}
+
+	return limiter.Wait(r.Context(), maxWait) == nil
+}
+
 // addRateLimitHeaders adds rate limit headers to the response
 func (m *RateLimitMiddleware) addRateLimitHeaders(w http.ResponseWriter, limiter *RateLimiter, limit int) {
 	remaining := limiter.Remaining()
@@ -299,9 +579,13 @@ func (m *RateLimitMiddleware) addRateLimitHeaders(w http.ResponseWriter, limiter
 }
 
 // handleRateLimitExceeded handles rate limit exceeded responses
-func (m *RateLimitMiddleware) handleRateLimitExceeded(w http.ResponseWriter, limiter *RateLimiter, limit int) {
+func (m *RateLimitMiddleware) handleRateLimitExceeded(w http.ResponseWriter, r *http.Request, limiter *RateLimiter, limit int) {
+	if m.rejection != nil {
+		m.rejection.RecordRejection("rate_limit")
+	}
+
 	reset := limiter.Reset()
-	retryAfter := int(time.Until(reset).Seconds()) + 1
+	retryAfter := int(reset.Sub(clock.Or(m.config.Clock).Now()).Seconds()) + 1
 	if retryAfter < 0 {
 		retryAfter = 1
 	}
@@ -311,8 +595,6 @@ func (m *RateLimitMiddleware) handleRateLimitExceeded(w http.ResponseWriter, lim
 	w.Header().Set("X-RateLimit-Remaining", "0")
 	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
 	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
-	w.Header().Set("Content-Type", "application/json")
 
-	w.WriteHeader(http.StatusTooManyRequests)
-	fmt.Fprintf(w, `{"error":"rate_limit_exceeded","message":"Rate limit exceeded. Retry after %d seconds.","retry_after":%d}`, retryAfter, retryAfter)
+	problem.WriteWithFields(w, r, http.StatusTooManyRequests, "rate_limit_exceeded", fmt.Sprintf("Rate limit exceeded. Retry after %d seconds.", retryAfter), map[string]any{"retry_after": retryAfter})
 }
@@ -9,8 +9,15 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
 )
 
+// newFakeClock returns a fake clock for tests that advance time instead of sleeping
+func newFakeClock() *clock.Fake {
+	return clock.NewFake(time.Unix(1700000000, 0))
+}
+
 // TestNewRateLimiter tests creating a new rate limiter
 func TestNewRateLimiter(t *testing.T) {
 	limiter := NewRateLimiter(10.0, 20)
@@ -44,7 +51,8 @@ func TestNewRateLimiterDefaults(t *testing.T) {
 // TestRateLimiterAllow tests the Allow method
 func TestRateLimiterAllow(t *testing.T) {
 	// Create limiter with 10 req/s, burst of 10
-	limiter := NewRateLimiter(10.0, 10)
+	fake := newFakeClock()
+	limiter := newRateLimiter(10.0, 10, WarmUp{}, fake)
 
 	// Should allow first 10 requests (burst)
 	for i := 0; i < 10; i++ {
@@ -58,10 +66,9 @@ func TestRateLimiterAllow(t *testing.T) {
 		t.Error("Request 11 should be denied (burst exhausted)")
 	}
 
-	// Wait for tokens to refill
-	time.Sleep(200 * time.Millisecond) // Should refill ~2 tokens at 10/s
+	// Refill 2 tokens at 10/s
+	fake.Advance(200 * time.Millisecond)
 
-	// Should allow 1-2 more requests
 	allowed := 0
 	for i := 0; i < 3; i++ {
 		if limiter.Allow() {
@@ -69,8 +76,8 @@ func TestRateLimiterAllow(t *testing.T) {
 		}
 	}
 
-	if allowed < 1 {
-		t.Error("At least 1 request should be allowed after token refill")
+	if allowed != 2 {
+		t.Errorf("Expected 2 requests to be allowed after token refill, got %d", allowed)
 	}
 }
 
@@ -167,13 +174,15 @@ func TestGetLimiter(t *testing.T) {
 func TestCleanupExpiredLimiters(t *testing.T) {
 	config := NewRateLimitConfig(100, 200)
 	config.LimiterTTL = 100 * time.Millisecond
+	fake := newFakeClock()
+	config.Clock = fake
 
 	// Create some limiters
 	config.GetLimiter("key1", 10, 20)
 	config.GetLimiter("key2", 10, 20)
 
-	// Wait for TTL to expire
-	time.Sleep(150 * time.Millisecond)
+	// Let the TTL expire
+	fake.Advance(150 * time.Millisecond)
 
 	// Create one more recent limiter
 	config.GetLimiter("key3", 10, 20)
@@ -220,6 +229,8 @@ func TestRateLimitMiddleware(t *testing.T) {
 	config := NewRateLimitConfig(10, 10)
 	config.PerKeyRequestsPerSecond = 5
 	config.PerKeyBurstSize = 5
+	rejections := &rejectionRecorder{}
+	config.Rejections = rejections
 
 	middleware := NewRateLimitMiddleware(config)
 	defer middleware.Stop()
@@ -279,6 +290,28 @@ func TestRateLimitMiddleware(t *testing.T) {
 	if !strings.Contains(rr.Body.String(), "rate_limit_exceeded") {
 		t.Error("Response should contain rate_limit_exceeded error")
 	}
+
+	if got := rejections.list(); strings.Join(got, ",") != "rate_limit" {
+		t.Errorf("Expected one rate_limit rejection reported, got %v", got)
+	}
+}
+
+// rejectionRecorder collects rejections reported by a limiting middleware
+type rejectionRecorder struct {
+	mu      sync.Mutex
+	reasons []string
+}
+
+func (r *rejectionRecorder) RecordRejection(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reasons = append(r.reasons, reason)
+}
+
+func (r *rejectionRecorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.reasons...)
 }
 
 // TestRateLimitMiddlewareIPFallback tests IP-based rate limiting
@@ -432,7 +465,8 @@ func TestRateLimitMiddlewareStop(t *testing.T) {
 
 // TestTokenRefill tests that tokens refill over time
 func TestTokenRefill(t *testing.T) {
-	limiter := NewRateLimiter(10.0, 5)
+	fake := newFakeClock()
+	limiter := newRateLimiter(10.0, 5, WarmUp{}, fake)
 
 	// Exhaust all tokens
 	for i := 0; i < 5; i++ {
@@ -446,11 +480,273 @@ func TestTokenRefill(t *testing.T) {
 		t.Error("Request should be denied when tokens exhausted")
 	}
 
-	// Wait for token refill (100ms = 1 token at 10/s)
-	time.Sleep(150 * time.Millisecond)
+	// 100ms = 1 token at 10/s
+	fake.Advance(100 * time.Millisecond)
 
 	// Should allow 1 request now
 	if !limiter.Allow() {
 		t.Error("Request should be allowed after token refill")
 	}
 }
+
+// TestRateLimiterWait tests waiting for a token
+func TestRateLimiterWait(t *testing.T) {
+	// 20 req/s = one token every 50ms
+	fake := newFakeClock()
+	limiter := newRateLimiter(20, 1, WarmUp{}, fake)
+
+	if !limiter.Allow() {
+		t.Fatal("First request should be allowed")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.Wait(context.Background(), time.Second)
+	}()
+
+	fake.BlockUntil(1)
+	select {
+	case err := <-done:
+		t.Fatalf("Expected to wait for a token, returned %v", err)
+	default:
+	}
+
+	fake.Advance(50 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("Expected wait to succeed, got %v", err)
+	}
+}
+
+// TestRateLimiterWaitExceedsMaxWait tests rejection when the wait would exceed the cap
+func TestRateLimiterWaitExceedsMaxWait(t *testing.T) {
+	// 1 req/s = one token every second
+	limiter := NewRateLimiter(1, 1)
+	limiter.Allow()
+
+	start := time.Now()
+	err := limiter.Wait(context.Background(), 50*time.Millisecond)
+	if err != ErrRateLimitExceeded {
+		t.Fatalf("Expected ErrRateLimitExceeded, got %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("Expected immediate rejection, returned after %v", elapsed)
+	}
+}
+
+// TestRateLimiterWaitRespectsContext tests that waiting never outlives the request deadline
+func TestRateLimiterWaitRespectsContext(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	limiter.Allow()
+
+	// The deadline is shorter than the time to the next token
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := limiter.Wait(ctx, 5*time.Second); err != ErrRateLimitExceeded {
+		t.Errorf("Expected ErrRateLimitExceeded for deadline before reset, got %v", err)
+	}
+
+	// A cancelled context stops the wait
+	limiter = NewRateLimiter(10, 1)
+	limiter.Allow()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+
+	if err := limiter.Wait(ctx, 5*time.Second); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+// TestRateLimitMiddlewareKeyIPMode tests that rotating keys does not get around the IP limit
+// when both limits apply
+func TestRateLimitMiddlewareKeyIPMode(t *testing.T) {
+	tests := []struct {
+		mode     string
+		expected []int
+	}{
+		{KeyIPModeKeyOnly, []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+		{KeyIPModeBoth, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			config := NewRateLimitConfig(100, 200)
+			config.PerKeyRequestsPerSecond = 1
+			config.PerKeyBurstSize = 5
+			config.KeyIP = KeyIPLimit{Mode: tt.mode, RequestsPerSecond: 1, BurstSize: 2}
+			config.Clock = newFakeClock()
+
+			middleware := NewRateLimitMiddleware(config)
+			defer middleware.Stop()
+
+			handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, keyID := range []string{"key1", "key2", "key3"} {
+				req := httptest.NewRequest("GET", "/test", nil)
+				req.RemoteAddr = "192.168.1.1:12345"
+				req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: keyID}))
+				rr := httptest.NewRecorder()
+				handler.ServeHTTP(rr, req)
+
+				if rr.Code != tt.expected[i] {
+					t.Errorf("Request with %s: expected status %d, got %d", keyID, tt.expected[i], rr.Code)
+				}
+			}
+
+			if tt.mode != KeyIPModeBoth {
+				return
+			}
+
+			// The IP limit is closest to running out, so the headers report it
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.RemoteAddr = "192.168.1.2:12345"
+			req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "key4"}))
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			if limit := rr.Header().Get("X-RateLimit-Limit"); limit != "2" {
+				t.Errorf("Expected X-RateLimit-Limit 2, got %s", limit)
+			}
+
+			// The key rejected by the IP limit was not charged for the request
+			if remaining := config.GetLimiter("key:key3", 1, 5).Remaining(); remaining != 5 {
+				t.Errorf("Expected key3 to keep its full burst, got %d tokens", remaining)
+			}
+		})
+	}
+}
+
+// TestRateLimitMiddlewareWaitMode tests that requests wait instead of being rejected
+func TestRateLimitMiddlewareWaitMode(t *testing.T) {
+	config := NewRateLimitConfig(20, 1)
+	config.PerIPRequestsPerSecond = 20
+	config.PerIPBurstSize = 1
+	config.MaxWait = time.Second
+
+	middleware := NewRateLimitMiddleware(config)
+	defer middleware.Stop()
+
+	handler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.RemoteAddr = "192.168.1.1:12345"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Request %d: expected status 200 in wait mode, got %d", i+1, rr.Code)
+		}
+	}
+}
+
+// TestRateLimiterWarmUp tests that a new limiter starts with part of its burst and ramps up
+func TestRateLimiterWarmUp(t *testing.T) {
+	limiter := NewRateLimiterWithWarmUp(1, 10, WarmUp{InitialFraction: 0.2, Duration: time.Hour})
+
+	if remaining := limiter.Remaining(); remaining != 2 {
+		t.Errorf("Expected 2 initial tokens, got %d", remaining)
+	}
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow() {
+			t.Fatalf("Request %d should be allowed", i+1)
+		}
+	}
+	if limiter.Allow() {
+		t.Error("Request should be denied once the initial tokens are spent")
+	}
+
+	// Refill is capped by the ramp, not the full burst
+	fake := newFakeClock()
+	limiter = newRateLimiter(1000, 10, WarmUp{Duration: 100 * time.Millisecond}, fake)
+	if remaining := limiter.Remaining(); remaining != 0 {
+		t.Errorf("Expected an empty bucket, got %d tokens", remaining)
+	}
+
+	fake.Advance(50 * time.Millisecond)
+	if remaining := limiter.Remaining(); remaining != 5 {
+		t.Errorf("Expected half the burst mid-ramp, got %d", remaining)
+	}
+
+	fake.Advance(50 * time.Millisecond)
+	if remaining := limiter.Remaining(); remaining != 10 {
+		t.Errorf("Expected the full burst after the ramp, got %d", remaining)
+	}
+}
+
+// TestRateLimitConfigWarmUp tests that limiters created by a config use its warm-up
+func TestRateLimitConfigWarmUp(t *testing.T) {
+	config := NewRateLimitConfig(100, 200)
+
+	if remaining := config.GetLimiter("key1", 10, 20).Remaining(); remaining != 20 {
+		t.Errorf("Expected a full bucket without warm-up, got %d", remaining)
+	}
+
+	config.WarmUp = WarmUp{InitialFraction: 0.5, Duration: time.Minute}
+	if remaining := config.GetLimiter("key2", 10, 20).Remaining(); remaining != 10 {
+		t.Errorf("Expected half the burst with warm-up, got %d", remaining)
+	}
+}
+
+// TestRateLimitConfigLimiterState tests inspecting and resetting a throttled key's limiter
+func TestRateLimitConfigLimiterState(t *testing.T) {
+	fake := newFakeClock()
+	config := NewRateLimitConfig(100, 200)
+	config.Clock = fake
+	config.WarmUp = WarmUp{InitialFraction: 0.5, Duration: time.Hour}
+
+	if _, exists := config.GetLimiterState("key:key1"); exists {
+		t.Error("Expected no state for a key without a limiter")
+	}
+	if config.ResetLimiter("key:key1") {
+		t.Error("Expected resetting a key without a limiter to report false")
+	}
+
+	// Spend the 2 tokens the warm-up starts with
+	limiter := config.GetLimiter("key:key1", 2, 4)
+	for limiter.Allow() {
+	}
+
+	state, exists := config.GetLimiterState("key:key1")
+	if !exists {
+		t.Fatal("Expected state for a used key")
+	}
+	if state.Tokens >= 1 || state.Rate != 2 || state.Burst != 4 {
+		t.Errorf("Expected an empty bucket of 4 at 2/s, got %+v", state)
+	}
+	if want := fake.Now().Add(500 * time.Millisecond); !state.ResetAt.Equal(want) {
+		t.Errorf("Expected the next token at %v, got %v", want, state.ResetAt)
+	}
+	if !state.LastUsed.Equal(fake.Now()) {
+		t.Errorf("Expected last use at %v, got %v", fake.Now(), state.LastUsed)
+	}
+
+	// A reset refills the full burst, past the warm-up cap
+	if !config.ResetLimiter("key:key1") {
+		t.Fatal("Expected the limiter to be reset")
+	}
+	state, _ = config.GetLimiterState("key:key1")
+	if state.Tokens != 4 || !state.ResetAt.Equal(fake.Now()) {
+		t.Errorf("Expected a full bucket available now, got %+v", state)
+	}
+	for i := 0; i < 4; i++ {
+		if !limiter.Allow() {
+			t.Fatalf("Request %d should be allowed after a reset", i+1)
+		}
+	}
+
+	// Other keys are untouched
+	other := config.GetLimiter("key:key2", 2, 4)
+	for other.Allow() {
+	}
+	config.ResetLimiter("key:key1")
+	if other.Remaining() != 0 {
+		t.Error("Expected resetting one key not to refill another")
+	}
+}
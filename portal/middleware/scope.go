@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// ScopeMiddleware restricts a handler to API keys holding one of a set of scopes
+// It must run after AuthMiddleware, which puts the API key info in the context
+type ScopeMiddleware struct {
+	scopes []string
+}
+
+// NewScopeMiddleware creates a middleware that requires any of the given scopes
+func NewScopeMiddleware(scopes ...string) *ScopeMiddleware {
+	if len(scopes) == 0 {
+		panic("at least one scope is required")
+	}
+
+	return &ScopeMiddleware{
+		scopes: scopes,
+	}
+}
+
+// Middleware returns an http.Handler that rejects keys without a required scope
+func (m *ScopeMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKeyInfo := GetAPIKeyInfo(r.Context())
+		if apiKeyInfo == nil {
+			problem.Write(w, r, http.StatusUnauthorized, "missing_api_key", "API key is required")
+			return
+		}
+
+		for _, scope := range m.scopes {
+			if apiKeyInfo.HasScope(scope) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		problem.Write(w, r, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("API key requires scope: %s", strings.Join(m.scopes, " or ")))
+	})
+}
@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
+)
+
+// TestScopeMiddleware tests scope enforcement
+func TestScopeMiddleware(t *testing.T) {
+	m := NewScopeMiddleware("metrics", "admin")
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		info       *APIKeyInfo
+		wantStatus int
+	}{
+		{"no API key", nil, http.StatusUnauthorized},
+		{"missing scope", &APIKeyInfo{KeyID: "reader", Scopes: []string{"read"}}, http.StatusForbidden},
+		{"first scope", &APIKeyInfo{KeyID: "scraper", Scopes: []string{"metrics"}}, http.StatusOK},
+		{"alternative scope", &APIKeyInfo{KeyID: "operator", Scopes: []string{"read", "admin"}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/metrics", nil)
+			if tt.info != nil {
+				req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, tt.info))
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+// TestScopeMiddlewareWithAuth tests scope enforcement behind API key authentication
+func TestScopeMiddlewareWithAuth(t *testing.T) {
+	config := NewAuthConfig()
+	config.AddAPIKey(&APIKey{KeyID: "scraper", Key: "sk_test_scraper", Scopes: []string{"metrics"}})
+	config.AddAPIKey(&APIKey{KeyID: "reader", Key: "sk_test_reader", Scopes: []string{"read"}})
+
+	handler := NewAuthMiddleware(config).Middleware(NewScopeMiddleware("metrics").Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	))
+
+	tests := []struct {
+		key        string
+		wantStatus int
+	}{
+		{"", http.StatusUnauthorized},
+		{"sk_test_reader", http.StatusForbidden},
+		{"sk_test_scraper", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if tt.key != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.key)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("key %q: expected status %d, got %d", tt.key, tt.wantStatus, rec.Code)
+		}
+	}
+}
+
+// TestScopeMiddlewareProblemJSON tests that rejections follow the configured error format
+func TestScopeMiddlewareProblemJSON(t *testing.T) {
+	if err := problem.Configure(&problem.Config{Format: problem.FormatProblem}); err != nil {
+		t.Fatalf("Failed to configure error format: %v", err)
+	}
+	t.Cleanup(func() { problem.Configure(nil) })
+
+	handler := NewScopeMiddleware("admin").Middleware(http.NotFoundHandler())
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "reader", Scopes: []string{"read"}}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Header().Get("Content-Type") != problem.ContentType {
+		t.Errorf("Expected %s, got %q", problem.ContentType, rec.Header().Get("Content-Type"))
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode body %q: %v", rec.Body.String(), err)
+	}
+	if body["type"] != problem.DefaultTypeBase+"insufficient_scope" || body["status"] != float64(http.StatusForbidden) {
+		t.Errorf("Expected an insufficient_scope problem, got %v", body)
+	}
+}
@@ -0,0 +1,410 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/forward"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// HeaderMirrored marks requests sent to a mirror so the backend can tell shadow traffic apart
+const HeaderMirrored = "X-Portal-Mirror"
+
+// Metrics holds request mirroring metrics
+type Metrics struct {
+	RequestsTotal       *prometheus.CounterVec
+	Duration            *prometheus.HistogramVec
+	StatusMismatchTotal *prometheus.CounterVec
+}
+
+// NewMetrics creates new mirroring metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new mirroring metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		RequestsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_mirror_requests_total",
+				Help: "Total number of requests mirrored, by mirror rule and outcome",
+			},
+			[]string{"lease_id", "result"}, // result: "2xx".."5xx", "error", "dropped", "skipped"
+		),
+		Duration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "portal_mirror_request_duration_seconds",
+				Help:    "Latency of mirrored requests",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"lease_id"},
+		),
+		StatusMismatchTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_mirror_status_mismatch_total",
+				Help: "Total number of mirrored requests whose status class differed from the primary response",
+			},
+			[]string{"lease_id"},
+		),
+	}
+}
+
+// Rule mirrors traffic for a lease to a secondary upstream
+type Rule struct {
+	LeaseID string // Lease ID (supports wildcards like "mcp-*")
+	URL     string // Mirror base URL; the request path and query are appended
+
+	target *url.URL
+}
+
+// MiddlewareConfig holds request mirroring configuration
+type MiddlewareConfig struct {
+	// Rules maps lease IDs to mirror upstreams
+	Rules middleware.LeaseRules[*Rule]
+
+	// Timeout bounds each mirrored request
+	Timeout time.Duration
+
+	// MaxBodySize is the largest request body that is mirrored; larger requests are skipped
+	MaxBodySize int64
+
+	// MaxInFlight caps concurrent mirrored requests; requests beyond it are dropped, never queued
+	MaxInFlight int
+
+	// Client sends mirrored requests (nil = a client without redirects using Transport)
+	Client *http.Client
+
+	// Transport carries mirrored requests when Client is nil (nil = http.DefaultTransport)
+	Transport http.RoundTripper
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+}
+
+// Common errors
+var (
+	ErrInvalidMirrorURL = errors.New("invalid mirror URL")
+	ErrRuleNotFound     = errors.New("mirror rule not found")
+)
+
+// DefaultMiddlewareConfig returns default mirroring configuration with no rules
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{
+		Timeout:     10 * time.Second,
+		MaxBodySize: 1 << 20, // 1 MB
+		MaxInFlight: 100,
+	}
+}
+
+// AddRule adds or replaces the mirror rule for a lease
+func (c *MiddlewareConfig) AddRule(rule *Rule) error {
+	if rule == nil {
+		return errors.New("mirror rule cannot be nil")
+	}
+
+	if rule.LeaseID == "" {
+		return errors.New("lease ID cannot be empty")
+	}
+
+	target, err := url.Parse(rule.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMirrorURL, err)
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: %q must be an absolute http or https URL", ErrInvalidMirrorURL, rule.URL)
+	}
+	rule.target = target
+
+	c.Rules.Set(rule.LeaseID, rule)
+	return nil
+}
+
+// RemoveRule removes the mirror rule for a lease
+func (c *MiddlewareConfig) RemoveRule(leaseID string) error {
+	if !c.Rules.Delete(leaseID) {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, leaseID)
+	}
+	return nil
+}
+
+// GetRule returns the mirror rule for a lease, or nil if its traffic is not mirrored
+func (c *MiddlewareConfig) GetRule(leaseID string) *Rule {
+	rule, _ := c.Rules.Match(leaseID)
+	return rule
+}
+
+// ListRules returns all mirror rules
+func (c *MiddlewareConfig) ListRules() []*Rule {
+	return c.Rules.List()
+}
+
+// Middleware copies lease traffic to mirror upstreams without affecting the primary response
+type Middleware struct {
+	config *MiddlewareConfig
+	slots  chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewMiddleware creates a new request mirroring middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = 100
+	}
+
+	if config.Client == nil {
+		config.Client = &http.Client{
+			Transport: config.Transport,
+			// The mirror's response is discarded, so there is no point following redirects
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	return &Middleware{
+		config: config,
+		slots:  make(chan struct{}, config.MaxInFlight),
+	}
+}
+
+// Stop waits for in-flight mirrored requests to finish
+func (m *Middleware) Stop() {
+	m.wg.Wait()
+}
+
+// Middleware returns an http.Handler that mirrors requests for leases with a mirror rule
+// The copy is sent after the primary handler returns, from the body bytes it read,
+// so mirroring never delays or changes the primary response
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := middleware.GetLeaseID(r.Context())
+		if leaseID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule := m.config.GetRule(leaseID)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Upgraded connections are handed over to the backend and cannot be replayed
+		if r.Header.Get("Upgrade") != "" {
+			m.config.Metrics.RequestsTotal.WithLabelValues(rule.LeaseID, "skipped").Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Snapshot the request before the primary handler can modify it
+		method := r.Method
+		requestURL := *r.URL
+		header := r.Header.Clone()
+
+		body := &bodyCapture{limit: m.config.MaxBodySize}
+		if r.Body == nil || r.Body == http.NoBody {
+			body.eof = true
+		} else {
+			body.ReadCloser = r.Body
+			r.Body = body
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Only a body the primary read in full can be mirrored faithfully
+		if !body.eof || body.overflow {
+			m.config.Metrics.RequestsTotal.WithLabelValues(rule.LeaseID, "skipped").Inc()
+			return
+		}
+
+		select {
+		case m.slots <- struct{}{}:
+		default:
+			m.config.Metrics.RequestsTotal.WithLabelValues(rule.LeaseID, "dropped").Inc()
+			return
+		}
+
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			defer func() { <-m.slots }()
+
+			m.send(rule, method, &requestURL, header, body.buf.Bytes(), recorder.statusCode)
+		}()
+	})
+}
+
+// send delivers a mirrored request and records its outcome; the response body is discarded
+func (m *Middleware) send(rule *Rule, method string, requestURL *url.URL, header http.Header, body []byte, primaryStatus int) {
+	// Detached from the client request, which has already completed
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, mirrorURL(rule.target, requestURL), bytes.NewReader(body))
+	if err != nil {
+		m.config.Metrics.RequestsTotal.WithLabelValues(rule.LeaseID, "error").Inc()
+		return
+	}
+	req.Header = mirrorHeader(header)
+
+	start := time.Now()
+	resp, err := m.config.Client.Do(req)
+	if err != nil {
+		m.config.Metrics.Duration.WithLabelValues(rule.LeaseID).Observe(time.Since(start).Seconds())
+		m.config.Metrics.RequestsTotal.WithLabelValues(rule.LeaseID, "error").Inc()
+		return
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	m.config.Metrics.Duration.WithLabelValues(rule.LeaseID).Observe(time.Since(start).Seconds())
+
+	result := statusClass(resp.StatusCode)
+	m.config.Metrics.RequestsTotal.WithLabelValues(rule.LeaseID, result).Inc()
+	if result != statusClass(primaryStatus) {
+		m.config.Metrics.StatusMismatchTotal.WithLabelValues(rule.LeaseID).Inc()
+	}
+}
+
+// mirrorURL appends the request path and query to the mirror base URL
+func mirrorURL(target, requestURL *url.URL) string {
+	u := *target
+	u.Path = strings.TrimSuffix(target.Path, "/") + "/" + strings.TrimPrefix(requestURL.Path, "/")
+	u.RawPath = ""
+
+	switch {
+	case target.RawQuery == "":
+		u.RawQuery = requestURL.RawQuery
+	case requestURL.RawQuery != "":
+		u.RawQuery = target.RawQuery + "&" + requestURL.RawQuery
+	}
+
+	return u.String()
+}
+
+// mirrorHeader returns the headers for a mirrored request
+// Gateway credentials are removed; the mirror sits behind the gateway like the primary
+func mirrorHeader(header http.Header) http.Header {
+	for _, value := range header.Values("Connection") {
+		for _, field := range strings.Split(value, ",") {
+			header.Del(strings.TrimSpace(field))
+		}
+	}
+	for _, name := range forward.HopHeaders {
+		header.Del(name)
+	}
+
+	header.Del("Authorization")
+	header.Del("X-API-Key")
+	header.Set(HeaderMirrored, "true")
+	return header
+}
+
+// statusClass returns the status class label for a status code, e.g. "2xx"
+func statusClass(statusCode int) string {
+	return fmt.Sprintf("%dxx", statusCode/100)
+}
+
+// bodyCapture keeps a copy of the request body as the primary handler reads it
+type bodyCapture struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	limit    int64
+	eof      bool
+	overflow bool
+}
+
+func (b *bodyCapture) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+
+	if !b.overflow {
+		if int64(b.buf.Len()+n) > b.limit {
+			b.overflow = true
+			b.buf = bytes.Buffer{}
+		} else {
+			b.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+// statusRecorder captures the primary response status
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (rw *statusRecorder) WriteHeader(code int) {
+	if !rw.wroteHeader {
+		rw.statusCode = code
+		rw.wroteHeader = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *statusRecorder) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so streaming responses still flush
+func (rw *statusRecorder) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it
+func (rw *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (rw *statusRecorder) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -0,0 +1,203 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestConfig creates a mirroring config with a fresh metrics registry
+func newTestConfig(t *testing.T, leaseID, mirrorURL string) *MiddlewareConfig {
+	t.Helper()
+
+	config := DefaultMiddlewareConfig()
+	config.Metrics = NewMetricsWithRegistry(prometheus.NewRegistry())
+	if err := config.AddRule(&Rule{LeaseID: leaseID, URL: mirrorURL}); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	return config
+}
+
+// counterValue returns the value of a counter
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	return m.Counter.GetValue()
+}
+
+// mirroredRequest is what the mirror upstream received
+type mirroredRequest struct {
+	method string
+	uri    string
+	header http.Header
+	body   string
+}
+
+// TestMirrorCopiesRequest tests that the mirror receives the request the primary served
+func TestMirrorCopiesRequest(t *testing.T) {
+	received := make(chan mirroredRequest, 1)
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- mirroredRequest{r.Method, r.URL.RequestURI(), r.Header, string(body)}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer mirrorServer.Close()
+
+	config := newTestConfig(t, "lease-*", mirrorServer.URL+"/shadow")
+	m := NewMiddleware(config)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+
+	req := httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "POST", "/peer/lease-1/items?limit=5", strings.NewReader(`{"name":"a"}`))
+	req.Header.Set("Authorization", "Bearer sk_live_secret")
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated || rr.Body.String() != `{"name":"a"}` {
+		t.Errorf("Expected primary response to be untouched, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	select {
+	case got := <-received:
+		if got.method != "POST" || got.uri != "/shadow/peer/lease-1/items?limit=5" {
+			t.Errorf("Unexpected mirrored request %s %s", got.method, got.uri)
+		}
+		if got.body != `{"name":"a"}` {
+			t.Errorf("Expected mirrored body, got %q", got.body)
+		}
+		if got.header.Get("Authorization") != "" {
+			t.Error("Expected credentials to be stripped from the mirrored request")
+		}
+		if got.header.Get("Content-Type") != "application/json" || got.header.Get(HeaderMirrored) != "true" {
+			t.Errorf("Unexpected mirrored headers %v", got.header)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Mirror never received the request")
+	}
+
+	m.Stop()
+
+	if got := counterValue(t, config.Metrics.RequestsTotal.WithLabelValues("lease-*", "5xx")); got != 1 {
+		t.Errorf("Expected 1 mirrored 5xx, got %v", got)
+	}
+	if got := counterValue(t, config.Metrics.StatusMismatchTotal.WithLabelValues("lease-*")); got != 1 {
+		t.Errorf("Expected 1 status mismatch, got %v", got)
+	}
+}
+
+// TestMirrorDoesNotDelayPrimary tests that a slow or failing mirror never affects the primary
+func TestMirrorDoesNotDelayPrimary(t *testing.T) {
+	release := make(chan struct{})
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer mirrorServer.Close()
+	defer close(release)
+
+	config := newTestConfig(t, "lease-1", mirrorServer.URL)
+	config.MaxInFlight = 1
+	m := NewMiddleware(config)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1", nil))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("Expected primary status 200, got %d", rr.Code)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("Primary request took %v while the mirror was blocked", elapsed)
+		}
+	}
+
+	// The first copy holds the only slot, so the second is dropped rather than queued
+	if got := counterValue(t, config.Metrics.RequestsTotal.WithLabelValues("lease-1", "dropped")); got != 1 {
+		t.Errorf("Expected 1 dropped mirror request, got %v", got)
+	}
+}
+
+// TestMirrorSkipsUnmirrorableBodies tests that oversized or unread bodies are not mirrored
+func TestMirrorSkipsUnmirrorableBodies(t *testing.T) {
+	mirrorServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Mirror should not receive %s", r.URL.Path)
+	}))
+	defer mirrorServer.Close()
+
+	config := newTestConfig(t, "lease-1", mirrorServer.URL)
+	config.MaxBodySize = 4
+	m := NewMiddleware(config)
+
+	reading := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+	}))
+	reading.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "POST", "/peer/lease-1/large", strings.NewReader("too large")))
+
+	ignoring := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ignoring.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "POST", "/peer/lease-1/unread", strings.NewReader("abc")))
+
+	m.Stop()
+
+	if got := counterValue(t, config.Metrics.RequestsTotal.WithLabelValues("lease-1", "skipped")); got != 2 {
+		t.Errorf("Expected 2 skipped mirror requests, got %v", got)
+	}
+}
+
+// TestGetRule tests exact and wildcard rule matching
+func TestGetRule(t *testing.T) {
+	config := DefaultMiddlewareConfig()
+	for _, rule := range []*Rule{
+		{LeaseID: "mcp-*", URL: "http://mirror-a"},
+		{LeaseID: "mcp-server-*", URL: "http://mirror-b"},
+		{LeaseID: "mcp-server-1", URL: "http://mirror-c"},
+	} {
+		if err := config.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule %s: %v", rule.LeaseID, err)
+		}
+	}
+
+	tests := []struct {
+		leaseID string
+		want    string
+	}{
+		{"mcp-server-1", "http://mirror-c"},
+		{"mcp-server-2", "http://mirror-b"},
+		{"mcp-tool", "http://mirror-a"},
+	}
+	for _, tt := range tests {
+		if rule := config.GetRule(tt.leaseID); rule == nil || rule.URL != tt.want {
+			t.Errorf("Lease %s: expected %s, got %v", tt.leaseID, tt.want, rule)
+		}
+	}
+
+	if rule := config.GetRule("other"); rule != nil {
+		t.Errorf("Expected no rule for other, got %v", rule)
+	}
+
+	for _, invalid := range []string{"", "mirror:8080", "ftp://mirror", "/relative"} {
+		if err := config.AddRule(&Rule{LeaseID: "x", URL: invalid}); err == nil {
+			t.Errorf("Expected error for mirror URL %q", invalid)
+		}
+	}
+}
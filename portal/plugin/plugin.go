@@ -0,0 +1,264 @@
+// Package plugin lets code built into the gateway binary register named middleware that a
+// configuration file places in the /peer chain relative to the built-in layers
+//
+// Plugins register from an init function, so a fork only adds a blank import:
+//
+//	func init() {
+//		plugin.Register(plugin.Registration{Name: "legacy-auth", Factory: newLegacyAuth})
+//	}
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// Layers are the built-in /peer layers plugins are placed against, outermost first
+// Disabled layers keep their place, so a placement never depends on which are enabled
+var Layers = []string{
+	"auth",
+	"acl",
+	"replay_protection",
+	"idempotency",
+	"timeout",
+	"circuit_breaker",
+	"quota",
+	"rate_limit",
+	"concurrency_limit",
+	"fair_queue",
+	"streaming",
+	"bandwidth",
+	"status_map",
+	"payload_capture",
+	"mirror",
+	"rewrite",
+	"coalesce",
+	"content_route",
+	"forward_headers",
+	"handler",
+}
+
+// Layers that set request state plugins may depend on
+const (
+	LayerAuth    = "auth" // Sets the API key
+	LayerACL     = "acl"  // Sets the lease ID
+	LayerHandler = "handler"
+)
+
+// Middleware wraps a handler, like the Middleware methods of the built-in layers
+type Middleware func(http.Handler) http.Handler
+
+// Factory builds a middleware from the options given to it in the plugin configuration
+type Factory func(options map[string]string) (Middleware, error)
+
+// Registration describes a middleware that can be placed in the /peer chain
+type Registration struct {
+	Name    string
+	Factory Factory
+
+	// RequiresKey rejects placements before authentication, where no API key is known yet
+	RequiresKey bool
+
+	// RequiresLease rejects placements before the ACL layer, where no lease ID is set yet
+	RequiresLease bool
+}
+
+// Common errors
+var (
+	ErrUnknownPlugin    = errors.New("unknown plugin")
+	ErrUnknownLayer     = errors.New("unknown layer")
+	ErrInvalidPlacement = errors.New("invalid plugin placement")
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Registration)
+)
+
+// Register makes a middleware available to the plugin configuration
+// It panics if the name is empty or already registered, like database/sql.Register
+func Register(reg Registration) {
+	if reg.Name == "" {
+		panic("plugin: Register name is empty")
+	}
+	if reg.Factory == nil {
+		panic("plugin: Register factory is nil for " + reg.Name)
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, exists := registry[reg.Name]; exists {
+		panic("plugin: Register called twice for " + reg.Name)
+	}
+	registry[reg.Name] = reg
+}
+
+// Lookup returns a registered middleware
+func Lookup(name string) (Registration, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	reg, ok := registry[name]
+	return reg, ok
+}
+
+// Names returns the registered middleware names, sorted
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Placement puts a registered middleware just before or just after a built-in layer
+// Placements next to the same layer run in the order they are listed
+type Placement struct {
+	Name    string
+	Before  string
+	After   string
+	Options map[string]string
+}
+
+// Validate checks that a placement names a registered middleware and a built-in layer, and
+// that it runs after the layers setting the state the middleware requires
+func (p *Placement) Validate() error {
+	reg, ok := Lookup(p.Name)
+	if !ok {
+		return fmt.Errorf("%w: %q (registered: %v)", ErrUnknownPlugin, p.Name, Names())
+	}
+
+	if (p.Before == "") == (p.After == "") {
+		return fmt.Errorf("%w: %s must set exactly one of before or after", ErrInvalidPlacement, p.Name)
+	}
+
+	layer := p.layer()
+	index := slices.Index(Layers, layer)
+	if index < 0 {
+		return fmt.Errorf("%w: %q (expected one of %v)", ErrUnknownLayer, layer, Layers)
+	}
+	if p.After == LayerHandler {
+		return fmt.Errorf("%w: nothing runs after the handler", ErrInvalidPlacement)
+	}
+
+	// Placed after a layer, the middleware sees everything that layer set
+	if p.After != "" {
+		index++
+	}
+	if reg.RequiresKey && index <= slices.Index(Layers, LayerAuth) {
+		return fmt.Errorf("%w: %s requires the API key and must be placed after %s", ErrInvalidPlacement, p.Name, LayerAuth)
+	}
+	if reg.RequiresLease && index <= slices.Index(Layers, LayerACL) {
+		return fmt.Errorf("%w: %s requires the lease ID and must be placed after %s", ErrInvalidPlacement, p.Name, LayerACL)
+	}
+
+	return nil
+}
+
+// layer returns the built-in layer a placement is relative to
+func (p *Placement) layer() string {
+	if p.Before != "" {
+		return p.Before
+	}
+	return p.After
+}
+
+// Chain holds the middlewares built from placements, by the layer they are placed next to
+// A nil Chain inserts nothing
+type Chain struct {
+	before map[string][]placed
+	after  map[string][]placed
+}
+
+// placed is a built middleware and the name it was registered under
+type placed struct {
+	name       string
+	middleware Middleware
+}
+
+// NewChain validates placements and builds their middlewares
+func NewChain(placements []*Placement) (*Chain, error) {
+	c := &Chain{
+		before: make(map[string][]placed),
+		after:  make(map[string][]placed),
+	}
+
+	for _, p := range placements {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+
+		reg, _ := Lookup(p.Name)
+		mw, err := reg.Factory(p.Options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create plugin %s: %w", p.Name, err)
+		}
+		if mw == nil {
+			return nil, fmt.Errorf("failed to create plugin %s: factory returned no middleware", p.Name)
+		}
+
+		entry := placed{name: p.Name, middleware: mw}
+		if p.Before != "" {
+			c.before[p.Before] = append(c.before[p.Before], entry)
+		} else {
+			c.after[p.After] = append(c.after[p.After], entry)
+		}
+	}
+
+	return c, nil
+}
+
+// Before wraps next, which must already be wrapped in layer, in the middlewares placed before layer
+func (c *Chain) Before(layer string, next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return wrap(c.before[layer], next)
+}
+
+// After wraps next in the middlewares placed after layer; layer is wrapped around the result
+func (c *Chain) After(layer string, next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return wrap(c.after[layer], next)
+}
+
+// wrap wraps next so the middlewares run in the order listed
+func wrap(middlewares []placed, next http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		next = middlewares[i].middleware(next)
+	}
+	return next
+}
+
+// Describe returns the active built-in layers, in request order, with the plugins placed
+// among them as "plugin:<name>"
+func (c *Chain) Describe(active []string) []string {
+	if c == nil {
+		return active
+	}
+
+	described := make([]string, 0, len(active))
+	for _, layer := range Layers {
+		for _, p := range c.before[layer] {
+			described = append(described, "plugin:"+p.name)
+		}
+		if slices.Contains(active, layer) {
+			described = append(described, layer)
+		}
+		for _, p := range c.after[layer] {
+			described = append(described, "plugin:"+p.name)
+		}
+	}
+	return described
+}
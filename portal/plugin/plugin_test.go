@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// tagFactory builds a middleware that appends its "tag" option to X-Trace
+func tagFactory(options map[string]string) (Middleware, error) {
+	tag := options["tag"]
+	if tag == "" {
+		return nil, errors.New("tag option is required")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Add("X-Trace", tag)
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func init() {
+	Register(Registration{Name: "test-tag", Factory: tagFactory})
+	Register(Registration{Name: "test-key", Factory: tagFactory, RequiresKey: true})
+	Register(Registration{Name: "test-lease", Factory: tagFactory, RequiresLease: true})
+}
+
+// layerHandler stands in for a built-in layer, appending its name to X-Trace
+func layerHandler(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Add("X-Trace", name)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a name twice to panic")
+		}
+	}()
+	Register(Registration{Name: "test-tag", Factory: tagFactory})
+}
+
+func TestPlacementValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		placement Placement
+		wantErr   error
+	}{
+		{"before auth", Placement{Name: "test-tag", Before: "auth"}, nil},
+		{"before handler", Placement{Name: "test-tag", Before: "handler"}, nil},
+		{"key after auth", Placement{Name: "test-key", After: "auth"}, nil},
+		{"lease after acl", Placement{Name: "test-lease", After: "acl"}, nil},
+		{"lease before circuit breaker", Placement{Name: "test-lease", Before: "circuit_breaker"}, nil},
+		{"unknown plugin", Placement{Name: "missing", Before: "auth"}, ErrUnknownPlugin},
+		{"unknown layer", Placement{Name: "test-tag", After: "cache"}, ErrUnknownLayer},
+		{"no layer", Placement{Name: "test-tag"}, ErrInvalidPlacement},
+		{"both before and after", Placement{Name: "test-tag", Before: "auth", After: "acl"}, ErrInvalidPlacement},
+		{"after handler", Placement{Name: "test-tag", After: "handler"}, ErrInvalidPlacement},
+		{"key before auth", Placement{Name: "test-key", Before: "auth"}, ErrInvalidPlacement},
+		{"lease before acl", Placement{Name: "test-lease", Before: "acl"}, ErrInvalidPlacement},
+		{"lease between auth and acl", Placement{Name: "test-lease", After: "auth"}, ErrInvalidPlacement},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.placement.Validate()
+			if tt.wantErr == nil && err != nil {
+				t.Errorf("Expected placement to be valid, got %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	chain, err := NewChain([]*Placement{
+		{Name: "test-tag", Before: "auth", Options: map[string]string{"tag": "first"}},
+		{Name: "test-tag", Before: "auth", Options: map[string]string{"tag": "second"}},
+		{Name: "test-lease", After: "acl", Options: map[string]string{"tag": "lease"}},
+		{Name: "test-tag", Before: "handler", Options: map[string]string{"tag": "last"}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+
+	// Built like the server: innermost first, each layer between its After and Before plugins
+	var trace []string
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = r.Header.Values("X-Trace")
+	})
+	h = chain.Before("handler", h)
+	for _, layer := range []string{"acl", "auth"} {
+		h = chain.After(layer, h)
+		h = layerHandler(layer, h)
+		h = chain.Before(layer, h)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/peer/lease-1", nil))
+
+	want := []string{"first", "second", "auth", "acl", "lease", "last"}
+	if !slices.Equal(trace, want) {
+		t.Errorf("Expected request order %v, got %v", want, trace)
+	}
+
+	described := chain.Describe([]string{"auth", "acl", "timeout"})
+	wantDescribed := []string{"plugin:test-tag", "plugin:test-tag", "auth", "acl", "plugin:test-lease", "timeout", "plugin:test-tag"}
+	if !slices.Equal(described, wantDescribed) {
+		t.Errorf("Expected %v, got %v", wantDescribed, described)
+	}
+}
+
+func TestNewChainFactoryError(t *testing.T) {
+	_, err := NewChain([]*Placement{{Name: "test-tag", Before: "auth"}})
+	if err == nil || !strings.Contains(err.Error(), "tag option is required") {
+		t.Errorf("Expected the factory error, got %v", err)
+	}
+}
+
+func TestNilChain(t *testing.T) {
+	var chain *Chain
+	next := http.NotFoundHandler()
+
+	if chain.Before("auth", next) == nil || chain.After("auth", next) == nil {
+		t.Error("Expected a nil chain to return the handler")
+	}
+	if active := []string{"auth", "acl"}; !slices.Equal(chain.Describe(active), active) {
+		t.Error("Expected a nil chain to describe only the active layers")
+	}
+}
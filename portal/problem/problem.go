@@ -0,0 +1,145 @@
+// Package problem writes the gateway's own error responses, either in its original
+// {"error":"<code>","message":"..."} format or as RFC 7807 application/problem+json
+package problem
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+)
+
+// Format selects how error responses are written
+type Format string
+
+const (
+	// FormatJSON writes {"error":"<code>","message":"..."} as application/json
+	FormatJSON Format = "json"
+	// FormatProblem writes RFC 7807 type, title, status, detail and instance members as
+	// application/problem+json
+	FormatProblem Format = "problem+json"
+)
+
+// ContentType is the media type of RFC 7807 problem details
+const ContentType = "application/problem+json"
+
+// DefaultTypeBase prefixes error codes to form problem type URIs
+const DefaultTypeBase = "urn:portal-gateway:error:"
+
+// Config holds error response configuration
+type Config struct {
+	// Format is the error response format (default FormatJSON)
+	Format Format
+
+	// TypeBase is prepended to the error code to form the problem type URI, e.g.
+	// "https://docs.example.com/errors/" gives "https://docs.example.com/errors/rate_limit_exceeded"
+	TypeBase string
+}
+
+// DefaultConfig returns default error response configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Format:   FormatJSON,
+		TypeBase: DefaultTypeBase,
+	}
+}
+
+var current atomic.Pointer[Config]
+
+func init() {
+	current.Store(DefaultConfig())
+}
+
+// Configure sets how every error response is written
+// Must be called before the server serves requests
+func Configure(config *Config) error {
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	switch config.Format {
+	case "":
+		config.Format = FormatJSON
+	case FormatJSON, FormatProblem:
+	default:
+		return fmt.Errorf("invalid error format %q (expected %q or %q)", config.Format, FormatJSON, FormatProblem)
+	}
+
+	if config.TypeBase == "" {
+		config.TypeBase = DefaultTypeBase
+	}
+
+	current.Store(config)
+	return nil
+}
+
+// Current returns the error response configuration in effect
+func Current() *Config {
+	return current.Load()
+}
+
+// Write writes an error response with a machine-readable code and a message for people
+func Write(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	WriteWithFields(w, r, status, code, message, nil)
+}
+
+// WriteWithFields writes an error response with extra members, such as retry_after, which
+// are kept in either format (RFC 7807 extension members)
+func WriteWithFields(w http.ResponseWriter, r *http.Request, status int, code, message string, fields map[string]any) {
+	config := current.Load()
+
+	var buf bytes.Buffer
+	if config.Format == FormatProblem {
+		w.Header().Set("Content-Type", ContentType)
+		writeMember(&buf, "type", config.TypeBase+code)
+		writeMember(&buf, "title", http.StatusText(status))
+		writeMember(&buf, "status", status)
+		writeMember(&buf, "detail", message)
+		if r != nil {
+			if requestID := logging.GetRequestID(r.Context()); requestID != "" {
+				writeMember(&buf, "instance", requestID)
+			}
+		}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		writeMember(&buf, "error", code)
+		writeMember(&buf, "message", message)
+	}
+
+	// Extra members follow in a stable order
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		writeMember(&buf, key, fields[key])
+	}
+	buf.WriteByte('}')
+
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// writeMember appends a JSON object member, opening the object on the first one
+func writeMember(buf *bytes.Buffer, key string, value any) {
+	if buf.Len() == 0 {
+		buf.WriteByte('{')
+	} else {
+		buf.WriteByte(',')
+	}
+
+	name, _ := json.Marshal(key)
+	buf.Write(name)
+	buf.WriteByte(':')
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded = []byte("null")
+	}
+	buf.Write(encoded)
+}
@@ -0,0 +1,109 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+)
+
+// configure sets the error format for one test
+func configure(t *testing.T, config *Config) {
+	t.Helper()
+
+	if err := Configure(config); err != nil {
+		t.Fatalf("Failed to configure error format: %v", err)
+	}
+	t.Cleanup(func() { Configure(nil) })
+}
+
+func decode(t *testing.T, rr *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected a JSON body, got %q: %v", rr.Body.String(), err)
+	}
+	return body
+}
+
+func TestWriteJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	WriteWithFields(rr, httptest.NewRequest("GET", "/peer/lease-1", nil), http.StatusTooManyRequests, "rate_limit_exceeded", `Retry after "5" seconds`, map[string]any{"retry_after": 5})
+
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected a 429 JSON response, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	want := `{"error":"rate_limit_exceeded","message":"Retry after \"5\" seconds","retry_after":5}`
+	if rr.Body.String() != want {
+		t.Errorf("Expected %s, got %s", want, rr.Body.String())
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	configure(t, &Config{Format: FormatProblem, TypeBase: "https://docs.example.com/errors/"})
+
+	r := httptest.NewRequest("GET", "/peer/lease-1", nil)
+	r = r.WithContext(logging.ContextWithRequestID(r.Context(), "req-123"))
+
+	rr := httptest.NewRecorder()
+	WriteWithFields(rr, r, http.StatusServiceUnavailable, "service_unavailable", "Circuit breaker is open for lease lease-1", map[string]any{"retry_after_seconds": 30})
+
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Content-Type") != ContentType {
+		t.Errorf("Expected a 503 problem response, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	body := decode(t, rr)
+	want := map[string]any{
+		"type":                "https://docs.example.com/errors/service_unavailable",
+		"title":               "Service Unavailable",
+		"status":              float64(http.StatusServiceUnavailable),
+		"detail":              "Circuit breaker is open for lease lease-1",
+		"instance":            "req-123",
+		"retry_after_seconds": float64(30),
+	}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("Expected %s to be %v, got %v", key, value, body[key])
+		}
+	}
+	if _, exists := body["error"]; exists {
+		t.Error("Expected no legacy error member")
+	}
+}
+
+func TestWriteProblemWithoutRequestID(t *testing.T) {
+	configure(t, &Config{Format: FormatProblem})
+
+	rr := httptest.NewRecorder()
+	Write(rr, httptest.NewRequest("GET", "/peer/lease-1", nil), http.StatusForbidden, "access_denied", "Access denied to this lease")
+
+	body := decode(t, rr)
+	if body["type"] != DefaultTypeBase+"access_denied" {
+		t.Errorf("Expected the default type base, got %v", body["type"])
+	}
+	if _, exists := body["instance"]; exists {
+		t.Error("Expected no instance without a request ID")
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() { Configure(nil) })
+
+	if err := Configure(&Config{Format: "xml"}); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+	if Current().Format != FormatJSON {
+		t.Errorf("Expected a rejected config to leave the format unchanged, got %q", Current().Format)
+	}
+
+	if err := Configure(&Config{}); err != nil {
+		t.Fatalf("Expected an empty config to be valid, got %v", err)
+	}
+	if Current().Format != FormatJSON || Current().TypeBase != DefaultTypeBase {
+		t.Errorf("Expected defaults to be filled in, got %+v", Current())
+	}
+}
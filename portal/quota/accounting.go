@@ -0,0 +1,86 @@
+package quota
+
+import (
+	"fmt"
+	"io"
+)
+
+// ByteAccounting selects which traffic direction counts against byte quotas
+type ByteAccounting string
+
+// Byte accounting modes accepted by ParseByteAccounting
+const (
+	ByteAccountingBoth    ByteAccounting = "both"    // Request and response bodies
+	ByteAccountingIngress ByteAccounting = "ingress" // Request bodies only
+	ByteAccountingEgress  ByteAccounting = "egress"  // Response bodies only
+)
+
+// ParseByteAccounting parses a byte accounting mode; an empty name is "both"
+func ParseByteAccounting(name string) (ByteAccounting, error) {
+	switch ByteAccounting(name) {
+	case "", ByteAccountingBoth:
+		return ByteAccountingBoth, nil
+	case ByteAccountingIngress:
+		return ByteAccountingIngress, nil
+	case ByteAccountingEgress:
+		return ByteAccountingEgress, nil
+	}
+
+	return "", fmt.Errorf("invalid byte accounting %q (expected both, ingress, or egress)", name)
+}
+
+// CountsIngress reports whether request bodies count against the byte quota
+func (a ByteAccounting) CountsIngress() bool {
+	return a != ByteAccountingEgress
+}
+
+// CountsEgress reports whether response bodies count against the byte quota
+func (a ByteAccounting) CountsEgress() bool {
+	return a != ByteAccountingIngress
+}
+
+// Total returns the bytes charged for a request given the body bytes read and written
+func (a ByteAccounting) Total(ingress, egress int64) int64 {
+	var total int64
+	if a.CountsIngress() {
+		total += ingress
+	}
+	if a.CountsEgress() {
+		total += egress
+	}
+	return total
+}
+
+// StreamAccounting selects when the response bytes of a streamed response are charged
+// A stream counts as one request however long it stays open, in either mode
+type StreamAccounting string
+
+// Stream accounting modes accepted by ParseStreamAccounting
+const (
+	StreamAccountingOnClose     StreamAccounting = "close"       // Charged once the stream ends
+	StreamAccountingIncremental StreamAccounting = "incremental" // Charged as chunks are sent; the stream is cut off once the byte quota runs out
+)
+
+// ParseStreamAccounting parses a stream accounting mode; an empty name is "close"
+func ParseStreamAccounting(name string) (StreamAccounting, error) {
+	switch StreamAccounting(name) {
+	case "", StreamAccountingOnClose:
+		return StreamAccountingOnClose, nil
+	case StreamAccountingIncremental:
+		return StreamAccountingIncremental, nil
+	}
+
+	return "", fmt.Errorf("invalid stream accounting %q (expected close or incremental)", name)
+}
+
+// countingReadCloser wraps a request body to count the bytes actually read
+type countingReadCloser struct {
+	io.ReadCloser
+	bytesRead int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.bytesRead += int64(n)
+	return n, err
+}
@@ -0,0 +1,69 @@
+package quota
+
+import "testing"
+
+func TestParseByteAccounting(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    ByteAccounting
+		wantErr bool
+	}{
+		{"", ByteAccountingBoth, false},
+		{"both", ByteAccountingBoth, false},
+		{"ingress", ByteAccountingIngress, false},
+		{"egress", ByteAccountingEgress, false},
+		{"upload", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteAccounting(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteAccounting(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteAccounting(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestByteAccountingTotal(t *testing.T) {
+	tests := []struct {
+		accounting ByteAccounting
+		want       int64
+	}{
+		{ByteAccountingBoth, 150},
+		{ByteAccountingIngress, 100},
+		{ByteAccountingEgress, 50},
+	}
+
+	for _, tt := range tests {
+		if got := tt.accounting.Total(100, 50); got != tt.want {
+			t.Errorf("%s.Total(100, 50) = %d, want %d", tt.accounting, got, tt.want)
+		}
+	}
+}
+
+func TestParseStreamAccounting(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    StreamAccounting
+		wantErr bool
+	}{
+		{"", StreamAccountingOnClose, false},
+		{"close", StreamAccountingOnClose, false},
+		{"incremental", StreamAccountingIncremental, false},
+		{"chunk", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseStreamAccounting(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseStreamAccounting(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseStreamAccounting(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -8,28 +8,36 @@ import (
 )
 
 // QuotaLimit defines quota limits for an API key
+// Request and byte limits apply per quota period, which is monthly unless Period says otherwise
 type QuotaLimit struct {
 	KeyID                 string `json:"key_id"`
-	MonthlyRequestLimit   int64  `json:"monthly_request_limit"`   // 0 = unlimited
-	MonthlyBytesLimit     int64  `json:"monthly_bytes_limit"`     // 0 = unlimited (in bytes)
-	ConcurrentConnections int    `json:"concurrent_connections"`  // 0 = unlimited
+	MonthlyRequestLimit   int64  `json:"monthly_request_limit"`  // 0 = unlimited
+	MonthlyBytesLimit     int64  `json:"monthly_bytes_limit"`    // 0 = unlimited (in bytes)
+	ConcurrentConnections int    `json:"concurrent_connections"` // 0 = unlimited
+	Period                string `json:"period,omitempty"`       // See ParsePeriod; "" = manager default
+
+	// RolloverPercent carries up to this percentage of a period's unused request allowance
+	// into the next period as bonus requests; 0 = no rollover
+	RolloverPercent int `json:"rollover_percent,omitempty"`
 }
 
 // QuotaStatus represents the current quota status for an API key
 type QuotaStatus struct {
-	KeyID                  string    `json:"key_id"`
-	RequestCount           int64     `json:"request_count"`
-	RequestLimit           int64     `json:"request_limit"`
-	RequestRemaining       int64     `json:"request_remaining"`
-	BytesTransferred       int64     `json:"bytes_transferred"`
-	BytesLimit             int64     `json:"bytes_limit"`
-	BytesRemaining         int64     `json:"bytes_remaining"`
-	ActiveConnections      int       `json:"active_connections"`
-	ConcurrentConnLimit    int       `json:"concurrent_conn_limit"`
-	PeriodStart            time.Time `json:"period_start"`
-	PeriodEnd              time.Time `json:"period_end"`
-	QuotaExceeded          bool      `json:"quota_exceeded"`
-	QuotaExceededReason    string    `json:"quota_exceeded_reason,omitempty"`
+	KeyID               string    `json:"key_id"`
+	RequestCount        int64     `json:"request_count"`
+	RequestLimit        int64     `json:"request_limit"`
+	RequestRemaining    int64     `json:"request_remaining"` // Includes RolloverRequests
+	RolloverRequests    int64     `json:"rollover_requests"` // Bonus requests carried from the previous period
+	BytesTransferred    int64     `json:"bytes_transferred"`
+	BytesLimit          int64     `json:"bytes_limit"`
+	BytesRemaining      int64     `json:"bytes_remaining"`
+	ActiveConnections   int       `json:"active_connections"`
+	ConcurrentConnLimit int       `json:"concurrent_conn_limit"`
+	Period              string    `json:"period"`
+	PeriodStart         time.Time `json:"period_start"`
+	PeriodEnd           time.Time `json:"period_end"`
+	QuotaExceeded       bool      `json:"quota_exceeded"`
+	QuotaExceededReason string    `json:"quota_exceeded_reason,omitempty"`
 }
 
 // Manager manages quota limits and enforcement
@@ -40,6 +48,9 @@ type Manager struct {
 	defaultRequestLimit int64
 	defaultBytesLimit   int64
 	defaultConnLimit    int
+	defaultPeriod       PeriodStrategy
+	byteAccounting      ByteAccounting
+	streamAccounting    StreamAccounting
 	mu                  sync.RWMutex
 	connMu              sync.Mutex
 }
@@ -49,10 +60,14 @@ var (
 	ErrQuotaExceeded        = errors.New("quota exceeded")
 	ErrRequestQuotaExceeded = errors.New("monthly request quota exceeded")
 	ErrBytesQuotaExceeded   = errors.New("monthly data transfer quota exceeded")
+	ErrRequestTooLarge      = errors.New("request size exceeds remaining data transfer quota")
 	ErrConnectionLimit      = errors.New("concurrent connection limit exceeded")
 	ErrInvalidLimit         = errors.New("invalid quota limit")
 )
 
+// MaxRolloverPercent is the largest RolloverPercent a limit may set
+const MaxRolloverPercent = 100
+
 // NewManager creates a new quota manager
 func NewManager(storage Storage, defaultRequestLimit int64, defaultBytesLimit int64, defaultConnLimit int) *Manager {
 	if defaultRequestLimit <= 0 {
@@ -72,11 +87,135 @@ func NewManager(storage Storage, defaultRequestLimit int64, defaultBytesLimit in
 		defaultRequestLimit: defaultRequestLimit,
 		defaultBytesLimit:   defaultBytesLimit,
 		defaultConnLimit:    defaultConnLimit,
+		defaultPeriod:       MonthlyPeriod{},
+		byteAccounting:      ByteAccountingBoth,
+		streamAccounting:    StreamAccountingOnClose,
+	}
+}
+
+// SetDefaultPeriod sets the period for keys whose limit does not name one
+// It must be called before the manager is used
+func (m *Manager) SetDefaultPeriod(period PeriodStrategy) {
+	if period == nil {
+		period = MonthlyPeriod{}
+	}
+	m.defaultPeriod = period
+}
+
+// SetByteAccounting sets which traffic direction counts against byte quotas
+// It must be called before the manager is used
+func (m *Manager) SetByteAccounting(accounting ByteAccounting) {
+	if accounting == "" {
+		accounting = ByteAccountingBoth
+	}
+	m.byteAccounting = accounting
+}
+
+// ByteAccounting returns which traffic direction counts against byte quotas
+func (m *Manager) ByteAccounting() ByteAccounting {
+	return m.byteAccounting
+}
+
+// SetStreamAccounting sets when the response bytes of streamed responses are charged
+// It must be called before the manager is used
+func (m *Manager) SetStreamAccounting(accounting StreamAccounting) {
+	if accounting == "" {
+		accounting = StreamAccountingOnClose
+	}
+	m.streamAccounting = accounting
+}
+
+// StreamAccounting returns when the response bytes of streamed responses are charged
+func (m *Manager) StreamAccounting() StreamAccounting {
+	return m.streamAccounting
+}
+
+// periodFor returns the period strategy for a limit
+func (m *Manager) periodFor(limit *QuotaLimit) PeriodStrategy {
+	if limit.Period == "" {
+		return m.defaultPeriod
+	}
+
+	period, err := ParsePeriod(limit.Period)
+	if err != nil {
+		// Limits are validated when set, so this only guards hand-built limits
+		return m.defaultPeriod
 	}
+	return period
 }
 
 // SetLimit sets quota limit for an API key
 func (m *Manager) SetLimit(limit *QuotaLimit) error {
+	if err := validateLimit(limit); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.limits[limit.KeyID] = limit
+	return nil
+}
+
+// SetLimits sets the quota limits of several API keys at once and returns the limits they
+// replaced, nil for keys that had none
+// Every limit is validated first, so either all are applied or none are
+func (m *Manager) SetLimits(limits []*QuotaLimit) ([]*QuotaLimit, error) {
+	for _, limit := range limits {
+		if err := validateLimit(limit); err != nil {
+			if limit != nil && limit.KeyID != "" {
+				return nil, fmt.Errorf("key %s: %w", limit.KeyID, err)
+			}
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := make([]*QuotaLimit, len(limits))
+	for i, limit := range limits {
+		previous[i] = m.limits[limit.KeyID]
+		m.limits[limit.KeyID] = limit
+	}
+	return previous, nil
+}
+
+// ChangePlan replaces the quota limit for an API key without resetting usage
+// and returns the status recomputed against the new limit, all under one lock
+// so callers never observe the new limit paired with a stale status
+func (m *Manager) ChangePlan(keyID string, newLimit *QuotaLimit) (*QuotaStatus, error) {
+	if newLimit == nil {
+		return nil, errors.New("quota limit cannot be nil")
+	}
+
+	if newLimit.KeyID != "" && newLimit.KeyID != keyID {
+		return nil, fmt.Errorf("key ID mismatch: %s != %s", newLimit.KeyID, keyID)
+	}
+
+	limit := *newLimit
+	limit.KeyID = keyID
+
+	if err := validateLimit(&limit); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Usage is read under the same lock the limit is written with
+	usage, err := m.currentUsage(keyID, &limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	m.limits[keyID] = &limit
+
+	return m.buildStatus(keyID, usage, &limit), nil
+}
+
+// validateLimit validates a quota limit
+func validateLimit(limit *QuotaLimit) error {
 	if limit == nil {
 		return errors.New("quota limit cannot be nil")
 	}
@@ -89,13 +228,63 @@ func (m *Manager) SetLimit(limit *QuotaLimit) error {
 		return ErrInvalidLimit
 	}
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	if limit.Period != "" {
+		if _, err := ParsePeriod(limit.Period); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidLimit, err)
+		}
+	}
+
+	if limit.RolloverPercent < 0 || limit.RolloverPercent > MaxRolloverPercent {
+		return fmt.Errorf("%w: rollover percent must be between 0 and %d", ErrInvalidLimit, MaxRolloverPercent)
+	}
 
-	m.limits[limit.KeyID] = limit
 	return nil
 }
 
+// periodAt returns the start of the limit's period containing at, first carrying over
+// unused requests from the previous period when the limit has rollover enabled
+func (m *Manager) periodAt(keyID string, limit *QuotaLimit, at time.Time) (time.Time, error) {
+	period := m.periodFor(limit)
+	periodStart := period.Start(at)
+
+	if limit.RolloverPercent > 0 && limit.MonthlyRequestLimit > 0 {
+		err := m.storage.StartPeriod(keyID, periodStart, func(previous *Usage) int64 {
+			return rolloverRequests(limit, period, previous, periodStart)
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	return periodStart, nil
+}
+
+// currentUsage returns usage in the limit's current period
+func (m *Manager) currentUsage(keyID string, limit *QuotaLimit) (*Usage, error) {
+	periodStart, err := m.periodAt(keyID, limit, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	return m.storage.GetUsage(keyID, periodStart)
+}
+
+// rolloverRequests returns the bonus requests carried into the period starting at periodStart
+// Only the base allowance rolls over, so bonuses do not compound across periods
+func rolloverRequests(limit *QuotaLimit, period PeriodStrategy, previous *Usage, periodStart time.Time) int64 {
+	unused := limit.MonthlyRequestLimit
+
+	// Usage stored for an older period means the key made no requests in the previous one
+	if previous.PeriodStart.Equal(period.Start(periodStart.Add(-time.Second))) {
+		unused -= previous.RequestCount
+	}
+
+	if unused <= 0 {
+		return 0
+	}
+	return unused * int64(limit.RolloverPercent) / 100
+}
+
 // GetLimit retrieves quota limit for an API key
 func (m *Manager) GetLimit(keyID string) *QuotaLimit {
 	m.mu.RLock()
@@ -111,6 +300,7 @@ func (m *Manager) GetLimit(keyID string) *QuotaLimit {
 		MonthlyRequestLimit:   m.defaultRequestLimit,
 		MonthlyBytesLimit:     m.defaultBytesLimit,
 		ConcurrentConnections: m.defaultConnLimit,
+		Period:                m.defaultPeriod.String(),
 	}
 }
 
@@ -139,53 +329,158 @@ func (m *Manager) ListLimits() []*QuotaLimit {
 	return limits
 }
 
+// Quota types reported in QuotaDecision.ExceededType, matching the portal_quota_exceeded_total labels
+const (
+	QuotaTypeRequests    = "requests"
+	QuotaTypeBytes       = "bytes"
+	QuotaTypeConnections = "connections"
+)
+
+// QuotaDecision is the structured outcome of a quota check
+type QuotaDecision struct {
+	Allowed      bool
+	ExceededType string // One of the QuotaType constants when not allowed
+
+	// RequestTooLarge is set when byte quota remains, just not enough for the estimated request
+	RequestTooLarge bool
+
+	RequestCount      int64
+	RequestLimit      int64 // 0 = unlimited; includes any rollover bonus
+	RequestRemaining  int64
+	BytesTransferred  int64
+	BytesLimit        int64 // 0 = unlimited
+	BytesRemaining    int64
+	EstimatedBytes    int64
+	ActiveConnections int
+	ConnectionLimit   int // 0 = unlimited
+}
+
+// Err returns the error CheckQuota reports for this decision, or nil if it is allowed
+func (d *QuotaDecision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+
+	switch d.ExceededType {
+	case QuotaTypeRequests:
+		return fmt.Errorf("%w: %d/%d requests used", ErrRequestQuotaExceeded, d.RequestCount, d.RequestLimit)
+	case QuotaTypeBytes:
+		if d.RequestTooLarge {
+			return fmt.Errorf("%w: %w: %d bytes requested, %d remaining", ErrBytesQuotaExceeded, ErrRequestTooLarge, d.EstimatedBytes, d.BytesRemaining)
+		}
+		return fmt.Errorf("%w: %d/%d bytes used", ErrBytesQuotaExceeded, d.BytesTransferred, d.BytesLimit)
+	case QuotaTypeConnections:
+		return fmt.Errorf("%w: %d/%d connections", ErrConnectionLimit, d.ActiveConnections, d.ConnectionLimit)
+	default:
+		return ErrQuotaExceeded
+	}
+}
+
 // CheckQuota checks if a request is allowed under quota limits
+// Use Decide to learn which limit was hit without matching errors
 func (m *Manager) CheckQuota(keyID string, estimatedBytes int64) error {
-	if keyID == "" {
-		return errors.New("key ID cannot be empty")
+	decision, err := m.Decide(keyID, estimatedBytes)
+	if err != nil {
+		return err
 	}
+	return decision.Err()
+}
 
-	// Get current usage
-	usage, err := m.storage.GetUsage(keyID)
-	if err != nil {
-		return fmt.Errorf("failed to get usage: %w", err)
+// Decide checks a request against the quota limits and reports which limit, if any, was hit
+// The error is only set when the check itself fails
+func (m *Manager) Decide(keyID string, estimatedBytes int64) (*QuotaDecision, error) {
+	if keyID == "" {
+		return nil, errors.New("key ID cannot be empty")
 	}
 
 	// Get quota limit
 	limit := m.GetLimit(keyID)
 
-	// Check request quota
-	if limit.MonthlyRequestLimit > 0 && usage.RequestCount >= limit.MonthlyRequestLimit {
-		return fmt.Errorf("%w: %d/%d requests used", ErrRequestQuotaExceeded, usage.RequestCount, limit.MonthlyRequestLimit)
-	}
-
-	// Check bytes quota
-	if limit.MonthlyBytesLimit > 0 {
-		projectedBytes := usage.BytesTransferred + estimatedBytes
-		if projectedBytes > limit.MonthlyBytesLimit {
-			return fmt.Errorf("%w: %d/%d bytes used", ErrBytesQuotaExceeded, usage.BytesTransferred, limit.MonthlyBytesLimit)
-		}
+	// Get usage in the current period
+	usage, err := m.currentUsage(keyID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
 	}
 
-	// Check concurrent connections
+	// Get active connections
 	m.connMu.Lock()
 	activeConns := m.activeConnections[keyID]
 	m.connMu.Unlock()
 
-	if limit.ConcurrentConnections > 0 && activeConns >= limit.ConcurrentConnections {
-		return fmt.Errorf("%w: %d/%d connections", ErrConnectionLimit, activeConns, limit.ConcurrentConnections)
+	requestLimit := effectiveRequestLimit(limit, usage)
+
+	decision := &QuotaDecision{
+		Allowed:           true,
+		RequestCount:      usage.RequestCount,
+		RequestLimit:      requestLimit,
+		BytesTransferred:  usage.BytesTransferred,
+		BytesLimit:        limit.MonthlyBytesLimit,
+		EstimatedBytes:    estimatedBytes,
+		ActiveConnections: activeConns,
+		ConnectionLimit:   limit.ConcurrentConnections,
+	}
+	if requestLimit > 0 {
+		decision.RequestRemaining = max(requestLimit-usage.RequestCount, 0)
+	}
+	if limit.MonthlyBytesLimit > 0 {
+		decision.BytesRemaining = max(limit.MonthlyBytesLimit-usage.BytesTransferred, 0)
 	}
 
-	return nil
+	switch {
+	// Check request quota
+	case requestLimit > 0 && usage.RequestCount >= requestLimit:
+		decision.Allowed = false
+		decision.ExceededType = QuotaTypeRequests
+
+	// Check bytes quota
+	case limit.MonthlyBytesLimit > 0 && usage.BytesTransferred+estimatedBytes > limit.MonthlyBytesLimit:
+		decision.Allowed = false
+		decision.ExceededType = QuotaTypeBytes
+		// Quota remains, just not enough for a request this size
+		decision.RequestTooLarge = usage.BytesTransferred < limit.MonthlyBytesLimit
+
+	// Check concurrent connections
+	case limit.ConcurrentConnections > 0 && activeConns >= limit.ConcurrentConnections:
+		decision.Allowed = false
+		decision.ExceededType = QuotaTypeConnections
+	}
+
+	return decision, nil
 }
 
 // RecordRequest records a request and updates usage
 func (m *Manager) RecordRequest(keyID string, bytesTransferred int64) error {
+	return m.RecordRequestAt(keyID, bytesTransferred, time.Now())
+}
+
+// RecordRequestAt records a request that started at startedAt and updates usage
+// The request counts against the period it started in, even if it completes after a rollover
+func (m *Manager) RecordRequestAt(keyID string, bytesTransferred int64, startedAt time.Time) error {
 	if keyID == "" {
 		return errors.New("key ID cannot be empty")
 	}
 
-	return m.storage.UpdateUsage(keyID, 1, bytesTransferred)
+	periodStart, err := m.periodAt(keyID, m.GetLimit(keyID), startedAt)
+	if err != nil {
+		return err
+	}
+
+	return m.storage.UpdateUsage(keyID, periodStart, 1, bytesTransferred)
+}
+
+// RecordBytesAt charges bytes of a request that started at startedAt and is still in progress
+// The request itself is not counted; RecordRequestAt does that once it completes
+func (m *Manager) RecordBytesAt(keyID string, bytesTransferred int64, startedAt time.Time) error {
+	if keyID == "" {
+		return errors.New("key ID cannot be empty")
+	}
+
+	periodStart, err := m.periodAt(keyID, m.GetLimit(keyID), startedAt)
+	if err != nil {
+		return err
+	}
+
+	return m.storage.UpdateUsage(keyID, periodStart, 0, bytesTransferred)
 }
 
 // AcquireConnection increments the active connection count
@@ -225,25 +520,53 @@ func (m *Manager) ReleaseConnection(keyID string) {
 	}
 }
 
+// ListActiveConnections returns a snapshot of active connection counts by key ID
+// Keys without active connections are omitted
+func (m *Manager) ListActiveConnections() map[string]int {
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+
+	connections := make(map[string]int, len(m.activeConnections))
+	for keyID, count := range m.activeConnections {
+		connections[keyID] = count
+	}
+	return connections
+}
+
 // GetStatus returns the current quota status for an API key
 func (m *Manager) GetStatus(keyID string) (*QuotaStatus, error) {
 	if keyID == "" {
 		return nil, errors.New("key ID cannot be empty")
 	}
 
-	// Get current usage
-	usage, err := m.storage.GetUsage(keyID)
+	// Get quota limit
+	limit := m.GetLimit(keyID)
+
+	// Get usage in the current period
+	usage, err := m.currentUsage(keyID, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get usage: %w", err)
 	}
 
-	// Get quota limit
-	limit := m.GetLimit(keyID)
+	return m.buildStatus(keyID, usage, limit), nil
+}
+
+// effectiveRequestLimit returns the request limit plus any bonus carried into the usage's period
+func effectiveRequestLimit(limit *QuotaLimit, usage *Usage) int64 {
+	if limit.MonthlyRequestLimit <= 0 {
+		return 0
+	}
+	return limit.MonthlyRequestLimit + usage.RolloverRequests
+}
+
+// buildStatus computes the quota status from usage and a limit
+func (m *Manager) buildStatus(keyID string, usage *Usage, limit *QuotaLimit) *QuotaStatus {
+	requestLimit := effectiveRequestLimit(limit, usage)
 
 	// Calculate remaining quota
 	requestRemaining := int64(0)
-	if limit.MonthlyRequestLimit > 0 {
-		requestRemaining = limit.MonthlyRequestLimit - usage.RequestCount
+	if requestLimit > 0 {
+		requestRemaining = requestLimit - usage.RequestCount
 		if requestRemaining < 0 {
 			requestRemaining = 0
 		}
@@ -263,13 +586,14 @@ func (m *Manager) GetStatus(keyID string) (*QuotaStatus, error) {
 	m.connMu.Unlock()
 
 	// Calculate period end
-	periodEnd := getMonthEnd(usage.PeriodStart)
+	period := m.periodFor(limit)
+	periodEnd := period.End(usage.PeriodStart)
 
 	// Check if quota is exceeded
 	quotaExceeded := false
 	quotaExceededReason := ""
 
-	if limit.MonthlyRequestLimit > 0 && usage.RequestCount >= limit.MonthlyRequestLimit {
+	if requestLimit > 0 && usage.RequestCount >= requestLimit {
 		quotaExceeded = true
 		quotaExceededReason = "Monthly request quota exceeded"
 	} else if limit.MonthlyBytesLimit > 0 && usage.BytesTransferred >= limit.MonthlyBytesLimit {
@@ -278,20 +602,22 @@ func (m *Manager) GetStatus(keyID string) (*QuotaStatus, error) {
 	}
 
 	return &QuotaStatus{
-		KeyID:                keyID,
-		RequestCount:         usage.RequestCount,
-		RequestLimit:         limit.MonthlyRequestLimit,
-		RequestRemaining:     requestRemaining,
-		BytesTransferred:     usage.BytesTransferred,
-		BytesLimit:           limit.MonthlyBytesLimit,
-		BytesRemaining:       bytesRemaining,
-		ActiveConnections:    activeConns,
-		ConcurrentConnLimit:  limit.ConcurrentConnections,
-		PeriodStart:          usage.PeriodStart,
-		PeriodEnd:            periodEnd,
-		QuotaExceeded:        quotaExceeded,
-		QuotaExceededReason:  quotaExceededReason,
-	}, nil
+		KeyID:               keyID,
+		RequestCount:        usage.RequestCount,
+		RequestLimit:        limit.MonthlyRequestLimit,
+		RequestRemaining:    requestRemaining,
+		RolloverRequests:    usage.RolloverRequests,
+		BytesTransferred:    usage.BytesTransferred,
+		BytesLimit:          limit.MonthlyBytesLimit,
+		BytesRemaining:      bytesRemaining,
+		ActiveConnections:   activeConns,
+		ConcurrentConnLimit: limit.ConcurrentConnections,
+		Period:              period.String(),
+		PeriodStart:         usage.PeriodStart,
+		PeriodEnd:           periodEnd,
+		QuotaExceeded:       quotaExceeded,
+		QuotaExceededReason: quotaExceededReason,
+	}
 }
 
 // ResetQuota resets quota for an API key
@@ -300,7 +626,8 @@ func (m *Manager) ResetQuota(keyID string) error {
 		return errors.New("key ID cannot be empty")
 	}
 
-	return m.storage.ResetUsage(keyID)
+	periodStart := m.periodFor(m.GetLimit(keyID)).Start(time.Now())
+	return m.storage.ResetUsage(keyID, periodStart)
 }
 
 // Close closes the quota manager
@@ -310,8 +637,3 @@ func (m *Manager) Close() error {
 	}
 	return nil
 }
-
-// getMonthEnd returns the end of the month
-func getMonthEnd(periodStart time.Time) time.Time {
-	return periodStart.AddDate(0, 1, 0).Add(-time.Second)
-}
@@ -1,9 +1,11 @@
 package quota
 
 import (
+	"errors"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestNewManager tests creating a new quota manager
@@ -82,6 +84,47 @@ func TestSetLimit(t *testing.T) {
 	}
 }
 
+// TestSetLimits tests setting several limits at once
+func TestSetLimits(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000000, 107374182400, 100)
+	existing := &QuotaLimit{KeyID: "key-a", MonthlyRequestLimit: 100}
+	manager.SetLimit(existing)
+
+	previous, err := manager.SetLimits([]*QuotaLimit{
+		{KeyID: "key-a", MonthlyRequestLimit: 5000},
+		{KeyID: "key-b", MonthlyRequestLimit: 5000},
+	})
+	if err != nil {
+		t.Fatalf("Failed to set limits: %v", err)
+	}
+	if len(previous) != 2 || previous[0] != existing || previous[1] != nil {
+		t.Errorf("Expected the replaced limits to be returned, got %v", previous)
+	}
+	for _, keyID := range []string{"key-a", "key-b"} {
+		if limit := manager.GetLimit(keyID); limit.MonthlyRequestLimit != 5000 {
+			t.Errorf("Expected %s to have request limit 5000, got %d", keyID, limit.MonthlyRequestLimit)
+		}
+	}
+
+	// One invalid limit keeps the others from being applied
+	_, err = manager.SetLimits([]*QuotaLimit{
+		{KeyID: "key-a", MonthlyRequestLimit: 9000},
+		{KeyID: "key-b", MonthlyRequestLimit: 9000, RolloverPercent: -1},
+	})
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected ErrInvalidLimit, got %v", err)
+	}
+	if limit := manager.GetLimit("key-a"); limit.MonthlyRequestLimit != 5000 {
+		t.Errorf("Expected key-a to keep request limit 5000, got %d", limit.MonthlyRequestLimit)
+	}
+}
+
 // TestSetLimitInvalid tests error handling for invalid limits
 func TestSetLimitInvalid(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -249,7 +292,7 @@ func TestCheckQuota(t *testing.T) {
 	}
 
 	// Add usage close to limit
-	storage.UpdateUsage("test-key", 999, 9000)
+	storage.UpdateUsage("test-key", thisMonth(), 999, 9000)
 
 	// Should still pass
 	err = manager.CheckQuota("test-key", 1024)
@@ -258,7 +301,7 @@ func TestCheckQuota(t *testing.T) {
 	}
 
 	// Add one more to exceed request quota
-	storage.UpdateUsage("test-key", 1, 0)
+	storage.UpdateUsage("test-key", thisMonth(), 1, 0)
 
 	// Should fail
 	err = manager.CheckQuota("test-key", 1024)
@@ -267,6 +310,109 @@ func TestCheckQuota(t *testing.T) {
 	}
 }
 
+// TestDecide tests the structured quota decision for each limit type
+func TestDecide(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 2)
+
+	tests := []struct {
+		name            string
+		setup           func()
+		estimatedBytes  int64
+		wantType        string
+		wantTooLarge    bool
+		wantErr         error
+		wantBytesRemain int64
+	}{
+		{
+			name:            "allowed",
+			estimatedBytes:  1024,
+			wantBytesRemain: 10240,
+		},
+		{
+			name:            "request too large",
+			setup:           func() { storage.UpdateUsage("test-key", thisMonth(), 1, 9000) },
+			estimatedBytes:  2000,
+			wantType:        QuotaTypeBytes,
+			wantTooLarge:    true,
+			wantErr:         ErrRequestTooLarge,
+			wantBytesRemain: 1240,
+		},
+		{
+			name: "connections",
+			setup: func() {
+				manager.AcquireConnection("test-key")
+				manager.AcquireConnection("test-key")
+			},
+			estimatedBytes:  100,
+			wantType:        QuotaTypeConnections,
+			wantErr:         ErrConnectionLimit,
+			wantBytesRemain: 1240,
+		},
+		{
+			name:            "bytes exhausted",
+			setup:           func() { storage.UpdateUsage("test-key", thisMonth(), 1, 1240) },
+			estimatedBytes:  1,
+			wantType:        QuotaTypeBytes,
+			wantErr:         ErrBytesQuotaExceeded,
+			wantBytesRemain: 0,
+		},
+		{
+			name:     "requests",
+			setup:    func() { storage.UpdateUsage("test-key", thisMonth(), 998, 0) },
+			wantType: QuotaTypeRequests,
+			wantErr:  ErrRequestQuotaExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.setup != nil {
+				tt.setup()
+			}
+
+			decision, err := manager.Decide("test-key", tt.estimatedBytes)
+			if err != nil {
+				t.Fatalf("Decide failed: %v", err)
+			}
+
+			if decision.Allowed != (tt.wantType == "") {
+				t.Errorf("Expected Allowed %v, got %v", tt.wantType == "", decision.Allowed)
+			}
+			if decision.ExceededType != tt.wantType {
+				t.Errorf("Expected ExceededType %q, got %q", tt.wantType, decision.ExceededType)
+			}
+			if decision.RequestTooLarge != tt.wantTooLarge {
+				t.Errorf("Expected RequestTooLarge %v, got %v", tt.wantTooLarge, decision.RequestTooLarge)
+			}
+			if tt.wantType != QuotaTypeRequests && decision.BytesRemaining != tt.wantBytesRemain {
+				t.Errorf("Expected BytesRemaining %d, got %d", tt.wantBytesRemain, decision.BytesRemaining)
+			}
+
+			// CheckQuota reports the same outcome as an error
+			checkErr := manager.CheckQuota("test-key", tt.estimatedBytes)
+			if tt.wantErr == nil {
+				if checkErr != nil || decision.Err() != nil {
+					t.Errorf("Expected no error, got %v / %v", checkErr, decision.Err())
+				}
+				return
+			}
+			if !errors.Is(checkErr, tt.wantErr) || !errors.Is(decision.Err(), tt.wantErr) {
+				t.Errorf("Expected %v, got %v / %v", tt.wantErr, checkErr, decision.Err())
+			}
+		})
+	}
+
+	if _, err := manager.Decide("", 0); err == nil {
+		t.Error("Expected error for empty key ID")
+	}
+}
+
 // TestCheckQuotaBytes tests bytes quota checking
 func TestCheckQuotaBytes(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -281,7 +427,7 @@ func TestCheckQuotaBytes(t *testing.T) {
 	manager := NewManager(storage, 1000000, 10240, 5)
 
 	// Add usage close to bytes limit
-	storage.UpdateUsage("test-key", 100, 9000)
+	storage.UpdateUsage("test-key", thisMonth(), 100, 9000)
 
 	// Check with bytes that would exceed limit
 	err = manager.CheckQuota("test-key", 2000)
@@ -292,6 +438,18 @@ func TestCheckQuotaBytes(t *testing.T) {
 	if !strings.Contains(err.Error(), "bytes") {
 		t.Errorf("Expected bytes quota error, got: %v", err)
 	}
+
+	// Quota remains, so the request is rejected for its size
+	if !errors.Is(err, ErrBytesQuotaExceeded) || !errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("Expected ErrBytesQuotaExceeded and ErrRequestTooLarge, got: %v", err)
+	}
+
+	// Once the quota is used up, any request is rejected
+	storage.UpdateUsage("test-key", thisMonth(), 1, 2000)
+	err = manager.CheckQuota("test-key", 1)
+	if !errors.Is(err, ErrBytesQuotaExceeded) || errors.Is(err, ErrRequestTooLarge) {
+		t.Errorf("Expected only ErrBytesQuotaExceeded, got: %v", err)
+	}
 }
 
 // TestRecordRequest tests recording requests
@@ -314,7 +472,7 @@ func TestRecordRequest(t *testing.T) {
 	}
 
 	// Verify usage
-	usage, err := storage.GetUsage("test-key")
+	usage, err := storage.GetUsage("test-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to get usage: %v", err)
 	}
@@ -328,6 +486,52 @@ func TestRecordRequest(t *testing.T) {
 	}
 }
 
+// TestRecordRequestAtPeriodBoundary tests that a request counts against the period it started in
+func TestRecordRequestAtPeriodBoundary(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 100, 0, 0)
+	manager.SetLimit(&QuotaLimit{KeyID: "test-key", MonthlyRequestLimit: 100, RolloverPercent: 50})
+
+	lastMonthEnd := thisMonth().Add(-time.Millisecond)
+	if err := manager.RecordRequestAt("test-key", 100, lastMonthEnd); err != nil {
+		t.Fatalf("Failed to record request: %v", err)
+	}
+
+	// A request started this month rolls the period over
+	if err := manager.RecordRequest("test-key", 10); err != nil {
+		t.Fatalf("Failed to record request: %v", err)
+	}
+
+	// A request started just before the boundary completes after it
+	if err := manager.RecordRequestAt("test-key", 100, lastMonthEnd); err != nil {
+		t.Fatalf("Failed to record request: %v", err)
+	}
+
+	status, err := manager.GetStatus("test-key")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.RequestCount != 1 || status.BytesTransferred != 10 {
+		t.Errorf("Expected 1 request and 10 bytes this month, got %d and %d", status.RequestCount, status.BytesTransferred)
+	}
+	if status.RolloverRequests != 49 {
+		t.Errorf("Expected 49 rollover requests, got %d", status.RolloverRequests)
+	}
+
+	previous, err := storage.GetUsage("test-key", thisMonth().AddDate(0, -1, 0))
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if previous.RequestCount != 2 || previous.BytesTransferred != 200 {
+		t.Errorf("Expected 2 requests and 200 bytes last month, got %d and %d", previous.RequestCount, previous.BytesTransferred)
+	}
+}
+
 // TestAcquireReleaseConnection tests connection tracking
 func TestAcquireReleaseConnection(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -365,6 +569,47 @@ func TestAcquireReleaseConnection(t *testing.T) {
 	}
 }
 
+// TestListActiveConnections tests the active connection snapshot
+func TestListActiveConnections(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000000, 107374182400, 10)
+
+	if got := manager.ListActiveConnections(); len(got) != 0 {
+		t.Errorf("Expected no active connections, got %v", got)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := manager.AcquireConnection("key-a"); err != nil {
+			t.Fatalf("Failed to acquire connection: %v", err)
+		}
+	}
+	if err := manager.AcquireConnection("key-b"); err != nil {
+		t.Fatalf("Failed to acquire connection: %v", err)
+	}
+
+	connections := manager.ListActiveConnections()
+	if connections["key-a"] != 2 || connections["key-b"] != 1 {
+		t.Errorf("Expected key-a=2 key-b=1, got %v", connections)
+	}
+
+	// The snapshot is a copy
+	connections["key-a"] = 100
+	if manager.ListActiveConnections()["key-a"] != 2 {
+		t.Error("Modifying the snapshot changed the manager state")
+	}
+
+	// Fully released keys are omitted
+	manager.ReleaseConnection("key-b")
+	if _, ok := manager.ListActiveConnections()["key-b"]; ok {
+		t.Error("Expected key-b to be omitted after release")
+	}
+}
+
 // TestGetStatus tests getting quota status
 func TestGetStatus(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -379,7 +624,7 @@ func TestGetStatus(t *testing.T) {
 	manager := NewManager(storage, 1000, 10240, 5)
 
 	// Add some usage
-	storage.UpdateUsage("test-key", 250, 2560)
+	storage.UpdateUsage("test-key", thisMonth(), 250, 2560)
 
 	// Get status
 	status, err := manager.GetStatus("test-key")
@@ -418,7 +663,7 @@ func TestGetStatusExceeded(t *testing.T) {
 	manager := NewManager(storage, 1000, 10240, 5)
 
 	// Add usage exceeding limit
-	storage.UpdateUsage("test-key", 1001, 2560)
+	storage.UpdateUsage("test-key", thisMonth(), 1001, 2560)
 
 	// Get status
 	status, err := manager.GetStatus("test-key")
@@ -435,6 +680,173 @@ func TestGetStatusExceeded(t *testing.T) {
 	}
 }
 
+// TestChangePlan tests changing limits while keeping usage
+func TestChangePlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 5)
+
+	// Exceed the default request limit
+	storage.UpdateUsage("test-key", thisMonth(), 1200, 2560)
+
+	status, err := manager.ChangePlan("test-key", &QuotaLimit{
+		MonthlyRequestLimit:   5000,
+		MonthlyBytesLimit:     20480,
+		ConcurrentConnections: 10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to change plan: %v", err)
+	}
+
+	// Usage is preserved and remaining is recomputed against the new limit
+	if status.RequestCount != 1200 {
+		t.Errorf("Expected RequestCount 1200, got %d", status.RequestCount)
+	}
+
+	if status.RequestLimit != 5000 || status.RequestRemaining != 3800 {
+		t.Errorf("Expected 3800/5000 requests remaining, got %d/%d", status.RequestRemaining, status.RequestLimit)
+	}
+
+	if status.QuotaExceeded {
+		t.Error("Quota should no longer be exceeded after upgrade")
+	}
+
+	if limit := manager.GetLimit("test-key"); limit.MonthlyRequestLimit != 5000 || limit.KeyID != "test-key" {
+		t.Errorf("Expected stored limit of 5000 for test-key, got %+v", limit)
+	}
+}
+
+// TestChangePlanInvalid tests ChangePlan validation
+func TestChangePlanInvalid(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 5)
+
+	if _, err := manager.ChangePlan("test-key", nil); err == nil {
+		t.Error("Expected error for nil limit")
+	}
+
+	if _, err := manager.ChangePlan("", &QuotaLimit{MonthlyRequestLimit: 10}); err == nil {
+		t.Error("Expected error for empty key ID")
+	}
+
+	if _, err := manager.ChangePlan("test-key", &QuotaLimit{KeyID: "other-key"}); err == nil {
+		t.Error("Expected error for mismatched key ID")
+	}
+
+	if _, err := manager.ChangePlan("test-key", &QuotaLimit{MonthlyRequestLimit: -1}); err != ErrInvalidLimit {
+		t.Errorf("Expected ErrInvalidLimit, got %v", err)
+	}
+
+	// Failed changes leave the default limit in place
+	if limit := manager.GetLimit("test-key"); limit.MonthlyRequestLimit != 1000 {
+		t.Errorf("Expected default limit 1000, got %d", limit.MonthlyRequestLimit)
+	}
+}
+
+// TestGetStatusWeeklyPeriod tests that status reflects a per-key period
+func TestGetStatusWeeklyPeriod(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 5)
+	manager.SetLimit(&QuotaLimit{
+		KeyID:               "weekly-key",
+		MonthlyRequestLimit: 10,
+		Period:              PeriodWeekly,
+	})
+
+	// Usage from earlier in the month but a previous week is not counted
+	weekStart := WeeklyPeriod{}.Start(time.Now())
+	storage.UpdateUsage("weekly-key", weekStart.AddDate(0, 0, -7), 10, 0)
+
+	if err := manager.CheckQuota("weekly-key", 0); err != nil {
+		t.Errorf("Expected last week's usage to be ignored, got: %v", err)
+	}
+
+	if err := manager.RecordRequest("weekly-key", 100); err != nil {
+		t.Fatalf("Failed to record request: %v", err)
+	}
+
+	status, err := manager.GetStatus("weekly-key")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+
+	if status.Period != PeriodWeekly {
+		t.Errorf("Expected weekly period, got %q", status.Period)
+	}
+
+	if !status.PeriodStart.Equal(weekStart) {
+		t.Errorf("Expected period start %v, got %v", weekStart, status.PeriodStart)
+	}
+
+	if expected := weekStart.AddDate(0, 0, 7).Add(-time.Second); !status.PeriodEnd.Equal(expected) {
+		t.Errorf("Expected period end %v, got %v", expected, status.PeriodEnd)
+	}
+
+	if status.RequestCount != 1 {
+		t.Errorf("Expected 1 request this week, got %d", status.RequestCount)
+	}
+}
+
+// TestSetLimitInvalidPeriod tests that unknown periods are rejected
+func TestSetLimitInvalidPeriod(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 5)
+	err = manager.SetLimit(&QuotaLimit{KeyID: "test-key", Period: "yearly"})
+	if !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected ErrInvalidLimit, got: %v", err)
+	}
+}
+
+// TestDefaultPeriod tests the manager-wide default period
+func TestDefaultPeriod(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 5)
+	manager.SetDefaultPeriod(QuarterlyPeriod{})
+
+	status, err := manager.GetStatus("test-key")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+
+	if status.Period != PeriodQuarterly {
+		t.Errorf("Expected quarterly period, got %q", status.Period)
+	}
+
+	if expected := (QuarterlyPeriod{}).Start(time.Now()); !status.PeriodStart.Equal(expected) {
+		t.Errorf("Expected period start %v, got %v", expected, status.PeriodStart)
+	}
+}
+
 // TestResetQuota tests resetting quota
 func TestResetQuota(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -449,7 +861,7 @@ func TestResetQuota(t *testing.T) {
 	manager := NewManager(storage, 1000000, 107374182400, 100)
 
 	// Add some usage
-	storage.UpdateUsage("test-key", 500, 5120)
+	storage.UpdateUsage("test-key", thisMonth(), 500, 5120)
 
 	// Reset quota
 	err = manager.ResetQuota("test-key")
@@ -458,7 +870,7 @@ func TestResetQuota(t *testing.T) {
 	}
 
 	// Verify usage is reset
-	usage, err := storage.GetUsage("test-key")
+	usage, err := storage.GetUsage("test-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to get usage: %v", err)
 	}
@@ -467,3 +879,144 @@ func TestResetQuota(t *testing.T) {
 		t.Errorf("Expected RequestCount 0 after reset, got %d", usage.RequestCount)
 	}
 }
+
+// TestRolloverPercent tests that unused requests from the previous period become bonus capacity
+func TestRolloverPercent(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 5)
+	manager.SetLimit(&QuotaLimit{
+		KeyID:               "rollover-key",
+		MonthlyRequestLimit: 100,
+		RolloverPercent:     50,
+	})
+
+	// 40 of last month's 100 requests were used, so half of the remaining 60 carries over
+	storage.UpdateUsage("rollover-key", thisMonth().AddDate(0, -1, 0), 40, 0)
+
+	status, err := manager.GetStatus("rollover-key")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+
+	if status.RolloverRequests != 30 {
+		t.Errorf("Expected 30 rollover requests, got %d", status.RolloverRequests)
+	}
+	if status.RequestLimit != 100 {
+		t.Errorf("Expected request limit 100, got %d", status.RequestLimit)
+	}
+	if status.RequestRemaining != 130 {
+		t.Errorf("Expected 130 requests remaining, got %d", status.RequestRemaining)
+	}
+
+	// The base allowance is exhausted but the bonus is not
+	storage.UpdateUsage("rollover-key", thisMonth(), 100, 0)
+	if err := manager.CheckQuota("rollover-key", 0); err != nil {
+		t.Errorf("Expected bonus requests to be available, got: %v", err)
+	}
+
+	storage.UpdateUsage("rollover-key", thisMonth(), 30, 0)
+	decision, err := manager.Decide("rollover-key", 0)
+	if err != nil {
+		t.Fatalf("Failed to decide: %v", err)
+	}
+	if decision.Allowed || decision.ExceededType != QuotaTypeRequests {
+		t.Errorf("Expected request quota exceeded after using the bonus, got %+v", decision)
+	}
+	if decision.RequestLimit != 130 {
+		t.Errorf("Expected decision request limit 130, got %d", decision.RequestLimit)
+	}
+
+	// The bonus is computed once per period
+	status, _ = manager.GetStatus("rollover-key")
+	if status.RolloverRequests != 30 || status.RequestCount != 130 {
+		t.Errorf("Expected 130 requests against a 30 request bonus, got %d and %d", status.RequestCount, status.RolloverRequests)
+	}
+}
+
+// TestRolloverIdlePeriod tests that a key idle for the whole previous period rolls over its full allowance
+func TestRolloverIdlePeriod(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 1000, 10240, 5)
+	manager.SetLimit(&QuotaLimit{
+		KeyID:               "idle-key",
+		MonthlyRequestLimit: 100,
+		RolloverPercent:     20,
+	})
+	manager.SetLimit(&QuotaLimit{
+		KeyID:               "new-key",
+		MonthlyRequestLimit: 100,
+		RolloverPercent:     20,
+	})
+
+	storage.UpdateUsage("idle-key", thisMonth().AddDate(0, -2, 0), 90, 0)
+
+	if err := manager.RecordRequest("idle-key", 0); err != nil {
+		t.Fatalf("Failed to record request: %v", err)
+	}
+
+	status, err := manager.GetStatus("idle-key")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.RolloverRequests != 20 {
+		t.Errorf("Expected 20 rollover requests, got %d", status.RolloverRequests)
+	}
+	if status.RequestCount != 1 {
+		t.Errorf("Expected 1 request this month, got %d", status.RequestCount)
+	}
+
+	// Keys without earlier usage have nothing to carry over
+	status, err = manager.GetStatus("new-key")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.RolloverRequests != 0 {
+		t.Errorf("Expected no rollover for a new key, got %d", status.RolloverRequests)
+	}
+}
+
+// TestRolloverDisabled tests that unused requests are dropped without a rollover percent
+func TestRolloverDisabled(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	manager := NewManager(storage, 100, 10240, 5)
+	storage.UpdateUsage("test-key", thisMonth().AddDate(0, -1, 0), 10, 0)
+
+	if err := manager.RecordRequest("test-key", 0); err != nil {
+		t.Fatalf("Failed to record request: %v", err)
+	}
+
+	status, err := manager.GetStatus("test-key")
+	if err != nil {
+		t.Fatalf("Failed to get status: %v", err)
+	}
+	if status.RolloverRequests != 0 || status.RequestRemaining != 99 {
+		t.Errorf("Expected no rollover and 99 requests remaining, got %d and %d", status.RolloverRequests, status.RequestRemaining)
+	}
+}
+
+// TestSetLimitInvalidRollover tests that rollover percentages outside 0-100 are rejected
+func TestSetLimitInvalidRollover(t *testing.T) {
+	manager := NewManager(nil, 1000, 10240, 5)
+
+	for _, percent := range []int{-1, 101} {
+		err := manager.SetLimit(&QuotaLimit{KeyID: "test-key", MonthlyRequestLimit: 10, RolloverPercent: percent})
+		if !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("Expected ErrInvalidLimit for %d%%, got %v", percent, err)
+		}
+	}
+}
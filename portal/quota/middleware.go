@@ -1,12 +1,19 @@
 package quota
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/portal-project/portal-gateway/portal/problem"
 )
 
+// streamChargeBytes is how much a stream may send between charges when it is not flushed
+const streamChargeBytes = 64 << 10
+
 // contextKey is a custom type for context keys to avoid collisions
 type contextKey string
 
@@ -20,25 +27,72 @@ type APIKeyInfo struct {
 	KeyID string
 }
 
+// ExceededRecorder records rejected requests by quota type, e.g. metrics.MetricsMiddleware
+type ExceededRecorder interface {
+	RecordQuotaExceeded(keyID, quotaType string)
+}
+
+// RejectionRecorder is told about requests a limiting layer turns away, e.g. saturation.Tracker
+type RejectionRecorder interface {
+	RecordRejection(reason string)
+}
+
+// Bypass decides whether a request skips quota enforcement, e.g. middleware.LimitBypass
+type Bypass interface {
+	Bypasses(r *http.Request, limit string) bool
+}
+
 // QuotaMiddleware provides quota enforcement middleware
 type QuotaMiddleware struct {
-	manager *Manager
+	manager   *Manager
+	recorder  ExceededRecorder
+	rejection RejectionRecorder
+	bypass    Bypass
+}
+
+// MiddlewareConfig holds quota middleware configuration
+type MiddlewareConfig struct {
+	// Manager decides and records quota usage (required)
+	Manager *Manager
+
+	// ExceededRecorder is told which quota rejected a request (nil = none)
+	ExceededRecorder ExceededRecorder
+
+	// Rejections is told about requests turned away over quota, e.g. saturation.Tracker (nil = none)
+	Rejections RejectionRecorder
+
+	// Bypass selects requests that skip quota enforcement (nil = none)
+	Bypass Bypass
 }
 
 // NewQuotaMiddleware creates a new quota middleware
 func NewQuotaMiddleware(manager *Manager) *QuotaMiddleware {
-	if manager == nil {
+	return NewQuotaMiddlewareWithConfig(&MiddlewareConfig{Manager: manager})
+}
+
+// NewQuotaMiddlewareWithConfig creates a new quota middleware from a configuration
+func NewQuotaMiddlewareWithConfig(config *MiddlewareConfig) *QuotaMiddleware {
+	if config == nil || config.Manager == nil {
 		panic("quota manager cannot be nil")
 	}
 
 	return &QuotaMiddleware{
-		manager: manager,
+		manager:   config.Manager,
+		recorder:  config.ExceededRecorder,
+		rejection: config.Rejections,
+		bypass:    config.Bypass,
 	}
 }
 
 // Middleware returns an http.Handler that enforces quota limits
 func (m *QuotaMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Bypassed requests neither consume nor are blocked by quota
+		if m.bypass != nil && m.bypass.Bypasses(r, "quota") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Get API key from context
 		apiKeyInfo := getAPIKeyInfo(r.Context())
 		if apiKeyInfo == nil {
@@ -48,19 +102,45 @@ func (m *QuotaMiddleware) Middleware(next http.Handler) http.Handler {
 		}
 
 		keyID := apiKeyInfo.KeyID
+		accounting := m.manager.ByteAccounting()
+
+		// Usage is attributed to the period the request started in
+		startedAt := time.Now()
 
-		// Estimate request size (content-length if available, otherwise use default)
+		// Estimate request size (content-length if it counts and is available, otherwise use default)
 		estimatedBytes := int64(1024) // Default: 1 KB
-		if r.ContentLength > 0 {
+		if r.ContentLength > 0 && accounting.CountsIngress() {
 			estimatedBytes = r.ContentLength
 		}
 
-		// Check quota before processing request
-		if err := m.manager.CheckQuota(keyID, estimatedBytes); err != nil {
-			m.handleQuotaExceeded(w, keyID, err)
+		// Check quota before the body is read, so oversized uploads are never transferred
+		decision, err := m.manager.Decide(keyID, estimatedBytes)
+		if err != nil {
+			m.handleQuotaExceeded(w, r, keyID, "", err)
+			return
+		}
+		if !decision.Allowed {
+			if m.recorder != nil {
+				m.recorder.RecordQuotaExceeded(keyID, decision.ExceededType)
+			}
+			if decision.RequestTooLarge && r.ContentLength > 0 && accounting.CountsIngress() {
+				m.handleRequestTooLarge(w, r, keyID, r.ContentLength)
+				return
+			}
+			if m.rejection != nil {
+				m.rejection.RecordRejection("quota")
+			}
+			m.handleQuotaExceeded(w, r, keyID, decision.ExceededType, decision.Err())
 			return
 		}
 
+		// Count the request body bytes the handler actually reads
+		var body *countingReadCloser
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReadCloser{ReadCloser: r.Body}
+			r.Body = body
+		}
+
 		// Wrap response writer to capture response size
 		wrapped := &responseWriter{
 			ResponseWriter: w,
@@ -68,16 +148,38 @@ func (m *QuotaMiddleware) Middleware(next http.Handler) http.Handler {
 			bytesWritten:   0,
 		}
 
-		// Process request
+		// Streamed responses may be charged as they are sent, so a long stream is cut off
+		// once it exhausts the byte quota instead of overrunning it until it closes
+		if accounting.CountsEgress() && m.manager.StreamAccounting() == StreamAccountingIncremental {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			r = r.WithContext(ctx)
+			wrapped.stream = &streamMeter{
+				manager:   m.manager,
+				keyID:     keyID,
+				startedAt: startedAt,
+				cancel:    cancel,
+			}
+		}
+
+		// Process request; streaming responses are complete once the handler returns
 		next.ServeHTTP(wrapped, r)
 
-		// Record request after successful completion
-		totalBytes := r.ContentLength + int64(wrapped.bytesWritten)
-		if totalBytes < 0 {
-			totalBytes = int64(wrapped.bytesWritten)
+		// Record request after completion with the bytes actually transferred
+		// A stream counts as one request, and bytes already charged while it ran are not charged again
+		var ingress int64
+		if body != nil {
+			ingress = body.bytesRead
+		}
+		totalBytes := accounting.Total(ingress, wrapped.bytesWritten)
+		if wrapped.stream != nil {
+			totalBytes -= wrapped.stream.charged
+			if wrapped.stream.exhausted && m.recorder != nil {
+				m.recorder.RecordQuotaExceeded(keyID, QuotaTypeBytes)
+			}
 		}
 
-		if err := m.manager.RecordRequest(keyID, totalBytes); err != nil {
+		if err := m.manager.RecordRequestAt(keyID, totalBytes, startedAt); err != nil {
 			// Log error but don't fail the request
 			// TODO: Add proper logging
 		}
@@ -88,7 +190,8 @@ func (m *QuotaMiddleware) Middleware(next http.Handler) http.Handler {
 }
 
 // handleQuotaExceeded handles quota exceeded responses
-func (m *QuotaMiddleware) handleQuotaExceeded(w http.ResponseWriter, keyID string, err error) {
+// quotaType names the limit that was hit and is empty when the check itself failed
+func (m *QuotaMiddleware) handleQuotaExceeded(w http.ResponseWriter, r *http.Request, keyID, quotaType string, err error) {
 	status, _ := m.manager.GetStatus(keyID)
 
 	// Calculate retry-after (seconds until period end)
@@ -101,7 +204,6 @@ func (m *QuotaMiddleware) handleQuotaExceeded(w http.ResponseWriter, keyID strin
 	}
 
 	// Add headers
-	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 
 	if status != nil {
@@ -112,17 +214,32 @@ func (m *QuotaMiddleware) handleQuotaExceeded(w http.ResponseWriter, keyID strin
 		w.Header().Set("X-Quota-Reset", strconv.FormatInt(status.PeriodEnd.Unix(), 10))
 	}
 
-	w.WriteHeader(http.StatusTooManyRequests)
-
 	// Determine error message
-	errorType := "quota_exceeded"
 	errorMessage := err.Error()
 
 	if status != nil && status.QuotaExceededReason != "" {
 		errorMessage = status.QuotaExceededReason
 	}
 
-	fmt.Fprintf(w, `{"error":"%s","message":"%s","retry_after":%d}`, errorType, errorMessage, retryAfter)
+	fields := map[string]any{"retry_after": retryAfter}
+	if quotaType != "" {
+		fields["quota_type"] = quotaType
+	}
+	problem.WriteWithFields(w, r, http.StatusTooManyRequests, "quota_exceeded", errorMessage, fields)
+}
+
+// handleRequestTooLarge rejects a request whose declared body exceeds the remaining byte quota
+// Smaller requests may still succeed, so no Retry-After is sent
+func (m *QuotaMiddleware) handleRequestTooLarge(w http.ResponseWriter, r *http.Request, keyID string, contentLength int64) {
+	bytesRemaining := int64(0)
+	if status, err := m.manager.GetStatus(keyID); err == nil {
+		bytesRemaining = status.BytesRemaining
+		m.addQuotaHeaders(w, keyID)
+	}
+
+	// Close the connection instead of draining the unread body
+	w.Header().Set("Connection", "close")
+	problem.WriteWithFields(w, r, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("Request body of %d bytes exceeds remaining data transfer quota", contentLength), map[string]any{"bytes_remaining": bytesRemaining})
 }
 
 // addQuotaHeaders adds quota information to response headers
@@ -194,16 +311,79 @@ func getAPIKeyInfo(ctx interface{}) *APIKeyInfo {
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode   int
-	bytesWritten int
+	bytesWritten int64
+	stream       *streamMeter // Set with incremental stream accounting
+}
+
+// streamMeter charges the bytes of a streamed response while it is being sent
+type streamMeter struct {
+	manager   *Manager
+	keyID     string
+	startedAt time.Time
+	cancel    context.CancelFunc
+	streaming bool  // Flushed, or sent as an event stream
+	charged   int64 // Response bytes already recorded
+	exhausted bool  // Cut off after running out of byte quota
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
+	if rw.stream != nil && strings.HasPrefix(rw.Header().Get("Content-Type"), "text/event-stream") {
+		rw.stream.streaming = true
+	}
 	rw.ResponseWriter.WriteHeader(code)
 }
 
 func (rw *responseWriter) Write(b []byte) (int, error) {
+	if rw.stream != nil && rw.stream.exhausted {
+		return 0, ErrBytesQuotaExceeded
+	}
+
 	n, err := rw.ResponseWriter.Write(b)
-	rw.bytesWritten += n
+	rw.bytesWritten += int64(n)
+	if rw.stream != nil && rw.stream.streaming && rw.bytesWritten-rw.stream.charged >= streamChargeBytes {
+		rw.charge()
+	}
 	return n, err
 }
+
+// Flush implements http.Flusher; with incremental stream accounting, each flush charges
+// the bytes sent since the last one
+func (rw *responseWriter) Flush() {
+	if rw.stream != nil && rw.stream.exhausted {
+		return
+	}
+
+	http.NewResponseController(rw.ResponseWriter).Flush()
+	if rw.stream != nil {
+		rw.stream.streaming = true
+		rw.charge()
+	}
+}
+
+// charge records the stream's uncharged bytes and cuts it off once the byte quota is used up
+// The request's context is cancelled, so the handler stops reading from the upstream
+func (rw *responseWriter) charge() {
+	s := rw.stream
+	n := rw.bytesWritten - s.charged
+	if n <= 0 {
+		return
+	}
+
+	if err := s.manager.RecordBytesAt(s.keyID, n, s.startedAt); err != nil {
+		// Charged again at the next flush or once the stream ends
+		return
+	}
+	s.charged += n
+
+	status, err := s.manager.GetStatus(s.keyID)
+	if err == nil && status.BytesLimit > 0 && status.BytesRemaining <= 0 {
+		s.exhausted = true
+		s.cancel()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
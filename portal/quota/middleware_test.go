@@ -0,0 +1,399 @@
+package quota
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestMiddleware creates a quota middleware with the given byte limit for "test-key"
+func newTestMiddleware(t *testing.T, bytesLimit int64) (*QuotaMiddleware, *SQLiteStorage) {
+	t.Helper()
+	return newTestMiddlewareWithConfig(t, bytesLimit, &MiddlewareConfig{})
+}
+
+// newTestMiddlewareWithConfig is newTestMiddleware with the rest of the configuration set
+func newTestMiddlewareWithConfig(t *testing.T, bytesLimit int64, config *MiddlewareConfig) (*QuotaMiddleware, *SQLiteStorage) {
+	t.Helper()
+
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { storage.Close() })
+
+	config.Manager = NewManager(storage, 1000, bytesLimit, 10)
+	return NewQuotaMiddlewareWithConfig(config), storage
+}
+
+// newQuotaRequest creates a POST request for "test-key" with the given body
+func newQuotaRequest(body string) *http.Request {
+	req := httptest.NewRequest("POST", "/peer/lease", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "test-key"})
+	return req.WithContext(ctx)
+}
+
+func TestMiddlewareRejectsOversizedBody(t *testing.T) {
+	m, storage := newTestMiddleware(t, 10000)
+	storage.UpdateUsage("test-key", thisMonth(), 1, 9000)
+
+	bodyRead := false
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bodyRead = true
+		io.Copy(io.Discard, r.Body)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newQuotaRequest(strings.Repeat("x", 2000)))
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rr.Code)
+	}
+
+	if bodyRead {
+		t.Error("Expected handler not to be called")
+	}
+
+	if rr.Header().Get("Connection") != "close" {
+		t.Errorf("Expected Connection close, got %q", rr.Header().Get("Connection"))
+	}
+
+	if rr.Header().Get("X-Quota-Remaining-Bytes") != "1000" {
+		t.Errorf("Expected 1000 remaining bytes, got %q", rr.Header().Get("X-Quota-Remaining-Bytes"))
+	}
+
+	// Nothing is recorded for a rejected request
+	usage, _ := storage.GetUsage("test-key", thisMonth())
+	if usage.BytesTransferred != 9000 {
+		t.Errorf("Expected usage to stay at 9000 bytes, got %d", usage.BytesTransferred)
+	}
+}
+
+func TestMiddlewareAllowsBodyWithinRemaining(t *testing.T) {
+	m, storage := newTestMiddleware(t, 10000)
+	storage.UpdateUsage("test-key", thisMonth(), 1, 9000)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newQuotaRequest(strings.Repeat("x", 500)))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+
+	// Recorded usage is the request body plus the response body
+	usage, _ := storage.GetUsage("test-key", thisMonth())
+	if usage.BytesTransferred != 9502 {
+		t.Errorf("Expected 9502 bytes used, got %d", usage.BytesTransferred)
+	}
+}
+
+// readTracker counts how much of a request body the client sent
+type readTracker struct {
+	io.Reader
+	read atomic.Int64
+}
+
+func (r *readTracker) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read.Add(int64(n))
+	return n, err
+}
+
+func TestMiddlewareExpectContinue(t *testing.T) {
+	m, storage := newTestMiddleware(t, 100000)
+	storage.UpdateUsage("test-key", thisMonth(), 1, 90000)
+
+	// Sets the API key as the auth middleware would
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+	}))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ContextKeyAPIKey, &APIKeyInfo{KeyID: "test-key"})
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+
+	tests := []struct {
+		name          string
+		size          int
+		wantContinued bool
+		wantStatus    int
+	}{
+		{"over remaining quota", 20000, false, http.StatusRequestEntityTooLarge},
+		{"within remaining quota", 5000, true, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &readTracker{Reader: strings.NewReader(strings.Repeat("x", tt.size))}
+			var continued bool
+			trace := &httptrace.ClientTrace{Got100Continue: func() { continued = true }}
+
+			req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "POST", server.URL+"/peer/lease", body)
+			req.ContentLength = int64(tt.size)
+			req.Header.Set("Expect", "100-continue")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus || continued != tt.wantContinued {
+				t.Errorf("Expected status %d and continued=%v, got %d and %v", tt.wantStatus, tt.wantContinued, resp.StatusCode, continued)
+			}
+
+			// A rejected upload is never sent
+			if !tt.wantContinued && body.read.Load() != 0 {
+				t.Errorf("Expected no body bytes sent, got %d", body.read.Load())
+			}
+		})
+	}
+}
+
+func TestMiddlewareExhaustedBytesQuota(t *testing.T) {
+	m, storage := newTestMiddleware(t, 10000)
+	storage.UpdateUsage("test-key", thisMonth(), 1, 10000)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected handler not to be called")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newQuotaRequest("small"))
+
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rr.Code)
+	}
+
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After header")
+	}
+}
+
+func TestMiddlewareCountsActualBytes(t *testing.T) {
+	tests := []struct {
+		accounting ByteAccounting
+		want       int64
+	}{
+		{ByteAccountingBoth, 300 + 3*5},
+		{ByteAccountingIngress, 300},
+		{ByteAccountingEgress, 3 * 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.accounting), func(t *testing.T) {
+			m, storage := newTestMiddleware(t, 10000)
+			m.manager.SetByteAccounting(tt.accounting)
+
+			// Streams the response in flushed chunks after reading the body
+			handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				for i := 0; i < 3; i++ {
+					w.Write([]byte("chunk"))
+					http.NewResponseController(w).Flush()
+				}
+			}))
+
+			// Declared length overstates the body, which must not be charged
+			req := newQuotaRequest(strings.Repeat("x", 300))
+			req.ContentLength = 1000
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if !rr.Flushed {
+				t.Error("Expected the streamed response to be flushed")
+			}
+
+			usage, _ := storage.GetUsage("test-key", thisMonth())
+			if usage.BytesTransferred != tt.want {
+				t.Errorf("Expected %d bytes used, got %d", tt.want, usage.BytesTransferred)
+			}
+		})
+	}
+}
+
+func TestMiddlewareStreamAccounting(t *testing.T) {
+	tests := []struct {
+		accounting StreamAccounting
+		sent       int   // Chunks the client received
+		want       int64 // Bytes used afterwards
+	}{
+		{StreamAccountingOnClose, 5, 8000 + 5*600},
+		{StreamAccountingIncremental, 4, 8000 + 4*600},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.accounting), func(t *testing.T) {
+			recorder := &quotaRecorder{}
+			m, storage := newTestMiddlewareWithConfig(t, 10000, &MiddlewareConfig{ExceededRecorder: recorder})
+			m.manager.SetByteAccounting(ByteAccountingEgress)
+			m.manager.SetStreamAccounting(tt.accounting)
+			storage.UpdateUsage("test-key", thisMonth(), 1, 8000)
+
+			// Streams five flushed chunks, stopping once the request is cancelled
+			var cancelled bool
+			handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for i := 0; i < 5; i++ {
+					if r.Context().Err() != nil {
+						cancelled = true
+						return
+					}
+					w.Write([]byte(strings.Repeat("x", 600)))
+					http.NewResponseController(w).Flush()
+				}
+			}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newQuotaRequest(""))
+
+			if got := rr.Body.Len(); got != tt.sent*600 {
+				t.Errorf("Expected %d chunks sent, got %d bytes", tt.sent, got)
+			}
+
+			// The stream counts as one request in both modes
+			usage, _ := storage.GetUsage("test-key", thisMonth())
+			if usage.RequestCount != 2 || usage.BytesTransferred != tt.want {
+				t.Errorf("Expected 2 requests and %d bytes used, got %d and %d", tt.want, usage.RequestCount, usage.BytesTransferred)
+			}
+
+			cutOff := tt.accounting == StreamAccountingIncremental
+			if cancelled != cutOff {
+				t.Errorf("Expected request cancelled = %v, got %v", cutOff, cancelled)
+			}
+			if cutOff && strings.Join(recorder.events, ",") != "test-key:bytes" {
+				t.Errorf("Expected the cut-off to be recorded, got %v", recorder.events)
+			}
+		})
+	}
+}
+
+func TestMiddlewareEgressIgnoresDeclaredBodySize(t *testing.T) {
+	m, storage := newTestMiddleware(t, 10000)
+	m.manager.SetByteAccounting(ByteAccountingEgress)
+	storage.UpdateUsage("test-key", thisMonth(), 1, 8000)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte("ok"))
+	}))
+
+	// The upload alone would exceed the remaining quota, but uploads are not charged
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newQuotaRequest(strings.Repeat("x", 5000)))
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", rr.Code)
+	}
+
+	usage, _ := storage.GetUsage("test-key", thisMonth())
+	if usage.BytesTransferred != 8002 {
+		t.Errorf("Expected 8002 bytes used, got %d", usage.BytesTransferred)
+	}
+}
+
+// quotaRecorder collects recorded quota rejections
+type quotaRecorder struct {
+	events     []string
+	rejections []string
+}
+
+func (r *quotaRecorder) RecordQuotaExceeded(keyID, quotaType string) {
+	r.events = append(r.events, keyID+":"+quotaType)
+}
+
+// RecordRejection collects rejections reported for saturation
+func (r *quotaRecorder) RecordRejection(reason string) {
+	r.rejections = append(r.rejections, reason)
+}
+
+func TestMiddlewareRecordsExceededType(t *testing.T) {
+	recorder := &quotaRecorder{}
+	m, storage := newTestMiddlewareWithConfig(t, 10000, &MiddlewareConfig{ExceededRecorder: recorder, Rejections: recorder})
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected handler not to be called")
+	}))
+
+	// Oversized upload
+	storage.UpdateUsage("test-key", thisMonth(), 1, 9000)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newQuotaRequest(strings.Repeat("x", 2000)))
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413, got %d", rr.Code)
+	}
+
+	// Request quota exhausted
+	storage.UpdateUsage("test-key", thisMonth(), 999, 0)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newQuotaRequest("small"))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status 429, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), `"quota_type":"requests"`) {
+		t.Errorf("Expected quota_type in body, got %s", rr.Body.String())
+	}
+
+	want := []string{"test-key:bytes", "test-key:requests"}
+	if strings.Join(recorder.events, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected recorded %v, got %v", want, recorder.events)
+	}
+
+	// A single oversized upload is not a sign of saturation
+	if strings.Join(recorder.rejections, ",") != "quota" {
+		t.Errorf("Expected one quota rejection reported, got %v", recorder.rejections)
+	}
+}
+
+// bypassFunc adapts a function to the Bypass interface
+type bypassFunc func(r *http.Request, limit string) bool
+
+func (f bypassFunc) Bypasses(r *http.Request, limit string) bool { return f(r, limit) }
+
+func TestMiddlewareBypass(t *testing.T) {
+	var limits []string
+	m, storage := newTestMiddlewareWithConfig(t, 10000, &MiddlewareConfig{Bypass: bypassFunc(func(r *http.Request, limit string) bool {
+		limits = append(limits, limit)
+		return true
+	})})
+	storage.UpdateUsage("test-key", thisMonth(), 1, 10000)
+
+	called := false
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.Write([]byte("response"))
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newQuotaRequest("body"))
+
+	// An exhausted quota does not apply to bypassed requests
+	if !called || rr.Code != http.StatusOK {
+		t.Errorf("Expected the request to pass, got %d", rr.Code)
+	}
+	if len(limits) != 1 || limits[0] != "quota" {
+		t.Errorf("Expected the bypass to be asked about quota, got %v", limits)
+	}
+
+	// Nor is their usage counted
+	usage, _ := storage.GetUsage("test-key", thisMonth())
+	if usage.RequestCount != 1 || usage.BytesTransferred != 10000 {
+		t.Errorf("Expected usage to be unchanged, got %d requests and %d bytes", usage.RequestCount, usage.BytesTransferred)
+	}
+}
@@ -0,0 +1,136 @@
+package quota
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PeriodStrategy computes the boundaries of quota periods
+type PeriodStrategy interface {
+	// Start returns the start of the period containing t
+	Start(t time.Time) time.Time
+
+	// End returns the last second of the period beginning at periodStart
+	End(periodStart time.Time) time.Time
+
+	// String returns the period name as used in configuration
+	String() string
+}
+
+// Period names accepted by ParsePeriod
+const (
+	PeriodMonthly   = "monthly"
+	PeriodWeekly    = "weekly"
+	PeriodQuarterly = "quarterly"
+)
+
+// MonthlyPeriod resets on the 1st of each month
+type MonthlyPeriod struct{}
+
+// Start implements PeriodStrategy
+func (MonthlyPeriod) Start(t time.Time) time.Time {
+	return getMonthStart(t)
+}
+
+// End implements PeriodStrategy
+func (MonthlyPeriod) End(periodStart time.Time) time.Time {
+	return periodStart.AddDate(0, 1, 0).Add(-time.Second)
+}
+
+func (MonthlyPeriod) String() string {
+	return PeriodMonthly
+}
+
+// WeeklyPeriod resets every Monday
+type WeeklyPeriod struct{}
+
+// Start implements PeriodStrategy
+func (WeeklyPeriod) Start(t time.Time) time.Time {
+	year, month, day := t.Date()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(year, month, day-daysSinceMonday, 0, 0, 0, 0, t.Location())
+}
+
+// End implements PeriodStrategy
+func (WeeklyPeriod) End(periodStart time.Time) time.Time {
+	return periodStart.AddDate(0, 0, 7).Add(-time.Second)
+}
+
+func (WeeklyPeriod) String() string {
+	return PeriodWeekly
+}
+
+// QuarterlyPeriod resets on January, April, July and October 1st
+type QuarterlyPeriod struct{}
+
+// Start implements PeriodStrategy
+func (QuarterlyPeriod) Start(t time.Time) time.Time {
+	year, month, _ := t.Date()
+	quarterMonth := month - (month-1)%3
+	return time.Date(year, quarterMonth, 1, 0, 0, 0, 0, t.Location())
+}
+
+// End implements PeriodStrategy
+func (QuarterlyPeriod) End(periodStart time.Time) time.Time {
+	return periodStart.AddDate(0, 3, 0).Add(-time.Second)
+}
+
+func (QuarterlyPeriod) String() string {
+	return PeriodQuarterly
+}
+
+// DaysPeriod resets every Days calendar days, counted from 1970-01-01
+// so every key on the same length shares the same boundaries
+type DaysPeriod struct {
+	Days int
+}
+
+// Start implements PeriodStrategy
+func (p DaysPeriod) Start(t time.Time) time.Time {
+	year, month, day := t.Date()
+
+	// Count calendar days rather than hours so DST changes do not shift boundaries
+	dayNumber := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	startDay := dayNumber - dayNumber%int64(p.Days)
+
+	return time.Date(1970, time.January, 1+int(startDay), 0, 0, 0, 0, t.Location())
+}
+
+// End implements PeriodStrategy
+func (p DaysPeriod) End(periodStart time.Time) time.Time {
+	return periodStart.AddDate(0, 0, p.Days).Add(-time.Second)
+}
+
+func (p DaysPeriod) String() string {
+	return strconv.Itoa(p.Days) + "d"
+}
+
+// ParsePeriod parses a period name: "monthly", "weekly", "quarterly", or "<N>d" for N days
+// An empty name is monthly
+func ParsePeriod(name string) (PeriodStrategy, error) {
+	switch name {
+	case "", PeriodMonthly:
+		return MonthlyPeriod{}, nil
+	case PeriodWeekly:
+		return WeeklyPeriod{}, nil
+	case PeriodQuarterly:
+		return QuarterlyPeriod{}, nil
+	}
+
+	if days, ok := strings.CutSuffix(name, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n > 0 {
+			return DaysPeriod{Days: n}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid quota period %q (expected monthly, weekly, quarterly, or <N>d)", name)
+}
+
+// getMonthStart returns the start of the current month
+func getMonthStart(t time.Time) time.Time {
+	year, month, _ := t.Date()
+	return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
+}
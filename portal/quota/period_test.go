@@ -0,0 +1,133 @@
+package quota
+
+import (
+	"testing"
+	"time"
+)
+
+// TestPeriodBoundaries tests period start and end for each strategy
+func TestPeriodBoundaries(t *testing.T) {
+	tests := []struct {
+		name          string
+		period        PeriodStrategy
+		input         time.Time
+		expectedStart time.Time
+		expectedEnd   time.Time
+	}{
+		{
+			name:          "monthly",
+			period:        MonthlyPeriod{},
+			input:         time.Date(2024, 2, 15, 10, 0, 0, 0, time.UTC),
+			expectedStart: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 2, 29, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:          "weekly mid-week",
+			period:        WeeklyPeriod{},
+			input:         time.Date(2024, 6, 13, 10, 0, 0, 0, time.UTC), // Thursday
+			expectedStart: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 6, 16, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:          "weekly sunday",
+			period:        WeeklyPeriod{},
+			input:         time.Date(2024, 6, 16, 23, 0, 0, 0, time.UTC),
+			expectedStart: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 6, 16, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:          "weekly across month",
+			period:        WeeklyPeriod{},
+			input:         time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), // Saturday
+			expectedStart: time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 3, 3, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:          "quarterly",
+			period:        QuarterlyPeriod{},
+			input:         time.Date(2024, 8, 20, 10, 0, 0, 0, time.UTC),
+			expectedStart: time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 9, 30, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:          "quarterly last day",
+			period:        QuarterlyPeriod{},
+			input:         time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+			expectedStart: time.Date(2024, 10, 1, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			name:          "14 days",
+			period:        DaysPeriod{Days: 14},
+			input:         time.Date(1970, 1, 20, 10, 0, 0, 0, time.UTC),
+			expectedStart: time.Date(1970, 1, 15, 0, 0, 0, 0, time.UTC),
+			expectedEnd:   time.Date(1970, 1, 28, 23, 59, 59, 0, time.UTC),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := tt.period.Start(tt.input)
+			if !start.Equal(tt.expectedStart) {
+				t.Errorf("Expected start %v, got %v", tt.expectedStart, start)
+			}
+
+			end := tt.period.End(start)
+			if !end.Equal(tt.expectedEnd) {
+				t.Errorf("Expected end %v, got %v", tt.expectedEnd, end)
+			}
+		})
+	}
+}
+
+// TestDaysPeriodContiguous tests that N-day periods tile time without gaps
+func TestDaysPeriodContiguous(t *testing.T) {
+	period := DaysPeriod{Days: 30}
+	start := period.Start(time.Date(2024, 6, 15, 0, 0, 0, 0, time.UTC))
+
+	next := period.Start(period.End(start).Add(time.Second))
+	if !next.Equal(start.AddDate(0, 0, 30)) {
+		t.Errorf("Expected next period to start at %v, got %v", start.AddDate(0, 0, 30), next)
+	}
+
+	if period.Start(next) != next {
+		t.Errorf("Expected period start to be stable, got %v", period.Start(next))
+	}
+}
+
+// TestParsePeriod tests parsing period names
+func TestParsePeriod(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected PeriodStrategy
+	}{
+		{"", MonthlyPeriod{}},
+		{"monthly", MonthlyPeriod{}},
+		{"weekly", WeeklyPeriod{}},
+		{"quarterly", QuarterlyPeriod{}},
+		{"30d", DaysPeriod{Days: 30}},
+	}
+
+	for _, tt := range tests {
+		period, err := ParsePeriod(tt.input)
+		if err != nil {
+			t.Errorf("ParsePeriod(%q) failed: %v", tt.input, err)
+			continue
+		}
+
+		if period != tt.expected {
+			t.Errorf("ParsePeriod(%q) = %v, expected %v", tt.input, period, tt.expected)
+		}
+	}
+
+	for _, invalid := range []string{"yearly", "0d", "-3d", "d", "7"} {
+		if _, err := ParsePeriod(invalid); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+
+	// Names round-trip through String
+	if period, _ := ParsePeriod(DaysPeriod{Days: 7}.String()); period != (DaysPeriod{Days: 7}) {
+		t.Errorf("Expected 7d to round-trip, got %v", period)
+	}
+}
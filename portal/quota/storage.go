@@ -4,22 +4,31 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/portal-project/portal-gateway/portal/sqlite"
 )
 
 // Storage defines the interface for quota persistence
 type Storage interface {
-	// GetUsage retrieves current usage for an API key
-	GetUsage(keyID string) (*Usage, error)
+	// GetUsage retrieves usage for an API key in the period starting at periodStart
+	// Usage recorded in any other period is not counted
+	GetUsage(keyID string, periodStart time.Time) (*Usage, error)
 
-	// UpdateUsage updates usage counters for an API key
-	UpdateUsage(keyID string, requestsIncrement int64, bytesIncrement int64) error
+	// UpdateUsage updates usage counters for an API key in the period starting at periodStart
+	// Requests that started before a rollover still count against the period they started in
+	UpdateUsage(keyID string, periodStart time.Time, requestsIncrement int64, bytesIncrement int64) error
 
-	// ResetUsage resets usage counters for an API key
-	ResetUsage(keyID string) error
+	// ResetUsage resets usage counters for an API key, starting a new period at periodStart
+	ResetUsage(keyID string, periodStart time.Time) error
+
+	// StartPeriod moves usage stored for an earlier period into the period starting at periodStart
+	// rollover receives the earlier usage and returns the bonus requests carried into the new period
+	// Keys without stored usage, or already in the period, are left untouched
+	StartPeriod(keyID string, periodStart time.Time, rollover func(previous *Usage) int64) error
 
 	// ListAllUsage lists usage for all API keys
 	ListAllUsage() ([]*Usage, error)
@@ -36,6 +45,7 @@ type Usage struct {
 	LastRequestTime  time.Time `json:"last_request_time"`
 	PeriodStart      time.Time `json:"period_start"`
 	UpdatedAt        time.Time `json:"updated_at"`
+	RolloverRequests int64     `json:"rollover_requests"` // Bonus requests carried into this period
 }
 
 // SQLiteStorage implements Storage using SQLite
@@ -49,23 +59,36 @@ var (
 	ErrStorageNotFound   = errors.New("quota usage not found")
 	ErrStorageFailed     = errors.New("storage operation failed")
 	ErrStorageInvalidKey = errors.New("invalid API key ID")
+	ErrStoragePeriodGone = errors.New("quota period no longer retained")
+)
+
+// SQLite connection tuning for concurrent use
+const (
+	// sqliteBusyTimeout is how long a writer waits for a lock held by another connection or process
+	sqliteBusyTimeout = 5 * time.Second
+
+	// sqliteMaxOpenConns bounds the pool; WAL allows concurrent readers alongside one writer
+	sqliteMaxOpenConns = 4
 )
 
 // NewSQLiteStorage creates a new SQLite-based quota storage
+// The database is opened in WAL mode with a busy timeout, so concurrent writers,
+// including other processes sharing the file, wait for the lock instead of failing
+// Transactions take the write lock up front, so a period rollover is read and written atomically
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 	if dbPath == "" {
 		return nil, errors.New("database path cannot be empty")
 	}
 
 	// Open database connection
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Configure connection pool
-	db.SetMaxOpenConns(25)
-	db.SetMaxIdleConns(5)
+	// Configure connection pool; idle connections are kept so per-connection settings are not reapplied
+	db.SetMaxOpenConns(sqliteMaxOpenConns)
+	db.SetMaxIdleConns(sqliteMaxOpenConns)
 	db.SetConnMaxLifetime(5 * time.Minute)
 
 	storage := &SQLiteStorage{
@@ -81,6 +104,18 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 	return storage, nil
 }
 
+// sqliteDSN appends the WAL, busy timeout, synchronous and transaction lock settings to a database path
+// The driver applies them to every connection it opens
+func sqliteDSN(dbPath string) string {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+
+	return fmt.Sprintf("%s%s_journal_mode=WAL&_busy_timeout=%d&_synchronous=NORMAL&_txlock=immediate",
+		dbPath, separator, sqliteBusyTimeout.Milliseconds())
+}
+
 // initSchema creates the quota_usage table if it doesn't exist
 func (s *SQLiteStorage) initSchema() error {
 	query := `
@@ -97,12 +132,28 @@ func (s *SQLiteStorage) initSchema() error {
 	CREATE INDEX IF NOT EXISTS idx_updated_at ON quota_usage(updated_at);
 	`
 
-	_, err := s.db.Exec(query)
-	return err
+	if _, err := s.db.Exec(query); err != nil {
+		return err
+	}
+
+	// Databases created before rollover support and previous period retention lack these columns
+	columns := []struct{ name, definition string }{
+		{"rollover_requests", "INTEGER NOT NULL DEFAULT 0"},
+		{"previous_period_start", "DATETIME"},
+		{"previous_request_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"previous_bytes_transferred", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range columns {
+		if err := sqlite.AddColumnIfMissing(s.db, "quota_usage", column.name, column.definition); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// GetUsage retrieves current usage for an API key
-func (s *SQLiteStorage) GetUsage(keyID string) (*Usage, error) {
+// GetUsage retrieves usage for an API key in the period starting at periodStart
+// The period before the stored one is retained, so it can still be read after a rollover
+func (s *SQLiteStorage) GetUsage(keyID string, periodStart time.Time) (*Usage, error) {
 	if keyID == "" {
 		return nil, ErrStorageInvalidKey
 	}
@@ -110,48 +161,94 @@ func (s *SQLiteStorage) GetUsage(keyID string) (*Usage, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	row, err := readUsageRow(s.db, keyID)
+	if err == sql.ErrNoRows {
+		return emptyUsage(keyID, periodStart), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrStorageFailed, err)
+	}
+
+	switch {
+	case row.PeriodStart.Equal(periodStart):
+		return &row.Usage, nil
+
+	case row.previousPeriodStart.Valid && row.previousPeriodStart.Time.Equal(periodStart):
+		return &Usage{
+			KeyID:            keyID,
+			RequestCount:     row.previousRequestCount,
+			BytesTransferred: row.previousBytesTransferred,
+			PeriodStart:      periodStart,
+			UpdatedAt:        row.UpdatedAt,
+		}, nil
+	}
+
+	// Return zero usage for periods without stored usage
+	return emptyUsage(keyID, periodStart), nil
+}
+
+// usageRow is a stored usage record together with the usage of the period before it
+type usageRow struct {
+	Usage
+	previousPeriodStart      sql.NullTime
+	previousRequestCount     int64
+	previousBytesTransferred int64
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// readUsageRow reads the stored usage record for an API key
+func readUsageRow(q queryer, keyID string) (*usageRow, error) {
 	query := `
-	SELECT key_id, request_count, bytes_transferred, last_request_time, period_start, updated_at
+	SELECT key_id, request_count, bytes_transferred, last_request_time, period_start, updated_at, rollover_requests,
+	       previous_period_start, previous_request_count, previous_bytes_transferred
 	FROM quota_usage
 	WHERE key_id = ?
 	`
 
-	usage := &Usage{}
+	row := &usageRow{}
 	var lastRequestTime sql.NullTime
 
-	err := s.db.QueryRow(query, keyID).Scan(
-		&usage.KeyID,
-		&usage.RequestCount,
-		&usage.BytesTransferred,
+	err := q.QueryRow(query, keyID).Scan(
+		&row.KeyID,
+		&row.RequestCount,
+		&row.BytesTransferred,
 		&lastRequestTime,
-		&usage.PeriodStart,
-		&usage.UpdatedAt,
+		&row.PeriodStart,
+		&row.UpdatedAt,
+		&row.RolloverRequests,
+		&row.previousPeriodStart,
+		&row.previousRequestCount,
+		&row.previousBytesTransferred,
 	)
-
-	if err == sql.ErrNoRows {
-		// Return zero usage for new keys
-		return &Usage{
-			KeyID:            keyID,
-			RequestCount:     0,
-			BytesTransferred: 0,
-			PeriodStart:      getMonthStart(time.Now()),
-			UpdatedAt:        time.Now(),
-		}, nil
-	}
-
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrStorageFailed, err)
+		return nil, err
 	}
 
 	if lastRequestTime.Valid {
-		usage.LastRequestTime = lastRequestTime.Time
+		row.LastRequestTime = lastRequestTime.Time
 	}
 
-	return usage, nil
+	return row, nil
+}
+
+// emptyUsage returns zero usage for an API key in the period starting at periodStart
+func emptyUsage(keyID string, periodStart time.Time) *Usage {
+	return &Usage{
+		KeyID:       keyID,
+		PeriodStart: periodStart,
+		UpdatedAt:   time.Now(),
+	}
 }
 
-// UpdateUsage updates usage counters for an API key
-func (s *SQLiteStorage) UpdateUsage(keyID string, requestsIncrement int64, bytesIncrement int64) error {
+// UpdateUsage updates usage counters for an API key in the period starting at periodStart
+// A newer period moves the stored usage into the retained previous period, and updates for
+// the retained period are added to it, so requests straddling a rollover are neither lost
+// nor counted against the new period
+func (s *SQLiteStorage) UpdateUsage(keyID string, periodStart time.Time, requestsIncrement int64, bytesIncrement int64) error {
 	if keyID == "" {
 		return ErrStorageInvalidKey
 	}
@@ -159,62 +256,92 @@ func (s *SQLiteStorage) UpdateUsage(keyID string, requestsIncrement int64, bytes
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
+	}
+	defer tx.Rollback()
+
 	now := time.Now()
-	periodStart := getMonthStart(now)
 
-	query := `
-	INSERT INTO quota_usage (key_id, request_count, bytes_transferred, last_request_time, period_start, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?)
-	ON CONFLICT(key_id) DO UPDATE SET
-		request_count = request_count + ?,
-		bytes_transferred = bytes_transferred + ?,
-		last_request_time = ?,
-		updated_at = ?
-	WHERE period_start = ?
-	`
+	row, err := readUsageRow(tx, keyID)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = tx.Exec(`
+			INSERT INTO quota_usage (key_id, request_count, bytes_transferred, last_request_time, period_start, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, keyID, requestsIncrement, bytesIncrement, now, periodStart, now)
+
+	case err != nil:
+		// Reported below
+
+	case row.PeriodStart.Equal(periodStart):
+		_, err = tx.Exec(`
+			UPDATE quota_usage
+			SET request_count = request_count + ?,
+			    bytes_transferred = bytes_transferred + ?,
+			    last_request_time = ?,
+			    updated_at = ?
+			WHERE key_id = ?
+		`, requestsIncrement, bytesIncrement, now, now, keyID)
+
+	case row.PeriodStart.Before(periodStart):
+		// First update in a new period; StartPeriod has not run for keys without rollover
+		if err = startPeriod(tx, keyID, periodStart, 0, now); err == nil {
+			_, err = tx.Exec(`
+				UPDATE quota_usage
+				SET request_count = ?,
+				    bytes_transferred = ?,
+				    last_request_time = ?
+				WHERE key_id = ?
+			`, requestsIncrement, bytesIncrement, now, keyID)
+		}
 
-	result, err := s.db.Exec(query,
-		keyID, requestsIncrement, bytesIncrement, now, periodStart, now,
-		requestsIncrement, bytesIncrement, now, now, periodStart,
-	)
+	case row.previousPeriodStart.Valid && row.previousPeriodStart.Time.Equal(periodStart):
+		// A request that started before the rollover finished after it
+		_, err = tx.Exec(`
+			UPDATE quota_usage
+			SET previous_request_count = previous_request_count + ?,
+			    previous_bytes_transferred = previous_bytes_transferred + ?,
+			    updated_at = ?
+			WHERE key_id = ?
+		`, requestsIncrement, bytesIncrement, now, keyID)
+
+	default:
+		return fmt.Errorf("%w: key %s, period %v", ErrStoragePeriodGone, keyID, periodStart)
+	}
 
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
 	}
 
-	// Check if period has changed (new month)
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		// Period changed, reset and insert new record
-		return s.resetAndUpdate(keyID, requestsIncrement, bytesIncrement, now, periodStart)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
 	}
 
 	return nil
 }
 
-// resetAndUpdate resets usage and updates with new values (for period rollover)
-func (s *SQLiteStorage) resetAndUpdate(keyID string, requests int64, bytes int64, now time.Time, periodStart time.Time) error {
-	// Delete old record
-	_, err := s.db.Exec("DELETE FROM quota_usage WHERE key_id = ?", keyID)
-	if err != nil {
-		return fmt.Errorf("%w: failed to delete old record: %v", ErrStorageFailed, err)
-	}
-
-	// Insert new record
-	_, err = s.db.Exec(`
-		INSERT INTO quota_usage (key_id, request_count, bytes_transferred, last_request_time, period_start, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, keyID, requests, bytes, now, periodStart, now)
-
-	if err != nil {
-		return fmt.Errorf("%w: failed to insert new record: %v", ErrStorageFailed, err)
-	}
-
-	return nil
+// startPeriod moves a key's stored usage into the retained previous period and starts
+// an empty period at periodStart with the given rollover bonus
+func startPeriod(tx *sql.Tx, keyID string, periodStart time.Time, rolloverRequests int64, now time.Time) error {
+	_, err := tx.Exec(`
+		UPDATE quota_usage
+		SET previous_period_start = period_start,
+		    previous_request_count = request_count,
+		    previous_bytes_transferred = bytes_transferred,
+		    request_count = 0,
+		    bytes_transferred = 0,
+		    rollover_requests = ?,
+		    period_start = ?,
+		    updated_at = ?
+		WHERE key_id = ?
+	`, rolloverRequests, periodStart, now, keyID)
+	return err
 }
 
-// ResetUsage resets usage counters for an API key
-func (s *SQLiteStorage) ResetUsage(keyID string) error {
+// ResetUsage resets usage counters for an API key, starting a new period at periodStart
+func (s *SQLiteStorage) ResetUsage(keyID string, periodStart time.Time) error {
 	if keyID == "" {
 		return ErrStorageInvalidKey
 	}
@@ -223,18 +350,19 @@ func (s *SQLiteStorage) ResetUsage(keyID string) error {
 	defer s.mu.Unlock()
 
 	now := time.Now()
-	periodStart := getMonthStart(now)
 
 	query := `
 	UPDATE quota_usage
 	SET request_count = 0,
 	    bytes_transferred = 0,
+	    rollover_requests = CASE WHEN period_start = ? THEN rollover_requests ELSE 0 END,
 	    period_start = ?,
 	    updated_at = ?
 	WHERE key_id = ?
 	`
 
-	result, err := s.db.Exec(query, periodStart, now, keyID)
+	// A rollover bonus survives a reset within its own period
+	result, err := s.db.Exec(query, periodStart, periodStart, now, keyID)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
 	}
@@ -247,13 +375,52 @@ func (s *SQLiteStorage) ResetUsage(keyID string) error {
 	return nil
 }
 
+// StartPeriod moves usage stored for an earlier period into the period starting at periodStart
+func (s *SQLiteStorage) StartPeriod(keyID string, periodStart time.Time, rollover func(previous *Usage) int64) error {
+	if keyID == "" {
+		return ErrStorageInvalidKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The transaction holds the write lock, so the move happens once even with other processes sharing the file
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
+	}
+	defer tx.Rollback()
+
+	previous, err := readUsageRow(tx, keyID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
+	}
+
+	if !previous.PeriodStart.Before(periodStart) {
+		return nil
+	}
+
+	if err := startPeriod(tx, keyID, periodStart, rollover(&previous.Usage), time.Now()); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", ErrStorageFailed, err)
+	}
+
+	return nil
+}
+
 // ListAllUsage lists usage for all API keys
 func (s *SQLiteStorage) ListAllUsage() ([]*Usage, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
 	query := `
-	SELECT key_id, request_count, bytes_transferred, last_request_time, period_start, updated_at
+	SELECT key_id, request_count, bytes_transferred, last_request_time, period_start, updated_at, rollover_requests
 	FROM quota_usage
 	ORDER BY updated_at DESC
 	`
@@ -276,6 +443,7 @@ func (s *SQLiteStorage) ListAllUsage() ([]*Usage, error) {
 			&lastRequestTime,
 			&usage.PeriodStart,
 			&usage.UpdatedAt,
+			&usage.RolloverRequests,
 		)
 
 		if err != nil {
@@ -296,9 +464,3 @@ func (s *SQLiteStorage) ListAllUsage() ([]*Usage, error) {
 func (s *SQLiteStorage) Close() error {
 	return s.db.Close()
 }
-
-// getMonthStart returns the start of the current month
-func getMonthStart(t time.Time) time.Time {
-	year, month, _ := t.Date()
-	return time.Date(year, month, 1, 0, 0, 0, 0, t.Location())
-}
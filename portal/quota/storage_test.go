@@ -1,12 +1,20 @@
 package quota
 
 import (
+	"database/sql"
+	"errors"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
 
+// thisMonth returns the start of the current monthly period
+func thisMonth() time.Time {
+	return MonthlyPeriod{}.Start(time.Now())
+}
+
 // TestNewSQLiteStorage tests creating a new SQLite storage
 func TestNewSQLiteStorage(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -43,7 +51,7 @@ func TestGetUsageNewKey(t *testing.T) {
 	}
 	defer storage.Close()
 
-	usage, err := storage.GetUsage("test-key")
+	usage, err := storage.GetUsage("test-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to get usage: %v", err)
 	}
@@ -72,7 +80,7 @@ func TestGetUsageInvalidKey(t *testing.T) {
 	}
 	defer storage.Close()
 
-	_, err = storage.GetUsage("")
+	_, err = storage.GetUsage("", thisMonth())
 	if err != ErrStorageInvalidKey {
 		t.Errorf("Expected ErrStorageInvalidKey, got %v", err)
 	}
@@ -90,13 +98,13 @@ func TestUpdateUsage(t *testing.T) {
 	defer storage.Close()
 
 	// Update usage
-	err = storage.UpdateUsage("test-key", 10, 1024)
+	err = storage.UpdateUsage("test-key", thisMonth(), 10, 1024)
 	if err != nil {
 		t.Fatalf("Failed to update usage: %v", err)
 	}
 
 	// Verify usage
-	usage, err := storage.GetUsage("test-key")
+	usage, err := storage.GetUsage("test-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to get usage: %v", err)
 	}
@@ -122,19 +130,19 @@ func TestUpdateUsageMultipleTimes(t *testing.T) {
 	defer storage.Close()
 
 	// First update
-	err = storage.UpdateUsage("test-key", 5, 512)
+	err = storage.UpdateUsage("test-key", thisMonth(), 5, 512)
 	if err != nil {
 		t.Fatalf("Failed to update usage (1): %v", err)
 	}
 
 	// Second update
-	err = storage.UpdateUsage("test-key", 3, 256)
+	err = storage.UpdateUsage("test-key", thisMonth(), 3, 256)
 	if err != nil {
 		t.Fatalf("Failed to update usage (2): %v", err)
 	}
 
 	// Verify cumulative usage
-	usage, err := storage.GetUsage("test-key")
+	usage, err := storage.GetUsage("test-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to get usage: %v", err)
 	}
@@ -159,7 +167,7 @@ func TestUpdateUsageInvalidKey(t *testing.T) {
 	}
 	defer storage.Close()
 
-	err = storage.UpdateUsage("", 10, 1024)
+	err = storage.UpdateUsage("", thisMonth(), 10, 1024)
 	if err != ErrStorageInvalidKey {
 		t.Errorf("Expected ErrStorageInvalidKey, got %v", err)
 	}
@@ -177,19 +185,19 @@ func TestResetUsage(t *testing.T) {
 	defer storage.Close()
 
 	// Add some usage
-	err = storage.UpdateUsage("test-key", 100, 10240)
+	err = storage.UpdateUsage("test-key", thisMonth(), 100, 10240)
 	if err != nil {
 		t.Fatalf("Failed to update usage: %v", err)
 	}
 
 	// Reset usage
-	err = storage.ResetUsage("test-key")
+	err = storage.ResetUsage("test-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to reset usage: %v", err)
 	}
 
 	// Verify usage is reset
-	usage, err := storage.GetUsage("test-key")
+	usage, err := storage.GetUsage("test-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to get usage: %v", err)
 	}
@@ -214,7 +222,7 @@ func TestResetUsageNonExistent(t *testing.T) {
 	}
 	defer storage.Close()
 
-	err = storage.ResetUsage("nonexistent-key")
+	err = storage.ResetUsage("nonexistent-key", thisMonth())
 	if err == nil {
 		t.Fatal("Expected error for non-existent key, got nil")
 	}
@@ -231,7 +239,7 @@ func TestResetUsageInvalidKey(t *testing.T) {
 	}
 	defer storage.Close()
 
-	err = storage.ResetUsage("")
+	err = storage.ResetUsage("", thisMonth())
 	if err != ErrStorageInvalidKey {
 		t.Errorf("Expected ErrStorageInvalidKey, got %v", err)
 	}
@@ -261,7 +269,7 @@ func TestListAllUsage(t *testing.T) {
 	// Add some usage records
 	keys := []string{"key1", "key2", "key3"}
 	for i, key := range keys {
-		err = storage.UpdateUsage(key, int64(i+1)*10, int64(i+1)*1024)
+		err = storage.UpdateUsage(key, thisMonth(), int64(i+1)*10, int64(i+1)*1024)
 		if err != nil {
 			t.Fatalf("Failed to update usage for %s: %v", key, err)
 		}
@@ -324,6 +332,115 @@ func TestGetMonthStart(t *testing.T) {
 	}
 }
 
+// TestUsageRollsOverWithPeriod tests that usage from an earlier period is not counted
+func TestUsageRollsOverWithPeriod(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	lastMonth := thisMonth().AddDate(0, -1, 0)
+	if err := storage.UpdateUsage("test-key", lastMonth, 100, 10240); err != nil {
+		t.Fatalf("Failed to update usage: %v", err)
+	}
+
+	// Reading the new period sees no usage, even before anything is recorded in it
+	usage, err := storage.GetUsage("test-key", thisMonth())
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+
+	if usage.RequestCount != 0 || usage.BytesTransferred != 0 {
+		t.Errorf("Expected zero usage in new period, got %d requests, %d bytes", usage.RequestCount, usage.BytesTransferred)
+	}
+
+	if !usage.PeriodStart.Equal(thisMonth()) {
+		t.Errorf("Expected period start %v, got %v", thisMonth(), usage.PeriodStart)
+	}
+
+	// Recording in the new period starts a fresh count
+	if err := storage.UpdateUsage("test-key", thisMonth(), 1, 10); err != nil {
+		t.Fatalf("Failed to update usage: %v", err)
+	}
+
+	usage, _ = storage.GetUsage("test-key", thisMonth())
+	if usage.RequestCount != 1 || usage.BytesTransferred != 10 {
+		t.Errorf("Expected 1 request and 10 bytes, got %d requests, %d bytes", usage.RequestCount, usage.BytesTransferred)
+	}
+}
+
+// TestUpdateUsageStraddlingRollover tests requests that started in one period and finish in the next
+// while other processes record in the new period
+func TestUpdateUsageStraddlingRollover(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	storages := make([]*SQLiteStorage, 2)
+	for i := range storages {
+		storage, err := NewSQLiteStorage(dbPath)
+		if err != nil {
+			t.Fatalf("Failed to create storage %d: %v", i, err)
+		}
+		defer storage.Close()
+		storages[i] = storage
+	}
+
+	lastMonth := thisMonth().AddDate(0, -1, 0)
+	if err := storages[0].UpdateUsage("test-key", lastMonth, 10, 100); err != nil {
+		t.Fatalf("Failed to update usage: %v", err)
+	}
+
+	// Tail requests of last month and new requests of this month complete interleaved
+	const workers = 10
+	const updates = 20
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(storages)*workers*updates)
+	for _, storage := range storages {
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(storage *SQLiteStorage, periodStart time.Time) {
+				defer wg.Done()
+				for j := 0; j < updates; j++ {
+					if err := storage.UpdateUsage("test-key", periodStart, 1, 10); err != nil {
+						errs <- err
+					}
+				}
+			}(storage, []time.Time{lastMonth, thisMonth()}[i%2])
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Unexpected storage error: %v", err)
+	}
+
+	perPeriod := int64(len(storages) * workers / 2 * updates)
+
+	current, err := storages[0].GetUsage("test-key", thisMonth())
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if current.RequestCount != perPeriod || current.BytesTransferred != perPeriod*10 {
+		t.Errorf("Expected %d requests this month, got %+v", perPeriod, current)
+	}
+
+	previous, err := storages[1].GetUsage("test-key", lastMonth)
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if previous.RequestCount != perPeriod+10 || previous.BytesTransferred != perPeriod*10+100 {
+		t.Errorf("Expected %d requests last month, got %+v", perPeriod+10, previous)
+	}
+
+	// Only the period before the stored one is retained
+	err = storages[0].UpdateUsage("test-key", lastMonth.AddDate(0, -1, 0), 1, 10)
+	if !errors.Is(err, ErrStoragePeriodGone) {
+		t.Errorf("Expected ErrStoragePeriodGone, got %v", err)
+	}
+}
+
 // TestConcurrentAccess tests concurrent access to storage
 func TestConcurrentAccess(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -340,7 +457,7 @@ func TestConcurrentAccess(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func() {
 			for j := 0; j < 100; j++ {
-				storage.UpdateUsage("concurrent-key", 1, 100)
+				storage.UpdateUsage("concurrent-key", thisMonth(), 1, 100)
 			}
 			done <- true
 		}()
@@ -352,7 +469,7 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 
 	// Verify final count
-	usage, err := storage.GetUsage("concurrent-key")
+	usage, err := storage.GetUsage("concurrent-key", thisMonth())
 	if err != nil {
 		t.Fatalf("Failed to get usage: %v", err)
 	}
@@ -362,3 +479,179 @@ func TestConcurrentAccess(t *testing.T) {
 		t.Errorf("Expected RequestCount %d, got %d", expected, usage.RequestCount)
 	}
 }
+
+// TestSQLiteStorageWALMode tests that the database is opened in WAL mode with a busy timeout
+func TestSQLiteStorageWALMode(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	var journalMode string
+	if err := storage.db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+		t.Fatalf("Failed to read journal mode: %v", err)
+	}
+	if journalMode != "wal" {
+		t.Errorf("Expected journal mode wal, got %q", journalMode)
+	}
+
+	var busyTimeout int64
+	if err := storage.db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+		t.Fatalf("Failed to read busy timeout: %v", err)
+	}
+	if busyTimeout != sqliteBusyTimeout.Milliseconds() {
+		t.Errorf("Expected busy timeout %d, got %d", sqliteBusyTimeout.Milliseconds(), busyTimeout)
+	}
+}
+
+// TestConcurrentAccessMultipleWriters stresses one database file from two storages,
+// as two worker processes would, and expects no lock errors
+func TestConcurrentAccessMultipleWriters(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	storages := make([]*SQLiteStorage, 2)
+	for i := range storages {
+		storage, err := NewSQLiteStorage(dbPath)
+		if err != nil {
+			t.Fatalf("Failed to create storage %d: %v", i, err)
+		}
+		defer storage.Close()
+		storages[i] = storage
+	}
+
+	const workers = 25
+	const updates = 40
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(storages)*workers*updates)
+	for _, storage := range storages {
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(storage *SQLiteStorage) {
+				defer wg.Done()
+				for j := 0; j < updates; j++ {
+					if err := storage.UpdateUsage("stress-key", thisMonth(), 1, 10); err != nil {
+						errs <- err
+					}
+					if _, err := storage.GetUsage("stress-key", thisMonth()); err != nil {
+						errs <- err
+					}
+				}
+			}(storage)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Unexpected storage error: %v", err)
+	}
+
+	usage, err := storages[0].GetUsage("stress-key", thisMonth())
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+
+	expected := int64(len(storages) * workers * updates)
+	if usage.RequestCount != expected {
+		t.Errorf("Expected RequestCount %d, got %d", expected, usage.RequestCount)
+	}
+	if usage.BytesTransferred != expected*10 {
+		t.Errorf("Expected BytesTransferred %d, got %d", expected*10, usage.BytesTransferred)
+	}
+}
+
+// TestStartPeriod tests that stored usage moves into a new period exactly once
+func TestStartPeriod(t *testing.T) {
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	defer storage.Close()
+
+	lastMonth := thisMonth().AddDate(0, -1, 0)
+	storage.UpdateUsage("test-key", lastMonth, 40, 1024)
+
+	calls := 0
+	rollover := func(previous *Usage) int64 {
+		calls++
+		if previous.RequestCount != 40 || !previous.PeriodStart.Equal(lastMonth) {
+			t.Errorf("Expected last month's 40 requests, got %d in %v", previous.RequestCount, previous.PeriodStart)
+		}
+		return 15
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := storage.StartPeriod("test-key", thisMonth(), rollover); err != nil {
+			t.Fatalf("Failed to start period: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected rollover to be computed once, got %d", calls)
+	}
+
+	usage, err := storage.GetUsage("test-key", thisMonth())
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if usage.RequestCount != 0 || usage.BytesTransferred != 0 || usage.RolloverRequests != 15 {
+		t.Errorf("Expected fresh usage with 15 rollover requests, got %+v", usage)
+	}
+
+	// Recording and resetting within the period keep the bonus
+	storage.UpdateUsage("test-key", thisMonth(), 1, 10)
+	storage.ResetUsage("test-key", thisMonth())
+	usage, _ = storage.GetUsage("test-key", thisMonth())
+	if usage.RolloverRequests != 15 {
+		t.Errorf("Expected rollover to survive updates and reset, got %d", usage.RolloverRequests)
+	}
+
+	// Keys without stored usage are left alone
+	if err := storage.StartPeriod("new-key", thisMonth(), rollover); err != nil {
+		t.Fatalf("Failed to start period: %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected no rollover for a new key, got %d calls", calls)
+	}
+}
+
+// TestSQLiteStorageMigratesRolloverColumn tests opening a database created before rollover support
+func TestSQLiteStorageMigratesRolloverColumn(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE quota_usage (
+		key_id TEXT PRIMARY KEY,
+		request_count INTEGER NOT NULL DEFAULT 0,
+		bytes_transferred INTEGER NOT NULL DEFAULT 0,
+		last_request_time DATETIME,
+		period_start DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+	INSERT INTO quota_usage (key_id, request_count, bytes_transferred, period_start, updated_at)
+	VALUES ('old-key', 7, 70, ?, ?);
+	`, thisMonth(), time.Now())
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	storage, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open old database: %v", err)
+	}
+	defer storage.Close()
+
+	usage, err := storage.GetUsage("old-key", thisMonth())
+	if err != nil {
+		t.Fatalf("Failed to get usage: %v", err)
+	}
+	if usage.RequestCount != 7 || usage.RolloverRequests != 0 {
+		t.Errorf("Expected 7 requests and no rollover, got %+v", usage)
+	}
+}
@@ -0,0 +1,193 @@
+package quota
+
+import (
+	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// UsageMetrics holds gauges derived from a scan of all stored usage
+type UsageMetrics struct {
+	NearLimitKeys prometheus.Gauge
+	ExceededKeys  prometheus.Gauge
+}
+
+// NewUsageMetrics creates new quota usage metrics
+func NewUsageMetrics() *UsageMetrics {
+	return NewUsageMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewUsageMetricsWithRegistry creates new quota usage metrics with a custom registry
+func NewUsageMetricsWithRegistry(reg prometheus.Registerer) *UsageMetrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &UsageMetrics{
+		NearLimitKeys: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_quota_near_limit_keys",
+				Help: "Number of API keys at or above the near-limit percentage of a quota but not yet over it",
+			},
+		),
+		ExceededKeys: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_quota_exceeded_keys",
+				Help: "Number of API keys that have used up a request or data transfer quota",
+			},
+		),
+	}
+}
+
+// UsageReporterConfig holds configuration for the quota usage reporter
+type UsageReporterConfig struct {
+	// NearLimitPercent is the share of a limit, in percent, at which a key counts as near its limit
+	NearLimitPercent float64
+
+	// RefreshInterval is how often usage is rescanned
+	RefreshInterval time.Duration
+
+	// Metrics is the metrics collector
+	Metrics *UsageMetrics
+}
+
+// DefaultUsageReporterConfig returns default usage reporter configuration
+func DefaultUsageReporterConfig() *UsageReporterConfig {
+	return &UsageReporterConfig{
+		NearLimitPercent: 90,
+		RefreshInterval:  30 * time.Second,
+		Metrics:          nil, // Will be created by NewUsageReporter
+	}
+}
+
+// UsageSummary counts keys by how close their current-period usage is to their limits
+type UsageSummary struct {
+	NearLimit int // At or above the near-limit fraction of a limit, not exceeded
+	Exceeded  int // At or above a request or bytes limit
+}
+
+// SummarizeUsage scans all stored usage against the keys' limits
+// nearLimitFraction is in (0, 1]; usage from an earlier period does not count
+func (m *Manager) SummarizeUsage(nearLimitFraction float64) (*UsageSummary, error) {
+	usages, err := m.storage.ListAllUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	summary := &UsageSummary{}
+	for _, usage := range usages {
+		limit := m.GetLimit(usage.KeyID)
+		if usage.PeriodStart.Before(m.periodFor(limit).Start(now)) {
+			continue
+		}
+
+		fraction := usageFraction(usage.RequestCount, effectiveRequestLimit(limit, usage))
+		fraction = max(fraction, usageFraction(usage.BytesTransferred, limit.MonthlyBytesLimit))
+
+		switch {
+		case fraction >= 1:
+			summary.Exceeded++
+		case fraction >= nearLimitFraction:
+			summary.NearLimit++
+		}
+	}
+
+	return summary, nil
+}
+
+// usageFraction returns used/limit, or 0 for an unlimited quota
+func usageFraction(used, limit int64) float64 {
+	if limit <= 0 {
+		return 0
+	}
+	return float64(used) / float64(limit)
+}
+
+// UsageReporter periodically refreshes the quota usage gauges
+type UsageReporter struct {
+	manager  *Manager
+	config   *UsageReporterConfig
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	mu          sync.RWMutex
+	summary     *UsageSummary
+	refreshedAt time.Time
+}
+
+// NewUsageReporter creates a usage reporter and starts refreshing its gauges
+func NewUsageReporter(manager *Manager, config *UsageReporterConfig) *UsageReporter {
+	if config == nil {
+		config = DefaultUsageReporterConfig()
+	}
+	if config.RefreshInterval <= 0 {
+		config.RefreshInterval = 30 * time.Second
+	}
+	if config.Metrics == nil {
+		config.Metrics = NewUsageMetrics()
+	}
+
+	r := &UsageReporter{
+		manager: manager,
+		config:  config,
+		stopCh:  make(chan struct{}),
+	}
+
+	r.refresh()
+	go r.refreshLoop()
+
+	return r
+}
+
+// refreshLoop periodically recomputes the usage gauges
+func (r *UsageReporter) refreshLoop() {
+	ticker := time.NewTicker(r.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.refresh()
+		case <-r.stopCh:
+			return
+		}
+	}
+}
+
+// refresh scans usage and updates the gauges; on error the previous values are kept
+func (r *UsageReporter) refresh() {
+	summary, err := r.manager.SummarizeUsage(r.config.NearLimitPercent / 100)
+	if err != nil {
+		logging.Warn("Failed to refresh quota usage metrics", "error", err)
+		return
+	}
+
+	r.config.Metrics.NearLimitKeys.Set(float64(summary.NearLimit))
+	r.config.Metrics.ExceededKeys.Set(float64(summary.Exceeded))
+
+	r.mu.Lock()
+	r.summary = summary
+	r.refreshedAt = time.Now()
+	r.mu.Unlock()
+}
+
+// Summary returns the usage summary behind the gauges and when it was computed
+// The summary is nil until a refresh has succeeded
+func (r *UsageReporter) Summary() (*UsageSummary, time.Time) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.summary, r.refreshedAt
+}
+
+// Stop stops refreshing the usage gauges
+func (r *UsageReporter) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stopCh)
+	})
+}
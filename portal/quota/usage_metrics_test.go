@@ -0,0 +1,123 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// gaugeValue reads the current value of a gauge
+func gaugeValue(t *testing.T, g prometheus.Gauge) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := g.Write(m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	return m.Gauge.GetValue()
+}
+
+// newUsageTestManager returns a manager with keys near, over and well under their limits
+func newUsageTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	storage, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create storage: %v", err)
+	}
+	manager := NewManager(storage, 1000, 1<<30, 10)
+	t.Cleanup(func() { manager.Close() })
+
+	for _, keyID := range []string{"near", "exceeded", "under", "stale"} {
+		if err := manager.SetLimit(&QuotaLimit{KeyID: keyID, MonthlyRequestLimit: 100}); err != nil {
+			t.Fatalf("Failed to set limit: %v", err)
+		}
+	}
+	if err := manager.SetLimit(&QuotaLimit{KeyID: "near-bytes", MonthlyBytesLimit: 1000}); err != nil {
+		t.Fatalf("Failed to set limit: %v", err)
+	}
+
+	current := MonthlyPeriod{}.Start(time.Now())
+	usage := []struct {
+		keyID       string
+		periodStart time.Time
+		requests    int64
+		bytes       int64
+	}{
+		{"near", current, 92, 0},
+		{"exceeded", current, 100, 0},
+		{"under", current, 10, 0},
+		{"near-bytes", current, 1, 950},
+		{"stale", current.AddDate(0, -1, 0), 500, 0}, // Last period's usage no longer counts
+	}
+	for _, u := range usage {
+		if err := storage.UpdateUsage(u.keyID, u.periodStart, u.requests, u.bytes); err != nil {
+			t.Fatalf("Failed to record usage: %v", err)
+		}
+	}
+
+	return manager
+}
+
+// TestSummarizeUsage tests counting keys near and over their limits
+func TestSummarizeUsage(t *testing.T) {
+	manager := newUsageTestManager(t)
+
+	summary, err := manager.SummarizeUsage(0.9)
+	if err != nil {
+		t.Fatalf("Failed to summarize usage: %v", err)
+	}
+	if summary.NearLimit != 2 || summary.Exceeded != 1 {
+		t.Errorf("Expected 2 near limit and 1 exceeded, got %+v", summary)
+	}
+
+	summary, err = manager.SummarizeUsage(0.95)
+	if err != nil {
+		t.Fatalf("Failed to summarize usage: %v", err)
+	}
+	if summary.NearLimit != 1 || summary.Exceeded != 1 {
+		t.Errorf("Expected 1 near limit and 1 exceeded at 95%%, got %+v", summary)
+	}
+}
+
+// TestUsageReporter tests that the reporter sets its gauges on start and keeps them current
+func TestUsageReporter(t *testing.T) {
+	manager := newUsageTestManager(t)
+
+	config := DefaultUsageReporterConfig()
+	config.RefreshInterval = 10 * time.Millisecond
+	config.Metrics = NewUsageMetricsWithRegistry(prometheus.NewRegistry())
+
+	reporter := NewUsageReporter(manager, config)
+	defer reporter.Stop()
+
+	if got := gaugeValue(t, config.Metrics.NearLimitKeys); got != 2 {
+		t.Errorf("Expected 2 near-limit keys, got %v", got)
+	}
+	if got := gaugeValue(t, config.Metrics.ExceededKeys); got != 1 {
+		t.Errorf("Expected 1 exceeded key, got %v", got)
+	}
+
+	summary, refreshedAt := reporter.Summary()
+	if summary == nil || summary.NearLimit != 2 || summary.Exceeded != 1 {
+		t.Errorf("Expected the summary to match the gauges, got %+v", summary)
+	}
+	if refreshedAt.IsZero() {
+		t.Error("Expected the refresh time to be set")
+	}
+
+	if err := manager.ResetQuota("exceeded"); err != nil {
+		t.Fatalf("Failed to reset quota: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for gaugeValue(t, config.Metrics.ExceededKeys) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected exceeded keys to drop to 0 after a refresh")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
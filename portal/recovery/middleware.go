@@ -0,0 +1,157 @@
+package recovery
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics holds panic recovery metrics
+type Metrics struct {
+	PanicsTotal prometheus.Counter
+}
+
+// NewMetrics creates new recovery metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new recovery metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		PanicsTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "portal_panics_total",
+				Help: "Total number of panics recovered from request handlers",
+			},
+		),
+	}
+}
+
+// MiddlewareConfig holds recovery middleware configuration
+type MiddlewareConfig struct {
+	// Logger is used to log recovered panics (nil uses logging.Default())
+	Logger *logging.Logger
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+}
+
+// DefaultMiddlewareConfig returns default configuration
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{
+		Logger:  nil, // Uses logging.Default() at log time
+		Metrics: nil, // Will be created by NewMiddleware
+	}
+}
+
+// Middleware recovers panics from downstream handlers
+type Middleware struct {
+	config *MiddlewareConfig
+}
+
+// NewMiddleware creates a new recovery middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	return &Middleware{
+		config: config,
+	}
+}
+
+// Middleware returns an http.Handler that turns a panic into a logged 500 response
+// If the response has already started, the connection is aborted instead so the
+// client cannot mistake a truncated response for a complete one
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		wrapped := &recoveryResponseWriter{ResponseWriter: w}
+
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+
+			// ErrAbortHandler is the sanctioned way to abort a response; let the server handle it
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+
+			m.config.Metrics.PanicsTotal.Inc()
+			m.logPanic(r, p, debug.Stack())
+
+			if wrapped.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+
+			problem.Write(w, r, http.StatusInternalServerError, "internal_error", "Internal server error")
+		}()
+
+		next.ServeHTTP(wrapped, r)
+	})
+}
+
+// logPanic logs a recovered panic at Error level
+func (m *Middleware) logPanic(r *http.Request, p any, stack []byte) {
+	logger := m.config.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
+	logger.WithContext(r.Context()).Error("Panic recovered",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("panic", fmt.Sprint(p)),
+		slog.String("stack", string(stack)),
+	)
+}
+
+// GetMetrics returns the metrics collector
+func (m *Middleware) GetMetrics() *Metrics {
+	return m.config.Metrics
+}
+
+// recoveryResponseWriter wraps http.ResponseWriter to track if the response has started
+type recoveryResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoveryResponseWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recoveryResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher; flushing commits the response header
+func (w *recoveryResponseWriter) Flush() {
+	w.wroteHeader = true
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *recoveryResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,166 @@
+package recovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestMiddleware creates a middleware with fresh metrics that logs to buf
+func newTestMiddleware(buf *bytes.Buffer) *Middleware {
+	return NewMiddleware(&MiddlewareConfig{
+		Logger: logging.NewLogger(&logging.Config{
+			Level:  slog.LevelInfo,
+			Format: logging.FormatJSON,
+			Output: buf,
+		}),
+		Metrics: NewMetricsWithRegistry(prometheus.NewRegistry()),
+	})
+}
+
+// panicsTotal reads the current panic count
+func panicsTotal(t *testing.T, m *Middleware) float64 {
+	t.Helper()
+
+	metric := &dto.Metric{}
+	if err := m.GetMetrics().PanicsTotal.Write(metric); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	return metric.GetCounter().GetValue()
+}
+
+func TestNewMiddlewareWithDefaults(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		Metrics: NewMetricsWithRegistry(prometheus.NewRegistry()),
+	})
+
+	if m.GetMetrics() == nil {
+		t.Error("Expected metrics to be set")
+	}
+}
+
+func TestMiddlewareNoPanic(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := newTestMiddleware(buf)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+	if rr.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", rr.Code)
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected no log output, got %q", buf.String())
+	}
+
+	if got := panicsTotal(t, m); got != 0 {
+		t.Errorf("Expected 0 panics, got %v", got)
+	}
+}
+
+func TestMiddlewareRecoversPanic(t *testing.T) {
+	buf := &bytes.Buffer{}
+	m := newTestMiddleware(buf)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("proxy exploded")
+	}))
+
+	ctx := logging.ContextWithRequestID(context.Background(), "req-123")
+	req := httptest.NewRequest("POST", "/peer/lease", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500, got %d", rr.Code)
+	}
+
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON content type, got %q", rr.Header().Get("Content-Type"))
+	}
+
+	if !strings.Contains(rr.Body.String(), `"error":"internal_error"`) {
+		t.Errorf("Expected internal_error body, got %q", rr.Body.String())
+	}
+
+	if got := panicsTotal(t, m); got != 1 {
+		t.Errorf("Expected 1 panic, got %v", got)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse log entry %q: %v", buf.String(), err)
+	}
+
+	if entry["level"] != "ERROR" {
+		t.Errorf("Expected ERROR level, got %v", entry["level"])
+	}
+
+	if entry["request_id"] != "req-123" {
+		t.Errorf("Expected request_id req-123, got %v", entry["request_id"])
+	}
+
+	if entry["panic"] != "proxy exploded" {
+		t.Errorf("Expected panic value, got %v", entry["panic"])
+	}
+
+	if stack, _ := entry["stack"].(string); !strings.Contains(stack, "TestMiddlewareRecoversPanic") {
+		t.Errorf("Expected stack trace of the panic, got %q", stack)
+	}
+}
+
+func TestMiddlewarePanicAfterWrite(t *testing.T) {
+	m := newTestMiddleware(&bytes.Buffer{})
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		panic("mid-stream")
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("Expected ErrAbortHandler, got %v", p)
+		}
+
+		if got := panicsTotal(t, m); got != 1 {
+			t.Errorf("Expected 1 panic, got %v", got)
+		}
+	}()
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+}
+
+func TestMiddlewareAbortHandlerPassesThrough(t *testing.T) {
+	m := newTestMiddleware(&bytes.Buffer{})
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Errorf("Expected ErrAbortHandler, got %v", p)
+		}
+
+		if got := panicsTotal(t, m); got != 0 {
+			t.Errorf("Expected aborts not to be counted, got %v", got)
+		}
+	}()
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+}
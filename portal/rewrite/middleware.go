@@ -0,0 +1,305 @@
+package rewrite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// Hook transforms a lease's requests before they reach the upstream and its responses
+// before they reach the client
+// Hooks run on the request path, so they must be fast and must not block
+type Hook interface {
+	// RewriteRequest modifies the request in place before it is handled
+	RewriteRequest(r *http.Request)
+
+	// RewriteResponse modifies the response header just before it is written
+	RewriteResponse(r *http.Request, statusCode int, header http.Header)
+}
+
+// HeaderRules are header edits applied in order: rename, then remove, then set
+type HeaderRules struct {
+	Set    map[string]string // Header name -> value, replacing any existing values
+	Remove []string          // Header names to drop
+	Rename map[string]string // Old header name -> new name, keeping the values
+}
+
+// Rule is a hook built from header rewrite rules for a lease
+type Rule struct {
+	LeaseID  string // Lease ID (supports wildcards like "legacy-*")
+	Request  HeaderRules
+	Response HeaderRules
+
+	// RedirectHosts rewrites the host of absolute Location headers, e.g.
+	// "backend.internal:8080" -> "api.example.com"; hosts are matched case-insensitively
+	RedirectHosts map[string]string
+}
+
+// RewriteRequest applies the request header rules
+func (rule *Rule) RewriteRequest(r *http.Request) {
+	applyHeaderRules(r.Header, &rule.Request)
+}
+
+// RewriteResponse applies the response header rules and the redirect host rewrite
+func (rule *Rule) RewriteResponse(r *http.Request, statusCode int, header http.Header) {
+	applyHeaderRules(header, &rule.Response)
+
+	if len(rule.RedirectHosts) > 0 {
+		if location := header.Get("Location"); location != "" {
+			header.Set("Location", rewriteLocation(location, rule.RedirectHosts))
+		}
+	}
+}
+
+// applyHeaderRules applies rules whose header names were canonicalized by AddRule
+func applyHeaderRules(header http.Header, rules *HeaderRules) {
+	for from, to := range rules.Rename {
+		if values, exists := header[from]; exists {
+			delete(header, from)
+			header[to] = values
+		}
+	}
+	for _, name := range rules.Remove {
+		delete(header, name)
+	}
+	for name, value := range rules.Set {
+		header[name] = []string{value}
+	}
+}
+
+// rewriteLocation replaces the host of an absolute redirect target found in hosts
+// Relative and unparsable targets are returned unchanged
+func rewriteLocation(location string, hosts map[string]string) string {
+	target, err := url.Parse(location)
+	if err != nil || target.Host == "" {
+		return location
+	}
+
+	replacement, exists := hosts[strings.ToLower(target.Host)]
+	if !exists {
+		return location
+	}
+
+	target.Host = replacement
+	return target.String()
+}
+
+// MiddlewareConfig holds request and response transformation configuration
+type MiddlewareConfig struct {
+	// Hooks maps lease IDs to their transformation hook
+	Hooks middleware.LeaseRules[Hook]
+}
+
+// Common errors
+var (
+	ErrInvalidHeaderName = errors.New("invalid header name")
+	ErrHookNotFound      = errors.New("rewrite hook not found")
+)
+
+// DefaultMiddlewareConfig returns default transformation configuration with no hooks
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{}
+}
+
+// SetHook adds or replaces the transformation hook for a lease
+func (c *MiddlewareConfig) SetHook(leaseID string, hook Hook) error {
+	if leaseID == "" {
+		return errors.New("lease ID cannot be empty")
+	}
+
+	if hook == nil {
+		return errors.New("rewrite hook cannot be nil")
+	}
+
+	c.Hooks.Set(leaseID, hook)
+	return nil
+}
+
+// AddRule validates header rewrite rules and sets them as the hook for their lease
+// Header names are canonicalized and redirect hosts lowercased, so no work is left for requests
+func (c *MiddlewareConfig) AddRule(rule *Rule) error {
+	if rule == nil {
+		return errors.New("rewrite rule cannot be nil")
+	}
+
+	for _, rules := range []*HeaderRules{&rule.Request, &rule.Response} {
+		if err := canonicalizeHeaderRules(rules); err != nil {
+			return err
+		}
+	}
+
+	hosts := make(map[string]string, len(rule.RedirectHosts))
+	for from, to := range rule.RedirectHosts {
+		if from == "" || to == "" || strings.ContainsAny(from+to, "/?# ") {
+			return fmt.Errorf("invalid redirect host rewrite %q -> %q", from, to)
+		}
+		hosts[strings.ToLower(from)] = to
+	}
+	rule.RedirectHosts = hosts
+
+	return c.SetHook(rule.LeaseID, rule)
+}
+
+// canonicalizeHeaderRules validates header names and rewrites them in canonical form
+func canonicalizeHeaderRules(rules *HeaderRules) error {
+	set := make(map[string]string, len(rules.Set))
+	for name, value := range rules.Set {
+		if !validHeaderName(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidHeaderName, name)
+		}
+		set[http.CanonicalHeaderKey(name)] = value
+	}
+
+	remove := make([]string, 0, len(rules.Remove))
+	for _, name := range rules.Remove {
+		if !validHeaderName(name) {
+			return fmt.Errorf("%w: %q", ErrInvalidHeaderName, name)
+		}
+		remove = append(remove, http.CanonicalHeaderKey(name))
+	}
+
+	rename := make(map[string]string, len(rules.Rename))
+	for from, to := range rules.Rename {
+		if !validHeaderName(from) || !validHeaderName(to) {
+			return fmt.Errorf("%w: rename %q -> %q", ErrInvalidHeaderName, from, to)
+		}
+		rename[http.CanonicalHeaderKey(from)] = http.CanonicalHeaderKey(to)
+	}
+
+	rules.Set, rules.Remove, rules.Rename = set, remove, rename
+	return nil
+}
+
+// validHeaderName reports whether name is a non-empty HTTP token
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c >= 0x7f || strings.ContainsRune(`"(),/:;<=>?@[\]{}`, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveHook removes the transformation hook for a lease
+func (c *MiddlewareConfig) RemoveHook(leaseID string) error {
+	if !c.Hooks.Delete(leaseID) {
+		return fmt.Errorf("%w: %s", ErrHookNotFound, leaseID)
+	}
+	return nil
+}
+
+// GetHook returns the transformation hook for a lease, or nil if its traffic is not rewritten
+func (c *MiddlewareConfig) GetHook(leaseID string) Hook {
+	hook, _ := c.Hooks.Match(leaseID)
+	return hook
+}
+
+// Middleware runs per-lease transformation hooks around the upstream handler
+type Middleware struct {
+	config *MiddlewareConfig
+}
+
+// NewMiddleware creates a new request and response transformation middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	return &Middleware{
+		config: config,
+	}
+}
+
+// Middleware returns an http.Handler that applies the lease's hook to the request and response
+// Leases without a hook pass through untouched
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := middleware.GetLeaseID(r.Context())
+		if leaseID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hook := m.config.GetHook(leaseID)
+		if hook == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		hook.RewriteRequest(r)
+
+		wrapped := &rewriteResponseWriter{
+			ResponseWriter: w,
+			request:        r,
+			hook:           hook,
+		}
+		next.ServeHTTP(wrapped, r)
+
+		// Handlers that never write still produce a response
+		if !wrapped.wroteHeader {
+			wrapped.WriteHeader(http.StatusOK)
+		}
+	})
+}
+
+// rewriteResponseWriter wraps http.ResponseWriter to run the response hook on first write
+type rewriteResponseWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	hook        Hook
+	wroteHeader bool
+}
+
+func (w *rewriteResponseWriter) WriteHeader(code int) {
+	// Informational responses are passed on as they are; the hook sees the final one
+	if !w.wroteHeader && code >= 200 {
+		w.wroteHeader = true
+		w.hook.RewriteResponse(w.request, code, w.ResponseWriter.Header())
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *rewriteResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so streaming responses still flush
+func (w *rewriteResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it
+// A hijacked connection writes its own response, so the response hook does not run
+func (w *rewriteResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *rewriteResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,213 @@
+package rewrite
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+)
+
+// newTestMiddleware creates a middleware with one rewrite rule
+func newTestMiddleware(t *testing.T, rule *Rule) *Middleware {
+	t.Helper()
+
+	config := DefaultMiddlewareConfig()
+	if err := config.AddRule(rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+	return NewMiddleware(config)
+}
+
+func TestMiddlewareRewritesRequestHeaders(t *testing.T) {
+	m := newTestMiddleware(t, &Rule{
+		LeaseID: "lease-1",
+		Request: HeaderRules{
+			Set:    map[string]string{"x-forwarded-prefix": "/legacy"},
+			Remove: []string{"X-Debug"},
+			Rename: map[string]string{"x-old-token": "X-Upstream-Token"},
+		},
+	})
+
+	var received http.Header
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+
+	req := httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1", nil)
+	req.Header.Set("X-Debug", "1")
+	req.Header.Set("X-Old-Token", "abc")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got := received.Get("X-Forwarded-Prefix"); got != "/legacy" {
+		t.Errorf("Expected X-Forwarded-Prefix /legacy, got %q", got)
+	}
+	if received.Get("X-Debug") != "" {
+		t.Error("Expected X-Debug to be removed")
+	}
+	if received.Get("X-Old-Token") != "" || received.Get("X-Upstream-Token") != "abc" {
+		t.Errorf("Expected X-Old-Token renamed to X-Upstream-Token, got %v", received)
+	}
+}
+
+func TestMiddlewareRewritesResponseHeaders(t *testing.T) {
+	m := newTestMiddleware(t, &Rule{
+		LeaseID: "lease-*",
+		Response: HeaderRules{
+			Set:    map[string]string{"Cache-Control": "no-store"},
+			Remove: []string{"x-internal-trace", "Server"},
+			Rename: map[string]string{"X-Backend-Version": "X-Api-Version"},
+		},
+		RedirectHosts: map[string]string{"Backend.Internal:8080": "api.example.com"},
+	})
+
+	tests := []struct {
+		name     string
+		location string
+		expected string
+	}{
+		{"internal redirect", "http://backend.internal:8080/items/1?x=y", "http://api.example.com/items/1?x=y"},
+		{"external redirect", "https://other.example.com/items", "https://other.example.com/items"},
+		{"relative redirect", "/items/1", "/items/1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Location", tt.location)
+				w.Header().Set("X-Internal-Trace", "node-7")
+				w.Header().Set("Server", "legacy/1.0")
+				w.Header().Set("X-Backend-Version", "42")
+				w.Header().Set("Cache-Control", "max-age=60")
+				w.WriteHeader(http.StatusFound)
+			}))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1", nil))
+
+			if rr.Code != http.StatusFound {
+				t.Errorf("Expected status 302, got %d", rr.Code)
+			}
+			if got := rr.Header().Get("Location"); got != tt.expected {
+				t.Errorf("Expected Location %q, got %q", tt.expected, got)
+			}
+			if rr.Header().Get("X-Internal-Trace") != "" || rr.Header().Get("Server") != "" {
+				t.Error("Expected internal headers to be removed")
+			}
+			if rr.Header().Get("X-Api-Version") != "42" || rr.Header().Get("X-Backend-Version") != "" {
+				t.Errorf("Expected X-Backend-Version renamed to X-Api-Version, got %v", rr.Header())
+			}
+			if got := rr.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Expected Cache-Control no-store, got %q", got)
+			}
+		})
+	}
+}
+
+func TestMiddlewareImplicitResponse(t *testing.T) {
+	m := newTestMiddleware(t, &Rule{
+		LeaseID:  "lease-1",
+		Response: HeaderRules{Set: map[string]string{"X-Gateway": "portal"}},
+	})
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"write without header", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }},
+		{"no write", func(w http.ResponseWriter, r *http.Request) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			m.Middleware(tt.handler).ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1", nil))
+
+			if rr.Header().Get("X-Gateway") != "portal" {
+				t.Error("Expected the response hook to run")
+			}
+		})
+	}
+}
+
+func TestMiddlewareWithoutHook(t *testing.T) {
+	m := newTestMiddleware(t, &Rule{
+		LeaseID:  "lease-1",
+		Response: HeaderRules{Remove: []string{"Server"}},
+	})
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "legacy/1.0")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-2"), "GET", "/peer/lease-2", nil))
+
+	if rr.Header().Get("Server") != "legacy/1.0" {
+		t.Error("Expected a lease without a hook to pass through untouched")
+	}
+}
+
+// statusHook records the status codes its response hook was called with
+type statusHook struct {
+	statuses []int
+}
+
+func (h *statusHook) RewriteRequest(r *http.Request) {}
+
+func (h *statusHook) RewriteResponse(r *http.Request, statusCode int, header http.Header) {
+	h.statuses = append(h.statuses, statusCode)
+}
+
+func TestMiddlewareCustomHook(t *testing.T) {
+	hook := &statusHook{}
+	config := DefaultMiddlewareConfig()
+	if err := config.SetHook("lease-1", hook); err != nil {
+		t.Fatalf("Failed to set hook: %v", err)
+	}
+	m := NewMiddleware(config)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "POST", "/peer/lease-1", nil))
+
+	// The hook sees only the final status, once
+	if len(hook.statuses) != 1 || hook.statuses[0] != http.StatusCreated {
+		t.Errorf("Expected one call with 201, got %v", hook.statuses)
+	}
+
+	if err := config.RemoveHook("lease-1"); err != nil {
+		t.Errorf("Failed to remove hook: %v", err)
+	}
+	if err := config.RemoveHook("lease-1"); !errors.Is(err, ErrHookNotFound) {
+		t.Errorf("Expected ErrHookNotFound, got %v", err)
+	}
+}
+
+func TestConfigAddRuleValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *Rule
+	}{
+		{"nil rule", nil},
+		{"empty lease ID", &Rule{Response: HeaderRules{Remove: []string{"Server"}}}},
+		{"empty header name", &Rule{LeaseID: "lease-1", Response: HeaderRules{Remove: []string{""}}}},
+		{"header name with colon", &Rule{LeaseID: "lease-1", Request: HeaderRules{Set: map[string]string{"X-Bad:": "1"}}}},
+		{"rename to invalid name", &Rule{LeaseID: "lease-1", Request: HeaderRules{Rename: map[string]string{"X-Old": "X New"}}}},
+		{"redirect host with path", &Rule{LeaseID: "lease-1", RedirectHosts: map[string]string{"backend": "api.example.com/v1"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := DefaultMiddlewareConfig().AddRule(tt.rule); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package saturation
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Rejection reasons reported by the limiting layers
+const (
+	ReasonRateLimit   = "rate_limit"
+	ReasonQuota       = "quota"
+	ReasonConcurrency = "concurrency"
+	ReasonCircuitOpen = "circuit_open"
+)
+
+// Metrics holds saturation metrics
+type Metrics struct {
+	Saturation      prometheus.Gauge
+	RejectionsTotal *prometheus.CounterVec
+}
+
+// NewMetrics creates new saturation metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new saturation metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		Saturation: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_saturation",
+				Help: "Share of recent requests rejected by rate limit, quota, concurrency or open circuit breaker (0-1)",
+			},
+		),
+		RejectionsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_saturation_rejections_total",
+				Help: "Total number of rejections counted toward saturation",
+			},
+			[]string{"reason"},
+		),
+	}
+}
+
+// Config holds saturation tracker configuration
+type Config struct {
+	// Window is how far back requests and rejections are counted
+	Window time.Duration
+
+	// Resolution is the bucket width; the window slides and the gauge refreshes in these steps
+	Resolution time.Duration
+
+	// MinRequests is the fewest requests in the window for saturation to be reported;
+	// below it the gauge reads 0, so a few rejections on an idle gateway do not trigger scaling
+	MinRequests int64
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+}
+
+// DefaultConfig returns default saturation tracker configuration
+func DefaultConfig() *Config {
+	return &Config{
+		Window:      time.Minute,
+		Resolution:  5 * time.Second,
+		MinRequests: 20,
+		Metrics:     nil, // Will be created by NewTracker
+	}
+}
+
+// bucket counts requests and rejections over one resolution step
+type bucket struct {
+	requests   int64
+	rejections int64
+}
+
+// Tracker aggregates rejections from the limiting layers into one saturation signal
+// Requests are counted by its middleware, rejections are reported by the layers it wraps
+type Tracker struct {
+	config       *Config
+	buckets      []bucket
+	current      int       // Index of the bucket for the current step
+	currentStart time.Time // Start of the current step
+	now          func() time.Time
+	mu           sync.Mutex
+	stopCh       chan struct{}
+	stopOnce     sync.Once
+}
+
+// NewTracker creates a saturation tracker and starts refreshing its gauge
+func NewTracker(config *Config) *Tracker {
+	t := newTracker(config, time.Now)
+	go t.refreshLoop()
+	return t
+}
+
+// newTracker creates a tracker with the given clock without starting the refresh loop
+func newTracker(config *Config, now func() time.Time) *Tracker {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.Resolution <= 0 || config.Resolution > config.Window {
+		config.Resolution = config.Window
+	}
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	return &Tracker{
+		config:       config,
+		buckets:      make([]bucket, int((config.Window+config.Resolution-1)/config.Resolution)),
+		currentStart: now(),
+		now:          now,
+		stopCh:       make(chan struct{}),
+	}
+}
+
+// Middleware returns an http.Handler that counts every request toward the saturation window
+// It must wrap all layers that report rejections, so each rejection has a counted request
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.mu.Lock()
+		t.advance()
+		t.buckets[t.current].requests++
+		t.mu.Unlock()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RecordRejection counts a request turned away by a limiting layer
+func (t *Tracker) RecordRejection(reason string) {
+	t.config.Metrics.RejectionsTotal.WithLabelValues(reason).Inc()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.advance()
+	t.buckets[t.current].rejections++
+}
+
+// Saturation returns the share of requests in the window that were rejected, in [0, 1]
+func (t *Tracker) Saturation() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.advance()
+
+	var requests, rejections int64
+	for _, b := range t.buckets {
+		requests += b.requests
+		rejections += b.rejections
+	}
+
+	if requests == 0 || requests < t.config.MinRequests {
+		return 0
+	}
+	return min(float64(rejections)/float64(requests), 1)
+}
+
+// advance moves the window forward to the current time, clearing expired buckets; callers hold t.mu
+func (t *Tracker) advance() {
+	steps := int(t.now().Sub(t.currentStart) / t.config.Resolution)
+	if steps <= 0 {
+		return
+	}
+
+	if steps >= len(t.buckets) {
+		clear(t.buckets)
+	} else {
+		for i := 0; i < steps; i++ {
+			t.current = (t.current + 1) % len(t.buckets)
+			t.buckets[t.current] = bucket{}
+		}
+	}
+
+	t.currentStart = t.currentStart.Add(time.Duration(steps) * t.config.Resolution)
+}
+
+// refreshLoop periodically updates the saturation gauge
+func (t *Tracker) refreshLoop() {
+	ticker := time.NewTicker(t.config.Resolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			t.config.Metrics.Saturation.Set(t.Saturation())
+		case <-t.stopCh:
+			return
+		}
+	}
+}
+
+// Stop stops refreshing the saturation gauge
+func (t *Tracker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+	})
+}
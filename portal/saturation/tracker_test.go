@@ -0,0 +1,125 @@
+package saturation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestTracker creates a tracker on a fake clock with its own registry
+func newTestTracker(t *testing.T, minRequests int64) (*Tracker, *time.Time) {
+	t.Helper()
+
+	now := time.Unix(1_700_000_000, 0)
+	config := &Config{
+		Window:      time.Minute,
+		Resolution:  10 * time.Second,
+		MinRequests: minRequests,
+		Metrics:     NewMetricsWithRegistry(prometheus.NewRegistry()),
+	}
+	return newTracker(config, func() time.Time { return now }), &now
+}
+
+// serve sends n requests through the tracker, rejecting the first rejected of them
+func serve(tracker *Tracker, n, rejected int) {
+	handler := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rejected > 0 {
+			rejected--
+			tracker.RecordRejection(ReasonRateLimit)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for i := 0; i < n; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/peer/lease-1", nil))
+	}
+}
+
+func TestTrackerSaturation(t *testing.T) {
+	tracker, _ := newTestTracker(t, 0)
+
+	if got := tracker.Saturation(); got != 0 {
+		t.Errorf("Expected 0 saturation with no traffic, got %v", got)
+	}
+
+	serve(tracker, 10, 3)
+	if got := tracker.Saturation(); got != 0.3 {
+		t.Errorf("Expected 0.3 saturation, got %v", got)
+	}
+
+	// A fully rejected burst raises the share across the whole window
+	serve(tracker, 10, 10)
+	if got := tracker.Saturation(); got != 0.65 {
+		t.Errorf("Expected 0.65 saturation, got %v", got)
+	}
+}
+
+func TestTrackerWindowSlides(t *testing.T) {
+	tracker, now := newTestTracker(t, 0)
+
+	serve(tracker, 10, 10)
+
+	// Half a minute later the rejections are still in the window
+	*now = now.Add(30 * time.Second)
+	serve(tracker, 10, 0)
+	if got := tracker.Saturation(); got != 0.5 {
+		t.Errorf("Expected 0.5 saturation, got %v", got)
+	}
+
+	// Once the first burst leaves the window only the healthy requests remain
+	*now = now.Add(35 * time.Second)
+	if got := tracker.Saturation(); got != 0 {
+		t.Errorf("Expected 0 saturation after the rejections expired, got %v", got)
+	}
+
+	// A gap longer than the window clears everything
+	*now = now.Add(10 * time.Minute)
+	if got := tracker.Saturation(); got != 0 {
+		t.Errorf("Expected 0 saturation after an idle window, got %v", got)
+	}
+}
+
+func TestTrackerMinRequests(t *testing.T) {
+	tracker, _ := newTestTracker(t, 20)
+
+	serve(tracker, 5, 5)
+	if got := tracker.Saturation(); got != 0 {
+		t.Errorf("Expected 0 saturation below the minimum request count, got %v", got)
+	}
+
+	serve(tracker, 15, 0)
+	if got := tracker.Saturation(); got != 0.25 {
+		t.Errorf("Expected 0.25 saturation at the minimum request count, got %v", got)
+	}
+}
+
+func TestTrackerRejectionsTotal(t *testing.T) {
+	tracker, _ := newTestTracker(t, 0)
+
+	tracker.RecordRejection(ReasonQuota)
+	tracker.RecordRejection(ReasonQuota)
+	tracker.RecordRejection(ReasonCircuitOpen)
+
+	m := &dto.Metric{}
+	if err := tracker.config.Metrics.RejectionsTotal.WithLabelValues(ReasonQuota).Write(m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	if got := m.Counter.GetValue(); got != 2 {
+		t.Errorf("Expected 2 quota rejections, got %v", got)
+	}
+
+	// Rejections without counted requests still read as at most fully saturated
+	if got := tracker.Saturation(); got != 0 {
+		t.Errorf("Expected 0 saturation without counted requests, got %v", got)
+	}
+	serve(tracker, 1, 0)
+	if got := tracker.Saturation(); got != 1 {
+		t.Errorf("Expected saturation capped at 1, got %v", got)
+	}
+}
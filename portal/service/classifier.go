@@ -0,0 +1,121 @@
+// Package service classifies leases into service types, so features that vary by service
+// (timeouts, AI agent metrics, circuit breaking) all agree on what a lease is
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultService is the service of leases that match no rule
+const DefaultService = "unknown"
+
+// ErrInvalidRule is returned for a classification rule that cannot be used
+var ErrInvalidRule = errors.New("invalid service rule")
+
+// Rule maps lease IDs to a service by prefix or regular expression
+type Rule struct {
+	Service string
+	Prefix  string // Lease IDs starting with Prefix match
+	Pattern string // Lease IDs matching this regular expression match
+
+	pattern *regexp.Regexp
+}
+
+// matches reports whether a lease ID matches the rule
+func (r *Rule) matches(leaseID string) bool {
+	if r.pattern != nil {
+		return r.pattern.MatchString(leaseID)
+	}
+	return strings.HasPrefix(leaseID, r.Prefix)
+}
+
+// Classifier maps lease IDs to services; the first matching rule wins
+type Classifier struct {
+	rules          []*Rule
+	defaultService string
+}
+
+// NewClassifier creates a classifier from rules in priority order
+// Leases matching no rule are classified as defaultService (DefaultService if empty)
+func NewClassifier(rules []*Rule, defaultService string) (*Classifier, error) {
+	if defaultService == "" {
+		defaultService = DefaultService
+	}
+
+	for i, rule := range rules {
+		if rule == nil {
+			return nil, fmt.Errorf("%w: rule %d is nil", ErrInvalidRule, i)
+		}
+
+		if rule.Service == "" {
+			return nil, fmt.Errorf("%w: service is required", ErrInvalidRule)
+		}
+
+		if (rule.Prefix == "") == (rule.Pattern == "") {
+			return nil, fmt.Errorf("%w: exactly one of prefix or pattern is required", ErrInvalidRule)
+		}
+
+		if rule.Pattern != "" {
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidRule, err)
+			}
+			rule.pattern = pattern
+		}
+	}
+
+	return &Classifier{
+		rules:          rules,
+		defaultService: defaultService,
+	}, nil
+}
+
+// Classify returns the service of a lease
+// A nil classifier returns "", so callers can tell classification is not configured
+func (c *Classifier) Classify(leaseID string) string {
+	if c == nil {
+		return ""
+	}
+
+	for _, rule := range c.rules {
+		if rule.matches(leaseID) {
+			return rule.Service
+		}
+	}
+	return c.defaultService
+}
+
+// Services returns every service a lease can be classified as, sorted
+func (c *Classifier) Services() []string {
+	if c == nil {
+		return nil
+	}
+
+	seen := map[string]bool{c.defaultService: true}
+	for _, rule := range c.rules {
+		seen[rule.Service] = true
+	}
+
+	services := make([]string, 0, len(seen))
+	for service := range seen {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// Config holds lease classification and the per-service settings that use it
+type Config struct {
+	Classifier *Classifier
+
+	// Timeouts are request timeouts by service, for leases without their own
+	Timeouts map[string]time.Duration
+
+	// FailureThresholds are circuit breaker failure thresholds by service
+	FailureThresholds map[string]uint32
+}
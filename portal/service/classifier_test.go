@@ -0,0 +1,77 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	classifier, err := NewClassifier([]*Rule{
+		{Service: "mcp", Prefix: "mcp-"},
+		{Service: "openai", Pattern: `^(openai|gpt)-`},
+		{Service: "catch-gpt", Pattern: `gpt`},
+	}, "other")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	tests := []struct {
+		leaseID  string
+		expected string
+	}{
+		{"mcp-tools", "mcp"},
+		{"openai-prod", "openai"},
+		{"gpt-4-relay", "openai"}, // First matching rule wins
+		{"my-gpt", "catch-gpt"},
+		{"billing", "other"},
+		{"", "other"},
+	}
+
+	for _, tt := range tests {
+		if got := classifier.Classify(tt.leaseID); got != tt.expected {
+			t.Errorf("Classify(%q) = %q, expected %q", tt.leaseID, got, tt.expected)
+		}
+	}
+
+	expected := []string{"catch-gpt", "mcp", "openai", "other"}
+	if services := classifier.Services(); !reflect.DeepEqual(services, expected) {
+		t.Errorf("Expected services %v, got %v", expected, services)
+	}
+}
+
+func TestClassifyDefaults(t *testing.T) {
+	var unconfigured *Classifier
+	if got := unconfigured.Classify("mcp-tools"); got != "" {
+		t.Errorf("Expected a nil classifier to classify nothing, got %q", got)
+	}
+
+	classifier, err := NewClassifier(nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+	if got := classifier.Classify("mcp-tools"); got != DefaultService {
+		t.Errorf("Expected %q, got %q", DefaultService, got)
+	}
+}
+
+func TestNewClassifierValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *Rule
+	}{
+		{"nil rule", nil},
+		{"missing service", &Rule{Prefix: "mcp-"}},
+		{"no matcher", &Rule{Service: "mcp"}},
+		{"both matchers", &Rule{Service: "mcp", Prefix: "mcp-", Pattern: "^mcp"}},
+		{"invalid pattern", &Rule{Service: "mcp", Pattern: "(mcp"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClassifier([]*Rule{tt.rule}, ""); !errors.Is(err, ErrInvalidRule) {
+				t.Errorf("Expected ErrInvalidRule, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestAddColumnIfMissing(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`CREATE TABLE items (id INTEGER PRIMARY KEY)`); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := db.Exec(`INSERT INTO items (id) VALUES (1)`); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	// Adding the same column twice leaves the first one in place
+	for i := 0; i < 2; i++ {
+		if err := AddColumnIfMissing(db, "items", "attempts", "INTEGER NOT NULL DEFAULT 3"); err != nil {
+			t.Fatalf("Failed to add column: %v", err)
+		}
+	}
+
+	var attempts int
+	if err := db.QueryRow(`SELECT attempts FROM items WHERE id = 1`).Scan(&attempts); err != nil {
+		t.Fatalf("Failed to read column: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected existing rows to get the default, got %d", attempts)
+	}
+
+	if err := AddColumnIfMissing(db, "missing", "attempts", "INTEGER"); err == nil {
+		t.Error("Expected adding a column to a missing table to fail")
+	}
+}
@@ -0,0 +1,191 @@
+// Package startup holds the gateway back from readiness for a warm-up period after it starts,
+// so a load balancer does not send full traffic to a process that is still cold
+package startup
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+)
+
+// SelfTest is a check that must pass once before the gateway reports ready, e.g. a storage read
+type SelfTest struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// Config holds startup readiness configuration
+type Config struct {
+	// WarmUp is how long after Start the gateway reports not ready (0 = no delay)
+	WarmUp time.Duration
+
+	// RetryInterval is the time between attempts of a failed self-test (default 1s)
+	RetryInterval time.Duration
+
+	// Timeout bounds each self-test attempt (default 5s)
+	Timeout time.Duration
+
+	// Logger receives self-test results (nil = logging.Default())
+	Logger *logging.Logger
+}
+
+// Status is the startup readiness of the gateway
+type Status struct {
+	Ready bool
+
+	// WarmUpRemaining is the time left in the warm-up period
+	WarmUpRemaining time.Duration
+
+	// FailedSelfTests maps self-tests that have not passed yet to their last error
+	FailedSelfTests map[string]string
+}
+
+// Gate reports the gateway not ready until its warm-up period has passed and every self-test
+// has passed once
+// A nil Gate is always ready
+type Gate struct {
+	config    *Config
+	selfTests []SelfTest
+	now       func() time.Time
+
+	mu      sync.RWMutex
+	started time.Time
+	failed  map[string]string // Self-tests that have not passed yet -> last error
+
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewGate creates a startup readiness gate
+func NewGate(config *Config) *Gate {
+	if config == nil {
+		config = &Config{}
+	}
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+
+	return &Gate{
+		config: config,
+		now:    time.Now,
+		failed: make(map[string]string),
+	}
+}
+
+// AddSelfTest adds a self-test that must pass before the gateway is ready
+// Must be called before Start
+func (g *Gate) AddSelfTest(name string, run func(ctx context.Context) error) {
+	g.selfTests = append(g.selfTests, SelfTest{Name: name, Run: run})
+	g.failed[name] = "not run yet"
+}
+
+// HasSelfTests reports whether any self-tests have been added
+func (g *Gate) HasSelfTests() bool {
+	return g != nil && len(g.selfTests) > 0
+}
+
+// Start begins the warm-up period and runs each self-test until it passes or Stop is called
+func (g *Gate) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	g.mu.Lock()
+	g.started = g.now()
+	g.cancel = cancel
+	g.mu.Unlock()
+
+	for _, test := range g.selfTests {
+		g.wg.Add(1)
+		go func(test SelfTest) {
+			defer g.wg.Done()
+
+			ticker := time.NewTicker(g.config.RetryInterval)
+			defer ticker.Stop()
+
+			for !g.runSelfTest(ctx, test) {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(test)
+	}
+}
+
+// Stop stops retrying self-tests and waits for attempts in progress to finish
+func (g *Gate) Stop() {
+	g.stopOnce.Do(func() {
+		g.mu.RLock()
+		cancel := g.cancel
+		g.mu.RUnlock()
+
+		if cancel != nil {
+			cancel()
+		}
+		g.wg.Wait()
+	})
+}
+
+// runSelfTest runs one attempt of a self-test and records the result; it returns true if it passed
+func (g *Gate) runSelfTest(ctx context.Context, test SelfTest) bool {
+	attemptCtx, cancel := context.WithTimeout(ctx, g.config.Timeout)
+	defer cancel()
+
+	err := test.Run(attemptCtx)
+	if err != nil && ctx.Err() != nil {
+		// Stopping; an attempt cut short says nothing about the gateway
+		return false
+	}
+
+	logger := g.config.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err != nil {
+		g.failed[test.Name] = err.Error()
+		logger.Warn("Startup self-test failed", "self_test", test.Name, "error", err)
+		return false
+	}
+
+	delete(g.failed, test.Name)
+	logger.Info("Startup self-test passed", "self_test", test.Name)
+	return true
+}
+
+// Status returns the startup readiness of the gateway
+// Before Start the warm-up period has not begun, so the gateway is not ready
+func (g *Gate) Status() Status {
+	if g == nil {
+		return Status{Ready: true}
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	status := Status{}
+	if g.started.IsZero() {
+		status.WarmUpRemaining = g.config.WarmUp
+	} else {
+		status.WarmUpRemaining = max(g.config.WarmUp-g.now().Sub(g.started), 0)
+	}
+
+	if len(g.failed) > 0 {
+		status.FailedSelfTests = make(map[string]string, len(g.failed))
+		for name, reason := range g.failed {
+			status.FailedSelfTests[name] = reason
+		}
+	}
+
+	status.Ready = !g.started.IsZero() && status.WarmUpRemaining == 0 && len(g.failed) == 0
+	return status
+}
@@ -0,0 +1,99 @@
+package startup
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGateWarmUp(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	gate := NewGate(&Config{WarmUp: 30 * time.Second})
+	gate.now = func() time.Time { return now }
+
+	if gate.Status().Ready {
+		t.Error("Expected the gate not to be ready before Start")
+	}
+
+	gate.Start()
+	defer gate.Stop()
+
+	now = now.Add(10 * time.Second)
+	status := gate.Status()
+	if status.Ready || status.WarmUpRemaining != 20*time.Second {
+		t.Errorf("Expected 20s of warm-up left, got %+v", status)
+	}
+
+	now = now.Add(20 * time.Second)
+	if !gate.Status().Ready {
+		t.Error("Expected the gate to be ready once the warm-up has passed")
+	}
+}
+
+func TestGateNoDelay(t *testing.T) {
+	var unconfigured *Gate
+	if !unconfigured.Status().Ready {
+		t.Error("Expected a nil gate to be ready")
+	}
+
+	gate := NewGate(nil)
+	gate.Start()
+	defer gate.Stop()
+
+	if !gate.Status().Ready {
+		t.Error("Expected a gate without warm-up or self-tests to be ready at once")
+	}
+}
+
+func TestGateSelfTests(t *testing.T) {
+	gate := NewGate(&Config{RetryInterval: 5 * time.Millisecond})
+
+	var attempts atomic.Int32
+	gate.AddSelfTest("storage", func(ctx context.Context) error {
+		if attempts.Add(1) < 3 {
+			return errors.New("database is locked")
+		}
+		return nil
+	})
+	gate.AddSelfTest("config", func(ctx context.Context) error { return nil })
+
+	if !gate.HasSelfTests() {
+		t.Fatal("Expected the gate to have self-tests")
+	}
+
+	status := gate.Status()
+	if status.Ready || len(status.FailedSelfTests) != 2 {
+		t.Errorf("Expected both self-tests pending before Start, got %+v", status)
+	}
+
+	gate.Start()
+	defer gate.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for !gate.Status().Ready {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the self-tests to pass, got %+v", gate.Status())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("Expected the failing self-test to be retried until it passed, got %d attempts", got)
+	}
+}
+
+func TestGateStopWhileFailing(t *testing.T) {
+	gate := NewGate(&Config{RetryInterval: time.Millisecond})
+	gate.AddSelfTest("storage", func(ctx context.Context) error { return errors.New("unavailable") })
+	gate.Start()
+
+	time.Sleep(5 * time.Millisecond)
+	gate.Stop()
+
+	status := gate.Status()
+	if status.Ready || status.FailedSelfTests["storage"] != "unavailable" {
+		t.Errorf("Expected the failing self-test to keep the gate unready, got %+v", status)
+	}
+}
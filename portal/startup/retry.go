@@ -0,0 +1,82 @@
+package startup
+
+import (
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/logging"
+)
+
+// Retry retries a startup step that can fail while something it depends on is not ready yet,
+// such as a data volume that is mounted after the container starts
+type Retry struct {
+	// Attempts is the total number of attempts (1 or less = fail fast)
+	Attempts int
+
+	// InitialBackoff is the wait after the first failure, doubled after each later one (default 1s)
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the wait between attempts (0 = no cap)
+	MaxBackoff time.Duration
+
+	// Clock times the backoff (nil = clock.Real); tests set a clock.Fake
+	Clock clock.Clock
+
+	// Logger receives a record of each failed attempt (nil = logging.Default())
+	Logger *logging.Logger
+}
+
+// DefaultRetry returns the default startup retry: 5 attempts over about 15 seconds
+func DefaultRetry() Retry {
+	return Retry{
+		Attempts:       5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     8 * time.Second,
+	}
+}
+
+// Do runs step until it succeeds or the attempts run out, and returns the last error
+// name identifies the step in the log, e.g. "quota storage"
+func (r Retry) Do(name string, step func() error) error {
+	logger := r.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
+	attempts := max(r.Attempts, 1)
+	backoff := r.InitialBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := step()
+		if err == nil {
+			if attempt > 1 {
+				logger.Info("Startup step succeeded after retrying", "step", name, "attempt", attempt)
+			}
+			return nil
+		}
+
+		if attempt >= attempts {
+			if attempts > 1 {
+				logger.Error("Startup step failed, no attempts left", "step", name, "attempt", attempt, "attempts", attempts, "error", err)
+			}
+			return err
+		}
+
+		if r.MaxBackoff > 0 && backoff > r.MaxBackoff {
+			backoff = r.MaxBackoff
+		}
+		logger.Warn("Startup step failed, retrying",
+			"step", name,
+			"attempt", attempt,
+			"attempts", attempts,
+			"retry_in", backoff,
+			"error", err,
+		)
+
+		<-clock.Or(r.Clock).After(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,97 @@
+package startup
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/logging"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	logs := &bytes.Buffer{}
+	retry := Retry{
+		Attempts:       5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     3 * time.Second,
+		Clock:          fake,
+		Logger:         logging.NewLogger(&logging.Config{Format: logging.FormatJSON, Output: logs}),
+	}
+
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- retry.Do("quota storage", func() error {
+			calls++
+			if calls < 4 {
+				return errors.New("unable to open database file")
+			}
+			return nil
+		})
+	}()
+
+	// Waits double from the initial backoff up to the cap
+	for _, wait := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		fake.BlockUntil(1)
+		fake.Advance(wait - time.Nanosecond)
+		if fake.Waiters() != 1 {
+			t.Fatalf("Expected the retry to wait %v", wait)
+		}
+		fake.Advance(time.Nanosecond)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("Expected the step to succeed on the 4th attempt, got %v", err)
+	}
+	if calls != 4 {
+		t.Errorf("Expected 4 attempts, got %d", calls)
+	}
+	if got := strings.Count(logs.String(), "Startup step failed, retrying"); got != 3 {
+		t.Errorf("Expected each failed attempt to be logged, got %d records", got)
+	}
+	if !strings.Contains(logs.String(), `"step":"quota storage"`) {
+		t.Errorf("Expected the step name to be logged, got %s", logs.String())
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	retry := Retry{Attempts: 2, InitialBackoff: time.Second, Clock: fake, Logger: logging.NewLogger(&logging.Config{Output: &bytes.Buffer{}})}
+
+	stepErr := errors.New("unable to open database file")
+	calls := 0
+	done := make(chan error)
+	go func() {
+		done <- retry.Do("quota storage", func() error {
+			calls++
+			return stepErr
+		})
+	}()
+
+	fake.BlockUntil(1)
+	fake.Advance(time.Second)
+
+	if err := <-done; !errors.Is(err, stepErr) {
+		t.Errorf("Expected the last error, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestRetryFailFast(t *testing.T) {
+	for _, attempts := range []int{0, 1} {
+		calls := 0
+		err := Retry{Attempts: attempts, Logger: logging.NewLogger(&logging.Config{Output: &bytes.Buffer{}})}.Do("quota storage", func() error {
+			calls++
+			return errors.New("unable to open database file")
+		})
+		if err == nil || calls != 1 {
+			t.Errorf("Attempts %d: expected a single failed attempt, got %d attempts and error %v", attempts, calls, err)
+		}
+	}
+}
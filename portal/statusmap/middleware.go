@@ -0,0 +1,224 @@
+package statusmap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics holds status code remapping metrics
+type Metrics struct {
+	RemappedTotal *prometheus.CounterVec
+}
+
+// NewMetrics creates new status remapping metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new status remapping metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		RemappedTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_status_remapped_total",
+				Help: "Total number of upstream responses whose status code was remapped",
+			},
+			[]string{"lease_id", "from", "to"},
+		),
+	}
+}
+
+// Rule remaps upstream status codes for a lease
+type Rule struct {
+	LeaseID string      // Lease ID (supports wildcards like "legacy-*")
+	Codes   map[int]int // Upstream status code to the code sent to the client
+}
+
+// MiddlewareConfig holds status code remapping configuration
+type MiddlewareConfig struct {
+	// Rules maps lease IDs to remapping tables
+	Rules middleware.LeaseRules[*Rule]
+
+	// Metrics is the metrics collector
+	Metrics *Metrics
+}
+
+// Common errors
+var (
+	ErrInvalidStatusCode = errors.New("invalid status code")
+	ErrRuleNotFound      = errors.New("status map rule not found")
+)
+
+// DefaultMiddlewareConfig returns default remapping configuration with no rules
+func DefaultMiddlewareConfig() *MiddlewareConfig {
+	return &MiddlewareConfig{}
+}
+
+// AddRule adds or replaces the remapping table for a lease
+// Upstream codes may be any valid HTTP status from 200 up, including non-standard ones;
+// mapped codes must be between 200 and 599
+func (c *MiddlewareConfig) AddRule(rule *Rule) error {
+	if rule == nil {
+		return errors.New("status map rule cannot be nil")
+	}
+
+	if rule.LeaseID == "" {
+		return errors.New("lease ID cannot be empty")
+	}
+
+	if len(rule.Codes) == 0 {
+		return errors.New("status map rule must remap at least one status code")
+	}
+
+	for from, to := range rule.Codes {
+		// Informational responses may be sent several times before the final one, so they are never remapped
+		if from < 200 || from > 999 {
+			return fmt.Errorf("%w: upstream code %d must be between 200 and 999", ErrInvalidStatusCode, from)
+		}
+		if to < 200 || to > 599 {
+			return fmt.Errorf("%w: code %d for upstream %d must be between 200 and 599", ErrInvalidStatusCode, to, from)
+		}
+	}
+
+	c.Rules.Set(rule.LeaseID, rule)
+	return nil
+}
+
+// RemoveRule removes the remapping table for a lease
+func (c *MiddlewareConfig) RemoveRule(leaseID string) error {
+	if !c.Rules.Delete(leaseID) {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, leaseID)
+	}
+	return nil
+}
+
+// GetRule returns the remapping table for a lease, or nil if its status codes pass through
+func (c *MiddlewareConfig) GetRule(leaseID string) *Rule {
+	rule, _ := c.Rules.Match(leaseID)
+	return rule
+}
+
+// ListRules returns all remapping rules
+func (c *MiddlewareConfig) ListRules() []*Rule {
+	return c.Rules.List()
+}
+
+// Middleware normalizes upstream status codes per lease
+type Middleware struct {
+	config *MiddlewareConfig
+}
+
+// NewMiddleware creates a new status code remapping middleware
+func NewMiddleware(config *MiddlewareConfig) *Middleware {
+	if config == nil {
+		config = DefaultMiddlewareConfig()
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	return &Middleware{
+		config: config,
+	}
+}
+
+// Middleware returns an http.Handler that remaps the status codes of leases with a rule
+// It must sit inside the circuit breaker, so the breaker classifies the remapped code
+// exactly as the client receives it
+func (m *Middleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaseID := middleware.GetLeaseID(r.Context())
+		if leaseID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule := m.config.GetRule(leaseID)
+		if rule == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		wrapped := &statusMapWriter{
+			ResponseWriter: w,
+			rule:           rule,
+			metrics:        m.config.Metrics,
+		}
+		next.ServeHTTP(wrapped, r)
+
+		// An upstream that never writes answers 200, which may itself be remapped
+		if !wrapped.wroteHeader {
+			if _, remapped := rule.Codes[http.StatusOK]; remapped {
+				wrapped.WriteHeader(http.StatusOK)
+			}
+		}
+	})
+}
+
+// statusMapWriter wraps http.ResponseWriter to remap the status code on first write
+type statusMapWriter struct {
+	http.ResponseWriter
+	rule        *Rule
+	metrics     *Metrics
+	wroteHeader bool
+}
+
+func (w *statusMapWriter) WriteHeader(code int) {
+	if w.wroteHeader || code < 200 {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.wroteHeader = true
+
+	if to, remapped := w.rule.Codes[code]; remapped && to != code {
+		w.metrics.RemappedTotal.WithLabelValues(w.rule.LeaseID, strconv.Itoa(code), strconv.Itoa(to)).Inc()
+		code = to
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusMapWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher so streaming responses still flush
+func (w *statusMapWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it
+func (w *statusMapWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
+
+// Unwrap returns the underlying writer for http.ResponseController
+func (w *statusMapWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,185 @@
+package statusmap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/portal-project/portal-gateway/portal/circuitbreaker"
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestConfig creates a remapping config with a fresh metrics registry
+func newTestConfig(t *testing.T, rules ...*Rule) *MiddlewareConfig {
+	t.Helper()
+
+	config := DefaultMiddlewareConfig()
+	config.Metrics = NewMetricsWithRegistry(prometheus.NewRegistry())
+	for _, rule := range rules {
+		if err := config.AddRule(rule); err != nil {
+			t.Fatalf("Failed to add rule: %v", err)
+		}
+	}
+	return config
+}
+
+// statusHandler answers every request with a fixed status code
+func statusHandler(code int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+		w.Write([]byte("upstream body"))
+	})
+}
+
+func TestMiddlewareRemapsStatus(t *testing.T) {
+	config := newTestConfig(t, &Rule{LeaseID: "lease-1", Codes: map[int]int{418: 502, 299: 200}})
+	m := NewMiddleware(config)
+
+	tests := []struct {
+		name     string
+		leaseID  string
+		upstream int
+		expected int
+	}{
+		{"remapped error", "lease-1", 418, http.StatusBadGateway},
+		{"remapped non-standard success", "lease-1", 299, http.StatusOK},
+		{"unmapped code", "lease-1", http.StatusNotFound, http.StatusNotFound},
+		{"lease without rule", "lease-2", 418, 418},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := m.Middleware(statusHandler(tt.upstream))
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), tt.leaseID), "GET", "/peer/"+tt.leaseID, nil))
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, rr.Code)
+			}
+			if rr.Body.String() != "upstream body" {
+				t.Errorf("Expected the upstream body to pass through, got %q", rr.Body.String())
+			}
+		})
+	}
+
+	metric := &dto.Metric{}
+	if err := config.Metrics.RemappedTotal.WithLabelValues("lease-1", "418", "502").Write(metric); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	if got := metric.Counter.GetValue(); got != 1 {
+		t.Errorf("Expected 1 remapped response, got %v", got)
+	}
+}
+
+func TestMiddlewareRemapsImplicitStatus(t *testing.T) {
+	m := NewMiddleware(newTestConfig(t, &Rule{LeaseID: "lease-*", Codes: map[int]int{200: 502}}))
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"write without header", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) }},
+		{"no write", func(w http.ResponseWriter, r *http.Request) {}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			m.Middleware(tt.handler).ServeHTTP(rr, httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), "lease-1"), "GET", "/peer/lease-1", nil))
+
+			if rr.Code != http.StatusBadGateway {
+				t.Errorf("Expected status 502, got %d", rr.Code)
+			}
+		})
+	}
+}
+
+func TestMiddlewareCircuitBreakerSeesRemappedStatus(t *testing.T) {
+	m := NewMiddleware(newTestConfig(t, &Rule{LeaseID: "lease-1", Codes: map[int]int{418: 502}}))
+	breakers := circuitbreaker.NewMiddleware(&circuitbreaker.MiddlewareConfig{
+		MaxRequests:      1,
+		Timeout:          time.Minute,
+		FailureThreshold: 3,
+		Metrics:          circuitbreaker.NewMetricsWithRegistry(prometheus.NewRegistry()),
+	})
+
+	// Remapping sits inside the breaker, as in the server chain
+	handler := breakers.Middleware(m.Middleware(statusHandler(418)))
+
+	// The breaker reads the lease ID from its own context key
+	ctx := context.WithValue(middleware.WithLeaseID(context.Background(), "lease-1"), "lease_id", "lease-1")
+
+	for i := 0; i < 3; i++ {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequestWithContext(ctx, "GET", "/peer/lease-1", nil))
+		if rr.Code != http.StatusBadGateway {
+			t.Errorf("Request %d: expected status 502, got %d", i, rr.Code)
+		}
+	}
+
+	// An upstream 418 is a client error to the breaker; only the remapping makes it a failure
+	if state := breakers.GetBreaker("lease-1").State(); state != circuitbreaker.StateOpen {
+		t.Errorf("Expected breaker to be Open after remapped failures, got %v", state)
+	}
+}
+
+func TestConfigGetRule(t *testing.T) {
+	config := newTestConfig(t,
+		&Rule{LeaseID: "lease-*", Codes: map[int]int{418: 502}},
+		&Rule{LeaseID: "lease-legacy-*", Codes: map[int]int{418: 503}},
+		&Rule{LeaseID: "lease-legacy-1", Codes: map[int]int{418: 504}},
+	)
+
+	tests := []struct {
+		leaseID  string
+		expected string
+	}{
+		{"lease-legacy-1", "lease-legacy-1"},
+		{"lease-legacy-2", "lease-legacy-*"},
+		{"lease-new", "lease-*"},
+	}
+
+	for _, tt := range tests {
+		rule := config.GetRule(tt.leaseID)
+		if rule == nil || rule.LeaseID != tt.expected {
+			t.Errorf("Expected rule %s for %s, got %v", tt.expected, tt.leaseID, rule)
+		}
+	}
+
+	if rule := config.GetRule("other"); rule != nil {
+		t.Errorf("Expected no rule for other, got %v", rule)
+	}
+}
+
+func TestConfigAddRuleValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *Rule
+	}{
+		{"nil rule", nil},
+		{"empty lease ID", &Rule{Codes: map[int]int{418: 502}}},
+		{"no codes", &Rule{LeaseID: "lease-1"}},
+		{"informational upstream code", &Rule{LeaseID: "lease-1", Codes: map[int]int{103: 200}}},
+		{"upstream code out of range", &Rule{LeaseID: "lease-1", Codes: map[int]int{1000: 502}}},
+		{"mapped code out of range", &Rule{LeaseID: "lease-1", Codes: map[int]int{418: 600}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := DefaultMiddlewareConfig().AddRule(tt.rule); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+
+	err := DefaultMiddlewareConfig().AddRule(&Rule{LeaseID: "lease-1", Codes: map[int]int{418: 99}})
+	if !errors.Is(err, ErrInvalidStatusCode) {
+		t.Errorf("Expected ErrInvalidStatusCode, got %v", err)
+	}
+}
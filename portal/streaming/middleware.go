@@ -3,13 +3,19 @@ package streaming
 import (
 	"bufio"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
+	"github.com/portal-project/portal-gateway/portal/problem"
 )
 
 // Metrics holds streaming metrics
@@ -18,6 +24,11 @@ type Metrics struct {
 	StreamingBytesTotal    prometheus.Counter
 	ActiveStreams          prometheus.Gauge
 	StreamDuration         prometheus.Histogram
+	StreamingChunksTotal   prometheus.Counter
+	ChunkSize              prometheus.Histogram
+	ChunksPerStream        prometheus.Histogram
+	LeaseActiveStreams     *prometheus.GaugeVec
+	RejectedStreamsTotal   *prometheus.CounterVec
 }
 
 // NewMetrics creates new streaming metrics
@@ -59,6 +70,40 @@ func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
 				Buckets: []float64{1, 5, 10, 30, 60, 300, 600},
 			},
 		),
+		StreamingChunksTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "portal_streaming_chunks_total",
+				Help: "Total number of chunks written to streaming responses",
+			},
+		),
+		ChunkSize: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "portal_streaming_chunk_size_bytes",
+				Help:    "Size of chunks written to streaming responses in bytes",
+				Buckets: prometheus.ExponentialBuckets(1, 4, 9), // 1B to 64KiB
+			},
+		),
+		ChunksPerStream: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "portal_streaming_chunks_per_stream",
+				Help:    "Number of chunks written per streaming response",
+				Buckets: prometheus.ExponentialBuckets(1, 4, 8), // 1 to 16384
+			},
+		),
+		LeaseActiveStreams: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "portal_lease_active_streams",
+				Help: "Number of active streaming connections per lease",
+			},
+			[]string{"lease_id"},
+		),
+		RejectedStreamsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_streaming_rejected_total",
+				Help: "Total number of streams rejected because too many were open",
+			},
+			[]string{"reason"}, // reason: "global_limit", "lease_limit"
+		),
 	}
 }
 
@@ -70,6 +115,19 @@ type MiddlewareConfig struct {
 	// KeepAliveInterval is the interval for keep-alive comments
 	KeepAliveInterval time.Duration
 
+	// DisableDeadlines clears the server read/write deadlines on streaming connections
+	// so long-lived streams are not cut off by the listener's ReadTimeout/WriteTimeout
+	DisableDeadlines bool
+
+	// MaxStreams caps the streams open at once across all leases (0 = unlimited)
+	MaxStreams int
+
+	// MaxStreamsPerLease caps the streams open at once for each lease (0 = unlimited)
+	MaxStreamsPerLease int
+
+	// RetryAfter is advertised on 503 responses to streams over a limit
+	RetryAfter time.Duration
+
 	// Metrics is the metrics collector
 	Metrics *Metrics
 }
@@ -79,6 +137,8 @@ func DefaultMiddlewareConfig() *MiddlewareConfig {
 	return &MiddlewareConfig{
 		EnableKeepAlive:   true,
 		KeepAliveInterval: 30 * time.Second,
+		DisableDeadlines:  true,
+		RetryAfter:        5 * time.Second,
 		Metrics:           nil, // Will be created by NewMiddleware
 	}
 }
@@ -86,6 +146,10 @@ func DefaultMiddlewareConfig() *MiddlewareConfig {
 // Middleware provides SSE/streaming support
 type Middleware struct {
 	config *MiddlewareConfig
+
+	mu           sync.Mutex
+	open         int            // Streams open across all leases
+	leaseStreams map[string]int // lease ID -> streams open
 }
 
 // NewMiddleware creates a new streaming middleware
@@ -102,8 +166,13 @@ func NewMiddleware(config *MiddlewareConfig) *Middleware {
 		config.KeepAliveInterval = 30 * time.Second
 	}
 
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = 5 * time.Second
+	}
+
 	return &Middleware{
-		config: config,
+		config:       config,
+		leaseStreams: make(map[string]int),
 	}
 }
 
@@ -120,11 +189,23 @@ func (m *Middleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// Long-lived streams hold resources until they end, so cap how many are open
+		leaseID := middleware.GetLeaseID(r.Context())
+		if reason := m.acquire(leaseID); reason != "" {
+			m.rejectStream(w, r, reason)
+			return
+		}
+		defer m.release(leaseID)
+
 		// Track streaming request
 		m.config.Metrics.StreamingRequestsTotal.Inc()
 		m.config.Metrics.ActiveStreams.Inc()
 		defer m.config.Metrics.ActiveStreams.Dec()
 
+		if m.config.DisableDeadlines {
+			clearDeadlines(w)
+		}
+
 		startTime := time.Now()
 		defer func() {
 			duration := time.Since(startTime).Seconds()
@@ -147,9 +228,80 @@ func (m *Middleware) Middleware(next http.Handler) http.Handler {
 
 		// Serve the request
 		next.ServeHTTP(sw, r)
+
+		m.config.Metrics.ChunksPerStream.Observe(float64(sw.chunksWritten))
 	})
 }
 
+// acquire counts a new stream for a lease, or returns the reason it is over a limit
+func (m *Middleware) acquire(leaseID string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if leaseID != "" && m.config.MaxStreamsPerLease > 0 && m.leaseStreams[leaseID] >= m.config.MaxStreamsPerLease {
+		return "lease_limit"
+	}
+	if m.config.MaxStreams > 0 && m.open >= m.config.MaxStreams {
+		return "global_limit"
+	}
+
+	m.open++
+	if leaseID != "" {
+		m.leaseStreams[leaseID]++
+		m.config.Metrics.LeaseActiveStreams.WithLabelValues(leaseID).Set(float64(m.leaseStreams[leaseID]))
+	}
+	return ""
+}
+
+// release stops counting a stream once it ends
+// Leases without open streams are dropped, so the label set stays bounded
+func (m *Middleware) release(leaseID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.open--
+	if leaseID == "" {
+		return
+	}
+
+	m.leaseStreams[leaseID]--
+	if m.leaseStreams[leaseID] <= 0 {
+		delete(m.leaseStreams, leaseID)
+		m.config.Metrics.LeaseActiveStreams.DeleteLabelValues(leaseID)
+		return
+	}
+	m.config.Metrics.LeaseActiveStreams.WithLabelValues(leaseID).Set(float64(m.leaseStreams[leaseID]))
+}
+
+// rejectStream writes a 503 response for a stream over a limit
+func (m *Middleware) rejectStream(w http.ResponseWriter, r *http.Request, reason string) {
+	m.config.Metrics.RejectedStreamsTotal.WithLabelValues(reason).Inc()
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(m.config.RetryAfter.Seconds()))))
+
+	if reason == "lease_limit" {
+		problem.Write(w, r, http.StatusServiceUnavailable, "too_many_streams", "Too many open streams for this lease, retry later")
+		return
+	}
+	problem.Write(w, r, http.StatusServiceUnavailable, "too_many_streams", "Server has too many open streams, retry later")
+}
+
+// GetStreamCounts returns the streams open across all leases and for one lease
+func (m *Middleware) GetStreamCounts(leaseID string) (total, lease int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.open, m.leaseStreams[leaseID]
+}
+
+// clearDeadlines removes the connection read/write deadlines for this request
+// Writers that cannot reach the connection are left with the server defaults
+func clearDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+}
+
 // isSSERequest checks if the request is for SSE
 func (m *Middleware) isSSERequest(r *http.Request) bool {
 	accept := r.Header.Get("Accept")
@@ -176,6 +328,7 @@ type streamingResponseWriter struct {
 	http.ResponseWriter
 	metrics       *Metrics
 	bytesWritten  int64
+	chunksWritten int64
 	headerWritten bool
 }
 
@@ -201,27 +354,37 @@ func (w *streamingResponseWriter) Write(b []byte) (int, error) {
 	w.bytesWritten += int64(n)
 	w.metrics.StreamingBytesTotal.Add(float64(n))
 
-	// Flush if possible
-	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
-		flusher.Flush()
+	// Track chunking behavior (empty writes are not chunks)
+	if n > 0 {
+		w.chunksWritten++
+		w.metrics.StreamingChunksTotal.Inc()
+		w.metrics.ChunkSize.Observe(float64(n))
 	}
 
+	// Flush if possible
+	w.Flush()
+
 	return n, nil
 }
 
 // Flush flushes the response buffer
+// Outer writers without Flush are unwrapped to reach the connection
 func (w *streamingResponseWriter) Flush() {
-	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
-		flusher.Flush()
-	}
+	http.NewResponseController(w.ResponseWriter).Flush()
 }
 
 // Hijack implements http.Hijacker for WebSocket support
 func (w *streamingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	if hijacker, ok := w.ResponseWriter.(http.Hijacker); ok {
-		return hijacker.Hijack()
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking: %w", err)
 	}
-	return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	return conn, rw, nil
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *streamingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
 // GetMetrics returns the metrics collector
@@ -1,14 +1,20 @@
 package streaming
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/portal-project/portal-gateway/portal/middleware"
 )
 
 // newTestMetrics creates new metrics for testing with a fresh registry
@@ -323,6 +329,90 @@ func TestStreamingResponseWriterFlush(t *testing.T) {
 	sw.Flush()
 }
 
+// plainWriter hides the Flusher of the writer it wraps, like other middleware writers
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func (w *plainWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestStreamingResponseWriterFlushUnwraps(t *testing.T) {
+	rr := httptest.NewRecorder()
+	sw := &streamingResponseWriter{
+		ResponseWriter: &plainWriter{ResponseWriter: rr},
+		metrics:        newTestMetrics(),
+	}
+
+	sw.Write([]byte("test"))
+
+	if !rr.Flushed {
+		t.Error("Expected flush to reach the underlying writer")
+	}
+}
+
+// streamPastWriteTimeout serves a slow SSE stream from a server with a short WriteTimeout
+func streamPastWriteTimeout(t *testing.T, disableDeadlines bool) (string, error) {
+	t.Helper()
+
+	m := NewMiddleware(&MiddlewareConfig{
+		DisableDeadlines: disableDeadlines,
+		Metrics:          newTestMetrics(),
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			fmt.Fprintf(w, "data: %d\n\n", i)
+			time.Sleep(75 * time.Millisecond)
+		}
+	})
+
+	server := httptest.NewUnstartedServer(m.Middleware(&plainWriterHandler{handler}))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+// plainWriterHandler wraps the writer in plainWriter before calling the handler
+type plainWriterHandler struct {
+	next http.Handler
+}
+
+func (h *plainWriterHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.next.ServeHTTP(&plainWriter{ResponseWriter: w}, r)
+}
+
+func TestMiddlewareClearsWriteDeadline(t *testing.T) {
+	body, err := streamPastWriteTimeout(t, true)
+	if err != nil {
+		t.Fatalf("Expected stream to outlive the write timeout, got %v", err)
+	}
+
+	if !strings.Contains(body, "data: 3") {
+		t.Errorf("Expected all events, got %q", body)
+	}
+}
+
+func TestMiddlewareKeepsWriteDeadline(t *testing.T) {
+	body, err := streamPastWriteTimeout(t, false)
+	if err == nil && strings.Contains(body, "data: 3") {
+		t.Error("Expected the write timeout to cut the stream short")
+	}
+}
+
 func TestStreamingMetrics(t *testing.T) {
 	metrics := newTestMetrics()
 	config := &MiddlewareConfig{
@@ -351,6 +441,59 @@ func TestStreamingMetrics(t *testing.T) {
 	// but the code paths are covered
 }
 
+// histogramSample returns the sample count and sum of a histogram
+func histogramSample(t *testing.T, h prometheus.Histogram) (uint64, float64) {
+	t.Helper()
+
+	var m dto.Metric
+	if err := h.Write(&m); err != nil {
+		t.Fatalf("Failed to read histogram: %v", err)
+	}
+
+	return m.GetHistogram().GetSampleCount(), m.GetHistogram().GetSampleSum()
+}
+
+func TestStreamingChunkMetrics(t *testing.T) {
+	metrics := newTestMetrics()
+	config := &MiddlewareConfig{
+		Metrics: metrics,
+	}
+	m := NewMiddleware(config)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a"))
+		w.Write([]byte("bcd"))
+		w.Write(nil)
+		w.Write([]byte("efghijkl"))
+	})
+
+	wrapped := m.Middleware(handler)
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	var chunks dto.Metric
+	if err := metrics.StreamingChunksTotal.Write(&chunks); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	if got := chunks.GetCounter().GetValue(); got != 3 {
+		t.Errorf("Expected 3 chunks, got %v", got)
+	}
+
+	count, sum := histogramSample(t, metrics.ChunkSize)
+	if count != 3 || sum != 12 {
+		t.Errorf("Expected 3 chunk size samples totalling 12 bytes, got %d samples totalling %v", count, sum)
+	}
+
+	count, sum = histogramSample(t, metrics.ChunksPerStream)
+	if count != 1 || sum != 3 {
+		t.Errorf("Expected one stream with 3 chunks, got %d streams with %v chunks", count, sum)
+	}
+}
+
 func TestGetMetrics(t *testing.T) {
 	metrics := newTestMetrics()
 	config := &MiddlewareConfig{
@@ -376,6 +519,10 @@ func TestDefaultMiddlewareConfig(t *testing.T) {
 		t.Errorf("Expected KeepAliveInterval 30s, got %v", config.KeepAliveInterval)
 	}
 
+	if !config.DisableDeadlines {
+		t.Error("Expected DisableDeadlines to be true")
+	}
+
 	if config.Metrics != nil {
 		t.Error("Expected metrics to be nil from DefaultMiddlewareConfig")
 	}
@@ -423,3 +570,95 @@ func BenchmarkMiddlewareSSE(b *testing.B) {
 		wrapped.ServeHTTP(rr, req)
 	}
 }
+
+// metricValue returns the value of a gauge or counter
+func metricValue(t *testing.T, metric prometheus.Metric) float64 {
+	t.Helper()
+
+	var m dto.Metric
+	if err := metric.Write(&m); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	if m.GetGauge() != nil {
+		return m.GetGauge().GetValue()
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestMiddlewareStreamLimits(t *testing.T) {
+	metrics := newTestMetrics()
+	m := NewMiddleware(&MiddlewareConfig{
+		MaxStreams:         3,
+		MaxStreamsPerLease: 2,
+		RetryAfter:         10 * time.Second,
+		Metrics:            metrics,
+	})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: open\n\n"))
+		started <- struct{}{}
+		<-release
+	}))
+
+	openStream := func(leaseID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(middleware.WithLeaseID(context.Background(), leaseID), "GET", "/peer/"+leaseID, nil)
+		req.Header.Set("Accept", "text/event-stream")
+		rr := httptest.NewRecorder()
+		wrapped.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	for _, leaseID := range []string{"lease-1", "lease-1", "lease-2"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			openStream(leaseID)
+		}()
+		<-started
+	}
+
+	if total, lease := m.GetStreamCounts("lease-1"); total != 3 || lease != 2 {
+		t.Errorf("Expected 3 open streams with 2 for lease-1, got %d and %d", total, lease)
+	}
+	if got := metricValue(t, metrics.LeaseActiveStreams.WithLabelValues("lease-1")); got != 2 {
+		t.Errorf("Expected the lease-1 gauge to be 2, got %v", got)
+	}
+
+	tests := []struct {
+		leaseID string
+		reason  string
+	}{
+		{"lease-1", "lease_limit"},
+		{"lease-3", "global_limit"},
+	}
+	for _, tt := range tests {
+		rr := openStream(tt.leaseID)
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected status 503, got %d", tt.leaseID, rr.Code)
+		}
+		if retryAfter := rr.Header().Get("Retry-After"); retryAfter != "10" {
+			t.Errorf("%s: expected Retry-After 10, got %q", tt.leaseID, retryAfter)
+		}
+		if got := metricValue(t, metrics.RejectedStreamsTotal.WithLabelValues(tt.reason)); got != 1 {
+			t.Errorf("Expected 1 rejection for %s, got %v", tt.reason, got)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+
+	if total, lease := m.GetStreamCounts("lease-1"); total != 0 || lease != 0 {
+		t.Errorf("Expected no open streams once they ended, got %d and %d", total, lease)
+	}
+
+	// Leases without open streams are dropped from the gauge
+	series := make(chan prometheus.Metric, 10)
+	metrics.LeaseActiveStreams.Collect(series)
+	close(series)
+	if len(series) != 0 {
+		t.Errorf("Expected no lease gauge series, got %d", len(series))
+	}
+}
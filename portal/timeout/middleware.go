@@ -3,18 +3,26 @@ package timeout
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"runtime/debug"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/problem"
+	"github.com/portal-project/portal-gateway/portal/service"
 )
 
 // Metrics holds timeout metrics
 type Metrics struct {
-	TimeoutsTotal *prometheus.CounterVec
-	TimeoutsByLease *prometheus.CounterVec
+	TimeoutsTotal       *prometheus.CounterVec
+	TimeoutsByLease     *prometheus.CounterVec
+	OverrunsTotal       prometheus.Counter
+	OverrunningHandlers prometheus.Gauge
 }
 
 // NewMetrics creates new timeout metrics
@@ -45,6 +53,18 @@ func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
 			},
 			[]string{"lease_id"},
 		),
+		OverrunsTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "portal_request_timeout_overruns_total",
+				Help: "Total number of handlers still running past the overrun grace period after their request timed out",
+			},
+		),
+		OverrunningHandlers: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_request_timeout_overrunning_handlers",
+				Help: "Number of handlers still running after their request timed out and the overrun grace period passed",
+			},
+		),
 	}
 }
 
@@ -64,8 +84,18 @@ type MiddlewareConfig struct {
 	LeaseTimeouts map[string]time.Duration
 	// ServiceTimeouts maps service types to their specific timeouts
 	ServiceTimeouts map[string]time.Duration
+	// Classifier assigns leases to service types; without it ServiceTimeouts is not used
+	Classifier *service.Classifier
 	// Metrics is the metrics collector
 	Metrics *Metrics
+	// Logger is used to log timeouts (nil uses logging.Default())
+	Logger *logging.Logger
+	// HardStop finalizes the response when a request times out and discards anything the
+	// handler writes afterwards, so a handler that ignores its context cannot touch the response
+	HardStop bool
+	// OverrunGrace is how long a handler may keep running after a hard stop before it counts
+	// as an overrun (default 1s)
+	OverrunGrace time.Duration
 }
 
 // DefaultMiddlewareConfig returns default configuration
@@ -106,6 +136,10 @@ func NewMiddleware(config *MiddlewareConfig) *Middleware {
 		config.ServiceTimeouts = make(map[string]time.Duration)
 	}
 
+	if config.OverrunGrace <= 0 {
+		config.OverrunGrace = time.Second
+	}
+
 	return &Middleware{
 		config: config,
 	}
@@ -121,6 +155,13 @@ func (m *Middleware) GetTimeout(leaseID string) time.Duration {
 		return timeout
 	}
 
+	// Then for the timeout of the lease's service
+	if serviceType := m.config.Classifier.Classify(leaseID); serviceType != "" {
+		if timeout, ok := m.config.ServiceTimeouts[serviceType]; ok {
+			return timeout
+		}
+	}
+
 	// Use default timeout
 	return m.config.DefaultTimeout
 }
@@ -161,32 +202,53 @@ func (m *Middleware) Middleware(next http.Handler) http.Handler {
 
 		// Determine timeout
 		timeout := m.GetTimeout(leaseID)
+		start := time.Now()
 
 		// Create context with timeout
 		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
 
-		// Create a channel to signal completion
+		// Create channels to signal completion or a panic in the handler
 		done := make(chan struct{})
+		panicCh := make(chan any, 1)
 
 		// Wrap response writer to track if response was sent
 		wrapped := &timeoutResponseWriter{
 			ResponseWriter: w,
 			wroteHeader:    false,
 		}
+		if m.config.HardStop {
+			// Headers are staged until the first write, so the handler never shares the real header map
+			wrapped.header = w.Header().Clone()
+		}
 
 		// Execute request in goroutine
 		go func() {
-			defer close(done)
+			defer func() {
+				// A panic here would crash the process; hand it to the serving goroutine instead
+				if p := recover(); p != nil {
+					panicCh <- handlerPanic(p)
+					return
+				}
+				close(done)
+			}()
 			next.ServeHTTP(wrapped, r.WithContext(ctx))
 		}()
 
-		// Wait for completion or timeout
+		// Wait for completion, panic, or timeout
 		select {
 		case <-done:
 			// Request completed successfully
 			return
+		case p := <-panicCh:
+			panic(p)
 		case <-ctx.Done():
+			if m.config.HardStop {
+				m.hardStop(w, r, wrapped, leaseID, timeout, start)
+				go m.trackOverrun(r, leaseID, done, panicCh)
+				return
+			}
+
 			// Request timed out
 			wrapped.mu.Lock()
 			alreadyWrote := wrapped.wroteHeader
@@ -199,33 +261,166 @@ func (m *Middleware) Middleware(next http.Handler) http.Handler {
 					m.config.Metrics.TimeoutsByLease.WithLabelValues(leaseID).Inc()
 				}
 
+				m.logTimeout(r, leaseID, timeout, time.Since(start))
+
 				// Send 504 Gateway Timeout
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusGatewayTimeout)
-				if leaseID != "" {
-					fmt.Fprintf(w, `{"error":"gateway_timeout","message":"Request timed out after %v for lease %s"}`, timeout, leaseID)
-				} else {
-					fmt.Fprintf(w, `{"error":"gateway_timeout","message":"Request timed out after %v"}`, timeout)
-				}
+				writeTimeout(w, r, leaseID, timeout)
 			}
 			return
 		}
 	})
 }
 
+// hardStop finalizes a timed out response through the wrapped writer
+// After it returns the handler's writes are discarded, so the response is complete even if
+// the handler is still running
+func (m *Middleware) hardStop(w http.ResponseWriter, r *http.Request, wrapped *timeoutResponseWriter, leaseID string, timeout time.Duration, start time.Time) {
+	wrapped.mu.Lock()
+	defer wrapped.mu.Unlock()
+
+	wrapped.timedOut = true
+	if wrapped.wroteHeader {
+		// Part of the response was already sent; it ends here
+		return
+	}
+	wrapped.wroteHeader = true
+
+	m.config.Metrics.TimeoutsTotal.WithLabelValues(r.URL.Path).Inc()
+	if leaseID != "" {
+		m.config.Metrics.TimeoutsByLease.WithLabelValues(leaseID).Inc()
+	}
+
+	m.logTimeout(r, leaseID, timeout, time.Since(start))
+
+	writeTimeout(w, r, leaseID, timeout)
+}
+
+// writeTimeout writes a 504 response for a request that ran past its timeout
+func writeTimeout(w http.ResponseWriter, r *http.Request, leaseID string, timeout time.Duration) {
+	if leaseID != "" {
+		problem.Write(w, r, http.StatusGatewayTimeout, "gateway_timeout", fmt.Sprintf("Request timed out after %v for lease %s", timeout, leaseID))
+		return
+	}
+	problem.Write(w, r, http.StatusGatewayTimeout, "gateway_timeout", fmt.Sprintf("Request timed out after %v", timeout))
+}
+
+// trackOverrun waits for an abandoned handler to return
+// Handlers still running after the grace period ignore their context, so they are counted
+// and logged to surface goroutines leaked by uncooperative upstream calls
+func (m *Middleware) trackOverrun(r *http.Request, leaseID string, done <-chan struct{}, panicCh <-chan any) {
+	abandoned := time.Now()
+	grace := time.NewTimer(m.config.OverrunGrace)
+	defer grace.Stop()
+
+	select {
+	case <-done:
+		return
+	case p := <-panicCh:
+		m.logAbandonedPanic(r, leaseID, p)
+		return
+	case <-grace.C:
+	}
+
+	m.config.Metrics.OverrunsTotal.Inc()
+	m.config.Metrics.OverrunningHandlers.Inc()
+	defer m.config.Metrics.OverrunningHandlers.Dec()
+
+	logger := m.requestLogger(r, leaseID)
+	logger.Warn("Handler still running after request timed out",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Duration("grace", m.config.OverrunGrace),
+	)
+
+	select {
+	case <-done:
+	case p := <-panicCh:
+		m.logAbandonedPanic(r, leaseID, p)
+		return
+	}
+
+	logger.Info("Overrunning handler returned",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Duration("overrun", time.Since(abandoned)),
+	)
+}
+
+// logAbandonedPanic logs a panic from a handler whose request already timed out
+// Nothing is left to propagate it to, since the serving goroutine has returned
+func (m *Middleware) logAbandonedPanic(r *http.Request, leaseID string, p any) {
+	if p == http.ErrAbortHandler {
+		return
+	}
+	m.requestLogger(r, leaseID).Error("Handler panicked after request timed out",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Any("panic", p),
+	)
+}
+
+// handlerPanic attaches the handler goroutine's stack to a recovered panic value,
+// since re-panicking in the serving goroutine loses it
+func handlerPanic(p any) any {
+	if p == http.ErrAbortHandler {
+		return p
+	}
+	return fmt.Sprintf("%v\n\nhandler goroutine stack:\n%s", p, debug.Stack())
+}
+
+// logTimeout logs a timed out request at Warn level
+func (m *Middleware) logTimeout(r *http.Request, leaseID string, timeout, elapsed time.Duration) {
+	m.requestLogger(r, leaseID).Warn("Request timed out",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Duration("timeout", timeout),
+		slog.Duration("elapsed", elapsed),
+	)
+}
+
+// requestLogger returns the configured logger with the request's context attached
+func (m *Middleware) requestLogger(r *http.Request, leaseID string) *slog.Logger {
+	logger := m.config.Logger
+	if logger == nil {
+		logger = logging.Default()
+	}
+
+	// The lease ID is stored under a plain string key, so hand it to the logger explicitly
+	ctx := r.Context()
+	if leaseID != "" {
+		ctx = logging.ContextWithLeaseID(ctx, leaseID)
+	}
+
+	return logger.WithContext(ctx)
+}
+
 // timeoutResponseWriter wraps http.ResponseWriter to track if header was written
 type timeoutResponseWriter struct {
 	http.ResponseWriter
 	wroteHeader bool
 	mu          sync.Mutex
+
+	// Only used in hard-stop mode: header stages the handler's headers until the first write,
+	// and timedOut discards everything the handler writes after a timeout
+	header   http.Header
+	timedOut bool
+}
+
+// Header returns the staged headers in hard-stop mode, or the real ones otherwise
+func (w *timeoutResponseWriter) Header() http.Header {
+	if w.header != nil {
+		return w.header
+	}
+	return w.ResponseWriter.Header()
 }
 
 func (w *timeoutResponseWriter) WriteHeader(code int) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if !w.wroteHeader {
+	if !w.wroteHeader && !w.timedOut {
 		w.wroteHeader = true
+		w.copyHeader()
 		w.ResponseWriter.WriteHeader(code)
 	}
 }
@@ -234,12 +429,50 @@ func (w *timeoutResponseWriter) Write(b []byte) (int, error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
 	if !w.wroteHeader {
 		w.wroteHeader = true
+		w.copyHeader()
 	}
 	return w.ResponseWriter.Write(b)
 }
 
+// copyHeader moves staged headers to the real response; callers hold mu
+func (w *timeoutResponseWriter) copyHeader() {
+	if w.header == nil {
+		return
+	}
+
+	dst := w.ResponseWriter.Header()
+	for key := range dst {
+		if _, ok := w.header[key]; !ok {
+			delete(dst, key)
+		}
+	}
+	for key, values := range w.header {
+		dst[key] = values
+	}
+}
+
+// Flush implements http.Flusher, serialized with writes
+func (w *timeoutResponseWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *timeoutResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // getLeaseID retrieves lease ID from context
 func getLeaseID(ctx context.Context) string {
 	if ctx == nil {
@@ -1,13 +1,22 @@
 package timeout
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/portal-project/portal-gateway/portal/logging"
+	"github.com/portal-project/portal-gateway/portal/service"
 )
 
 // newTestMetrics creates new metrics for testing with a fresh registry
@@ -100,15 +109,16 @@ func TestMiddlewareContextCancellation(t *testing.T) {
 	}
 	m := NewMiddleware(config)
 
-	contextCancelled := false
+	contextCancelled := make(chan bool, 1)
 
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Wait for context cancellation
 		select {
 		case <-r.Context().Done():
-			contextCancelled = true
+			contextCancelled <- true
 			return
 		case <-time.After(200 * time.Millisecond):
+			contextCancelled <- false
 			w.WriteHeader(http.StatusOK)
 		}
 	})
@@ -120,7 +130,8 @@ func TestMiddlewareContextCancellation(t *testing.T) {
 
 	wrapped.ServeHTTP(rr, req)
 
-	if !contextCancelled {
+	// The middleware returns on timeout without waiting for the handler goroutine
+	if !<-contextCancelled {
 		t.Error("Expected context to be cancelled on timeout")
 	}
 
@@ -129,6 +140,83 @@ func TestMiddlewareContextCancellation(t *testing.T) {
 	}
 }
 
+func TestMiddlewareTimeoutLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	config := &MiddlewareConfig{
+		DefaultTimeout: 50 * time.Millisecond,
+		Metrics:        newTestMetrics(),
+		Logger: logging.NewLogger(&logging.Config{
+			Level:  slog.LevelInfo,
+			Format: logging.FormatJSON,
+			Output: buf,
+		}),
+	}
+	m := NewMiddleware(config)
+
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+
+	wrapped := m.Middleware(handler)
+
+	ctx := context.WithValue(context.Background(), "lease_id", "test-lease")
+	ctx = logging.ContextWithRequestID(ctx, "req-123")
+	req := httptest.NewRequest("GET", "/test", nil).WithContext(ctx)
+	rr := httptest.NewRecorder()
+
+	wrapped.ServeHTTP(rr, req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to parse log entry %q: %v", buf.String(), err)
+	}
+
+	if entry["level"] != "WARN" {
+		t.Errorf("Expected WARN level, got %v", entry["level"])
+	}
+
+	if entry["lease_id"] != "test-lease" {
+		t.Errorf("Expected lease_id test-lease, got %v", entry["lease_id"])
+	}
+
+	if entry["request_id"] != "req-123" {
+		t.Errorf("Expected request_id req-123, got %v", entry["request_id"])
+	}
+
+	if entry["timeout"] != float64(50*time.Millisecond) {
+		t.Errorf("Expected timeout %d, got %v", 50*time.Millisecond, entry["timeout"])
+	}
+
+	if elapsed, ok := entry["elapsed"].(float64); !ok || elapsed < float64(50*time.Millisecond) {
+		t.Errorf("Expected elapsed of at least the timeout, got %v", entry["elapsed"])
+	}
+}
+
+func TestMiddlewarePanicPropagates(t *testing.T) {
+	m := NewMiddleware(&MiddlewareConfig{
+		DefaultTimeout: time.Second,
+		Metrics:        newTestMetrics(),
+	})
+
+	wrapped := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler failed")
+	}))
+
+	// The panic must surface in the serving goroutine, where recovery middleware can catch it
+	defer func() {
+		p := recover()
+		msg, _ := p.(string)
+		if !strings.Contains(msg, "handler failed") || !strings.Contains(msg, "handler goroutine stack") {
+			t.Errorf("Expected panic with handler stack, got %v", p)
+		}
+	}()
+
+	wrapped.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/test", nil))
+}
+
 func TestMiddlewarePerLeaseTimeout(t *testing.T) {
 	config := &MiddlewareConfig{
 		DefaultTimeout: 1 * time.Second,
@@ -243,6 +331,54 @@ func TestServiceTimeouts(t *testing.T) {
 	}
 }
 
+func TestGetTimeoutByService(t *testing.T) {
+	classifier, err := service.NewClassifier([]*service.Rule{
+		{Service: "mcp", Prefix: "mcp-"},
+		{Service: "n8n", Prefix: "n8n-"},
+	}, "")
+	if err != nil {
+		t.Fatalf("Failed to create classifier: %v", err)
+	}
+
+	config := &MiddlewareConfig{
+		DefaultTimeout: 30 * time.Second,
+		LeaseTimeouts:  map[string]time.Duration{"mcp-slow": 90 * time.Second},
+		ServiceTimeouts: map[string]time.Duration{
+			"mcp": 10 * time.Second,
+			"n8n": 60 * time.Second,
+		},
+		Classifier: classifier,
+		Metrics:    newTestMetrics(),
+	}
+	m := NewMiddleware(config)
+
+	tests := []struct {
+		leaseID  string
+		expected time.Duration
+	}{
+		{"mcp-tools", 10 * time.Second},
+		{"n8n-flows", 60 * time.Second},
+		{"mcp-slow", 90 * time.Second}, // Lease timeout wins over its service's
+		{"billing", 30 * time.Second},  // Service without a timeout uses the default
+	}
+
+	for _, tt := range tests {
+		if timeout := m.GetTimeout(tt.leaseID); timeout != tt.expected {
+			t.Errorf("Lease %s: expected timeout %v, got %v", tt.leaseID, tt.expected, timeout)
+		}
+	}
+
+	// Without a classifier, service timeouts do not apply to leases
+	m = NewMiddleware(&MiddlewareConfig{
+		DefaultTimeout:  30 * time.Second,
+		ServiceTimeouts: config.ServiceTimeouts,
+		Metrics:         newTestMetrics(),
+	})
+	if timeout := m.GetTimeout("mcp-tools"); timeout != 30*time.Second {
+		t.Errorf("Expected the default timeout without a classifier, got %v", timeout)
+	}
+}
+
 func TestSetServiceTimeout(t *testing.T) {
 	config := &MiddlewareConfig{
 		DefaultTimeout: 30 * time.Second,
@@ -290,6 +426,115 @@ func TestTimeoutMetrics(t *testing.T) {
 	// but the code paths are covered
 }
 
+func TestMiddlewareHardStop(t *testing.T) {
+	metrics := newTestMetrics()
+	m := NewMiddleware(&MiddlewareConfig{
+		DefaultTimeout: 20 * time.Millisecond,
+		Metrics:        metrics,
+		HardStop:       true,
+		OverrunGrace:   20 * time.Millisecond,
+		Logger:         logging.NewLogger(&logging.Config{Output: io.Discard}),
+	})
+
+	release := make(chan struct{})
+	writeErr := make(chan error, 1)
+
+	// Ignores its context, like a blocking upstream read without context support
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("X-Late", "1")
+		_, err := w.Write([]byte("late"))
+		writeErr <- err
+	})
+
+	rr := httptest.NewRecorder()
+	start := time.Now()
+	m.Middleware(handler).ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the middleware to return at the timeout, took %v", elapsed)
+	}
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status 504, got %d", rr.Code)
+	}
+
+	// The handler is counted once it outlives the grace period
+	waitForGauge(t, metrics.OverrunningHandlers, 1)
+	if got := counterValue(t, metrics.OverrunsTotal); got != 1 {
+		t.Errorf("Expected 1 overrun, got %v", got)
+	}
+
+	close(release)
+	if err := <-writeErr; err != http.ErrHandlerTimeout {
+		t.Errorf("Expected late writes to fail with ErrHandlerTimeout, got %v", err)
+	}
+	waitForGauge(t, metrics.OverrunningHandlers, 0)
+
+	if strings.Contains(rr.Body.String(), "late") || rr.Header().Get("X-Late") != "" {
+		t.Errorf("Expected the handler's late response to be discarded, got %q", rr.Body.String())
+	}
+}
+
+func TestMiddlewareHardStopCooperativeHandler(t *testing.T) {
+	metrics := newTestMetrics()
+	m := NewMiddleware(&MiddlewareConfig{
+		DefaultTimeout: 20 * time.Millisecond,
+		Metrics:        metrics,
+		HardStop:       true,
+		OverrunGrace:   50 * time.Millisecond,
+		Logger:         logging.NewLogger(&logging.Config{Output: io.Discard}),
+	})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Partial", "1")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("partial"))
+		<-r.Context().Done()
+	})
+
+	rr := httptest.NewRecorder()
+	m.Middleware(handler).ServeHTTP(rr, httptest.NewRequest("GET", "/test", nil))
+
+	// A response already under way is ended rather than replaced
+	if rr.Code != http.StatusOK || rr.Body.String() != "partial" || rr.Header().Get("X-Partial") != "1" {
+		t.Errorf("Expected the partial response, got %d %q", rr.Code, rr.Body.String())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := counterValue(t, metrics.OverrunsTotal); got != 0 {
+		t.Errorf("Expected a handler that honors its context not to overrun, got %v", got)
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("Failed to read counter: %v", err)
+	}
+	return m.Counter.GetValue()
+}
+
+func waitForGauge(t *testing.T, g prometheus.Gauge, want float64) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		m := &dto.Metric{}
+		if err := g.Write(m); err != nil {
+			t.Fatalf("Failed to read gauge: %v", err)
+		}
+		if m.Gauge.GetValue() == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected gauge to reach %v, got %v", want, m.Gauge.GetValue())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
 func TestTimeoutResponseWriterConcurrency(t *testing.T) {
 	rr := httptest.NewRecorder()
 	wrapped := &timeoutResponseWriter{
@@ -0,0 +1,266 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Metrics holds upstream connection pool metrics
+type Metrics struct {
+	Connections *prometheus.GaugeVec
+	DialsTotal  *prometheus.CounterVec
+}
+
+// NewMetrics creates new upstream connection pool metrics using the default registry
+func NewMetrics() *Metrics {
+	return NewMetricsWithRegistry(prometheus.DefaultRegisterer)
+}
+
+// NewMetricsWithRegistry creates new upstream connection pool metrics with a custom registry
+func NewMetricsWithRegistry(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.NewRegistry()
+	}
+
+	factory := promauto.With(reg)
+
+	return &Metrics{
+		Connections: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "portal_upstream_connections",
+				Help: "Open connections to each upstream, by whether they are serving a request or idle in the pool",
+			},
+			[]string{"upstream", "state"}, // upstream: host:port, state: "active", "idle"
+		),
+		DialsTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_upstream_dials_total",
+				Help: "Total number of new connections opened to each upstream",
+			},
+			[]string{"upstream", "result"}, // result: "success", "failure"
+		),
+	}
+}
+
+// TransportConfig tunes the connection pool used to reach upstreams
+type TransportConfig struct {
+	MaxIdleConns        int           // Idle connections kept across all upstreams (0 = unlimited)
+	MaxIdleConnsPerHost int           // Idle connections kept per upstream (default 100)
+	MaxConnsPerHost     int           // Connections per upstream, active or idle; further requests wait (0 = unlimited)
+	IdleConnTimeout     time.Duration // How long an unused connection is kept (default 90s)
+	DialTimeout         time.Duration // Bound on opening a connection (default 5s)
+	KeepAlive           time.Duration // TCP keep-alive probe interval (default 30s)
+	TLSHandshakeTimeout time.Duration // Bound on the TLS handshake (default 10s)
+	Metrics             *Metrics
+}
+
+// DefaultTransportConfig returns a configuration for high-throughput upstreams
+// Unlike http.DefaultTransport, which keeps 2 idle connections per host, busy leases can
+// reuse up to 100 connections instead of dialing for most requests
+func DefaultTransportConfig() *TransportConfig {
+	return &TransportConfig{
+		MaxIdleConns:        1000,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+		DialTimeout:         5 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// Transport is an http.RoundTripper with a tuned connection pool that reports its
+// connections per upstream
+type Transport struct {
+	base    *http.Transport
+	metrics *Metrics
+
+	mu    sync.Mutex
+	pools map[string]*poolCount // upstream address -> its connections
+}
+
+// poolCount counts the connections to one upstream
+// With HTTP/2 several requests share a connection, so active counts requests in flight
+type poolCount struct {
+	open   int
+	active int
+}
+
+// NewTransport creates a transport from a configuration
+func NewTransport(config *TransportConfig) *Transport {
+	if config == nil {
+		config = DefaultTransportConfig()
+	}
+
+	defaults := DefaultTransportConfig()
+	if config.MaxIdleConnsPerHost <= 0 {
+		config.MaxIdleConnsPerHost = defaults.MaxIdleConnsPerHost
+	}
+	if config.IdleConnTimeout <= 0 {
+		config.IdleConnTimeout = defaults.IdleConnTimeout
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaults.DialTimeout
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = defaults.KeepAlive
+	}
+	if config.TLSHandshakeTimeout <= 0 {
+		config.TLSHandshakeTimeout = defaults.TLSHandshakeTimeout
+	}
+	if config.Metrics == nil {
+		config.Metrics = NewMetrics()
+	}
+
+	t := &Transport{
+		metrics: config.Metrics,
+		pools:   make(map[string]*poolCount),
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   config.DialTimeout,
+		KeepAlive: config.KeepAlive,
+	}
+
+	t.base = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return t.dial(ctx, dialer, network, addr)
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          config.MaxIdleConns,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       config.MaxConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return t
+}
+
+// RoundTrip sends a request through the pool, counting its connection as active until
+// the response body is read to the end or closed
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	addr := upstreamAddr(req.URL)
+
+	// GotConn fires again if the transport retries on a new connection; count the request once
+	var gotConn atomic.Bool
+	trace := &httptrace.ClientTrace{
+		GotConn: func(httptrace.GotConnInfo) {
+			if gotConn.CompareAndSwap(false, true) {
+				t.update(addr, 0, 1)
+			}
+		},
+	}
+
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if !gotConn.Load() {
+		return resp, err
+	}
+
+	release := sync.OnceFunc(func() { t.update(addr, 0, -1) })
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	resp.Body = &trackedBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the pool's idle connections
+func (t *Transport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+// dial opens a connection and counts it until it is closed
+func (t *Transport) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		t.metrics.DialsTotal.WithLabelValues(addr, "failure").Inc()
+		return nil, err
+	}
+
+	t.metrics.DialsTotal.WithLabelValues(addr, "success").Inc()
+	t.update(addr, 1, 0)
+	return &trackedConn{Conn: conn, release: sync.OnceFunc(func() { t.update(addr, -1, 0) })}, nil
+}
+
+// update applies changes to an upstream's connection counts and refreshes its gauges
+// Series of upstreams without connections are dropped, so the label set stays bounded
+func (t *Transport) update(addr string, open, active int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pool, ok := t.pools[addr]
+	if !ok {
+		pool = &poolCount{}
+		t.pools[addr] = pool
+	}
+	pool.open += open
+	pool.active += active
+
+	if pool.open <= 0 && pool.active <= 0 {
+		delete(t.pools, addr)
+		t.metrics.Connections.DeleteLabelValues(addr, "active")
+		t.metrics.Connections.DeleteLabelValues(addr, "idle")
+		return
+	}
+
+	t.metrics.Connections.WithLabelValues(addr, "active").Set(float64(pool.active))
+	t.metrics.Connections.WithLabelValues(addr, "idle").Set(float64(max(pool.open-pool.active, 0)))
+}
+
+// upstreamAddr returns the host:port a request URL is sent to, matching the dialed address
+func upstreamAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// trackedConn releases its pool count once closed
+type trackedConn struct {
+	net.Conn
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
+
+// trackedBody releases its request's active count once read to the end or closed
+type trackedBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if errors.Is(err, io.EOF) {
+		b.release()
+	}
+	return n, err
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
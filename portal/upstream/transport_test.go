@@ -0,0 +1,150 @@
+package upstream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// metricValue returns the value of a gauge or counter series, or -1 if it does not exist
+func metricValue(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			if matchesLabels(metric.GetLabel(), labels) {
+				if metric.GetGauge() != nil {
+					return metric.GetGauge().GetValue()
+				}
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return -1
+}
+
+func matchesLabels(pairs []*dto.LabelPair, labels map[string]string) bool {
+	for _, pair := range pairs {
+		if value, ok := labels[pair.GetName()]; ok && value != pair.GetValue() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTransportReusesConnections(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	transport := NewTransport(&TransportConfig{Metrics: NewMetricsWithRegistry(reg)})
+	client := &http.Client{Transport: transport}
+	addr := upstreamAddr(mustParseURL(t, server.URL))
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+
+	if got := metricValue(t, reg, "portal_upstream_dials_total", map[string]string{"upstream": addr, "result": "success"}); got != 1 {
+		t.Errorf("Expected sequential requests to share one connection, got %v dials", got)
+	}
+	if got := metricValue(t, reg, "portal_upstream_connections", map[string]string{"upstream": addr, "state": "idle"}); got != 1 {
+		t.Errorf("Expected 1 idle connection, got %v", got)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := client.Get(server.URL + "/slow")
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for metricValue(t, reg, "portal_upstream_connections", map[string]string{"upstream": addr, "state": "active"}) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the connection to be reported active during the request")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done
+
+	if got := metricValue(t, reg, "portal_upstream_connections", map[string]string{"upstream": addr, "state": "active"}); got != 0 {
+		t.Errorf("Expected no active connections once the body is closed, got %v", got)
+	}
+
+	transport.CloseIdleConnections()
+	if got := metricValue(t, reg, "portal_upstream_connections", map[string]string{"upstream": addr}); got != -1 {
+		t.Errorf("Expected the upstream's series to be dropped once its connections closed, got %v", got)
+	}
+}
+
+func TestTransportDialFailure(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	transport := NewTransport(&TransportConfig{DialTimeout: time.Second, Metrics: NewMetricsWithRegistry(reg)})
+
+	// Nothing listens on port 1
+	req, _ := http.NewRequest("GET", "http://127.0.0.1:1/", nil)
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("Expected the request to fail")
+	}
+
+	if got := metricValue(t, reg, "portal_upstream_dials_total", map[string]string{"upstream": "127.0.0.1:1", "result": "failure"}); got != 1 {
+		t.Errorf("Expected 1 failed dial, got %v", got)
+	}
+	if got := metricValue(t, reg, "portal_upstream_connections", nil); got != -1 {
+		t.Errorf("Expected no connection series, got %v", got)
+	}
+}
+
+func TestUpstreamAddr(t *testing.T) {
+	tests := map[string]string{
+		"http://api.example.com/v1":      "api.example.com:80",
+		"https://api.example.com/v1":     "api.example.com:443",
+		"http://10.0.0.5:8080/health":    "10.0.0.5:8080",
+		"https://[2001:db8::1]/v1/items": "[2001:db8::1]:443",
+	}
+
+	for rawURL, expected := range tests {
+		if got := upstreamAddr(mustParseURL(t, rawURL)); got != expected {
+			t.Errorf("upstreamAddr(%q) = %q, expected %q", rawURL, got, expected)
+		}
+	}
+}
+
+func mustParseURL(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("Failed to parse %q: %v", rawURL, err)
+	}
+	return u
+}
@@ -0,0 +1,115 @@
+package webhook
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRetryBudgetExhausted is returned when a retry is dropped by the retry budget
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
+// budgetBuckets is the number of buckets the budget window is split into
+const budgetBuckets = 10
+
+// RetryBudget limits retries to a fraction of requests over a sliding window
+// so that retries cannot amplify load on a degraded upstream
+type RetryBudget struct {
+	ratio      float64       // Max retries as a fraction of requests (e.g. 0.1 = 10%)
+	minRetries int           // Retries always allowed per window, regardless of traffic
+	width      time.Duration // Width of a single bucket
+
+	mu      sync.Mutex
+	buckets [budgetBuckets]budgetBucket
+	now     func() time.Time
+}
+
+// budgetBucket counts requests and retries started in one slice of the window
+type budgetBucket struct {
+	start    time.Time
+	requests int
+	retries  int
+}
+
+// NewRetryBudget creates a new retry budget
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	if ratio < 0 {
+		ratio = 0
+	}
+
+	if minRetries < 0 {
+		minRetries = 0
+	}
+
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+
+	width := window / budgetBuckets
+	if width <= 0 {
+		width = time.Nanosecond
+	}
+
+	return &RetryBudget{
+		ratio:      ratio,
+		minRetries: minRetries,
+		width:      width,
+		now:        time.Now,
+	}
+}
+
+// RecordRequest records an initial (non-retry) request
+func (b *RetryBudget) RecordRequest() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.currentLocked().requests++
+}
+
+// TryRetry reports whether a retry is allowed and, if so, records it
+func (b *RetryBudget) TryRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := b.currentLocked()
+	requests, retries := b.totalsLocked()
+
+	allowed := int(float64(requests) * b.ratio)
+	if allowed < b.minRetries {
+		allowed = b.minRetries
+	}
+
+	if retries >= allowed {
+		return false
+	}
+
+	current.retries++
+	return true
+}
+
+// currentLocked returns the bucket for the current time, resetting it if stale; b.mu must be held
+func (b *RetryBudget) currentLocked() *budgetBucket {
+	now := b.now()
+	start := now.Truncate(b.width)
+	bucket := &b.buckets[(start.UnixNano()/int64(b.width))%budgetBuckets]
+
+	if !bucket.start.Equal(start) {
+		*bucket = budgetBucket{start: start}
+	}
+
+	return bucket
+}
+
+// totalsLocked sums requests and retries over buckets still inside the window; b.mu must be held
+func (b *RetryBudget) totalsLocked() (requests, retries int) {
+	cutoff := b.now().Add(-b.width * budgetBuckets)
+
+	for i := range b.buckets {
+		if b.buckets[i].start.After(cutoff) {
+			requests += b.buckets[i].requests
+			retries += b.buckets[i].retries
+		}
+	}
+
+	return requests, retries
+}
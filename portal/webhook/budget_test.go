@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestRetryBudget creates a retry budget driven by a fake clock
+func newTestRetryBudget(ratio float64, minRetries int, window time.Duration) (*RetryBudget, *time.Time) {
+	budget := NewRetryBudget(ratio, minRetries, window)
+	now := time.Unix(1700000000, 0)
+	budget.now = func() time.Time { return now }
+	return budget, &now
+}
+
+func TestRetryBudgetRatio(t *testing.T) {
+	budget, _ := newTestRetryBudget(0.1, 0, 10*time.Second)
+
+	for i := 0; i < 100; i++ {
+		budget.RecordRequest()
+	}
+
+	allowed := 0
+	for i := 0; i < 20; i++ {
+		if budget.TryRetry() {
+			allowed++
+		}
+	}
+
+	if allowed != 10 {
+		t.Errorf("Expected 10 retries for 100 requests at 10%%, got %d", allowed)
+	}
+}
+
+func TestRetryBudgetMinRetries(t *testing.T) {
+	budget, _ := newTestRetryBudget(0.1, 3, 10*time.Second)
+
+	budget.RecordRequest()
+
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if budget.TryRetry() {
+			allowed++
+		}
+	}
+
+	if allowed != 3 {
+		t.Errorf("Expected 3 minimum retries, got %d", allowed)
+	}
+}
+
+func TestRetryBudgetWindowExpiry(t *testing.T) {
+	budget, now := newTestRetryBudget(0.5, 0, 10*time.Second)
+
+	budget.RecordRequest()
+	budget.RecordRequest()
+
+	if !budget.TryRetry() {
+		t.Fatal("Expected retry to be allowed")
+	}
+
+	if budget.TryRetry() {
+		t.Error("Expected budget to be exhausted")
+	}
+
+	// Old requests and retries fall out of the window
+	*now = now.Add(11 * time.Second)
+
+	if budget.TryRetry() {
+		t.Error("Expected no retries without requests in the window")
+	}
+
+	budget.RecordRequest()
+	budget.RecordRequest()
+
+	if !budget.TryRetry() {
+		t.Error("Expected retry to be allowed in the new window")
+	}
+}
@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ConditionalRetryConfig holds configuration for conditional GET retries
+// Successful GET responses carrying an ETag or Last-Modified are remembered, and retries of
+// the same request send those validators so a recovered upstream can answer 304 instead of
+// resending the body
+type ConditionalRetryConfig struct {
+	// MaxEntries bounds the number of remembered responses; the least recently used is evicted
+	MaxEntries int
+
+	// MaxBodySize is the largest response body that is remembered
+	MaxBodySize int64
+}
+
+// DefaultConditionalRetryConfig returns default conditional retry configuration
+func DefaultConditionalRetryConfig() *ConditionalRetryConfig {
+	return &ConditionalRetryConfig{
+		MaxEntries:  1000,
+		MaxBodySize: 1 << 20, // 1 MB
+	}
+}
+
+// validatorCacheVaryHeaders are request headers that are part of the cache key, so a
+// response is only reused for a request that would have received the same one
+var validatorCacheVaryHeaders = []string{"Accept", "Accept-Encoding", "Authorization"}
+
+// validatorCache keeps the validators and body of recent successful GET responses
+type validatorCache struct {
+	config  *ConditionalRetryConfig
+	entries map[string]*list.Element
+	order   *list.List // front = most recently used
+
+	mu sync.Mutex
+}
+
+type validatorEntry struct {
+	key          string
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+}
+
+// newValidatorCache creates a validator cache
+func newValidatorCache(config *ConditionalRetryConfig) *validatorCache {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+
+	return &validatorCache{
+		config:  config,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// key returns the cache key for a request, or "" if the request cannot use the cache
+// Requests carrying their own validators are left alone
+func (c *validatorCache) key(req *http.Request) string {
+	if req.Method != http.MethodGet {
+		return ""
+	}
+	if req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(req.URL.String())
+	for _, name := range validatorCacheVaryHeaders {
+		b.WriteByte('\n')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// get returns the remembered response for a key, or nil
+func (c *validatorCache) get(key string) *validatorEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*validatorEntry)
+}
+
+// put remembers a response, evicting the least recently used one if the cache is full
+func (c *validatorCache) put(entry *validatorEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.order.Len() > c.config.MaxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*validatorEntry).key)
+	}
+}
+
+// remove forgets the response for a key
+func (c *validatorCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// addValidators sets the conditional headers for a remembered response
+// The header is cloned first, since it is shared with the caller's request
+func (e *validatorEntry) addValidators(req *http.Request) {
+	req.Header = req.Header.Clone()
+	if e.etag != "" {
+		req.Header.Set("If-None-Match", e.etag)
+	}
+	if e.lastModified != "" {
+		req.Header.Set("If-Modified-Since", e.lastModified)
+	}
+}
+
+// response rebuilds the remembered response for a 304 answer
+// Headers the 304 carries replace the remembered ones, as they are the current values
+func (e *validatorEntry) response(notModified *http.Response) *http.Response {
+	header := e.header.Clone()
+	for name, values := range notModified.Header {
+		if name == "Content-Length" {
+			continue
+		}
+		header[name] = values
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         notModified.Proto,
+		ProtoMajor:    notModified.ProtoMajor,
+		ProtoMinor:    notModified.ProtoMinor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       notModified.Request,
+	}
+}
+
+// remember arranges for a successful response to be stored once its body has been read in full
+// Responses without validators, or with bodies over MaxBodySize, replace nothing and are dropped
+func (c *validatorCache) remember(key string, resp *http.Response) {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if resp.StatusCode != http.StatusOK || (etag == "" && lastModified == "") || resp.ContentLength > c.config.MaxBodySize {
+		c.remove(key)
+		return
+	}
+
+	header := resp.Header.Clone()
+	resp.Body = &capturingReadCloser{
+		ReadCloser: resp.Body,
+		max:        c.config.MaxBodySize,
+		done: func(body []byte) {
+			c.put(&validatorEntry{
+				key:          key,
+				etag:         etag,
+				lastModified: lastModified,
+				header:       header,
+				body:         body,
+			})
+		},
+	}
+}
+
+// capturingReadCloser copies a response body as it is read and hands it to done at EOF
+// Bodies larger than max are not kept
+type capturingReadCloser struct {
+	io.ReadCloser
+	buf      bytes.Buffer
+	max      int64
+	overflow bool
+	done     func(body []byte)
+}
+
+func (c *capturingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if !c.overflow {
+		if int64(c.buf.Len()+n) > c.max {
+			c.overflow = true
+			c.buf = bytes.Buffer{}
+		} else {
+			c.buf.Write(p[:n])
+		}
+	}
+
+	if err == io.EOF && !c.overflow && c.done != nil {
+		c.done(bytes.Clone(c.buf.Bytes()))
+		c.done = nil
+	}
+	return n, err
+}
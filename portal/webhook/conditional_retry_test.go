@@ -0,0 +1,160 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestRetryHandlerConditionalRetry(t *testing.T) {
+	metrics := newTestRetryMetrics()
+	handler := NewRetryHandler(&RetryConfig{
+		MaxRetries:       2,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       10 * time.Millisecond,
+		RetryOn5xxOnly:   true,
+		ConditionalRetry: DefaultConditionalRetryConfig(),
+		Metrics:          metrics,
+	})
+
+	var mu sync.Mutex
+	var validators []string
+	failNext := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		validators = append(validators, r.Header.Get("If-None-Match"))
+		if failNext {
+			failNext = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.Header().Set("X-Revalidated", "true")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"large":"payload"}`))
+	}))
+	defer server.Close()
+
+	get := func() (*http.Response, string) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/resource", nil)
+		resp, err := handler.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		if req.Header.Get("If-None-Match") != "" {
+			t.Error("Expected the caller's request headers to be left alone")
+		}
+		return resp, string(body)
+	}
+
+	// The first successful response is remembered once its body has been read
+	get()
+
+	// A failed attempt is retried with the validators and the 304 served from memory
+	mu.Lock()
+	failNext = true
+	mu.Unlock()
+
+	resp, body := get()
+	if resp.StatusCode != http.StatusOK || body != `{"large":"payload"}` {
+		t.Errorf("Expected the remembered response, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" || resp.Header.Get("X-Revalidated") != "true" {
+		t.Errorf("Expected remembered headers updated by the 304, got %v", resp.Header)
+	}
+
+	// Only retries are conditional
+	expected := []string{"", "", `"v1"`}
+	if strings.Join(validators, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected If-None-Match %q, got %q", expected, validators)
+	}
+
+	m := &dto.Metric{}
+	metrics.ConditionalRetryNotModifiedTotal.Write(m)
+	if got := m.Counter.GetValue(); got != 1 {
+		t.Errorf("Expected 1 not-modified retry, got %v", got)
+	}
+}
+
+func TestValidatorCacheKey(t *testing.T) {
+	cache := newValidatorCache(DefaultConditionalRetryConfig())
+
+	get, _ := http.NewRequest(http.MethodGet, "http://upstream/a", nil)
+	post, _ := http.NewRequest(http.MethodPost, "http://upstream/a", nil)
+	conditional, _ := http.NewRequest(http.MethodGet, "http://upstream/a", nil)
+	conditional.Header.Set("If-None-Match", `"v0"`)
+	otherCaller, _ := http.NewRequest(http.MethodGet, "http://upstream/a", nil)
+	otherCaller.Header.Set("Authorization", "Bearer other")
+
+	if cache.key(get) == "" {
+		t.Error("Expected a plain GET to be cacheable")
+	}
+	if cache.key(post) != "" {
+		t.Error("Expected POST not to be cacheable")
+	}
+	if cache.key(conditional) != "" {
+		t.Error("Expected a request with its own validators to be left alone")
+	}
+	if cache.key(otherCaller) == cache.key(get) {
+		t.Error("Expected different credentials to use different entries")
+	}
+}
+
+func TestValidatorCacheRemember(t *testing.T) {
+	cache := newValidatorCache(&ConditionalRetryConfig{MaxEntries: 2, MaxBodySize: 8})
+
+	remember := func(key, etag, body string) {
+		resp := &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(body)),
+			ContentLength: -1,
+		}
+		if etag != "" {
+			resp.Header.Set("ETag", etag)
+		}
+		cache.remember(key, resp)
+		io.ReadAll(resp.Body)
+	}
+
+	remember("a", `"a"`, "small")
+	if entry := cache.get("a"); entry == nil || string(entry.body) != "small" {
+		t.Fatalf("Expected the body to be remembered, got %+v", entry)
+	}
+
+	// Bodies over the limit are not kept, even without a declared length
+	remember("big", `"big"`, "much too large")
+	if cache.get("big") != nil {
+		t.Error("Expected an oversized body not to be remembered")
+	}
+
+	// A response without validators replaces the remembered one
+	remember("a", "", "changed")
+	if cache.get("a") != nil {
+		t.Error("Expected a response without validators to forget the entry")
+	}
+
+	// The least recently used entry is evicted
+	remember("b", `"b"`, "b")
+	remember("c", `"c"`, "c")
+	cache.get("b")
+	remember("d", `"d"`, "d")
+	if cache.get("c") != nil || cache.get("b") == nil || cache.get("d") == nil {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+}
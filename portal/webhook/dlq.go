@@ -3,24 +3,99 @@ package webhook
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/portal-project/portal-gateway/portal/sqlite"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 // DLQMetrics holds DLQ metrics
 type DLQMetrics struct {
-	EntriesTotal   prometheus.Counter
-	EntriesActive  prometheus.Gauge
-	ReplayTotal    prometheus.Counter
-	ReplaySuccess  prometheus.Counter
-	ReplayFailure  prometheus.Counter
-	DeletedTotal   prometheus.Counter
+	EntriesTotal  prometheus.Counter
+	EntriesActive prometheus.Gauge
+	ReplayTotal   prometheus.Counter
+	ReplaySuccess prometheus.Counter
+	ReplayFailure prometheus.Counter
+	DeletedTotal  prometheus.Counter
+
+	// Refreshed periodically from the stored entries, see DLQConfig.MetricsRefreshInterval
+	OldestEntryAge prometheus.Gauge
+	EntryAge       *EntryAgeHistogram
+	EntriesByHost  *prometheus.GaugeVec
+
+	// Reported by the automatic Replayer
+	ReplayerPausesTotal *prometheus.CounterVec
+	ReplayerPausedHosts prometheus.Gauge
+}
+
+// DefaultDLQAgeBuckets are the entry age histogram buckets in seconds, from one minute to 30 days
+var DefaultDLQAgeBuckets = []float64{60, 300, 900, 3600, 6 * 3600, 86400, 3 * 86400, 7 * 86400, 30 * 86400}
+
+// EntryAgeHistogram exports the age distribution of the entries currently in the DLQ
+// Unlike a prometheus.Histogram it is replaced wholesale on each refresh rather than accumulated
+type EntryAgeHistogram struct {
+	desc    *prometheus.Desc
+	buckets []float64
+	mu      sync.Mutex
+	counts  map[float64]uint64 // Cumulative count per upper bound
+	count   uint64
+	sum     float64
+}
+
+// newEntryAgeHistogram creates an empty entry age histogram
+func newEntryAgeHistogram(name, help string, buckets []float64) *EntryAgeHistogram {
+	return &EntryAgeHistogram{
+		desc:    prometheus.NewDesc(name, help, nil, nil),
+		buckets: buckets,
+		counts:  make(map[float64]uint64, len(buckets)),
+	}
+}
+
+// Set replaces the histogram with the given entry ages in seconds
+func (h *EntryAgeHistogram) Set(ages []float64) {
+	counts := make(map[float64]uint64, len(h.buckets))
+	var sum float64
+	for _, age := range ages {
+		sum += age
+		for _, bound := range h.buckets {
+			if age <= bound {
+				counts[bound]++
+			}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts = counts
+	h.count = uint64(len(ages))
+	h.sum = sum
+}
+
+// Describe implements prometheus.Collector
+func (h *EntryAgeHistogram) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+// Collect implements prometheus.Collector
+func (h *EntryAgeHistogram) Collect(ch chan<- prometheus.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	counts := make(map[float64]uint64, len(h.buckets))
+	for _, bound := range h.buckets {
+		counts[bound] = h.counts[bound]
+	}
+
+	ch <- prometheus.MustNewConstHistogram(h.desc, h.count, h.sum, counts)
 }
 
 // NewDLQMetrics creates new DLQ metrics
@@ -36,6 +111,13 @@ func NewDLQMetricsWithRegistry(reg prometheus.Registerer) *DLQMetrics {
 
 	factory := promauto.With(reg)
 
+	entryAge := newEntryAgeHistogram(
+		"portal_dlq_entry_age_seconds",
+		"Age distribution of the entries currently in the DLQ in seconds",
+		DefaultDLQAgeBuckets,
+	)
+	reg.MustRegister(entryAge)
+
 	return &DLQMetrics{
 		EntriesTotal: factory.NewCounter(
 			prometheus.CounterOpts{
@@ -73,37 +155,154 @@ func NewDLQMetricsWithRegistry(reg prometheus.Registerer) *DLQMetrics {
 				Help: "Total number of DLQ entries deleted",
 			},
 		),
+		OldestEntryAge: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_dlq_oldest_entry_age_seconds",
+				Help: "Age of the oldest DLQ entry in seconds (0 when the DLQ is empty)",
+			},
+		),
+		EntryAge: entryAge,
+		EntriesByHost: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "portal_dlq_entries_by_host",
+				Help: "Number of DLQ entries by target URL host",
+			},
+			[]string{"host"},
+		),
+		ReplayerPausesTotal: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "portal_dlq_replayer_pauses_total",
+				Help: "Total number of times automatic DLQ replay to a host was paused after a burst of failures",
+			},
+			[]string{"host"},
+		),
+		ReplayerPausedHosts: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "portal_dlq_replayer_paused_hosts",
+				Help: "Number of hosts automatic DLQ replay is currently paused for",
+			},
+		),
 	}
 }
 
 // DLQEntry represents a failed request in the DLQ
 type DLQEntry struct {
-	ID          int64             `json:"id"`
-	Method      string            `json:"method"`
-	URL         string            `json:"url"`
-	Headers     http.Header       `json:"headers"`
-	Body        []byte            `json:"body"`
-	StatusCode  int               `json:"status_code"`
-	Retries     int               `json:"retries"`
-	LastError   string            `json:"last_error"`
-	CreatedAt   time.Time         `json:"created_at"`
-	LastAttempt time.Time         `json:"last_attempt"`
+	ID          int64       `json:"id"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	Headers     http.Header `json:"headers"`
+	Body        []byte      `json:"body"`
+	StatusCode  int         `json:"status_code"`
+	Retries     int         `json:"retries"`
+	LastError   string      `json:"last_error"`
+	CreatedAt   time.Time   `json:"created_at"`
+	LastAttempt time.Time   `json:"last_attempt"`
+	LeaseID     string      `json:"lease_id,omitempty"` // Lease the failed request was made for
+	KeyID       string      `json:"key_id,omitempty"`   // API key the failed request was made with
+
+	// Replays counts admin replays of this entry; PermanentlyFailed is set once it may not be replayed again
+	Replays           int  `json:"replays"`
+	PermanentlyFailed bool `json:"permanently_failed"`
+}
+
+// DLQFilter narrows List and CountFiltered to matching entries; empty fields match everything
+type DLQFilter struct {
+	LeaseID string
+	KeyID   string
+
+	ExcludePermanentlyFailed bool // Only entries that have not been flagged as permanently failed
+}
+
+// where returns the SQL WHERE clause and arguments for the filter
+func (f DLQFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if f.LeaseID != "" {
+		conditions = append(conditions, "lease_id = ?")
+		args = append(args, f.LeaseID)
+	}
+
+	if f.KeyID != "" {
+		conditions = append(conditions, "key_id = ?")
+		args = append(args, f.KeyID)
+	}
+
+	if f.ExcludePermanentlyFailed {
+		conditions = append(conditions, "permanently_failed = 0")
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+
+	return "WHERE " + strings.Join(conditions, " AND "), args
 }
 
+// dlqColumns lists the columns read into a DLQEntry, in scanEntry order
+const dlqColumns = `id, method, url, headers, body, status_code, retries, last_error, created_at, last_attempt, lease_id, key_id, replays, permanently_failed`
+
 // DLQ represents a dead letter queue for failed webhook requests
 type DLQ struct {
-	db      *sql.DB
-	metrics *DLQMetrics
-	mutex   sync.RWMutex
+	db       *sql.DB
+	config   *DLQConfig
+	metrics  *DLQMetrics
+	mutex    sync.RWMutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// DLQConfig holds DLQ configuration
+type DLQConfig struct {
+	// MaxReplays caps how many times an entry can be replayed (0 = unlimited)
+	MaxReplays int
+
+	// MarkPermanentlyFailed flags an entry once its last allowed replay fails
+	MarkPermanentlyFailed bool
+
+	// MetricsRefreshInterval is how often entry age and per-host metrics are recomputed
+	MetricsRefreshInterval time.Duration
+
+	// Metrics is the metrics collector
+	Metrics *DLQMetrics
+}
+
+// DefaultDLQConfig returns default DLQ configuration
+func DefaultDLQConfig() *DLQConfig {
+	return &DLQConfig{
+		MaxReplays:             10,
+		MarkPermanentlyFailed:  true,
+		MetricsRefreshInterval: 30 * time.Second,
+		Metrics:                nil, // Will be created by NewDLQWithConfig
+	}
 }
 
 // NewDLQ creates a new DLQ with SQLite backend
 func NewDLQ(dbPath string) (*DLQ, error) {
-	return NewDLQWithMetrics(dbPath, nil)
+	return NewDLQWithConfig(dbPath, nil)
 }
 
 // NewDLQWithMetrics creates a new DLQ with custom metrics
 func NewDLQWithMetrics(dbPath string, metrics *DLQMetrics) (*DLQ, error) {
+	config := DefaultDLQConfig()
+	config.Metrics = metrics
+	return NewDLQWithConfig(dbPath, config)
+}
+
+// NewDLQWithConfig creates a new DLQ with custom configuration
+func NewDLQWithConfig(dbPath string, config *DLQConfig) (*DLQ, error) {
+	if config == nil {
+		config = DefaultDLQConfig()
+	}
+
+	if config.MaxReplays < 0 {
+		config.MaxReplays = 0
+	}
+
+	if config.MetricsRefreshInterval <= 0 {
+		config.MetricsRefreshInterval = 30 * time.Second
+	}
+
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -131,17 +330,43 @@ func NewDLQWithMetrics(dbPath string, metrics *DLQMetrics) (*DLQ, error) {
 		return nil, fmt.Errorf("failed to create schema: %w", err)
 	}
 
-	if metrics == nil {
-		metrics = NewDLQMetrics()
+	// Columns added after the original schema; existing databases are migrated in place
+	columns := []struct{ name, definition string }{
+		{"lease_id", "TEXT NOT NULL DEFAULT ''"},
+		{"key_id", "TEXT NOT NULL DEFAULT ''"},
+		{"replays", "INTEGER NOT NULL DEFAULT 0"},
+		{"permanently_failed", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, column := range columns {
+		if err := sqlite.AddColumnIfMissing(db, "dlq_entries", column.name, column.definition); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	indexes := `
+	CREATE INDEX IF NOT EXISTS idx_lease_id ON dlq_entries(lease_id);
+	CREATE INDEX IF NOT EXISTS idx_key_id ON dlq_entries(key_id);
+	`
+	if _, err := db.Exec(indexes); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create indexes: %w", err)
+	}
+
+	if config.Metrics == nil {
+		config.Metrics = NewDLQMetrics()
 	}
 
 	dlq := &DLQ{
 		db:      db,
-		metrics: metrics,
+		config:  config,
+		metrics: config.Metrics,
+		stopCh:  make(chan struct{}),
 	}
 
-	// Update active entries metric
-	dlq.updateActiveEntriesMetric()
+	// Populate metrics from existing entries, then keep ages current
+	dlq.refreshMetrics()
+	go dlq.refreshLoop()
 
 	return dlq, nil
 }
@@ -158,8 +383,8 @@ func (d *DLQ) Add(entry *DLQEntry) error {
 	}
 
 	query := `
-		INSERT INTO dlq_entries (method, url, headers, body, status_code, retries, last_error, created_at, last_attempt)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO dlq_entries (method, url, headers, body, status_code, retries, last_error, created_at, last_attempt, lease_id, key_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := d.db.Exec(query,
@@ -172,6 +397,8 @@ func (d *DLQ) Add(entry *DLQEntry) error {
 		entry.LastError,
 		entry.CreatedAt,
 		entry.LastAttempt,
+		entry.LeaseID,
+		entry.KeyID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to insert entry: %w", err)
@@ -193,17 +420,18 @@ func (d *DLQ) Add(entry *DLQEntry) error {
 
 // List returns all entries in the DLQ
 func (d *DLQ) List(limit, offset int) ([]*DLQEntry, error) {
+	return d.ListFiltered(DLQFilter{}, limit, offset)
+}
+
+// ListFiltered returns entries matching the filter, newest first
+func (d *DLQ) ListFiltered(filter DLQFilter, limit, offset int) ([]*DLQEntry, error) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
-	query := `
-		SELECT id, method, url, headers, body, status_code, retries, last_error, created_at, last_attempt
-		FROM dlq_entries
-		ORDER BY created_at DESC
-		LIMIT ? OFFSET ?
-	`
+	where, args := filter.where()
+	query := `SELECT ` + dlqColumns + ` FROM dlq_entries ` + where + ` ORDER BY created_at DESC LIMIT ? OFFSET ?`
 
-	rows, err := d.db.Query(query, limit, offset)
+	rows, err := d.db.Query(query, append(args, limit, offset)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query entries: %w", err)
 	}
@@ -211,28 +439,9 @@ func (d *DLQ) List(limit, offset int) ([]*DLQEntry, error) {
 
 	var entries []*DLQEntry
 	for rows.Next() {
-		entry := &DLQEntry{}
-		var headersJSON string
-
-		err := rows.Scan(
-			&entry.ID,
-			&entry.Method,
-			&entry.URL,
-			&headersJSON,
-			&entry.Body,
-			&entry.StatusCode,
-			&entry.Retries,
-			&entry.LastError,
-			&entry.CreatedAt,
-			&entry.LastAttempt,
-		)
+		entry, err := scanEntry(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan entry: %w", err)
-		}
-
-		// Deserialize headers
-		if err := json.Unmarshal([]byte(headersJSON), &entry.Headers); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal headers: %w", err)
+			return nil, err
 		}
 
 		entries = append(entries, entry)
@@ -250,16 +459,30 @@ func (d *DLQ) Get(id int64) (*DLQEntry, error) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
-	query := `
-		SELECT id, method, url, headers, body, status_code, retries, last_error, created_at, last_attempt
-		FROM dlq_entries
-		WHERE id = ?
-	`
+	query := `SELECT ` + dlqColumns + ` FROM dlq_entries WHERE id = ?`
+
+	entry, err := scanEntry(d.db.QueryRow(query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrEntryNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
 
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanEntry reads a DLQEntry from a row selected with dlqColumns
+func scanEntry(row rowScanner) (*DLQEntry, error) {
 	entry := &DLQEntry{}
 	var headersJSON string
 
-	err := d.db.QueryRow(query, id).Scan(
+	err := row.Scan(
 		&entry.ID,
 		&entry.Method,
 		&entry.URL,
@@ -270,12 +493,13 @@ func (d *DLQ) Get(id int64) (*DLQEntry, error) {
 		&entry.LastError,
 		&entry.CreatedAt,
 		&entry.LastAttempt,
+		&entry.LeaseID,
+		&entry.KeyID,
+		&entry.Replays,
+		&entry.PermanentlyFailed,
 	)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("entry not found: %d", id)
-	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get entry: %w", err)
+		return nil, fmt.Errorf("failed to scan entry: %w", err)
 	}
 
 	// Deserialize headers
@@ -304,7 +528,7 @@ func (d *DLQ) Delete(id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("entry not found: %d", id)
+		return fmt.Errorf("%w: %d", ErrEntryNotFound, id)
 	}
 
 	// Update metrics
@@ -316,13 +540,19 @@ func (d *DLQ) Delete(id int64) error {
 
 // Count returns the total number of entries in the DLQ
 func (d *DLQ) Count() (int, error) {
+	return d.CountFiltered(DLQFilter{})
+}
+
+// CountFiltered returns the number of entries matching the filter
+func (d *DLQ) CountFiltered(filter DLQFilter) (int, error) {
 	d.mutex.RLock()
 	defer d.mutex.RUnlock()
 
-	query := `SELECT COUNT(*) FROM dlq_entries`
+	where, args := filter.where()
+	query := `SELECT COUNT(*) FROM dlq_entries ` + where
 
 	var count int
-	err := d.db.QueryRow(query).Scan(&count)
+	err := d.db.QueryRow(query, args...).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count entries: %w", err)
 	}
@@ -330,18 +560,96 @@ func (d *DLQ) Count() (int, error) {
 	return count, nil
 }
 
-// updateActiveEntriesMetric updates the active entries metric
-func (d *DLQ) updateActiveEntriesMetric() {
-	count, err := d.Count()
+// OldestCreatedAt returns when the oldest entry was added, or the zero time if the DLQ is empty
+func (d *DLQ) OldestCreatedAt() (time.Time, error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	var createdAt time.Time
+	err := d.db.QueryRow(`SELECT created_at FROM dlq_entries ORDER BY created_at ASC LIMIT 1`).Scan(&createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
 	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query oldest entry: %w", err)
+	}
+
+	return createdAt, nil
+}
+
+// refreshLoop periodically recomputes the metrics derived from stored entries
+func (d *DLQ) refreshLoop() {
+	ticker := time.NewTicker(d.config.MetricsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.refreshMetrics()
+		case <-d.stopCh:
+			return
+		}
+	}
+}
+
+// refreshMetrics scans the stored entries to update the active count, age and per-host metrics
+func (d *DLQ) refreshMetrics() {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+
+	rows, err := d.db.Query(`SELECT url, created_at FROM dlq_entries`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	var ages []float64
+	oldest := 0.0
+	hosts := make(map[string]int)
+
+	for rows.Next() {
+		var rawURL string
+		var createdAt time.Time
+		if err := rows.Scan(&rawURL, &createdAt); err != nil {
+			return
+		}
+
+		age := max(now.Sub(createdAt).Seconds(), 0)
+		ages = append(ages, age)
+		oldest = max(oldest, age)
+		hosts[entryHost(rawURL)]++
+	}
+	if rows.Err() != nil {
 		return
 	}
 
-	d.metrics.EntriesActive.Set(float64(count))
+	d.metrics.EntriesActive.Set(float64(len(ages)))
+	d.metrics.OldestEntryAge.Set(oldest)
+	d.metrics.EntryAge.Set(ages)
+
+	// Hosts with no entries left are dropped rather than reported as zero
+	d.metrics.EntriesByHost.Reset()
+	for host, count := range hosts {
+		d.metrics.EntriesByHost.WithLabelValues(host).Set(float64(count))
+	}
 }
 
-// Close closes the DLQ database
+// entryHost returns the host an entry was sent to, or "unknown" if its URL has none
+func entryHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "unknown"
+	}
+	return u.Host
+}
+
+// Close stops the metrics refresh and closes the DLQ database
 func (d *DLQ) Close() error {
+	if d.stopCh != nil {
+		d.stopOnce.Do(func() { close(d.stopCh) })
+	}
+
 	if d.db != nil {
 		return d.db.Close()
 	}
@@ -1,12 +1,14 @@
 package webhook
 
 import (
+	"database/sql"
 	"net/http"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // newTestDLQMetrics creates new DLQ metrics for testing with a fresh registry
@@ -132,6 +134,125 @@ func TestDLQList(t *testing.T) {
 	}
 }
 
+// TestDLQListFiltered tests filtering entries by lease and key
+func TestDLQListFiltered(t *testing.T) {
+	dbPath := "test_dlq_list_filtered.db"
+	defer os.Remove(dbPath)
+
+	dlq, err := NewDLQWithMetrics(dbPath, newTestDLQMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create DLQ: %v", err)
+	}
+	defer dlq.Close()
+
+	origins := []struct{ leaseID, keyID string }{
+		{"lease-a", "key-1"},
+		{"lease-a", "key-2"},
+		{"lease-b", "key-1"},
+		{"", ""},
+	}
+	for _, origin := range origins {
+		entry := &DLQEntry{
+			Method:      "POST",
+			URL:         "http://example.com/webhook",
+			Headers:     http.Header{},
+			LastError:   "error",
+			CreatedAt:   time.Now(),
+			LastAttempt: time.Now(),
+			LeaseID:     origin.leaseID,
+			KeyID:       origin.keyID,
+		}
+		if err := dlq.Add(entry); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter DLQFilter
+		want   int
+	}{
+		{"no filter", DLQFilter{}, 4},
+		{"by lease", DLQFilter{LeaseID: "lease-a"}, 2},
+		{"by key", DLQFilter{KeyID: "key-1"}, 2},
+		{"by lease and key", DLQFilter{LeaseID: "lease-a", KeyID: "key-2"}, 1},
+		{"no match", DLQFilter{LeaseID: "lease-c"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := dlq.ListFiltered(tt.filter, 10, 0)
+			if err != nil {
+				t.Fatalf("Failed to list entries: %v", err)
+			}
+			if len(entries) != tt.want {
+				t.Errorf("Expected %d entries, got %d", tt.want, len(entries))
+			}
+			for _, entry := range entries {
+				if tt.filter.LeaseID != "" && entry.LeaseID != tt.filter.LeaseID {
+					t.Errorf("Entry %d has lease %q, want %q", entry.ID, entry.LeaseID, tt.filter.LeaseID)
+				}
+				if tt.filter.KeyID != "" && entry.KeyID != tt.filter.KeyID {
+					t.Errorf("Entry %d has key %q, want %q", entry.ID, entry.KeyID, tt.filter.KeyID)
+				}
+			}
+
+			count, err := dlq.CountFiltered(tt.filter)
+			if err != nil {
+				t.Fatalf("Failed to count entries: %v", err)
+			}
+			if count != tt.want {
+				t.Errorf("Expected count %d, got %d", tt.want, count)
+			}
+		})
+	}
+}
+
+// TestDLQMigratesExistingDatabase tests that databases created before lease and key columns are upgraded
+func TestDLQMigratesExistingDatabase(t *testing.T) {
+	dbPath := "test_dlq_migrate.db"
+	defer os.Remove(dbPath)
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	_, err = db.Exec(`
+	CREATE TABLE dlq_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		method TEXT NOT NULL,
+		url TEXT NOT NULL,
+		headers TEXT NOT NULL,
+		body BLOB,
+		status_code INTEGER,
+		retries INTEGER NOT NULL,
+		last_error TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_attempt DATETIME NOT NULL
+	);
+	INSERT INTO dlq_entries (method, url, headers, body, status_code, retries, last_error, created_at, last_attempt)
+	VALUES ('POST', 'http://example.com/webhook', '{}', NULL, 500, 3, 'error', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	dlq, err := NewDLQWithMetrics(dbPath, newTestDLQMetrics())
+	if err != nil {
+		t.Fatalf("Failed to open existing DLQ: %v", err)
+	}
+	defer dlq.Close()
+
+	entry, err := dlq.Get(1)
+	if err != nil {
+		t.Fatalf("Failed to get migrated entry: %v", err)
+	}
+	if entry.LeaseID != "" || entry.KeyID != "" {
+		t.Errorf("Expected empty lease and key for migrated entry, got %q/%q", entry.LeaseID, entry.KeyID)
+	}
+}
+
 func TestDLQGet(t *testing.T) {
 	dbPath := "test_dlq_get.db"
 	defer os.Remove(dbPath)
@@ -310,6 +431,48 @@ func TestDLQCount(t *testing.T) {
 	}
 }
 
+func TestDLQOldestCreatedAt(t *testing.T) {
+	dbPath := "test_dlq_oldest.db"
+	defer os.Remove(dbPath)
+
+	dlq, err := NewDLQWithMetrics(dbPath, newTestDLQMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create DLQ: %v", err)
+	}
+	defer dlq.Close()
+
+	oldest, err := dlq.OldestCreatedAt()
+	if err != nil {
+		t.Fatalf("Failed to get oldest entry: %v", err)
+	}
+	if !oldest.IsZero() {
+		t.Errorf("Expected the zero time for an empty DLQ, got %v", oldest)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	for _, age := range []time.Duration{time.Minute, 2 * time.Hour, 10 * time.Second} {
+		entry := &DLQEntry{
+			Method:      "POST",
+			URL:         "http://example.com/webhook",
+			Headers:     http.Header{},
+			LastError:   "error",
+			CreatedAt:   now.Add(-age),
+			LastAttempt: now,
+		}
+		if err := dlq.Add(entry); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+
+	oldest, err = dlq.OldestCreatedAt()
+	if err != nil {
+		t.Fatalf("Failed to get oldest entry: %v", err)
+	}
+	if !oldest.Equal(now.Add(-2 * time.Hour)) {
+		t.Errorf("Expected oldest entry from %v, got %v", now.Add(-2*time.Hour), oldest)
+	}
+}
+
 func TestDLQPersistence(t *testing.T) {
 	dbPath := "test_dlq_persistence.db"
 	defer os.Remove(dbPath)
@@ -379,6 +542,110 @@ func TestGetDLQMetrics(t *testing.T) {
 	}
 }
 
+// TestDLQAgeMetrics tests the oldest entry age, age histogram and per-host counts
+func TestDLQAgeMetrics(t *testing.T) {
+	dbPath := "test_dlq_age_metrics.db"
+	defer os.Remove(dbPath)
+
+	reg := prometheus.NewRegistry()
+	metrics := NewDLQMetricsWithRegistry(reg)
+	dlq, err := NewDLQWithMetrics(dbPath, metrics)
+	if err != nil {
+		t.Fatalf("Failed to create DLQ: %v", err)
+	}
+	defer dlq.Close()
+
+	now := time.Now()
+	entries := []struct {
+		url string
+		age time.Duration
+	}{
+		{"https://a.example.com/hook", 2 * time.Hour},
+		{"https://a.example.com/other", 3 * 24 * time.Hour},
+		{"https://b.example.com:8443/hook", 10 * time.Minute},
+		{"not a url", time.Minute / 2},
+	}
+	for _, e := range entries {
+		entry := &DLQEntry{
+			Method:      "POST",
+			URL:         e.url,
+			Headers:     http.Header{},
+			LastError:   "failed",
+			CreatedAt:   now.Add(-e.age),
+			LastAttempt: now,
+		}
+		if err := dlq.Add(entry); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+
+	dlq.refreshMetrics()
+
+	m := &dto.Metric{}
+	metrics.OldestEntryAge.Write(m)
+	if age := m.Gauge.GetValue(); age < (3*24*time.Hour).Seconds() || age > (3*24*time.Hour+time.Minute).Seconds() {
+		t.Errorf("Expected oldest entry age of about 3 days, got %vs", age)
+	}
+
+	hosts := map[string]float64{"a.example.com": 2, "b.example.com:8443": 1, "unknown": 1}
+	for host, want := range hosts {
+		m := &dto.Metric{}
+		metrics.EntriesByHost.WithLabelValues(host).Write(m)
+		if got := m.Gauge.GetValue(); got != want {
+			t.Errorf("Expected %v entries for host %s, got %v", want, host, got)
+		}
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	var histogram *dto.Histogram
+	for _, family := range families {
+		if family.GetName() == "portal_dlq_entry_age_seconds" {
+			histogram = family.GetMetric()[0].GetHistogram()
+		}
+	}
+	if histogram == nil {
+		t.Fatal("Expected portal_dlq_entry_age_seconds to be exported")
+	}
+	if histogram.GetSampleCount() != 4 {
+		t.Errorf("Expected 4 samples, got %d", histogram.GetSampleCount())
+	}
+
+	// Cumulative counts: 1 entry within a minute, 2 within 15 minutes, 3 within 6 hours, all within 7 days
+	wantBuckets := map[float64]uint64{60: 1, 900: 2, 6 * 3600: 3, 7 * 86400: 4}
+	for _, bucket := range histogram.GetBucket() {
+		if want, ok := wantBuckets[bucket.GetUpperBound()]; ok && bucket.GetCumulativeCount() != want {
+			t.Errorf("Expected %d entries within %vs, got %d", want, bucket.GetUpperBound(), bucket.GetCumulativeCount())
+		}
+	}
+
+	// Refreshing after deletes replaces the snapshot instead of accumulating
+	list, _ := dlq.List(10, 0)
+	for _, entry := range list {
+		if entry.URL != "https://b.example.com:8443/hook" {
+			dlq.Delete(entry.ID)
+		}
+	}
+	dlq.refreshMetrics()
+
+	families, _ = reg.Gather()
+	for _, family := range families {
+		switch family.GetName() {
+		case "portal_dlq_entry_age_seconds":
+			if count := family.GetMetric()[0].GetHistogram().GetSampleCount(); count != 1 {
+				t.Errorf("Expected 1 sample after deletes, got %d", count)
+			}
+		case "portal_dlq_entries_by_host":
+			if len(family.GetMetric()) != 1 {
+				t.Errorf("Expected only one host after deletes, got %d", len(family.GetMetric()))
+			}
+		}
+	}
+}
+
 func TestDLQClose(t *testing.T) {
 	dbPath := "test_dlq_close.db"
 	defer os.Remove(dbPath)
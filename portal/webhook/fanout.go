@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// FanoutEndpoint configures delivery to a single subscriber
+type FanoutEndpoint struct {
+	// Name identifies the endpoint in results (defaults to URL)
+	Name string
+
+	// URL is the subscriber URL
+	URL string
+
+	// Method is the HTTP method (defaults to POST)
+	Method string
+
+	// Headers are added to every request to this endpoint
+	Headers http.Header
+
+	// Retry is the retry configuration for this endpoint (nil uses DefaultRetryConfig)
+	// Its DLQ receives entries for failed deliveries to this endpoint
+	Retry *RetryConfig
+}
+
+// FanoutConfig holds fan-out delivery configuration
+type FanoutConfig struct {
+	// Endpoints are the subscribers to deliver to
+	Endpoints []FanoutEndpoint
+
+	// MaxConcurrency bounds the number of concurrent deliveries
+	MaxConcurrency int
+
+	// Metrics is shared by all endpoint retry handlers without their own metrics
+	Metrics *RetryMetrics
+
+	// DLQ is used for endpoints whose retry configuration has no DLQ
+	DLQ *DLQ
+}
+
+// FanoutResult is the delivery outcome for a single endpoint
+type FanoutResult struct {
+	Name       string        `json:"name"`
+	URL        string        `json:"url"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Err        error         `json:"-"`
+}
+
+// FanoutSummary aggregates the results of a fan-out delivery
+type FanoutSummary struct {
+	Results   []FanoutResult `json:"results"` // In endpoint order
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+}
+
+// Fanout delivers a payload to multiple endpoints with independent retries
+type Fanout struct {
+	targets        []*fanoutTarget
+	maxConcurrency int
+}
+
+// fanoutTarget pairs an endpoint with its own retry handler
+type fanoutTarget struct {
+	endpoint FanoutEndpoint
+	handler  *RetryHandler
+}
+
+// NewFanout creates a new fan-out deliverer
+func NewFanout(config *FanoutConfig) (*Fanout, error) {
+	if config == nil || len(config.Endpoints) == 0 {
+		return nil, errors.New("at least one fanout endpoint is required")
+	}
+
+	maxConcurrency := config.MaxConcurrency
+	if maxConcurrency <= 0 {
+		maxConcurrency = 4
+	}
+
+	// Retry handlers share one metrics collector, registering it once
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = NewRetryMetrics()
+	}
+
+	targets := make([]*fanoutTarget, 0, len(config.Endpoints))
+	for _, endpoint := range config.Endpoints {
+		if endpoint.URL == "" {
+			return nil, errors.New("fanout endpoint URL cannot be empty")
+		}
+
+		if endpoint.Name == "" {
+			endpoint.Name = endpoint.URL
+		}
+
+		if endpoint.Method == "" {
+			endpoint.Method = http.MethodPost
+		}
+
+		// Copy the retry configuration so endpoints never share budget or DLQ state
+		var retryConfig RetryConfig
+		if endpoint.Retry != nil {
+			retryConfig = *endpoint.Retry
+		} else {
+			retryConfig = *DefaultRetryConfig()
+		}
+
+		if retryConfig.Metrics == nil {
+			retryConfig.Metrics = metrics
+		}
+
+		if retryConfig.DLQ == nil {
+			retryConfig.DLQ = config.DLQ
+		}
+
+		targets = append(targets, &fanoutTarget{
+			endpoint: endpoint,
+			handler:  NewRetryHandler(&retryConfig),
+		})
+	}
+
+	return &Fanout{
+		targets:        targets,
+		maxConcurrency: maxConcurrency,
+	}, nil
+}
+
+// Deliver sends the payload to every endpoint concurrently and waits for all results
+func (f *Fanout) Deliver(ctx context.Context, payload []byte) *FanoutSummary {
+	summary := &FanoutSummary{
+		Results: make([]FanoutResult, len(f.targets)),
+	}
+
+	sem := make(chan struct{}, f.maxConcurrency)
+	var wg sync.WaitGroup
+
+	for i, target := range f.targets {
+		wg.Add(1)
+		go func(i int, target *fanoutTarget) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			summary.Results[i] = target.deliver(ctx, payload)
+		}(i, target)
+	}
+
+	wg.Wait()
+
+	for _, result := range summary.Results {
+		if result.Err != nil {
+			summary.Failed++
+		} else {
+			summary.Succeeded++
+		}
+	}
+
+	return summary
+}
+
+// deliver sends the payload to a single endpoint
+// The result is named so the deferred Duration is part of what is returned
+func (t *fanoutTarget) deliver(ctx context.Context, payload []byte) (result FanoutResult) {
+	result = FanoutResult{
+		Name: t.endpoint.Name,
+		URL:  t.endpoint.URL,
+	}
+
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, t.endpoint.Method, t.endpoint.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Err = fmt.Errorf("failed to create request: %w", err)
+		result.Error = result.Err.Error()
+		return result
+	}
+
+	for key, values := range t.endpoint.Headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := t.handler.Do(req)
+	if err != nil {
+		result.Err = err
+		result.Error = err.Error()
+		return result
+	}
+
+	// Drain and close response body
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+
+	// Non-retryable error statuses are returned without an error but still failed
+	if resp.StatusCode >= 400 {
+		result.Err = fmt.Errorf("request failed with status %d", resp.StatusCode)
+		result.Error = result.Err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewFanoutValidation(t *testing.T) {
+	if _, err := NewFanout(nil); err == nil {
+		t.Error("Expected error for nil config")
+	}
+
+	if _, err := NewFanout(&FanoutConfig{}); err == nil {
+		t.Error("Expected error for no endpoints")
+	}
+
+	_, err := NewFanout(&FanoutConfig{
+		Endpoints: []FanoutEndpoint{{Name: "missing-url"}},
+		Metrics:   newTestRetryMetrics(),
+	})
+	if err == nil {
+		t.Error("Expected error for empty endpoint URL")
+	}
+}
+
+func TestFanoutDeliver(t *testing.T) {
+	dbPath := "test_fanout_dlq.db"
+	defer os.Remove(dbPath)
+
+	dlq, err := NewDLQWithMetrics(dbPath, newTestDLQMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create DLQ: %v", err)
+	}
+	defer dlq.Close()
+
+	var received atomic.Value
+	okServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+
+		if r.Header.Get("X-Subscriber") != "ok" {
+			t.Errorf("Expected X-Subscriber header 'ok', got %q", r.Header.Get("X-Subscriber"))
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer okServer.Close()
+
+	var failAttempts int32
+	failServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failAttempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failServer.Close()
+
+	fanout, err := NewFanout(&FanoutConfig{
+		Endpoints: []FanoutEndpoint{
+			{
+				Name:    "ok",
+				URL:     okServer.URL,
+				Headers: http.Header{"X-Subscriber": []string{"ok"}},
+				Retry:   &RetryConfig{MaxRetries: 1, InitialBackoff: 10 * time.Millisecond},
+			},
+			{
+				Name:  "failing",
+				URL:   failServer.URL,
+				Retry: &RetryConfig{MaxRetries: 2, InitialBackoff: 10 * time.Millisecond},
+			},
+		},
+		Metrics: newTestRetryMetrics(),
+		DLQ:     dlq,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create fanout: %v", err)
+	}
+
+	summary := fanout.Deliver(context.Background(), []byte(`{"event":"test"}`))
+
+	if summary.Succeeded != 1 || summary.Failed != 1 {
+		t.Fatalf("Expected 1 succeeded and 1 failed, got %d and %d", summary.Succeeded, summary.Failed)
+	}
+
+	if len(summary.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(summary.Results))
+	}
+
+	ok := summary.Results[0]
+	if ok.Name != "ok" || ok.Err != nil || ok.StatusCode != http.StatusOK {
+		t.Errorf("Unexpected result for ok endpoint: %+v", ok)
+	}
+
+	if received.Load() != `{"event":"test"}` {
+		t.Errorf("Expected payload to be delivered, got %v", received.Load())
+	}
+
+	failing := summary.Results[1]
+	if failing.Name != "failing" || failing.Err == nil {
+		t.Errorf("Expected failing endpoint to report an error: %+v", failing)
+	}
+
+	if attempts := atomic.LoadInt32(&failAttempts); attempts != 3 {
+		t.Errorf("Expected 3 attempts to failing endpoint, got %d", attempts)
+	}
+
+	count, err := dlq.Count()
+	if err != nil {
+		t.Fatalf("Failed to count DLQ entries: %v", err)
+	}
+
+	if count != 1 {
+		t.Errorf("Expected 1 DLQ entry, got %d", count)
+	}
+
+	entries, err := dlq.List(10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list DLQ entries: %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].URL != failServer.URL {
+		t.Errorf("Expected DLQ entry for failing endpoint, got %+v", entries)
+	}
+}
+
+func TestFanoutNonRetryableStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	fanout, err := NewFanout(&FanoutConfig{
+		Endpoints: []FanoutEndpoint{{URL: server.URL}},
+		Metrics:   newTestRetryMetrics(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create fanout: %v", err)
+	}
+
+	summary := fanout.Deliver(context.Background(), []byte("payload"))
+
+	if summary.Failed != 1 {
+		t.Errorf("Expected 1 failed delivery, got %d", summary.Failed)
+	}
+
+	result := summary.Results[0]
+	if result.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", result.StatusCode)
+	}
+
+	if result.Name != server.URL {
+		t.Errorf("Expected name to default to URL, got %q", result.Name)
+	}
+}
+
+func TestFanoutResultDuration(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fanout, err := NewFanout(&FanoutConfig{
+		Endpoints: []FanoutEndpoint{{URL: server.URL}},
+		Metrics:   newTestRetryMetrics(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create fanout: %v", err)
+	}
+
+	summary := fanout.Deliver(context.Background(), []byte("payload"))
+
+	if got := summary.Results[0].Duration; got < 20*time.Millisecond {
+		t.Errorf("Expected the duration to cover the slow response, got %v", got)
+	}
+}
+
+func TestFanoutMaxConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	endpoints := make([]FanoutEndpoint, 6)
+	for i := range endpoints {
+		endpoints[i] = FanoutEndpoint{URL: server.URL}
+	}
+
+	fanout, err := NewFanout(&FanoutConfig{
+		Endpoints:      endpoints,
+		MaxConcurrency: 2,
+		Metrics:        newTestRetryMetrics(),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create fanout: %v", err)
+	}
+
+	summary := fanout.Deliver(context.Background(), []byte("payload"))
+
+	if summary.Succeeded != len(endpoints) {
+		t.Errorf("Expected %d succeeded, got %d", len(endpoints), summary.Succeeded)
+	}
+
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent deliveries, got %d", peak)
+	}
+}
@@ -0,0 +1,123 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Replay errors
+var (
+	ErrEntryNotFound      = errors.New("entry not found")
+	ErrMaxReplaysExceeded = errors.New("maximum replays exceeded")
+	ErrPermanentlyFailed  = errors.New("entry is permanently failed")
+	ErrReplayFailed       = errors.New("replay failed")
+)
+
+// Replay resends a DLQ entry through handler, counting the attempt against MaxReplays
+// It returns nil only when the endpoint answered with a 2xx status; the caller decides
+// whether to delete the entry. handler should have no DLQ configured, otherwise a failed
+// replay would enqueue a duplicate entry
+func (d *DLQ) Replay(ctx context.Context, id int64, handler *RetryHandler) error {
+	entry, err := d.reserveReplay(id)
+	if err != nil {
+		return err
+	}
+
+	d.metrics.ReplayTotal.Inc()
+
+	req, err := http.NewRequestWithContext(ctx, entry.Method, entry.URL, bytes.NewReader(entry.Body))
+	if err != nil {
+		return fmt.Errorf("failed to build replay request: %w", err)
+	}
+	for key, values := range entry.Headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	resp, err := handler.Do(req)
+	if err != nil {
+		d.metrics.ReplayFailure.Inc()
+		d.recordReplayFailure(entry, 0, err.Error())
+		return fmt.Errorf("%w: %w", ErrReplayFailed, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		d.metrics.ReplayFailure.Inc()
+		d.recordReplayFailure(entry, resp.StatusCode, fmt.Sprintf("replay failed with status %d", resp.StatusCode))
+		return fmt.Errorf("%w with status %d", ErrReplayFailed, resp.StatusCode)
+	}
+
+	d.metrics.ReplaySuccess.Inc()
+	return nil
+}
+
+// reserveReplay atomically counts a replay attempt, refusing entries that are
+// permanently failed or have used up their replays
+func (d *DLQ) reserveReplay(id int64) (*DLQEntry, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	maxReplays := d.config.MaxReplays
+	result, err := d.db.Exec(`
+		UPDATE dlq_entries SET replays = replays + 1
+		WHERE id = ? AND permanently_failed = 0 AND (? = 0 OR replays < ?)
+	`, id, maxReplays, maxReplays)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve replay: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	entry, err := scanEntry(d.db.QueryRow(`SELECT `+dlqColumns+` FROM dlq_entries WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: %d", ErrEntryNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		if entry.PermanentlyFailed {
+			return nil, fmt.Errorf("%w: entry %d", ErrPermanentlyFailed, id)
+		}
+
+		// The cap may have been lowered since the last replay; flag the entry now
+		if d.config.MarkPermanentlyFailed {
+			d.db.Exec(`UPDATE dlq_entries SET permanently_failed = 1 WHERE id = ?`, id)
+		}
+		return nil, fmt.Errorf("%w: entry %d was replayed %d times (max %d)", ErrMaxReplaysExceeded, id, entry.Replays, maxReplays)
+	}
+
+	return entry, nil
+}
+
+// recordReplayFailure stores the outcome of a failed replay, flagging the entry
+// as permanently failed once it has no replays left
+func (d *DLQ) recordReplayFailure(entry *DLQEntry, statusCode int, lastError string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if statusCode == 0 {
+		statusCode = entry.StatusCode
+	}
+
+	permanentlyFailed := d.config.MarkPermanentlyFailed && d.config.MaxReplays > 0 && entry.Replays >= d.config.MaxReplays
+
+	// Best effort: the replay error is what the caller needs to see
+	d.db.Exec(`
+		UPDATE dlq_entries SET status_code = ?, last_error = ?, last_attempt = ?, permanently_failed = ?
+		WHERE id = ?
+	`, statusCode, lastError, time.Now(), permanentlyFailed, entry.ID)
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestReplayDLQ creates a DLQ with a replay cap and one entry pointing at url
+func newTestReplayDLQ(t *testing.T, dbPath string, maxReplays int, url string) (*DLQ, int64) {
+	t.Helper()
+
+	config := DefaultDLQConfig()
+	config.MaxReplays = maxReplays
+	config.Metrics = newTestDLQMetrics()
+
+	dlq, err := NewDLQWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to create DLQ: %v", err)
+	}
+
+	entry := &DLQEntry{
+		Method:      "POST",
+		URL:         url,
+		Headers:     http.Header{"X-Test": []string{"value"}},
+		Body:        []byte(`{"test": "data"}`),
+		StatusCode:  500,
+		LastError:   "error",
+		CreatedAt:   time.Now(),
+		LastAttempt: time.Now(),
+	}
+	if err := dlq.Add(entry); err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	return dlq, entry.ID
+}
+
+// newTestReplayHandler creates a retry handler that does not retry
+func newTestReplayHandler() *RetryHandler {
+	return NewRetryHandler(&RetryConfig{
+		MaxRetries:     1,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		RetryOn5xxOnly: true,
+		Metrics:        newTestRetryMetrics(),
+	})
+}
+
+// TestDLQReplaySuccess tests that a successful replay is counted and leaves deletion to the caller
+func TestDLQReplaySuccess(t *testing.T) {
+	dbPath := "test_dlq_replay_success.db"
+	defer os.Remove(dbPath)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Test") != "value" {
+			t.Error("Expected replay to carry stored headers")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dlq, id := newTestReplayDLQ(t, dbPath, 3, server.URL)
+	defer dlq.Close()
+
+	if err := dlq.Replay(context.Background(), id, newTestReplayHandler()); err != nil {
+		t.Fatalf("Expected replay to succeed, got %v", err)
+	}
+
+	entry, err := dlq.Get(id)
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if entry.Replays != 1 {
+		t.Errorf("Expected 1 replay, got %d", entry.Replays)
+	}
+}
+
+// TestDLQReplayCap tests that replays stop at MaxReplays and the entry is flagged
+func TestDLQReplayCap(t *testing.T) {
+	dbPath := "test_dlq_replay_cap.db"
+	defer os.Remove(dbPath)
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dlq, id := newTestReplayDLQ(t, dbPath, 2, server.URL)
+	defer dlq.Close()
+
+	handler := newTestReplayHandler()
+
+	for i := 0; i < 2; i++ {
+		if err := dlq.Replay(context.Background(), id, handler); !errors.Is(err, ErrReplayFailed) {
+			t.Fatalf("Replay %d: expected ErrReplayFailed, got %v", i+1, err)
+		}
+	}
+
+	entry, err := dlq.Get(id)
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if entry.Replays != 2 {
+		t.Errorf("Expected 2 replays, got %d", entry.Replays)
+	}
+	if !entry.PermanentlyFailed {
+		t.Error("Expected entry to be permanently failed after its last replay")
+	}
+	if !strings.Contains(entry.LastError, "503") {
+		t.Errorf("Expected last error to mention status 503, got %q", entry.LastError)
+	}
+
+	sent := attempts
+	if err := dlq.Replay(context.Background(), id, handler); !errors.Is(err, ErrPermanentlyFailed) {
+		t.Errorf("Expected ErrPermanentlyFailed, got %v", err)
+	}
+	if attempts != sent {
+		t.Error("Expected no request to be sent for a permanently failed entry")
+	}
+}
+
+// TestDLQReplayCapWithoutMarking tests the cap when entries are not flagged
+func TestDLQReplayCapWithoutMarking(t *testing.T) {
+	dbPath := "test_dlq_replay_nomark.db"
+	defer os.Remove(dbPath)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	dlq, id := newTestReplayDLQ(t, dbPath, 1, server.URL)
+	defer dlq.Close()
+	dlq.config.MarkPermanentlyFailed = false
+
+	handler := newTestReplayHandler()
+	if err := dlq.Replay(context.Background(), id, handler); !errors.Is(err, ErrReplayFailed) {
+		t.Fatalf("Expected ErrReplayFailed, got %v", err)
+	}
+	if err := dlq.Replay(context.Background(), id, handler); !errors.Is(err, ErrMaxReplaysExceeded) {
+		t.Errorf("Expected ErrMaxReplaysExceeded, got %v", err)
+	}
+
+	entry, err := dlq.Get(id)
+	if err != nil {
+		t.Fatalf("Failed to get entry: %v", err)
+	}
+	if entry.PermanentlyFailed {
+		t.Error("Expected entry not to be flagged")
+	}
+}
+
+// TestDLQReplayNotFound tests replaying a missing entry
+func TestDLQReplayNotFound(t *testing.T) {
+	dbPath := "test_dlq_replay_notfound.db"
+	defer os.Remove(dbPath)
+
+	dlq, _ := newTestReplayDLQ(t, dbPath, 1, "http://127.0.0.1:1")
+	defer dlq.Close()
+
+	if err := dlq.Replay(context.Background(), 999, newTestReplayHandler()); !errors.Is(err, ErrEntryNotFound) {
+		t.Errorf("Expected ErrEntryNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,335 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ReplayerConfig holds automatic DLQ replay configuration
+type ReplayerConfig struct {
+	// Interval is how often the DLQ is scanned for entries to replay
+	Interval time.Duration
+
+	// BatchSize is the most entries replayed per scan
+	BatchSize int
+
+	// Concurrency is the most replays in flight at once
+	Concurrency int
+
+	// HostRate paces replays to a single host, in replays per second (0 = unlimited)
+	HostRate float64
+
+	// FailureThreshold is the number of consecutive failed replays to a host that pauses it
+	FailureThreshold int
+
+	// PauseDuration is how long a host is first paused; each further pause without
+	// a successful replay in between doubles it, up to MaxPauseDuration
+	PauseDuration    time.Duration
+	MaxPauseDuration time.Duration
+}
+
+// DefaultReplayerConfig returns default automatic DLQ replay configuration
+func DefaultReplayerConfig() *ReplayerConfig {
+	return &ReplayerConfig{
+		Interval:         time.Minute,
+		BatchSize:        100,
+		Concurrency:      4,
+		HostRate:         5,
+		FailureThreshold: 5,
+		PauseDuration:    30 * time.Second,
+		MaxPauseDuration: 10 * time.Minute,
+	}
+}
+
+// ReplayRun summarizes one pass of the replayer over the DLQ
+type ReplayRun struct {
+	Succeeded int // Replayed and deleted from the DLQ
+	Failed    int // Replayed, but the endpoint did not answer with a 2xx status
+	Skipped   int // Not replayed: host paused, replays used up, or the run was stopped
+}
+
+// Replayer drains the DLQ in the background without overwhelming endpoints that have
+// just recovered: replays are bounded in number, paced per host, and a host that keeps
+// failing is paused with exponential backoff
+type Replayer struct {
+	dlq     *DLQ
+	handler *RetryHandler
+	config  *ReplayerConfig
+	now     func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*replayHost
+
+	cancel   context.CancelFunc
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// replayHost tracks pacing and failures for one target host
+type replayHost struct {
+	next        time.Time // Earliest time the next replay may start
+	failures    int       // Consecutive failed replays since the last success or pause
+	pauses      int       // Pauses since the last success
+	pausedUntil time.Time
+}
+
+// NewReplayer creates an automatic DLQ replayer
+// handler should have no DLQ configured, otherwise a failed replay would enqueue a duplicate entry
+func NewReplayer(dlq *DLQ, handler *RetryHandler, config *ReplayerConfig) *Replayer {
+	if config == nil {
+		config = DefaultReplayerConfig()
+	}
+
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+
+	if config.Concurrency <= 0 {
+		config.Concurrency = 4
+	}
+
+	if config.HostRate < 0 {
+		config.HostRate = 0
+	}
+
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+
+	if config.PauseDuration <= 0 {
+		config.PauseDuration = 30 * time.Second
+	}
+
+	if config.MaxPauseDuration < config.PauseDuration {
+		config.MaxPauseDuration = config.PauseDuration
+	}
+
+	return &Replayer{
+		dlq:     dlq,
+		handler: handler,
+		config:  config,
+		now:     time.Now,
+		hosts:   make(map[string]*replayHost),
+	}
+}
+
+// Start replays the DLQ every Interval until Stop is called
+func (r *Replayer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Failures are counted in the DLQ metrics; a failed scan is retried on the next tick
+				r.RunOnce(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the background loop, abandoning replays that have not started yet
+func (r *Replayer) Stop() {
+	r.stopOnce.Do(func() {
+		if r.cancel != nil {
+			r.cancel()
+			<-r.done
+		}
+	})
+}
+
+// RunOnce replays up to BatchSize entries that have not been flagged as permanently failed
+// Successfully replayed entries are deleted from the DLQ
+func (r *Replayer) RunOnce(ctx context.Context) (*ReplayRun, error) {
+	entries, err := r.dlq.ListFiltered(DLQFilter{ExcludePermanentlyFailed: true}, r.config.BatchSize, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	run := &ReplayRun{}
+	var runMu sync.Mutex
+	count := func(counter *int) {
+		runMu.Lock()
+		defer runMu.Unlock()
+		*counter++
+	}
+
+	slots := make(chan struct{}, r.config.Concurrency)
+	var wg sync.WaitGroup
+
+	for _, entry := range entries {
+		host := entryHost(entry.URL)
+
+		wait, ok := r.reserve(host)
+		if !ok {
+			count(&run.Skipped)
+			continue
+		}
+
+		wg.Add(1)
+		go func(id int64, host string, wait time.Duration) {
+			defer wg.Done()
+
+			if !sleepContext(ctx, wait) {
+				count(&run.Skipped)
+				return
+			}
+
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				count(&run.Skipped)
+				return
+			}
+
+			// A burst of failures may have paused the host while this replay waited
+			if r.paused(host) {
+				count(&run.Skipped)
+				return
+			}
+
+			err := r.dlq.Replay(ctx, id, r.handler)
+			switch {
+			case err == nil:
+				r.recordResult(host, true)
+				r.dlq.Delete(id)
+				count(&run.Succeeded)
+			case errors.Is(err, ErrReplayFailed):
+				r.recordResult(host, false)
+				count(&run.Failed)
+			default:
+				// Replays used up or entry already gone; says nothing about the host
+				count(&run.Skipped)
+			}
+		}(entry.ID, host, wait)
+	}
+
+	wg.Wait()
+	return run, nil
+}
+
+// reserve claims the next replay slot for a host, returning how long to wait for it,
+// or false if the host is paused
+func (r *Replayer) reserve(host string) (time.Duration, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	state := r.hostLocked(host)
+	if now.Before(state.pausedUntil) {
+		return 0, false
+	}
+
+	if r.config.HostRate == 0 {
+		return 0, true
+	}
+
+	slot := state.next
+	if slot.Before(now) {
+		slot = now
+	}
+	state.next = slot.Add(time.Duration(float64(time.Second) / r.config.HostRate))
+
+	return slot.Sub(now), true
+}
+
+// paused reports whether replays to a host are paused
+func (r *Replayer) paused(host string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.now().Before(r.hostLocked(host).pausedUntil)
+}
+
+// recordResult records a replay outcome, pausing the host once FailureThreshold
+// replays in a row have failed
+func (r *Replayer) recordResult(host string, success bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state := r.hostLocked(host)
+	if success {
+		state.failures = 0
+		state.pauses = 0
+		return
+	}
+
+	state.failures++
+	if state.failures < r.config.FailureThreshold {
+		return
+	}
+
+	pause := r.config.PauseDuration << state.pauses
+	if pause > r.config.MaxPauseDuration || pause <= 0 {
+		pause = r.config.MaxPauseDuration
+	}
+
+	state.failures = 0
+	state.pauses++
+	state.pausedUntil = r.now().Add(pause)
+
+	r.dlq.metrics.ReplayerPausesTotal.WithLabelValues(host).Inc()
+	r.updatePausedHostsLocked()
+}
+
+// hostLocked returns the state for a host, creating it if needed; r.mu must be held
+func (r *Replayer) hostLocked(host string) *replayHost {
+	state, exists := r.hosts[host]
+	if !exists {
+		state = &replayHost{}
+		r.hosts[host] = state
+	}
+
+	// Refresh the gauge as pauses expire
+	if !state.pausedUntil.IsZero() && !r.now().Before(state.pausedUntil) {
+		state.pausedUntil = time.Time{}
+		r.updatePausedHostsLocked()
+	}
+
+	return state
+}
+
+// updatePausedHostsLocked recomputes the paused hosts gauge; r.mu must be held
+func (r *Replayer) updatePausedHostsLocked() {
+	now := r.now()
+	paused := 0
+	for _, state := range r.hosts {
+		if now.Before(state.pausedUntil) {
+			paused++
+		}
+	}
+	r.dlq.metrics.ReplayerPausedHosts.Set(float64(paused))
+}
+
+// sleepContext waits for d, returning false if ctx is done first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
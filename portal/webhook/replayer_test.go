@@ -0,0 +1,240 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// newTestReplayerDLQ creates a DLQ holding n entries pointing at url
+func newTestReplayerDLQ(t *testing.T, dbPath string, n int, url string) *DLQ {
+	t.Helper()
+
+	config := DefaultDLQConfig()
+	config.Metrics = newTestDLQMetrics()
+
+	dlq, err := NewDLQWithConfig(dbPath, config)
+	if err != nil {
+		t.Fatalf("Failed to create DLQ: %v", err)
+	}
+
+	for i := 0; i < n; i++ {
+		entry := &DLQEntry{
+			Method:      "POST",
+			URL:         url,
+			Headers:     http.Header{},
+			Body:        []byte(`{"test": "data"}`),
+			StatusCode:  503,
+			LastError:   "error",
+			CreatedAt:   time.Now(),
+			LastAttempt: time.Now(),
+		}
+		if err := dlq.Add(entry); err != nil {
+			t.Fatalf("Failed to add entry: %v", err)
+		}
+	}
+
+	return dlq
+}
+
+// TestReplayerConcurrency tests that no more than Concurrency replays are in flight
+func TestReplayerConcurrency(t *testing.T) {
+	dbPath := "test_replayer_concurrency.db"
+	defer os.Remove(dbPath)
+
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dlq := newTestReplayerDLQ(t, dbPath, 12, server.URL)
+	defer dlq.Close()
+
+	replayer := NewReplayer(dlq, newTestReplayHandler(), &ReplayerConfig{Concurrency: 3})
+
+	run, err := replayer.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to run replayer: %v", err)
+	}
+
+	if run.Succeeded != 12 || run.Failed != 0 || run.Skipped != 0 {
+		t.Errorf("Expected 12 successful replays, got %+v", run)
+	}
+	if got := maxInFlight.Load(); got > 3 {
+		t.Errorf("Expected at most 3 replays in flight, got %d", got)
+	}
+
+	if count, _ := dlq.Count(); count != 0 {
+		t.Errorf("Expected replayed entries to be deleted, %d left", count)
+	}
+}
+
+// TestReplayerHostRate tests that replays to one host are paced
+func TestReplayerHostRate(t *testing.T) {
+	dbPath := "test_replayer_rate.db"
+	defer os.Remove(dbPath)
+
+	var mu sync.Mutex
+	var arrivals []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		arrivals = append(arrivals, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dlq := newTestReplayerDLQ(t, dbPath, 4, server.URL)
+	defer dlq.Close()
+
+	// 20 replays per second: one every 50ms
+	replayer := NewReplayer(dlq, newTestReplayHandler(), &ReplayerConfig{Concurrency: 4, HostRate: 20})
+
+	start := time.Now()
+	if _, err := replayer.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Failed to run replayer: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("Expected 4 replays to take at least 150ms, took %v", elapsed)
+	}
+	if len(arrivals) != 4 {
+		t.Fatalf("Expected 4 replays, got %d", len(arrivals))
+	}
+}
+
+// TestReplayerPausesFailingHost tests that a burst of failures pauses a host with growing backoff
+func TestReplayerPausesFailingHost(t *testing.T) {
+	dbPath := "test_replayer_pause.db"
+	defer os.Remove(dbPath)
+
+	var requests atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dlq := newTestReplayerDLQ(t, dbPath, 10, server.URL)
+	defer dlq.Close()
+
+	replayer := NewReplayer(dlq, newTestReplayHandler(), &ReplayerConfig{
+		Concurrency:      1,
+		FailureThreshold: 3,
+		PauseDuration:    time.Minute,
+		MaxPauseDuration: 90 * time.Second,
+	})
+	now := time.Now()
+	replayer.now = func() time.Time { return now }
+
+	// The first three failures pause the host; the remaining entries are left alone
+	run, err := replayer.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to run replayer: %v", err)
+	}
+	if run.Failed != 3 || run.Skipped != 7 {
+		t.Errorf("Expected 3 failed replays before pausing, got %+v", run)
+	}
+
+	host := entryHost(server.URL)
+	if got := pauseCount(t, dlq, host); got != 1 {
+		t.Errorf("Expected 1 pause, got %v", got)
+	}
+
+	// Nothing is sent while the host is paused
+	sent := requests.Load()
+	run, _ = replayer.RunOnce(context.Background())
+	if run.Skipped != 10 || requests.Load() != sent {
+		t.Errorf("Expected every entry to be skipped while paused, got %+v", run)
+	}
+
+	// Still failing after the pause: paused again, for longer (capped at MaxPauseDuration)
+	now = now.Add(time.Minute)
+	run, _ = replayer.RunOnce(context.Background())
+	if run.Failed != 3 {
+		t.Errorf("Expected 3 more failed replays after the pause, got %+v", run)
+	}
+
+	now = now.Add(time.Minute)
+	if !replayer.paused(host) {
+		t.Error("Expected the second pause to outlast the first")
+	}
+
+	// Recovered endpoint: remaining entries drain
+	now = now.Add(30 * time.Second)
+	healthy.Store(true)
+	run, _ = replayer.RunOnce(context.Background())
+	if run.Succeeded != 10 {
+		t.Errorf("Expected all entries to drain once the host recovered, got %+v", run)
+	}
+
+	metric := &dto.Metric{}
+	dlq.metrics.ReplayerPausedHosts.Write(metric)
+	if metric.Gauge.GetValue() != 0 {
+		t.Errorf("Expected no paused hosts, got %v", metric.Gauge.GetValue())
+	}
+}
+
+// TestReplayerStop tests that Stop ends the background loop
+func TestReplayerStop(t *testing.T) {
+	dbPath := "test_replayer_stop.db"
+	defer os.Remove(dbPath)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dlq := newTestReplayerDLQ(t, dbPath, 2, server.URL)
+	defer dlq.Close()
+
+	replayer := NewReplayer(dlq, newTestReplayHandler(), &ReplayerConfig{Interval: 10 * time.Millisecond})
+	replayer.Start()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if count, _ := dlq.Count(); count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the background loop to drain the DLQ")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	replayer.Stop()
+	replayer.Stop()
+}
+
+// pauseCount returns how often replays to host were paused
+func pauseCount(t *testing.T, dlq *DLQ, host string) float64 {
+	t.Helper()
+
+	metric := &dto.Metric{}
+	if err := dlq.metrics.ReplayerPausesTotal.WithLabelValues(host).Write(metric); err != nil {
+		t.Fatalf("Failed to read metric: %v", err)
+	}
+	return metric.Counter.GetValue()
+}
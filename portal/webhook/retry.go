@@ -2,22 +2,30 @@ package webhook
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"time"
 
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/middleware"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 // RetryMetrics holds retry metrics
 type RetryMetrics struct {
-	RetriesTotal     *prometheus.CounterVec
-	RetrySuccessTotal prometheus.Counter
-	RetryFailureTotal prometheus.Counter
-	RetryDuration    prometheus.Histogram
+	RetriesTotal                     *prometheus.CounterVec
+	RetrySuccessTotal                prometheus.Counter
+	RetryFailureTotal                prometheus.Counter
+	RetryDuration                    prometheus.Histogram
+	RetriesDroppedByBudgetTotal      prometheus.Counter
+	RetriesDroppedByTimeoutTotal     prometheus.Counter
+	StreamedUploadBytesTotal         prometheus.Counter
+	ConditionalRetryNotModifiedTotal prometheus.Counter
 }
 
 // NewRetryMetrics creates new retry metrics
@@ -60,6 +68,59 @@ func NewRetryMetricsWithRegistry(reg prometheus.Registerer) *RetryMetrics {
 				Buckets: []float64{0.1, 0.5, 1, 2, 5, 10, 30},
 			},
 		),
+		RetriesDroppedByBudgetTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "portal_webhook_retries_dropped_by_budget_total",
+				Help: "Total number of retries skipped because the retry budget was exhausted",
+			},
+		),
+		RetriesDroppedByTimeoutTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "portal_webhook_retries_dropped_by_timeout_budget_total",
+				Help: "Total number of retries skipped because the request's timeout budget ran out",
+			},
+		),
+		StreamedUploadBytesTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "portal_webhook_streamed_upload_bytes_total",
+				Help: "Total request body bytes sent upstream without being buffered for retries",
+			},
+		),
+		ConditionalRetryNotModifiedTotal: factory.NewCounter(
+			prometheus.CounterOpts{
+				Name: "portal_webhook_conditional_retry_not_modified_total",
+				Help: "Total number of conditional GET retries answered 304 and served from the remembered body",
+			},
+		),
+	}
+}
+
+// ErrTimeoutBudgetExhausted is returned when retries stop because the request's timeout budget ran out
+var ErrTimeoutBudgetExhausted = errors.New("timeout budget exhausted")
+
+// TimeoutBudgetSource selects where the deadline shared by all attempts of a request comes from
+type TimeoutBudgetSource string
+
+// Timeout budget sources
+const (
+	// TimeoutBudgetFromContext uses the request context's deadline, which the timeout
+	// middleware sets from the lease timeout; requests without a deadline are unbounded
+	TimeoutBudgetFromContext TimeoutBudgetSource = "context"
+
+	// TimeoutBudgetExplicit starts RetryConfig.TimeoutBudget at the first attempt
+	// An earlier context deadline still applies
+	TimeoutBudgetExplicit TimeoutBudgetSource = "explicit"
+)
+
+// ParseTimeoutBudgetSource parses a timeout budget source name
+func ParseTimeoutBudgetSource(name string) (TimeoutBudgetSource, error) {
+	switch source := TimeoutBudgetSource(name); source {
+	case TimeoutBudgetFromContext, TimeoutBudgetExplicit:
+		return source, nil
+	case "":
+		return TimeoutBudgetFromContext, nil
+	default:
+		return "", fmt.Errorf("unknown timeout budget source %q (want context or explicit)", name)
 	}
 }
 
@@ -80,30 +141,66 @@ type RetryConfig struct {
 	// RetryOn5xxOnly retries only on 5xx status codes
 	RetryOn5xxOnly bool
 
+	// RetryBudgetRatio caps retries as a fraction of requests across the handler
+	// (e.g. 0.1 = 10%). 0 disables the retry budget
+	RetryBudgetRatio float64
+
+	// RetryBudgetMinRetries is the number of retries always allowed per window,
+	// so low-traffic handlers can still retry
+	RetryBudgetMinRetries int
+
+	// RetryBudgetWindow is the sliding window the retry budget is measured over
+	RetryBudgetWindow time.Duration
+
+	// TimeoutBudgetSource selects the deadline shared by the first attempt and all retries
+	// Each attempt gets only the time left, and retries stop once it runs out
+	TimeoutBudgetSource TimeoutBudgetSource
+
+	// TimeoutBudget is the total time for all attempts with TimeoutBudgetExplicit
+	TimeoutBudget time.Duration
+
+	// MaxBufferedBody is the largest request body held in memory so retries can resend it
+	// Larger bodies, and bodies of unknown length, are streamed upstream in a single attempt
+	MaxBufferedBody int64
+
+	// ConditionalRetry sends the validators of the last successful response with GET retries
+	// and serves its body on 304 (nil = disabled)
+	ConditionalRetry *ConditionalRetryConfig
+
 	// Metrics is the metrics collector
 	Metrics *RetryMetrics
 
 	// DLQ is the dead letter queue for failed requests
 	DLQ *DLQ
+
+	// Clock times the backoff between attempts (nil = clock.Real); tests set a clock.Fake
+	Clock clock.Clock
 }
 
 // DefaultRetryConfig returns default retry configuration
 func DefaultRetryConfig() *RetryConfig {
 	return &RetryConfig{
-		MaxRetries:        3,
-		InitialBackoff:    1 * time.Second,
-		MaxBackoff:        30 * time.Second,
-		BackoffMultiplier: 2.0,
-		RetryOn5xxOnly:    true,
-		Metrics:           nil, // Will be created by NewRetryHandler
-		DLQ:               nil, // Will be set separately
+		MaxRetries:            3,
+		InitialBackoff:        1 * time.Second,
+		MaxBackoff:            30 * time.Second,
+		BackoffMultiplier:     2.0,
+		RetryOn5xxOnly:        true,
+		RetryBudgetRatio:      0.1,
+		RetryBudgetMinRetries: 10,
+		RetryBudgetWindow:     10 * time.Second,
+		TimeoutBudgetSource:   TimeoutBudgetFromContext,
+		MaxBufferedBody:       10 << 20,
+		Metrics:               nil, // Will be created by NewRetryHandler
+		DLQ:                   nil, // Will be set separately
 	}
 }
 
 // RetryHandler handles webhook requests with retry logic
 type RetryHandler struct {
-	config *RetryConfig
-	client *http.Client
+	config     *RetryConfig
+	client     *http.Client
+	budget     *RetryBudget    // nil when the retry budget is disabled
+	validators *validatorCache // nil when conditional retries are disabled
 }
 
 // NewRetryHandler creates a new retry handler
@@ -132,12 +229,30 @@ func NewRetryHandler(config *RetryConfig) *RetryHandler {
 		config.BackoffMultiplier = 2.0
 	}
 
-	return &RetryHandler{
+	if config.TimeoutBudgetSource == "" {
+		config.TimeoutBudgetSource = TimeoutBudgetFromContext
+	}
+
+	if config.MaxBufferedBody <= 0 {
+		config.MaxBufferedBody = 10 << 20 // 10 MB
+	}
+
+	h := &RetryHandler{
 		config: config,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
 	}
+
+	if config.RetryBudgetRatio > 0 {
+		h.budget = NewRetryBudget(config.RetryBudgetRatio, config.RetryBudgetMinRetries, config.RetryBudgetWindow)
+	}
+
+	if config.ConditionalRetry != nil {
+		h.validators = newValidatorCache(config.ConditionalRetry)
+	}
+
+	return h
 }
 
 // Do executes an HTTP request with retry logic
@@ -148,37 +263,81 @@ func (h *RetryHandler) Do(req *http.Request) (*http.Response, error) {
 		h.config.Metrics.RetryDuration.Observe(duration)
 	}()
 
-	// Save the request body for retries
-	var bodyBytes []byte
-	if req.Body != nil {
-		var err error
-		bodyBytes, err = io.ReadAll(req.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read request body: %w", err)
+	// Keep the request body available for retries, or stream it if it cannot be
+	body, err := h.prepareBody(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+
+	// A streamed body is consumed by the first attempt, so there is nothing to retry with
+	maxRetries := h.config.MaxRetries
+	if body.stream != nil {
+		maxRetries = 0
+	}
+
+	// All attempts share one deadline, so retries cannot stretch the total past the budget
+	ctx, cancel := h.timeoutBudget(req.Context(), startTime)
+	req = req.WithContext(ctx)
+	releaseBudget := true
+	defer func() {
+		if releaseBudget {
+			cancel()
 		}
-		req.Body.Close()
+	}()
+
+	// Requests that can be retried conditionally, keyed before any validators are added
+	validatorKey := ""
+	if h.validators != nil {
+		validatorKey = h.validators.key(req)
 	}
+	var sentValidators *validatorEntry
 
 	var lastErr error
 	var lastResp *http.Response
+	retries := 0
+	budgetExhausted := false
+	timeoutExhausted := false
+
+	if h.budget != nil {
+		h.budget.RecordRequest()
+	}
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		// Check the retry budget before retrying
+		if attempt > 0 && h.budget != nil && !h.budget.TryRetry() {
+			h.config.Metrics.RetriesDroppedByBudgetTotal.Inc()
+			budgetExhausted = true
+			break
+		}
 
-	for attempt := 0; attempt <= h.config.MaxRetries; attempt++ {
 		// Restore request body for each attempt
-		if bodyBytes != nil {
-			req.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		if req.Body, err = body.forAttempt(req, attempt, h.config.Metrics.StreamedUploadBytesTotal); err != nil {
+			lastErr = fmt.Errorf("failed to reopen request body: %w", err)
+			break
 		}
 
 		// Track retry attempt
 		if attempt > 0 {
+			retries = attempt
 			h.config.Metrics.RetriesTotal.WithLabelValues(fmt.Sprintf("%d", attempt)).Inc()
+
+			// Let a recovered upstream answer 304 if the response is unchanged
+			if validatorKey != "" && sentValidators == nil {
+				if sentValidators = h.validators.get(validatorKey); sentValidators != nil {
+					sentValidators.addValidators(req)
+				}
+			}
 		}
 
 		// Execute request
 		resp, err := h.client.Do(req)
 		if err != nil {
 			lastErr = err
-			if attempt < h.config.MaxRetries {
-				h.sleep(attempt)
+			if attempt < maxRetries {
+				if !h.wait(ctx, attempt) {
+					timeoutExhausted = !errors.Is(ctx.Err(), context.Canceled)
+					break
+				}
 				continue
 			}
 			break
@@ -193,32 +352,57 @@ func (h *RetryHandler) Do(req *http.Request) (*http.Response, error) {
 			resp.Body.Close()
 
 			lastErr = fmt.Errorf("request failed with status %d", resp.StatusCode)
-			if attempt < h.config.MaxRetries {
-				h.sleep(attempt)
+			if attempt < maxRetries {
+				if !h.wait(ctx, attempt) {
+					timeoutExhausted = !errors.Is(ctx.Err(), context.Canceled)
+					break
+				}
 				continue
 			}
 			break
 		}
 
-		// Success
+		// Unchanged since the remembered response, so serve its body
+		if resp.StatusCode == http.StatusNotModified && sentValidators != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			resp = sentValidators.response(resp)
+			h.config.Metrics.ConditionalRetryNotModifiedTotal.Inc()
+		} else if validatorKey != "" {
+			h.validators.remember(validatorKey, resp)
+		}
+
+		// Success; the budget is released once the caller closes the body
 		h.config.Metrics.RetrySuccessTotal.Inc()
+		releaseBudget = false
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
 		return resp, nil
 	}
 
+	if timeoutExhausted {
+		h.config.Metrics.RetriesDroppedByTimeoutTotal.Inc()
+	}
+
 	// All retries failed
 	h.config.Metrics.RetryFailureTotal.Inc()
 
-	// Store in DLQ if configured
-	if h.config.DLQ != nil {
+	// Store in DLQ if configured; a streamed body is gone, so the request could not be replayed
+	if h.config.DLQ != nil && body.stream == nil {
 		entry := &DLQEntry{
-			Method:     req.Method,
-			URL:        req.URL.String(),
-			Headers:    req.Header,
-			Body:       bodyBytes,
-			Retries:    h.config.MaxRetries,
-			LastError:  lastErr.Error(),
-			CreatedAt:  time.Now(),
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			Headers:     req.Header,
+			Body:        body.bytes(),
+			Retries:     retries,
+			LastError:   lastErr.Error(),
+			CreatedAt:   time.Now(),
 			LastAttempt: time.Now(),
+			LeaseID:     middleware.GetLeaseID(req.Context()),
+		}
+
+		// Record which tenant the request belonged to, so entries can be scoped after an incident
+		if apiKeyInfo := middleware.GetAPIKeyInfo(req.Context()); apiKeyInfo != nil {
+			entry.KeyID = apiKeyInfo.KeyID
 		}
 
 		if lastResp != nil {
@@ -231,13 +415,126 @@ func (h *RetryHandler) Do(req *http.Request) (*http.Response, error) {
 		}
 	}
 
+	if budgetExhausted {
+		return nil, fmt.Errorf("request failed after %d retries: %w: %w", retries, ErrRetryBudgetExhausted, lastErr)
+	}
+
+	if timeoutExhausted {
+		return nil, fmt.Errorf("request failed after %d retries: %w: %w", retries, ErrTimeoutBudgetExhausted, lastErr)
+	}
+
 	if lastErr != nil {
-		return nil, fmt.Errorf("request failed after %d retries: %w", h.config.MaxRetries, lastErr)
+		return nil, fmt.Errorf("request failed after %d retries: %w", retries, lastErr)
 	}
 
 	return lastResp, nil
 }
 
+// requestBody supplies a request's body to each attempt
+type requestBody struct {
+	buffered []byte                        // Held in memory and resent by every attempt
+	reopen   func() (io.ReadCloser, error) // Reopened for each retry (http.Request.GetBody)
+	stream   io.ReadCloser                 // Sent once as it arrives; the request is not retried
+}
+
+// prepareBody decides how a request's body is supplied to its attempts
+// Bodies the caller can reopen are never copied; otherwise bodies of known length up to
+// MaxBufferedBody are buffered, and everything else is streamed
+func (h *RetryHandler) prepareBody(req *http.Request) (*requestBody, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return &requestBody{}, nil
+	}
+
+	if req.GetBody != nil {
+		return &requestBody{reopen: req.GetBody}, nil
+	}
+
+	// Unknown length means the client is still sending; waiting for all of it would stall the upload
+	if req.ContentLength < 0 || req.ContentLength > h.config.MaxBufferedBody {
+		return &requestBody{stream: req.Body}, nil
+	}
+
+	// Content-Length is the client's claim; the cap holds even if more arrives
+	buffered, err := io.ReadAll(io.LimitReader(req.Body, h.config.MaxBufferedBody+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(buffered)) > h.config.MaxBufferedBody {
+		return &requestBody{stream: &replayedReadCloser{
+			Reader: io.MultiReader(bytes.NewReader(buffered), req.Body),
+			Closer: req.Body,
+		}}, nil
+	}
+
+	req.Body.Close()
+	return &requestBody{buffered: buffered}, nil
+}
+
+// forAttempt returns the body to send with an attempt, counting bytes that were not buffered
+func (b *requestBody) forAttempt(req *http.Request, attempt int, streamed prometheus.Counter) (io.ReadCloser, error) {
+	switch {
+	case b.buffered != nil:
+		return io.NopCloser(bytes.NewReader(b.buffered)), nil
+	case b.stream != nil:
+		return &countingReadCloser{ReadCloser: b.stream, counter: streamed}, nil
+	case b.reopen != nil:
+		body := req.Body
+		if attempt > 0 {
+			var err error
+			if body, err = b.reopen(); err != nil {
+				return nil, err
+			}
+		}
+		return &countingReadCloser{ReadCloser: body, counter: streamed}, nil
+	default:
+		return req.Body, nil
+	}
+}
+
+// bytes returns the body for a DLQ entry, or nil if it can no longer be read
+func (b *requestBody) bytes() []byte {
+	if b.buffered != nil {
+		return b.buffered
+	}
+
+	if b.reopen != nil {
+		body, err := b.reopen()
+		if err != nil {
+			return nil
+		}
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+
+	return nil
+}
+
+// replayedReadCloser reads an already consumed prefix before the rest of a body
+type replayedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// countingReadCloser counts the bytes read from a request body
+type countingReadCloser struct {
+	io.ReadCloser
+	counter prometheus.Counter
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.counter.Add(float64(n))
+	}
+	return n, err
+}
+
 // shouldRetry checks if a request should be retried based on status code
 func (h *RetryHandler) shouldRetry(statusCode int) bool {
 	if h.config.RetryOn5xxOnly {
@@ -249,10 +546,40 @@ func (h *RetryHandler) shouldRetry(statusCode int) bool {
 	return statusCode >= 400
 }
 
-// sleep sleeps for the backoff duration based on the attempt number
-func (h *RetryHandler) sleep(attempt int) {
+// timeoutBudget returns the context all attempts of a request share
+func (h *RetryHandler) timeoutBudget(ctx context.Context, start time.Time) (context.Context, context.CancelFunc) {
+	if h.config.TimeoutBudgetSource == TimeoutBudgetExplicit && h.config.TimeoutBudget > 0 {
+		return context.WithDeadline(ctx, start.Add(h.config.TimeoutBudget))
+	}
+	return context.WithCancel(ctx)
+}
+
+// wait sleeps for the backoff before the next attempt
+// It returns false, without sleeping, when the budget would run out before the retry could start
+func (h *RetryHandler) wait(ctx context.Context, attempt int) bool {
 	backoff := h.calculateBackoff(attempt)
-	time.Sleep(backoff)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+		return false
+	}
+
+	select {
+	case <-clock.Or(h.config.Clock).After(backoff):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// cancelOnClose releases a request's timeout budget when the response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
 }
 
 // calculateBackoff calculates the backoff duration for a given attempt
@@ -1,13 +1,20 @@
 package webhook
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/portal-project/portal-gateway/portal/clock"
+	"github.com/portal-project/portal-gateway/portal/middleware"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // newTestRetryMetrics creates new retry metrics for testing with a fresh registry
@@ -129,6 +136,57 @@ func TestRetryHandlerRetryOn5xx(t *testing.T) {
 	}
 }
 
+func TestRetryHandlerBackoffClock(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	config := &RetryConfig{
+		MaxRetries:     1,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     time.Minute,
+		Metrics:        newTestRetryMetrics(),
+		Clock:          fake,
+	}
+	handler := NewRetryHandler(config)
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := handler.Do(req)
+		if err != nil {
+			t.Errorf("Expected no error, got %v", err)
+		}
+		done <- resp
+	}()
+
+	// The retry waits for the fake clock rather than a minute of real time
+	fake.BlockUntil(1)
+	fake.Advance(time.Minute)
+
+	resp := <-done
+	if resp == nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the retry to succeed, got %v", resp)
+	}
+	resp.Body.Close()
+
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
 func TestRetryHandlerMaxRetriesExceeded(t *testing.T) {
 	config := &RetryConfig{
 		MaxRetries:     2,
@@ -246,6 +304,106 @@ func TestRetryHandlerWithBody(t *testing.T) {
 	}
 }
 
+// TestRetryHandlerBodyBuffering tests which request bodies are buffered for retries and which are streamed
+func TestRetryHandlerBodyBuffering(t *testing.T) {
+	tests := []struct {
+		name             string
+		body             string
+		contentLength    int64
+		expectedAttempts int
+		expectStreamed   bool
+	}{
+		{"known length within cap is buffered", "small body", 10, 3, false},
+		{"known length over cap is streamed", "a much larger request body", 26, 1, true},
+		{"unknown length is streamed", "small body", -1, 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := newTestRetryMetrics()
+			handler := NewRetryHandler(&RetryConfig{
+				MaxRetries:      2,
+				InitialBackoff:  time.Millisecond,
+				MaxBufferedBody: 16,
+				Metrics:         metrics,
+			})
+
+			var received []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = append(received, string(body))
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}))
+			defer server.Close()
+
+			// A plain io.Reader has no GetBody, so the handler cannot reopen it
+			req, err := http.NewRequest("POST", server.URL, io.NopCloser(strings.NewReader(tt.body)))
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+			req.ContentLength = tt.contentLength
+
+			handler.Do(req)
+
+			if len(received) != tt.expectedAttempts {
+				t.Fatalf("Expected %d attempts, got %d", tt.expectedAttempts, len(received))
+			}
+			for i, body := range received {
+				if body != tt.body {
+					t.Errorf("Attempt %d: expected body %q, got %q", i+1, tt.body, body)
+				}
+			}
+
+			metric := &dto.Metric{}
+			metrics.StreamedUploadBytesTotal.Write(metric)
+			expected := 0.0
+			if tt.expectStreamed {
+				expected = float64(len(tt.body))
+			}
+			if metric.Counter.GetValue() != expected {
+				t.Errorf("Expected %v streamed bytes, got %v", expected, metric.Counter.GetValue())
+			}
+		})
+	}
+}
+
+// TestRetryHandlerReopensBody tests that bodies with GetBody are resent without being buffered
+func TestRetryHandlerReopensBody(t *testing.T) {
+	metrics := newTestRetryMetrics()
+	handler := NewRetryHandler(&RetryConfig{
+		MaxRetries:      1,
+		InitialBackoff:  time.Millisecond,
+		MaxBufferedBody: 4,
+		Metrics:         metrics,
+	})
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	// Larger than MaxBufferedBody, but http.NewRequest sets GetBody for a strings.Reader
+	req, err := http.NewRequest("POST", server.URL, strings.NewReader("reopened body"))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	handler.Do(req)
+
+	if len(received) != 2 || received[1] != "reopened body" {
+		t.Errorf("Expected the body to be resent on retry, got %q", received)
+	}
+
+	metric := &dto.Metric{}
+	metrics.StreamedUploadBytesTotal.Write(metric)
+	if metric.Counter.GetValue() != 26 {
+		t.Errorf("Expected 26 streamed bytes, got %v", metric.Counter.GetValue())
+	}
+}
+
 func TestCalculateBackoff(t *testing.T) {
 	config := &RetryConfig{
 		InitialBackoff:    1 * time.Second,
@@ -351,3 +509,238 @@ func TestGetMetrics(t *testing.T) {
 		t.Error("Expected GetMetrics to return the same metrics instance")
 	}
 }
+
+func TestRetryHandlerRetryBudgetExhausted(t *testing.T) {
+	metrics := newTestRetryMetrics()
+	config := &RetryConfig{
+		MaxRetries:            3,
+		InitialBackoff:        time.Millisecond,
+		MaxBackoff:            10 * time.Millisecond,
+		RetryBudgetRatio:      0.1,
+		RetryBudgetMinRetries: 1,
+		RetryBudgetWindow:     time.Minute,
+		Metrics:               metrics,
+	}
+	handler := NewRetryHandler(config)
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	_, err = handler.Do(req)
+	if !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Errorf("Expected ErrRetryBudgetExhausted, got %v", err)
+	}
+
+	// Initial attempt plus the single retry allowed by the budget
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+
+	// Budget stays exhausted for the next request
+	attempts = 0
+	if _, err := handler.Do(req); !errors.Is(err, ErrRetryBudgetExhausted) {
+		t.Errorf("Expected ErrRetryBudgetExhausted, got %v", err)
+	}
+
+	if attempts != 1 {
+		t.Errorf("Expected 1 attempt with no budget left, got %d", attempts)
+	}
+}
+
+// TestRetryHandlerDLQRecordsOrigin tests that DLQ entries record the API key from the request context
+func TestRetryHandlerDLQRecordsOrigin(t *testing.T) {
+	dbPath := "test_retry_dlq_origin.db"
+	defer os.Remove(dbPath)
+
+	dlq, err := NewDLQWithMetrics(dbPath, newTestDLQMetrics())
+	if err != nil {
+		t.Fatalf("Failed to create DLQ: %v", err)
+	}
+	defer dlq.Close()
+
+	config := &RetryConfig{
+		MaxRetries: 0,
+		Metrics:    newTestRetryMetrics(),
+		DLQ:        dlq,
+	}
+	handler := NewRetryHandler(config)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest("POST", server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	info := &middleware.APIKeyInfo{KeyID: "tenant-key"}
+	req = req.WithContext(context.WithValue(req.Context(), middleware.ContextKeyAPIKey, info))
+
+	if _, err := handler.Do(req); err == nil {
+		t.Fatal("Expected error for failed request")
+	}
+
+	entries, err := dlq.ListFiltered(DLQFilter{KeyID: "tenant-key"}, 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to list entries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 entry for tenant-key, got %d", len(entries))
+	}
+}
+
+// TestRetryHandlerTimeoutBudget tests that all attempts share one deadline, from either source
+func TestRetryHandlerTimeoutBudget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		source TimeoutBudgetSource
+		budget time.Duration
+		ctx    func() (context.Context, context.CancelFunc)
+	}{
+		{
+			name:   "explicit",
+			source: TimeoutBudgetExplicit,
+			budget: 150 * time.Millisecond,
+			ctx:    func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+		},
+		{
+			name:   "context deadline",
+			source: TimeoutBudgetFromContext,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 150*time.Millisecond)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := newTestRetryMetrics()
+			handler := NewRetryHandler(&RetryConfig{
+				MaxRetries:          10,
+				InitialBackoff:      40 * time.Millisecond,
+				MaxBackoff:          40 * time.Millisecond,
+				BackoffMultiplier:   1,
+				TimeoutBudgetSource: tt.source,
+				TimeoutBudget:       tt.budget,
+				Metrics:             metrics,
+			})
+
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+			if err != nil {
+				t.Fatalf("Failed to create request: %v", err)
+			}
+
+			start := time.Now()
+			_, err = handler.Do(req)
+			elapsed := time.Since(start)
+
+			if !errors.Is(err, ErrTimeoutBudgetExhausted) {
+				t.Errorf("Expected ErrTimeoutBudgetExhausted, got %v", err)
+			}
+			if elapsed > 300*time.Millisecond {
+				t.Errorf("Expected retries to stop within the budget, took %v", elapsed)
+			}
+			m := &dto.Metric{}
+			metrics.RetriesDroppedByTimeoutTotal.Write(m)
+			if got := m.Counter.GetValue(); got != 1 {
+				t.Errorf("Expected 1 request dropped by the timeout budget, got %v", got)
+			}
+		})
+	}
+}
+
+// TestRetryHandlerTimeoutBudgetBoundsAttempts tests that a slow attempt only gets the time left in the budget
+func TestRetryHandlerTimeoutBudgetBoundsAttempts(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+
+	handler := NewRetryHandler(&RetryConfig{
+		MaxRetries:          3,
+		InitialBackoff:      time.Millisecond,
+		TimeoutBudgetSource: TimeoutBudgetExplicit,
+		TimeoutBudget:       100 * time.Millisecond,
+		Metrics:             newTestRetryMetrics(),
+	})
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	start := time.Now()
+	if _, err := handler.Do(req); !errors.Is(err, ErrTimeoutBudgetExhausted) {
+		t.Errorf("Expected ErrTimeoutBudgetExhausted, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected the attempt to be cut off at the budget, took %v", elapsed)
+	}
+}
+
+// TestRetryHandlerTimeoutBudgetKeepsBodyReadable tests that a successful response outlives Do
+func TestRetryHandlerTimeoutBudgetKeepsBodyReadable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	handler := NewRetryHandler(&RetryConfig{
+		TimeoutBudgetSource: TimeoutBudgetExplicit,
+		TimeoutBudget:       time.Second,
+		Metrics:             newTestRetryMetrics(),
+	})
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	resp, err := handler.Do(req)
+	if err != nil {
+		t.Fatalf("Expected success, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "ok" {
+		t.Errorf("Expected body %q, got %q (%v)", "ok", body, err)
+	}
+}
+
+// TestParseTimeoutBudgetSource tests parsing timeout budget source names
+func TestParseTimeoutBudgetSource(t *testing.T) {
+	for name, want := range map[string]TimeoutBudgetSource{
+		"":         TimeoutBudgetFromContext,
+		"context":  TimeoutBudgetFromContext,
+		"explicit": TimeoutBudgetExplicit,
+	} {
+		if got, err := ParseTimeoutBudgetSource(name); err != nil || got != want {
+			t.Errorf("ParseTimeoutBudgetSource(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+
+	if _, err := ParseTimeoutBudgetSource("lease"); err == nil {
+		t.Error("Expected an error for an unknown source")
+	}
+}